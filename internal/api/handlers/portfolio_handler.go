@@ -63,13 +63,15 @@ func (h *PortfolioHandler) GetPortfolioSummary(c *gin.Context) {
 
 	// Update weights for each stock (batch update to avoid N+1)
 	if metrics.TotalValue > 0 && len(stocks) > 0 {
+		// Rates are currency units per 1 EUR, matching metrics.TotalValue (EUR).
 		for i := range stocks {
 			fxRate := fxRates[stocks[i].Currency]
-			if fxRate == 0 {
-				fxRate = 1.0
+			if fxRate <= 0 || stocks[i].SharesOwned <= 0 {
+				stocks[i].Weight = 0
+				continue
 			}
-			valueUSD := float64(stocks[i].SharesOwned) * stocks[i].CurrentPrice * fxRate
-			stocks[i].Weight = (valueUSD / metrics.TotalValue) * 100
+			valueEUR := float64(stocks[i].SharesOwned) * stocks[i].CurrentPrice / fxRate
+			stocks[i].Weight = (valueEUR / metrics.TotalValue) * 100
 		}
 
 		// Batch update all stocks at once
@@ -197,7 +197,7 @@ func (h *StockHandler) UpdateStock(c *gin.Context) {
 	}
 
 	// Recalculate metrics
-	services.CalculateMetrics(&stock)
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 	h.db.Save(&stock)
 
 	h.logger.Info().Str("ticker", stock.Ticker).Msg("Stock updated successfully")
@@ -228,7 +228,7 @@ func (h *StockHandler) UpdateStockPrice(c *gin.Context) {
 	stock.LastUpdated = time.Now()
 
 	// Recalculate all derived metrics based on new price
-	services.CalculateMetrics(&stock)
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 
 	// Get FX rate for USD conversion
 	fxRate, err := h.apiService.FetchExchangeRate(stock.Currency)
@@ -289,7 +289,7 @@ func (h *StockHandler) UpdateStockField(c *gin.Context) {
 	stock.LastUpdated = time.Now()
 
 	// Recalculate all derived metrics
-	services.CalculateMetrics(&stock)
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 
 	// Get FX rate for USD conversion
 	fxRate, err := h.apiService.FetchExchangeRate(stock.Currency)
@@ -411,7 +411,7 @@ func (h *StockHandler) UpdateSingleStock(c *gin.Context) {
 		h.logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to update stock data from API, using mock data")
 		// Don't return error - the updateStockData should have fallback to mock data
 		// Try to at least recalculate metrics with existing data
-		services.CalculateMetrics(&stock)
+		services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 		h.db.Save(&stock)
 	}
 
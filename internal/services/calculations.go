@@ -4,11 +4,12 @@ import (
 	"math"
 
 	"github.com/art-pro/stock-backend/internal/models"
+	pkgmodels "github.com/art-pro/stock-backend/pkg/models"
+	pkgservices "github.com/art-pro/stock-backend/pkg/services"
 )
 
 const (
 	defaultProbabilityPositive = 0.65
-	riskFreeRatePercent        = 4.0
 	minDownsideMagnitude       = 0.1
 )
 
@@ -101,69 +102,30 @@ func CalculateMetrics(stock *models.Stock) {
 	}
 }
 
-// CalculatePortfolioMetrics calculates portfolio-level metrics
-func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64) PortfolioMetrics {
-	var totalValue float64
-	stockValues := make([]float64, len(stocks))
-
-	// First pass: calculate total portfolio value in USD.
-	for i, stock := range stocks {
-		if stock.SharesOwned <= 0 {
-			continue
-		}
-
-		fxRate := fxRates[stock.Currency]
-		if fxRate <= 0 {
-			continue
-		}
-
-		valueEUR := float64(stock.SharesOwned) * stock.CurrentPrice / fxRate
-		stockValues[i] = valueEUR
-		totalValue += valueEUR
-	}
-
-	var weightedEV float64
-	var weightedVolatility float64
-	sectorWeights := make(map[string]float64)
-	kellyUtilization := 0.0
+// PortfolioMetrics is the portfolio summary produced by the pkg calculation engine.
+type PortfolioMetrics = pkgservices.PortfolioMetrics
 
-	// Second pass: calculate weighted aggregates.
+// CalculatePortfolioMetrics values the portfolio with the pkg calculation engine, so this tree and
+// pkg report the same totals: FX rates are currency units per 1 EUR, values are in EUR and sector
+// weights are fractions 0–1.
+func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64) PortfolioMetrics {
+	converted := make([]pkgmodels.Stock, len(stocks))
 	for i, stock := range stocks {
-		if stock.SharesOwned <= 0 {
-			continue
-		}
-
-		if totalValue > 0 && stockValues[i] > 0 {
-			weight := stockValues[i] / totalValue
-			weightedEV += stock.ExpectedValue * weight
-			weightedVolatility += stock.Volatility * weight
-			sectorWeights[stock.Sector] += weight * 100
-			kellyUtilization += weight * 100
+		converted[i] = pkgmodels.Stock{
+			ID:                 stock.ID,
+			Ticker:             stock.Ticker,
+			CompanyName:        stock.CompanyName,
+			Sector:             stock.Sector,
+			Currency:           stock.Currency,
+			CurrentPrice:       stock.CurrentPrice,
+			FairValue:          stock.FairValue,
+			ExpectedValue:      stock.ExpectedValue,
+			Volatility:         stock.Volatility,
+			Beta:               stock.Beta,
+			KellyFraction:      stock.KellyFraction,
+			HalfKellySuggested: stock.HalfKellySuggested,
+			SharesOwned:        stock.SharesOwned,
 		}
 	}
-
-	// Sharpe Ratio = (Rp - Rf) / sigma, using weighted EV as Rp proxy.
-	sharpeRatio := 0.0
-	if weightedVolatility > 0 {
-		sharpeRatio = (weightedEV - riskFreeRatePercent) / weightedVolatility
-	}
-
-	return PortfolioMetrics{
-		TotalValue:         totalValue,
-		OverallEV:          weightedEV,
-		WeightedVolatility: weightedVolatility,
-		SharpeRatio:        sharpeRatio,
-		KellyUtilization:   kellyUtilization,
-		SectorWeights:      sectorWeights,
-	}
-}
-
-// PortfolioMetrics holds portfolio-level aggregated metrics
-type PortfolioMetrics struct {
-	TotalValue         float64            `json:"total_value"`
-	OverallEV          float64            `json:"overall_ev"`
-	WeightedVolatility float64            `json:"weighted_volatility"`
-	SharpeRatio        float64            `json:"sharpe_ratio"`
-	KellyUtilization   float64            `json:"kelly_utilization"`
-	SectorWeights      map[string]float64 `json:"sector_weights"`
+	return pkgservices.CalculatePortfolioMetrics(converted, fxRates, "EUR", pkgservices.DefaultMetricsConfig())
 }
@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/art-pro/stock-backend/internal/models"
+	pkgmodels "github.com/art-pro/stock-backend/pkg/models"
+	pkgservices "github.com/art-pro/stock-backend/pkg/services"
 )
 
 func assertClose(t *testing.T, got, want, tol float64, field string) {
@@ -91,29 +93,34 @@ func TestCalculatePortfolioMetrics(t *testing.T) {
 			Sector:        "Health",
 		},
 	}
+	// Rates are currency units per 1 EUR: 1,000 USD is 500 EUR, next to 1,000 EUR.
 	fxRates := map[string]float64{
-		"USD": 1,
-		"EUR": 2,
+		"EUR": 1,
+		"USD": 2,
 	}
 
 	metrics := CalculatePortfolioMetrics(stocks, fxRates)
 
 	assertClose(t, metrics.TotalValue, 1500, 0.01, "TotalValue")
-	assertClose(t, metrics.OverallEV, 3.6667, 0.01, "OverallEV")
-	assertClose(t, metrics.WeightedVolatility, 13.3333, 0.01, "WeightedVolatility")
-	assertClose(t, metrics.SharpeRatio, -0.025, 0.01, "SharpeRatio")
+	assertClose(t, metrics.OverallEV, 2.3333, 0.01, "OverallEV")
+	// sqrt(w'Σw) at the default 0.3 correlation, below the linear 16.67
+	assertClose(t, metrics.WeightedVolatility, 14.6818, 0.01, "WeightedVolatility")
+	assertClose(t, metrics.NaiveVolatility, 16.6667, 0.01, "NaiveVolatility")
+	if metrics.SharpeRatio == nil {
+		t.Error("SharpeRatio: expected a value for two valued positions with volatility")
+	}
 	assertClose(t, metrics.KellyUtilization, 100, 0.01, "KellyUtilization")
 
-	// Note: internal/services uses percentage values (0-100), not fractions (0-1)
-	assertClose(t, metrics.SectorWeights["Tech"], 66.6667, 0.05, "SectorWeights[Tech]")
-	assertClose(t, metrics.SectorWeights["Health"], 33.3333, 0.05, "SectorWeights[Health]")
+	// Sector weights are fractions (0-1), as in pkg/services
+	assertClose(t, metrics.SectorWeights["Tech"], 0.3333, 0.0005, "SectorWeights[Tech]")
+	assertClose(t, metrics.SectorWeights["Health"], 0.6667, 0.0005, "SectorWeights[Health]")
 
 	// Verify total sector weights
 	totalWeight := 0.0
 	for _, weight := range metrics.SectorWeights {
 		totalWeight += weight
 	}
-	assertClose(t, totalWeight, 100.0, 0.1, "Total sector weights")
+	assertClose(t, totalWeight, 1.0, 0.001, "Total sector weights")
 }
 
 func TestCalculatePortfolioMetricsEmpty(t *testing.T) {
@@ -153,8 +160,52 @@ func TestCalculatePortfolioMetricsWithZeroShares(t *testing.T) {
 	metrics := CalculatePortfolioMetrics(stocks, fxRates)
 
 	assertClose(t, metrics.TotalValue, 1000, 0.01, "TotalValue")
-	assertClose(t, metrics.SectorWeights["Tech"], 100.0, 0.01, "SectorWeights[Tech]")
+	assertClose(t, metrics.SectorWeights["Tech"], 1.0, 0.0001, "SectorWeights[Tech]")
 	if _, exists := metrics.SectorWeights["Ignored"]; exists {
 		t.Errorf("Sector weights should not include stocks with SharesOwned=0")
 	}
 }
+
+// Weights must come from the full total (two passes), not a running total, and match
+// the pkg implementation this tree delegates to.
+func TestCalculatePortfolioMetricsMatchesPkgWeights(t *testing.T) {
+	t.Parallel()
+	type position struct {
+		shares           int
+		price, ev, vol   float64
+		currency, sector string
+	}
+	positions := []position{
+		{shares: 10, price: 100, ev: 12, vol: 30, currency: "EUR", sector: "Tech"},  // 1,000 EUR
+		{shares: 20, price: 150, ev: 4, vol: 20, currency: "USD", sector: "Health"}, // 2,500 EUR
+		{shares: 0, price: 500, ev: 50, vol: 90, currency: "EUR", sector: "Closed"}, // excluded
+		{shares: 5, price: 300, ev: -2, vol: 10, currency: "DKK", sector: "Energy"}, // 200 EUR
+	}
+	fxRates := map[string]float64{"EUR": 1, "USD": 1.2, "DKK": 7.5}
+
+	internalStocks := make([]models.Stock, len(positions))
+	pkgStocks := make([]pkgmodels.Stock, len(positions))
+	for i, p := range positions {
+		internalStocks[i] = models.Stock{SharesOwned: p.shares, CurrentPrice: p.price, ExpectedValue: p.ev, Volatility: p.vol, Currency: p.currency, Sector: p.sector}
+		pkgStocks[i] = pkgmodels.Stock{SharesOwned: p.shares, CurrentPrice: p.price, ExpectedValue: p.ev, Volatility: p.vol, Currency: p.currency, Sector: p.sector}
+	}
+
+	got := CalculatePortfolioMetrics(internalStocks, fxRates)
+	want := pkgservices.CalculatePortfolioMetrics(pkgStocks, fxRates, "EUR", pkgservices.DefaultMetricsConfig())
+
+	assertClose(t, got.TotalValue, 3700, 0.01, "TotalValue")
+	assertClose(t, got.SectorWeights["Tech"], 1000.0/3700, 0.0001, "SectorWeights[Tech]")
+	assertClose(t, got.SectorWeights["Health"], 2500.0/3700, 0.0001, "SectorWeights[Health]")
+	assertClose(t, got.SectorWeights["Energy"], 200.0/3700, 0.0001, "SectorWeights[Energy]")
+	if _, exists := got.SectorWeights["Closed"]; exists {
+		t.Errorf("Sector weights should not include stocks with SharesOwned=0")
+	}
+
+	assertClose(t, got.TotalValue, want.TotalValue, 0.0001, "TotalValue vs pkg")
+	assertClose(t, got.OverallEV, want.OverallEV, 0.0001, "OverallEV vs pkg")
+	assertClose(t, got.WeightedVolatility, want.WeightedVolatility, 0.0001, "WeightedVolatility vs pkg")
+	assertClose(t, got.KellyUtilization, want.KellyUtilization, 0.0001, "KellyUtilization vs pkg")
+	for sector, weight := range want.SectorWeights {
+		assertClose(t, got.SectorWeights[sector], weight, 0.0001, "SectorWeights["+sector+"] vs pkg")
+	}
+}
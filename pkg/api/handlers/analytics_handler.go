@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -16,13 +17,16 @@ import (
 type AnalyticsHandler struct {
 	db     *gorm.DB
 	logger zerolog.Logger
+
+	evHistoryBatchSize int // StockHistory rows GetEVHistory reads per query
 }
 
 // NewAnalyticsHandler creates a new analytics handler
 func NewAnalyticsHandler(db *gorm.DB, logger zerolog.Logger) *AnalyticsHandler {
 	return &AnalyticsHandler{
-		db:     db,
-		logger: logger,
+		db:                 db,
+		logger:             logger,
+		evHistoryBatchSize: defaultEVHistoryBatchSize,
 	}
 }
 
@@ -306,3 +310,212 @@ func (h *AnalyticsHandler) insertSorted(list *[]MoverData, item MoverData, limit
 		*list = (*list)[:limit]
 	}
 }
+
+// maxEVHistoryBuckets caps the number of points returned by GetEVHistory.
+// Wider ranges are downsampled by widening each bucket.
+const maxEVHistoryBuckets = 366
+
+// defaultEVHistoryBatchSize is how many StockHistory rows GetEVHistory loads at a time. Rows are folded
+// into buckets as they arrive, so memory depends on stocks and buckets, not on the rows in the range.
+const defaultEVHistoryBatchSize = 1000
+
+// EVHistoryPoint is one bucket of the portfolio EV time series.
+type EVHistoryPoint struct {
+	Date      string  `json:"date"` // bucket start, YYYY-MM-DD
+	OverallEV float64 `json:"overall_ev"`
+	Positions int     `json:"positions"`
+}
+
+// EVHistoryResponse is the response for the portfolio EV heatmap series.
+type EVHistoryResponse struct {
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Granularity string           `json:"granularity"`
+	BucketDays  int              `json:"bucket_days"`
+	Downsampled bool             `json:"downsampled"`
+	Points      []EVHistoryPoint `json:"points"`
+}
+
+// GetEVHistory returns portfolio-level weighted EV over time, bucketed by day or week.
+// Each bucket uses the latest StockHistory snapshot per stock known at the end of the bucket.
+func (h *AnalyticsHandler) GetEVHistory(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", "day")
+	baseDays := 1
+	switch granularity {
+	case "day":
+	case "week":
+		baseDays = 7
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid granularity. Use day or week"})
+		return
+	}
+
+	from, to, err := parseDateRange(c, 90)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if granularity == "week" {
+		// Align weekly buckets to Monday
+		offset := (int(from.Weekday()) + 6) % 7
+		from = from.AddDate(0, 0, -offset)
+	}
+
+	totalDays := int(to.Sub(from).Hours()/24) + 1
+	bucketDays := baseDays
+	downsampled := false
+	if totalDays > maxEVHistoryBuckets*baseDays {
+		factor := (totalDays + maxEVHistoryBuckets*baseDays - 1) / (maxEVHistoryBuckets * baseDays)
+		bucketDays = baseDays * factor
+		downsampled = true
+	}
+	bucketCount := (totalDays + bucketDays - 1) / bucketDays
+
+	builder := newEVHistoryBuilder(from, bucketDays, bucketCount)
+
+	// Each stock's latest snapshot before the range seeds the carried-forward state.
+	var seeds []models.StockHistory
+	if err := h.db.Where("portfolio_id = ? AND recorded_at = (SELECT MAX(prior.recorded_at) FROM stock_histories prior WHERE prior.stock_id = stock_histories.stock_id AND prior.recorded_at < ?)", portfolioID, from).
+		Find(&seeds).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stock history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock history"})
+		return
+	}
+	builder.add(seeds)
+
+	end := to.AddDate(0, 0, 1)
+	var batch []models.StockHistory
+	if err := h.db.Where("portfolio_id = ? AND recorded_at >= ? AND recorded_at < ?", portfolioID, from, end).
+		FindInBatches(&batch, h.evHistoryBatchSize, func(tx *gorm.DB, _ int) error {
+			builder.add(batch)
+			return nil
+		}).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stock history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock history"})
+		return
+	}
+
+	points := builder.points()
+
+	c.Header("Cache-Control", "private, max-age=300, stale-while-revalidate=600")
+	c.JSON(http.StatusOK, EVHistoryResponse{
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		Granularity: granularity,
+		BucketDays:  bucketDays,
+		Downsampled: downsampled,
+		Points:      points,
+	})
+}
+
+// parseDateRange reads the from/to query params (YYYY-MM-DD, UTC). to defaults to today and
+// from defaults to defaultDays before to.
+func parseDateRange(c *gin.Context, defaultDays int) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if toParam := c.Query("to"); toParam != "" {
+		parsed, err := time.Parse("2006-01-02", toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid to date. Use YYYY-MM-DD")
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -defaultDays)
+	if fromParam := c.Query("from"); fromParam != "" {
+		parsed, err := time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid from date. Use YYYY-MM-DD")
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// evHistoryBuilder folds StockHistory rows, in any order, into the latest snapshot per stock per
+// bucket. Rows before start seed the state carried into the first bucket; rows past the last bucket
+// are ignored.
+type evHistoryBuilder struct {
+	start       time.Time
+	bucketDays  int
+	bucketCount int
+	seed        map[uint]models.StockHistory
+	buckets     []map[uint]models.StockHistory
+}
+
+func newEVHistoryBuilder(start time.Time, bucketDays, bucketCount int) *evHistoryBuilder {
+	return &evHistoryBuilder{
+		start:       start,
+		bucketDays:  bucketDays,
+		bucketCount: bucketCount,
+		seed:        make(map[uint]models.StockHistory),
+		buckets:     make([]map[uint]models.StockHistory, bucketCount),
+	}
+}
+
+// add keeps each row if it is the stock's latest in its bucket. Of rows recorded at the same time,
+// the last one added wins.
+func (b *evHistoryBuilder) add(histories []models.StockHistory) {
+	for _, snap := range histories {
+		target := b.seed
+		if !snap.RecordedAt.Before(b.start) {
+			idx := int(snap.RecordedAt.Sub(b.start) / (time.Duration(b.bucketDays) * 24 * time.Hour))
+			if idx >= b.bucketCount {
+				continue
+			}
+			if b.buckets[idx] == nil {
+				b.buckets[idx] = make(map[uint]models.StockHistory)
+			}
+			target = b.buckets[idx]
+		}
+		if existing, ok := target[snap.StockID]; ok && snap.RecordedAt.Before(existing.RecordedAt) {
+			continue
+		}
+		target[snap.StockID] = snap
+	}
+}
+
+// points emits one point per bucket that has at least one weighted position, carrying each stock's
+// latest snapshot forward. Weighted EV = sum(weight * EV) / sum(weight) over the latest snapshot of
+// each stock; stocks with zero weight (not owned) are ignored.
+func (b *evHistoryBuilder) points() []EVHistoryPoint {
+	points := make([]EVHistoryPoint, 0, b.bucketCount)
+	latest := b.seed
+
+	for i := 0; i < b.bucketCount; i++ {
+		for stockID, snap := range b.buckets[i] {
+			latest[stockID] = snap
+		}
+
+		var weightedEV, totalWeight float64
+		positions := 0
+		for _, snap := range latest {
+			if snap.Weight <= 0 {
+				continue
+			}
+			weightedEV += snap.Weight * snap.ExpectedValue
+			totalWeight += snap.Weight
+			positions++
+		}
+		if totalWeight <= 0 {
+			continue
+		}
+
+		points = append(points, EVHistoryPoint{
+			Date:      b.start.AddDate(0, 0, i*b.bucketDays).Format("2006-01-02"),
+			OverallEV: weightedEV / totalWeight,
+			Positions: positions,
+		})
+	}
+
+	return points
+}
@@ -306,3 +306,148 @@ func TestBuildTopMoversLists(t *testing.T) {
 		t.Errorf("expected 2 EV drops, got %d", len(result.BiggestEVDrops))
 	}
 }
+
+func TestGetEVHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupAnalyticsTestDB(t)
+	logger := zerolog.Nop()
+
+	portfolio := models.Portfolio{Name: "Test Portfolio", IsDefault: true}
+	db.Create(&portfolio)
+
+	day1 := time.Date(2026, 3, 2, 16, 0, 0, 0, time.UTC) // Monday
+	day3 := day1.AddDate(0, 0, 2)
+
+	histories := []models.StockHistory{
+		{StockID: 1, PortfolioID: portfolio.ID, Ticker: "AAA", ExpectedValue: 10.0, Weight: 0.5, RecordedAt: day1},
+		{StockID: 2, PortfolioID: portfolio.ID, Ticker: "BBB", ExpectedValue: 2.0, Weight: 0.5, RecordedAt: day1},
+		// Second snapshot: AAA EV drops and weight shifts
+		{StockID: 1, PortfolioID: portfolio.ID, Ticker: "AAA", ExpectedValue: 4.0, Weight: 0.25, RecordedAt: day3},
+		{StockID: 2, PortfolioID: portfolio.ID, Ticker: "BBB", ExpectedValue: 8.0, Weight: 0.75, RecordedAt: day3},
+	}
+	for i := range histories {
+		db.Create(&histories[i])
+	}
+
+	handler := NewAnalyticsHandler(db, logger)
+	router := gin.New()
+	router.GET("/portfolio/ev-history", handler.GetEVHistory)
+
+	t.Run("Daily", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/portfolio/ev-history?from=2026-03-02&to=2026-03-04&granularity=day", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var response EVHistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if len(response.Points) != 3 {
+			t.Fatalf("expected 3 points, got %d", len(response.Points))
+		}
+		// Day 1 and day 2 carry the first snapshot: 0.5*10 + 0.5*2 = 6
+		want := []float64{6.0, 6.0, 7.0}
+		for i, p := range response.Points {
+			if p.OverallEV != want[i] {
+				t.Errorf("point %d (%s): expected EV %.2f, got %.2f", i, p.Date, want[i], p.OverallEV)
+			}
+		}
+		if response.Points[2].Date != "2026-03-04" {
+			t.Errorf("expected last bucket 2026-03-04, got %s", response.Points[2].Date)
+		}
+	})
+
+	t.Run("Weekly", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/portfolio/ev-history?from=2026-03-04&to=2026-03-10&granularity=week", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var response EVHistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if response.From != "2026-03-02" {
+			t.Errorf("expected week aligned to Monday 2026-03-02, got %s", response.From)
+		}
+		if len(response.Points) != 2 {
+			t.Fatalf("expected 2 weekly points, got %d", len(response.Points))
+		}
+		if response.Points[0].OverallEV != 7.0 {
+			t.Errorf("expected first week EV 7.0 (latest snapshot), got %.2f", response.Points[0].OverallEV)
+		}
+	})
+
+	t.Run("DownsamplesWideRange", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/portfolio/ev-history?from=2020-01-01&to=2026-03-10&granularity=day", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response EVHistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if !response.Downsampled || response.BucketDays <= 1 {
+			t.Errorf("expected downsampled response, got bucket_days=%d downsampled=%v", response.BucketDays, response.Downsampled)
+		}
+		if len(response.Points) > maxEVHistoryBuckets {
+			t.Errorf("expected at most %d points, got %d", maxEVHistoryBuckets, len(response.Points))
+		}
+	})
+
+	t.Run("CarriesSnapshotsFromBeforeRange", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/portfolio/ev-history?from=2026-03-03&to=2026-03-03&granularity=day", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response EVHistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if len(response.Points) != 1 || response.Points[0].OverallEV != 6.0 || response.Points[0].Positions != 2 {
+			t.Errorf("expected one point with EV 6.0 from the day-1 snapshots, got %+v", response.Points)
+		}
+	})
+
+	t.Run("ReadsRangeInBatches", func(t *testing.T) {
+		batched := NewAnalyticsHandler(db, logger)
+		batched.evHistoryBatchSize = 1
+		batchedRouter := gin.New()
+		batchedRouter.GET("/portfolio/ev-history", batched.GetEVHistory)
+
+		req, _ := http.NewRequest("GET", "/portfolio/ev-history?from=2026-03-02&to=2026-03-04", nil)
+		w := httptest.NewRecorder()
+		batchedRouter.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var response EVHistoryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		want := []float64{6.0, 6.0, 7.0}
+		if len(response.Points) != len(want) {
+			t.Fatalf("expected %d points, got %d", len(want), len(response.Points))
+		}
+		for i, p := range response.Points {
+			if p.OverallEV != want[i] {
+				t.Errorf("point %d (%s): expected EV %.2f, got %.2f", i, p.Date, want[i], p.OverallEV)
+			}
+		}
+	})
+
+	t.Run("InvalidGranularity", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/portfolio/ev-history?granularity=month", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
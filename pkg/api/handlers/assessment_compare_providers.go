@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ProviderCompareRequest asks for fresh Grok and Deepseek assessments of one ticker.
+type ProviderCompareRequest struct {
+	Ticker       string  `json:"ticker" binding:"required"`
+	ISIN         string  `json:"isin,omitempty"`
+	CompanyName  string  `json:"company_name,omitempty"`
+	CurrentPrice float64 `json:"current_price,omitempty"`
+	Currency     string  `json:"currency,omitempty"`
+}
+
+// ProviderAssessmentResult is one provider's outcome in a provider comparison.
+type ProviderAssessmentResult struct {
+	Assessment string `json:"assessment,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// assessmentGenerator is the signature of the per-source generate*Assessment methods.
+type assessmentGenerator func(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error)
+
+// providerOutcome is one generator's text or error from generateFromProviders.
+type providerOutcome struct {
+	text string
+	err  error
+}
+
+// generateFromProviders runs every generator in parallel on the same stock, without dashboard hints,
+// and returns their outcomes in generator order once all have finished.
+func generateFromProviders(generators []assessmentGenerator, portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, stockData *models.Stock) []providerOutcome {
+	outcomes := make([]providerOutcome, len(generators))
+	var wg sync.WaitGroup
+	for i, generate := range generators {
+		wg.Add(1)
+		go func(i int, generate assessmentGenerator) {
+			defer wg.Done()
+			outcomes[i].text, outcomes[i].err = generate(portfolioID, ticker, isin, companyName, currentPrice, currency, "", "", "", stockData)
+		}(i, generate)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// CompareProviders runs Grok and Deepseek assessments for a ticker in parallel and returns both,
+// each with its own error when that provider failed. Successful assessments are persisted like
+// RequestAssessment results. Responds 502 only when both providers fail.
+func (h *AssessmentHandler) CompareProviders(c *gin.Context) {
+	var req ProviderCompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+	assessmentReq := AssessmentRequest{
+		Ticker:       strings.ToUpper(strings.TrimSpace(req.Ticker)),
+		ISIN:         req.ISIN,
+		CompanyName:  req.CompanyName,
+		CurrentPrice: req.CurrentPrice,
+		Currency:     req.Currency,
+	}
+	ticker := assessmentReq.Ticker
+	if !h.ensureTickerResolvable(c, ticker) {
+		return
+	}
+	stockData := h.anchorOnStoredStock(portfolioID, &assessmentReq)
+
+	sources := []struct {
+		name     string
+		generate assessmentGenerator
+	}{
+		{"grok", h.generateGrokAssessment},
+		{"deepseek", h.generateDeepseekAssessment},
+	}
+	generators := make([]assessmentGenerator, len(sources))
+	for i, source := range sources {
+		generators[i] = source.generate
+	}
+	outcomes := generateFromProviders(generators, portfolioID, ticker, assessmentReq.ISIN, assessmentReq.CompanyName, assessmentReq.CurrentPrice, assessmentReq.Currency, stockData)
+
+	results := make([]ProviderAssessmentResult, len(sources))
+	for i, outcome := range outcomes {
+		if outcome.err != nil {
+			h.logger.Warn().Err(outcome.err).Str("ticker", ticker).Str("source", sources[i].name).Msg("Provider comparison assessment failed")
+			results[i].Error = outcome.err.Error()
+			continue
+		}
+		results[i].Assessment = outcome.text
+	}
+
+	resp := gin.H{"ticker": ticker}
+	succeeded := 0
+	for i, source := range sources {
+		resp[source.name] = results[i]
+		if results[i].Error != "" {
+			continue
+		}
+		succeeded++
+		if err := h.assessments.Upsert(portfolioID, ticker, source.name, results[i].Assessment); err != nil {
+			h.logger.Error().Err(err).Str("ticker", ticker).Str("source", source.name).Msg("Failed to persist assessment from provider comparison")
+		}
+	}
+	if succeeded == 0 {
+		c.JSON(http.StatusBadGateway, resp)
+		return
+	}
+	h.assessments.CleanupOld()
+	if err := h.assessments.RegenerateAssessmentDiff(portfolioID, ticker); err != nil {
+		h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Failed to regenerate persisted assessment diff")
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// renderAssessmentMarkdown prefixes the assessment text with a header block.
+func renderAssessmentMarkdown(assessment *models.Assessment) string {
+	summary := services.ParseAssessmentSummary(assessment.Assessment)
+	orNA := func(value string) string {
+		if value == "" {
+			return "n/a"
+		}
+		return value
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s assessment\n\n", assessment.Ticker)
+	fmt.Fprintf(&b, "- **Ticker:** %s\n", assessment.Ticker)
+	fmt.Fprintf(&b, "- **Source:** %s\n", assessment.Source)
+	fmt.Fprintf(&b, "- **Date:** %s\n", assessment.CreatedAt.Format("2006-01-02"))
+	fmt.Fprintf(&b, "- **Expected Value:** %s\n", orNA(summary.ExpectedValue))
+	fmt.Fprintf(&b, "- **½-Kelly:** %s\n", orNA(summary.HalfKelly))
+	fmt.Fprintf(&b, "- **Assessment:** %s\n", orNA(summary.Recommendation))
+	b.WriteString("\n---\n\n")
+	b.WriteString(strings.TrimSpace(assessment.Assessment))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// ExportAssessment returns an assessment as a downloadable markdown (default) or PDF file.
+func (h *AssessmentHandler) ExportAssessment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "md"))
+	if format != "md" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be md or pdf"})
+		return
+	}
+
+	var assessment models.Assessment
+	if err := h.db.First(&assessment, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+			return
+		}
+		h.logger.Error().Err(err).Msg("Failed to fetch assessment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assessment"})
+		return
+	}
+
+	markdown := renderAssessmentMarkdown(&assessment)
+	filename := fmt.Sprintf("%s_%s_%s.%s", assessment.Ticker, assessment.Source, assessment.CreatedAt.Format("2006-01-02"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%q", filename))
+
+	if format == "pdf" {
+		c.Data(http.StatusOK, "application/pdf", renderTextPDF(markdown))
+		return
+	}
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(markdown))
+}
+
+// PDF layout: A4 portrait, Helvetica 10pt.
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 50
+	pdfFontSize     = 10
+	pdfLeading      = 13
+	pdfCharsPerLine = 95
+)
+
+var pdfReplacer = strings.NewReplacer(
+	"½", "1/2", "–", "-", "—", "-", "•", "-", "σ", "sigma", "≤", "<=", "≥", ">=", "≠", "!=",
+	"’", "'", "‘", "'", "“", "\"", "”", "\"", "…", "...", "×", "x", "→", "->",
+)
+
+// renderTextPDF renders plain text as a minimal multi-page PDF using the built-in Helvetica font.
+// Markdown is printed as-is; characters outside ASCII are transliterated or replaced with '?'.
+func renderTextPDF(text string) []byte {
+	var lines []string
+	for _, raw := range strings.Split(pdfReplacer.Replace(text), "\n") {
+		lines = append(lines, wrapPDFLine(pdfASCII(raw), pdfCharsPerLine)...)
+	}
+	linesPerPage := (pdfPageHeight - 2*pdfMargin) / pdfLeading
+	var pages [][]string
+	for start := 0; start < len(lines); start += linesPerPage {
+		end := start + linesPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		pages = append(pages, lines[start:end])
+	}
+	if len(pages) == 0 {
+		pages = [][]string{{}}
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and content stream per page.
+	objects := make([]string, 3, 3+2*len(pages))
+	kids := make([]string, len(pages))
+	for i, page := range pages {
+		pageObj := 4 + 2*i
+		kids[i] = fmt.Sprintf("%d 0 R", pageObj)
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, pageObj+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+	objects[2] = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+func pdfASCII(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b.WriteString("    ")
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r == '\r':
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+// wrapPDFLine splits a line at word boundaries so it fits within width characters.
+func wrapPDFLine(line string, width int) []string {
+	if len(line) <= width {
+		return []string{line}
+	}
+	var wrapped []string
+	for len(line) > width {
+		cut := strings.LastIndex(line[:width], " ")
+		if cut <= 0 {
+			cut = width
+		}
+		wrapped = append(wrapped, strings.TrimRight(line[:cut], " "))
+		line = strings.TrimLeft(line[cut:], " ")
+	}
+	return append(wrapped, line)
+}
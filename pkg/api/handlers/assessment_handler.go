@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,24 +17,38 @@ import (
 	"github.com/art-pro/stock-backend/pkg/config"
 	"github.com/art-pro/stock-backend/pkg/database"
 	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 )
 
+// stockPriceFetcher fetches a current market price for a ticker.
+type stockPriceFetcher interface {
+	FetchStockPrice(ticker string) (float64, error)
+}
+
+// tickerResolver checks that a ticker is a listed security before an LLM call is spent on it.
+type tickerResolver interface {
+	ResolveTicker(ticker string) (bool, error)
+}
+
 // AssessmentHandler handles stock assessment requests
 type AssessmentHandler struct {
-	db     *gorm.DB
-	cfg    *config.Config
-	logger zerolog.Logger
-	client *http.Client
+	db             *gorm.DB
+	cfg            *config.Config
+	logger         zerolog.Logger
+	client         *http.Client
+	priceFetcher   stockPriceFetcher
+	tickerResolver tickerResolver
+	assessments    *services.AssessmentService
 }
 
 // AssessmentRequest represents the request for stock assessment
 type AssessmentRequest struct {
 	Ticker               string  `json:"ticker" binding:"required"`
 	ISIN                 string  `json:"isin,omitempty"`
-	Source               string  `json:"source" binding:"required,oneof=grok deepseek perplexity chatgpt"`
+	Source               string  `json:"source" binding:"required,oneof=grok deepseek perplexity chatgpt claude"`
 	CompanyName          string  `json:"company_name,omitempty"`
 	CurrentPrice         float64 `json:"current_price,omitempty"`
 	Currency             string  `json:"currency,omitempty"`
@@ -43,6 +60,7 @@ type AssessmentRequest struct {
 // AssessmentResponse represents the response containing assessment
 type AssessmentResponse struct {
 	Assessment string `json:"assessment"`
+	Cached     bool   `json:"cached,omitempty"` // Served from a recent stored assessment without an LLM call
 }
 
 type AssessmentCompareRequest struct {
@@ -51,33 +69,21 @@ type AssessmentCompareRequest struct {
 	DeepseekAssessment    string `json:"deepseek_assessment" binding:"required"`
 	PerplexityAssessment  string `json:"perplexity_assessment,omitempty"`
 	ChatGPTAssessment     string `json:"chatgpt_assessment,omitempty"`
-}
-
-type AssessmentCompareRow struct {
-	Key         string `json:"key"`
-	Label       string `json:"label"`
-	Grok        string `json:"grok"`
-	Deepseek    string `json:"deepseek"`
-	Perplexity  string `json:"perplexity,omitempty"`
-	ChatGPT     string `json:"chatgpt,omitempty"`
-}
-
-type assessmentCompareLLMResult struct {
-	Grok        map[string]string `json:"grok"`
-	Deepseek    map[string]string `json:"deepseek"`
-	Perplexity  map[string]string `json:"perplexity,omitempty"`
-	ChatGPT     map[string]string `json:"chatgpt,omitempty"`
+	ClaudeAssessment      string `json:"claude_assessment,omitempty"`
 }
 
 // NewAssessmentHandler creates a new assessment handler
 func NewAssessmentHandler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *AssessmentHandler {
+	externalAPI := services.NewExternalAPIService(cfg)
+	assessments := services.NewAssessmentService(db, cfg, logger)
 	return &AssessmentHandler{
-		db:     db,
-		cfg:    cfg,
-		logger: logger,
-		client: &http.Client{
-			Timeout: 120 * time.Second, // Longer timeout for AI analysis
-		},
+		db:             db,
+		cfg:            cfg,
+		logger:         logger,
+		client:         assessments.Client(), // One rate-limited client for the service's and the handler's own LLM calls
+		priceFetcher:   externalAPI,
+		tickerResolver: externalAPI,
+		assessments:    assessments,
 	}
 }
 
@@ -221,7 +227,7 @@ func (h *AssessmentHandler) extractWithGrokVision(images []string, prompt string
 	messages[0]["content"] = contentList
 
 	reqBody := map[string]interface{}{
-		"model":       "grok-2-vision-latest", // Use appropriate vision model name
+		"model":       h.cfg.ModelFor(config.UseCaseVision, "grok"),
 		"messages":    messages,
 		"stream":      false,
 		"temperature": 0.1, // Low temperature for data extraction
@@ -240,7 +246,7 @@ func (h *AssessmentHandler) extractWithGrokVision(images []string, prompt string
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+h.cfg.XAIAPIKey)
 
-	resp, err := h.client.Do(req)
+	resp, err := services.DoWithRetry(h.client, req, services.RetryPolicyFromConfig(h.cfg))
 	if err != nil {
 		return "", fmt.Errorf("failed to call Grok API: %w", err)
 	}
@@ -260,6 +266,7 @@ func (h *AssessmentHandler) extractWithGrokVision(images []string, prompt string
 	if err := json.Unmarshal(body, &grokResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	services.RecordProviderSuccess(resp)
 
 	choices, ok := grokResp["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
@@ -281,7 +288,7 @@ func (h *AssessmentHandler) extractWithGrokVision(images []string, prompt string
 		return "", fmt.Errorf("invalid content format")
 	}
 
-	return content, nil
+	return services.RequireContent(content)
 }
 
 // extractWithDeepseekVision uses Deepseek's capabilities to extract data from images
@@ -318,7 +325,7 @@ func (h *AssessmentHandler) extractWithDeepseekVision(images []string, prompt st
 	messages[0]["content"] = contentList
 
 	reqBody := map[string]interface{}{
-		"model":       "deepseek-chat", // Assuming V3/multimodal capability
+		"model":       h.cfg.ModelFor(config.UseCaseVision, "deepseek"),
 		"messages":    messages,
 		"stream":      false,
 		"temperature": 0.1,
@@ -338,7 +345,7 @@ func (h *AssessmentHandler) extractWithDeepseekVision(images []string, prompt st
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+h.cfg.DeepseekAPIKey)
 
-	resp, err := h.client.Do(req)
+	resp, err := services.DoWithRetry(h.client, req, services.RetryPolicyFromConfig(h.cfg))
 	if err != nil {
 		return "", fmt.Errorf("failed to call Deepseek API: %w", err)
 	}
@@ -358,6 +365,7 @@ func (h *AssessmentHandler) extractWithDeepseekVision(images []string, prompt st
 	if err := json.Unmarshal(body, &deepseekResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	services.RecordProviderSuccess(resp)
 
 	choices, ok := deepseekResp["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
@@ -379,7 +387,7 @@ func (h *AssessmentHandler) extractWithDeepseekVision(images []string, prompt st
 		return "", fmt.Errorf("invalid content format")
 	}
 
-	return content, nil
+	return services.RequireContent(content)
 }
 
 // RequestAssessment generates a stock assessment using AI
@@ -398,25 +406,41 @@ func (h *AssessmentHandler) RequestAssessment(c *gin.Context) {
 		return
 	}
 
+	if c.Query("force") != "true" {
+		if cached, ok := h.cachedAssessment(portfolioID, req.Ticker, req.Source); ok {
+			h.logger.Info().Str("ticker", req.Ticker).Str("source", req.Source).Msg("Serving cached stock assessment")
+			c.JSON(http.StatusOK, AssessmentResponse{Assessment: cached, Cached: true})
+			return
+		}
+	}
+
+	if !h.ensureTickerResolvable(c, req.Ticker) {
+		return
+	}
+
 	h.logger.Info().
 		Str("ticker", req.Ticker).
 		Str("source", req.Source).
 		Msg("Generating stock assessment")
 
+	stockData := h.anchorOnStoredStock(portfolioID, &req)
+
 	var assessment string
 	var err error
 
 	switch req.Source {
 	case "grok":
-		assessment, err = h.generateGrokAssessment(req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint)
+		assessment, err = h.generateGrokAssessment(portfolioID, req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint, stockData)
 	case "deepseek":
-		assessment, err = h.generateDeepseekAssessment(req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint)
+		assessment, err = h.generateDeepseekAssessment(portfolioID, req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint, stockData)
 	case "perplexity":
-		assessment, err = h.generatePerplexityAssessment(req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint)
+		assessment, err = h.generatePerplexityAssessment(portfolioID, req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint, stockData)
 	case "chatgpt":
-		assessment, err = h.generateChatGPTAssessment(req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint)
+		assessment, err = h.generateChatGPTAssessment(portfolioID, req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint, stockData)
+	case "claude":
+		assessment, err = h.generateClaudeAssessment(portfolioID, req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint, stockData)
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source. Must be 'grok', 'deepseek', 'perplexity', or 'chatgpt'"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source. Must be 'grok', 'deepseek', 'perplexity', 'chatgpt', or 'claude'"})
 		return
 	}
 
@@ -425,20 +449,24 @@ func (h *AssessmentHandler) RequestAssessment(c *gin.Context) {
 			Str("ticker", req.Ticker).
 			Str("source", req.Source).
 			Msg("Failed to generate assessment")
+		if errors.Is(err, services.ErrEmptyContent) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to generate assessment: " + err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate assessment: " + err.Error()})
 		return
 	}
 
 	// Persist one latest assessment per ticker+source (replace old with new).
-	if err := h.upsertAssessment(portfolioID, req.Ticker, req.Source, assessment); err != nil {
+	if err := h.assessments.Upsert(portfolioID, req.Ticker, req.Source, assessment); err != nil {
 		h.logger.Error().Err(err).Msg("Failed to persist assessment")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to persist assessment"})
 		return
 	}
-	h.cleanupOldAssessments()
+	h.assessments.CleanupOld()
 
 	// Rebuild and persist diff whenever a new source assessment is saved.
-	if err := h.regenerateAndPersistAssessmentDiff(portfolioID, req.Ticker); err != nil {
+	if err := h.assessments.RegenerateAssessmentDiff(portfolioID, req.Ticker); err != nil {
 		h.logger.Warn().Err(err).Str("ticker", req.Ticker).Msg("Failed to regenerate persisted assessment diff")
 	}
 
@@ -447,22 +475,118 @@ func (h *AssessmentHandler) RequestAssessment(c *gin.Context) {
 	})
 }
 
-// GetRecentAssessments returns recent assessments
+// cachedAssessment returns the completed assessment for ticker and source stored within
+// ASSESSMENT_CACHE_TTL_MINUTES, if any.
+func (h *AssessmentHandler) cachedAssessment(portfolioID uint, ticker, source string) (string, bool) {
+	if h.cfg.AssessmentCacheTTLMinutes <= 0 {
+		return "", false
+	}
+	cutoff := time.Now().Add(-time.Duration(h.cfg.AssessmentCacheTTLMinutes) * time.Minute)
+	var record models.Assessment
+	if err := h.db.Where("portfolio_id = ? AND ticker = ? AND source = ? AND status = ? AND updated_at >= ?", portfolioID, ticker, source, "completed", cutoff).
+		Order("updated_at DESC").First(&record).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Failed to look up cached assessment")
+		}
+		return "", false
+	}
+	if strings.TrimSpace(record.Assessment) == "" {
+		return "", false
+	}
+	return record.Assessment, true
+}
+
+// anchorOnStoredStock loads the portfolio's (freshened) stock for req.Ticker when ASSESSMENT_FRESH_PRICE
+// is on and copies its price, currency and name into req, so the prompt is anchored on our own data
+// instead of the model's own figures. Returns nil when the option is off or the ticker is not tracked.
+func (h *AssessmentHandler) anchorOnStoredStock(portfolioID uint, req *AssessmentRequest) *models.Stock {
+	if !h.cfg.AssessmentFreshPrice {
+		return nil
+	}
+	stockData := h.loadFreshStock(portfolioID, req.Ticker)
+	if stockData != nil {
+		req.CurrentPrice = stockData.CurrentPrice
+		req.Currency = stockData.Currency
+		if req.CompanyName == "" {
+			req.CompanyName = stockData.CompanyName
+		}
+	}
+	return stockData
+}
+
+// ensureTickerResolvable rejects tickers the data provider cannot find when
+// ASSESSMENT_REQUIRE_RESOLVABLE_TICKER is on, writing a 404 and returning false.
+// Lookup failures (no key, rate limit) let the request through.
+func (h *AssessmentHandler) ensureTickerResolvable(c *gin.Context, ticker string) bool {
+	if !h.cfg.AssessmentRequireResolvableTicker || h.tickerResolver == nil {
+		return true
+	}
+	resolved, err := h.tickerResolver.ResolveTicker(ticker)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Ticker lookup failed, continuing with assessment")
+		return true
+	}
+	if !resolved {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Ticker %s could not be resolved to a listed security", ticker)})
+		return false
+	}
+	return true
+}
+
+// Page size bounds for GET /assessment/recent.
+const (
+	defaultRecentAssessmentsLimit = 20
+	maxRecentAssessmentsLimit     = 100
+)
+
+// GetRecentAssessments returns a page of the portfolio's assessments, newest first, as an array; the
+// total count for pagination is in the X-Total-Count header. Query limit (default 20, max 100),
+// offset and ticker (case-insensitive) are optional.
 func (h *AssessmentHandler) GetRecentAssessments(c *gin.Context) {
 	portfolioID, err := h.resolvePortfolioID(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
 		return
 	}
-	var assessments []models.Assessment
 
-	// Get the last 20 assessments, ordered by creation time
-	if err := h.db.Where("portfolio_id = ?", portfolioID).Order("created_at DESC").Limit(20).Find(&assessments).Error; err != nil {
+	limit := defaultRecentAssessmentsLimit
+	if rawLimit := strings.TrimSpace(c.Query("limit")); rawLimit != "" {
+		parsedLimit, err := strconv.Atoi(rawLimit)
+		if err != nil || parsedLimit <= 0 || parsedLimit > maxRecentAssessmentsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be an integer between 1 and %d", maxRecentAssessmentsLimit)})
+			return
+		}
+		limit = parsedLimit
+	}
+	offset := 0
+	if rawOffset := strings.TrimSpace(c.Query("offset")); rawOffset != "" {
+		parsedOffset, err := strconv.Atoi(rawOffset)
+		if err != nil || parsedOffset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+		offset = parsedOffset
+	}
+
+	query := h.db.Model(&models.Assessment{}).Where("portfolio_id = ?", portfolioID)
+	if ticker := strings.ToUpper(strings.TrimSpace(c.Query("ticker"))); ticker != "" {
+		query = query.Where("UPPER(ticker) = ?", ticker)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to count recent assessments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assessments"})
+		return
+	}
+	assessments := []models.Assessment{}
+	if err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Offset(offset).Find(&assessments).Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to fetch recent assessments")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assessments"})
 		return
 	}
 
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, assessments)
 }
 
@@ -475,8 +599,8 @@ func (h *AssessmentHandler) GetAssessmentsByTicker(c *gin.Context) {
 	}
 
 	source := strings.ToLower(strings.TrimSpace(c.Query("source")))
-	if source != "" && source != "grok" && source != "deepseek" && source != "perplexity" && source != "chatgpt" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source. Must be 'grok', 'deepseek', 'perplexity', or 'chatgpt'"})
+	if source != "" && !slices.Contains(services.AssessmentSources, source) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid source. Must be 'grok', 'deepseek', 'perplexity', 'chatgpt', or 'claude'"})
 		return
 	}
 
@@ -522,7 +646,7 @@ func (h *AssessmentHandler) GetAssessmentDiffByTicker(c *gin.Context) {
 	var diff models.AssessmentDiff
 	if err := h.db.Where("UPPER(ticker) = ?", ticker).First(&diff).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusOK, gin.H{"rows": []AssessmentCompareRow{}})
+			c.JSON(http.StatusOK, gin.H{"rows": []services.AssessmentCompareRow{}})
 			return
 		}
 		h.logger.Error().Err(err).Str("ticker", ticker).Msg("Failed to fetch assessment diff by ticker")
@@ -530,7 +654,7 @@ func (h *AssessmentHandler) GetAssessmentDiffByTicker(c *gin.Context) {
 		return
 	}
 
-	var rows []AssessmentCompareRow
+	var rows []services.AssessmentCompareRow
 	if err := json.Unmarshal([]byte(diff.RowsJSON), &rows); err != nil {
 		h.logger.Error().Err(err).Str("ticker", ticker).Msg("Failed to parse persisted assessment diff")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse assessment diff"})
@@ -549,13 +673,13 @@ func (h *AssessmentHandler) CompareAssessments(c *gin.Context) {
 	}
 
 	ticker := strings.ToUpper(strings.TrimSpace(req.Ticker))
-	rows, err := h.extractAssessmentCompareRows(ticker, req.GrokAssessment, req.DeepseekAssessment, req.PerplexityAssessment, req.ChatGPTAssessment)
+	rows, err := h.assessments.ExtractAssessmentCompareRows(ticker, req.GrokAssessment, req.DeepseekAssessment, req.PerplexityAssessment, req.ChatGPTAssessment, req.ClaudeAssessment)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare assessments: " + err.Error()})
 		return
 	}
 
-	if err := h.persistAssessmentDiff(ticker, rows); err != nil {
+	if err := h.assessments.PersistAssessmentDiff(ticker, rows); err != nil {
 		h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Failed to persist assessment diff from compare endpoint")
 	}
 
@@ -584,6 +708,63 @@ func (h *AssessmentHandler) GetAssessmentById(c *gin.Context) {
 	c.JSON(http.StatusOK, assessment)
 }
 
+// DeleteAssessment removes one stored assessment of the portfolio.
+func (h *AssessmentHandler) DeleteAssessment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment ID"})
+		return
+	}
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	result := h.db.Where("id = ? AND portfolio_id = ?", id, portfolioID).Delete(&models.Assessment{})
+	if result.Error != nil {
+		h.logger.Error().Err(result.Error).Msg("Failed to delete assessment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete assessment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Assessment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": result.RowsAffected})
+}
+
+// PruneAssessments deletes the portfolio's assessments last updated before the required query
+// before (RFC3339). Requiring it keeps the route from wiping every assessment.
+func (h *AssessmentHandler) PruneAssessments(c *gin.Context) {
+	beforeParam := c.Query("before")
+	if beforeParam == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "before is required (RFC3339 timestamp)"})
+		return
+	}
+	before, err := time.Parse(time.RFC3339, beforeParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before: use RFC3339, e.g. 2024-01-31T00:00:00Z"})
+		return
+	}
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	result := h.db.Where("portfolio_id = ? AND updated_at < ?", portfolioID, before).Delete(&models.Assessment{})
+	if result.Error != nil {
+		h.logger.Error().Err(result.Error).Msg("Failed to prune assessments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prune assessments"})
+		return
+	}
+	h.logger.Info().Int64("deleted", result.RowsAffected).Time("before", before).Msg("Pruned assessments")
+
+	c.JSON(http.StatusOK, gin.H{"deleted": result.RowsAffected})
+}
+
 // BatchAssessmentRequest is the request for batch assessment.
 type BatchAssessmentRequest struct {
 	Tickers []string `json:"tickers" binding:"required,max=10"`
@@ -650,7 +831,7 @@ func (h *AssessmentHandler) BatchAssessment(c *gin.Context) {
 				currentPrice = s.CurrentPrice
 				currency = s.Currency
 			}
-			prompt := h.buildAssessmentPrompt(ticker, "", companyName, currentPrice, currency, portfolioData, cashData, "", "", "")
+			prompt := h.assessments.BuildPrompt(portfolioID, ticker, "", companyName, currentPrice, currency, portfolioData, cashData, "", "", "", nil)
 			text, err := h.callChatCompletion(systemContent, prompt, source)
 			if err != nil {
 				h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Batch assessment failed for ticker")
@@ -838,202 +1019,39 @@ Provide a short narrative (2–4 sentences) covering: outlook, main risks, and h
 }
 
 // generateGrokAssessment generates assessment using Grok AI
-func (h *AssessmentHandler) generateGrokAssessment(ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string) (string, error) {
-	if h.cfg.XAIAPIKey == "" {
-		return "", fmt.Errorf("Grok AI API key not configured")
-	}
-
-	// Fetch portfolio data for context
-	portfolioData, cashData, err := h.fetchPortfolioContext()
-	if err != nil {
-		h.logger.Warn().Err(err).Msg("Failed to fetch portfolio context, continuing without it")
-	}
-
-	// Create the comprehensive prompt based on your strategy (includes dashboard hints when provided)
-	prompt := h.buildAssessmentPrompt(ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint)
-
-	// Build Grok API request
-	reqBody := map[string]interface{}{
-		"model": "grok-4-1-fast-reasoning-latest",
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a financial advisor and investment consultant using a probabilistic strategy. You provide detailed stock analysis following the Kelly Criterion framework. Always provide complete, structured analysis. Use the most recent market data available and indicate data freshness in your analysis.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"stream": false,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.x.ai/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+h.cfg.XAIAPIKey)
-
-	resp, err := h.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to call Grok API: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Grok API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	var grokResp map[string]interface{}
-	if err := json.Unmarshal(body, &grokResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	// Extract the content from the response
-	choices, ok := grokResp["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
-	}
-
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid choice format")
-	}
-
-	message, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid message format")
-	}
-
-	content, ok := message["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid content format")
-	}
-
-	return content, nil
+func (h *AssessmentHandler) generateGrokAssessment(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error) {
+	return h.assessments.Generate(h.assessments.Provider("grok"), portfolioID, ticker, isin, companyName, currentPrice, currency, rebalanceHint, concentrationHint, suggestedActionsHint, stockData)
 }
 
 // generateDeepseekAssessment generates assessment using Deepseek AI
-func (h *AssessmentHandler) generateDeepseekAssessment(ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string) (string, error) {
-	if h.cfg.DeepseekAPIKey == "" {
-		return "", fmt.Errorf("Deepseek AI API key not configured")
-	}
-
-	// Fetch portfolio data for context
-	portfolioData, cashData, err := h.fetchPortfolioContext()
-	if err != nil {
-		h.logger.Warn().Err(err).Msg("Failed to fetch portfolio context, continuing without it")
-	}
-
-	// Create the comprehensive prompt based on your strategy (includes dashboard hints when provided)
-	prompt := h.buildAssessmentPrompt(ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint)
-
-	// Build Deepseek API request
-	reqBody := map[string]interface{}{
-		"model": "deepseek-reasoner",
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a financial advisor and investment consultant using a probabilistic strategy. You provide detailed stock analysis following the Kelly Criterion framework. Always provide complete, structured analysis. Use the most recent market data available and indicate data freshness in your analysis.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"stream": false,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.deepseek.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+h.cfg.DeepseekAPIKey)
-
-	resp, err := h.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to call Deepseek API: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Deepseek API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	var deepseekResp map[string]interface{}
-	if err := json.Unmarshal(body, &deepseekResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	// Extract the content from the response
-	choices, ok := deepseekResp["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
-	}
-
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid choice format")
-	}
-
-	message, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid message format")
-	}
-
-	content, ok := message["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid content format")
-	}
+func (h *AssessmentHandler) generateDeepseekAssessment(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error) {
+	return h.assessments.Generate(h.assessments.Provider("deepseek"), portfolioID, ticker, isin, companyName, currentPrice, currency, rebalanceHint, concentrationHint, suggestedActionsHint, stockData)
+}
 
-	return content, nil
+// generateClaudeAssessment generates assessment using Anthropic Claude
+func (h *AssessmentHandler) generateClaudeAssessment(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error) {
+	return h.assessments.Generate(h.assessments.Provider("claude"), portfolioID, ticker, isin, companyName, currentPrice, currency, rebalanceHint, concentrationHint, suggestedActionsHint, stockData)
 }
 
 // generatePerplexityAssessment generates assessment using Perplexity (Sonar) AI
-func (h *AssessmentHandler) generatePerplexityAssessment(ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string) (string, error) {
+func (h *AssessmentHandler) generatePerplexityAssessment(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error) {
 	if h.cfg.PerplexityAPIKey == "" {
 		return "", fmt.Errorf("Perplexity AI API key not configured")
 	}
 
-	portfolioData, cashData, err := h.fetchPortfolioContext()
+	portfolioData, cashData, err := h.assessments.PortfolioContext()
 	if err != nil {
 		h.logger.Warn().Err(err).Msg("Failed to fetch portfolio context, continuing without it")
 	}
 
-	prompt := h.buildAssessmentPrompt(ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint)
+	prompt := h.assessments.BuildPrompt(portfolioID, ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint, stockData)
 
 	reqBody := map[string]interface{}{
-		"model": "sonar-pro",
+		"model": h.cfg.ModelFor(config.UseCaseAssessment, "perplexity"),
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a financial advisor and investment consultant using a probabilistic strategy. You provide detailed stock analysis following the Kelly Criterion framework. Always provide complete, structured analysis. Use the most recent market data available and indicate data freshness in your analysis.",
+				"content": services.AssessmentSystemPrompt,
 			},
 			{
 				"role":    "user",
@@ -1049,7 +1067,8 @@ func (h *AssessmentHandler) generatePerplexityAssessment(ticker, isin, companyNa
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.perplexity.ai/chat/completions", bytes.NewBuffer(jsonData))
+	ctx := services.WithProviderCallInfo(context.Background(), ticker, config.UseCaseAssessment)
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.perplexity.ai/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1077,6 +1096,7 @@ func (h *AssessmentHandler) generatePerplexityAssessment(ticker, isin, companyNa
 	if err := json.Unmarshal(body, &perplexityResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	services.RecordProviderSuccess(resp)
 
 	choices, ok := perplexityResp["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
@@ -1098,28 +1118,28 @@ func (h *AssessmentHandler) generatePerplexityAssessment(ticker, isin, companyNa
 		return "", fmt.Errorf("invalid content format")
 	}
 
-	return content, nil
+	return services.RequireContent(content)
 }
 
-// generateChatGPTAssessment generates assessment using OpenAI ChatGPT (gpt-5.4).
-func (h *AssessmentHandler) generateChatGPTAssessment(ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string) (string, error) {
+// generateChatGPTAssessment generates assessment using OpenAI ChatGPT.
+func (h *AssessmentHandler) generateChatGPTAssessment(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error) {
 	if h.cfg.OpenAIAPIKey == "" {
 		return "", fmt.Errorf("OpenAI API key not configured")
 	}
 
-	portfolioData, cashData, err := h.fetchPortfolioContext()
+	portfolioData, cashData, err := h.assessments.PortfolioContext()
 	if err != nil {
 		h.logger.Warn().Err(err).Msg("Failed to fetch portfolio context, continuing without it")
 	}
 
-	prompt := h.buildAssessmentPrompt(ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint)
+	prompt := h.assessments.BuildPrompt(portfolioID, ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint, stockData)
 
 	reqBody := map[string]interface{}{
-		"model": "gpt-5.4",
+		"model": h.cfg.ModelFor(config.UseCaseAssessment, "chatgpt"),
 		"messages": []map[string]string{
 			{
 				"role":    "system",
-				"content": "You are a financial advisor and investment consultant using a probabilistic strategy. You provide detailed stock analysis following the Kelly Criterion framework. Always provide complete, structured analysis. Use the most recent market data available and indicate data freshness in your analysis.",
+				"content": services.AssessmentSystemPrompt,
 			},
 			{
 				"role":    "user",
@@ -1135,7 +1155,8 @@ func (h *AssessmentHandler) generateChatGPTAssessment(ticker, isin, companyName
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	ctx := services.WithProviderCallInfo(context.Background(), ticker, config.UseCaseAssessment)
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1163,6 +1184,7 @@ func (h *AssessmentHandler) generateChatGPTAssessment(ticker, isin, companyName
 	if err := json.Unmarshal(body, &openAIResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	services.RecordProviderSuccess(resp)
 
 	choices, ok := openAIResp["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
@@ -1184,7 +1206,7 @@ func (h *AssessmentHandler) generateChatGPTAssessment(ticker, isin, companyName
 		return "", fmt.Errorf("invalid content format")
 	}
 
-	return content, nil
+	return services.RequireContent(content)
 }
 
 // resolvePortfolioID returns portfolio_id from query or default.
@@ -1199,97 +1221,38 @@ func (h *AssessmentHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
 	return database.GetDefaultPortfolioID(h.db)
 }
 
-// callChatCompletion calls Grok, Deepseek, Perplexity, or ChatGPT chat API and returns the assistant content.
+// callChatCompletion calls Grok, Deepseek, Claude (through their LLMProvider), Perplexity, or ChatGPT chat API and returns the assistant content.
 func (h *AssessmentHandler) callChatCompletion(systemContent, userContent, source string) (string, error) {
-	var url string
-	var apiKey string
-	var model string
-	switch source {
-	case "deepseek":
-		url = "https://api.deepseek.com/v1/chat/completions"
-		apiKey = h.cfg.DeepseekAPIKey
-		model = "deepseek-reasoner"
-	case "perplexity":
-		url = "https://api.perplexity.ai/chat/completions"
-		apiKey = h.cfg.PerplexityAPIKey
-		model = "sonar-pro"
-	case "chatgpt":
-		url = "https://api.openai.com/v1/chat/completions"
-		apiKey = h.cfg.OpenAIAPIKey
-		model = "gpt-5.4"
-	default:
-		url = "https://api.x.ai/v1/chat/completions"
-		apiKey = h.cfg.XAIAPIKey
-		model = "grok-4-1-fast-reasoning-latest"
-	}
-	if apiKey == "" {
-		return "", fmt.Errorf("%s API key not configured", source)
-	}
-	reqBody := map[string]interface{}{
-		"model": model,
-		"messages": []map[string]string{
-			{"role": "system", "content": systemContent},
-			{"role": "user", "content": userContent},
-		},
-		"stream": false,
-	}
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
-	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	resp, err := h.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("call API: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API status %d: %s", resp.StatusCode, string(body))
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
-	}
-	var parsed map[string]interface{}
-	if err := json.Unmarshal(body, &parsed); err != nil {
-		return "", fmt.Errorf("parse response: %w", err)
-	}
-	choices, ok := parsed["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
-	}
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid choice format")
-	}
-	message, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid message format")
-	}
-	content, ok := message["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid content format")
-	}
-	return content, nil
+	return h.assessments.CompleteChat(systemContent, userContent, source)
 }
 
-// fetchPortfolioContext retrieves current portfolio and cash data for assessment context (all portfolios).
-func (h *AssessmentHandler) fetchPortfolioContext() ([]models.Stock, []models.CashHolding, error) {
-	var portfolioStocks []models.Stock
-	if err := h.db.Where("shares_owned > 0").Find(&portfolioStocks).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch portfolio stocks: %w", err)
+// loadFreshStock returns the portfolio's stock for ticker, refetching its price first when
+// LastUpdated is older than the configured max age. Returns nil when the ticker is not tracked.
+// The refetched price only feeds the prompt and is not persisted; saving it would skip the EUR
+// values and history row a real price update writes. A failed refetch is logged and the stored
+// price is used.
+func (h *AssessmentHandler) loadFreshStock(portfolioID uint, ticker string) *models.Stock {
+	var stock models.Stock
+	if err := h.db.Where("portfolio_id = ? AND ticker = ?", portfolioID, ticker).First(&stock).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Failed to load stock for assessment")
+		}
+		return nil
 	}
-	var cashHoldings []models.CashHolding
-	if err := h.db.Find(&cashHoldings).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to fetch cash holdings: %w", err)
+
+	maxAge := time.Duration(h.cfg.AssessmentPriceMaxAgeMinutes) * time.Minute
+	if stock.CurrentPrice > 0 && time.Since(stock.LastUpdated) <= maxAge {
+		return &stock
 	}
-	return portfolioStocks, cashHoldings, nil
+
+	price, err := h.priceFetcher.FetchStockPrice(stock.Ticker)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("ticker", ticker).Msg("Failed to refresh stale price before assessment, using stored price")
+		return &stock
+	}
+	stock.CurrentPrice = price
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
+	return &stock
 }
 
 // fetchPortfolioContextForPortfolio retrieves portfolio and cash for a given portfolio_id.
@@ -1304,524 +1267,3 @@ func (h *AssessmentHandler) fetchPortfolioContextForPortfolio(portfolioID uint)
 	}
 	return portfolioStocks, cashHoldings, nil
 }
-
-// buildPortfolioContext creates a formatted string describing the current portfolio
-func (h *AssessmentHandler) buildPortfolioContext(portfolio []models.Stock, cashHoldings []models.CashHolding) string {
-	context := "\n\n## CURRENT PORTFOLIO CONTEXT\n\n"
-
-	if len(portfolio) == 0 {
-		context += "**Current Portfolio:** Empty (no owned stocks)\n\n"
-	} else {
-		context += "**Current Portfolio (Owned Stocks):**\n\n"
-		context += "| Ticker | Company | Sector | Shares | Avg Price | Current Price | Position Value | Weight | EV | Assessment |\n"
-		context += "|--------|---------|--------|--------|-----------|---------------|----------------|--------|----|------------|\n"
-
-		totalPortfolioValue := 0.0
-		for _, stock := range portfolio {
-			positionValue := float64(stock.SharesOwned) * stock.CurrentPrice
-			totalPortfolioValue += positionValue
-		}
-
-		sectorAllocations := make(map[string]float64)
-
-		for _, stock := range portfolio {
-			positionValue := float64(stock.SharesOwned) * stock.CurrentPrice
-			weightPercent := (positionValue / totalPortfolioValue) * 100
-
-			context += fmt.Sprintf("| %s | %s | %s | %d | €%.2f | €%.2f | €%.0f | %.1f%% | %.1f%% | %s |\n",
-				stock.Ticker,
-				stock.CompanyName,
-				stock.Sector,
-				stock.SharesOwned,
-				stock.AvgPriceLocal,
-				stock.CurrentPrice,
-				positionValue,
-				weightPercent,
-				stock.ExpectedValue,
-				stock.Assessment)
-
-			// Track sector allocations
-			sectorAllocations[stock.Sector] += weightPercent
-		}
-
-		context += "\n**Current Sector Allocations:**\n"
-		for sector, allocation := range sectorAllocations {
-			context += fmt.Sprintf("- %s: %.1f%%\n", sector, allocation)
-		}
-		context += fmt.Sprintf("\n**Total Portfolio Value:** €%.0f\n", totalPortfolioValue)
-	}
-
-	// Add cash holdings
-	if len(cashHoldings) == 0 {
-		context += "\n**Available Cash:** No cash holdings recorded\n"
-	} else {
-		context += "\n**Available Cash:**\n"
-		totalCash := 0.0
-		for _, cash := range cashHoldings {
-			if cash.CurrencyCode == "EUR" {
-				// For EUR (base currency), use actual amount
-				context += fmt.Sprintf("- %s: %.0f (€%.0f)\n", cash.CurrencyCode, cash.Amount, cash.Amount)
-				totalCash += cash.Amount
-			} else {
-				// For other currencies, show both original and EUR value
-				context += fmt.Sprintf("- %s: %.0f (€%.0f)\n", cash.CurrencyCode, cash.Amount, cash.USDValue)
-				totalCash += cash.USDValue
-			}
-		}
-		context += fmt.Sprintf("\n**Total Available Cash:** €%.0f\n", totalCash)
-	}
-
-	context += "\n**IMPORTANT:** Consider this portfolio context when making recommendations. Analyze:\n"
-	context += "- How this new position would affect sector diversification\n"
-	context += "- Whether current sector allocations exceed targets (Healthcare 30-35%, Tech 15%, etc.)\n"
-	context += "- If sufficient cash is available for the recommended position size\n"
-	context += "- How this fits with the overall portfolio risk and Kelly utilization\n"
-
-	return context
-}
-
-// buildAssessmentPrompt creates the comprehensive prompt for stock assessment
-func (h *AssessmentHandler) buildAssessmentPrompt(ticker, isin, companyName string, currentPrice float64, currency string, portfolio []models.Stock, cashHoldings []models.CashHolding, rebalanceHint, concentrationHint, suggestedActionsHint string) string {
-	// Build portfolio context string
-	portfolioContext := h.buildPortfolioContext(portfolio, cashHoldings)
-	// Append dashboard hints when provided by the frontend (Sector rebalance hint, Concentration & tail risk, Suggested next actions)
-	if rebalanceHint != "" || concentrationHint != "" || suggestedActionsHint != "" {
-		portfolioContext += "\n\n## DASHBOARD HINTS (current portfolio state)\n\n"
-		if rebalanceHint != "" {
-			portfolioContext += "**Sector rebalance hint:** " + rebalanceHint + "\n\n"
-		}
-		if concentrationHint != "" {
-			portfolioContext += "**Concentration & tail risk:** " + concentrationHint + "\n\n"
-		}
-		if suggestedActionsHint != "" {
-			portfolioContext += "**Suggested next actions:** " + suggestedActionsHint + "\n\n"
-		}
-		portfolioContext += "Consider these hints when making recommendations (e.g. sector fit, concentration, and existing sell/trim/buy-zone actions).\n"
-	}
-	// Get current date
-	currentDate := time.Now().Format("January 2, 2006")
-
-	// Build additional stock info
-	stockInfo := ""
-	if companyName != "" {
-		stockInfo += fmt.Sprintf("\n**Company Name:** %s", companyName)
-	}
-	if strings.TrimSpace(isin) != "" {
-		stockInfo += fmt.Sprintf("\n**ISIN:** %s", strings.ToUpper(strings.TrimSpace(isin)))
-	}
-	if currentPrice > 0 && currency != "" {
-		stockInfo += fmt.Sprintf("\n**Current Price:** %.2f %s (user-provided)", currentPrice, currency)
-	}
-
-	return fmt.Sprintf(`CURRENT DATE: %s
-%s
-IMPORTANT: Please use the most recent available market data and financial information. Access current stock prices, latest quarterly earnings, recent analyst reports, and up-to-date fundamental metrics. If any data appears outdated, please indicate when the information was last updated.
-
-You are a financial advisor and investment consultant using a probabilistic strategy. For the stock %s, follow these steps:
-
-1. Collect data: current price, fair value (median consensus target), upside %% = ((fair value - current price) / current price) * 100, downside %% (calibrate by beta: -15%% <0.5, -20%% 0.5–1, -25%% 1–1.5, -30%% >1.5), p (0.5–0.7 based on ratings), volatility, P/E, EPS growth, debt-to-EBITDA, dividend yield.
-
-2. Calculate EV = (p * upside %%) + ((1-p) * downside %%).
-
-3. Calculate b = upside %% / |downside %%|, Kelly f* = ((b * p) - (1-p)) / b, ½-Kelly = f*/2 capped at 15%%.
-
-4. Assess: Add (EV >7%%), Hold (EV >0%%), Trim (EV <3%%), Sell (EV <0%%).
-
-5. Recommend buy zone (prices for EV >7%%), laddered entries if Add. Align with sector targets (Healthcare 30–35%%, Tech 15%%, etc.).
-
-Output in structured format with EV, Kelly, assessment, and notes. Use conservative p; avoid hype.
-
-Core Philosophy:
-My investment approach is built on probabilistic reasoning, expected value optimization, and risk control via the Kelly criterion. The strategy aims to maximize long-term portfolio growth while minimizing the probability of ruin. It is grounded in three key principles:
-
-1. Probabilistic Thinking – all investment decisions are made by assessing probabilities, not certainties. Every scenario (growth, stagnation, decline) is assigned a probability rather than treated as binary "yes/no".
-
-2. Expected Value (EV) – an investment is only valid if the expected value is positive, accounting for both the potential upside and downside.
-
-3. Kelly Criterion (½-Kelly Implementation) – position sizing is determined mathematically based on the Kelly formula, but only half of the optimal position is used to limit drawdowns and smooth volatility.
-
-Decision-Making Framework:
-For every asset, the model should follow these steps:
-
-Collect Fundamental and Market Data:
-• Current price and fair value estimate
-• Upside potential (%%) and downside risk (%%)
-• Probability of positive outcome (p)
-• Volatility (σ)
-• P/E ratio, EPS growth rate, debt-to-EBITDA, dividend yield
-
-Portfolio Construction Rules:
-• Diversification: include multiple sectors with positive EV to capture the "long tail" of outperformers.
-• Maximum single-position weight: 15%% (only for extremely high-conviction, low-volatility assets like Novo Nordisk).
-• Typical range: 3–6%% per stock, depending on EV, volatility, and risk correlation.
-• Avoid overexposure to any one sector, region, or currency.
-• Cash buffer: always maintain 8–12%% of total portfolio in cash for high-EV opportunities during corrections.
-
-Execution and Risk Management Rules:
-1. Enter only within the defined "EV buy zone." Optimal buy zones correspond to the range where EV > 7%% and downside risk < 10%%. Avoid buying into EV < 3%% or after strong rallies.
-
-2. Add positions gradually ("laddered entries"). Divide entries into 2–3 limit orders across a price range to average in probabilistically.
-
-3. Never average down mechanically. Only average down if EV increases and probability of success remains >55%%.
-
-4. Position trimming: If EV drops below +3%% (e.g., due to overvaluation), trim or take profits.
-
-5. Portfolio rebalancing: Review weights quarterly. Maintain overall Kelly usage between 0.75–0.85 (not fully leveraged).
-
-6. Hold cash strategically. Cash has optional value during corrections. Reinvest only when market-wide EV turns positive again.
-
-Behavioral and Philosophical Anchors:
-• Avoid emotional reactions to drawdowns. Evaluate situations through EV changes, not price changes.
-• Loss ≠ mistake if EV was positive at entry. Focus on process, not short-term results.
-• Never chase hype or "narratives." Wait for probabilistic edge.
-• Diversify into "future rocket stocks" (2%% of positions) to capture asymmetric long-tail gains.
-
-Target Portfolio Metrics:
-Expected Value (EV): +10–11%% (Portfolio-wide mathematical expectation)
-Volatility (σ): 11–13%% (Moderate risk level)
-Sharpe Ratio (EV/σ): 0.8–0.9 (Efficient balance of risk/reward)
-Kelly Utilization: 0.75–0.85 (Safe use of probabilistic leverage)
-Max drawdown tolerance: ≤15%% (Controlled downside risk)
-
-Summary Principle: "Every investment must be a probabilistic bet with a positive expected value, diversified across independent opportunities, and sized according to Kelly to maximize long-term growth without emotional interference."
-
-Please provide a detailed assessment for %s following the template format similar to the NVIDIA analysis example, including:
-
-- Step 1: Data Collection & Fundamental Analysis
-- Step 2: Conservative Parameter Estimation
-- Step 3: Expected Value Calculation
-- Step 4: Kelly Criterion Sizing
-- Step 5: Assessment
-- Step 6: Buy Zone & Strategic Context
-- Recommendation & Action Plan
-- Risk Management Notes
-- Final Assessment
-
-Use real market data and provide specific numbers for all calculations. Be conservative with probability estimates and avoid hype.
-
-%s`, currentDate, stockInfo, ticker, ticker, portfolioContext)
-}
-
-func assessmentCompareFieldSpec() []struct {
-	Key   string
-	Label string
-} {
-	return []struct {
-		Key   string
-		Label string
-	}{
-		{"current_price", "Current Price"},
-		{"fair_value_estimate", "Fair Value Estimate"},
-		{"upside_potential", "Upside Potential"},
-		{"beta", "Beta"},
-		{"downside_risk", "Downside Risk (D)"},
-		{"probability_positive", "Probability of Positive Outcome (p)"},
-		{"volatility", "Volatility (σ)"},
-		{"forward_pe_ratio", "Forward P/E Ratio"},
-		{"eps_growth", "EPS Growth"},
-		{"debt_to_ebitda_ttm", "Debt-to-EBITDA (TTM)"},
-		{"dividend_yield", "Dividend Yield"},
-		{"expected_value_calculation", "Expected Value (EV) Calculation"},
-		{"kelly_criterion_sizing", "Kelly Criterion Sizing"},
-		{"buy_zone", "Buy Zone"},
-		{"final_assessment", "Final Assessment"},
-	}
-}
-
-func (h *AssessmentHandler) upsertAssessment(portfolioID uint, ticker, source, text string) error {
-	ticker = strings.ToUpper(strings.TrimSpace(ticker))
-	source = strings.ToLower(strings.TrimSpace(source))
-
-	var existing models.Assessment
-	err := h.db.Where("portfolio_id = ? AND ticker = ? AND source = ?", portfolioID, ticker, source).First(&existing).Error
-	if err == nil {
-		if updateErr := h.db.Model(&existing).Updates(map[string]interface{}{
-			"assessment": text,
-			"status":     "completed",
-			"updated_at": time.Now(),
-		}).Error; updateErr != nil {
-			return updateErr
-		}
-		// Clean up any legacy duplicates from older behavior.
-		return h.db.Where("portfolio_id = ? AND ticker = ? AND source = ? AND id <> ?", portfolioID, ticker, source, existing.ID).Delete(&models.Assessment{}).Error
-	}
-	if err != gorm.ErrRecordNotFound {
-		return err
-	}
-
-	record := models.Assessment{
-		PortfolioID: portfolioID,
-		Ticker:      ticker,
-		Source:      source,
-		Assessment:  text,
-		Status:      "completed",
-		CreatedAt:   time.Now(),
-	}
-	return h.db.Create(&record).Error
-}
-
-func (h *AssessmentHandler) extractAssessmentCompareRows(ticker, grokAssessment, deepseekAssessment, perplexityAssessment, chatgptAssessment string) ([]AssessmentCompareRow, error) {
-	source := "grok"
-	if h.cfg.XAIAPIKey == "" && h.cfg.DeepseekAPIKey != "" {
-		source = "deepseek"
-	}
-	if h.cfg.XAIAPIKey == "" && h.cfg.DeepseekAPIKey == "" && h.cfg.PerplexityAPIKey == "" && h.cfg.OpenAIAPIKey == "" {
-		return nil, fmt.Errorf("No LLM API key configured")
-	}
-	if h.cfg.XAIAPIKey == "" && h.cfg.DeepseekAPIKey == "" && h.cfg.PerplexityAPIKey == "" {
-		source = "chatgpt"
-	}
-	if h.cfg.XAIAPIKey == "" && h.cfg.DeepseekAPIKey == "" && h.cfg.OpenAIAPIKey == "" {
-		source = "perplexity"
-	}
-
-	perplexityBlock := ""
-	if perplexityAssessment != "" {
-		perplexityBlock = `,
-  "perplexity": {
-    "current_price": "...",
-    "fair_value_estimate": "...",
-    "upside_potential": "...",
-    "beta": "...",
-    "downside_risk": "...",
-    "probability_positive": "...",
-    "volatility": "...",
-    "forward_pe_ratio": "...",
-    "eps_growth": "...",
-    "debt_to_ebitda_ttm": "...",
-    "dividend_yield": "...",
-    "expected_value_calculation": "...",
-    "kelly_criterion_sizing": "...",
-    "buy_zone": "...",
-    "final_assessment": "ADD|SELL|HOLD|N/A"
-  }`
-	}
-	chatgptBlock := ""
-	if chatgptAssessment != "" {
-		chatgptBlock = `,
-  "chatgpt": {
-    "current_price": "...",
-    "fair_value_estimate": "...",
-    "upside_potential": "...",
-    "beta": "...",
-    "downside_risk": "...",
-    "probability_positive": "...",
-    "volatility": "...",
-    "forward_pe_ratio": "...",
-    "eps_growth": "...",
-    "debt_to_ebitda_ttm": "...",
-    "dividend_yield": "...",
-    "expected_value_calculation": "...",
-    "kelly_criterion_sizing": "...",
-    "buy_zone": "...",
-    "final_assessment": "ADD|SELL|HOLD|N/A"
-  }`
-	}
-	systemContent := "You are a financial data extraction assistant. Extract only values explicitly present in text. If a field is absent, return 'N/A'. For final assessment return only ADD, SELL, or HOLD if clearly stated, otherwise N/A."
-	userContent := fmt.Sprintf(`Extract the requested fields from the stock assessment summaries for ticker %s.
-
-Return STRICT JSON with this exact shape (include "perplexity" and/or "chatgpt" only if the corresponding summary is provided below):
-{
-  "grok": {
-    "current_price": "...",
-    "fair_value_estimate": "...",
-    "upside_potential": "...",
-    "beta": "...",
-    "downside_risk": "...",
-    "probability_positive": "...",
-    "volatility": "...",
-    "forward_pe_ratio": "...",
-    "eps_growth": "...",
-    "debt_to_ebitda_ttm": "...",
-    "dividend_yield": "...",
-    "expected_value_calculation": "...",
-    "kelly_criterion_sizing": "...",
-    "buy_zone": "...",
-    "final_assessment": "ADD|SELL|HOLD|N/A"
-  },
-  "deepseek": {
-    "current_price": "...",
-    "fair_value_estimate": "...",
-    "upside_potential": "...",
-    "beta": "...",
-    "downside_risk": "...",
-    "probability_positive": "...",
-    "volatility": "...",
-    "forward_pe_ratio": "...",
-    "eps_growth": "...",
-    "debt_to_ebitda_ttm": "...",
-    "dividend_yield": "...",
-    "expected_value_calculation": "...",
-    "kelly_criterion_sizing": "...",
-    "buy_zone": "...",
-    "final_assessment": "ADD|SELL|HOLD|N/A"
-  }%s%s
-}
-
-Rules:
-- Keep values compact and human-readable.
-- Preserve units/percent signs if present.
-- Do not invent missing data.
-- Output raw JSON only, no markdown.
-
-GROK SUMMARY:
-%s
-
-DEEPSEEK SUMMARY:
-%s
-`, ticker, perplexityBlock, chatgptBlock, grokAssessment, deepseekAssessment)
-	if perplexityAssessment != "" {
-		userContent += "\n\nPERPLEXITY SUMMARY:\n" + perplexityAssessment
-	}
-	if chatgptAssessment != "" {
-		userContent += "\n\nCHATGPT SUMMARY:\n" + chatgptAssessment
-	}
-
-	content, err := h.callChatCompletion(systemContent, userContent, source)
-	if err != nil {
-		return nil, err
-	}
-
-	content = strings.TrimSpace(content)
-	if strings.HasPrefix(content, "```json") {
-		content = strings.TrimPrefix(content, "```json")
-		content = strings.TrimSuffix(content, "```")
-	} else if strings.HasPrefix(content, "```") {
-		content = strings.TrimPrefix(content, "```")
-		content = strings.TrimSuffix(content, "```")
-	}
-	content = strings.TrimSpace(content)
-
-	var parsed assessmentCompareLLMResult
-	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
-		h.logger.Error().Err(err).Str("content", content).Msg("Failed to parse assessment comparison JSON")
-		return nil, fmt.Errorf("Failed to parse comparison output")
-	}
-
-	fieldSpec := assessmentCompareFieldSpec()
-	rows := make([]AssessmentCompareRow, 0, len(fieldSpec))
-	for _, f := range fieldSpec {
-		grokValue := "N/A"
-		deepseekValue := "N/A"
-		perplexityValue := "N/A"
-		chatgptValue := "N/A"
-		if parsed.Grok != nil {
-			if value := strings.TrimSpace(parsed.Grok[f.Key]); value != "" {
-				grokValue = value
-			}
-		}
-		if parsed.Deepseek != nil {
-			if value := strings.TrimSpace(parsed.Deepseek[f.Key]); value != "" {
-				deepseekValue = value
-			}
-		}
-		if parsed.Perplexity != nil {
-			if value := strings.TrimSpace(parsed.Perplexity[f.Key]); value != "" {
-				perplexityValue = value
-			}
-		}
-		if parsed.ChatGPT != nil {
-			if value := strings.TrimSpace(parsed.ChatGPT[f.Key]); value != "" {
-				chatgptValue = value
-			}
-		}
-		rows = append(rows, AssessmentCompareRow{
-			Key:        f.Key,
-			Label:      f.Label,
-			Grok:       grokValue,
-			Deepseek:   deepseekValue,
-			Perplexity: perplexityValue,
-			ChatGPT:    chatgptValue,
-		})
-	}
-
-	return rows, nil
-}
-
-func (h *AssessmentHandler) persistAssessmentDiff(ticker string, rows []AssessmentCompareRow) error {
-	payload, err := json.Marshal(rows)
-	if err != nil {
-		return err
-	}
-
-	var existing models.AssessmentDiff
-	err = h.db.Where("ticker = ?", ticker).First(&existing).Error
-	if err == nil {
-		return h.db.Model(&existing).Updates(map[string]interface{}{
-			"rows_json":  string(payload),
-			"updated_at": time.Now(),
-		}).Error
-	}
-	if err != gorm.ErrRecordNotFound {
-		return err
-	}
-
-	record := models.AssessmentDiff{
-		Ticker:   ticker,
-		RowsJSON: string(payload),
-	}
-	return h.db.Create(&record).Error
-}
-
-func (h *AssessmentHandler) regenerateAndPersistAssessmentDiff(portfolioID uint, ticker string) error {
-	ticker = strings.ToUpper(strings.TrimSpace(ticker))
-	var records []models.Assessment
-	if err := h.db.Where("portfolio_id = ? AND ticker = ? AND source IN ? AND status = ?", portfolioID, ticker, []string{"grok", "deepseek", "perplexity", "chatgpt"}, "completed").Find(&records).Error; err != nil {
-		return err
-	}
-
-	var grokText, deepseekText, perplexityText, chatgptText string
-	for _, record := range records {
-		switch strings.ToLower(record.Source) {
-		case "grok":
-			grokText = record.Assessment
-		case "deepseek":
-			deepseekText = record.Assessment
-		case "perplexity":
-			perplexityText = record.Assessment
-		case "chatgpt":
-			chatgptText = record.Assessment
-		}
-	}
-
-	if strings.TrimSpace(grokText) == "" || strings.TrimSpace(deepseekText) == "" {
-		return nil
-	}
-
-	rows, err := h.extractAssessmentCompareRows(ticker, grokText, deepseekText, perplexityText, chatgptText)
-	if err != nil {
-		return err
-	}
-	return h.persistAssessmentDiff(ticker, rows)
-}
-
-const maxStoredAssessments = 100
-
-// cleanupOldAssessments keeps at most maxStoredAssessments; deletes oldest first.
-func (h *AssessmentHandler) cleanupOldAssessments() {
-	var count int64
-	if err := h.db.Model(&models.Assessment{}).Count(&count).Error; err != nil {
-		h.logger.Error().Err(err).Msg("Failed to count assessments")
-		return
-	}
-	if count <= maxStoredAssessments {
-		return
-	}
-	var idsToDelete []uint
-	if err := h.db.Model(&models.Assessment{}).
-		Select("id").
-		Order("created_at ASC").
-		Limit(int(count - maxStoredAssessments)).
-		Pluck("id", &idsToDelete).Error; err != nil {
-		h.logger.Error().Err(err).Msg("Failed to get assessment IDs for cleanup")
-		return
-	}
-	if len(idsToDelete) == 0 {
-		return
-	}
-	if err := h.db.Where("id IN ?", idsToDelete).Delete(&models.Assessment{}).Error; err != nil {
-		h.logger.Error().Err(err).Msg("Failed to delete old assessments")
-	} else {
-		h.logger.Info().Int("deleted", len(idsToDelete)).Int("remaining", maxStoredAssessments).Msg("Cleaned up old assessments")
-	}
-}
@@ -0,0 +1,964 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCallChatCompletionUsesConfiguredAssessmentModel(t *testing.T) {
+	t.Parallel()
+	cfg := &config.Config{
+		XAIAPIKey:    "test-key",
+		OpenAIAPIKey: "test-key",
+		ProviderModels: map[string]map[string]string{
+			config.UseCaseAssessment: {"grok": "grok-custom", "chatgpt": "gpt-custom"},
+		},
+	}
+	h := NewAssessmentHandler(nil, cfg, zerolog.Nop())
+
+	var gotModel string
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		gotModel, _ = body["model"].(string)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"ok"}}]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	for source, want := range map[string]string{"grok": "grok-custom", "chatgpt": "gpt-custom"} {
+		if _, err := h.callChatCompletion("system", "user", source); err != nil {
+			t.Fatalf("%s: callChatCompletion: %v", source, err)
+		}
+		if gotModel != want {
+			t.Errorf("%s model: got %q want %q", source, gotModel, want)
+		}
+	}
+}
+
+type stubStockPriceFetcher struct {
+	price   float64
+	tickers []string
+}
+
+func (s *stubStockPriceFetcher) FetchStockPrice(ticker string) (float64, error) {
+	s.tickers = append(s.tickers, ticker)
+	return s.price, nil
+}
+
+func TestRequestAssessmentRefreshesStalePriceBeforePrompt(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	stock := models.Stock{
+		PortfolioID:  portfolio.ID,
+		Ticker:       "ACME",
+		CompanyName:  "Acme Corp",
+		Currency:     "USD",
+		CurrentPrice: 100,
+		FairValue:    150,
+		Beta:         1.2,
+		LastUpdated:  time.Now().Add(-3 * time.Hour),
+	}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	cfg := &config.Config{XAIAPIKey: "test-key", AssessmentFreshPrice: true, AssessmentPriceMaxAgeMinutes: 60}
+	h := NewAssessmentHandler(db, cfg, zerolog.Nop())
+	fetcher := &stubStockPriceFetcher{price: 123.45}
+	h.priceFetcher = fetcher
+
+	var prompt string
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// The price must already be refreshed when the prompt is built.
+		if len(fetcher.tickers) != 1 {
+			t.Errorf("expected price refetch before LLM call, got %d fetches", len(fetcher.tickers))
+		}
+		var body struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		for _, msg := range body.Messages {
+			if msg.Role == "user" {
+				prompt = msg.Content
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"ok"}}]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessment/request", strings.NewReader(`{"ticker":"acme","source":"grok","current_price":90,"currency":"USD"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.RequestAssessment(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	if len(fetcher.tickers) != 1 || fetcher.tickers[0] != "ACME" {
+		t.Fatalf("expected one refetch for ACME, got %v", fetcher.tickers)
+	}
+	for _, want := range []string{"**Current Price:** 123.45 USD (portfolio data", "**Fair Value:** 150.00 USD", "**Beta:** 1.20"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+	if strings.Contains(prompt, "user-provided") {
+		t.Error("expected stored data to replace the user-provided price")
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.CurrentPrice != 100 {
+		t.Errorf("the refetched price must stay in the prompt only, stored CurrentPrice: got %.2f want 100", saved.CurrentPrice)
+	}
+	if time.Since(saved.LastUpdated) < 2*time.Hour {
+		t.Errorf("expected LastUpdated to be left alone, got %v", saved.LastUpdated)
+	}
+}
+
+type fakeLLMProvider struct {
+	reply        string
+	err          error
+	systemPrompt string
+	userPrompt   string
+}
+
+func (f *fakeLLMProvider) Complete(_ context.Context, systemPrompt, userPrompt string) (string, error) {
+	f.systemPrompt, f.userPrompt = systemPrompt, userPrompt
+	return f.reply, f.err
+}
+
+func TestRequestAssessmentUsesInjectedLLMProvider(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-provider-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{DeepseekAPIKey: "test-key"}, zerolog.Nop())
+	fake := &fakeLLMProvider{reply: "Deepseek says hold"}
+	h.assessments.Providers = map[string]services.LLMProvider{"deepseek": fake}
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected HTTP call to %s", req.URL)
+		return nil, context.Canceled
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessment/request", strings.NewReader(`{"ticker":"acme","source":"deepseek","current_price":90,"currency":"USD"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.RequestAssessment(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var resp AssessmentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Assessment != "Deepseek says hold" {
+		t.Fatalf("assessment: got %q", resp.Assessment)
+	}
+	if fake.systemPrompt != services.AssessmentSystemPrompt || !strings.Contains(fake.userPrompt, "ACME") {
+		t.Fatalf("unexpected prompts: system %q, user missing ticker", fake.systemPrompt)
+	}
+}
+
+func TestRequestAssessmentRejectsEmptyContent(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-empty-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{DeepseekAPIKey: "test-key"}, zerolog.Nop())
+	h.assessments.Providers = map[string]services.LLMProvider{"deepseek": &fakeLLMProvider{reply: " \n\t "}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessment/request", strings.NewReader(`{"ticker":"acme","source":"deepseek","current_price":90,"currency":"USD"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.RequestAssessment(c)
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status: got %d want 502, body %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "retryable") {
+		t.Fatalf("empty content is not retried, so it must not be flagged retryable: %s", w.Body.String())
+	}
+	var saved int64
+	db.Model(&models.Assessment{}).Count(&saved)
+	if saved != 0 {
+		t.Fatalf("expected no saved assessment, got %d", saved)
+	}
+
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"   "}}]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	h.cfg.XAIAPIKey = "test-key"
+	if _, err := h.callChatCompletion("system", "user", "grok"); !errors.Is(err, services.ErrEmptyContent) {
+		t.Fatalf("callChatCompletion: got %v, want ErrEmptyContent", err)
+	}
+}
+
+func TestRequestAssessmentAddsSectorContextForTrackedStock(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-sector-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}, &models.UserSettings{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true, UserID: 7}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	stock := models.Stock{PortfolioID: portfolio.ID, Ticker: "NOVO", CompanyName: "Novo Nordisk", Sector: "Health Care", Beta: 0.8, Currency: "DKK"}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	other := models.Portfolio{Name: "Other", UserID: 8}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("create other portfolio: %v", err)
+	}
+	if err := db.Create(&models.Stock{PortfolioID: other.ID, Ticker: "ASML", Sector: "Technology", Currency: "EUR"}).Error; err != nil {
+		t.Fatalf("create other stock: %v", err)
+	}
+	targets := `{"rows":[{"sector":"Healthcare","min":25,"max":30},{"sector":"Cash","min":8,"max":12}]}`
+	if err := db.Create(&models.UserSettings{UserID: 7, Key: services.SectorTargetsSettingKey, Value: targets}).Error; err != nil {
+		t.Fatalf("create sector targets: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{DeepseekAPIKey: "test-key"}, zerolog.Nop())
+	fake := &fakeLLMProvider{reply: "Hold"}
+	h.assessments.Providers = map[string]services.LLMProvider{"deepseek": fake}
+
+	request := func(ticker string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/assessment/request", strings.NewReader(`{"ticker":"`+ticker+`","source":"deepseek"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.RequestAssessment(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+		}
+		return fake.userPrompt
+	}
+
+	prompt := request("novo")
+	for _, want := range []string{"## SECTOR CONTEXT", "**Sector:** Healthcare (target allocation 25–30% of the portfolio)", "**Beta:** 0.80", "**Trading Currency:** DKK"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+	// Untracked tickers get no sector context.
+	if prompt := request("zzzz"); strings.Contains(prompt, "## SECTOR CONTEXT") {
+		t.Error("expected no sector context for an untracked ticker")
+	}
+	// Stocks tracked only in another portfolio do not leak into the prompt.
+	if prompt := request("asml"); strings.Contains(prompt, "## SECTOR CONTEXT") {
+		t.Error("expected no sector context for a ticker tracked only in another portfolio")
+	}
+}
+
+func TestCompareProvidersReturnsBothResultsWhenOneFails(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-compare-providers-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{}, zerolog.Nop())
+	h.assessments.Providers = map[string]services.LLMProvider{
+		"grok":     &fakeLLMProvider{reply: "Grok says add"},
+		"deepseek": &fakeLLMProvider{err: errors.New("deepseek unavailable")},
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessments/compare", strings.NewReader(`{"ticker":"acme"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.CompareProviders(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Ticker   string                   `json:"ticker"`
+		Grok     ProviderAssessmentResult `json:"grok"`
+		Deepseek ProviderAssessmentResult `json:"deepseek"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Ticker != "ACME" || body.Grok.Assessment != "Grok says add" || body.Grok.Error != "" {
+		t.Fatalf("unexpected grok result: %+v", body)
+	}
+	if body.Deepseek.Assessment != "" || !strings.Contains(body.Deepseek.Error, "deepseek unavailable") {
+		t.Fatalf("unexpected deepseek result: %+v", body.Deepseek)
+	}
+
+	var stored []models.Assessment
+	if err := db.Where("ticker = ?", "ACME").Find(&stored).Error; err != nil {
+		t.Fatalf("load assessments: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Source != "grok" || stored[0].Assessment != "Grok says add" {
+		t.Fatalf("stored assessments: %+v", stored)
+	}
+}
+
+func TestPruneAssessmentsRequiresBeforeAndDeletesOlder(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-prune-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	cutoff := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, updatedAt := range []time.Time{cutoff.AddDate(0, -2, 0), cutoff.AddDate(0, 0, -1), cutoff.AddDate(0, 0, 1)} {
+		record := models.Assessment{PortfolioID: portfolio.ID, Ticker: "ACME", Source: []string{"grok", "deepseek", "claude"}[i], Status: "completed", CreatedAt: updatedAt, UpdatedAt: updatedAt}
+		if err := db.Create(&record).Error; err != nil {
+			t.Fatalf("create assessment: %v", err)
+		}
+	}
+	h := NewAssessmentHandler(db, &config.Config{}, zerolog.Nop())
+
+	prune := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/assessments"+query, nil)
+		h.PruneAssessments(c)
+		return w
+	}
+
+	if w := prune(""); w.Code != http.StatusBadRequest {
+		t.Fatalf("without before: got %d want 400", w.Code)
+	}
+	if w := prune("?before=yesterday"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid before: got %d want 400", w.Code)
+	}
+	var count int64
+	db.Model(&models.Assessment{}).Count(&count)
+	if count != 3 {
+		t.Fatalf("rejected prunes deleted rows: %d left", count)
+	}
+
+	w := prune("?before=" + cutoff.Format(time.RFC3339))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Deleted != 2 {
+		t.Fatalf("deleted: got %d want 2", resp.Deleted)
+	}
+	var left []models.Assessment
+	db.Find(&left)
+	if len(left) != 1 || left[0].Source != "claude" {
+		t.Fatalf("remaining assessments: %+v", left)
+	}
+}
+
+func TestGenerateAssessmentPicksLowestEVChoice(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-choices-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	cfg := &config.Config{XAIAPIKey: "test-key", AssessmentLLMChoices: 3}
+	h := NewAssessmentHandler(db, cfg, zerolog.Nop())
+
+	var gotN float64
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		gotN, _ = body["n"].(float64)
+		reply := `{"choices":[
+			{"message":{"content":"EV = 9.5%\nAssessment: Add"}},
+			{"message":{"content":"EV = 2.1%\nAssessment: Trim"}},
+			{"message":{"content":"No figures this time"}}
+		]}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(reply)), Header: make(http.Header)}, nil
+	})
+
+	text, err := h.generateGrokAssessment(1, "ACME", "", "Acme Corp", 100, "USD", "", "", "", nil)
+	if err != nil {
+		t.Fatalf("generateGrokAssessment: %v", err)
+	}
+	if gotN != 3 {
+		t.Errorf("n: got %v want 3", gotN)
+	}
+	if !strings.Contains(text, "EV = 2.1%") {
+		t.Fatalf("expected the lowest-EV choice, got %q", text)
+	}
+}
+
+func TestGetRecentAssessmentsPaginatesAndFiltersByTicker(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-recent-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sources := []string{"grok", "deepseek", "perplexity", "chatgpt", "claude"}
+	for i := 0; i < 5; i++ {
+		for _, ticker := range []string{"ACME", "BETA"} {
+			record := models.Assessment{PortfolioID: portfolio.ID, Ticker: ticker, Source: sources[i], Status: "completed", CreatedAt: start.AddDate(0, 0, i)}
+			if err := db.Create(&record).Error; err != nil {
+				t.Fatalf("create assessment: %v", err)
+			}
+		}
+	}
+	h := NewAssessmentHandler(db, &config.Config{}, zerolog.Nop())
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/assessment/recent"+query, nil)
+		h.GetRecentAssessments(c)
+		return w
+	}
+
+	w := get("?ticker=acme&limit=2&offset=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	// The body stays a bare array; the total is in a header.
+	var page []models.Assessment
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "5" {
+		t.Fatalf("X-Total-Count: got %q want 5", total)
+	}
+	// Newest first, skipping the newest (claude): chatgpt then perplexity.
+	if len(page) != 2 || page[0].Source != "chatgpt" || page[1].Source != "perplexity" {
+		t.Fatalf("page: got %+v", page)
+	}
+	for _, record := range page {
+		if record.Ticker != "ACME" {
+			t.Fatalf("ticker filter: got %s", record.Ticker)
+		}
+	}
+
+	for _, query := range []string{"?limit=101", "?limit=0", "?offset=-1"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d want 400", query, w.Code)
+		}
+	}
+}
+
+type stubTickerResolver struct {
+	resolved bool
+	tickers  []string
+}
+
+func (s *stubTickerResolver) ResolveTicker(ticker string) (bool, error) {
+	s.tickers = append(s.tickers, ticker)
+	return s.resolved, nil
+}
+
+func TestRequestAssessmentRejectsUnresolvableTicker(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-resolve-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{XAIAPIKey: "test-key", AssessmentRequireResolvableTicker: true}, zerolog.Nop())
+	resolver := &stubTickerResolver{resolved: false}
+	h.tickerResolver = resolver
+	llmCalls := 0
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		llmCalls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"hallucinated"}}]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessment/request", strings.NewReader(`{"ticker":"zzzz","source":"grok"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.RequestAssessment(c)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status: got %d want 404, body %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "ZZZZ could not be resolved") {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+	if len(resolver.tickers) != 1 || resolver.tickers[0] != "ZZZZ" {
+		t.Errorf("expected one lookup for ZZZZ, got %v", resolver.tickers)
+	}
+	if llmCalls != 0 {
+		t.Errorf("expected no LLM call, got %d", llmCalls)
+	}
+	var count int64
+	db.Model(&models.Assessment{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected no stored assessment, got %d", count)
+	}
+}
+
+func TestRequestAssessmentServesCachedAssessmentUnlessForced(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-cache-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if err := db.Create(&models.Assessment{PortfolioID: portfolio.ID, Ticker: "ACME", Source: "grok", Assessment: "cached text", Status: "completed"}).Error; err != nil {
+		t.Fatalf("create assessment: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{XAIAPIKey: "test-key", AssessmentCacheTTLMinutes: 360}, zerolog.Nop())
+	llmCalls := 0
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		llmCalls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"fresh text"}}]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	request := func(target string) AssessmentResponse {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"ticker":"acme","source":"grok"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.RequestAssessment(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", target, w.Code, w.Body.String())
+		}
+		var resp AssessmentResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	if resp := request("/assessment/request"); resp.Assessment != "cached text" || !resp.Cached || llmCalls != 0 {
+		t.Fatalf("expected cached assessment without LLM call, got %+v after %d calls", resp, llmCalls)
+	}
+	if resp := request("/assessment/request?force=true"); resp.Assessment != "fresh text" || resp.Cached || llmCalls != 1 {
+		t.Fatalf("expected forced regeneration, got %+v after %d calls", resp, llmCalls)
+	}
+
+	// Past the TTL the stored assessment is regenerated.
+	if err := db.Model(&models.Assessment{}).Where("ticker = ?", "ACME").UpdateColumn("updated_at", time.Now().Add(-7*time.Hour)).Error; err != nil {
+		t.Fatalf("age assessment: %v", err)
+	}
+	if resp := request("/assessment/request"); resp.Cached || llmCalls != 2 {
+		t.Fatalf("expected an LLM call past the TTL, got %+v after %d calls", resp, llmCalls)
+	}
+}
+
+// blockingStreamBody yields the first chunk, then blocks until the upstream request's context ends.
+type blockingStreamBody struct {
+	ctx   context.Context
+	first *strings.Reader
+}
+
+func (b *blockingStreamBody) Read(p []byte) (int, error) {
+	if b.first.Len() > 0 {
+		return b.first.Read(p)
+	}
+	<-b.ctx.Done()
+	return 0, b.ctx.Err()
+}
+
+func (b *blockingStreamBody) Close() error { return nil }
+
+func TestStreamAssessmentRelaysDeltasAndPersistsText(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-stream-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+
+	h := NewAssessmentHandler(db, &config.Config{XAIAPIKey: "test-key"}, zerolog.Nop())
+	var streamed bool
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		streamed, _ = body["stream"].(bool)
+		chunks := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Buy \"}}]}\n\n" +
+			": keep-alive\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"ACME\"}}]}\n\n" +
+			"data: [DONE]\n\n"
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(chunks)),
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		}, nil
+	})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessments/stream", strings.NewReader(`{"ticker":"acme","source":"grok"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.StreamAssessment(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	if !streamed {
+		t.Error("expected stream=true in the provider request")
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type: got %q want text/event-stream", ct)
+	}
+	out := w.Body.String()
+	if strings.Count(out, "event:delta") != 2 || !strings.Contains(out, `"content":"Buy "`) || !strings.Contains(out, "event:done") {
+		t.Fatalf("unexpected event stream: %s", out)
+	}
+	var saved models.Assessment
+	if err := db.Where("ticker = ? AND source = ?", "ACME", "grok").First(&saved).Error; err != nil {
+		t.Fatalf("load assessment: %v", err)
+	}
+	if saved.Assessment != "Buy ACME" || saved.Status != "completed" {
+		t.Errorf("saved assessment: got %q (%s) want \"Buy ACME\" (completed)", saved.Assessment, saved.Status)
+	}
+
+	// A client disconnect cancels the upstream request mid-stream and nothing is persisted.
+	upstreamDone := make(chan struct{})
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		go func() {
+			<-req.Context().Done()
+			close(upstreamDone)
+		}()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       &blockingStreamBody{ctx: req.Context(), first: strings.NewReader("data: {\"choices\":[{\"delta\":{\"content\":\"Partial\"}}]}\n\n")},
+			Header:     make(http.Header),
+		}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/assessments/stream", strings.NewReader(`{"ticker":"other","source":"grok"}`)).WithContext(ctx)
+	c.Request.Header.Set("Content-Type", "application/json")
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	h.StreamAssessment(c)
+
+	select {
+	case <-upstreamDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the upstream request context to be cancelled")
+	}
+	if strings.Contains(w.Body.String(), "event:done") {
+		t.Errorf("expected no done event after disconnect, got %s", w.Body.String())
+	}
+	var count int64
+	db.Model(&models.Assessment{}).Where("ticker = ?", "OTHER").Count(&count)
+	if count != 0 {
+		t.Errorf("expected no stored assessment after disconnect, got %d", count)
+	}
+}
+
+func TestExportAssessmentMarkdownIncludesHeader(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-export-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	assessment := models.Assessment{
+		PortfolioID: 1,
+		Ticker:      "ACME",
+		Source:      "grok",
+		Status:      "completed",
+		Assessment: "## Step 3: Expected Value Calculation\n" +
+			"EV = (0.6 × 30%) + (0.4 × -20%) = 10.0%\n" +
+			"## Step 4: Kelly Criterion Sizing\n" +
+			"½-Kelly = 18.3% / 2 = 9.2%\n" +
+			"## Final Assessment: Add\n",
+		CreatedAt: time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC),
+	}
+	if err := db.Create(&assessment).Error; err != nil {
+		t.Fatalf("create assessment: %v", err)
+	}
+	h := NewAssessmentHandler(db, &config.Config{}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/assessments/1/export?format=md", nil)
+
+	h.ExportAssessment(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment;filename="ACME_grok_2026-03-14.md"` {
+		t.Errorf("Content-Disposition: got %q", got)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# ACME assessment",
+		"- **Source:** grok",
+		"- **Date:** 2026-03-14",
+		"- **Expected Value:** 10.0%",
+		"- **½-Kelly:** 9.2%",
+		"- **Assessment:** Add",
+		"EV = (0.6 × 30%)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("export missing %q:\n%s", want, body)
+		}
+	}
+
+	pdf := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(pdf)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/assessments/1/export?format=pdf", nil)
+	h.ExportAssessment(c)
+	if pdf.Code != http.StatusOK || !strings.HasPrefix(pdf.Body.String(), "%PDF-") {
+		t.Errorf("pdf export: got status %d, prefix %q", pdf.Code, pdf.Body.String()[:min(8, pdf.Body.Len())])
+	}
+}
+
+func TestRecommendSourcePrefersConservativeEV(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-recommend-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.FairValueHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Main", IsDefault: true}).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+
+	cfg := &config.Config{XAIAPIKey: "test-key", DeepseekAPIKey: "test-key", AssessmentSourceTieBreak: TieBreakConservativeEV, AssessmentMinEVImprovement: 2}
+	h := NewAssessmentHandler(db, cfg, zerolog.Nop())
+	replies := map[string]string{
+		"api.x.ai":         "EV = (0.65 × 30%) + (0.35 × -20%) = 12.5%\\n½-Kelly = 6.0%\\nFinal Assessment: Add",
+		"api.deepseek.com": "EV = (0.6 × 25%) + (0.4 × -20%) = 7.0%\\n½-Kelly = 3.5%\\nFinal Assessment: Hold",
+	}
+	h.client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"` + replies[req.URL.Host] + `"}}]}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	recommend := func(body string) (string, string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/assessment/recommend-source", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.RecommendSource(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+		}
+		var out struct {
+			RecommendedSource string `json:"recommended_source"`
+			Reason            string `json:"reason"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out.RecommendedSource, out.Reason
+	}
+
+	// 12.5% vs 7.0%: the more conservative Deepseek EV wins.
+	if source, reason := recommend(`{"ticker":"acme"}`); source != "deepseek" {
+		t.Errorf("conservative tie-break: got %s (%s), want deepseek", source, reason)
+	}
+	// The 5.5-point gap is below a 6-point minimum, so the current source is kept.
+	if source, reason := recommend(`{"ticker":"acme","current_source":"grok","min_ev_improvement":6}`); source != "grok" {
+		t.Errorf("min improvement: got %s (%s), want grok", source, reason)
+	}
+
+	var saved int64
+	db.Model(&models.Assessment{}).Where("ticker = ?", "ACME").Count(&saved)
+	if saved != 2 {
+		t.Errorf("expected both source assessments persisted, got %d", saved)
+	}
+}
+
+func TestUpsertAssessmentPersistsFinalAssessmentFields(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-final-fields-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	h := NewAssessmentHandler(db, &config.Config{}, zerolog.Nop())
+
+	// The Step 3 figures come before the Final Assessment section and must be ignored.
+	text := "### Step 3: EV\nEV = 20.0%\n½-Kelly = 9.0%\n\n## Final Assessment\n**Trim**\n- EV: 4.5%\n- ½-Kelly: 2.25%\n"
+	if err := h.assessments.Upsert(1, "acme", "grok", text); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	var stored models.Assessment
+	if err := db.Where("ticker = ?", "ACME").First(&stored).Error; err != nil {
+		t.Fatalf("load assessment: %v", err)
+	}
+	if stored.ExpectedValue == nil || *stored.ExpectedValue != 4.5 ||
+		stored.HalfKelly == nil || *stored.HalfKelly != 2.25 ||
+		stored.Recommendation == nil || *stored.Recommendation != "Trim" {
+		t.Fatalf("parsed fields: ev=%v kelly=%v rec=%v", stored.ExpectedValue, stored.HalfKelly, stored.Recommendation)
+	}
+
+	// Without a Final Assessment section the fields are cleared rather than failing the write.
+	if err := h.assessments.Upsert(1, "acme", "grok", "EV = 12%, looks like an Add"); err != nil {
+		t.Fatalf("upsert unparseable: %v", err)
+	}
+	stored = models.Assessment{}
+	if err := db.Where("ticker = ?", "ACME").First(&stored).Error; err != nil {
+		t.Fatalf("reload assessment: %v", err)
+	}
+	if stored.ExpectedValue != nil || stored.HalfKelly != nil || stored.Recommendation != nil {
+		t.Fatalf("expected null fields, got ev=%v kelly=%v rec=%v", stored.ExpectedValue, stored.HalfKelly, stored.Recommendation)
+	}
+	if stored.Assessment != "EV = 12%, looks like an Add" {
+		t.Fatalf("assessment text not updated: %q", stored.Assessment)
+	}
+}
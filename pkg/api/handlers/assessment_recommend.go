@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Tie-break rules for choosing which assessment source to act on.
+const (
+	TieBreakConservativeEV      = "conservative_ev"       // Lower EV wins
+	TieBreakFairValueDispersion = "fair_value_dispersion" // Source with tighter recent fair values wins
+)
+
+// sourceDispersionWindowDays bounds the fair value history used for per-source dispersion.
+const sourceDispersionWindowDays = 90
+
+// SourceRecommendationRequest asks which assessment source to act on for a ticker.
+type SourceRecommendationRequest struct {
+	Ticker        string   `json:"ticker" binding:"required"`
+	CurrentSource string   `json:"current_source"`     // Source currently acted on (grok/deepseek), optional
+	TieBreak      string   `json:"tie_break"`          // conservative_ev or fair_value_dispersion; defaults to config
+	MinEVImprove  *float64 `json:"min_ev_improvement"` // EV points needed to switch from current_source; defaults to config
+}
+
+// SourceCandidate is one source's parsed assessment figures.
+type SourceCandidate struct {
+	Source              string   `json:"source"`
+	ExpectedValue       *float64 `json:"expected_value"`
+	HalfKelly           *float64 `json:"half_kelly"`
+	Assessment          string   `json:"assessment"`
+	FairValueDispersion *float64 `json:"fair_value_dispersion"` // Coefficient of variation of recent fair values from this provider
+	Error               string   `json:"error,omitempty"`
+}
+
+// RecommendSource runs Grok and Deepseek assessments for a ticker, parses EV/½-Kelly from each
+// and recommends which source to act on using the configured tie-break rule.
+func (h *AssessmentHandler) RecommendSource(c *gin.Context) {
+	var req SourceRecommendationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ticker := strings.ToUpper(strings.TrimSpace(req.Ticker))
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	if !h.ensureTickerResolvable(c, ticker) {
+		return
+	}
+
+	tieBreak := req.TieBreak
+	if tieBreak == "" {
+		tieBreak = h.cfg.AssessmentSourceTieBreak
+	}
+	if tieBreak == "" {
+		tieBreak = TieBreakConservativeEV
+	}
+	if tieBreak != TieBreakConservativeEV && tieBreak != TieBreakFairValueDispersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tie_break must be conservative_ev or fair_value_dispersion"})
+		return
+	}
+	minImprovement := h.cfg.AssessmentMinEVImprovement
+	if req.MinEVImprove != nil {
+		minImprovement = *req.MinEVImprove
+	}
+	currentSource := strings.ToLower(strings.TrimSpace(req.CurrentSource))
+
+	var stockData *models.Stock
+	var stock models.Stock
+	if err := h.db.Where("portfolio_id = ? AND ticker = ?", portfolioID, ticker).First(&stock).Error; err == nil {
+		stockData = &stock
+	}
+	companyName, currentPrice, currency := "", 0.0, ""
+	if stockData != nil {
+		companyName, currentPrice, currency = stockData.CompanyName, stockData.CurrentPrice, stockData.Currency
+	}
+
+	sources := []struct {
+		name     string
+		provider string // FairValueHistory source prefix
+		generate assessmentGenerator
+	}{
+		{"grok", "Grok", h.generateGrokAssessment},
+		{"deepseek", "Deepseek", h.generateDeepseekAssessment},
+	}
+	generators := make([]assessmentGenerator, len(sources))
+	for i, source := range sources {
+		generators[i] = source.generate
+	}
+	outcomes := generateFromProviders(generators, portfolioID, ticker, "", companyName, currentPrice, currency, stockData)
+
+	candidates := make([]SourceCandidate, len(sources))
+	for i, source := range sources {
+		candidates[i].Source = source.name
+		if stockData != nil {
+			candidates[i].FairValueDispersion = h.providerFairValueDispersion(stockData.ID, source.provider)
+		}
+		if outcomes[i].err != nil {
+			candidates[i].Error = outcomes[i].err.Error()
+			continue
+		}
+		summary := services.ParseAssessmentSummary(outcomes[i].text)
+		candidates[i].ExpectedValue = services.ParsePercentValue(summary.ExpectedValue)
+		candidates[i].HalfKelly = services.ParsePercentValue(summary.HalfKelly)
+		candidates[i].Assessment = summary.Recommendation
+		if err := h.assessments.Upsert(portfolioID, ticker, source.name, outcomes[i].text); err != nil {
+			h.logger.Warn().Err(err).Str("ticker", ticker).Str("source", source.name).Msg("Failed to persist assessment from source recommendation")
+		}
+	}
+
+	recommended, reason := recommendAssessmentSource(candidates, currentSource, tieBreak, minImprovement)
+	if recommended == "" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": reason, "candidates": candidates})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticker":             ticker,
+		"recommended_source": recommended,
+		"reason":             reason,
+		"tie_break":          tieBreak,
+		"min_ev_improvement": minImprovement,
+		"candidates":         candidates,
+	})
+}
+
+// recommendAssessmentSource picks the source to act on. A current source is kept unless the other
+// source's EV differs by at least minImprovement points; otherwise the tie-break rule decides.
+func recommendAssessmentSource(candidates []SourceCandidate, currentSource, tieBreak string, minImprovement float64) (string, string) {
+	usable := make([]SourceCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.ExpectedValue != nil {
+			usable = append(usable, candidate)
+		}
+	}
+	switch len(usable) {
+	case 0:
+		return "", "no source returned a parseable EV"
+	case 1:
+		return usable[0].Source, fmt.Sprintf("only %s returned a parseable EV", usable[0].Source)
+	}
+
+	a, b := usable[0], usable[1]
+	if b.Source == currentSource {
+		a, b = b, a
+	}
+	if a.Source == currentSource {
+		if diff := math.Abs(*b.ExpectedValue - *a.ExpectedValue); diff < minImprovement {
+			return a.Source, fmt.Sprintf("EV difference %.2f points is below the %.2f minimum to switch from %s", diff, minImprovement, a.Source)
+		}
+	}
+
+	if tieBreak == TieBreakFairValueDispersion && a.FairValueDispersion != nil && b.FairValueDispersion != nil &&
+		*a.FairValueDispersion != *b.FairValueDispersion {
+		if *b.FairValueDispersion < *a.FairValueDispersion {
+			a, b = b, a
+		}
+		return a.Source, fmt.Sprintf("%s has tighter fair value dispersion (%.3f vs %.3f)", a.Source, *a.FairValueDispersion, *b.FairValueDispersion)
+	}
+
+	if *b.ExpectedValue < *a.ExpectedValue {
+		a, b = b, a
+	}
+	return a.Source, fmt.Sprintf("%s has the more conservative EV (%.2f%% vs %.2f%%)", a.Source, *a.ExpectedValue, *b.ExpectedValue)
+}
+
+// providerFairValueDispersion returns the coefficient of variation of a provider's recent fair values
+// for a stock, or nil when fewer than two observations exist.
+func (h *AssessmentHandler) providerFairValueDispersion(stockID uint, provider string) *float64 {
+	var values []float64
+	if err := h.db.Model(&models.FairValueHistory{}).
+		Where("stock_id = ? AND source LIKE ? AND recorded_at >= ?", stockID, provider+" |%", time.Now().AddDate(0, 0, -sourceDispersionWindowDays)).
+		Pluck("fair_value", &values).Error; err != nil || len(values) < 2 {
+		return nil
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean <= 0 {
+		return nil
+	}
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	cv := math.Sqrt(variance/float64(len(values))) / mean
+	return &cv
+}
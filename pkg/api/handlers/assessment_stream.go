@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Upstream chat completion endpoints that support "stream": true
+var streamingAssessmentURLs = map[string]string{
+	"grok":     "https://api.x.ai/v1/chat/completions",
+	"deepseek": "https://api.deepseek.com/v1/chat/completions",
+}
+
+// maxStreamLineBytes bounds one upstream "data:" line
+const maxStreamLineBytes = 1024 * 1024
+
+// StreamAssessment generates a Grok or Deepseek assessment like RequestAssessment but relays the
+// completion as Server-Sent Events while it is generated: one "delta" event ({"content": ...}) per
+// token delta, then "done" ({"assessment": ...}) once the assembled text is persisted, or "error".
+// A client disconnect cancels the upstream request and nothing is persisted.
+func (h *AssessmentHandler) StreamAssessment(c *gin.Context) {
+	var req AssessmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	url, ok := streamingAssessmentURLs[req.Source]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Streaming is supported for 'grok' and 'deepseek' only"})
+		return
+	}
+	apiKey := h.cfg.XAIAPIKey
+	if req.Source == "deepseek" {
+		apiKey = h.cfg.DeepseekAPIKey
+	}
+	if apiKey == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s API key not configured", req.Source)})
+		return
+	}
+
+	req.Ticker = strings.ToUpper(req.Ticker)
+	portfolioID, resolveErr := h.resolvePortfolioID(c)
+	if resolveErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+	if !h.ensureTickerResolvable(c, req.Ticker) {
+		return
+	}
+
+	h.logger.Info().
+		Str("ticker", req.Ticker).
+		Str("source", req.Source).
+		Msg("Streaming stock assessment")
+
+	stockData := h.anchorOnStoredStock(portfolioID, &req)
+	portfolioData, cashData, err := h.assessments.PortfolioContext()
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to fetch portfolio context, continuing without it")
+	}
+	prompt := h.assessments.BuildPrompt(portfolioID, req.Ticker, req.ISIN, req.CompanyName, req.CurrentPrice, req.Currency, portfolioData, cashData, req.RebalanceHint, req.ConcentrationHint, req.SuggestedActionsHint, stockData)
+
+	ctx := c.Request.Context()
+	resp, err := h.openAssessmentStream(ctx, url, apiKey, h.cfg.ModelFor(config.UseCaseAssessment, req.Source), prompt)
+	if err != nil {
+		h.logger.Error().Err(err).
+			Str("ticker", req.Ticker).
+			Str("source", req.Source).
+			Msg("Failed to start assessment stream")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate assessment: " + err.Error()})
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	assessment, err := readChatCompletionStream(resp.Body, func(delta string) {
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+	})
+	if ctx.Err() != nil {
+		h.logger.Info().Str("ticker", req.Ticker).Str("source", req.Source).Msg("Client disconnected, assessment stream cancelled")
+		return
+	}
+	if err == nil && strings.TrimSpace(assessment) == "" {
+		err = fmt.Errorf("empty assessment content")
+	}
+	if err == nil {
+		services.RecordProviderSuccess(resp)
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Str("ticker", req.Ticker).Str("source", req.Source).Msg("Assessment stream failed")
+		c.SSEvent("error", gin.H{"error": "Failed to generate assessment: " + err.Error()})
+		c.Writer.Flush()
+		return
+	}
+
+	if err := h.assessments.Upsert(portfolioID, req.Ticker, req.Source, assessment); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to persist assessment")
+		c.SSEvent("error", gin.H{"error": "Failed to persist assessment"})
+		c.Writer.Flush()
+		return
+	}
+	h.assessments.CleanupOld()
+	c.SSEvent("done", AssessmentResponse{Assessment: assessment})
+	c.Writer.Flush()
+
+	// The client already has the text; rebuild the cross-source diff before closing.
+	if err := h.assessments.RegenerateAssessmentDiff(portfolioID, req.Ticker); err != nil {
+		h.logger.Warn().Err(err).Str("ticker", req.Ticker).Msg("Failed to regenerate persisted assessment diff")
+	}
+}
+
+// openAssessmentStream starts a streaming chat completion bound to ctx. The handler's client timeout
+// is not applied because a long completion legitimately streams for longer; ctx ends the request.
+func (h *AssessmentHandler) openAssessmentStream(ctx context.Context, url, apiKey, model, prompt string) (*http.Response, error) {
+	reqBody := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": services.AssessmentSystemPrompt},
+			{"role": "user", "content": prompt},
+		},
+		"stream": true,
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	client := &http.Client{Transport: h.client.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+// readChatCompletionStream reads OpenAI-style "data:" lines until "data: [DONE]" or EOF, calls onDelta
+// with each non-empty content delta and returns the assembled text.
+func readChatCompletionStream(r io.Reader, onDelta func(delta string)) (string, error) {
+	var text strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue // Blank separators and ": keep-alive" comments
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "[DONE]" {
+			return text.String(), nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return text.String(), fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		text.WriteString(delta)
+		onDelta(delta)
+	}
+	if err := scanner.Err(); err != nil {
+		return text.String(), fmt.Errorf("failed to read stream: %w", err)
+	}
+	return text.String(), nil
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/art-pro/stock-backend/pkg/auth"
 	"github.com/art-pro/stock-backend/pkg/config"
@@ -206,3 +208,88 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 		"username": username,
 	})
 }
+
+// CreateAPIKeyRequest represents an API key creation request
+type CreateAPIKeyRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// CreateAPIKey issues a new API key for the current user. The key is only returned once.
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request, name is required"})
+		return
+	}
+
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate API key")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	record := models.APIKey{
+		UserID:   userID,
+		Name:     req.Name,
+		Prefix:   key[:12],
+		KeyHash:  hash,
+		ReadOnly: req.ReadOnly,
+	}
+	if err := h.db.Create(&record).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to save API key")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	h.logger.Info().Uint("user_id", userID).Uint("api_key_id", record.ID).Bool("read_only", record.ReadOnly).Msg("API key created")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": record,
+		"key":     key,
+		"message": "Store this key now; it will not be shown again",
+	})
+}
+
+// ListAPIKeys returns the current user's API keys (without secrets)
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	if err := h.db.Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC").Find(&keys).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch API keys")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var key models.APIKey
+	if err := h.db.Where("id = ? AND user_id = ?", id, c.GetUint("user_id")).First(&key).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := h.db.Model(&key).Update("revoked_at", &now).Error; err != nil {
+			h.logger.Error().Err(err).Msg("Failed to revoke API key")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+	}
+
+	h.logger.Info().Uint("api_key_id", key.ID).Msg("API key revoked")
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// BackupHandler exports and restores full user data backups for disaster recovery and migration.
+type BackupHandler struct {
+	db     *gorm.DB
+	logger zerolog.Logger
+}
+
+// NewBackupHandler creates a new backup handler
+func NewBackupHandler(db *gorm.DB, logger zerolog.Logger) *BackupHandler {
+	return &BackupHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ExportBackup streams the caller's data as an NDJSON backup (see database.ExportBackup).
+func (h *BackupHandler) ExportBackup(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	now := time.Now().UTC()
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=stock-backup-%s.ndjson", now.Format("20060102-150405")))
+	c.Status(http.StatusOK)
+
+	// Headers are sent with the first write, so a mid-stream failure can only be logged; the
+	// truncated stream then fails to decode on import.
+	if err := database.ExportBackup(h.db, userID.(uint), c.Writer, now); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to export backup")
+		return
+	}
+	h.logger.Info().Uint("user_id", userID.(uint)).Msg("Backup exported")
+}
+
+// ImportBackup restores an NDJSON backup from the request body for the caller in one transaction.
+func (h *BackupHandler) ImportBackup(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	result, err := database.ImportBackup(h.db, userID.(uint), c.Request.Body)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidBackup) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error().Err(err).Msg("Failed to import backup")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import backup"})
+		return
+	}
+
+	h.logger.Info().Uint("user_id", userID.(uint)).Interface("imported", result.Imported).Msg("Backup imported")
+	c.JSON(http.StatusOK, result)
+}
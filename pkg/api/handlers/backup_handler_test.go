@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openBackupTestDB(t *testing.T, name string) (*gorm.DB, models.User) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{}, &models.UserSettings{}, &models.Portfolio{}, &models.PortfolioSettings{},
+		&models.Stock{}, &models.StockHistory{}, &models.FairValueHistory{}, &models.DeletedStock{},
+		&models.CashHolding{}, &models.Operation{}, &models.Assessment{}, &models.PortfolioSnapshot{},
+		&models.Alert{}, &models.ExchangeRate{}, &models.ExchangeRateHistory{}, &models.Order{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := models.User{Username: "admin", Password: "hash"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return db, user
+}
+
+func TestBackupExportImportRoundTrip(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	source, sourceUser := openBackupTestDB(t, "backup-source.db")
+
+	recordedAt := time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true, UserID: sourceUser.ID}
+	mustCreate(t, source, &portfolio)
+	// A disabled default-true flag must survive the round trip.
+	mustCreate(t, source, &models.PortfolioSettings{PortfolioID: portfolio.ID, AutoRecompute: true, MaxPositions: 12})
+	if err := source.Model(&models.PortfolioSettings{}).Where("portfolio_id = ?", portfolio.ID).Update("auto_recompute", false).Error; err != nil {
+		t.Fatalf("disable auto_recompute: %v", err)
+	}
+	// Offset IDs so remapping is observable in the target.
+	mustCreate(t, source, &models.Stock{PortfolioID: portfolio.ID, Ticker: "TMP", CompanyName: "Temp"})
+	stock := models.Stock{PortfolioID: portfolio.ID, Ticker: "AAPL", CompanyName: "Apple", Currency: "USD", CurrentPrice: 200, FairValue: 240, SharesOwned: 5}
+	mustCreate(t, source, &stock)
+	mustCreate(t, source, &models.StockHistory{StockID: stock.ID, PortfolioID: portfolio.ID, Ticker: "AAPL", CurrentPrice: 190, RecordedAt: recordedAt})
+	mustCreate(t, source, &models.FairValueHistory{StockID: stock.ID, PortfolioID: portfolio.ID, Ticker: "AAPL", FairValue: 240, Source: "Grok | TipRanks", RecordedAt: recordedAt})
+	mustCreate(t, source, &models.CashHolding{PortfolioID: portfolio.ID, CurrencyCode: "EUR", Amount: 1500})
+	mustCreate(t, source, &models.Order{PortfolioID: portfolio.ID, Ticker: "TMP", Side: "Buy", Currency: "EUR", LimitPrice: 1, Quantity: 1, Status: "cancelled"})
+	order := models.Order{PortfolioID: portfolio.ID, StockID: &stock.ID, Ticker: "AAPL", Side: "Buy", Currency: "USD", LimitPrice: 180, Quantity: 5, FilledQuantity: 5, Status: "filled"}
+	mustCreate(t, source, &order)
+	mustCreate(t, source, &models.Operation{PortfolioID: portfolio.ID, StockID: &stock.ID, OrderID: &order.ID, OperationType: "Buy", Ticker: "AAPL", Currency: "USD", Quantity: 5, Price: 180, Amount: 900, TradeDate: "02.01.2026"})
+	mustCreate(t, source, &models.Assessment{PortfolioID: portfolio.ID, StockID: &stock.ID, Ticker: "AAPL", Source: "grok", Assessment: "Hold", Status: "completed"})
+	mustCreate(t, source, &models.UserSettings{UserID: sourceUser.ID, Key: "stock_table_columns", Value: `{"ticker":true}`})
+	mustCreate(t, source, &models.ExchangeRate{CurrencyCode: "USD", Rate: 1.1, IsActive: true, IsManual: true, LastUpdated: recordedAt})
+	mustCreate(t, source, &models.ExchangeRateHistory{CurrencyCode: "USD", Rate: 1.1, Provider: "manual", RecordedAt: recordedAt})
+	mustCreate(t, source, &models.ExchangeRateHistory{CurrencyCode: "USD", Rate: 1.05, Provider: "frankfurter", RecordedAt: recordedAt.AddDate(0, 0, -1)})
+	if err := source.Delete(&models.Stock{}, "ticker = ?", "TMP").Error; err != nil {
+		t.Fatalf("delete temp stock: %v", err)
+	}
+
+	exportRecorder := httptest.NewRecorder()
+	exportCtx, _ := gin.CreateTestContext(exportRecorder)
+	exportCtx.Request = httptest.NewRequest(http.MethodGet, "/admin/export", nil)
+	exportCtx.Set("user_id", sourceUser.ID)
+	NewBackupHandler(source, zerolog.Nop()).ExportBackup(exportCtx)
+	if exportRecorder.Code != http.StatusOK {
+		t.Fatalf("export status: got %d, body %s", exportRecorder.Code, exportRecorder.Body.String())
+	}
+
+	target, targetUser := openBackupTestDB(t, "backup-target.db")
+	// The target already has a rate for USD and an unrelated portfolio, so IDs cannot line up.
+	mustCreate(t, target, &models.ExchangeRate{CurrencyCode: "USD", Rate: 1.3, IsActive: true})
+	mustCreate(t, target, &models.ExchangeRateHistory{CurrencyCode: "USD", Rate: 1.3, Provider: "exchangerate-api", RecordedAt: recordedAt})
+	mustCreate(t, target, &models.Portfolio{Name: "Scratch", UserID: targetUser.ID + 100})
+
+	importRecorder := httptest.NewRecorder()
+	importCtx, _ := gin.CreateTestContext(importRecorder)
+	importCtx.Request = httptest.NewRequest(http.MethodPost, "/admin/import", bytes.NewReader(exportRecorder.Body.Bytes()))
+	importCtx.Set("user_id", targetUser.ID)
+	NewBackupHandler(target, zerolog.Nop()).ImportBackup(importCtx)
+	if importRecorder.Code != http.StatusOK {
+		t.Fatalf("import status: got %d, body %s", importRecorder.Code, importRecorder.Body.String())
+	}
+	var result struct {
+		Imported map[string]int `json:"imported"`
+		Skipped  map[string]int `json:"skipped"`
+	}
+	if err := json.Unmarshal(importRecorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode import result: %v", err)
+	}
+	for recordType, want := range map[string]int{"portfolio": 1, "portfolio_settings": 1, "stock": 1, "stock_history": 1, "fair_value_history": 1, "cash_holding": 1, "operation": 1, "assessment": 1, "user_setting": 1, "order": 2, "exchange_rate_history": 1} {
+		if got := result.Imported[recordType]; got != want {
+			t.Errorf("imported %s: got %d want %d", recordType, got, want)
+		}
+	}
+	for recordType, want := range map[string]int{"exchange_rate": 1, "exchange_rate_history": 1} {
+		if got := result.Skipped[recordType]; got != want {
+			t.Errorf("skipped %s: got %d want %d", recordType, got, want)
+		}
+	}
+
+	var restored models.Portfolio
+	if err := target.Where("user_id = ? AND name = ?", targetUser.ID, "Main").First(&restored).Error; err != nil {
+		t.Fatalf("load restored portfolio: %v", err)
+	}
+	if !restored.IsDefault {
+		t.Error("expected restored portfolio to be the default")
+	}
+	var settings models.PortfolioSettings
+	if err := target.Where("portfolio_id = ?", restored.ID).First(&settings).Error; err != nil {
+		t.Fatalf("load restored settings: %v", err)
+	}
+	if settings.AutoRecompute || settings.MaxPositions != 12 {
+		t.Errorf("settings: auto_recompute=%v max_positions=%d, want false/12", settings.AutoRecompute, settings.MaxPositions)
+	}
+	var restoredStock models.Stock
+	if err := target.Where("portfolio_id = ? AND ticker = ?", restored.ID, "AAPL").First(&restoredStock).Error; err != nil {
+		t.Fatalf("load restored stock: %v", err)
+	}
+	if restoredStock.FairValue != 240 || restoredStock.SharesOwned != 5 {
+		t.Errorf("stock: fair_value=%.2f shares=%d", restoredStock.FairValue, restoredStock.SharesOwned)
+	}
+	var history models.StockHistory
+	if err := target.First(&history).Error; err != nil {
+		t.Fatalf("load restored history: %v", err)
+	}
+	if history.StockID != restoredStock.ID || history.PortfolioID != restored.ID || !history.RecordedAt.Equal(recordedAt) {
+		t.Errorf("history: stock_id=%d portfolio_id=%d recorded_at=%v, want %d/%d/%v", history.StockID, history.PortfolioID, history.RecordedAt, restoredStock.ID, restored.ID, recordedAt)
+	}
+	var operation models.Operation
+	if err := target.First(&operation).Error; err != nil {
+		t.Fatalf("load restored operation: %v", err)
+	}
+	if operation.StockID == nil || *operation.StockID != restoredStock.ID {
+		t.Errorf("operation stock_id: got %v want %d", operation.StockID, restoredStock.ID)
+	}
+	var assessment models.Assessment
+	if err := target.First(&assessment).Error; err != nil {
+		t.Fatalf("load restored assessment: %v", err)
+	}
+	if assessment.StockID == nil || *assessment.StockID != restoredStock.ID {
+		t.Errorf("assessment stock_id: got %v want %d", assessment.StockID, restoredStock.ID)
+	}
+	var restoredOrder models.Order
+	if err := target.Where("portfolio_id = ? AND ticker = ?", restored.ID, "AAPL").First(&restoredOrder).Error; err != nil {
+		t.Fatalf("load restored order: %v", err)
+	}
+	if restoredOrder.StockID == nil || *restoredOrder.StockID != restoredStock.ID || restoredOrder.Status != "filled" {
+		t.Errorf("order: stock_id=%v status=%s, want %d/filled", restoredOrder.StockID, restoredOrder.Status, restoredStock.ID)
+	}
+	if operation.OrderID == nil || *operation.OrderID != restoredOrder.ID {
+		t.Errorf("operation order_id: got %v want %d", operation.OrderID, restoredOrder.ID)
+	}
+	var historyRates []models.ExchangeRateHistory
+	if err := target.Where("currency_code = ?", "USD").Order("recorded_at").Find(&historyRates).Error; err != nil {
+		t.Fatalf("load rate history: %v", err)
+	}
+	if len(historyRates) != 2 || historyRates[0].Rate != 1.05 || historyRates[1].Rate != 1.3 {
+		t.Errorf("rate history: got %+v, want the imported 1.05 and the target's own 1.30", historyRates)
+	}
+	var rate models.ExchangeRate
+	if err := target.Where("currency_code = ?", "USD").First(&rate).Error; err != nil {
+		t.Fatalf("load restored rate: %v", err)
+	}
+	// The shared rates table is never overwritten by a user's backup.
+	if rate.Rate != 1.3 || rate.IsManual {
+		t.Errorf("rate: got %.2f manual=%v, want the target's 1.30 auto rate", rate.Rate, rate.IsManual)
+	}
+	var setting models.UserSettings
+	if err := target.Where("user_id = ? AND key = ?", targetUser.ID, "stock_table_columns").First(&setting).Error; err != nil {
+		t.Fatalf("load restored user setting: %v", err)
+	}
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// CalculationsHandler serves stateless calculators that work on request inputs only
+type CalculationsHandler struct {
+	logger zerolog.Logger
+}
+
+// NewCalculationsHandler creates a new calculations handler
+func NewCalculationsHandler(logger zerolog.Logger) *CalculationsHandler {
+	return &CalculationsHandler{logger: logger}
+}
+
+// MonteCarlo simulates the return distribution behind a stock's EV and returns its percentiles
+// and probability of loss.
+func (h *CalculationsHandler) MonteCarlo(c *gin.Context) {
+	var input services.MonteCarloInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	result, err := services.SimulateEV(input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !result.MeanConsistent {
+		h.logger.Warn().Float64("mean_return", result.MeanReturn).Float64("expected_value", result.ExpectedValue).Msg("Monte Carlo mean diverges from closed-form EV")
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// BuyZoneRequest represents the inputs of the buy-zone calculator
+type BuyZoneRequest struct {
+	Ticker              string  `json:"ticker"`
+	FairValue           float64 `json:"fair_value" binding:"required"`
+	ProbabilityPositive float64 `json:"probability_positive"`
+	DownsideRisk        float64 `json:"downside_risk" binding:"required"`
+	CurrentPrice        float64 `json:"current_price"` // Optional; classifies the price against the zone
+	Tranches            int     `json:"tranches"`      // Optional; splits the zone into 1–5 laddered limit prices
+}
+
+// BuyZone returns the buy-zone bounds for the given inputs and, when tranches is set, laddered
+// entry prices across the zone. The calculator is not tied to a portfolio, so it uses the default
+// EV thresholds.
+func (h *CalculationsHandler) BuyZone(c *gin.Context) {
+	var req BuyZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	result, err := services.CalculateBuyZoneResult(req.Ticker, req.FairValue, req.ProbabilityPositive, req.DownsideRisk, req.CurrentPrice, services.DefaultMetricsConfig())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Tranches != 0 {
+		result.Ladder = services.CalculateLadderedEntries(result.BuyZone, req.Tranches)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/art-pro/stock-backend/pkg/config"
 	"github.com/art-pro/stock-backend/pkg/database"
 	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
@@ -15,17 +17,19 @@ import (
 
 // CashHandler handles cash management requests
 type CashHandler struct {
-	db     *gorm.DB
-	cfg    *config.Config
-	logger zerolog.Logger
+	db                  *gorm.DB
+	cfg                 *config.Config
+	logger              zerolog.Logger
+	exchangeRateService *services.ExchangeRateService
 }
 
 // NewCashHandler creates a new cash handler
 func NewCashHandler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *CashHandler {
 	return &CashHandler{
-		db:     db,
-		cfg:    cfg,
-		logger: logger,
+		db:                  db,
+		cfg:                 cfg,
+		logger:              logger,
+		exchangeRateService: services.NewExchangeRateService(db, logger),
 	}
 }
 
@@ -43,17 +47,17 @@ func (h *CashHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
 // CreateCashHoldingRequest represents the request to create a cash holding
 type CreateCashHoldingRequest struct {
 	CurrencyCode string  `json:"currency_code" binding:"required"`
-	Amount       float64 `json:"amount" binding:"required,gte=0"`
+	Amount       float64 `json:"amount" binding:"required"` // Negative only when the portfolio allows negative cash
 	Description  string  `json:"description"`
 }
 
 // UpdateCashHoldingRequest represents the request to update a cash holding
 type UpdateCashHoldingRequest struct {
-	Amount      float64 `json:"amount" binding:"required,gte=0"`
+	Amount      float64 `json:"amount" binding:"required"` // Negative only when the portfolio allows negative cash
 	Description string  `json:"description"`
 }
 
-// GetAllCashHoldings returns all cash holdings with USD values calculated
+// GetAllCashHoldings returns all cash holdings with USD and base-currency values calculated
 func (h *CashHandler) GetAllCashHoldings(c *gin.Context) {
 	portfolioID, err := h.resolvePortfolioID(c)
 	if err != nil {
@@ -68,18 +72,28 @@ func (h *CashHandler) GetAllCashHoldings(c *gin.Context) {
 		return
 	}
 
-	// Update USD values using current exchange rates
+	// Update values using current exchange rates
+	fxRates, err := database.ExchangeRatesMap(h.db)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+	base := database.PortfolioBaseCurrency(h.db, portfolioID)
 	for i := range cashHoldings {
-		usdValue, err := h.calculateUSDValue(cashHoldings[i].CurrencyCode, cashHoldings[i].Amount)
-		if err != nil {
-			h.logger.Warn().Err(err).Str("currency", cashHoldings[i].CurrencyCode).Msg("Failed to calculate USD value")
-			// Keep existing USD value if calculation fails
+		cash := cashHoldings[i]
+		if err := calculateCashValues(&cash, base, fxRates); err != nil {
+			h.logger.Warn().Err(err).Str("currency", cashHoldings[i].CurrencyCode).Msg("Failed to calculate cash values")
+			// Keep existing values if calculation fails, flagged as stale
+			cashHoldings[i].RateStale = true
+			h.db.Model(&cashHoldings[i]).Update("rate_stale", true)
 		} else {
-			cashHoldings[i].USDValue = usdValue
+			cashHoldings[i] = cash
 			cashHoldings[i].LastUpdated = time.Now()
 			h.db.Save(&cashHoldings[i])
 		}
 	}
+	h.warnStaleCashRates(cashHoldings)
 
 	// Cash holdings change infrequently - cache for 2 minutes
 	c.Header("Cache-Control", "private, max-age=120, stale-while-revalidate=240")
@@ -101,6 +115,25 @@ func (h *CashHandler) CreateCashHolding(c *gin.Context) {
 		return
 	}
 
+	var portfolio models.Portfolio
+	if err := h.db.Select("id").First(&portfolio, portfolioID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Portfolio not found"})
+			return
+		}
+		h.logger.Error().Err(err).Uint("portfolio_id", portfolioID).Msg("Failed to load portfolio")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load portfolio"})
+		return
+	}
+
+	if !h.checkCashAmount(c, portfolioID, req.Amount) {
+		return
+	}
+
+	if !ensureCurrencyTracked(c, h.cfg, h.exchangeRateService, h.logger, req.CurrencyCode) {
+		return
+	}
+
 	// Check if currency exists in exchange rates
 	var exchangeRate models.ExchangeRate
 	if err := h.db.Where("currency_code = ?", req.CurrencyCode).First(&exchangeRate).Error; err != nil {
@@ -115,22 +148,18 @@ func (h *CashHandler) CreateCashHolding(c *gin.Context) {
 		return
 	}
 
-	// Calculate USD value
-	usdValue, err := h.calculateUSDValue(req.CurrencyCode, req.Amount)
-	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to calculate USD value")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate USD value"})
-		return
-	}
-
 	cashHolding := models.CashHolding{
 		PortfolioID:  portfolioID,
 		CurrencyCode: req.CurrencyCode,
 		Amount:       req.Amount,
-		USDValue:     usdValue,
 		Description:  req.Description,
 		LastUpdated:  time.Now(),
 	}
+	if err := h.calculateValuesWithDB(h.db, &cashHolding); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to calculate cash values")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate cash values"})
+		return
+	}
 
 	if err := h.db.Create(&cashHolding).Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to create cash holding")
@@ -162,6 +191,10 @@ func (h *CashHandler) UpdateCashHolding(c *gin.Context) {
 		return
 	}
 
+	if !h.checkCashAmount(c, portfolioID, req.Amount) {
+		return
+	}
+
 	var cashHolding models.CashHolding
 	if err := h.db.Where("id = ? AND portfolio_id = ?", id, portfolioID).First(&cashHolding).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -173,16 +206,12 @@ func (h *CashHandler) UpdateCashHolding(c *gin.Context) {
 		return
 	}
 
-	// Calculate new USD value
-	usdValue, err := h.calculateUSDValue(cashHolding.CurrencyCode, req.Amount)
-	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to calculate USD value")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate USD value"})
+	cashHolding.Amount = req.Amount
+	if err := h.calculateValuesWithDB(h.db, &cashHolding); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to calculate cash values")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate cash values"})
 		return
 	}
-
-	cashHolding.Amount = req.Amount
-	cashHolding.USDValue = usdValue
 	cashHolding.Description = req.Description
 	cashHolding.LastUpdated = time.Now()
 
@@ -231,7 +260,26 @@ func (h *CashHandler) DeleteCashHolding(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Cash holding deleted successfully"})
 }
 
-// RefreshUSDValues recalculates USD values for all cash holdings
+// checkCashAmount rejects negative amounts unless the portfolio allows negative cash (margin/overdraft).
+// On rejection it writes the error response and returns false.
+func (h *CashHandler) checkCashAmount(c *gin.Context, portfolioID uint, amount float64) bool {
+	if amount >= 0 {
+		return true
+	}
+	var settings models.PortfolioSettings
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return false
+	}
+	if !settings.AllowNegativeCash {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Negative cash is not allowed for this portfolio (enable allow_negative_cash)"})
+		return false
+	}
+	return true
+}
+
+// RefreshUSDValues recalculates USD and base-currency values for all cash holdings
 func (h *CashHandler) RefreshUSDValues(c *gin.Context) {
 	portfolioID, err := h.resolvePortfolioID(c)
 	if err != nil {
@@ -246,34 +294,47 @@ func (h *CashHandler) RefreshUSDValues(c *gin.Context) {
 		return
 	}
 
+	fxRates, err := database.ExchangeRatesMap(h.db)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+
+	base := database.PortfolioBaseCurrency(h.db, portfolioID)
 	updatedCount := 0
+	failed := []gin.H{}
 	for i := range cashHoldings {
-		usdValue, err := h.calculateUSDValue(cashHoldings[i].CurrencyCode, cashHoldings[i].Amount)
-		if err != nil {
-			h.logger.Warn().Err(err).Str("currency", cashHoldings[i].CurrencyCode).Msg("Failed to calculate USD value")
+		if err := calculateCashValues(&cashHoldings[i], base, fxRates); err != nil {
+			h.logger.Warn().Err(err).Str("currency", cashHoldings[i].CurrencyCode).Msg("Failed to calculate cash values")
+			if err := h.db.Model(&cashHoldings[i]).Update("rate_stale", true).Error; err != nil {
+				h.logger.Warn().Err(err).Uint("id", cashHoldings[i].ID).Msg("Failed to flag cash holding as stale")
+			}
+			failed = append(failed, gin.H{"id": cashHoldings[i].ID, "currency_code": cashHoldings[i].CurrencyCode, "error": err.Error()})
 			continue
 		}
 
-		cashHoldings[i].USDValue = usdValue
 		cashHoldings[i].LastUpdated = time.Now()
 
 		if err := h.db.Save(&cashHoldings[i]).Error; err != nil {
-			h.logger.Warn().Err(err).Uint("id", cashHoldings[i].ID).Msg("Failed to update cash holding USD value")
+			h.logger.Warn().Err(err).Uint("id", cashHoldings[i].ID).Msg("Failed to update cash holding values")
 			continue
 		}
 		updatedCount++
 	}
 
-	h.logger.Info().Int("updated_count", updatedCount).Msg("Cash holdings USD values refreshed")
+	h.warnStaleCashRates(cashHoldings)
+	h.logger.Info().Int("updated_count", updatedCount).Msg("Cash holding values refreshed")
 	c.JSON(http.StatusOK, gin.H{
-		"message": "USD values refreshed successfully",
+		"message": "Cash values refreshed successfully",
 		"updated": updatedCount,
 		"total":   len(cashHoldings),
+		"failed":  failed,
 	})
 }
 
 // AdjustCash adds delta to the cash holding for the given portfolio and currency.
-// If no holding exists, one is created with amount = max(0, delta) then delta is applied (so initial amount may be 0+delta).
+// If no holding exists, one is created with amount = delta (which may be negative).
 // Used by operations (Buy/Sell/Deposit/Withdraw/Dividend) to update cash.
 // If tx is non-nil it is used for all DB operations (e.g. when called inside operation_handler's transaction).
 func (h *CashHandler) AdjustCash(tx *gorm.DB, portfolioID uint, currencyCode string, delta float64) error {
@@ -290,70 +351,81 @@ func (h *CashHandler) AdjustCash(tx *gorm.DB, portfolioID uint, currencyCode str
 			if errEx := run.Where("currency_code = ?", currencyCode).First(&ex).Error; errEx != nil {
 				return errEx
 			}
-			amount := delta
-			if amount < 0 {
-				amount = 0
-			}
-			usdValue, _ := h.calculateUSDValueWithDB(run, currencyCode, amount)
 			cash = models.CashHolding{
 				PortfolioID:  portfolioID,
 				CurrencyCode: currencyCode,
-				Amount:       amount,
-				USDValue:     usdValue,
+				Amount:       delta, // may go negative
 				LastUpdated:  time.Now(),
 			}
-			if err := run.Create(&cash).Error; err != nil {
-				return err
-			}
-			if delta < 0 {
-				cash.Amount += delta // may go negative
-				cash.USDValue, _ = h.calculateUSDValueWithDB(run, currencyCode, cash.Amount)
-				cash.LastUpdated = time.Now()
-				return run.Save(&cash).Error
-			}
-			return nil
+			_ = h.calculateValuesWithDB(run, &cash)
+			return run.Create(&cash).Error
 		}
 		return err
 	}
 	cash.Amount += delta
-	usdValue, errUV := h.calculateUSDValueWithDB(run, currencyCode, cash.Amount)
-	if errUV != nil {
-		return errUV
+	if err := h.calculateValuesWithDB(run, &cash); err != nil {
+		return err
 	}
-	cash.USDValue = usdValue
 	cash.LastUpdated = time.Now()
 	return run.Save(&cash).Error
 }
 
-// calculateUSDValue converts amount from given currency to USD (uses handler's db).
-func (h *CashHandler) calculateUSDValue(currencyCode string, amount float64) (float64, error) {
-	return h.calculateUSDValueWithDB(h.db, currencyCode, amount)
+// calculateValuesWithDB sets cash's USD value and its value in the portfolio's base currency using
+// the given db (or tx), loading the rates and the base currency once.
+func (h *CashHandler) calculateValuesWithDB(db *gorm.DB, cash *models.CashHolding) error {
+	fxRates, err := database.ExchangeRatesMap(db)
+	if err != nil {
+		return err
+	}
+	if err := calculateCashValues(cash, database.PortfolioBaseCurrency(db, cash.PortfolioID), fxRates); err != nil {
+		return err
+	}
+	if cash.RateStale {
+		h.logger.Warn().Str("currency", cash.CurrencyCode).Msg("USD exchange rate not found, cash USD value is the EUR equivalent")
+	}
+	return nil
 }
 
-// calculateUSDValueWithDB converts amount from given currency to USD using the given db (or tx).
-func (h *CashHandler) calculateUSDValueWithDB(db *gorm.DB, currencyCode string, amount float64) (float64, error) {
-	// If EUR (base currency), convert to USD using USD rate
-	if currencyCode == "EUR" {
-		var usdRate models.ExchangeRate
-		if err := db.Where("currency_code = ?", "USD").First(&usdRate).Error; err != nil {
-			h.logger.Warn().Msg("USD exchange rate not found, using 1:1")
-			return amount, nil
+// warnStaleCashRates logs one warning for all holdings whose USD value fell back to EUR.
+func (h *CashHandler) warnStaleCashRates(holdings []models.CashHolding) {
+	stale := 0
+	for _, holding := range holdings {
+		if holding.RateStale {
+			stale++
 		}
-		return amount * usdRate.Rate, nil
 	}
+	if stale > 0 {
+		h.logger.Warn().Int("holdings", stale).Msg("USD exchange rate not found, cash USD values are EUR equivalents")
+	}
+}
+
+// calculateCashValues is calculateValuesWithDB with the rates and base currency already loaded, so a
+// refresh of several holdings reads them once. It sets cash.RateStale instead of logging a missing USD rate. When
+// the holding's own currency has no rate it keeps the previous values, sets RateStale and errors.
+func calculateCashValues(cash *models.CashHolding, base string, fxRates map[string]float64) error {
+	usdValue, stale, ok := cashUSDValue(cash.Amount, cash.CurrencyCode, fxRates)
+	if !ok {
+		cash.RateStale = true
+		return fmt.Errorf("exchange rate not found for %s", cash.CurrencyCode)
+	}
+	cash.USDValue, cash.RateStale = usdValue, stale
+	return database.SetCashBaseValueWithRates(cash, base, fxRates)
+}
+
+// cashUSDValue converts amount of currencyCode to USD via EUR. Without a USD rate it returns the EUR
+// equivalent with stale set; it reports false when currencyCode itself has no rate.
+func cashUSDValue(amount float64, currencyCode string, fxRates map[string]float64) (value float64, stale bool, ok bool) {
 	if currencyCode == "USD" {
-		return amount, nil
+		return amount, false, true
 	}
-	var exchangeRate models.ExchangeRate
-	if err := db.Where("currency_code = ?", currencyCode).First(&exchangeRate).Error; err != nil {
-		h.logger.Warn().Str("currency", currencyCode).Msg("Exchange rate not found")
-		return amount, nil
+	rate := fxRates[currencyCode]
+	if rate <= 0 {
+		return 0, false, false
 	}
-	var usdRate models.ExchangeRate
-	if err := db.Where("currency_code = ?", "USD").First(&usdRate).Error; err != nil {
-		h.logger.Warn().Msg("USD exchange rate not found, returning EUR equivalent")
-		return amount / exchangeRate.Rate, nil
+	amountEUR := amount / rate
+	usdRate := fxRates["USD"]
+	if usdRate <= 0 {
+		return amountEUR, true, true
 	}
-	amountInEUR := amount / exchangeRate.Rate
-	return amountInEUR * usdRate.Rate, nil
+	return amountEUR * usdRate, false, true
 }
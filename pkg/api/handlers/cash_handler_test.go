@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCreateCashHoldingNegativeAmountRequiresAllowNegativeCash(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cash-handler-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.PortfolioSettings{}, &models.CashHolding{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	settings := models.PortfolioSettings{PortfolioID: portfolio.ID}
+	if err := db.Create(&settings).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	h := NewCashHandler(db, &config.Config{}, zerolog.Nop())
+
+	create := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/cash", strings.NewReader(`{"currency_code":"EUR","amount":-1000}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.CreateCashHolding(c)
+		return w
+	}
+
+	if w := create(); w.Code != http.StatusBadRequest {
+		t.Fatalf("status without allow_negative_cash: got %d want 400, body %s", w.Code, w.Body.String())
+	}
+
+	if err := db.Model(&settings).Update("allow_negative_cash", true).Error; err != nil {
+		t.Fatalf("enable negative cash: %v", err)
+	}
+	if w := create(); w.Code != http.StatusCreated {
+		t.Fatalf("status with allow_negative_cash: got %d want 201, body %s", w.Code, w.Body.String())
+	}
+
+	var holding models.CashHolding
+	if err := db.Where("portfolio_id = ? AND currency_code = ?", portfolio.ID, "EUR").First(&holding).Error; err != nil {
+		t.Fatalf("load holding: %v", err)
+	}
+	if holding.Amount != -1000 || holding.USDValue != -1250 {
+		t.Errorf("amount/usd_value: got %.2f/%.2f want -1000/-1250", holding.Amount, holding.USDValue)
+	}
+}
+
+func TestGetAllCashHoldingsReportsValuesInPortfolioBaseCurrency(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cash-base-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.PortfolioSettings{}, &models.CashHolding{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true, BaseCurrency: "EUR"}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true},
+		{CurrencyCode: "DKK", Rate: 7.5, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	for _, holding := range []models.CashHolding{
+		{PortfolioID: portfolio.ID, CurrencyCode: "USD", Amount: 500},
+		{PortfolioID: portfolio.ID, CurrencyCode: "DKK", Amount: 1500},
+	} {
+		if err := db.Create(&holding).Error; err != nil {
+			t.Fatalf("create holding: %v", err)
+		}
+	}
+	h := NewCashHandler(db, &config.Config{}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/cash", nil)
+	h.GetAllCashHoldings(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+
+	var holdings []models.CashHolding
+	if err := json.Unmarshal(w.Body.Bytes(), &holdings); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]float64{"USD": 400, "DKK": 200}
+	if len(holdings) != len(want) {
+		t.Fatalf("holdings: got %d want %d", len(holdings), len(want))
+	}
+	for _, holding := range holdings {
+		if holding.BaseCurrency != "EUR" || math.Abs(holding.BaseValue-want[holding.CurrencyCode]) > 1e-9 {
+			t.Errorf("%s base value: got %s %.2f want EUR %.2f", holding.CurrencyCode, holding.BaseCurrency, holding.BaseValue, want[holding.CurrencyCode])
+		}
+	}
+}
+
+func TestRefreshCashValuesFallsBackToEURWithoutUSDRate(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cash-no-usd-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.PortfolioSettings{}, &models.CashHolding{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true, BaseCurrency: "EUR"}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "DKK", Rate: 7.5, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	for _, holding := range []models.CashHolding{
+		{PortfolioID: portfolio.ID, CurrencyCode: "EUR", Amount: 300},
+		{PortfolioID: portfolio.ID, CurrencyCode: "DKK", Amount: 1500},
+	} {
+		if err := db.Create(&holding).Error; err != nil {
+			t.Fatalf("create holding: %v", err)
+		}
+	}
+	h := NewCashHandler(db, &config.Config{}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/cash/refresh", nil)
+	h.RefreshUSDValues(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Updated int `json:"updated"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Updated != 2 {
+		t.Errorf("updated: got %d want 2", resp.Updated)
+	}
+
+	var holdings []models.CashHolding
+	if err := db.Find(&holdings).Error; err != nil {
+		t.Fatalf("load holdings: %v", err)
+	}
+	want := map[string]float64{"EUR": 300, "DKK": 200}
+	for _, holding := range holdings {
+		if !holding.RateStale || math.Abs(holding.USDValue-want[holding.CurrencyCode]) > 1e-9 {
+			t.Errorf("%s: got usd_value %.2f rate_stale=%v, want EUR equivalent %.2f with rate_stale", holding.CurrencyCode, holding.USDValue, holding.RateStale, want[holding.CurrencyCode])
+		}
+		if math.Abs(holding.BaseValue-want[holding.CurrencyCode]) > 1e-9 {
+			t.Errorf("%s base value: got %.2f want %.2f", holding.CurrencyCode, holding.BaseValue, want[holding.CurrencyCode])
+		}
+	}
+}
+
+func TestRefreshCashValuesFlagsHoldingWithoutRate(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cash-no-rate-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.PortfolioSettings{}, &models.CashHolding{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true, BaseCurrency: "EUR"}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.1, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	holding := models.CashHolding{PortfolioID: portfolio.ID, CurrencyCode: "SEK", Amount: 1000, USDValue: 95, BaseCurrency: "EUR", BaseValue: 86}
+	if err := db.Create(&holding).Error; err != nil {
+		t.Fatalf("create holding: %v", err)
+	}
+	h := NewCashHandler(db, &config.Config{}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/cash/refresh", nil)
+	h.RefreshUSDValues(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Updated int `json:"updated"`
+		Failed  []struct {
+			CurrencyCode string `json:"currency_code"`
+		} `json:"failed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Updated != 0 || len(resp.Failed) != 1 || resp.Failed[0].CurrencyCode != "SEK" {
+		t.Fatalf("unexpected refresh response: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/cash", nil)
+	h.GetAllCashHoldings(c)
+	var holdings []models.CashHolding
+	if err := json.Unmarshal(w.Body.Bytes(), &holdings); err != nil {
+		t.Fatalf("decode holdings: %v", err)
+	}
+	if len(holdings) != 1 || !holdings[0].RateStale || holdings[0].USDValue != 95 || holdings[0].BaseValue != 86 {
+		t.Fatalf("expected the SEK holding flagged rate_stale with its last values, got %+v", holdings)
+	}
+}
+
+func TestCreateCashHoldingRejectsUnknownPortfolio(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cash-portfolio-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.PortfolioSettings{}, &models.CashHolding{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.ExchangeRate{CurrencyCode: "EUR", Rate: 1, IsActive: true}).Error; err != nil {
+		t.Fatalf("create rate: %v", err)
+	}
+	h := NewCashHandler(db, &config.Config{}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/cash?portfolio_id=42", strings.NewReader(`{"currency_code":"EUR","amount":100}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.CreateCashHolding(c)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status: got %d want 404, body %s", w.Code, w.Body.String())
+	}
+	var count int64
+	db.Model(&models.CashHolding{}).Count(&count)
+	if count != 0 {
+		t.Errorf("cash holdings: got %d want 0", count)
+	}
+}
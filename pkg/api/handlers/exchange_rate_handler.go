@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/art-pro/stock-backend/pkg/config"
@@ -43,9 +45,12 @@ func (h *ExchangeRateHandler) GetAllRates(c *gin.Context) {
 	c.JSON(http.StatusOK, rates)
 }
 
-// RefreshRates fetches latest rates from the API
+// RefreshRates fetches latest rates from the first provider that returns them and reports it in
+// provider. Within the minimum refresh interval the stored rates are returned with
+// recently_refreshed set instead of calling the providers again.
 func (h *ExchangeRateHandler) RefreshRates(c *gin.Context) {
-	if err := h.service.FetchLatestRates(); err != nil {
+	refresh, err := h.service.RefreshLatestRates()
+	if err != nil {
 		h.logger.Error().Err(err).Msg("Failed to refresh exchange rates")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -59,10 +64,22 @@ func (h *ExchangeRateHandler) RefreshRates(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Exchange rates refreshed successfully",
-		"rates":   rates,
-	})
+	message := "Exchange rates refreshed successfully"
+	if refresh.RecentlyRefreshed {
+		message = "Exchange rates were refreshed recently; returning stored rates"
+	}
+	response := gin.H{
+		"message":            message,
+		"rates":              rates,
+		"recently_refreshed": refresh.RecentlyRefreshed,
+	}
+	if !refresh.RefreshedAt.IsZero() {
+		response["refreshed_at"] = refresh.RefreshedAt
+	}
+	if refresh.Provider != "" {
+		response["provider"] = refresh.Provider
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // AddCurrencyRequest represents a request to add a new currency
@@ -126,3 +143,28 @@ func (h *ExchangeRateHandler) DeleteCurrency(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Currency deleted successfully"})
 }
+
+// ensureCurrencyTracked registers an untracked currency with the provider's current rate when
+// AUTO_ADD_CURRENCIES is on. It writes an actionable error and returns false when the currency
+// cannot be added, so callers never fall back to an implicit 1:1 rate.
+func ensureCurrencyTracked(c *gin.Context, cfg *config.Config, service *services.ExchangeRateService, logger zerolog.Logger, currencyCode string) bool {
+	if !cfg.AutoAddCurrencies {
+		return true
+	}
+	if _, err := service.EnsureCurrency(currencyCode); err != nil {
+		if errors.Is(err, services.ErrNoExchangeRateProvider) || errors.Is(err, services.ErrCurrencyNotSupported) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    fmt.Sprintf("Currency %s is not tracked and could not be added automatically: %v. Add it with POST /exchange-rates first.", currencyCode, err),
+				"currency": currencyCode,
+			})
+			return false
+		}
+		logger.Error().Err(err).Str("currency", currencyCode).Msg("Failed to add currency automatically")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":    fmt.Sprintf("Failed to fetch an exchange rate for %s. Retry or add it with POST /exchange-rates.", currencyCode),
+			"currency": currencyCode,
+		})
+		return false
+	}
+	return true
+}
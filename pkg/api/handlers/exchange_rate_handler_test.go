@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestConcurrentRefreshRatesFetchProviderOnce(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "exchange-rate-handler-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: time.Now().Add(-48 * time.Hour)},
+		{CurrencyCode: "USD", Rate: 1.1, IsActive: true, LastUpdated: time.Now().Add(-48 * time.Hour)},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("seed rate: %v", err)
+		}
+	}
+
+	// The provider holds the first fetch open until both requests are in flight or done.
+	var fetches int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := NewExchangeRateHandler(db, &config.Config{}, zerolog.Nop())
+	// Refreshes are throttled per provider endpoint process-wide, so each run uses its own.
+	endpoint := fmt.Sprintf("https://fx-refresh-%d.test/v6", time.Now().UnixNano())
+	h.service.SetProvider(endpoint, "refresh-key", &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"result":"success","base_code":"EUR","conversion_rates":{"EUR":1,"USD":1.2}}`)),
+			Request:    req,
+		}, nil
+	})})
+
+	refresh := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/exchange-rates/refresh", nil)
+		h.RefreshRates(c)
+		return w
+	}
+
+	responses := make([]*httptest.ResponseRecorder, 2)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = refresh()
+		}(i)
+	}
+	<-started
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Fatalf("provider fetches: got %d want 1", got)
+	}
+	for i, w := range responses {
+		if w.Code != http.StatusOK {
+			t.Fatalf("refresh %d: status %d body %s", i, w.Code, w.Body.String())
+		}
+	}
+	var usd models.ExchangeRate
+	if err := db.Where("currency_code = ?", "USD").First(&usd).Error; err != nil {
+		t.Fatalf("load USD: %v", err)
+	}
+	if usd.Rate != 1.2 {
+		t.Errorf("USD rate: got %.2f want 1.2", usd.Rate)
+	}
+
+	// A later refresh within the minimum interval is short-circuited.
+	w := refresh()
+	var body struct {
+		RecentlyRefreshed bool                  `json:"recently_refreshed"`
+		Rates             []models.ExchangeRate `json:"rates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !body.RecentlyRefreshed || len(body.Rates) != 2 {
+		t.Errorf("third refresh: got recently_refreshed=%v with %d rates, want true with 2", body.RecentlyRefreshed, len(body.Rates))
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("provider fetches after third refresh: got %d want 1", got)
+	}
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/art-pro/stock-backend/pkg/config"
 	"github.com/art-pro/stock-backend/pkg/database"
 	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
@@ -14,14 +17,22 @@ import (
 
 // OperationHandler handles operation (trade) creation and listing
 type OperationHandler struct {
-	db          *gorm.DB
-	cashHandler *CashHandler
-	logger      zerolog.Logger
+	db                  *gorm.DB
+	cfg                 *config.Config
+	cashHandler         *CashHandler
+	exchangeRateService *services.ExchangeRateService
+	logger              zerolog.Logger
 }
 
 // NewOperationHandler creates a new operation handler
-func NewOperationHandler(db *gorm.DB, cashHandler *CashHandler, logger zerolog.Logger) *OperationHandler {
-	return &OperationHandler{db: db, cashHandler: cashHandler, logger: logger}
+func NewOperationHandler(db *gorm.DB, cfg *config.Config, cashHandler *CashHandler, logger zerolog.Logger) *OperationHandler {
+	return &OperationHandler{
+		db:                  db,
+		cfg:                 cfg,
+		cashHandler:         cashHandler,
+		exchangeRateService: services.NewExchangeRateService(db, logger),
+		logger:              logger,
+	}
 }
 
 func (h *OperationHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
@@ -35,6 +46,15 @@ func (h *OperationHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
 	return database.GetDefaultPortfolioID(h.db)
 }
 
+// resolvePortfolioIDForWrite resolves the portfolio for operations that may create stocks, creating
+// the caller's default portfolio first when none exists and AUTO_CREATE_DEFAULT_PORTFOLIO is on.
+func (h *OperationHandler) resolvePortfolioIDForWrite(c *gin.Context) (uint, error) {
+	if c.Query("portfolio_id") != "" {
+		return h.resolvePortfolioID(c)
+	}
+	return database.ResolveDefaultPortfolioID(h.db, c.GetString("username"), h.cfg != nil && h.cfg.AutoCreateDefaultPortfolio)
+}
+
 // CreateOperationRequest represents the request to create an operation
 type CreateOperationRequest struct {
 	OperationType string  `json:"operation_type" binding:"required"` // Buy, Sell, Deposit, Withdraw, Dividend
@@ -45,7 +65,8 @@ type CreateOperationRequest struct {
 	Currency      string  `json:"currency" binding:"required"`
 	Quantity      float64 `json:"quantity" binding:"required,gte=0"`
 	Price         float64 `json:"price" binding:"gte=0"`
-	Amount        float64 `json:"amount"` // Optional; if 0 for Buy/Sell computed as Quantity*Price
+	Amount        float64 `json:"amount"`  // Optional; if 0 for Buy/Sell computed as Quantity*Price
+	FXRate        float64 `json:"fx_rate"` // Optional; currency units per 1 EUR at trade time
 	Note          string  `json:"note"`
 	TradeDate     string  `json:"trade_date" binding:"required"` // DD.MM.YYYY
 	StockID       *uint   `json:"stock_id,omitempty"`            // Optional; for Buy/Sell link to existing stock
@@ -59,7 +80,7 @@ func (h *OperationHandler) CreateOperation(c *gin.Context) {
 		return
 	}
 
-	portfolioID, err := h.resolvePortfolioID(c)
+	portfolioID, err := h.resolvePortfolioIDForWrite(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
 		return
@@ -85,7 +106,7 @@ func (h *OperationHandler) CreateOperation(c *gin.Context) {
 		PortfolioID:   portfolioID,
 		StockID:       req.StockID,
 		OperationType: req.OperationType,
-		Ticker:        req.Ticker,
+		Ticker:        services.StoredTicker(req.Ticker, h.cfg),
 		ISIN:          req.ISIN,
 		CompanyName:   req.CompanyName,
 		Sector:        req.Sector,
@@ -93,9 +114,11 @@ func (h *OperationHandler) CreateOperation(c *gin.Context) {
 		Quantity:      req.Quantity,
 		Price:         req.Price,
 		Amount:        amount,
+		FXRate:        req.FXRate,
 		Note:          req.Note,
 		TradeDate:     req.TradeDate,
 	}
+	h.recordLotFX(&op)
 
 	if err := h.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&op).Error; err != nil {
@@ -129,6 +152,29 @@ func (h *OperationHandler) ListOperations(c *gin.Context) {
 	c.JSON(http.StatusOK, operations)
 }
 
+// releaseOrderFill takes a deleted fill's quantity back off its limit order, so the order reopens
+// (or drops to partial) unless it was cancelled.
+func releaseOrderFill(tx *gorm.DB, op *models.Operation) error {
+	if op.OrderID == nil {
+		return nil
+	}
+	var order models.Order
+	if err := tx.Where("id = ? AND portfolio_id = ?", *op.OrderID, op.PortfolioID).First(&order).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	order.FilledQuantity -= op.Quantity
+	if order.FilledQuantity < 0 {
+		order.FilledQuantity = 0
+	}
+	if order.Status != services.OrderStatusCancelled {
+		order.Status = services.OrderStatusFor(order.FilledQuantity, order.Quantity)
+	}
+	return tx.Save(&order).Error
+}
+
 // reverseOperationEffects undoes the cash and stock impact of an operation (for delete or before update).
 func (h *OperationHandler) reverseOperationEffects(tx *gorm.DB, op *models.Operation) error {
 	portfolioID := op.PortfolioID
@@ -162,7 +208,7 @@ func (h *OperationHandler) reverseOperationEffects(tx *gorm.DB, op *models.Opera
 			return nil
 		}
 		var stock models.Stock
-		errStock := tx.Where("portfolio_id = ? AND ticker = ?", portfolioID, op.Ticker).First(&stock).Error
+		errStock := tx.Where("portfolio_id = ? AND ticker = ?", portfolioID, services.StoredTicker(op.Ticker, h.cfg)).First(&stock).Error
 		if errStock != nil {
 			return nil // stock already gone or never created
 		}
@@ -177,7 +223,7 @@ func (h *OperationHandler) reverseOperationEffects(tx *gorm.DB, op *models.Opera
 				return nil
 			}
 			oldTotal := float64(stock.SharesOwned) * stock.AvgPriceLocal
-			newTotal := oldTotal - op.Quantity*op.Price
+			newTotal := oldTotal - op.Quantity*h.priceInCurrency(op, stock.Currency)
 			stock.SharesOwned = newShares
 			if newShares > 0 {
 				stock.AvgPriceLocal = newTotal / float64(newShares)
@@ -187,7 +233,7 @@ func (h *OperationHandler) reverseOperationEffects(tx *gorm.DB, op *models.Opera
 		}
 		// Sell reversal: add shares back
 		newShares := stock.SharesOwned + qty
-		totalCost := float64(stock.SharesOwned)*stock.AvgPriceLocal + op.Quantity*op.Price
+		totalCost := float64(stock.SharesOwned)*stock.AvgPriceLocal + op.Quantity*h.priceInCurrency(op, stock.Currency)
 		stock.SharesOwned = newShares
 		if newShares > 0 {
 			stock.AvgPriceLocal = totalCost / float64(newShares)
@@ -229,7 +275,7 @@ func (h *OperationHandler) applyOperationEffects(tx *gorm.DB, portfolioID uint,
 			return nil
 		}
 		var stock models.Stock
-		errStock := tx.Where("portfolio_id = ? AND ticker = ?", portfolioID, op.Ticker).First(&stock).Error
+		errStock := tx.Where("portfolio_id = ? AND ticker = ?", portfolioID, services.StoredTicker(op.Ticker, h.cfg)).First(&stock).Error
 		if op.OperationType == "Buy" {
 			if errStock != nil {
 				companyName := op.CompanyName
@@ -248,6 +294,7 @@ func (h *OperationHandler) applyOperationEffects(tx *gorm.DB, portfolioID uint,
 					AvgPriceLocal:       op.Price,
 					UpdateFrequency:     "daily",
 					ProbabilityPositive: 0.65,
+					PurchasedAt:         tradeTimestamp(op.TradeDate),
 				}
 				if err := tx.Create(&stock).Error; err != nil {
 					return err
@@ -255,8 +302,12 @@ func (h *OperationHandler) applyOperationEffects(tx *gorm.DB, portfolioID uint,
 				op.StockID = &stock.ID
 				return tx.Save(op).Error
 			}
+			if stock.SharesOwned <= 0 || stock.PurchasedAt == nil {
+				// Buying into an empty (or legacy undated) position starts a new holding period
+				stock.PurchasedAt = tradeTimestamp(op.TradeDate)
+			}
 			newShares := stock.SharesOwned + int(op.Quantity)
-			totalCost := float64(stock.SharesOwned)*stock.AvgPriceLocal + op.Quantity*op.Price
+			totalCost := float64(stock.SharesOwned)*stock.AvgPriceLocal + op.Quantity*h.priceInCurrency(op, stock.Currency)
 			stock.SharesOwned = newShares
 			if newShares > 0 {
 				stock.AvgPriceLocal = totalCost / float64(newShares)
@@ -287,6 +338,51 @@ func (h *OperationHandler) applyOperationEffects(tx *gorm.DB, portfolioID uint,
 	return nil
 }
 
+// recordLotFX sets op.FXRate to the current rate of its currency for Buy/Sell operations when
+// LOT_FX_AT_PURCHASE is on and no rate was given, fixing the lot's FX-at-purchase.
+func (h *OperationHandler) recordLotFX(op *models.Operation) {
+	if op.FXRate > 0 || h.cfg == nil || !h.cfg.LotFXAtPurchase || (op.OperationType != "Buy" && op.OperationType != "Sell") {
+		return
+	}
+	if rate, err := h.exchangeRateService.GetRate(op.Currency); err == nil && rate > 0 {
+		op.FXRate = rate
+	}
+}
+
+// priceInCurrency converts op.Price into currency (the linked stock's) through EUR, using the lot's
+// FX-at-purchase for each leg when recorded and the current rate otherwise. With LOT_FX_AT_PURCHASE
+// on, the stock currency's rate is recorded on op (StockFXRate) so later reversals use the same rate.
+func (h *OperationHandler) priceInCurrency(op *models.Operation, currency string) float64 {
+	if currency == "" || strings.EqualFold(op.Currency, currency) {
+		return op.Price
+	}
+	opRate := op.FXRate
+	if opRate <= 0 {
+		opRate, _ = h.exchangeRateService.GetRate(op.Currency)
+	}
+	stockRate := op.StockFXRate
+	if stockRate <= 0 {
+		stockRate, _ = h.exchangeRateService.GetRate(currency)
+		if stockRate > 0 && h.cfg != nil && h.cfg.LotFXAtPurchase {
+			op.StockFXRate = stockRate
+		}
+	}
+	if opRate <= 0 || stockRate <= 0 {
+		h.logger.Warn().Str("ticker", op.Ticker).Str("currency", op.Currency).Str("stock_currency", currency).Msg("Missing exchange rate for lot, using unconverted price")
+		return op.Price
+	}
+	return op.Price / opRate * stockRate
+}
+
+// tradeTimestamp parses an operation trade date, falling back to now when unparseable.
+func tradeTimestamp(tradeDate string) *time.Time {
+	t, err := services.ParseTradeDate(tradeDate)
+	if err != nil {
+		t = time.Now()
+	}
+	return &t
+}
+
 // DeleteOperation deletes an operation and reverses its cash and stock effects.
 func (h *OperationHandler) DeleteOperation(c *gin.Context) {
 	idParam := c.Param("id")
@@ -315,6 +411,9 @@ func (h *OperationHandler) DeleteOperation(c *gin.Context) {
 		if err := h.reverseOperationEffects(tx, &op); err != nil {
 			return err
 		}
+		if err := releaseOrderFill(tx, &op); err != nil {
+			return err
+		}
 		return tx.Delete(&op).Error
 	}); err != nil {
 		h.logger.Error().Err(err).Msg("Failed to delete operation")
@@ -374,7 +473,7 @@ func (h *OperationHandler) UpdateOperation(c *gin.Context) {
 		PortfolioID:   existing.PortfolioID,
 		StockID:       req.StockID,
 		OperationType: req.OperationType,
-		Ticker:        req.Ticker,
+		Ticker:        services.StoredTicker(req.Ticker, h.cfg),
 		ISIN:          req.ISIN,
 		CompanyName:   req.CompanyName,
 		Sector:        req.Sector,
@@ -382,11 +481,20 @@ func (h *OperationHandler) UpdateOperation(c *gin.Context) {
 		Quantity:      req.Quantity,
 		Price:         req.Price,
 		Amount:        amount,
+		FXRate:        req.FXRate,
 		Note:          req.Note,
 		TradeDate:     req.TradeDate,
 		CreatedAt:     existing.CreatedAt,
 		UpdatedAt:     time.Now(),
 	}
+	if updated.Currency == existing.Currency && updated.Ticker == existing.Ticker {
+		// Keep the rates recorded at the original trade unless a new rate is given
+		if updated.FXRate <= 0 {
+			updated.FXRate = existing.FXRate
+		}
+		updated.StockFXRate = existing.StockFXRate
+	}
+	h.recordLotFX(&updated)
 
 	if err := h.db.Transaction(func(tx *gorm.DB) error {
 		// Reverse the existing operation's effects (use a copy so we don't mutate existing)
@@ -61,7 +61,7 @@ func setupOperationHandlerTest(t *testing.T) (*gorm.DB, *OperationHandler, uint)
 	}
 	cfg := &config.Config{}
 	cashHandler := NewCashHandler(db, cfg, zerolog.Nop())
-	opHandler := NewOperationHandler(db, cashHandler, zerolog.Nop())
+	opHandler := NewOperationHandler(db, cfg, cashHandler, zerolog.Nop())
 	return db, opHandler, portfolio.ID
 }
 
@@ -453,3 +453,43 @@ func TestUpdateOperation_RecomputesCash(t *testing.T) {
 		t.Errorf("cash after update: got %f want 80", cash.Amount)
 	}
 }
+
+func TestCreateOperation_BuyAndSellNonCanonicalTickerUseStoredStock(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupOperationHandlerTest(t)
+	h.cfg.NormalizeTickers = true
+	stock := models.Stock{PortfolioID: portfolioID, Ticker: "BRK-B", DisplayTicker: "BRK.B", Currency: "USD", CurrentPrice: 400, SharesOwned: 10, AvgPriceLocal: 400}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	for _, payload := range []CreateOperationRequest{
+		{OperationType: "Buy", Ticker: "BRK.B", Currency: "USD", Quantity: 5, Price: 400, TradeDate: "15.02.2026"},
+		{OperationType: "Sell", Ticker: "brk/b", Currency: "USD", Quantity: 3, Price: 420, TradeDate: "16.02.2026"},
+	} {
+		body, _ := json.Marshal(payload)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/operations", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.CreateOperation(c)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%s %s: status %d, body %s", payload.OperationType, payload.Ticker, w.Code, w.Body.String())
+		}
+	}
+
+	var stocks []models.Stock
+	if err := db.Where("portfolio_id = ?", portfolioID).Find(&stocks).Error; err != nil {
+		t.Fatalf("load stocks: %v", err)
+	}
+	if len(stocks) != 1 || stocks[0].SharesOwned != 12 {
+		t.Fatalf("expected the BRK-B position updated to 12 shares without a second stock, got %+v", stocks)
+	}
+	var tickers []string
+	if err := db.Model(&models.Operation{}).Order("id").Pluck("ticker", &tickers).Error; err != nil {
+		t.Fatalf("load operations: %v", err)
+	}
+	if len(tickers) != 2 || tickers[0] != "BRK-B" || tickers[1] != "BRK-B" {
+		t.Fatalf("operations should store the canonical ticker, got %v", tickers)
+	}
+}
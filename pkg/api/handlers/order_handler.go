@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/database"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// OrderHandler handles limit orders and their fills
+type OrderHandler struct {
+	db         *gorm.DB
+	operations *OperationHandler
+	logger     zerolog.Logger
+}
+
+// NewOrderHandler creates a new order handler; fills are booked as trades through operations
+func NewOrderHandler(db *gorm.DB, operations *OperationHandler, logger zerolog.Logger) *OrderHandler {
+	return &OrderHandler{
+		db:         db,
+		operations: operations,
+		logger:     logger,
+	}
+}
+
+func (h *OrderHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
+	if portfolioIDParam := c.Query("portfolio_id"); portfolioIDParam != "" {
+		parsed, err := strconv.ParseUint(portfolioIDParam, 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return uint(parsed), nil
+	}
+	return database.GetDefaultPortfolioID(h.db)
+}
+
+// CreateOrderRequest represents the request to place a limit order
+type CreateOrderRequest struct {
+	Ticker     string  `json:"ticker" binding:"required"`
+	Side       string  `json:"side" binding:"required"` // Buy or Sell
+	Currency   string  `json:"currency"`                // Optional; defaults to the tracked stock's currency
+	LimitPrice float64 `json:"limit_price" binding:"required,gt=0"`
+	Quantity   float64 `json:"quantity" binding:"required,gt=0"`
+	Note       string  `json:"note"`
+}
+
+// UpdateOrderRequest changes an active order. A higher filled_quantity books the newly filled
+// shares as a trade at fill_price (default: the limit price) on trade_date (DD.MM.YYYY, default today).
+type UpdateOrderRequest struct {
+	LimitPrice     *float64 `json:"limit_price"`
+	Quantity       *float64 `json:"quantity"`
+	FilledQuantity *float64 `json:"filled_quantity"` // Cumulative filled shares
+	FillPrice      float64  `json:"fill_price"`
+	TradeDate      string   `json:"trade_date"`
+	Status         string   `json:"status"` // Only "cancelled"; other statuses follow from the fills
+	Note           *string  `json:"note"`
+}
+
+// CreateOrder places an open limit order
+func (h *OrderHandler) CreateOrder(c *gin.Context) {
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if req.Side != "Buy" && req.Side != "Sell" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "side must be one of: Buy, Sell"})
+		return
+	}
+
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	order := models.Order{
+		PortfolioID: portfolioID,
+		Ticker:      services.StoredTicker(strings.ToUpper(strings.TrimSpace(req.Ticker)), h.operations.cfg),
+		Side:        req.Side,
+		Currency:    strings.ToUpper(strings.TrimSpace(req.Currency)),
+		LimitPrice:  req.LimitPrice,
+		Quantity:    req.Quantity,
+		Status:      services.OrderStatusOpen,
+		Note:        req.Note,
+	}
+	var stock models.Stock
+	if err := h.db.Where("portfolio_id = ? AND ticker = ?", portfolioID, order.Ticker).First(&stock).Error; err == nil {
+		order.StockID = &stock.ID
+		if order.Currency == "" {
+			order.Currency = stock.Currency
+		}
+	}
+	if order.Currency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency is required for a ticker that is not tracked"})
+		return
+	}
+	if order.Side == "Sell" && stock.SharesOwned < int(order.Quantity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot sell %.0f shares of %s; %d held", order.Quantity, order.Ticker, stock.SharesOwned)})
+		return
+	}
+
+	if err := h.db.Create(&order).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to create order")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
+	}
+	c.JSON(http.StatusCreated, order)
+}
+
+// ListOrders returns the portfolio's orders, newest first. Query status filters by a comma-separated
+// list of statuses (e.g. open,partial).
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	query := h.db.Where("portfolio_id = ?", portfolioID)
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query = query.Where("status IN ?", strings.Split(status, ","))
+	}
+	var orders []models.Order
+	if err := query.Order("created_at DESC").Find(&orders).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list orders")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list orders"})
+		return
+	}
+	c.JSON(http.StatusOK, orders)
+}
+
+// UpdateOrder edits, fills or cancels an active order. Filled and cancelled orders are final.
+func (h *OrderHandler) UpdateOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+		return
+	}
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+	var req UpdateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := h.db.Where("id = ? AND portfolio_id = ?", id, portfolioID).First(&order).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load order"})
+		return
+	}
+	if !services.OrderIsActive(order) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order is " + order.Status + " and can no longer change"})
+		return
+	}
+
+	if req.LimitPrice != nil {
+		if *req.LimitPrice <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit_price must be positive"})
+			return
+		}
+		order.LimitPrice = *req.LimitPrice
+	}
+	if req.Quantity != nil {
+		order.Quantity = *req.Quantity
+	}
+	if req.Note != nil {
+		order.Note = *req.Note
+	}
+	filled := order.FilledQuantity
+	if req.FilledQuantity != nil {
+		filled = *req.FilledQuantity
+	}
+	switch {
+	case order.Quantity <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be positive"})
+		return
+	case filled < order.FilledQuantity:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filled_quantity cannot decrease; delete the fill's operation instead"})
+		return
+	case filled > order.Quantity:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filled_quantity cannot exceed quantity"})
+		return
+	case req.Status != "" && req.Status != services.OrderStatusCancelled:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status can only be set to cancelled"})
+		return
+	}
+
+	var fill *models.Operation
+	if delta := filled - order.FilledQuantity; delta > 0 {
+		price := req.FillPrice
+		if price <= 0 {
+			price = order.LimitPrice
+		}
+		tradeDate := req.TradeDate
+		if tradeDate == "" {
+			tradeDate = time.Now().Format("02.01.2006")
+		} else if _, err := services.ParseTradeDate(tradeDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fill = &models.Operation{
+			PortfolioID:   portfolioID,
+			StockID:       order.StockID,
+			OrderID:       &order.ID,
+			OperationType: order.Side,
+			Ticker:        order.Ticker,
+			Currency:      order.Currency,
+			Quantity:      delta,
+			Price:         price,
+			Note:          fmt.Sprintf("Fill of order #%d", order.ID),
+			TradeDate:     tradeDate,
+		}
+		h.operations.recordLotFX(fill)
+	}
+	order.FilledQuantity = filled
+	order.Status = services.OrderStatusFor(order.FilledQuantity, order.Quantity)
+	if req.Status == services.OrderStatusCancelled && order.Status != services.OrderStatusFilled {
+		order.Status = services.OrderStatusCancelled
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if fill != nil {
+			if err := tx.Create(fill).Error; err != nil {
+				return err
+			}
+			if err := h.operations.applyOperationEffects(tx, portfolioID, fill); err != nil {
+				return err
+			}
+			if order.StockID == nil {
+				order.StockID = fill.StockID
+			}
+		}
+		return tx.Save(&order).Error
+	}); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to update order")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order"})
+		return
+	}
+
+	response := gin.H{"order": order}
+	if fill != nil {
+		response["fill"] = fill
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+func setupOrderHandlerTest(t *testing.T) (*gorm.DB, *OrderHandler, uint) {
+	t.Helper()
+	db, opHandler, portfolioID := setupOperationHandlerTest(t)
+	if err := db.AutoMigrate(&models.Order{}); err != nil {
+		t.Fatalf("migrate orders: %v", err)
+	}
+	return db, NewOrderHandler(db, opHandler, zerolog.Nop()), portfolioID
+}
+
+func updateOrder(t *testing.T, h *OrderHandler, id uint, payload map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(id), 10)}}
+	c.Request = httptest.NewRequest(http.MethodPut, "/orders/"+strconv.FormatUint(uint64(id), 10), bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.UpdateOrder(c)
+	return w
+}
+
+func TestUpdateOrderFillsAdjustPositionAndCash(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupOrderHandlerTest(t)
+
+	body, _ := json.Marshal(CreateOrderRequest{Ticker: "acme", Side: "Buy", Currency: "EUR", LimitPrice: 50, Quantity: 10})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.CreateOrder(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d, body %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if order.Ticker != "ACME" || order.Status != services.OrderStatusOpen || order.StockID != nil {
+		t.Fatalf("unexpected order: %+v", order)
+	}
+
+	// A partial fill of 4 at 49 books a Buy, creates the position and leaves the order partial.
+	w = updateOrder(t, h, order.ID, map[string]interface{}{"filled_quantity": 4, "fill_price": 49, "trade_date": "03.03.2026"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("partial fill: got %d, body %s", w.Code, w.Body.String())
+	}
+	var stock models.Stock
+	if err := db.Where("portfolio_id = ? AND ticker = ?", portfolioID, "ACME").First(&stock).Error; err != nil {
+		t.Fatalf("find stock: %v", err)
+	}
+	if stock.SharesOwned != 4 || stock.AvgPriceLocal != 49 {
+		t.Fatalf("after partial fill: got %d shares at %.2f, want 4 at 49", stock.SharesOwned, stock.AvgPriceLocal)
+	}
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	if order.Status != services.OrderStatusPartial || order.StockID == nil || *order.StockID != stock.ID {
+		t.Fatalf("after partial fill: got %+v", order)
+	}
+
+	// Filling the remaining 6 at the limit completes the order.
+	w = updateOrder(t, h, order.ID, map[string]interface{}{"filled_quantity": 10, "trade_date": "04.03.2026"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("full fill: got %d, body %s", w.Code, w.Body.String())
+	}
+	if err := db.First(&stock, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if stock.SharesOwned != 10 {
+		t.Fatalf("after full fill: got %d shares want 10", stock.SharesOwned)
+	}
+	var fills []models.Operation
+	if err := db.Where("order_id = ?", order.ID).Order("id").Find(&fills).Error; err != nil {
+		t.Fatalf("find fills: %v", err)
+	}
+	if len(fills) != 2 || fills[0].Quantity != 4 || fills[1].Quantity != 6 || fills[1].Price != 50 {
+		t.Fatalf("unexpected fills: %+v", fills)
+	}
+	var cash models.CashHolding
+	if err := db.Where("portfolio_id = ? AND currency_code = ?", portfolioID, "EUR").First(&cash).Error; err != nil {
+		t.Fatalf("find cash: %v", err)
+	}
+	if cash.Amount != -(4*49 + 6*50) {
+		t.Errorf("cash: got %.2f want %.2f", cash.Amount, -(4*49 + 6*50.0))
+	}
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	if order.Status != services.OrderStatusFilled {
+		t.Fatalf("status: got %s want filled", order.Status)
+	}
+
+	// Filled orders are final.
+	if w = updateOrder(t, h, order.ID, map[string]interface{}{"status": "cancelled"}); w.Code != http.StatusConflict {
+		t.Fatalf("update filled order: got %d want 409", w.Code)
+	}
+}
+
+func TestUpdateOrderRejectsFillBeyondQuantity(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupOrderHandlerTest(t)
+	order := models.Order{PortfolioID: portfolioID, Ticker: "ACME", Side: "Buy", Currency: "EUR", LimitPrice: 50, Quantity: 5, Status: services.OrderStatusOpen}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	if w := updateOrder(t, h, order.ID, map[string]interface{}{"filled_quantity": 6}); w.Code != http.StatusBadRequest {
+		t.Fatalf("overfill: got %d want 400", w.Code)
+	}
+	w := updateOrder(t, h, order.ID, map[string]interface{}{"status": "cancelled"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: got %d, body %s", w.Code, w.Body.String())
+	}
+	var count int64
+	db.Model(&models.Stock{}).Where("ticker = ?", "ACME").Count(&count)
+	if count != 0 {
+		t.Fatalf("cancelling without fills must not create a position")
+	}
+}
+
+func TestDeleteFillOperationReopensOrder(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupOrderHandlerTest(t)
+	order := models.Order{PortfolioID: portfolioID, Ticker: "ACME", Side: "Buy", Currency: "EUR", LimitPrice: 50, Quantity: 10, Status: services.OrderStatusOpen}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	for _, filled := range []int{4, 10} {
+		if w := updateOrder(t, h, order.ID, map[string]interface{}{"filled_quantity": filled, "trade_date": "03.03.2026"}); w.Code != http.StatusOK {
+			t.Fatalf("fill to %d: got %d, body %s", filled, w.Code, w.Body.String())
+		}
+	}
+	var fills []models.Operation
+	if err := db.Where("order_id = ?", order.ID).Order("id").Find(&fills).Error; err != nil || len(fills) != 2 {
+		t.Fatalf("find fills: %v (%d)", err, len(fills))
+	}
+
+	// Deleting the fill of 6 puts the order back to partial with 4 filled.
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(fills[1].ID), 10)}}
+	c.Request = httptest.NewRequest(http.MethodDelete, "/operations/"+strconv.FormatUint(uint64(fills[1].ID), 10), nil)
+	h.operations.DeleteOperation(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete fill: got %d, body %s", w.Code, w.Body.String())
+	}
+	if err := db.First(&order, order.ID).Error; err != nil {
+		t.Fatalf("reload order: %v", err)
+	}
+	if order.FilledQuantity != 4 || order.Status != services.OrderStatusPartial {
+		t.Fatalf("after deleting fill: filled %.0f status %s, want 4 partial", order.FilledQuantity, order.Status)
+	}
+
+	// The order can be filled again.
+	if w := updateOrder(t, h, order.ID, map[string]interface{}{"filled_quantity": 10, "trade_date": "04.03.2026"}); w.Code != http.StatusOK {
+		t.Fatalf("refill: got %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateOrderFindsStockByNormalizedTicker(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupOrderHandlerTest(t)
+	h.operations.cfg.NormalizeTickers = true
+	stock := models.Stock{PortfolioID: portfolioID, Ticker: "BRK-B", Currency: "USD", CurrentPrice: 400, SharesOwned: 10}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	body, _ := json.Marshal(CreateOrderRequest{Ticker: "brk.b", Side: "Sell", LimitPrice: 450, Quantity: 5})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.CreateOrder(c)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d, body %s", w.Code, w.Body.String())
+	}
+	var order models.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if order.Ticker != "BRK-B" || order.StockID == nil || *order.StockID != stock.ID || order.Currency != "USD" {
+		t.Fatalf("expected the order linked to BRK-B in USD, got %+v", order)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PortfolioSubtotal is one portfolio's share of the consolidated view, in EUR.
+type PortfolioSubtotal struct {
+	PortfolioID uint    `json:"portfolio_id"`
+	Name        string  `json:"name"`
+	IsDefault   bool    `json:"is_default"`
+	StockValue  float64 `json:"stock_value"`
+	CashValue   float64 `json:"cash_value"`
+	TotalValue  float64 `json:"total_value"`
+	OverallEV   float64 `json:"overall_ev"`
+	Positions   int     `json:"positions"`
+	Weight      float64 `json:"weight"` // Fraction 0–1 of the consolidated total value
+}
+
+// GetConsolidatedPortfolio merges the caller's portfolios into one view: metrics, sector and currency
+// exposure over all stocks and cash, plus per-portfolio subtotals. Query portfolio_ids (comma-separated)
+// limits the view to some portfolios; merge_tickers=false keeps a ticker held in several portfolios as
+// separate positions instead of one. Stored per-stock metrics are used and nothing is persisted.
+func (h *PortfolioHandler) GetConsolidatedPortfolio(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+		return
+	}
+
+	query := h.db.Where("user_id = ?", userID.(uint))
+	if idsParam := strings.TrimSpace(c.Query("portfolio_ids")); idsParam != "" {
+		var ids []uint
+		for _, part := range strings.Split(idsParam, ",") {
+			parsed, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_ids"})
+				return
+			}
+			ids = append(ids, uint(parsed))
+		}
+		query = query.Where("id IN ?", ids)
+	}
+	var portfolios []models.Portfolio
+	if err := query.Order("id").Find(&portfolios).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch portfolios")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolios"})
+		return
+	}
+	if len(portfolios) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No portfolios found"})
+		return
+	}
+	portfolioIDs := make([]uint, len(portfolios))
+	for i, portfolio := range portfolios {
+		portfolioIDs[i] = portfolio.ID
+	}
+
+	fxRates, err := h.exchangeRateService.GetRatesMap()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+
+	var stocks []models.Stock
+	if err := h.db.Where("portfolio_id IN ? AND shares_owned > 0", portfolioIDs).Find(&stocks).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
+		return
+	}
+	var cashHoldings []models.CashHolding
+	if err := h.db.Where("portfolio_id IN ?", portfolioIDs).Find(&cashHoldings).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch cash holdings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash holdings"})
+		return
+	}
+
+	// Per-portfolio subtotals from each portfolio's own stocks and cash.
+	stocksByPortfolio := make(map[uint][]models.Stock)
+	for _, stock := range stocks {
+		stocksByPortfolio[stock.PortfolioID] = append(stocksByPortfolio[stock.PortfolioID], stock)
+	}
+	cashByPortfolio := make(map[uint][]models.CashHolding)
+	for _, holding := range cashHoldings {
+		cashByPortfolio[holding.PortfolioID] = append(cashByPortfolio[holding.PortfolioID], holding)
+	}
+	subtotals := make([]PortfolioSubtotal, 0, len(portfolios))
+	var cashValueTotal float64
+	for _, portfolio := range portfolios {
+		metrics := services.CalculatePortfolioMetrics(stocksByPortfolio[portfolio.ID], fxRates, "EUR", services.PortfolioMetricsConfig(h.db, portfolio.ID))
+		_, cashValue, _ := buildCurrencyExposure(nil, cashByPortfolio[portfolio.ID], fxRates, "EUR", defaultMaxCurrencyExposure)
+		subtotals = append(subtotals, PortfolioSubtotal{
+			PortfolioID: portfolio.ID,
+			Name:        portfolio.Name,
+			IsDefault:   portfolio.IsDefault,
+			StockValue:  metrics.TotalValue,
+			CashValue:   cashValue,
+			TotalValue:  metrics.TotalValue + cashValue,
+			OverallEV:   metrics.OverallEV,
+			Positions:   len(stocksByPortfolio[portfolio.ID]),
+		})
+		cashValueTotal += cashValue
+	}
+
+	positions := stocks
+	mergeTickers := c.Query("merge_tickers") != "false"
+	if mergeTickers {
+		positions = services.MergeHoldingsAcrossPortfolios(stocks)
+	}
+	// The portfolios' metrics settings may differ, so the combined view uses the defaults.
+	metrics := services.CalculatePortfolioMetrics(positions, fxRates, "EUR", services.DefaultMetricsConfig())
+	if targets, err := services.LoadSectorTargets(h.db, userID.(uint)); err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to load sector targets")
+	} else {
+		services.ApplySectorTargets(&metrics, targets)
+	}
+	exposures, _, missing := buildCurrencyExposure(positions, cashHoldings, fxRates, "EUR", defaultMaxCurrencyExposure)
+	totalValue := metrics.TotalValue + cashValueTotal
+
+	for i := range subtotals {
+		if totalValue > 0 {
+			subtotals[i].Weight = subtotals[i].TotalValue / totalValue
+		}
+	}
+	// Position weights (fractions 0–1 of invested value, see DATA_CONTRACT.md) across all portfolios.
+	for i := range positions {
+		if rate := fxRates[positions[i].Currency]; rate > 0 && metrics.TotalValue > 0 {
+			positions[i].Weight = float64(positions[i].SharesOwned) * positions[i].CurrentPrice / rate / metrics.TotalValue
+		}
+	}
+
+	c.Header("Cache-Control", "private, max-age=30, stale-while-revalidate=60")
+	c.JSON(http.StatusOK, gin.H{
+		"summary":           metrics,
+		"cash_value":        cashValueTotal,
+		"total_value":       totalValue,
+		"merge_tickers":     mergeTickers,
+		"positions":         positions,
+		"currency_exposure": exposures,
+		"missing_rates":     missing,
+		"portfolios":        subtotals,
+		"units": gin.H{
+			"summary_total_value": "EUR",
+			"cash_value":          "EUR",
+			"total_value":         "EUR",
+			"position_weight":     "fraction_0_1",
+			"portfolio_weight":    "fraction_0_1",
+		},
+	})
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/art-pro/stock-backend/pkg/config"
@@ -21,6 +24,7 @@ type PortfolioHandler struct {
 	logger              zerolog.Logger
 	apiService          *services.ExternalAPIService
 	exchangeRateService *services.ExchangeRateService
+	metricsCache        *services.MetricsCache // nil when PORTFOLIO_METRICS_CACHE_SECONDS is 0
 }
 
 func (h *PortfolioHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
@@ -36,16 +40,27 @@ func (h *PortfolioHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
 
 // NewPortfolioHandler creates a new portfolio handler
 func NewPortfolioHandler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *PortfolioHandler {
-	return &PortfolioHandler{
+	h := &PortfolioHandler{
 		db:                  db,
 		cfg:                 cfg,
 		logger:              logger,
 		apiService:          services.NewExternalAPIService(cfg),
 		exchangeRateService: services.NewExchangeRateService(db, logger),
 	}
+	if cfg.PortfolioMetricsCacheSeconds > 0 {
+		cache := services.NewMetricsCache(time.Duration(cfg.PortfolioMetricsCacheSeconds) * time.Second)
+		if err := cache.InvalidateOnWrites(db); err != nil {
+			logger.Warn().Err(err).Msg("Failed to register metrics cache invalidation, portfolio summary cache disabled")
+		} else {
+			h.metricsCache = cache
+		}
+	}
+	return h
 }
 
-// GetPortfolioSummary returns aggregated portfolio metrics
+// GetPortfolioSummary returns aggregated portfolio metrics, served from the metrics cache when a
+// fresh entry exists (computed_at reports when the metrics were calculated).
+// Query tag filters the returned stocks by manual or derived tag (e.g. in-buy-zone).
 func (h *PortfolioHandler) GetPortfolioSummary(c *gin.Context) {
 	portfolioID, err := h.resolvePortfolioID(c)
 	if err != nil {
@@ -53,44 +68,201 @@ func (h *PortfolioHandler) GetPortfolioSummary(c *gin.Context) {
 		return
 	}
 
+	// Serve repeated polls from the server-side cache; writes to stocks, trades, rates or fair values invalidate it.
+	// Anonymous PUBLIC_READ visitors get stored data only: no rate refresh, no writes and nothing cached
+	// for signed-in callers, who would otherwise miss the rate refresh.
+	storedOnly := c.GetString("auth_method") == "anonymous"
+	var summary services.CachedPortfolioSummary
+	cached := false
+	if h.metricsCache != nil {
+		summary, cached = h.metricsCache.Get(portfolioID)
+	}
+	if !cached {
+		computed, ok := h.computePortfolioSummary(c, portfolioID, storedOnly)
+		if !ok {
+			return
+		}
+		summary = computed
+		if h.metricsCache != nil && !storedOnly {
+			summary = h.metricsCache.Put(portfolioID, computed)
+		}
+	}
+	stocks, fxRates, metrics := summary.Stocks, summary.FXRates, summary.Metrics
+	metrics.CashBuffer = h.cashBuffer(portfolioID, metrics, fxRates)
+
+	// Optional share-class consolidation (SHARE_CLASS_ALIASES) for concentration and sector analysis;
+	// the stocks list keeps one row per ticker for trade execution.
+	var consolidated []services.ConsolidatedPosition
+	if c.Query("consolidate_share_classes") == "true" {
+		consolidated = services.ConsolidateShareClasses(stocks, fxRates, h.cfg.ShareClassAliases)
+	}
+
+	// Optional tag filter (manual or derived) applies to the returned stocks only; summary covers the whole portfolio.
+	if tag := c.Query("tag"); tag != "" {
+		filtered := make([]models.Stock, 0, len(stocks))
+		for i := range stocks {
+			if stocks[i].HasTag(tag) {
+				filtered = append(filtered, stocks[i])
+			}
+		}
+		stocks = filtered
+	}
+
+	// Add caching headers - cache for 30 seconds (backed by the server-side metrics cache)
+	c.Header("Cache-Control", "private, max-age=30, stale-while-revalidate=60")
+
+	response := gin.H{
+		"portfolio_id": portfolioID,
+		"summary":      metrics,
+		"stocks":       stocks,
+		"computed_at":  summary.ComputedAt,
+		"cached":       cached,
+		"units": gin.H{
+			"summary_total_value":    metrics.BaseCurrency,
+			"summary_ev":             "percent",
+			"summary_volatility":     "percent",
+			"stock_current_value":    "USD",
+			"stock_weight":           "percent",
+			"stock_data_quality":     "score_0_100",
+			"stock_ev_confidence":    "fraction_0_1",
+			"exchange_rate_base":     "EUR",
+			"exchange_rate_semantic": "currency_per_1_EUR",
+		},
+	}
+	if consolidated != nil {
+		response["consolidated"] = consolidated
+	}
+	if openOrders := h.openOrderViews(portfolioID, summary.Stocks); len(openOrders) > 0 {
+		response["open_orders"] = openOrders
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// cashBuffer compares the portfolio's cash holdings (at current rates, in the metrics' base currency)
+// with its positions against settings.min_cash_buffer_pct and the strategy's upper bound. Cash is
+// read per request, outside the metrics cache. Failures are logged and yield nil.
+func (h *PortfolioHandler) cashBuffer(portfolioID uint, metrics services.PortfolioMetrics, fxRates map[string]float64) *services.CashBuffer {
+	settings := models.PortfolioSettings{MinCashBufferPct: services.DefaultMinCashBufferPct}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Warn().Err(err).Msg("Failed to fetch settings for cash buffer")
+		return nil
+	}
+	cashEUR, err := database.PortfolioCashEUR(h.db, portfolioID, fxRates)
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to fetch cash holdings for cash buffer")
+		return nil
+	}
+	baseRate, _ := services.BaseCurrencyRate(fxRates, metrics.BaseCurrency)
+	buffer := services.CalculateCashBuffer(metrics.TotalValue, cashEUR*baseRate, settings.MinCashBufferPct, services.DefaultMaxCashBufferPct)
+	return &buffer
+}
+
+// openOrderViews loads the portfolio's active limit orders and flags those near their limit, using
+// settings.order_near_limit_pct. Failures are logged and yield no orders, leaving the summary intact.
+func (h *PortfolioHandler) openOrderViews(portfolioID uint, stocks []models.Stock) []services.OpenOrderView {
+	var orders []models.Order
+	if err := h.db.Where("portfolio_id = ? AND status IN ?", portfolioID, []string{services.OrderStatusOpen, services.OrderStatusPartial}).
+		Order("created_at").Find(&orders).Error; err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to fetch open orders")
+		return nil
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+	settings := models.PortfolioSettings{OrderNearLimitPct: services.DefaultOrderNearLimitPct}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Warn().Err(err).Msg("Failed to fetch settings")
+	}
+	return services.OpenOrderViews(orders, stocks, settings.OrderNearLimitPct)
+}
+
+// computePortfolioSummary recalculates portfolio metrics and per-stock derived values, persisting
+// weights unless rates are stale and FX_STALE_SKIP_PERSIST is set. With storedOnly the stored rates
+// are used as they are and nothing is persisted. It writes the error response and returns false
+// on failure.
+func (h *PortfolioHandler) computePortfolioSummary(c *gin.Context, portfolioID uint, storedOnly bool) (services.CachedPortfolioSummary, bool) {
 	var stocks []models.Stock
 	if err := h.db.Where("portfolio_id = ?", portfolioID).Find(&stocks).Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
-		return
+		return services.CachedPortfolioSummary{}, false
 	}
 
 	// Refresh rates from API first, then read current rate map from DB.
-	if err := h.exchangeRateService.FetchLatestRates(); err != nil {
-		h.logger.Warn().Err(err).Msg("Failed to refresh exchange rates from API, using latest stored rates")
+	if !storedOnly {
+		if err := h.exchangeRateService.FetchLatestRates(); err != nil {
+			h.logger.Warn().Err(err).Msg("Failed to refresh exchange rates from API, using latest stored rates")
+		}
 	}
 
 	fxRates, err := h.exchangeRateService.GetRatesMap()
 	if err != nil {
 		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
-		return
+		return services.CachedPortfolioSummary{}, false
 	}
 	if len(fxRates) == 0 {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "No exchange rates available"})
-		return
+		return services.CachedPortfolioSummary{}, false
 	}
 
 	usdRate := fxRates["USD"]
 	if usdRate <= 0 {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "USD exchange rate is unavailable"})
-		return
+		return services.CachedPortfolioSummary{}, false
 	}
 
-	// Calculate portfolio metrics
-	metrics := services.CalculatePortfolioMetrics(stocks, fxRates)
+	// Calculate portfolio metrics in the portfolio's base currency
+	var portfolio models.Portfolio
+	if err := h.db.Select("id", "user_id", "base_currency").First(&portfolio, portfolioID).Error; err != nil {
+		h.logger.Warn().Err(err).Uint("portfolio_id", portfolioID).Msg("Failed to load portfolio, reporting in EUR")
+	}
+	metricsConfig := services.PortfolioMetricsConfig(h.db, portfolioID)
+	metrics := services.CalculatePortfolioMetrics(stocks, fxRates, portfolio.BaseCurrency, metricsConfig)
+	baseRate, _ := services.BaseCurrencyRate(fxRates, metrics.BaseCurrency)
+
+	// Flag valuations based on stale rates (manual rates never refresh; auto rates go stale when fetches fail).
+	maxRateAgeHours := h.cfg.FXRatesMaxAgeHours
+	if maxRateAgeHours <= 0 {
+		maxRateAgeHours = defaultFXRatesMaxAgeHours
+	}
+	if latest, err := h.exchangeRateService.LatestRateUpdate(); err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to determine exchange rate age")
+	} else if latest.IsZero() {
+		metrics.RatesStale = true
+	} else {
+		metrics.RatesAgeHours = time.Since(latest).Hours()
+		metrics.RatesStale = metrics.RatesAgeHours > float64(maxRateAgeHours)
+	}
+	persistDerived := !storedOnly && !(metrics.RatesStale && h.cfg.FXStaleSkipPersist)
+
+	// Compare sector weights with the owner's sector targets (GET/POST /settings/sector-targets)
+	if portfolio.ID == 0 {
+		h.logger.Warn().Uint("portfolio_id", portfolioID).Msg("Failed to load portfolio owner for sector targets")
+	} else if targets, err := services.LoadSectorTargets(h.db, portfolio.UserID); err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to load sector targets")
+	} else {
+		services.ApplySectorTargets(&metrics, targets)
+	}
+
+	// Group positions likely to move together (same industry, else same sector) against the correlated-weight cap
+	settings := models.PortfolioSettings{MaxCorrelatedWeight: services.DefaultMaxCorrelatedWeight}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Warn().Err(err).Msg("Failed to fetch settings for correlated positions")
+	}
+	metrics.CorrelatedClusters = services.FindCorrelatedClusters(stocks, fxRates, settings.MaxCorrelatedWeight)
 
-	// Realized PnL from Buy/Sell operations (FIFO, base currency EUR)
+	// Realized PnL and open-lot cost basis from Buy/Sell operations (FIFO, computed in EUR; realized
+	// PnL is converted to the base currency)
 	var operations []models.Operation
 	if err := h.db.Where("portfolio_id = ? AND operation_type IN ?", portfolioID, []string{"Buy", "Sell"}).
 		Order("trade_date ASC, created_at ASC").Find(&operations).Error; err == nil {
 		if realized, err := services.ComputeRealizedPnL(operations, fxRates); err == nil {
-			metrics.RealizedPnL = realized
+			metrics.RealizedPnL = realized * baseRate
+		}
+		costBasis := services.ComputeCostBasis(operations, fxRates)
+		for i := range stocks {
+			stocks[i].CostBasisEUR = costBasis[strings.TrimSpace(stocks[i].Ticker)].CostEUR
 		}
 	}
 
@@ -99,24 +271,24 @@ func (h *PortfolioHandler) GetPortfolioSummary(c *gin.Context) {
 	if tx.Error != nil {
 		h.logger.Error().Err(tx.Error).Msg("Failed to start transaction for portfolio summary updates")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update portfolio summary"})
-		return
+		return services.CachedPortfolioSummary{}, false
 	}
 
 	for i := range stocks {
 		// Recalculate canonical derived metrics on summary refresh so newly added
 		// fields (e.g., sell-zone bounds/status) are populated for existing rows.
-		services.CalculateMetrics(&stocks[i])
+		services.CalculateMetrics(&stocks[i], metricsConfig)
 
 		if stocks[i].SharesOwned > 0 {
 			fxRate := fxRates[stocks[i].Currency]
 			if fxRate <= 0 {
 				h.logger.Warn().Str("ticker", stocks[i].Ticker).Str("currency", stocks[i].Currency).Msg("Missing exchange rate for stock currency, skipping weight/value update")
 			} else {
-				// Convert to EUR (base currency)
+				// Convert to EUR, then to the base currency for the weight
 				valueEUR := float64(stocks[i].SharesOwned) * stocks[i].CurrentPrice / fxRate
 				if metrics.TotalValue > 0 {
 					// Weight as fraction 0–1 (see DATA_CONTRACT.md)
-					stocks[i].Weight = valueEUR / metrics.TotalValue
+					stocks[i].Weight = valueEUR * baseRate / metrics.TotalValue
 					stocks[i].CurrentValueUSD = valueEUR * usdRate // Store in USD for backward compatibility
 				}
 			}
@@ -126,36 +298,62 @@ func (h *PortfolioHandler) GetPortfolioSummary(c *gin.Context) {
 			stocks[i].CurrentValueUSD = 0
 		}
 
+		if !persistDerived {
+			continue
+		}
 		if err := tx.Save(&stocks[i]).Error; err != nil {
 			tx.Rollback()
 			h.logger.Error().Err(err).Msg("Failed to persist stock summary values")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update portfolio summary"})
-			return
+			return services.CachedPortfolioSummary{}, false
 		}
 	}
 
 	if err := tx.Commit().Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to commit portfolio summary transaction")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update portfolio summary"})
-		return
+		return services.CachedPortfolioSummary{}, false
 	}
 
-	// Add caching headers - cache for 30 seconds
-	c.Header("Cache-Control", "private, max-age=30, stale-while-revalidate=60")
+	// Data-quality score and EV aging per stock (computed, not persisted) so the UI can dim low-trust rows
+	// and flag Add/Trim/Sell decisions resting on stale inputs.
+	sourceCounts := h.fairValueSourceCounts(portfolioID, time.Now().AddDate(0, 0, -fairValueSourceWindowDays))
+	now := time.Now()
+	fairValueMaxAge := time.Duration(h.cfg.EVAgingFairValueMaxDays) * 24 * time.Hour
+	priceMaxAge := time.Duration(h.cfg.EVAgingPriceMaxDays) * 24 * time.Hour
+	for i := range stocks {
+		stocks[i].DataQuality = services.CalculateDataQuality(&stocks[i], sourceCounts[stocks[i].ID], now, h.cfg.DataQualityWeights)
+		stocks[i].EVConfidence, stocks[i].DataAgingWarning = services.EVAging(&stocks[i], now, fairValueMaxAge, priceMaxAge)
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"summary": metrics,
-		"stocks":  stocks,
-		"units": gin.H{
-			"summary_total_value":    "EUR",
-			"summary_ev":             "percent",
-			"summary_volatility":     "percent",
-			"stock_current_value":    "USD",
-			"stock_weight":           "percent",
-			"exchange_rate_base":     "EUR",
-			"exchange_rate_semantic": "currency_per_1_EUR",
-		},
-	})
+	return services.CachedPortfolioSummary{Metrics: metrics, Stocks: stocks, FXRates: fxRates, ComputedAt: now}, true
+}
+
+// defaultFXRatesMaxAgeHours applies when FX_RATES_MAX_AGE_HOURS is not configured.
+const defaultFXRatesMaxAgeHours = 48
+
+// fairValueSourceWindowDays bounds which fair value observations count toward data quality.
+const fairValueSourceWindowDays = 90
+
+// fairValueSourceCounts returns the number of distinct fair value sources per stock recorded since the given time.
+func (h *PortfolioHandler) fairValueSourceCounts(portfolioID uint, since time.Time) map[uint]int {
+	var rows []struct {
+		StockID uint
+		Sources int
+	}
+	counts := make(map[uint]int)
+	if err := h.db.Model(&models.FairValueHistory{}).
+		Select("stock_id, COUNT(DISTINCT source) AS sources").
+		Where("portfolio_id = ? AND recorded_at >= ?", portfolioID, since).
+		Group("stock_id").
+		Scan(&rows).Error; err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to count fair value sources")
+		return counts
+	}
+	for _, row := range rows {
+		counts[row.StockID] = row.Sources
+	}
+	return counts
 }
 
 // GetSettings returns portfolio settings
@@ -188,7 +386,8 @@ func (h *PortfolioHandler) GetSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, settings)
 }
 
-// GetAPIStatus returns the status of external API connections
+// GetAPIStatus returns the status of external API connections, plus the auth health of every
+// provider that has responded since startup (providers).
 func (h *PortfolioHandler) GetAPIStatus(c *gin.Context) {
 	status := gin.H{
 		"grok": gin.H{
@@ -242,6 +441,22 @@ func (h *PortfolioHandler) GetAPIStatus(c *gin.Context) {
 		status["grok"].(gin.H)["message"] = "Using mock data. Add XAI_API_KEY to .env for real data"
 	}
 
+	// Auth failures seen on any provider call (scheduler, assessments, fair values, FX) mark the key as broken.
+	health := services.SharedProviderHealth()
+	for key, provider := range map[string]string{"grok": "grok", "alpha_vantage": "alphavantage"} {
+		state, seen := health.State(provider)
+		if !seen {
+			continue
+		}
+		entry := status[key].(gin.H)
+		entry["healthy"] = state.Healthy
+		if state.AuthFailed {
+			entry["status"] = "auth_failed"
+			entry["auth_failed_at"] = state.FailedAt
+		}
+	}
+	status["providers"] = health.Snapshot()
+
 	c.JSON(http.StatusOK, status)
 }
 
@@ -258,6 +473,43 @@ func (h *PortfolioHandler) UpdateSettings(c *gin.Context) {
 		"alerts_enabled":        {},
 		"alert_threshold_ev":    {},
 		"total_portfolio_value": {},
+		"review_interval_days":  {},
+		"min_trade_value_eur":   {},
+		"whole_shares_only":     {},
+		"max_currency_exposure": {},
+		"ev_add_threshold":      {},
+		"ev_trim_threshold":     {},
+		"ev_sell_threshold":     {},
+		"kelly_scale":           {},
+		"kelly_cap":             {},
+		"auto_recompute":        {},
+		"downgrade_min_sources": {},
+		"kelly_utilization_min": {},
+		"kelly_utilization_max": {},
+		"min_cash_buffer_pct":   {},
+		"kelly_rounding_step":   {},
+		"max_fv_disagreement":   {},
+		"max_fv_dispersion":     {},
+		"rebalance_review_days": {},
+		"review_reminder_email": {},
+		"max_positions":         {},
+		"allow_negative_cash":   {},
+		"quiet_hours_start":     {},
+		"quiet_hours_end":       {},
+		"quiet_hours_tz":        {},
+		"probability_band":      {},
+		"max_price_move":        {},
+		"max_buy_zone_downside": {},
+		"min_ratio_positions":   {},
+		"order_near_limit_pct":  {},
+		"max_correlated_weight": {},
+		"max_sector_weight":     {},
+		"assumed_correlation":   {},
+		"benchmark_relative_ev": {},
+		"benchmark_return":      {},
+		"alert_cooldown_hours":  {},
+		"min_position_value":    {},
+		"exclude_dust":          {},
 	}
 
 	sanitized := make(map[string]interface{})
@@ -267,7 +519,46 @@ func (h *PortfolioHandler) UpdateSettings(c *gin.Context) {
 		}
 	}
 
-	if len(sanitized) == 0 {
+	// shadow_metrics is a MetricsConfig object (null turns shadow mode off), stored as JSON.
+	shadowRaw, shadowChanged := req["shadow_metrics"]
+	if shadowChanged {
+		shadowJSON := ""
+		if shadowRaw != nil {
+			encoded, err := json.Marshal(shadowRaw)
+			if err == nil {
+				_, err = services.ParseShadowMetricsConfig(string(encoded))
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			shadowJSON = string(encoded)
+		}
+		sanitized["shadow_metrics_json"] = shadowJSON
+	}
+
+	// base_currency is stored on the portfolio, not its settings, and must have an exchange rate.
+	baseCurrency := ""
+	if raw, present := req["base_currency"]; present {
+		value, ok := raw.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base_currency must be a string"})
+			return
+		}
+		baseCurrency = strings.ToUpper(strings.TrimSpace(value))
+		fxRates, err := h.exchangeRateService.GetRatesMap()
+		if err != nil {
+			h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
+			return
+		}
+		if _, ok := services.BaseCurrencyRate(fxRates, baseCurrency); !ok || baseCurrency == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown base currency: " + baseCurrency})
+			return
+		}
+	}
+
+	if len(sanitized) == 0 && baseCurrency == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
 		return
 	}
@@ -279,6 +570,14 @@ func (h *PortfolioHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	if baseCurrency != "" {
+		if err := h.db.Model(&models.Portfolio{}).Where("id = ?", portfolioID).Update("base_currency", baseCurrency).Error; err != nil {
+			h.logger.Error().Err(err).Msg("Failed to update base currency")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+			return
+		}
+	}
+
 	var settings models.PortfolioSettings
 	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -291,15 +590,161 @@ func (h *PortfolioHandler) UpdateSettings(c *gin.Context) {
 		}
 	}
 
+	// Quiet hours are validated as a whole: both times set (HH:MM) or both empty, in a loadable timezone.
+	quietHours := services.QuietHours{Start: settings.QuietHoursStart, End: settings.QuietHoursEnd, Timezone: settings.QuietHoursTZ}
+	for key, field := range map[string]*string{
+		"quiet_hours_start": &quietHours.Start,
+		"quiet_hours_end":   &quietHours.End,
+		"quiet_hours_tz":    &quietHours.Timezone,
+	} {
+		if raw, present := sanitized[key]; present {
+			value, ok := raw.(string)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": key + " must be a string"})
+				return
+			}
+			*field = value
+		}
+	}
+	if err := quietHours.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previousMetrics := services.MetricsConfigFromSettings(&settings)
+
+	if len(sanitized) == 0 {
+		c.JSON(http.StatusOK, settings)
+		return
+	}
 	if err := h.db.Model(&settings).Updates(sanitized).Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to update settings")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
 		return
 	}
+	if err := h.db.First(&settings, settings.ID).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to reload settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+
+	// Metrics thresholds changed: unless disabled, recompute stored metrics now so assessments
+	// reflect the new config immediately. Later calculations load the portfolio's settings.
+	if metricsConfig := services.MetricsConfigFromSettings(&settings); metricsConfig != previousMetrics {
+		if settings.AutoRecompute {
+			reclassified, err := services.RecomputePortfolioMetrics(h.db, portfolioID, metricsConfig)
+			if err != nil {
+				h.logger.Error().Err(err).Msg("Failed to recompute metrics after settings change")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Settings saved but metrics recompute failed"})
+				return
+			}
+			h.logger.Info().Uint("portfolio_id", portfolioID).Int("reclassified", reclassified).Msg("Recomputed metrics after settings change")
+		}
+	}
 
 	c.JSON(http.StatusOK, settings)
 }
 
+// ShadowDiffRow compares live and shadow metrics for one stock.
+type ShadowDiffRow struct {
+	StockID           uint    `json:"stock_id"`
+	Ticker            string  `json:"ticker"`
+	LiveEV            float64 `json:"live_ev"`
+	ShadowEV          float64 `json:"shadow_ev"`
+	EVDelta           float64 `json:"ev_delta"`
+	LiveHalfKelly     float64 `json:"live_half_kelly"`
+	ShadowHalfKelly   float64 `json:"shadow_half_kelly"`
+	HalfKellyDelta    float64 `json:"half_kelly_delta"`
+	LiveAssessment    string  `json:"live_assessment"`
+	ShadowAssessment  string  `json:"shadow_assessment"`
+	AssessmentChanged bool    `json:"assessment_changed"`
+}
+
+// GetShadowDiff compares live metrics with the shadow MetricsConfig for every stock in the portfolio.
+// Results are computed from current stock inputs and not persisted.
+func (h *PortfolioHandler) GetShadowDiff(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	live := services.PortfolioMetricsConfig(h.db, portfolioID)
+	shadow := live.Shadow()
+	if shadow == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false, "live_config": live, "rows": []ShadowDiffRow{}})
+		return
+	}
+
+	var stocks []models.Stock
+	if err := h.db.Where("portfolio_id = ?", portfolioID).Order("ticker").Find(&stocks).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
+		return
+	}
+
+	rows := make([]ShadowDiffRow, 0, len(stocks))
+	changes := 0
+	for i := range stocks {
+		stock := stocks[i]
+		services.CalculateMetricsWithShadow(&stock, live, shadow)
+		row := ShadowDiffRow{
+			StockID:           stock.ID,
+			Ticker:            stock.Ticker,
+			LiveEV:            stock.ExpectedValue,
+			ShadowEV:          stock.ShadowExpectedValue,
+			EVDelta:           stock.ShadowExpectedValue - stock.ExpectedValue,
+			LiveHalfKelly:     stock.HalfKellySuggested,
+			ShadowHalfKelly:   stock.ShadowHalfKelly,
+			HalfKellyDelta:    stock.ShadowHalfKelly - stock.HalfKellySuggested,
+			LiveAssessment:    stock.Assessment,
+			ShadowAssessment:  stock.ShadowAssessment,
+			AssessmentChanged: stock.ShadowAssessment != stock.Assessment,
+		}
+		if row.AssessmentChanged {
+			changes++
+		}
+		rows = append(rows, row)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":            true,
+		"live_config":        live,
+		"shadow_config":      shadow,
+		"assessment_changes": changes,
+		"rows":               rows,
+	})
+}
+
+// RecomputeMetrics recalculates and persists derived metrics for every stock in the portfolio
+// using the portfolio's metrics settings (manual trigger when auto_recompute is off).
+func (h *PortfolioHandler) RecomputeMetrics(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	var settings models.PortfolioSettings
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	reclassified, err := services.RecomputePortfolioMetrics(h.db, portfolioID, services.MetricsConfigFromSettings(&settings))
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to recompute metrics")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recompute metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"portfolio_id": portfolioID,
+		"reclassified": reclassified,
+	})
+}
+
 // GetAlerts returns all alerts
 func (h *PortfolioHandler) GetAlerts(c *gin.Context) {
 	portfolioID, err := h.resolvePortfolioID(c)
@@ -335,3 +780,707 @@ func (h *PortfolioHandler) DeleteAlert(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Alert deleted successfully"})
 }
+
+// MarkReviewed records that the portfolio was reviewed now, resetting the review_due reminder interval.
+func (h *PortfolioHandler) MarkReviewed(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	now := time.Now()
+	settings, err := database.MarkPortfolioReviewed(h.db, portfolioID, now)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to mark portfolio reviewed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark portfolio reviewed"})
+		return
+	}
+
+	response := gin.H{"portfolio_id": portfolioID, "last_reviewed_at": now}
+	if settings.RebalanceReviewDays > 0 {
+		response["next_review_due"] = now.AddDate(0, 0, settings.RebalanceReviewDays)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// defaultReviewIntervalDays matches the "review weights quarterly" discipline.
+const defaultReviewIntervalDays = 90
+
+// longTermHoldingDays is the holding period after which a position counts as long-term.
+const longTermHoldingDays = 365
+
+// HoldingPeriod describes how long a position has been held.
+type HoldingPeriod struct {
+	StockID     uint       `json:"stock_id"`
+	Ticker      string     `json:"ticker"`
+	CompanyName string     `json:"company_name"`
+	SharesOwned int        `json:"shares_owned"`
+	PurchasedAt *time.Time `json:"purchased_at"`
+	HeldDays    *int       `json:"held_days"` // nil when purchase date is unknown
+	LongTerm    bool       `json:"long_term"`
+	NeedsReview bool       `json:"needs_review"`
+	LastUpdated time.Time  `json:"last_updated"`
+}
+
+// GetHoldingPeriods returns the age of each owned position and flags those held beyond the review interval.
+// Positions without PurchasedAt fall back to the earliest Buy operation for the ticker.
+func (h *PortfolioHandler) GetHoldingPeriods(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	reviewDays := defaultReviewIntervalDays
+	var settings models.PortfolioSettings
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err == nil && settings.ReviewIntervalDays > 0 {
+		reviewDays = settings.ReviewIntervalDays
+	}
+	if reviewParam := c.Query("review_days"); reviewParam != "" {
+		parsed, err := strconv.Atoi(reviewParam)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review_days"})
+			return
+		}
+		reviewDays = parsed
+	}
+
+	var stocks []models.Stock
+	if err := h.db.Where("portfolio_id = ? AND shares_owned > 0", portfolioID).Order("ticker ASC").Find(&stocks).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
+		return
+	}
+
+	var buys []models.Operation
+	if err := h.db.Where("portfolio_id = ? AND operation_type = ?", portfolioID, "Buy").Find(&buys).Error; err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to fetch buy operations for holding periods")
+	}
+	firstBuy := make(map[string]time.Time)
+	for _, op := range buys {
+		t, err := services.ParseTradeDate(op.TradeDate)
+		if err != nil {
+			continue
+		}
+		if existing, ok := firstBuy[op.Ticker]; !ok || t.Before(existing) {
+			firstBuy[op.Ticker] = t
+		}
+	}
+
+	periods, needsReview := buildHoldingPeriods(stocks, firstBuy, reviewDays, time.Now())
+
+	c.JSON(http.StatusOK, gin.H{
+		"positions":            periods,
+		"review_interval_days": reviewDays,
+		"needs_review_count":   needsReview,
+	})
+}
+
+// buildHoldingPeriods computes position ages as of now.
+func buildHoldingPeriods(stocks []models.Stock, firstBuy map[string]time.Time, reviewDays int, now time.Time) ([]HoldingPeriod, int) {
+	periods := make([]HoldingPeriod, 0, len(stocks))
+	needsReview := 0
+	for _, stock := range stocks {
+		period := HoldingPeriod{
+			StockID:     stock.ID,
+			Ticker:      stock.Ticker,
+			CompanyName: stock.CompanyName,
+			SharesOwned: stock.SharesOwned,
+			PurchasedAt: stock.PurchasedAt,
+			LastUpdated: stock.LastUpdated,
+		}
+		if period.PurchasedAt == nil {
+			if t, ok := firstBuy[stock.Ticker]; ok {
+				period.PurchasedAt = &t
+			}
+		}
+		if period.PurchasedAt != nil {
+			days := int(now.Sub(*period.PurchasedAt).Hours() / 24)
+			if days < 0 {
+				days = 0
+			}
+			period.HeldDays = &days
+			period.LongTerm = days >= longTermHoldingDays
+			period.NeedsReview = days > reviewDays
+			if period.NeedsReview {
+				needsReview++
+			}
+		}
+		periods = append(periods, period)
+	}
+	return periods, needsReview
+}
+
+// BenchmarkPoint is one day of the portfolio vs benchmark series; returns are % since the start of the range.
+type BenchmarkPoint struct {
+	Date               string  `json:"date"`
+	PortfolioValueEUR  float64 `json:"portfolio_value_eur"`
+	BenchmarkPrice     float64 `json:"benchmark_price"`
+	PortfolioReturnPct float64 `json:"portfolio_return_pct"`
+	BenchmarkReturnPct float64 `json:"benchmark_return_pct"`
+	RelativeReturnPct  float64 `json:"relative_return_pct"` // portfolio minus benchmark, in percentage points
+}
+
+// GetVsBenchmark returns portfolio value vs a benchmark index, both normalized to % return from the start of the range.
+// Only days with both a portfolio and a benchmark snapshot are included; the last snapshot of each day is used.
+func (h *PortfolioHandler) GetVsBenchmark(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	from, to, err := parseDateRange(c, 365)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	benchmark := strings.ToUpper(strings.TrimSpace(c.Query("benchmark")))
+	if benchmark == "" {
+		if len(h.cfg.BenchmarkSymbols) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "benchmark is required (no BENCHMARK_SYMBOLS configured)"})
+			return
+		}
+		benchmark = h.cfg.BenchmarkSymbols[0]
+	}
+
+	end := to.AddDate(0, 0, 1)
+	var portfolioSnaps []models.PortfolioSnapshot
+	if err := h.db.Where("portfolio_id = ? AND recorded_at >= ? AND recorded_at < ?", portfolioID, from, end).
+		Order("recorded_at ASC").Find(&portfolioSnaps).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch portfolio snapshots")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolio snapshots"})
+		return
+	}
+
+	var benchmarkSnaps []models.BenchmarkSnapshot
+	if err := h.db.Where("symbol = ? AND recorded_at >= ? AND recorded_at < ?", benchmark, from, end).
+		Order("recorded_at ASC").Find(&benchmarkSnaps).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch benchmark snapshots")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch benchmark snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"benchmark": benchmark,
+		"from":      from.Format("2006-01-02"),
+		"to":        to.Format("2006-01-02"),
+		"points":    buildBenchmarkSeries(portfolioSnaps, benchmarkSnaps),
+	})
+}
+
+// GetPortfolioHistory returns the portfolio's daily snapshots (positions and cash in EUR, overall EV,
+// Sharpe ratio, Kelly utilization and cash %) between from and to (YYYY-MM-DD, default the last 365
+// days), oldest first.
+func (h *PortfolioHandler) GetPortfolioHistory(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	from, to, err := parseDateRange(c, 365)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshots := []models.PortfolioSnapshot{}
+	if err := h.db.Where("portfolio_id = ? AND recorded_at >= ? AND recorded_at < ?", portfolioID, from, to.AddDate(0, 0, 1)).
+		Order("recorded_at ASC").Find(&snapshots).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch portfolio snapshots")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolio snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":      from.Format("2006-01-02"),
+		"to":        to.Format("2006-01-02"),
+		"snapshots": snapshots,
+	})
+}
+
+// GetTimeWeightedReturn returns the time-weighted return between from and to (YYYY-MM-DD, default
+// last 365 days) over daily snapshots (positions + cash), linking sub-periods split at deposits and
+// withdrawals so external cash flows do not count as performance.
+func (h *PortfolioHandler) GetTimeWeightedReturn(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	from, to, err := parseDateRange(c, 365)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	points, flows, ok := h.loadReturnSeries(c, portfolioID, from, to)
+	if !ok {
+		return
+	}
+
+	result := services.TimeWeightedReturn(points, flows)
+	result.From, result.To = from.Format("2006-01-02"), to.Format("2006-01-02")
+	c.JSON(http.StatusOK, result)
+}
+
+// GetMoneyWeightedReturn returns the annualized money-weighted return (XIRR) between from and to
+// (YYYY-MM-DD, default the last 365 days): the first snapshot's value and deposits count as money
+// put in, withdrawals and the last snapshot's value as money taken out. When no rate solves the flows
+// irr_pct is null and status says why.
+func (h *PortfolioHandler) GetMoneyWeightedReturn(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	from, to, err := parseDateRange(c, 365)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	points, flows, ok := h.loadReturnSeries(c, portfolioID, from, to)
+	if !ok {
+		return
+	}
+
+	result := services.MoneyWeightedReturn(points, flows)
+	result.From, result.To = from.Format("2006-01-02"), to.Format("2006-01-02")
+	c.JSON(http.StatusOK, result)
+}
+
+// loadReturnSeries loads the daily portfolio values (positions + cash) between from and to and the
+// portfolio's external cash flows in EUR. On failure it writes the error response and returns false.
+func (h *PortfolioHandler) loadReturnSeries(c *gin.Context, portfolioID uint, from, to time.Time) ([]services.TWRValuePoint, []services.TWRCashFlow, bool) {
+	var snapshots []models.PortfolioSnapshot
+	if err := h.db.Where("portfolio_id = ? AND recorded_at >= ? AND recorded_at < ?", portfolioID, from, to.AddDate(0, 0, 1)).
+		Order("recorded_at ASC").Find(&snapshots).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch portfolio snapshots")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch portfolio snapshots"})
+		return nil, nil, false
+	}
+	var operations []models.Operation
+	if err := h.db.Where("portfolio_id = ? AND operation_type IN ?", portfolioID, []string{"Deposit", "Withdraw"}).
+		Find(&operations).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch cash operations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash operations"})
+		return nil, nil, false
+	}
+	fxRates, err := h.exchangeRateService.GetRatesMap()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
+		return nil, nil, false
+	}
+
+	// Snapshots are end-of-day, so each is dated by its UTC day; a flow on that day falls before it.
+	points := make([]services.TWRValuePoint, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		day := snapshot.RecordedAt.UTC()
+		points = append(points, services.TWRValuePoint{
+			Date:     time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
+			ValueEUR: snapshot.TotalValueEUR + snapshot.CashEUR,
+		})
+	}
+
+	return points, services.ExternalCashFlows(operations, fxRates), true
+}
+
+// buildBenchmarkSeries aligns portfolio and benchmark snapshots (both sorted ascending) by calendar day
+// and normalizes each to % return from the first common day.
+func buildBenchmarkSeries(portfolioSnaps []models.PortfolioSnapshot, benchmarkSnaps []models.BenchmarkSnapshot) []BenchmarkPoint {
+	benchmarkByDay := make(map[string]float64, len(benchmarkSnaps))
+	for _, snap := range benchmarkSnaps {
+		benchmarkByDay[snap.RecordedAt.UTC().Format("2006-01-02")] = snap.Price
+	}
+
+	// Last portfolio snapshot per day, in day order
+	var days []string
+	portfolioByDay := make(map[string]float64, len(portfolioSnaps))
+	for _, snap := range portfolioSnaps {
+		day := snap.RecordedAt.UTC().Format("2006-01-02")
+		if _, seen := portfolioByDay[day]; !seen {
+			days = append(days, day)
+		}
+		portfolioByDay[day] = snap.TotalValueEUR
+	}
+
+	points := make([]BenchmarkPoint, 0, len(days))
+	var baseValue, basePrice float64
+	for _, day := range days {
+		price, ok := benchmarkByDay[day]
+		value := portfolioByDay[day]
+		if !ok || price <= 0 || value <= 0 {
+			continue
+		}
+		if baseValue == 0 {
+			baseValue = value
+			basePrice = price
+		}
+		portfolioReturn := (value/baseValue - 1) * 100
+		benchmarkReturn := (price/basePrice - 1) * 100
+		points = append(points, BenchmarkPoint{
+			Date:               day,
+			PortfolioValueEUR:  value,
+			BenchmarkPrice:     price,
+			PortfolioReturnPct: portfolioReturn,
+			BenchmarkReturnPct: benchmarkReturn,
+			RelativeReturnPct:  portfolioReturn - benchmarkReturn,
+		})
+	}
+	return points
+}
+
+// GetRebalancePlan returns executable trades that move positions toward their ½-Kelly weights.
+// Query min_trade_eur and whole_shares override the portfolio settings for this request.
+func (h *PortfolioHandler) GetRebalancePlan(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	settings := models.PortfolioSettings{MinCashBufferPct: services.DefaultMinCashBufferPct}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	opts := services.RebalanceOptions{
+		MinTradeValueEUR:  settings.MinTradeValueEUR,
+		WholeShares:       settings.WholeSharesOnly,
+		MaxPositionWeight: services.MetricsConfigFromSettings(&settings).KellyCap,
+		MinCashBufferPct:  settings.MinCashBufferPct,
+		MaxCashBufferPct:  services.DefaultMaxCashBufferPct,
+	}
+	if minParam := c.Query("min_trade_eur"); minParam != "" {
+		parsed, err := strconv.ParseFloat(minParam, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_trade_eur"})
+			return
+		}
+		opts.MinTradeValueEUR = parsed
+	}
+	if wholeParam := c.Query("whole_shares"); wholeParam != "" {
+		parsed, err := strconv.ParseBool(wholeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid whole_shares"})
+			return
+		}
+		opts.WholeShares = parsed
+	}
+
+	stocks, fxRates, cashEUR, ok := h.loadRebalanceInputs(c, portfolioID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.BuildRebalancePlan(stocks, fxRates, cashEUR, opts))
+}
+
+// GetRebalanceRecommendation returns the full move from current to ½-Kelly target weights: the
+// rebalance plan without share rounding or a minimum trade value, its cash checked against the
+// 8–12% buffer band.
+func (h *PortfolioHandler) GetRebalanceRecommendation(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	settings := models.PortfolioSettings{MinCashBufferPct: services.DefaultMinCashBufferPct}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	opts := services.RebalanceOptions{
+		MaxPositionWeight: services.MetricsConfigFromSettings(&settings).KellyCap,
+		MinCashBufferPct:  settings.MinCashBufferPct,
+		MaxCashBufferPct:  services.DefaultMaxCashBufferPct,
+	}
+
+	stocks, fxRates, cashEUR, ok := h.loadRebalanceInputs(c, portfolioID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.BuildRebalancePlan(stocks, fxRates, cashEUR, opts))
+}
+
+// GetKellyUtilizationRecommendation suggests proportional trims or adds that bring Kelly utilization
+// (invested value / positions + cash) into the portfolio's target band.
+func (h *PortfolioHandler) GetKellyUtilizationRecommendation(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	settings := models.PortfolioSettings{
+		KellyUtilizationMin: services.DefaultKellyUtilizationMin,
+		KellyUtilizationMax: services.DefaultKellyUtilizationMax,
+		MinCashBufferPct:    services.DefaultMinCashBufferPct,
+	}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	opts := services.KellyUtilizationOptions{
+		Min:               settings.KellyUtilizationMin,
+		Max:               settings.KellyUtilizationMax,
+		MaxPositionWeight: services.MetricsConfigFromSettings(&settings).KellyCap,
+		Rebalance: services.RebalanceOptions{
+			MinTradeValueEUR: settings.MinTradeValueEUR,
+			WholeShares:      settings.WholeSharesOnly,
+			MinCashBufferPct: settings.MinCashBufferPct,
+			MaxCashBufferPct: services.DefaultMaxCashBufferPct,
+		},
+	}
+	if opts.Min <= 0 || opts.Max > 1 || opts.Min >= opts.Max {
+		opts.Min, opts.Max = services.DefaultKellyUtilizationMin, services.DefaultKellyUtilizationMax
+	}
+
+	stocks, fxRates, cashEUR, ok := h.loadRebalanceInputs(c, portfolioID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, services.RecommendKellyUtilization(stocks, fxRates, cashEUR, opts))
+}
+
+// GetPortfolioHealth runs portfolio-level checks: the soft cap on the number of positions and the cash buffer.
+func (h *PortfolioHandler) GetPortfolioHealth(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	settings := models.PortfolioSettings{
+		MaxPositions:        services.DefaultMaxPositions,
+		MinCashBufferPct:    services.DefaultMinCashBufferPct,
+		MaxCorrelatedWeight: services.DefaultMaxCorrelatedWeight,
+	}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+
+	stocks, fxRates, cashEUR, ok := h.loadRebalanceInputs(c, portfolioID)
+	if !ok {
+		return
+	}
+
+	metricsCfg := services.PortfolioMetricsConfig(h.db, portfolioID)
+	c.JSON(http.StatusOK, services.CheckPortfolioHealth(stocks, fxRates, services.HealthOptions{
+		MaxPositions:        settings.MaxPositions,
+		CashEUR:             cashEUR,
+		MinCashBufferPct:    settings.MinCashBufferPct,
+		MinRatioPositions:   metricsCfg.MinRatioPositions,
+		MaxCorrelatedWeight: settings.MaxCorrelatedWeight,
+		Correlations:        services.CorrelationMatrix{Default: metricsCfg.AssumedCorrelation},
+	}))
+}
+
+// loadRebalanceInputs loads a portfolio's stocks (with fresh metrics), FX rates and EUR cash total.
+// On failure it writes the error response and returns ok=false.
+func (h *PortfolioHandler) loadRebalanceInputs(c *gin.Context, portfolioID uint) ([]models.Stock, map[string]float64, float64, bool) {
+	var stocks []models.Stock
+	if err := h.db.Where("portfolio_id = ?", portfolioID).Find(&stocks).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
+		return nil, nil, 0, false
+	}
+	var cashHoldings []models.CashHolding
+	if err := h.db.Where("portfolio_id = ?", portfolioID).Find(&cashHoldings).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch cash holdings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash holdings"})
+		return nil, nil, 0, false
+	}
+
+	fxRates, err := h.exchangeRateService.GetRatesMap()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
+		return nil, nil, 0, false
+	}
+
+	cashEUR := 0.0
+	for _, holding := range cashHoldings {
+		if rate := fxRates[holding.CurrencyCode]; rate > 0 {
+			cashEUR += holding.Amount / rate
+		}
+	}
+
+	metricsConfig := services.PortfolioMetricsConfig(h.db, portfolioID)
+	for i := range stocks {
+		services.CalculateMetrics(&stocks[i], metricsConfig)
+	}
+	return stocks, fxRates, cashEUR, true
+}
+
+// defaultMaxCurrencyExposure is the per-currency cap (% of total) used when settings have none.
+const defaultMaxCurrencyExposure = 50.0
+
+// CurrencyExposure is the combined stock and cash exposure to a single currency, in the base currency.
+type CurrencyExposure struct {
+	Currency   string  `json:"currency"`
+	StockValue float64 `json:"stock_value"`
+	CashValue  float64 `json:"cash_value"`
+	TotalValue float64 `json:"total_value"`
+	Percent    float64 `json:"percent"`
+	OverCap    bool    `json:"over_cap"`
+}
+
+// GetCurrencyExposure returns exposure per currency across stock positions and cash holdings.
+// Query base (default: the portfolio's base currency) selects the reporting currency; cap overrides
+// settings.max_currency_exposure.
+func (h *PortfolioHandler) GetCurrencyExposure(c *gin.Context) {
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	var settings models.PortfolioSettings
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	capPct := settings.MaxCurrencyExposure
+	if capPct <= 0 {
+		capPct = defaultMaxCurrencyExposure
+	}
+	if capParam := c.Query("cap"); capParam != "" {
+		parsed, err := strconv.ParseFloat(capParam, 64)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cap must be between 0 and 100"})
+			return
+		}
+		capPct = parsed
+	}
+
+	base := strings.ToUpper(strings.TrimSpace(c.Query("base")))
+	if base == "" {
+		base = database.PortfolioBaseCurrency(h.db, portfolioID)
+	}
+
+	fxRates, err := h.exchangeRateService.GetRatesMap()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+	if base != "EUR" && fxRates[base] <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown base currency: " + base})
+		return
+	}
+
+	var stocks []models.Stock
+	if err := h.db.Where("portfolio_id = ? AND shares_owned > 0", portfolioID).Find(&stocks).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
+		return
+	}
+	var cashHoldings []models.CashHolding
+	if err := h.db.Where("portfolio_id = ?", portfolioID).Find(&cashHoldings).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch cash holdings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash holdings"})
+		return
+	}
+
+	exposures, total, missing := buildCurrencyExposure(stocks, cashHoldings, fxRates, base, capPct)
+
+	c.Header("Cache-Control", "private, max-age=30, stale-while-revalidate=60")
+	c.JSON(http.StatusOK, gin.H{
+		"base":          base,
+		"cap_percent":   capPct,
+		"total_value":   total,
+		"exposures":     exposures,
+		"missing_rates": missing,
+	})
+}
+
+// buildCurrencyExposure sums stock and cash values per currency, converted to base via EUR.
+// Currencies without an exchange rate are excluded and returned separately. Result is sorted by exposure descending.
+func buildCurrencyExposure(stocks []models.Stock, cashHoldings []models.CashHolding, fxRates map[string]float64, base string, capPct float64) ([]CurrencyExposure, float64, []string) {
+	baseRate := 1.0
+	if base != "EUR" {
+		baseRate = fxRates[base]
+	}
+	rateFor := func(currency string) float64 {
+		if currency == "EUR" {
+			return 1
+		}
+		return fxRates[currency]
+	}
+
+	byCurrency := make(map[string]*CurrencyExposure)
+	missingSet := make(map[string]struct{})
+	entry := func(currency string) *CurrencyExposure {
+		if e, ok := byCurrency[currency]; ok {
+			return e
+		}
+		e := &CurrencyExposure{Currency: currency}
+		byCurrency[currency] = e
+		return e
+	}
+
+	for _, stock := range stocks {
+		if stock.SharesOwned <= 0 {
+			continue
+		}
+		rate := rateFor(stock.Currency)
+		if rate <= 0 {
+			missingSet[stock.Currency] = struct{}{}
+			continue
+		}
+		entry(stock.Currency).StockValue += float64(stock.SharesOwned) * stock.CurrentPrice / rate * baseRate
+	}
+	for _, holding := range cashHoldings {
+		rate := rateFor(holding.CurrencyCode)
+		if rate <= 0 {
+			missingSet[holding.CurrencyCode] = struct{}{}
+			continue
+		}
+		entry(holding.CurrencyCode).CashValue += holding.Amount / rate * baseRate
+	}
+
+	total := 0.0
+	exposures := make([]CurrencyExposure, 0, len(byCurrency))
+	for _, e := range byCurrency {
+		e.TotalValue = e.StockValue + e.CashValue
+		total += e.TotalValue
+		exposures = append(exposures, *e)
+	}
+	for i := range exposures {
+		if total > 0 {
+			exposures[i].Percent = exposures[i].TotalValue / total * 100
+		}
+		exposures[i].OverCap = exposures[i].Percent > capPct
+	}
+	sort.Slice(exposures, func(i, j int) bool {
+		if exposures[i].TotalValue != exposures[j].TotalValue {
+			return exposures[i].TotalValue > exposures[j].TotalValue
+		}
+		return exposures[i].Currency < exposures[j].Currency
+	})
+
+	missing := make([]string, 0, len(missingSet))
+	for currency := range missingSet {
+		missing = append(missing, currency)
+	}
+	sort.Strings(missing)
+
+	return exposures, total, missing
+}
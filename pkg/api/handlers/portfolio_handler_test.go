@@ -0,0 +1,1013 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestMain keeps tests offline: the summary's rate refresh would otherwise fall back to the live
+// frankfurter.app provider, since no exchange rate API key is set.
+func TestMain(m *testing.M) {
+	os.Setenv("EXCHANGE_RATES_FALLBACK_PROVIDER", "none")
+	os.Exit(m.Run())
+}
+
+func setupPortfolioHandlerTest(t *testing.T) (*gorm.DB, *PortfolioHandler, uint) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dbPath := filepath.Join(t.TempDir(), "portfolio-handler-test.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.PortfolioSettings{}, &models.Operation{}, &models.ExchangeRate{}, &models.PortfolioSnapshot{}, &models.BenchmarkSnapshot{}, &models.CashHolding{}, &models.FairValueHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	h := NewPortfolioHandler(db, &config.Config{}, zerolog.Nop())
+	return db, h, portfolio.ID
+}
+
+func TestGetHoldingPeriods(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	now := time.Now()
+	oldPurchase := now.AddDate(0, 0, -400)
+	recentPurchase := now.AddDate(0, 0, -30)
+	stocks := []models.Stock{
+		{PortfolioID: portfolioID, Ticker: "OLD", CompanyName: "Old Co", SharesOwned: 10, PurchasedAt: &oldPurchase},
+		{PortfolioID: portfolioID, Ticker: "NEW", CompanyName: "New Co", SharesOwned: 5, PurchasedAt: &recentPurchase},
+		{PortfolioID: portfolioID, Ticker: "OPS", CompanyName: "Ops Co", SharesOwned: 3},
+		{PortfolioID: portfolioID, Ticker: "GONE", CompanyName: "Sold Co", SharesOwned: 0, PurchasedAt: &oldPurchase},
+	}
+	for i := range stocks {
+		if err := db.Create(&stocks[i]).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+	// OPS has no PurchasedAt; the earliest Buy operation is used instead.
+	opsBuy := now.AddDate(0, 0, -120).Format("02.01.2006")
+	if err := db.Create(&models.Operation{PortfolioID: portfolioID, OperationType: "Buy", Ticker: "OPS", Currency: "USD", Quantity: 3, Price: 10, TradeDate: opsBuy}).Error; err != nil {
+		t.Fatalf("create operation: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/holding-periods", nil)
+
+	h.GetHoldingPeriods(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Positions          []HoldingPeriod `json:"positions"`
+		ReviewIntervalDays int             `json:"review_interval_days"`
+		NeedsReviewCount   int             `json:"needs_review_count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.ReviewIntervalDays != defaultReviewIntervalDays {
+		t.Errorf("review_interval_days: got %d want %d", out.ReviewIntervalDays, defaultReviewIntervalDays)
+	}
+	if len(out.Positions) != 3 {
+		t.Fatalf("positions: got %d want 3 (zero-share positions excluded)", len(out.Positions))
+	}
+
+	byTicker := make(map[string]HoldingPeriod)
+	for _, p := range out.Positions {
+		byTicker[p.Ticker] = p
+	}
+	cases := []struct {
+		ticker      string
+		wantDays    int
+		longTerm    bool
+		needsReview bool
+	}{
+		{"OLD", 400, true, true},
+		{"NEW", 30, false, false},
+		{"OPS", 120, false, true},
+	}
+	for _, tc := range cases {
+		p := byTicker[tc.ticker]
+		if p.HeldDays == nil {
+			t.Fatalf("%s: held_days is nil", tc.ticker)
+		}
+		if diff := *p.HeldDays - tc.wantDays; diff < -1 || diff > 1 {
+			t.Errorf("%s held_days: got %d want ~%d", tc.ticker, *p.HeldDays, tc.wantDays)
+		}
+		if p.LongTerm != tc.longTerm {
+			t.Errorf("%s long_term: got %v want %v", tc.ticker, p.LongTerm, tc.longTerm)
+		}
+		if p.NeedsReview != tc.needsReview {
+			t.Errorf("%s needs_review: got %v want %v", tc.ticker, p.NeedsReview, tc.needsReview)
+		}
+	}
+	if out.NeedsReviewCount != 2 {
+		t.Errorf("needs_review_count: got %d want 2", out.NeedsReviewCount)
+	}
+}
+
+func TestGetHoldingPeriods_ReviewIntervalOverride(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	purchased := time.Now().AddDate(0, 0, -45)
+	if err := db.Create(&models.Stock{PortfolioID: portfolioID, Ticker: "MID", CompanyName: "Mid Co", SharesOwned: 1, PurchasedAt: &purchased}).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolioID, ReviewIntervalDays: 30}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/holding-periods", nil)
+
+	h.GetHoldingPeriods(c)
+
+	var out struct {
+		ReviewIntervalDays int `json:"review_interval_days"`
+		NeedsReviewCount   int `json:"needs_review_count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.ReviewIntervalDays != 30 || out.NeedsReviewCount != 1 {
+		t.Errorf("got review_interval_days=%d needs_review_count=%d, want 30 and 1", out.ReviewIntervalDays, out.NeedsReviewCount)
+	}
+}
+
+func TestGetVsBenchmark(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	day1 := time.Date(2026, 3, 2, 21, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	snaps := []models.PortfolioSnapshot{
+		{PortfolioID: portfolioID, TotalValueEUR: 10000, RecordedAt: day1},
+		{PortfolioID: portfolioID, TotalValueEUR: 11000, RecordedAt: day2},
+	}
+	for i := range snaps {
+		if err := db.Create(&snaps[i]).Error; err != nil {
+			t.Fatalf("create portfolio snapshot: %v", err)
+		}
+	}
+	benchmarks := []models.BenchmarkSnapshot{
+		{Symbol: "SPX", Price: 5000, RecordedAt: day1},
+		{Symbol: "SPX", Price: 5250, RecordedAt: day2},
+		{Symbol: "URTH", Price: 100, RecordedAt: day2},
+	}
+	for i := range benchmarks {
+		if err := db.Create(&benchmarks[i]).Error; err != nil {
+			t.Fatalf("create benchmark snapshot: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/vs-benchmark?from=2026-03-01&to=2026-03-05&benchmark=spx", nil)
+
+	h.GetVsBenchmark(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Benchmark string           `json:"benchmark"`
+		Points    []BenchmarkPoint `json:"points"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Benchmark != "SPX" {
+		t.Errorf("benchmark: got %q want SPX", out.Benchmark)
+	}
+	if len(out.Points) != 2 {
+		t.Fatalf("points: got %d want 2", len(out.Points))
+	}
+	first, last := out.Points[0], out.Points[1]
+	if first.PortfolioReturnPct != 0 || first.BenchmarkReturnPct != 0 {
+		t.Errorf("first point should be the 0%% baseline, got %+v", first)
+	}
+	// Portfolio +10%, benchmark +5% -> +5 points relative
+	if math.Abs(last.PortfolioReturnPct-10) > 1e-9 {
+		t.Errorf("portfolio return: got %.4f want 10", last.PortfolioReturnPct)
+	}
+	if math.Abs(last.BenchmarkReturnPct-5) > 1e-9 {
+		t.Errorf("benchmark return: got %.4f want 5", last.BenchmarkReturnPct)
+	}
+	if math.Abs(last.RelativeReturnPct-5) > 1e-9 {
+		t.Errorf("relative return: got %.4f want 5", last.RelativeReturnPct)
+	}
+}
+
+func TestGetTimeWeightedReturnExcludesDeposit(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	if err := db.Create(&models.ExchangeRate{CurrencyCode: "EUR", Rate: 1, IsActive: true}).Error; err != nil {
+		t.Fatalf("create rate: %v", err)
+	}
+	// Positions gain 10% on each day; the 1,000 EUR deposit on day 3 lands in cash.
+	day1 := time.Date(2026, 3, 2, 21, 0, 0, 0, time.UTC)
+	snaps := []models.PortfolioSnapshot{
+		{PortfolioID: portfolioID, TotalValueEUR: 800, CashEUR: 200, RecordedAt: day1},
+		{PortfolioID: portfolioID, TotalValueEUR: 880, CashEUR: 200, RecordedAt: day1.AddDate(0, 0, 1)},
+		{PortfolioID: portfolioID, TotalValueEUR: 968, CashEUR: 1200, RecordedAt: day1.AddDate(0, 0, 2)},
+	}
+	for i := range snaps {
+		if err := db.Create(&snaps[i]).Error; err != nil {
+			t.Fatalf("create portfolio snapshot: %v", err)
+		}
+	}
+	deposit := models.Operation{PortfolioID: portfolioID, OperationType: "Deposit", Currency: "EUR", Amount: 1000, TradeDate: "04.03.2026"}
+	if err := db.Create(&deposit).Error; err != nil {
+		t.Fatalf("create deposit: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/twr?from=2026-03-01&to=2026-03-05", nil)
+
+	h.GetTimeWeightedReturn(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out services.TWRResult
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// Value goes 1,000 -> 1,080 (+8%); the deposit lifts it to 2,080, which ends the day at 2,168.
+	want := (1080.0/1000.0*2168.0/2080.0 - 1) * 100
+	if out.TWRPct == nil || math.Abs(*out.TWRPct-want) > 1e-9 {
+		t.Fatalf("twr_pct: got %v want %.6f", out.TWRPct, want)
+	}
+	if len(out.SubPeriods) != 2 || out.NetFlowsEUR != 1000 {
+		t.Errorf("expected 2 sub-periods and 1,000 EUR of flows, got %+v", out)
+	}
+}
+
+func TestGetCurrencyExposure(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true},
+		{CurrencyCode: "DKK", Rate: 7.5, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	stocks := []models.Stock{
+		{PortfolioID: portfolioID, Ticker: "AAPL", Currency: "USD", CurrentPrice: 250, SharesOwned: 20}, // 5,000 USD = 4,000 EUR
+		{PortfolioID: portfolioID, Ticker: "NOVO", Currency: "DKK", CurrentPrice: 750, SharesOwned: 10}, // 7,500 DKK = 1,000 EUR
+		{PortfolioID: portfolioID, Ticker: "SAP", Currency: "EUR", CurrentPrice: 200, SharesOwned: 5},   // 1,000 EUR
+		{PortfolioID: portfolioID, Ticker: "SOLD", Currency: "USD", CurrentPrice: 100, SharesOwned: 0},  // ignored
+		{PortfolioID: portfolioID, Ticker: "CHFX", Currency: "CHF", CurrentPrice: 100, SharesOwned: 1},  // no rate
+	}
+	for i := range stocks {
+		if err := db.Create(&stocks[i]).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+	for _, holding := range []models.CashHolding{
+		{PortfolioID: portfolioID, CurrencyCode: "USD", Amount: 1250}, // 1,000 EUR
+		{PortfolioID: portfolioID, CurrencyCode: "EUR", Amount: 3000},
+	} {
+		if err := db.Create(&holding).Error; err != nil {
+			t.Fatalf("create cash: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/currency-exposure?base=USD&cap=45", nil)
+
+	h.GetCurrencyExposure(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Base         string             `json:"base"`
+		TotalValue   float64            `json:"total_value"`
+		Exposures    []CurrencyExposure `json:"exposures"`
+		MissingRates []string           `json:"missing_rates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Base != "USD" {
+		t.Errorf("base: got %s want USD", out.Base)
+	}
+	// 10,000 EUR total = 12,500 USD
+	if math.Abs(out.TotalValue-12500) > 0.01 {
+		t.Errorf("total_value: got %.2f want 12500", out.TotalValue)
+	}
+	if len(out.MissingRates) != 1 || out.MissingRates[0] != "CHF" {
+		t.Errorf("missing_rates: got %v want [CHF]", out.MissingRates)
+	}
+
+	want := map[string]struct {
+		stock, cash, pct float64
+		overCap          bool
+	}{
+		"USD": {stock: 5000, cash: 1250, pct: 50, overCap: true},
+		"EUR": {stock: 1250, cash: 3750, pct: 40},
+		"DKK": {stock: 1250, cash: 0, pct: 10},
+	}
+	if len(out.Exposures) != len(want) {
+		t.Fatalf("expected %d exposures, got %+v", len(want), out.Exposures)
+	}
+	if out.Exposures[0].Currency != "USD" {
+		t.Errorf("expected largest exposure first, got %s", out.Exposures[0].Currency)
+	}
+	for _, e := range out.Exposures {
+		exp := want[e.Currency]
+		if math.Abs(e.StockValue-exp.stock) > 0.01 || math.Abs(e.CashValue-exp.cash) > 0.01 {
+			t.Errorf("%s: got stock %.2f cash %.2f want %.2f / %.2f", e.Currency, e.StockValue, e.CashValue, exp.stock, exp.cash)
+		}
+		if math.Abs(e.Percent-exp.pct) > 0.0001 {
+			t.Errorf("%s: percent got %.4f want %.4f", e.Currency, e.Percent, exp.pct)
+		}
+		if e.OverCap != exp.overCap {
+			t.Errorf("%s: over_cap got %v want %v", e.Currency, e.OverCap, exp.overCap)
+		}
+	}
+}
+
+func TestUpdateSettingsAddThresholdRecomputesAssessments(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	// EV = 0.65*20% + 0.35*(-20%) = 6%: Hold under the default 7% Add threshold.
+	stock := models.Stock{PortfolioID: portfolioID, Ticker: "EDGE", CompanyName: "Edge Co", CurrentPrice: 100, FairValue: 120}
+	services.CalculateMetrics(&stock, services.DefaultMetricsConfig())
+	if stock.Assessment != "Hold" {
+		t.Fatalf("precondition: got %s want Hold", stock.Assessment)
+	}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/portfolio/settings", strings.NewReader(`{"ev_add_threshold": 5}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	h.UpdateSettings(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.Assessment != "Add" {
+		t.Errorf("assessment after threshold change: got %s want Add", saved.Assessment)
+	}
+	if got := services.PortfolioMetricsConfig(db, portfolioID).AddThreshold; got != 5 {
+		t.Errorf("portfolio Add threshold: got %.2f want 5", got)
+	}
+	if got := services.PortfolioMetricsConfig(db, portfolioID+1).AddThreshold; got != services.DefaultMetricsConfig().AddThreshold {
+		t.Errorf("other portfolio Add threshold: got %.2f want the default", got)
+	}
+}
+
+func TestGetPortfolioSummaryFlagsStaleRates(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+	h.cfg.FXRatesMaxAgeHours = 48
+	h.cfg.FXStaleSkipPersist = true
+
+	monthOld := time.Now().AddDate(0, 0, -30)
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: monthOld},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true, IsManual: true, LastUpdated: monthOld},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	stock := models.Stock{PortfolioID: portfolioID, Ticker: "AAPL", CompanyName: "Apple", Currency: "USD", CurrentPrice: 250, SharesOwned: 20}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+
+	h.GetPortfolioSummary(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Summary struct {
+			TotalValue    float64 `json:"total_value"`
+			RatesStale    bool    `json:"rates_stale"`
+			RatesAgeHours float64 `json:"rates_age_hours"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !out.Summary.RatesStale {
+		t.Error("expected rates_stale for month-old rates")
+	}
+	if math.Abs(out.Summary.RatesAgeHours-30*24) > 1 {
+		t.Errorf("rates_age_hours: got %.2f want ~720", out.Summary.RatesAgeHours)
+	}
+	if math.Abs(out.Summary.TotalValue-4000) > 0.01 {
+		t.Errorf("total_value: got %.2f want 4000", out.Summary.TotalValue)
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.Weight != 0 {
+		t.Errorf("expected weight not persisted while rates are stale, got %.4f", saved.Weight)
+	}
+}
+
+func TestGetPortfolioSummaryAnonymousReadUsesStoredDataOnly(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+	providerCalls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		providerCalls++
+		fmt.Fprint(w, `{"base":"EUR","date":"2026-03-02","rates":{"USD":2}}`)
+	}))
+	defer server.Close()
+	h.exchangeRateService.SetProviders(services.NewFrankfurterProvider(server.URL, server.Client(), zerolog.Nop()))
+	h.metricsCache = services.NewMetricsCache(30 * time.Second)
+
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: time.Now()},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true, LastUpdated: time.Now()},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	stock := models.Stock{PortfolioID: portfolioID, Ticker: "AAPL", CompanyName: "Apple", Currency: "USD", CurrentPrice: 250, SharesOwned: 20}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+	c.Set("auth_method", "anonymous")
+	h.GetPortfolioSummary(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Summary struct {
+			TotalValue float64 `json:"total_value"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if math.Abs(out.Summary.TotalValue-4000) > 0.01 {
+		t.Errorf("total_value: got %.2f want 4000 at the stored USD rate", out.Summary.TotalValue)
+	}
+	if providerCalls != 0 {
+		t.Errorf("expected no exchange rate provider calls, got %d", providerCalls)
+	}
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.Weight != 0 {
+		t.Errorf("expected nothing persisted for an anonymous read, got weight %.4f", saved.Weight)
+	}
+	if _, cached := h.metricsCache.Get(portfolioID); cached {
+		t.Error("expected the anonymous summary not to be cached for signed-in callers")
+	}
+}
+
+func TestGetPortfolioSummaryReportsMultiCurrencyCostBasis(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: time.Now()},
+		{CurrencyCode: "USD", Rate: 1.5, IsActive: true, LastUpdated: time.Now()},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	if err := db.Create(&models.Stock{PortfolioID: portfolioID, Ticker: "NVO", CompanyName: "Novo", Currency: "USD", CurrentPrice: 120, SharesOwned: 20}).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	// 10 @ 110 USD at 1.10 (1,000 EUR) and 10 @ 90 EUR (900 EUR), each at its own FX-at-purchase.
+	for _, op := range []models.Operation{
+		{PortfolioID: portfolioID, OperationType: "Buy", Ticker: "NVO", Currency: "USD", FXRate: 1.10, Quantity: 10, Price: 110, TradeDate: "01.01.2024"},
+		{PortfolioID: portfolioID, OperationType: "Buy", Ticker: "NVO", Currency: "EUR", FXRate: 1, Quantity: 10, Price: 90, TradeDate: "01.02.2024"},
+	} {
+		if err := db.Create(&op).Error; err != nil {
+			t.Fatalf("create operation: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+	h.GetPortfolioSummary(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Stocks []models.Stock `json:"stocks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Stocks) != 1 || math.Abs(out.Stocks[0].CostBasisEUR-1900) > 0.01 {
+		t.Fatalf("cost_basis_eur: got %+v want 1900", out.Stocks)
+	}
+}
+
+func TestGetPortfolioSummaryServesCacheUntilStockUpdate(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+	clock := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	h.metricsCache = services.NewMetricsCache(30 * time.Second)
+	h.metricsCache.SetClock(func() time.Time { return clock })
+	if err := h.metricsCache.InvalidateOnWrites(db); err != nil {
+		t.Fatalf("register invalidation: %v", err)
+	}
+
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: time.Now()},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true, LastUpdated: time.Now()},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	stock := models.Stock{PortfolioID: portfolioID, Ticker: "AAPL", CompanyName: "Apple", Currency: "USD", CurrentPrice: 250, SharesOwned: 20}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	type summaryResponse struct {
+		Summary struct {
+			TotalValue float64 `json:"total_value"`
+		} `json:"summary"`
+		ComputedAt time.Time `json:"computed_at"`
+		Cached     bool      `json:"cached"`
+	}
+	fetch := func() summaryResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+		h.GetPortfolioSummary(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+		}
+		var out summaryResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out
+	}
+
+	first := fetch()
+	if first.Cached || !first.ComputedAt.Equal(clock) {
+		t.Fatalf("first call: cached=%v computed_at=%v, want fresh computation at %v", first.Cached, first.ComputedAt, clock)
+	}
+
+	// A raw write bypasses the model callbacks, so a recomputation would be visible in total_value.
+	if err := db.Exec("UPDATE stocks SET current_price = ? WHERE id = ?", 500, stock.ID).Error; err != nil {
+		t.Fatalf("raw update: %v", err)
+	}
+	clock = clock.Add(10 * time.Second)
+	second := fetch()
+	if !second.Cached || !second.ComputedAt.Equal(first.ComputedAt) {
+		t.Errorf("second call: cached=%v computed_at=%v, want cached entry from %v", second.Cached, second.ComputedAt, first.ComputedAt)
+	}
+	if math.Abs(second.Summary.TotalValue-4000) > 0.01 {
+		t.Errorf("second call total_value: got %.2f want cached 4000", second.Summary.TotalValue)
+	}
+
+	if err := db.Model(&stock).Update("current_price", 300).Error; err != nil {
+		t.Fatalf("update stock: %v", err)
+	}
+	third := fetch()
+	if third.Cached || !third.ComputedAt.Equal(clock) {
+		t.Errorf("after stock update: cached=%v computed_at=%v, want recomputation at %v", third.Cached, third.ComputedAt, clock)
+	}
+	if math.Abs(third.Summary.TotalValue-4800) > 0.01 {
+		t.Errorf("after stock update total_value: got %.2f want 4800", third.Summary.TotalValue)
+	}
+}
+
+func TestGetPortfolioHealthWarnsAboveMaxPositions(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	if err := db.Create(&models.ExchangeRate{CurrencyCode: "EUR", Rate: 1, IsActive: true}).Error; err != nil {
+		t.Fatalf("create rate: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolioID, MaxPositions: 3}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	stocks := []models.Stock{
+		{PortfolioID: portfolioID, Ticker: "BIG", Currency: "EUR", CurrentPrice: 100, SharesOwned: 50},
+		{PortfolioID: portfolioID, Ticker: "TINY", Currency: "EUR", CurrentPrice: 10, SharesOwned: 5},
+		{PortfolioID: portfolioID, Ticker: "MID", Currency: "EUR", CurrentPrice: 100, SharesOwned: 20},
+		{PortfolioID: portfolioID, Ticker: "SMALL", Currency: "EUR", CurrentPrice: 20, SharesOwned: 10},
+		{PortfolioID: portfolioID, Ticker: "LARGE", Currency: "EUR", CurrentPrice: 100, SharesOwned: 30},
+		{PortfolioID: portfolioID, Ticker: "SOLD", Currency: "EUR", CurrentPrice: 1, SharesOwned: 0}, // not a position
+	}
+	for i := range stocks {
+		if err := db.Create(&stocks[i]).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+	// Keep the cash buffer healthy so the position cap is the only warning.
+	if err := db.Create(&models.CashHolding{PortfolioID: portfolioID, CurrencyCode: "EUR", Amount: 2000}).Error; err != nil {
+		t.Fatalf("create cash: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/health", nil)
+
+	h.GetPortfolioHealth(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out services.PortfolioHealth
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Positions != 5 || out.MaxPositions != 3 {
+		t.Fatalf("positions/max: got %d/%d want 5/3", out.Positions, out.MaxPositions)
+	}
+	if len(out.Warnings) != 1 || out.Warnings[0].Code != services.HealthWarningTooManyPositions {
+		t.Fatalf("expected one too_many_positions warning, got %+v", out.Warnings)
+	}
+	smallest := out.Warnings[0].Positions
+	if len(smallest) != 2 || smallest[0].Ticker != "TINY" || smallest[1].Ticker != "SMALL" {
+		t.Fatalf("expected the 2 smallest positions [TINY SMALL], got %+v", smallest)
+	}
+	// 50 EUR of 10,250 EUR invested
+	if math.Abs(smallest[0].WeightPct-50.0/10250*100) > 0.0001 {
+		t.Errorf("TINY weight: got %.4f", smallest[0].WeightPct)
+	}
+}
+
+func TestGetPortfolioHealthNegativeCashReducesValueAndFlagsLeverage(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolioID, AllowNegativeCash: true, MinCashBufferPct: 8}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	if err := db.Create(&models.Stock{PortfolioID: portfolioID, Ticker: "SAP", Currency: "EUR", CurrentPrice: 100, SharesOwned: 100}).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	for _, holding := range []models.CashHolding{
+		{PortfolioID: portfolioID, CurrencyCode: "EUR", Amount: 500},
+		{PortfolioID: portfolioID, CurrencyCode: "USD", Amount: -2500}, // -2,000 EUR on margin
+	} {
+		if err := db.Create(&holding).Error; err != nil {
+			t.Fatalf("create cash: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/health", nil)
+
+	h.GetPortfolioHealth(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out services.PortfolioHealth
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if math.Abs(out.CashEUR-(-1500)) > 0.01 || math.Abs(out.TotalValueEUR-8500) > 0.01 {
+		t.Fatalf("cash/total: got %.2f/%.2f want -1500/8500", out.CashEUR, out.TotalValueEUR)
+	}
+	if out.CashBufferStatus != services.CashBufferLeveraged {
+		t.Errorf("cash_buffer_status: got %q want leveraged", out.CashBufferStatus)
+	}
+	if len(out.Warnings) != 1 || out.Warnings[0].Code != services.HealthWarningLeveraged {
+		t.Errorf("expected one leveraged warning, got %+v", out.Warnings)
+	}
+	// One position without volatility is not enough data for a Sharpe ratio.
+	if out.SharpeRatio != nil || out.SharpeStatus != services.SharpeStatusInsufficientData {
+		t.Errorf("expected sharpe_status insufficient_data without a ratio, got %q", out.SharpeStatus)
+	}
+
+	// Paying down the margin to a small positive balance leaves cash below the 8% buffer.
+	if err := db.Model(&models.CashHolding{}).Where("currency_code = ?", "USD").Update("amount", 0).Error; err != nil {
+		t.Fatalf("update cash: %v", err)
+	}
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/health", nil)
+	h.GetPortfolioHealth(c)
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.CashBufferStatus != services.CashBufferBelowTarget {
+		t.Errorf("cash_buffer_status: got %q want below_target", out.CashBufferStatus)
+	}
+}
+
+func TestGetConsolidatedPortfolioMergesSharedTicker(t *testing.T) {
+	t.Parallel()
+	db, h, _ := setupPortfolioHandlerTest(t)
+	const userID uint = 7
+
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	main := models.Portfolio{Name: "Main", IsDefault: true, UserID: userID}
+	pension := models.Portfolio{Name: "Pension", UserID: userID}
+	other := models.Portfolio{Name: "Someone else", UserID: userID + 1}
+	for _, portfolio := range []*models.Portfolio{&main, &pension, &other} {
+		if err := db.Create(portfolio).Error; err != nil {
+			t.Fatalf("create portfolio: %v", err)
+		}
+	}
+	for _, stock := range []models.Stock{
+		{PortfolioID: main.ID, Ticker: "AAPL", Sector: "Technology", Currency: "USD", CurrentPrice: 250, SharesOwned: 10, AvgPriceLocal: 200, ExpectedValue: 10},   // 2,000 EUR
+		{PortfolioID: pension.ID, Ticker: "AAPL", Sector: "Technology", Currency: "USD", CurrentPrice: 250, SharesOwned: 30, AvgPriceLocal: 240, ExpectedValue: 6}, // 6,000 EUR
+		{PortfolioID: pension.ID, Ticker: "SAP", Sector: "Technology", Currency: "EUR", CurrentPrice: 100, SharesOwned: 20, ExpectedValue: 4},                      // 2,000 EUR
+		{PortfolioID: other.ID, Ticker: "AAPL", Currency: "USD", CurrentPrice: 250, SharesOwned: 1000},                                                             // not the caller's
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+	for _, holding := range []models.CashHolding{
+		{PortfolioID: main.ID, CurrencyCode: "EUR", Amount: 1000},
+		{PortfolioID: pension.ID, CurrencyCode: "USD", Amount: 1250}, // 1,000 EUR
+	} {
+		if err := db.Create(&holding).Error; err != nil {
+			t.Fatalf("create cash: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/consolidated", nil)
+	c.Set("user_id", userID)
+	h.GetConsolidatedPortfolio(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Summary    services.PortfolioMetrics `json:"summary"`
+		CashValue  float64                   `json:"cash_value"`
+		TotalValue float64                   `json:"total_value"`
+		Positions  []models.Stock            `json:"positions"`
+		Portfolios []PortfolioSubtotal       `json:"portfolios"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(out.Positions) != 2 {
+		t.Fatalf("expected AAPL merged into one position plus SAP, got %d positions", len(out.Positions))
+	}
+	var aapl models.Stock
+	for _, position := range out.Positions {
+		if position.Ticker == "AAPL" {
+			aapl = position
+		}
+	}
+	if aapl.SharesOwned != 40 {
+		t.Errorf("AAPL shares: got %d want 40", aapl.SharesOwned)
+	}
+	if math.Abs(aapl.AvgPriceLocal-230) > 1e-9 || math.Abs(aapl.ExpectedValue-7) > 1e-9 {
+		t.Errorf("AAPL avg price/EV: got %.2f/%.2f want 230/7", aapl.AvgPriceLocal, aapl.ExpectedValue)
+	}
+	if math.Abs(aapl.Weight-0.8) > 1e-9 {
+		t.Errorf("AAPL weight: got %.4f want 0.8", aapl.Weight)
+	}
+
+	// 8,000 EUR AAPL + 2,000 EUR SAP, plus 2,000 EUR cash.
+	if math.Abs(out.Summary.TotalValue-10000) > 1e-6 || math.Abs(out.CashValue-2000) > 1e-6 || math.Abs(out.TotalValue-12000) > 1e-6 {
+		t.Errorf("totals: stocks %.2f cash %.2f total %.2f, want 10000/2000/12000", out.Summary.TotalValue, out.CashValue, out.TotalValue)
+	}
+	// (7 * 8,000 + 4 * 2,000) / 10,000
+	if math.Abs(out.Summary.OverallEV-6.4) > 1e-9 {
+		t.Errorf("overall EV: got %.4f want 6.4", out.Summary.OverallEV)
+	}
+	if math.Abs(out.Summary.SectorWeights["Technology"]-1) > 1e-9 {
+		t.Errorf("sector weights: got %v", out.Summary.SectorWeights)
+	}
+
+	if len(out.Portfolios) != 2 {
+		t.Fatalf("expected subtotals for the caller's two portfolios, got %+v", out.Portfolios)
+	}
+	if got := out.Portfolios[0]; got.PortfolioID != main.ID || math.Abs(got.TotalValue-3000) > 1e-6 || math.Abs(got.Weight-0.25) > 1e-9 {
+		t.Errorf("main subtotal: got %+v want total 3000, weight 0.25", got)
+	}
+	if got := out.Portfolios[1]; got.PortfolioID != pension.ID || math.Abs(got.StockValue-8000) > 1e-6 || math.Abs(got.CashValue-1000) > 1e-6 {
+		t.Errorf("pension subtotal: got %+v want stocks 8000, cash 1000", got)
+	}
+}
+
+func TestGetPortfolioSummaryReportsCashBuffer(t *testing.T) {
+	t.Parallel()
+	db, h, portfolioID := setupPortfolioHandlerTest(t)
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: time.Now()},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true, LastUpdated: time.Now()},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	// 4,500 EUR in positions and 500 EUR of cash (625 USD): 10% cash, inside the default 8–12% band.
+	if err := db.Create(&models.Stock{PortfolioID: portfolioID, Ticker: "ACME", Currency: "EUR", CurrentPrice: 45, SharesOwned: 100}).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	if err := db.Create(&models.CashHolding{PortfolioID: portfolioID, CurrencyCode: "USD", Amount: 625}).Error; err != nil {
+		t.Fatalf("create cash: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+	h.GetPortfolioSummary(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Summary struct {
+			CashBuffer *services.CashBuffer `json:"cash_buffer"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	buffer := out.Summary.CashBuffer
+	if buffer == nil {
+		t.Fatal("expected summary.cash_buffer")
+	}
+	if math.Abs(buffer.CashValue-500) > 1e-6 || math.Abs(buffer.CashPct-10) > 1e-6 || buffer.Status != services.CashBandWithin {
+		t.Errorf("unexpected cash buffer: %+v", buffer)
+	}
+	if buffer.MinPct != services.DefaultMinCashBufferPct || buffer.MaxPct != services.DefaultMaxCashBufferPct {
+		t.Errorf("band: got %.1f–%.1f", buffer.MinPct, buffer.MaxPct)
+	}
+}
+
+func TestGetPortfolioSummaryScopesToPortfolioID(t *testing.T) {
+	t.Parallel()
+	db, h, mainID := setupPortfolioHandlerTest(t)
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true, LastUpdated: time.Now()},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true, LastUpdated: time.Now()},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	side := models.Portfolio{Name: "Side"}
+	if err := db.Create(&side).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	for _, stock := range []models.Stock{
+		{PortfolioID: mainID, Ticker: "MAIN", Currency: "EUR", CurrentPrice: 10, SharesOwned: 10},
+		{PortfolioID: side.ID, Ticker: "SIDE", Currency: "EUR", CurrentPrice: 20, SharesOwned: 5},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/portfolio/summary?portfolio_id=%d", side.ID), nil)
+	h.GetPortfolioSummary(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		PortfolioID uint           `json:"portfolio_id"`
+		Stocks      []models.Stock `json:"stocks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.PortfolioID != side.ID {
+		t.Errorf("portfolio_id: got %d want %d", out.PortfolioID, side.ID)
+	}
+	if len(out.Stocks) != 1 || out.Stocks[0].Ticker != "SIDE" {
+		t.Errorf("stocks: got %+v, want only SIDE", out.Stocks)
+	}
+}
+
+func TestGetShadowDiffUsesEachPortfolioShadowConfig(t *testing.T) {
+	t.Parallel()
+	db, h, mainID := setupPortfolioHandlerTest(t)
+	side := models.Portfolio{Name: "Side", UserID: 2}
+	if err := db.Create(&side).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: mainID, ShadowMetricsJSON: `{"add_threshold": 1, "trim_threshold": 0.5}`}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: side.ID}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	for _, stock := range []models.Stock{
+		{PortfolioID: mainID, Ticker: "MAIN", CurrentPrice: 100, FairValue: 120, ProbabilityPositive: 0.6, DownsideRisk: -20},
+		{PortfolioID: side.ID, Ticker: "SIDE", CurrentPrice: 100, FairValue: 120, ProbabilityPositive: 0.6, DownsideRisk: -20},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+
+	diff := func(portfolioID uint) (enabled bool, rows []ShadowDiffRow) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/portfolio/shadow-diff?portfolio_id=%d", portfolioID), nil)
+		h.GetShadowDiff(c)
+		var resp struct {
+			Enabled bool            `json:"enabled"`
+			Rows    []ShadowDiffRow `json:"rows"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Enabled, resp.Rows
+	}
+	if enabled, rows := diff(mainID); !enabled || len(rows) != 1 || rows[0].ShadowAssessment != "Add" {
+		t.Fatalf("main portfolio: expected its shadow config applied, got enabled=%v rows=%+v", enabled, rows)
+	}
+	if enabled, _ := diff(side.ID); enabled {
+		t.Fatal("side portfolio has no shadow config but shadow mode was reported on")
+	}
+
+	// CalculateMetrics with a portfolio's config fills the shadow fields for that portfolio only.
+	var sideStock models.Stock
+	if err := db.Where("ticker = ?", "SIDE").First(&sideStock).Error; err != nil {
+		t.Fatalf("load stock: %v", err)
+	}
+	services.CalculateMetrics(&sideStock, services.PortfolioMetricsConfig(db, side.ID))
+	if sideStock.ShadowAssessment != "" {
+		t.Fatalf("side stock got shadow results from another portfolio: %q", sideStock.ShadowAssessment)
+	}
+}
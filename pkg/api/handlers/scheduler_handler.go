@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/art-pro/stock-backend/pkg/database"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// SchedulerHandler exposes results of scheduled update runs
+type SchedulerHandler struct {
+	db     *gorm.DB
+	logger zerolog.Logger
+}
+
+// NewSchedulerHandler creates a new scheduler handler
+func NewSchedulerHandler(db *gorm.DB, logger zerolog.Logger) *SchedulerHandler {
+	return &SchedulerHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (h *SchedulerHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
+	if portfolioIDParam := c.Query("portfolio_id"); portfolioIDParam != "" {
+		parsed, err := strconv.ParseUint(portfolioIDParam, 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return uint(parsed), nil
+	}
+	return database.GetDefaultPortfolioID(h.db)
+}
+
+// GetRuns returns recent scheduler runs (newest first) with their outcome counts
+func (h *SchedulerHandler) GetRuns(c *gin.Context) {
+	limit := 20
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if parsed, err := strconv.Atoi(limitParam); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	var runs []models.SchedulerRun
+	if err := h.db.Order("started_at DESC").Limit(limit).Find(&runs).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch scheduler runs")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduler runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetRun returns a single scheduler run with per-stock outcomes for the resolved portfolio.
+// Query status (success|transient|permanent) filters the outcomes.
+func (h *SchedulerHandler) GetRun(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	var run models.SchedulerRun
+	if err := h.db.First(&run, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scheduler run not found"})
+			return
+		}
+		h.logger.Error().Err(err).Msg("Failed to fetch scheduler run")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduler run"})
+		return
+	}
+
+	query := h.db.Where("run_id = ? AND portfolio_id = ?", run.ID, portfolioID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("ticker ASC").Find(&run.Outcomes).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch scheduler run outcomes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduler run outcomes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
@@ -94,8 +95,6 @@ func (h *SettingsHandler) SaveColumnSettings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "saved"})
 }
 
-const sectorTargetsKey = "sector_targets"
-
 // SectorTargetRow is one row of the sector targets table (sector or Cash).
 type SectorTargetRow struct {
 	Sector   string `json:"sector" binding:"required"`
@@ -118,7 +117,7 @@ func (h *SettingsHandler) GetSectorTargets(c *gin.Context) {
 	uid := userID.(uint)
 
 	var setting models.UserSettings
-	if err := h.db.Where("user_id = ? AND key = ?", uid, sectorTargetsKey).First(&setting).Error; err != nil {
+	if err := h.db.Where("user_id = ? AND key = ?", uid, services.SectorTargetsSettingKey).First(&setting).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusOK, gin.H{"rows": nil})
 			return
@@ -157,11 +156,11 @@ func (h *SettingsHandler) SaveSectorTargets(c *gin.Context) {
 	value := string(jsonBytes)
 
 	var setting models.UserSettings
-	err := h.db.Where("user_id = ? AND key = ?", uid, sectorTargetsKey).First(&setting).Error
+	err := h.db.Where("user_id = ? AND key = ?", uid, services.SectorTargetsSettingKey).First(&setting).Error
 	if err == gorm.ErrRecordNotFound {
 		setting = models.UserSettings{
 			UserID: uid,
-			Key:    sectorTargetsKey,
+			Key:    services.SectorTargetsSettingKey,
 			Value:  value,
 		}
 		if err := h.db.Create(&setting).Error; err != nil {
@@ -25,11 +25,12 @@ type StockHandler struct {
 	apiService          *services.ExternalAPIService
 	fairValueCollector  *services.FairValueCollector
 	exchangeRateService *services.ExchangeRateService
+	staleRefresher      *staleRefresher // nil unless STALE_REFRESH_ON_READ
 }
 
 // NewStockHandler creates a new stock handler
 func NewStockHandler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *StockHandler {
-	return &StockHandler{
+	h := &StockHandler{
 		db:                  db,
 		cfg:                 cfg,
 		logger:              logger,
@@ -37,6 +38,23 @@ func NewStockHandler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *St
 		fairValueCollector:  services.NewFairValueCollector(cfg),
 		exchangeRateService: services.NewExchangeRateService(db, logger),
 	}
+	h.staleRefresher = newStaleRefresher(cfg, h.refreshStockInBackground)
+	return h
+}
+
+// refreshStockInBackground reloads a stock and updates it from the data providers, as
+// UpdateSingleStock does, outside any request.
+func (h *StockHandler) refreshStockInBackground(stockID uint) {
+	var stock models.Stock
+	if err := h.db.First(&stock, stockID).Error; err != nil {
+		h.logger.Warn().Err(err).Uint("stock_id", stockID).Msg("Failed to load stock for background refresh")
+		return
+	}
+	if err := h.updateStockData(&stock); err != nil {
+		h.logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Background refresh of stale stock failed")
+		return
+	}
+	h.logger.Info().Str("ticker", stock.Ticker).Msg("Refreshed stale stock in background")
 }
 
 func (h *StockHandler) updateStockUSDValues(stock *models.Stock) error {
@@ -64,6 +82,9 @@ func (h *StockHandler) updateStockUSDValues(stock *models.Stock) error {
 	return nil
 }
 
+// resolvePortfolioID returns the portfolio_id query param, else the caller's default portfolio. With
+// AUTO_CREATE_DEFAULT_PORTFOLIO on that is their own one, created when missing, so reads see the
+// portfolio their writes went to.
 func (h *StockHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
 	if portfolioIDParam := c.Query("portfolio_id"); portfolioIDParam != "" {
 		parsed, err := strconv.ParseUint(portfolioIDParam, 10, 32)
@@ -72,7 +93,7 @@ func (h *StockHandler) resolvePortfolioID(c *gin.Context) (uint, error) {
 		}
 		return uint(parsed), nil
 	}
-	return database.GetDefaultPortfolioID(h.db)
+	return database.ResolveDefaultPortfolioID(h.db, c.GetString("username"), h.cfg.AutoCreateDefaultPortfolio)
 }
 
 func normalizeUpdateFrequency(raw string) string {
@@ -105,7 +126,7 @@ func (h *StockHandler) refreshLatestPriceForStock(stock *models.Stock) error {
 	quotePayload, _ := json.Marshal(gin.H{"quote": quote})
 	stock.AlphaVantageRawJSON = string(quotePayload)
 
-	services.CalculateMetrics(stock)
+	services.CalculateMetrics(stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 	if err := h.updateStockUSDValues(stock); err != nil {
 		return err
 	}
@@ -127,6 +148,7 @@ func (h *StockHandler) refreshLatestPriceForStock(stock *models.Stock) error {
 		KellyFraction:       stock.KellyFraction,
 		Weight:              stock.Weight,
 		Assessment:          stock.Assessment,
+		PriceType:           services.PriceTypeIntraday,
 		RecordedAt:          now,
 	}
 	h.db.Create(&history)
@@ -176,6 +198,15 @@ func (h *StockHandler) GetStock(c *gin.Context) {
 		return
 	}
 
+	// A stale read returns the current data at once and refreshes it in the background for the next poll.
+	if h.staleRefresher.maybeRefresh(&stock) {
+		c.JSON(http.StatusOK, struct {
+			models.Stock
+			Refreshing bool `json:"refreshing"`
+		}{stock, true})
+		return
+	}
+
 	c.JSON(http.StatusOK, stock)
 }
 
@@ -185,11 +216,14 @@ type CreateStockRequest struct {
 	ISIN                string  `json:"isin"` // International Securities Identification Number (optional)
 	CompanyName         string  `json:"company_name" binding:"required"`
 	Sector              string  `json:"sector" binding:"required"`
+	Industry            string  `json:"industry"`
 	Currency            string  `json:"currency"`
 	SharesOwned         int     `json:"shares_owned"`
 	AvgPriceLocal       float64 `json:"avg_price_local"`
 	UpdateFrequency     string  `json:"update_frequency"`
+	AssessmentFrequency string  `json:"assessment_frequency"` // none (default), weekly or monthly
 	ProbabilityPositive float64 `json:"probability_positive"` // Optional manual input
+	ProbabilityManual   bool    `json:"probability_manual"`   // Keep p through analyst-rating re-estimation; implied by probability_positive
 	PortfolioID         uint    `json:"portfolio_id"`
 }
 
@@ -206,16 +240,26 @@ func (h *StockHandler) CreateStock(c *gin.Context) {
 		ISIN:                req.ISIN,
 		CompanyName:         req.CompanyName,
 		Sector:              req.Sector,
+		Industry:            req.Industry,
 		Currency:            req.Currency,
 		SharesOwned:         req.SharesOwned,
 		AvgPriceLocal:       req.AvgPriceLocal,
 		UpdateFrequency:     req.UpdateFrequency,
+		AssessmentFrequency: services.NormalizeAssessmentFrequency(req.AssessmentFrequency),
 		ProbabilityPositive: req.ProbabilityPositive,
+		ProbabilityManual:   req.ProbabilityManual || req.ProbabilityPositive > 0,
 	}
 
 	if stock.Currency == "" {
 		stock.Currency = "USD"
 	}
+	// Store the canonical ticker for dedup and provider lookups; keep the entered form for display.
+	if h.cfg.NormalizeTickers {
+		if normalized := services.NormalizeTicker(req.Ticker, services.TickerRulesFromConfig(h.cfg)); normalized != "" && normalized != req.Ticker {
+			stock.DisplayTicker = strings.TrimSpace(req.Ticker)
+			stock.Ticker = normalized
+		}
+	}
 	if stock.UpdateFrequency == "" {
 		stock.UpdateFrequency = "daily"
 	} else {
@@ -226,6 +270,10 @@ func (h *StockHandler) CreateStock(c *gin.Context) {
 		}
 		stock.UpdateFrequency = normalized
 	}
+	if stock.AssessmentFrequency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment_frequency. Allowed: none, weekly, monthly"})
+		return
+	}
 	if stock.ProbabilityPositive == 0 {
 		stock.ProbabilityPositive = 0.65 // Default conservative value
 	}
@@ -233,7 +281,7 @@ func (h *StockHandler) CreateStock(c *gin.Context) {
 	if req.PortfolioID != 0 {
 		stock.PortfolioID = req.PortfolioID
 	} else {
-		portfolioID, err := database.GetDefaultPortfolioID(h.db)
+		portfolioID, err := h.resolvePortfolioID(c)
 		if err != nil {
 			h.logger.Error().Err(err).Msg("Failed to resolve default portfolio")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "No default portfolio found"})
@@ -244,11 +292,16 @@ func (h *StockHandler) CreateStock(c *gin.Context) {
 
 	// Check if stock already exists in this portfolio.
 	var existing models.Stock
-	if err := h.db.Where("ticker = ? AND portfolio_id = ?", req.Ticker, stock.PortfolioID).First(&existing).Error; err == nil {
+	if err := h.db.Where("portfolio_id = ? AND (ticker IN ? OR display_ticker = ?)", stock.PortfolioID, []string{req.Ticker, stock.Ticker}, req.Ticker).First(&existing).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Stock with this ticker already exists in the selected portfolio"})
 		return
 	}
 
+	// Track the stock's currency before fetching data, so valuation never falls back to a 1:1 rate.
+	if !ensureCurrencyTracked(c, h.cfg, h.exchangeRateService, h.logger, stock.Currency) {
+		return
+	}
+
 	// Fetch all stock data from Grok in one call (includes ALL calculations!)
 	// With automatic fallback to mock data that also includes calculations
 	if err := h.apiService.FetchAllStockData(&stock); err != nil {
@@ -263,11 +316,8 @@ func (h *StockHandler) CreateStock(c *gin.Context) {
 
 	h.logger.Info().Str("ticker", stock.Ticker).Msg("✓ Successfully fetched data from Grok")
 
-	// NO NEED to call CalculateMetrics - Grok already calculated everything!
-	// The following fields are now provided by Grok:
-	// - UpsidePotential, BRatio, ExpectedValue
-	// - KellyFraction, HalfKellySuggested
-	// - BuyZoneMin, BuyZoneMax, Assessment
+	// Derive EV, Kelly and the assessment under the portfolio's thresholds.
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 
 	if err := h.updateStockUSDValues(&stock); err != nil {
 		h.logger.Error().Err(err).Str("currency", stock.Currency).Msg("Failed to convert stock values using exchange rates")
@@ -298,6 +348,7 @@ func (h *StockHandler) CreateStock(c *gin.Context) {
 		KellyFraction:       stock.KellyFraction,
 		Weight:              stock.Weight,
 		Assessment:          stock.Assessment,
+		PriceType:           services.PriceTypeIntraday,
 		RecordedAt:          time.Now(),
 	}
 	h.db.Create(&history)
@@ -333,12 +384,14 @@ func (h *StockHandler) UpdateStock(c *gin.Context) {
 		"company_name":           {},
 		"isin":                   {},
 		"sector":                 {},
+		"industry":               {},
 		"current_price":          {},
 		"currency":               {},
 		"fair_value":             {},
 		"upside_potential":       {},
 		"downside_risk":          {},
 		"probability_positive":   {},
+		"probability_manual":     {},
 		"expected_value":         {},
 		"beta":                   {},
 		"volatility":             {},
@@ -359,9 +412,12 @@ func (h *StockHandler) UpdateStock(c *gin.Context) {
 		"sell_zone_status":       {},
 		"assessment":             {},
 		"update_frequency":       {},
+		"assessment_frequency":   {},
 		"data_source":            {},
 		"fair_value_source":      {},
 		"comment":                {},
+		"purchased_at":           {},
+		"tags":                   {},
 		"alpha_vantage_raw_json": {},
 		"grok_raw_json":          {},
 	}
@@ -387,6 +443,49 @@ func (h *StockHandler) UpdateStock(c *gin.Context) {
 		sanitized["update_frequency"] = normalized
 	}
 
+	if rawFrequency, ok := sanitized["assessment_frequency"].(string); ok {
+		normalized := services.NormalizeAssessmentFrequency(rawFrequency)
+		if normalized == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assessment_frequency. Allowed: none, weekly, monthly"})
+			return
+		}
+		sanitized["assessment_frequency"] = normalized
+	}
+
+	if rawPurchasedAt, ok := sanitized["purchased_at"]; ok {
+		switch v := rawPurchasedAt.(type) {
+		case nil:
+			sanitized["purchased_at"] = nil
+		case string:
+			parsed, err := parsePurchasedAt(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchased_at. Use YYYY-MM-DD or RFC3339"})
+				return
+			}
+			sanitized["purchased_at"] = parsed
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchased_at. Use YYYY-MM-DD or RFC3339"})
+			return
+		}
+	}
+
+	if rawTags, ok := sanitized["tags"]; ok {
+		tags, ok := rawTags.(string)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tags. Use a comma-separated string"})
+			return
+		}
+		sanitized["tags"] = normalizeTags(tags)
+	}
+
+	if rawManual, ok := sanitized["probability_manual"]; ok {
+		if _, ok := rawManual.(bool); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid probability_manual. Use true or false"})
+			return
+		}
+	}
+	markManualProbability(sanitized)
+
 	// Update allowed fields
 	if err := h.db.Model(&stock).Updates(sanitized).Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to update stock")
@@ -395,7 +494,7 @@ func (h *StockHandler) UpdateStock(c *gin.Context) {
 	}
 
 	// Recalculate metrics
-	services.CalculateMetrics(&stock)
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 	h.db.Save(&stock)
 
 	h.logger.Info().Str("ticker", stock.Ticker).Msg("Stock updated successfully")
@@ -403,6 +502,33 @@ func (h *StockHandler) UpdateStock(c *gin.Context) {
 	c.JSON(http.StatusOK, stock)
 }
 
+// parsePurchasedAt accepts a calendar date (YYYY-MM-DD) or a full RFC3339 timestamp.
+func parsePurchasedAt(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// normalizeTags lowercases, trims and de-duplicates a comma-separated tag list.
+func normalizeTags(value string) string {
+	seen := make(map[string]struct{})
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return strings.Join(tags, ",")
+}
+
 // UpdateStockPrice updates just the current price and recalculates metrics
 func (h *StockHandler) UpdateStockPrice(c *gin.Context) {
 	id := c.Param("id")
@@ -431,7 +557,7 @@ func (h *StockHandler) UpdateStockPrice(c *gin.Context) {
 	stock.LastUpdated = time.Now()
 
 	// Recalculate all derived metrics based on new price
-	services.CalculateMetrics(&stock)
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 
 	if err := h.updateStockUSDValues(&stock); err != nil {
 		h.logger.Error().Err(err).Str("currency", stock.Currency).Msg("Failed to convert stock values using exchange rates")
@@ -513,6 +639,7 @@ func (h *StockHandler) UpdateStockField(c *gin.Context) {
 	case "probability_positive":
 		if floatVal, ok := req.Value.(float64); ok && floatVal >= 0 && floatVal <= 1 {
 			stock.ProbabilityPositive = floatVal
+			stock.ProbabilityManual = true
 			fieldUpdated = true
 		}
 	case "downside_risk":
@@ -651,7 +778,7 @@ func (h *StockHandler) UpdateStockField(c *gin.Context) {
 
 	// Recalculate all derived metrics (only if numeric fields changed)
 	if req.Field != "comment" && req.Field != "company_name" && req.Field != "ticker" && req.Field != "sector" && req.Field != "update_frequency" && req.Field != "isin" && req.Field != "fair_value_source" {
-		services.CalculateMetrics(&stock)
+		services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 
 		if err := h.updateStockUSDValues(&stock); err != nil {
 			h.logger.Error().Err(err).Str("currency", stock.Currency).Msg("Failed to convert stock values using exchange rates")
@@ -798,6 +925,10 @@ func (h *StockHandler) UpdateAllStocks(c *gin.Context) {
 
 	h.logger.Info().Int("updated", updatedCount).Int("errors", errorCount).Msg("Bulk stock update completed")
 
+	if updatedCount > 0 {
+		h.recordPortfolioSnapshot(portfolioID, stocks)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Update completed",
 		"updated": updatedCount,
@@ -806,6 +937,26 @@ func (h *StockHandler) UpdateAllStocks(c *gin.Context) {
 	})
 }
 
+// recordPortfolioSnapshot upserts today's portfolio snapshot after a manual refresh.
+// A later scheduler run on the same day overwrites it (snapshots are end-of-day, last write wins).
+func (h *StockHandler) recordPortfolioSnapshot(portfolioID uint, stocks []models.Stock) {
+	fxRates, err := h.exchangeRateService.GetRatesMap()
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("Failed to load exchange rates for portfolio snapshot")
+		return
+	}
+	metrics := services.CalculatePortfolioMetrics(stocks, fxRates, "EUR", services.PortfolioMetricsConfig(h.db, portfolioID))
+	cashEUR, err := database.PortfolioCashEUR(h.db, portfolioID, fxRates)
+	if err != nil {
+		h.logger.Warn().Err(err).Uint("portfolio_id", portfolioID).Msg("Failed to fetch cash holdings for portfolio snapshot")
+		return
+	}
+	snapshot := services.NewPortfolioSnapshot(portfolioID, metrics, cashEUR, time.Now())
+	if err := database.SavePortfolioSnapshot(h.db, &snapshot); err != nil {
+		h.logger.Warn().Err(err).Uint("portfolio_id", portfolioID).Msg("Failed to save portfolio snapshot")
+	}
+}
+
 type CollectFairValuesRequest struct {
 	IDs []uint `json:"ids" binding:"required,min=1"`
 }
@@ -835,9 +986,15 @@ func (h *StockHandler) CollectFairValues(c *gin.Context) {
 		return
 	}
 
+	settings := services.LoadPortfolioSettings(h.db, portfolioID)
+	metricsConfig := services.PortfolioMetricsConfig(h.db, portfolioID)
+
 	updated := 0
+	heldForReview := 0
 	errors := []string{}
 	totalSources := 0
+	disagreements := []gin.H{}
+	rejected := []gin.H{}
 
 	for i := range stocks {
 		select {
@@ -848,47 +1005,69 @@ func (h *StockHandler) CollectFairValues(c *gin.Context) {
 		}
 
 		stock := &stocks[i]
-		entries, collectErr := h.fairValueCollector.CollectTrustedFairValues(c.Request.Context(), stock)
+		collection, collectErr := h.fairValueCollector.CollectWithDiagnostics(c.Request.Context(), stock)
+		if len(collection.Rejections) > 0 {
+			rejected = append(rejected, gin.H{"ticker": stock.Ticker, "rejections": collection.Rejections})
+		}
+		entries := collection.Entries
 		if collectErr != nil {
 			errors = append(errors, fmt.Sprintf("%s: %v", stock.Ticker, collectErr))
 			continue
 		}
 
-		values := make([]float64, 0, len(entries))
-		for _, entry := range entries {
-			values = append(values, entry.FairValue)
-		}
-		if len(values) == 0 {
+		if len(entries) == 0 {
 			errors = append(errors, fmt.Sprintf("%s: no trusted fair value entries returned", stock.Ticker))
 			continue
 		}
+		consensus := services.ConsensusFairValue(entries, settings.MaxFVDisagreement)
 
+		held := false
 		txErr := func() error {
 			tx := h.db.Begin()
 			if tx.Error != nil {
 				return fmt.Errorf("failed to start transaction")
 			}
 
-			for _, entry := range entries {
-				history := models.FairValueHistory{
-					StockID:     stock.ID,
+			collectedAt := time.Now()
+			applied, proposed := services.ApplyCollectedFairValue(stock, entries, settings.DowngradeMinSources, collectedAt, metricsConfig)
+			if !applied {
+				// Thinly sourced fair value would worsen the assessment: keep the prior value and flag for review.
+				alert := models.Alert{
 					PortfolioID: stock.PortfolioID,
+					StockID:     stock.ID,
 					Ticker:      stock.Ticker,
-					FairValue:   entry.FairValue,
-					Source:      entry.Source,
-					RecordedAt:  entry.RecordedAt,
+					AlertType:   "needs_review",
+					Message:     services.NeedsReviewAlertMessage(stock, entries, proposed),
+					CreatedAt:   collectedAt,
 				}
-				if err := tx.Create(&history).Error; err != nil {
+				if _, err := services.RaiseStockAlert(tx, alert, services.AlertCooldown(settings)); err != nil {
 					tx.Rollback()
-					return fmt.Errorf("failed to save fair value history")
+					return fmt.Errorf("failed to save needs-review alert")
+				}
+				held = true
+			} else {
+				// Held values stay out of the history until a reviewer accepts them
+				for _, entry := range entries {
+					history := models.FairValueHistory{
+						StockID:     stock.ID,
+						PortfolioID: stock.PortfolioID,
+						Ticker:      stock.Ticker,
+						FairValue:   entry.FairValue,
+						Source:      entry.Source,
+						RecordedAt:  entry.RecordedAt,
+					}
+					if err := tx.Create(&history).Error; err != nil {
+						tx.Rollback()
+						return fmt.Errorf("failed to save fair value history")
+					}
 				}
 			}
+			if _, err := services.CheckFairValueDisagreement(tx, stock, consensus, settings, collectedAt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to save fair value uncertainty alert")
+			}
+			stock.LastUpdated = collectedAt
 
-			stock.FairValue = services.Median(values)
-			stock.FairValueSource = fmt.Sprintf("Trusted multi-source consensus (%d entries), %s", len(entries), time.Now().Format("2006-01-02"))
-			stock.LastUpdated = time.Now()
-
-			services.CalculateMetrics(stock)
 			if err := h.updateStockUSDValues(stock); err != nil {
 				tx.Rollback()
 				return fmt.Errorf("failed to convert stock values")
@@ -912,6 +1091,7 @@ func (h *StockHandler) CollectFairValues(c *gin.Context) {
 				KellyFraction:       stock.KellyFraction,
 				Weight:              stock.Weight,
 				Assessment:          stock.Assessment,
+				PriceType:           services.PriceTypeIntraday,
 				RecordedAt:          time.Now(),
 			}
 			if err := tx.Create(&snapshot).Error; err != nil {
@@ -932,16 +1112,29 @@ func (h *StockHandler) CollectFairValues(c *gin.Context) {
 
 		totalSources += len(entries)
 		updated++
+		if held {
+			heldForReview++
+		}
+		if consensus.ProvidersDisagree {
+			disagreements = append(disagreements, gin.H{
+				"ticker":                    stock.Ticker,
+				"provider_medians":          consensus.ProviderMedians,
+				"provider_disagreement_pct": consensus.ProviderDisagreementPct,
+			})
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":               "Fair value collection completed",
-		"updated":               updated,
-		"errors":                len(errors),
-		"error_details":         errors,
-		"total_requested":       len(req.IDs),
-		"entries_saved":         totalSources,
-		"trusted_entries_saved": totalSources,
+		"message":                "Fair value collection completed",
+		"updated":                updated,
+		"errors":                 len(errors),
+		"error_details":          errors,
+		"total_requested":        len(req.IDs),
+		"held_for_review":        heldForReview,
+		"provider_disagreements": disagreements,
+		"rejected_entries":       rejected,
+		"entries_saved":          totalSources,
+		"trusted_entries_saved":  totalSources,
 	})
 }
 
@@ -1035,13 +1228,47 @@ func (h *StockHandler) UpdateSingleStock(c *gin.Context) {
 		h.logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to update stock data from API, using mock data")
 		// Don't return error - the updateStockData should have fallback to mock data
 		// Try to at least recalculate metrics with existing data
-		services.CalculateMetrics(&stock)
+		services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 		h.db.Save(&stock)
 	}
 
 	c.JSON(http.StatusOK, stock)
 }
 
+// AverageDownRequest asks whether a tracked stock may be averaged down at a hypothetical price
+type AverageDownRequest struct {
+	Ticker string  `json:"ticker" binding:"required"`
+	Price  float64 `json:"price" binding:"required,gt=0"` // Hypothetical price in the stock's currency
+}
+
+// AverageDown checks the strategy's averaging-down rule for a tracked stock at a hypothetical lower
+// price: EV at that price must exceed the current EV and the probability must stay above 55%.
+func (h *StockHandler) AverageDown(c *gin.Context) {
+	var req AverageDownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	var stock models.Stock
+	if err := h.db.Where("portfolio_id = ? AND ticker = ?", portfolioID, services.StoredTicker(strings.ToUpper(strings.TrimSpace(req.Ticker)), h.cfg)).First(&stock).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
+			return
+		}
+		h.logger.Error().Err(err).Msg("Failed to fetch stock for average-down check")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, services.EvaluateAverageDown(stock, req.Price, services.PortfolioMetricsConfig(h.db, stock.PortfolioID)))
+}
+
 // updateStockData is a helper function to update stock data from external APIs (auto-mode)
 func (h *StockHandler) updateStockData(stock *models.Stock) error {
 	return h.updateStockDataWithSource(stock, "")
@@ -1085,7 +1312,8 @@ func (h *StockHandler) updateStockDataWithSource(stock *models.Stock, source str
 
 	h.logger.Info().Str("ticker", stock.Ticker).Msg("✓ Successfully fetched data from Grok")
 
-	// NO NEED to call CalculateMetrics - Grok already calculated everything!
+	// Derive EV, Kelly and the assessment under the portfolio's thresholds.
+	services.CalculateMetrics(stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
 
 	if err := h.updateStockUSDValues(stock); err != nil {
 		h.logger.Error().Err(err).Str("currency", stock.Currency).Msg("Failed to convert stock values using exchange rates")
@@ -1114,29 +1342,47 @@ func (h *StockHandler) updateStockDataWithSource(stock *models.Stock, source str
 		KellyFraction:       stock.KellyFraction,
 		Weight:              stock.Weight,
 		Assessment:          stock.Assessment,
+		PriceType:           services.PriceTypeIntraday,
 		RecordedAt:          time.Now(),
 	}
 	h.db.Create(&history)
 
-	// Check for alerts (EV change > threshold)
-	evChange := stock.ExpectedValue - oldEV
-	if evChange > 10.0 || evChange < -10.0 {
-		alert := models.Alert{
-			PortfolioID: stock.PortfolioID,
-			StockID:     stock.ID,
-			Ticker:      stock.Ticker,
-			AlertType:   "ev_change",
-			Message:     "EV changed by " + strconv.FormatFloat(evChange, 'f', 2, 64) + "%",
-			EmailSent:   false,
-			CreatedAt:   time.Now(),
-		}
-		h.db.Create(&alert)
+	// EV change and buy zone alerts go through the same settings and dedup as the scheduled update
+	settings := models.PortfolioSettings{AlertCooldownHours: services.DefaultAlertCooldownHours}
+	if err := h.db.Where("portfolio_id = ?", stock.PortfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Warn().Err(err).Msg("Failed to fetch settings for stock alerts")
+	}
+	if _, err := services.RaiseStockUpdateAlerts(h.db, stock, oldEV, settings, time.Now()); err != nil {
+		h.logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to raise stock alerts")
 	}
 
 	return nil
 }
 
-// GetStockHistory returns historical data for a stock
+// StockHistoryPoint is one value of a stock's metric series.
+type StockHistoryPoint struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	Value      float64   `json:"value"`
+}
+
+// maxStockHistoryPoints caps the points GetStockHistory returns for a metric series, as
+// maxEVHistoryBuckets does for the portfolio EV series.
+const maxStockHistoryPoints = maxEVHistoryBuckets
+
+// stockHistoryMetrics maps the metric query values to the StockHistory field they chart.
+var stockHistoryMetrics = map[string]func(models.StockHistory) float64{
+	"ev":     func(row models.StockHistory) float64 { return row.ExpectedValue },
+	"price":  func(row models.StockHistory) float64 { return row.CurrentPrice },
+	"kelly":  func(row models.StockHistory) float64 { return row.KellyFraction },
+	"upside": func(row models.StockHistory) float64 { return row.UpsidePotential },
+}
+
+// GetStockHistory returns historical data for a stock. With query metric (ev, price, kelly or
+// upside) it returns that metric as a [{recorded_at, value}] series, oldest first, between from and
+// to (YYYY-MM-DD, default the last 365 days); granularity daily or weekly keeps the last value per
+// UTC day or Monday-aligned week. Like GetEVHistory, the series is capped at maxStockHistoryPoints:
+// wider ranges widen the buckets, and a raw series holding more rows is bucketed too. Without metric it returns the latest 100 raw snapshots. With
+// end_of_day=true only rows recorded by the scheduled update (price_type end_of_day) are used.
 func (h *StockHandler) GetStockHistory(c *gin.Context) {
 	id := c.Param("id")
 	portfolioID, err := h.resolvePortfolioID(c)
@@ -1145,8 +1391,97 @@ func (h *StockHandler) GetStockHistory(c *gin.Context) {
 		return
 	}
 
+	query := h.db.Where("stock_id = ? AND portfolio_id = ?", id, portfolioID)
+	if c.Query("end_of_day") == "true" {
+		query = query.Where("price_type = ?", services.PriceTypeEndOfDay)
+	}
+
+	if metric := c.Query("metric"); metric != "" {
+		value, ok := stockHistoryMetrics[metric]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid metric. Use ev, price, kelly or upside"})
+			return
+		}
+		granularity := c.Query("granularity")
+		if granularity != "" && granularity != "daily" && granularity != "weekly" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid granularity. Use daily or weekly"})
+			return
+		}
+		from, to, err := parseDateRange(c, 365)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		baseDays := 1
+		if granularity == "weekly" {
+			// Align weekly buckets to Monday
+			from = from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7))
+			baseDays = 7
+		}
+		query = query.Where("recorded_at >= ? AND recorded_at < ?", from, to.AddDate(0, 0, 1))
+		totalDays := int(to.Sub(from).Hours()/24) + 1
+		bucketDays := baseDays
+		if totalDays > maxStockHistoryPoints*baseDays {
+			bucketDays = baseDays * ((totalDays + maxStockHistoryPoints*baseDays - 1) / (maxStockHistoryPoints * baseDays))
+		}
+
+		if granularity == "" && bucketDays == 1 {
+			var rows int64
+			if err := query.Session(&gorm.Session{}).Model(&models.StockHistory{}).Count(&rows).Error; err != nil {
+				h.logger.Error().Err(err).Msg("Failed to count stock history")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
+				return
+			}
+			if rows <= maxStockHistoryPoints {
+				var history []models.StockHistory
+				if err := query.Order("recorded_at ASC").Find(&history).Error; err != nil {
+					h.logger.Error().Err(err).Msg("Failed to fetch stock history")
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
+					return
+				}
+				points := make([]StockHistoryPoint, len(history))
+				for i, row := range history {
+					points[i] = StockHistoryPoint{RecordedAt: row.RecordedAt, Value: value(row)}
+				}
+				c.JSON(http.StatusOK, points)
+				return
+			}
+		}
+
+		// Keep the latest row per bucket, reading the range in batches.
+		latest := make([]*models.StockHistory, (totalDays+bucketDays-1)/bucketDays)
+		bucketWidth := time.Duration(bucketDays) * 24 * time.Hour
+		var batch []models.StockHistory
+		if err := query.FindInBatches(&batch, defaultEVHistoryBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				row := batch[i]
+				idx := int(row.RecordedAt.Sub(from) / bucketWidth)
+				if idx < 0 || idx >= len(latest) {
+					continue
+				}
+				if latest[idx] == nil || !row.RecordedAt.Before(latest[idx].RecordedAt) {
+					latest[idx] = &row
+				}
+			}
+			return nil
+		}).Error; err != nil {
+			h.logger.Error().Err(err).Msg("Failed to fetch stock history")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
+			return
+		}
+		points := make([]StockHistoryPoint, 0, len(latest))
+		for _, row := range latest {
+			if row != nil {
+				points = append(points, StockHistoryPoint{RecordedAt: row.RecordedAt, Value: value(*row)})
+			}
+		}
+		c.JSON(http.StatusOK, points)
+		return
+	}
+
 	var history []models.StockHistory
-	if err := h.db.Where("stock_id = ? AND portfolio_id = ?", id, portfolioID).Order("recorded_at DESC").Limit(100).Find(&history).Error; err != nil {
+	if err := query.Order("recorded_at DESC").Limit(100).Find(&history).Error; err != nil {
 		h.logger.Error().Err(err).Msg("Failed to fetch stock history")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
 		return
@@ -1183,6 +1518,159 @@ func (h *StockHandler) GetFairValueHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, history)
 }
 
+// defaultEVRangeWindowDays bounds the fair value history used for the EV range.
+const defaultEVRangeWindowDays = 30
+
+// GetEVRange computes EV at the low (min), consensus (median) and high (max) fair values collected
+// for a stock within the window (query days, default 30) and a probability-weighted blended EV.
+// Without collected entries, the stock's own fair value is used for all three targets.
+func (h *StockHandler) GetEVRange(c *gin.Context) {
+	id := c.Param("id")
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+	days := defaultEVRangeWindowDays
+	if daysParam := c.Query("days"); daysParam != "" {
+		parsed, err := strconv.Atoi(daysParam)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+			return
+		}
+		days = parsed
+	}
+
+	var stock models.Stock
+	if err := h.db.Where("id = ? AND portfolio_id = ?", id, portfolioID).First(&stock).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
+		return
+	}
+
+	var history []models.FairValueHistory
+	if err := h.db.Where("stock_id = ? AND portfolio_id = ? AND recorded_at >= ?", stock.ID, portfolioID, time.Now().AddDate(0, 0, -days)).
+		Find(&history).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch fair value history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch fair value history"})
+		return
+	}
+	entries := make([]services.NormalizedFairValueEntry, 0, len(history))
+	for _, record := range history {
+		if record.FairValue > 0 {
+			entries = append(entries, services.NormalizedFairValueEntry{FairValue: record.FairValue, Source: record.Source, RecordedAt: record.RecordedAt})
+		}
+	}
+
+	low, consensus, high := services.FairValueRange(entries)
+	if len(entries) == 0 {
+		if stock.FairValue <= 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stock has no fair value"})
+			return
+		}
+		low, consensus, high = stock.FairValue, stock.FairValue, stock.FairValue
+	}
+
+	// Fill probability and downside defaults the same way CalculateMetrics does.
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
+	weights := services.DefaultEVRangeWeights()
+	if w := h.cfg.EVRangeWeights; len(w) == 3 {
+		weights = services.EVRangeWeights{Low: w[0], Consensus: w[1], High: w[2]}
+	}
+
+	result := services.CalculateEVRange(low, consensus, high, stock.CurrentPrice, stock.ProbabilityPositive, stock.DownsideRisk, weights)
+	c.JSON(http.StatusOK, gin.H{
+		"stock_id":             stock.ID,
+		"ticker":               stock.Ticker,
+		"entries":              len(entries),
+		"probability_positive": stock.ProbabilityPositive,
+		"downside_risk":        stock.DownsideRisk,
+		"range":                result,
+	})
+}
+
+// GetSuggestedOrder sizes a whole-share buy that brings the stock up to its ½-Kelly suggested weight of
+// portfolio value, within the portfolio's Kelly cap and cash buffer. Query cash (EUR) sets the cash
+// available for the order; it defaults to the portfolio's cash holdings.
+func (h *StockHandler) GetSuggestedOrder(c *gin.Context) {
+	id := c.Param("id")
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+	var cashParam *float64
+	if raw := c.Query("cash"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cash"})
+			return
+		}
+		cashParam = &parsed
+	}
+
+	var stocks []models.Stock
+	if err := h.db.Where("portfolio_id = ?", portfolioID).Find(&stocks).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch stocks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stocks"})
+		return
+	}
+	metricsConfig := services.PortfolioMetricsConfig(h.db, portfolioID)
+	index := -1
+	for i := range stocks {
+		services.CalculateMetrics(&stocks[i], metricsConfig)
+		if strconv.FormatUint(uint64(stocks[i].ID), 10) == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
+		return
+	}
+
+	var cashHoldings []models.CashHolding
+	if err := h.db.Where("portfolio_id = ?", portfolioID).Find(&cashHoldings).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch cash holdings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cash holdings"})
+		return
+	}
+	fxRates, err := h.exchangeRateService.GetRatesMap()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to fetch exchange rates from database")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+	cashEUR := 0.0
+	for _, holding := range cashHoldings {
+		if rate := fxRates[holding.CurrencyCode]; rate > 0 {
+			cashEUR += holding.Amount / rate
+		}
+	}
+
+	settings := models.PortfolioSettings{KellyCap: metricsConfig.KellyCap, MinCashBufferPct: services.DefaultMinCashBufferPct}
+	if err := h.db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+		h.logger.Error().Err(err).Msg("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	opts := services.OrderSizingOptions{
+		AvailableCashEUR:  cashEUR,
+		MaxPositionWeight: settings.KellyCap,
+		MinCashBufferPct:  settings.MinCashBufferPct,
+		MinTradeValueEUR:  settings.MinTradeValueEUR,
+		WeightStep:        settings.KellyRoundingStep,
+	}
+	if cashParam != nil {
+		opts.AvailableCashEUR = *cashParam
+	}
+
+	order, err := services.SuggestOrder(stocks[index], stocks, fxRates, cashEUR, opts)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
 // GetDeletedStocks returns all deleted stocks
 func (h *StockHandler) GetDeletedStocks(c *gin.Context) {
 	portfolioID, err := h.resolvePortfolioID(c)
@@ -1404,6 +1892,7 @@ func (h *StockHandler) BulkUpdateStocks(c *gin.Context) {
 	errors := []string{}
 
 	for _, stockData := range req.Stocks {
+		stockData.Ticker = services.StoredTicker(stockData.Ticker, h.cfg)
 		var existing models.Stock
 		err := h.db.Where("ticker = ? AND portfolio_id = ?", stockData.Ticker, portfolioID).First(&existing).Error
 
@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBulkUpdateStocksCreatesDefaultPortfolioForNewUser(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "stock-handler-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Portfolio{}, &models.Stock{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := models.User{Username: "newcomer", Password: "hash"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	// Another user's default portfolio must not receive the newcomer's stocks.
+	veteran := models.User{Username: "veteran", Password: "hash"}
+	if err := db.Create(&veteran).Error; err != nil {
+		t.Fatalf("create other user: %v", err)
+	}
+	if err := db.Create(&models.Portfolio{Name: "Veteran", IsDefault: true, UserID: veteran.ID}).Error; err != nil {
+		t.Fatalf("create other portfolio: %v", err)
+	}
+
+	h := NewStockHandler(db, &config.Config{AutoCreateDefaultPortfolio: true}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/stocks/bulk-update", strings.NewReader(`{"stocks":[{"ticker":"ACME","company_name":"Acme Corp","current_price":50,"currency":"USD"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("username", user.Username)
+
+	h.BulkUpdateStocks(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+
+	var portfolio models.Portfolio
+	if err := db.Where("user_id = ?", user.ID).First(&portfolio).Error; err != nil {
+		t.Fatalf("expected a default portfolio for the user: %v", err)
+	}
+	if !portfolio.IsDefault {
+		t.Error("expected the created portfolio to be the default")
+	}
+
+	var stock models.Stock
+	if err := db.Where("ticker = ?", "ACME").First(&stock).Error; err != nil {
+		t.Fatalf("load imported stock: %v", err)
+	}
+	if stock.PortfolioID != portfolio.ID {
+		t.Errorf("PortfolioID: got %d want %d", stock.PortfolioID, portfolio.ID)
+	}
+
+	// Reads without portfolio_id resolve to the same per-user portfolio, not the veteran's global default.
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/stocks", nil)
+	c.Set("username", user.Username)
+	h.GetAllStocks(c)
+	var listed []models.Stock
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode stocks: %v", err)
+	}
+	if w.Code != http.StatusOK || len(listed) != 1 || listed[0].Ticker != "ACME" {
+		t.Fatalf("GET /stocks: status %d, got %+v, want the newcomer's ACME", w.Code, listed)
+	}
+}
+
+func setupStockPatchTest(t *testing.T) (*gorm.DB, *StockHandler, models.Stock) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "stock-patch-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.ExchangeRate{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.25, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	// Stored derived values are deliberately stale so a recompute is observable.
+	stock := models.Stock{
+		PortfolioID: portfolio.ID, Ticker: "AAPL", CompanyName: "Apple", Currency: "USD",
+		CurrentPrice: 100, FairValue: 150, ProbabilityPositive: 0.8, DownsideRisk: -20, SharesOwned: 10,
+		ExpectedValue: 1, Assessment: "Sell",
+	}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	return db, NewStockHandler(db, &config.Config{}, zerolog.Nop()), stock
+}
+
+func patchStock(h *StockHandler, stockID uint, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPatch, "/stocks/"+strconv.FormatUint(uint64(stockID), 10), strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(stockID), 10)}}
+	h.PatchStock(c)
+	return w
+}
+
+func TestPatchStockSharesOnlyKeepsInputsAndRecomputes(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+
+	w := patchStock(h, stock.ID, `{"shares_owned":25}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.SharesOwned != 25 {
+		t.Errorf("shares_owned: got %d want 25", saved.SharesOwned)
+	}
+	if saved.FairValue != 150 || saved.ProbabilityPositive != 0.8 || saved.DownsideRisk != -20 {
+		t.Errorf("inputs changed: fair_value=%.2f probability=%.2f downside=%.2f", saved.FairValue, saved.ProbabilityPositive, saved.DownsideRisk)
+	}
+	// EV = 0.8*50 + 0.2*(-20) = 36
+	if math.Abs(saved.ExpectedValue-36) > 1e-9 {
+		t.Errorf("expected_value: got %.4f want 36 (recomputed)", saved.ExpectedValue)
+	}
+	if saved.Assessment == "Sell" {
+		t.Error("expected assessment to be recomputed")
+	}
+	// 25 * 100 USD = 2000 EUR = 2500 USD
+	if math.Abs(saved.CurrentValueUSD-2500) > 0.01 {
+		t.Errorf("current_value_usd: got %.2f want 2500", saved.CurrentValueUSD)
+	}
+}
+
+func TestPatchStockRejectsDerivedFields(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+
+	w := patchStock(h, stock.ID, `{"shares_owned":25,"expected_value":50}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status: got %d want 400, body %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "expected_value") {
+		t.Errorf("expected the rejected field to be listed, body %s", w.Body.String())
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.SharesOwned != 10 {
+		t.Errorf("shares_owned: got %d want unchanged 10", saved.SharesOwned)
+	}
+}
+
+func TestPatchStockProbabilityMarksItManual(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+
+	if w := patchStock(h, stock.ID, `{"probability_positive":0.7}`); w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.ProbabilityPositive != 0.7 || !saved.ProbabilityManual {
+		t.Fatalf("after editing p: probability=%.2f manual=%v, want 0.70 manual", saved.ProbabilityPositive, saved.ProbabilityManual)
+	}
+
+	// Clearing the flag hands p back to analyst-rating re-estimation.
+	if w := patchStock(h, stock.ID, `{"probability_manual":false}`); w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.ProbabilityManual {
+		t.Error("expected probability_manual to be cleared")
+	}
+	if w := patchStock(h, stock.ID, `{"probability_manual":"yes"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("non-boolean probability_manual: got %d want 400", w.Code)
+	}
+}
+
+func TestCreateStockAutoAddsUntrackedCurrency(t *testing.T) {
+	t.Parallel()
+	db, h, _ := setupStockPatchTest(t)
+	h.cfg.AutoAddCurrencies = true
+	h.exchangeRateService.SetProvider("https://fx.test/v6", "test-key", &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"result":"success","base_code":"EUR","conversion_rates":{"EUR":1,"USD":1.25,"CHF":0.95}}`)),
+			Request:    req,
+		}, nil
+	})})
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/stocks", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.CreateStock(c)
+		return w
+	}
+
+	// No stock data provider is configured, so creation itself fails afterwards with 502; the
+	// currency is registered before that fetch runs.
+	if w := create(`{"ticker":"NOVN","company_name":"Novartis","sector":"Healthcare","currency":"CHF","shares_owned":10}`); w.Code == http.StatusBadRequest {
+		t.Fatalf("status: got 400 for a provider-quoted currency, body %s", w.Body.String())
+	}
+	var rate models.ExchangeRate
+	if err := db.Where("currency_code = ?", "CHF").First(&rate).Error; err != nil {
+		t.Fatalf("expected CHF to be registered: %v", err)
+	}
+	if rate.Rate != 0.95 || !rate.IsActive || rate.IsManual {
+		t.Errorf("CHF rate: got %.2f active=%v manual=%v, want 0.95 active, not manual", rate.Rate, rate.IsActive, rate.IsManual)
+	}
+
+	w := create(`{"ticker":"XYZ","company_name":"Unquoted","sector":"Technology","currency":"ZZZ"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "POST /exchange-rates") {
+		t.Fatalf("unsupported currency: got %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetStockEnqueuesRefreshForStaleStockWithoutBlocking(t *testing.T) {
+	t.Parallel()
+	db, _, stock := setupStockPatchTest(t)
+	cfg := &config.Config{StaleRefreshOnRead: true, StaleRefreshMaxAgeHours: 24, StaleRefreshCooldownMinutes: 60, StaleRefreshMaxPerHour: 10}
+	h := NewStockHandler(db, cfg, zerolog.Nop())
+	release := make(chan struct{})
+	refreshed := make(chan uint, 2)
+	h.staleRefresher.refresh = func(stockID uint) {
+		<-release
+		refreshed <- stockID
+	}
+
+	getStock := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/stocks/"+strconv.FormatUint(uint64(stock.ID), 10), nil)
+		c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(uint64(stock.ID), 10)}}
+		h.GetStock(c)
+		return w
+	}
+
+	// The refresh is still blocked, so GetStock returning at all shows it did not wait for it.
+	w := getStock()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Ticker     string `json:"ticker"`
+		Refreshing bool   `json:"refreshing"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Ticker != "AAPL" || !resp.Refreshing {
+		t.Fatalf("expected stale AAPL data flagged refreshing, got %s", w.Body.String())
+	}
+
+	// A second read while the first refresh runs (and within the cooldown) does not enqueue again.
+	if w := getStock(); strings.Contains(w.Body.String(), `"refreshing"`) {
+		t.Fatalf("expected no second refresh, got %s", w.Body.String())
+	}
+
+	close(release)
+	select {
+	case id := <-refreshed:
+		if id != stock.ID {
+			t.Fatalf("refreshed stock %d, want %d", id, stock.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("background refresh never ran")
+	}
+	select {
+	case id := <-refreshed:
+		t.Fatalf("unexpected second refresh of stock %d", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAverageDownChecksTrackedStockAtLowerPrice(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/calculations/average-down", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.AverageDown(c)
+		return w
+	}
+
+	// AAPL at 100 with fair value 150 and p 0.8: EV 36% now, 0.8*87.5 - 0.2*20 = 66% at 80.
+	w := post(`{"ticker":"aapl","price":80}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var check struct {
+		CurrentEV float64 `json:"current_ev"`
+		NewEV     float64 `json:"new_ev"`
+		Eligible  bool    `json:"eligible"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &check); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !check.Eligible || math.Abs(check.CurrentEV-36) > 1e-9 || math.Abs(check.NewEV-66) > 1e-9 {
+		t.Errorf("unexpected check: %+v", check)
+	}
+
+	if w := post(`{"ticker":"MSFT","price":80}`); w.Code != http.StatusNotFound {
+		t.Errorf("untracked ticker: got %d want 404", w.Code)
+	}
+	if w := post(`{"ticker":"AAPL","price":0}`); w.Code != http.StatusBadRequest {
+		t.Errorf("zero price: got %d want 400", w.Code)
+	}
+
+	// With normalization on, a share-class ticker finds the stock stored in canonical form.
+	h.cfg.NormalizeTickers = true
+	if err := db.Model(&stock).Update("ticker", "BRK-B").Error; err != nil {
+		t.Fatalf("rename stock: %v", err)
+	}
+	if w := post(`{"ticker":"brk.b","price":80}`); w.Code != http.StatusOK {
+		t.Errorf("non-canonical ticker: got %d want 200, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetStockHistoryMetricSeries(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+	if err := db.AutoMigrate(&models.StockHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Monday twice, Wednesday, then the next Monday; the last row is outside the requested range.
+	for _, row := range []struct {
+		at string
+		ev float64
+	}{
+		{"2026-03-02T15:00:00Z", 12},
+		{"2026-03-02T10:00:00Z", 10},
+		{"2026-03-04T10:00:00Z", 14},
+		{"2026-03-09T10:00:00Z", 16},
+		{"2026-03-20T10:00:00Z", 18},
+	} {
+		recordedAt, _ := time.Parse(time.RFC3339, row.at)
+		history := models.StockHistory{StockID: stock.ID, PortfolioID: stock.PortfolioID, Ticker: stock.Ticker, ExpectedValue: row.ev, CurrentPrice: 100, RecordedAt: recordedAt}
+		if err := db.Create(&history).Error; err != nil {
+			t.Fatalf("create history: %v", err)
+		}
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(stock.ID)}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/stocks/1/history?"+query, nil)
+		h.GetStockHistory(c)
+		return w
+	}
+
+	for _, tc := range []struct {
+		granularity string
+		want        []float64
+	}{
+		{"", []float64{10, 12, 14, 16}},
+		{"daily", []float64{12, 14, 16}},
+		{"weekly", []float64{14, 16}},
+	} {
+		w := get("metric=ev&from=2026-03-01&to=2026-03-15&granularity=" + tc.granularity)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q status: got %d, body %s", tc.granularity, w.Code, w.Body.String())
+		}
+		var points []StockHistoryPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		got := make([]float64, len(points))
+		for i, point := range points {
+			got[i] = point.Value
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%q series: got %v want %v", tc.granularity, got, tc.want)
+		}
+	}
+
+	if w := get("metric=beta"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown metric: got %d want 400", w.Code)
+	}
+	if w := get("metric=ev&granularity=monthly"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown granularity: got %d want 400", w.Code)
+	}
+}
+
+func TestGetStockHistoryMetricSeriesCapsPoints(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+	if err := db.AutoMigrate(&models.StockHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Three snapshots a day for 500 days; the last one of each day has EV equal to the day index.
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var rows []models.StockHistory
+	for day := 0; day < 500; day++ {
+		for _, hour := range []int{9, 13, 17} {
+			rows = append(rows, models.StockHistory{StockID: stock.ID, PortfolioID: stock.PortfolioID, Ticker: stock.Ticker, ExpectedValue: float64(day), RecordedAt: start.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour)})
+		}
+	}
+	if err := db.CreateInBatches(rows, 500).Error; err != nil {
+		t.Fatalf("create history: %v", err)
+	}
+
+	get := func(query string) []StockHistoryPoint {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(stock.ID)}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/stocks/1/history?"+query, nil)
+		h.GetStockHistory(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, body %s", query, w.Code, w.Body.String())
+		}
+		var points []StockHistoryPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return points
+	}
+
+	// 500 days of daily buckets exceed the cap, so each bucket widens to two days.
+	daily := get("metric=ev&granularity=daily&from=2025-01-01&to=2026-05-15")
+	if len(daily) != 250 || daily[0].Value != 1 || daily[249].Value != 499 {
+		t.Fatalf("daily: got %d points from %v to %v, want 250 two-day buckets", len(daily), daily[0], daily[len(daily)-1])
+	}
+
+	// 600 raw snapshots over 200 days exceed the cap, so they are bucketed by day.
+	raw := get("metric=ev&from=2025-01-01&to=2025-07-19")
+	if len(raw) != 200 || raw[0].Value != 0 || raw[0].RecordedAt.Hour() != 17 {
+		t.Fatalf("raw: got %d points starting %v, want the last snapshot of each of 200 days", len(raw), raw[0])
+	}
+
+	// A short raw range stays unbucketed.
+	if short := get("metric=ev&from=2025-01-01&to=2025-01-02"); len(short) != 6 {
+		t.Fatalf("short raw range: got %d points want 6", len(short))
+	}
+}
+
+func TestGetStockHistoryEndOfDayExcludesIntradayPoints(t *testing.T) {
+	t.Parallel()
+	db, h, stock := setupStockPatchTest(t)
+	if err := db.AutoMigrate(&models.StockHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, row := range []struct {
+		at        string
+		ev        float64
+		priceType string
+	}{
+		{"2026-03-02T21:05:00Z", 10, services.PriceTypeEndOfDay},
+		{"2026-03-03T14:00:00Z", 11, services.PriceTypeIntraday},
+		{"2026-03-03T21:05:00Z", 12, services.PriceTypeEndOfDay},
+		{"2026-03-04T15:30:00Z", 13, services.PriceTypeIntraday},
+	} {
+		recordedAt, _ := time.Parse(time.RFC3339, row.at)
+		history := models.StockHistory{StockID: stock.ID, PortfolioID: stock.PortfolioID, Ticker: stock.Ticker, ExpectedValue: row.ev, PriceType: row.priceType, RecordedAt: recordedAt}
+		if err := db.Create(&history).Error; err != nil {
+			t.Fatalf("create history: %v", err)
+		}
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(stock.ID)}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/stocks/1/history?"+query, nil)
+		h.GetStockHistory(c)
+		return w
+	}
+
+	for query, want := range map[string][]float64{
+		"metric=ev&from=2026-03-01&to=2026-03-10":                 {10, 11, 12, 13},
+		"metric=ev&from=2026-03-01&to=2026-03-10&end_of_day=true": {10, 12},
+	} {
+		w := get(query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s status: got %d, body %s", query, w.Code, w.Body.String())
+		}
+		var points []StockHistoryPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		got := make([]float64, len(points))
+		for i, point := range points {
+			got[i] = point.Value
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s series: got %v want %v", query, got, want)
+		}
+	}
+
+	w := get("end_of_day=true")
+	var rows []models.StockHistory
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("decode raw history: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("raw end-of-day rows: got %d want 2", len(rows))
+	}
+	for _, row := range rows {
+		if row.PriceType != services.PriceTypeEndOfDay {
+			t.Errorf("raw row at %s: got price_type %q want end_of_day", row.RecordedAt, row.PriceType)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// stockPatchValidator checks a JSON value for a patchable field and returns the value to store.
+type stockPatchValidator func(value interface{}) (interface{}, error)
+
+// patchableStockFields are the user-editable inputs accepted by PATCH /stocks/:id, keyed by JSON name
+// (which is also the column name).
+var patchableStockFields = map[string]stockPatchValidator{
+	"ticker":               patchTicker,
+	"display_ticker":       patchString,
+	"company_name":         patchNonEmptyString,
+	"isin":                 patchString,
+	"sector":               patchString,
+	"industry":             patchString,
+	"currency":             patchCurrency,
+	"current_price":        patchNumber(0, math.Inf(1)),
+	"fair_value":           patchNumber(0, math.Inf(1)),
+	"avg_price_local":      patchNumber(0, math.Inf(1)),
+	"shares_owned":         patchShares,
+	"probability_positive": patchNumber(0, 1),
+	"probability_manual":   patchBool,
+	"downside_risk":        patchNumber(math.Inf(-1), 0),
+	"beta":                 patchNumber(0, math.Inf(1)),
+	"volatility":           patchNumber(0, math.Inf(1)),
+	"pe_ratio":             patchNumber(0, math.Inf(1)),
+	"eps_growth_rate":      patchNumber(math.Inf(-1), math.Inf(1)),
+	"debt_to_ebitda":       patchNumber(0, math.Inf(1)),
+	"dividend_yield":       patchNumber(0, math.Inf(1)),
+	"update_frequency":     patchUpdateFrequency,
+	"assessment_frequency": patchAssessmentFrequency,
+	"data_source":          patchString,
+	"fair_value_source":    patchString,
+	"comment":              patchString,
+	"purchased_at":         patchPurchasedAt,
+	"tags":                 patchTags,
+}
+
+// derivedStockFields are computed by CalculateMetrics, the summary or the server and cannot be patched.
+var derivedStockFields = map[string]struct{}{
+	"id":                          {},
+	"portfolio_id":                {},
+	"upside_potential":            {},
+	"expected_value":              {},
+	"b_ratio":                     {},
+	"kelly_fraction":              {},
+	"half_kelly_suggested":        {},
+	"current_value_usd":           {},
+	"weight":                      {},
+	"unrealized_pnl":              {},
+	"buy_zone_min":                {},
+	"buy_zone_max":                {},
+	"buy_zone_status":             {},
+	"sell_zone_lower_bound":       {},
+	"sell_zone_upper_bound":       {},
+	"sell_zone_status":            {},
+	"assessment":                  {},
+	"derived_tags":                {},
+	"shadow_expected_value":       {},
+	"shadow_half_kelly_suggested": {},
+	"shadow_assessment":           {},
+	"data_quality":                {},
+	"ev_low":                      {},
+	"ev_mid":                      {},
+	"ev_high":                     {},
+	"ev_confidence":               {},
+	"data_aging_warning":          {},
+	"trading_status":              {},
+	"analyst_strong_buy":          {},
+	"analyst_buy":                 {},
+	"analyst_hold":                {},
+	"analyst_sell":                {},
+	"analyst_strong_sell":         {},
+	"analyst_ratings_at":          {},
+	"last_assessed_at":            {},
+	"last_updated":                {},
+	"created_at":                  {},
+	"updated_at":                  {},
+}
+
+// PatchStock applies only the provided fields to a stock, leaving every other field (including manual
+// probability and downside overrides) untouched, then recomputes derived metrics. Derived fields and
+// unknown fields are rejected.
+func (h *StockHandler) PatchStock(c *gin.Context) {
+	id := c.Param("id")
+	portfolioID, err := h.resolvePortfolioID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid portfolio_id"})
+		return
+	}
+
+	var stock models.Stock
+	if err := h.db.Where("id = ? AND portfolio_id = ?", id, portfolioID).First(&stock).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
+		return
+	}
+
+	var req map[string]interface{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if len(req) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+		return
+	}
+
+	var derived, unknown []string
+	invalid := make(map[string]string)
+	updates := make(map[string]interface{}, len(req))
+	for field, value := range req {
+		if _, ok := derivedStockFields[field]; ok {
+			derived = append(derived, field)
+			continue
+		}
+		validate, ok := patchableStockFields[field]
+		if !ok {
+			unknown = append(unknown, field)
+			continue
+		}
+		normalized, err := validate(value)
+		if err != nil {
+			invalid[field] = err.Error()
+			continue
+		}
+		updates[field] = normalized
+	}
+	if len(derived) > 0 {
+		sort.Strings(derived)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Derived fields cannot be patched; they are recomputed from inputs", "fields": derived})
+		return
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown fields", "fields": unknown})
+		return
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid field values", "fields": invalid})
+		return
+	}
+	markManualProbability(updates)
+
+	if ticker, ok := updates["ticker"].(string); ok {
+		var existing models.Stock
+		if err := h.db.Where("portfolio_id = ? AND id <> ? AND UPPER(ticker) = ?", stock.PortfolioID, stock.ID, ticker).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Stock with this ticker already exists in the selected portfolio"})
+			return
+		} else if err != gorm.ErrRecordNotFound {
+			h.logger.Error().Err(err).Msg("Failed to validate ticker uniqueness")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate ticker"})
+			return
+		}
+	}
+
+	if err := h.db.Model(&stock).Updates(updates).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to patch stock")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+		return
+	}
+	if err := h.db.First(&stock, stock.ID).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to reload patched stock")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+		return
+	}
+
+	services.CalculateMetrics(&stock, services.PortfolioMetricsConfig(h.db, stock.PortfolioID))
+	if err := h.updateStockUSDValues(&stock); err != nil {
+		h.logger.Warn().Err(err).Str("currency", stock.Currency).Msg("Failed to convert patched stock values, keeping previous USD values")
+	}
+	stock.LastUpdated = time.Now()
+	if err := h.db.Save(&stock).Error; err != nil {
+		h.logger.Error().Err(err).Msg("Failed to save patched stock")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+		return
+	}
+
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	h.logger.Info().Str("ticker", stock.Ticker).Strs("fields", fields).Msg("Stock patched")
+
+	c.JSON(http.StatusOK, stock)
+}
+
+func patchNumber(min, max float64) stockPatchValidator {
+	return func(value interface{}) (interface{}, error) {
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("must be a number")
+		}
+		if number < min || number > max {
+			return nil, fmt.Errorf("must be between %g and %g", min, max)
+		}
+		return number, nil
+	}
+}
+
+func patchBool(value interface{}) (interface{}, error) {
+	flag, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("must be true or false")
+	}
+	return flag, nil
+}
+
+// markManualProbability flags a hand-edited probability_positive as manual, so analyst-rating
+// re-estimation keeps it, unless the update sets probability_manual itself.
+func markManualProbability(updates map[string]interface{}) {
+	if _, ok := updates["probability_positive"]; !ok {
+		return
+	}
+	if _, ok := updates["probability_manual"]; !ok {
+		updates["probability_manual"] = true
+	}
+}
+
+func patchShares(value interface{}) (interface{}, error) {
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, fmt.Errorf("must be a non-negative whole number")
+	}
+	return int(number), nil
+}
+
+func patchString(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("must be a string")
+	}
+	return text, nil
+}
+
+func patchNonEmptyString(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok || strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("must be a non-empty string")
+	}
+	return text, nil
+}
+
+func patchTicker(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	ticker := strings.ToUpper(strings.TrimSpace(text))
+	if !ok || ticker == "" {
+		return nil, fmt.Errorf("must be a non-empty string")
+	}
+	return ticker, nil
+}
+
+func patchCurrency(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	currency := strings.ToUpper(strings.TrimSpace(text))
+	if !ok || len(currency) != 3 {
+		return nil, fmt.Errorf("must be a 3-letter code")
+	}
+	return currency, nil
+}
+
+func patchUpdateFrequency(value interface{}) (interface{}, error) {
+	text, _ := value.(string)
+	frequency := normalizeUpdateFrequency(text)
+	if frequency == "" {
+		return nil, fmt.Errorf("must be daily, weekly, monthly or manually")
+	}
+	return frequency, nil
+}
+
+func patchAssessmentFrequency(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	frequency := services.NormalizeAssessmentFrequency(text)
+	if !ok || frequency == "" {
+		return nil, fmt.Errorf("must be none, weekly or monthly")
+	}
+	return frequency, nil
+}
+
+func patchPurchasedAt(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		parsed, err := parsePurchasedAt(v)
+		if err != nil {
+			return nil, fmt.Errorf("use YYYY-MM-DD or RFC3339")
+		}
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("use YYYY-MM-DD or RFC3339")
+}
+
+func patchTags(value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("must be a comma-separated string")
+	}
+	return normalizeTags(text), nil
+}
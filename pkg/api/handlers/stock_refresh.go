@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// staleRefresher runs background stock refreshes triggered by reads of stale stocks. Each stock is
+// queued at most once per cooldown and never while its previous refresh is running, and at most
+// maxPerHour refreshes start in any rolling hour.
+type staleRefresher struct {
+	mu         sync.Mutex
+	maxAge     time.Duration
+	cooldown   time.Duration
+	maxPerHour int                // 0 = unlimited
+	lastQueued map[uint]time.Time // Stock ID -> last enqueue
+	inFlight   map[uint]bool      // Stock IDs being refreshed
+	started    []time.Time        // Enqueue times within the last hour, oldest first
+	now        func() time.Time
+	refresh    func(stockID uint) // Runs in its own goroutine
+}
+
+// newStaleRefresher returns a refresher configured from STALE_REFRESH_*, or nil when refresh on read is off.
+func newStaleRefresher(cfg *config.Config, refresh func(stockID uint)) *staleRefresher {
+	if cfg == nil || !cfg.StaleRefreshOnRead {
+		return nil
+	}
+	return &staleRefresher{
+		maxAge:     time.Duration(cfg.StaleRefreshMaxAgeHours) * time.Hour,
+		cooldown:   time.Duration(cfg.StaleRefreshCooldownMinutes) * time.Minute,
+		maxPerHour: cfg.StaleRefreshMaxPerHour,
+		lastQueued: make(map[uint]time.Time),
+		inFlight:   make(map[uint]bool),
+		now:        time.Now,
+		refresh:    refresh,
+	}
+}
+
+// maybeRefresh enqueues a background refresh when stock is older than maxAge, is not updated
+// manually, and the cooldown and hourly budget allow it. It never blocks on the refresh and
+// reports whether one was enqueued.
+func (r *staleRefresher) maybeRefresh(stock *models.Stock) bool {
+	if r == nil || stock.UpdateFrequency == "manually" {
+		return false
+	}
+	now := r.now()
+	if now.Sub(stock.LastUpdated) < r.maxAge {
+		return false
+	}
+
+	r.mu.Lock()
+	if r.inFlight[stock.ID] {
+		r.mu.Unlock()
+		return false
+	}
+	if last, ok := r.lastQueued[stock.ID]; ok && now.Sub(last) < r.cooldown {
+		r.mu.Unlock()
+		return false
+	}
+	cutoff := now.Add(-time.Hour)
+	for len(r.started) > 0 && !r.started[0].After(cutoff) {
+		r.started = r.started[1:]
+	}
+	if r.maxPerHour > 0 && len(r.started) >= r.maxPerHour {
+		r.mu.Unlock()
+		return false
+	}
+	r.started = append(r.started, now)
+	r.lastQueued[stock.ID] = now
+	r.inFlight[stock.ID] = true
+	r.mu.Unlock()
+
+	go func(stockID uint) {
+		defer func() {
+			r.mu.Lock()
+			delete(r.inFlight, stockID)
+			r.mu.Unlock()
+		}()
+		r.refresh(stockID)
+	}(stock.ID)
+	return true
+}
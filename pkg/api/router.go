@@ -1,9 +1,14 @@
 package api
 
 import (
+	"os"
+	"time"
+
 	"github.com/art-pro/stock-backend/pkg/api/handlers"
 	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/database"
 	"github.com/art-pro/stock-backend/pkg/middleware"
+	"github.com/art-pro/stock-backend/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
@@ -15,6 +20,34 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Outbound provider calls (LLMs, prices, FX) share one rate/concurrency limiter.
+	services.ConfigureProviderRateLimits(cfg.ProviderRateLimits)
+
+	// Every provider request is logged (API keys redacted) when PROVIDER_CALL_LOG selects a sink.
+	if sink, err := services.NewProviderCallSinkFromConfig(cfg, db, os.Stdout); err != nil {
+		logger.Error().Err(err).Msg("Provider call log disabled")
+	} else if sink != nil {
+		services.SharedProviderCallLedger().Configure(sink, services.ProviderSecretsFromConfig(cfg), func(err error) {
+			logger.Warn().Err(err).Msg("Failed to record provider call")
+		})
+	}
+
+	// A provider rejecting its API key raises one provider_auth_failed alert on the default portfolio.
+	if cfg.ProviderAuthAlerts {
+		dedupWindow := time.Duration(cfg.ProviderAuthAlertDedupHours) * time.Hour
+		services.SharedProviderHealth().SetAuthFailureHandler(func(provider string, statusCode int) {
+			logger.Error().Str("provider", provider).Int("status", statusCode).Msg("Provider rejected its API key")
+			portfolioID, err := database.GetDefaultPortfolioID(db)
+			if err != nil {
+				logger.Warn().Err(err).Str("provider", provider).Msg("No portfolio for provider auth alert")
+				return
+			}
+			if _, err := services.RaiseProviderAuthAlert(db, portfolioID, provider, statusCode, time.Now(), dedupWindow); err != nil {
+				logger.Warn().Err(err).Str("provider", provider).Msg("Failed to raise provider auth alert")
+			}
+		})
+	}
+
 	router := gin.New()
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
@@ -49,7 +82,8 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		}
 
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Requested-With, X-API-Key")
+		c.Header("Access-Control-Expose-Headers", "X-Total-Count")
 		c.Header("Access-Control-Allow-Credentials", "true")
 		c.Header("Access-Control-Max-Age", "43200")
 
@@ -68,10 +102,14 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 	portfolioHandler := handlers.NewPortfolioHandler(db, cfg, logger)
 	exchangeRateHandler := handlers.NewExchangeRateHandler(db, cfg, logger)
 	cashHandler := handlers.NewCashHandler(db, cfg, logger)
-	operationHandler := handlers.NewOperationHandler(db, cashHandler, logger)
+	operationHandler := handlers.NewOperationHandler(db, cfg, cashHandler, logger)
+	orderHandler := handlers.NewOrderHandler(db, operationHandler, logger)
 	assessmentHandler := handlers.NewAssessmentHandler(db, cfg, logger)
 	settingsHandler := handlers.NewSettingsHandler(db, logger)
 	analyticsHandler := handlers.NewAnalyticsHandler(db, logger)
+	schedulerHandler := handlers.NewSchedulerHandler(db, logger)
+	backupHandler := handlers.NewBackupHandler(db, logger)
+	calculationsHandler := handlers.NewCalculationsHandler(logger)
 
 	// Public routes
 	public := router.Group("/api")
@@ -88,15 +126,28 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		})
 	}
 
+	// Read routes that PUBLIC_READ opens to anonymous visitors (default portfolio only); with
+	// PUBLIC_READ off they require auth like every other protected route.
+	publicRead := router.Group("/api")
+	publicRead.Use(middleware.OptionalAuthMiddleware(cfg, db))
+	{
+		publicRead.GET("/portfolio/summary", portfolioHandler.GetPortfolioSummary)
+		publicRead.GET("/stocks/:id/history", stockHandler.GetStockHistory)
+		publicRead.GET("/portfolio/ev-history", analyticsHandler.GetEVHistory)
+	}
+
 	// Protected routes with default 1MB body limit
 	protected := router.Group("/api")
-	protected.Use(middleware.AuthMiddleware(cfg))
+	protected.Use(middleware.AuthMiddleware(cfg, db))
 	protected.Use(middleware.RequestSizeLimitMiddleware(1 << 20)) // 1 MB default
 	{
 		// Auth routes
 		protected.POST("/logout", authHandler.Logout)
 		protected.POST("/change-password", authHandler.ChangePassword)
 		protected.POST("/change-username", authHandler.ChangeUsername)
+		protected.POST("/auth/api-keys", authHandler.CreateAPIKey)
+		protected.GET("/auth/api-keys", authHandler.ListAPIKeys)
+		protected.DELETE("/auth/api-keys/:id", authHandler.RevokeAPIKey)
 		protected.GET("/me", authHandler.GetCurrentUser)
 
 		// Stock routes
@@ -105,6 +156,7 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		protected.GET("/stocks/:id", stockHandler.GetStock)
 		protected.POST("/stocks", stockHandler.CreateStock)
 		protected.PUT("/stocks/:id", stockHandler.UpdateStock)
+		protected.PATCH("/stocks/:id", stockHandler.PatchStock)
 		protected.PATCH("/stocks/:id/price", stockHandler.UpdateStockPrice)
 		protected.POST("/stocks/:id/latest-price", stockHandler.UpdateLatestPrice)
 		protected.PATCH("/stocks/:id/field", stockHandler.UpdateStockField)
@@ -116,21 +168,38 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		protected.POST("/stocks/bulk-latest-price", stockHandler.BulkUpdateLatestPrices)
 
 		// Stock history routes
-		protected.GET("/stocks/:id/history", stockHandler.GetStockHistory)
 		protected.GET("/stocks/:id/fair-value-history", stockHandler.GetFairValueHistory)
+		protected.GET("/stocks/:id/ev-range", stockHandler.GetEVRange)
+		protected.GET("/stocks/:id/suggested-order", stockHandler.GetSuggestedOrder)
 
 		// Deleted stocks (log) routes
 		protected.GET("/deleted-stocks", stockHandler.GetDeletedStocks)
 		protected.POST("/deleted-stocks/:id/restore", stockHandler.RestoreStock)
 
 		// Portfolio routes
-		protected.GET("/portfolio/summary", portfolioHandler.GetPortfolioSummary)
 		protected.GET("/portfolio/settings", portfolioHandler.GetSettings)
 		protected.PUT("/portfolio/settings", portfolioHandler.UpdateSettings)
+		protected.POST("/portfolio/mark-reviewed", portfolioHandler.MarkReviewed)
+		protected.GET("/portfolio/shadow-diff", portfolioHandler.GetShadowDiff)
+		protected.GET("/portfolio/holding-periods", portfolioHandler.GetHoldingPeriods)
+		protected.GET("/portfolio/rebalance", portfolioHandler.GetRebalanceRecommendation)
+		protected.GET("/portfolio/rebalance/plan", portfolioHandler.GetRebalancePlan)
+		protected.GET("/portfolio/rebalance/kelly-utilization", portfolioHandler.GetKellyUtilizationRecommendation)
+		protected.GET("/portfolio/currency-exposure", portfolioHandler.GetCurrencyExposure)
+		protected.GET("/portfolio/consolidated", portfolioHandler.GetConsolidatedPortfolio)
+		protected.GET("/portfolio/health", portfolioHandler.GetPortfolioHealth)
+		protected.GET("/portfolio/vs-benchmark", portfolioHandler.GetVsBenchmark)
+		protected.GET("/portfolio/history", portfolioHandler.GetPortfolioHistory)
+		protected.GET("/portfolio/twr", portfolioHandler.GetTimeWeightedReturn)
+		protected.GET("/portfolio/irr", portfolioHandler.GetMoneyWeightedReturn)
 
 		// API Status routes
 		protected.GET("/api-status", portfolioHandler.GetAPIStatus)
 
+		// Scheduler run reports
+		protected.GET("/scheduler/runs", schedulerHandler.GetRuns)
+		protected.GET("/scheduler/runs/:id", schedulerHandler.GetRun)
+
 		// Export routes
 		protected.GET("/export/json", stockHandler.ExportJSON)
 
@@ -158,16 +227,27 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		protected.DELETE("/operations/:id", operationHandler.DeleteOperation)
 		protected.PUT("/operations/:id", operationHandler.UpdateOperation)
 
+		// Limit order routes
+		protected.POST("/orders", orderHandler.CreateOrder)
+		protected.GET("/orders", orderHandler.ListOrders)
+		protected.PUT("/orders/:id", orderHandler.UpdateOrder)
+
 		// Assessment routes (text-based)
 		protected.POST("/assessment/request", assessmentHandler.RequestAssessment)
 		protected.POST("/assessment/batch", assessmentHandler.BatchAssessment)
 		protected.POST("/assessment/explain", assessmentHandler.ExplainAssessment)
 		protected.POST("/assessment/sector-summary", assessmentHandler.SectorSummary)
 		protected.POST("/assessment/compare", assessmentHandler.CompareAssessments)
+		protected.POST("/assessment/recommend-source", assessmentHandler.RecommendSource)
+		protected.POST("/assessments/compare", assessmentHandler.CompareProviders)
+		protected.POST("/assessments/stream", assessmentHandler.StreamAssessment)
+		protected.DELETE("/assessments/:id", assessmentHandler.DeleteAssessment)
+		protected.DELETE("/assessments", assessmentHandler.PruneAssessments)
 		protected.GET("/assessment/recent", assessmentHandler.GetRecentAssessments)
 		protected.GET("/assessment/ticker/:ticker", assessmentHandler.GetAssessmentsByTicker)
 		protected.GET("/assessment/ticker/:ticker/diff", assessmentHandler.GetAssessmentDiffByTicker)
 		protected.GET("/assessment/:id", assessmentHandler.GetAssessmentById)
+		protected.GET("/assessments/:id/export", assessmentHandler.ExportAssessment)
 
 		// User Settings routes
 		protected.GET("/settings/columns", settingsHandler.GetColumnSettings)
@@ -178,14 +258,28 @@ func SetupRouter(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *gin.En
 		// Analytics routes
 		protected.GET("/analytics/top-movers", analyticsHandler.GetTopMovers)
 		protected.GET("/analytics/top-losers", analyticsHandler.GetTopLosers)
+
+		// Calculator routes
+		protected.POST("/calculations/buy-zone", calculationsHandler.BuyZone)
+		protected.POST("/calculations/monte-carlo", calculationsHandler.MonteCarlo)
+		protected.POST("/calculations/average-down", stockHandler.AverageDown)
+	}
+
+	// Admin routes: the admin user only
+	admin := protected.Group("/admin")
+	admin.Use(middleware.AdminMiddleware(cfg))
+	{
+		admin.POST("/recompute", portfolioHandler.RecomputeMetrics)
+		admin.GET("/export", backupHandler.ExportBackup)
 	}
 
 	// Large payload routes (image uploads) with 100MB limit
 	largePayload := router.Group("/api")
-	largePayload.Use(middleware.AuthMiddleware(cfg))
+	largePayload.Use(middleware.AuthMiddleware(cfg, db))
 	largePayload.Use(middleware.RequestSizeLimitMiddleware(100 << 20)) // 100 MB for image uploads
 	{
 		largePayload.POST("/assessment/extract-from-images", assessmentHandler.ExtractFromImages)
+		largePayload.POST("/admin/import", middleware.AdminMiddleware(cfg), backupHandler.ImportBackup)
 	}
 
 	return router
@@ -1,6 +1,74 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Use-case keys for ProviderModels.
+const (
+	UseCaseAssessment = "assessment"
+	UseCaseFairValue  = "fair_value"
+	UseCaseVision     = "vision"
+	UseCaseStockData  = "stock_data"
+)
+
+// defaultProviderModels returns the built-in use-case -> provider -> model mapping.
+// Each entry can be overridden with env <USE_CASE>_MODEL_<PROVIDER>, e.g. FAIR_VALUE_MODEL_GROK.
+func defaultProviderModels() map[string]map[string]string {
+	return map[string]map[string]string{
+		UseCaseAssessment: {
+			"grok":       "grok-4-1-fast-reasoning-latest",
+			"deepseek":   "deepseek-reasoner",
+			"perplexity": "sonar-pro",
+			"chatgpt":    "gpt-5.4",
+			"claude":     "claude-sonnet-4-5",
+		},
+		UseCaseFairValue: {
+			"grok":     "grok-4-fast-reasoning",
+			"deepseek": "deepseek-reasoner",
+		},
+		UseCaseVision: {
+			"grok":     "grok-2-vision-latest",
+			"deepseek": "deepseek-chat",
+		},
+		UseCaseStockData: {
+			"grok": "grok-4-fast-reasoning",
+		},
+	}
+}
+
+// ProviderRateLimit bounds outbound calls to one external provider. Zero values mean unlimited.
+type ProviderRateLimit struct {
+	RequestsPerMinute int // Requests started in any rolling 60s window
+	MaxConcurrent     int // Requests in flight at once
+}
+
+// defaultProviderRateLimits returns the built-in provider -> limit mapping.
+// Each entry can be overridden with env <PROVIDER>_REQUESTS_PER_MINUTE and <PROVIDER>_MAX_CONCURRENT,
+// e.g. ALPHAVANTAGE_REQUESTS_PER_MINUTE.
+func defaultProviderRateLimits() map[string]ProviderRateLimit {
+	return map[string]ProviderRateLimit{
+		"grok":          {RequestsPerMinute: 60, MaxConcurrent: 4},
+		"deepseek":      {RequestsPerMinute: 60, MaxConcurrent: 4},
+		"perplexity":    {RequestsPerMinute: 50, MaxConcurrent: 2},
+		"chatgpt":       {RequestsPerMinute: 60, MaxConcurrent: 4},
+		"claude":        {RequestsPerMinute: 50, MaxConcurrent: 4},
+		"alphavantage":  {RequestsPerMinute: 5, MaxConcurrent: 1}, // Free tier
+		"exchangerates": {RequestsPerMinute: 30, MaxConcurrent: 2},
+		"frankfurter":   {RequestsPerMinute: 30, MaxConcurrent: 2},
+	}
+}
+
+// DataQualityWeights are the relative weights of each input to a stock's 0–100 data-quality score.
+type DataQualityWeights struct {
+	Freshness        float64 // Price updated recently
+	FairValueSources float64 // Number of distinct recent fair value sources
+	Beta             float64 // Beta provided (downside calibrated from data, not default)
+	Probability      float64 // Probability provided (not the 0.65 default)
+	Volatility       float64 // Volatility available
+}
 
 // Config holds all application configuration
 type Config struct {
@@ -16,17 +84,84 @@ type Config struct {
 	DeepseekAPIKey        string
 	PerplexityAPIKey      string
 	OpenAIAPIKey          string
+	AnthropicAPIKey       string
 	ExchangeRatesAPIKey   string
 	SendGridAPIKey        string
 	AlertEmailFrom        string
 	AlertEmailTo          string
+	TelegramBotToken      string // Bot token for the telegram alert channel
+	TelegramChatID        string // Chat that receives telegram alerts
 	EnableScheduler       bool
+	AutoCreateDefaultPortfolio bool // Create a default portfolio for the user when a stock is added and none exists
 	DefaultUpdateFrequency string
+	SchedulerFairValues   bool     // Collect trusted fair values during scheduled stock updates
+	BenchmarkSymbols      []string // Benchmark tickers snapshotted daily (e.g. SPY for S&P 500, URTH for MSCI World)
+	SchedulerHistoryBatchSize int // Stock history rows per INSERT when a scheduled run writes its snapshots
+	ScheduledAssessmentSource string // LLM source (grok, deepseek or claude) for scheduled per-stock assessments
+	ScheduledAssessmentMaxPerRun int // Budget of scheduled assessments per daily run; the longest-unassessed due stocks go first (0 = off)
+	HaltedQuoteMaxAgeDays int // An Alpha Vantage quote whose latest trading day is older than this means halted/delisted (0 = off)
+	LotFXAtPurchase       bool // Record the FX rate on Buy/Sell operations so lots keep their FX-at-purchase
+	StaleRefreshOnRead    bool // GET /stocks/:id on a stale, non-manual stock starts a background refresh
+	StaleRefreshMaxAgeHours int // Stock data older than this is stale for refresh on read
+	StaleRefreshCooldownMinutes int // Do not refresh the same stock on read again within this window
+	StaleRefreshMaxPerHour int // Budget of refreshes on read per rolling hour across all stocks (0 = unlimited)
+	RatingProbabilityUpdates bool  // Weekly: re-estimate p from analyst rating mix changes (Alpha Vantage overview)
+	RatingMixMinShift     float64 // Share of ratings (0–1) that must move before p is re-estimated
+	ProviderModels        map[string]map[string]string // use-case -> provider -> model
+	ProviderRateLimits    map[string]ProviderRateLimit // provider -> outbound rate/concurrency limit
+	AssessmentFreshPrice  bool // Refetch stale prices and anchor assessment prompts on stored stock data
+	AssessmentPriceMaxAgeMinutes int // Price age after which an assessment triggers a refetch
+	AssessmentCacheTTLMinutes int // Reuse a completed assessment for the same ticker and source this long (0 = off)
+	AssessmentRequireResolvableTicker bool // Reject assessments for tickers the data provider's symbol search cannot find
+	AssessmentLLMChoices  int // Choices (n) requested per Grok/Deepseek assessment; the lowest-EV one is kept (1 = first choice only)
+	FairValueLLMChoices   int // Choices (n) requested per fair value call; entries from all choices are aggregated
+	DataQualityWeights    DataQualityWeights
+	EVAgingFairValueMaxDays int // Fair value age after which EV-driven actions carry a "data aging" warning
+	EVAgingPriceMaxDays     int // Price age after which EV-driven actions carry a "data aging" warning
+	FairValueMaxPriceMultiple float64 // Drop collected fair values more than this multiple above/below the current price
+	LLMDecimalSeparator       string  // auto, dot or comma: how numbers in LLM fair value output are parsed
+	FairValueRequireSource    bool    // Reject collected fair values whose provider entry names no source
+	FairValueSingleflight     bool    // Concurrent collections for the same ticker share one provider run
+	FairValueSourceBlocklist  []string // Lower-cased substrings; collected fair values whose source or URL contains one are dropped
+	EVRangeWeights            []float64 // Low, consensus, high fair value weights for the blended EV range
+	ShareClassAliases         map[string]string // Share-class ticker -> canonical ticker, for consolidated exposure (e.g. GOOG -> GOOGL)
+	UrgentAlertTypes          []string // Alert types emailed even during quiet hours
+	AlertRoutes               map[string][]string // Alert severity -> delivery channels (email, telegram); an empty list only logs
+	AssessmentSourceTieBreak   string  // conservative_ev or fair_value_dispersion for /assessment/recommend-source
+	AssessmentMinEVImprovement float64 // EV points another source must differ by before switching away from the current one
+	FXRatesMaxAgeHours         int     // Summary flags rates_stale when the youngest exchange rate is older than this
+	FXStaleSkipPersist         bool    // Do not persist summary-derived weights/values while rates are stale
+	PortfolioMetricsCacheSeconds int   // TTL of the server-side portfolio summary cache (0 = off)
+	PublicRead                   bool  // Serve the default portfolio's summary and history without login (writes still need auth)
+	AutoAddCurrencies            bool  // Register untracked stock/cash currencies by fetching their rate from the FX provider
+	ProviderAuthAlerts           bool  // Raise a provider_auth_failed alert when a provider rejects its API key (401/403)
+	ProviderAuthAlertDedupHours  int   // Do not repeat a provider's auth-failure alert within this many hours
+	ProviderMaxRetries           int   // Retries of an LLM provider call after a 429/5xx or network timeout (0 = off)
+	ProviderRetryBaseDelayMs     int   // Backoff before the first retry; doubles per retry, plus jitter
+	ProviderCallLog              string // Compliance log of every provider request: "" (off), stdout (JSON lines) or db
+	NormalizeTickers             bool              // Canonicalize exchange suffixes and share-class separators on stock creation
+	TickerExchangeSuffixes       map[string]string // Extra exchange code -> canonical suffix rules (e.g. XCSE -> CO), layered over the defaults
+	TickerClassSeparator         string            // Separator between base symbol and share class in canonical tickers
 }
 
 // Load reads configuration from environment variables
 func Load() *Config {
 	enableScheduler := os.Getenv("ENABLE_SCHEDULER") == "true"
+
+	providerModels := defaultProviderModels()
+	for useCase, models := range providerModels {
+		for provider, model := range models {
+			models[provider] = getEnv(strings.ToUpper(useCase)+"_MODEL_"+strings.ToUpper(provider), model)
+		}
+	}
+
+	providerRateLimits := defaultProviderRateLimits()
+	for provider, limit := range providerRateLimits {
+		prefix := strings.ToUpper(provider)
+		limit.RequestsPerMinute = getEnvInt(prefix+"_REQUESTS_PER_MINUTE", limit.RequestsPerMinute)
+		limit.MaxConcurrent = getEnvInt(prefix+"_MAX_CONCURRENT", limit.MaxConcurrent)
+		providerRateLimits[provider] = limit
+	}
 	
 	return &Config{
 		AppEnv:                getEnv("APP_ENV", "development"),
@@ -41,13 +176,173 @@ func Load() *Config {
 		DeepseekAPIKey:        os.Getenv("DEEPSEEK_API_KEY"),
 		PerplexityAPIKey:      os.Getenv("PERPLEXITY_API_KEY"),
 		OpenAIAPIKey:          os.Getenv("OPENAI_API_KEY"),
+		AnthropicAPIKey:       os.Getenv("ANTHROPIC_API_KEY"),
 		ExchangeRatesAPIKey:   os.Getenv("EXCHANGE_RATES_API_KEY"),
 		SendGridAPIKey:        os.Getenv("SENDGRID_API_KEY"),
 		AlertEmailFrom:        os.Getenv("ALERT_EMAIL_FROM"),
 		AlertEmailTo:          os.Getenv("ALERT_EMAIL_TO"),
+		TelegramBotToken:      os.Getenv("TELEGRAM_BOT_TOKEN"),
+		TelegramChatID:        os.Getenv("TELEGRAM_CHAT_ID"),
 		EnableScheduler:       enableScheduler,
+		AutoCreateDefaultPortfolio: os.Getenv("AUTO_CREATE_DEFAULT_PORTFOLIO") != "false",
 		DefaultUpdateFrequency: getEnv("DEFAULT_UPDATE_FREQUENCY", "daily"),
+		SchedulerFairValues:   os.Getenv("SCHEDULER_FAIR_VALUES") == "true",
+		BenchmarkSymbols:      splitList(getEnv("BENCHMARK_SYMBOLS", "SPY,URTH")),
+		SchedulerHistoryBatchSize: getEnvInt("SCHEDULER_HISTORY_BATCH_SIZE", 100),
+		ScheduledAssessmentSource: getEnv("SCHEDULED_ASSESSMENT_SOURCE", "grok"),
+		ScheduledAssessmentMaxPerRun: getEnvInt("SCHEDULED_ASSESSMENT_MAX_PER_RUN", 5),
+		HaltedQuoteMaxAgeDays: getEnvInt("HALTED_QUOTE_MAX_AGE_DAYS", 7),
+		LotFXAtPurchase:       os.Getenv("LOT_FX_AT_PURCHASE") != "false",
+		StaleRefreshOnRead:    os.Getenv("STALE_REFRESH_ON_READ") == "true",
+		StaleRefreshMaxAgeHours: getEnvInt("STALE_REFRESH_MAX_AGE_HOURS", 24),
+		StaleRefreshCooldownMinutes: getEnvInt("STALE_REFRESH_COOLDOWN_MINUTES", 60),
+		StaleRefreshMaxPerHour: getEnvInt("STALE_REFRESH_MAX_PER_HOUR", 20),
+		RatingProbabilityUpdates: os.Getenv("RATING_PROBABILITY_UPDATES") == "true",
+		RatingMixMinShift:     getEnvFloat("RATING_MIX_MIN_SHIFT", 0.2),
+		ProviderModels:        providerModels,
+		ProviderRateLimits:    providerRateLimits,
+		AssessmentFreshPrice:  os.Getenv("ASSESSMENT_FRESH_PRICE") == "true",
+		AssessmentPriceMaxAgeMinutes: getEnvInt("ASSESSMENT_PRICE_MAX_AGE_MINUTES", 60),
+		AssessmentCacheTTLMinutes: getEnvInt("ASSESSMENT_CACHE_TTL_MINUTES", 360),
+		AssessmentRequireResolvableTicker: os.Getenv("ASSESSMENT_REQUIRE_RESOLVABLE_TICKER") == "true",
+		AssessmentLLMChoices:  getEnvInt("ASSESSMENT_LLM_CHOICES", 1),
+		FairValueLLMChoices:   getEnvInt("FAIR_VALUE_LLM_CHOICES", 1),
+		DataQualityWeights: DataQualityWeights{
+			Freshness:        getEnvFloat("DATA_QUALITY_WEIGHT_FRESHNESS", 30),
+			FairValueSources: getEnvFloat("DATA_QUALITY_WEIGHT_FAIR_VALUE_SOURCES", 25),
+			Beta:             getEnvFloat("DATA_QUALITY_WEIGHT_BETA", 15),
+			Probability:      getEnvFloat("DATA_QUALITY_WEIGHT_PROBABILITY", 15),
+			Volatility:       getEnvFloat("DATA_QUALITY_WEIGHT_VOLATILITY", 15),
+		},
+		EVAgingFairValueMaxDays: getEnvInt("EV_AGING_FAIR_VALUE_MAX_DAYS", 14),
+		EVAgingPriceMaxDays:     getEnvInt("EV_AGING_PRICE_MAX_DAYS", 3),
+		FairValueMaxPriceMultiple: getEnvFloat("FAIR_VALUE_MAX_PRICE_MULTIPLE", 5),
+		LLMDecimalSeparator:       getEnv("LLM_DECIMAL_SEPARATOR", "auto"),
+		FairValueRequireSource:    os.Getenv("FAIR_VALUE_REQUIRE_SOURCE") != "false",
+		FairValueSingleflight:     os.Getenv("FAIR_VALUE_SINGLEFLIGHT") != "false",
+		FairValueSourceBlocklist:  splitLowerList(os.Getenv("FAIR_VALUE_SOURCE_BLOCKLIST")),
+		EVRangeWeights:            parseFloatList(getEnv("EV_RANGE_WEIGHTS", "0.25,0.5,0.25")),
+		ShareClassAliases:         parseTickerMap(os.Getenv("SHARE_CLASS_ALIASES")),
+		UrgentAlertTypes:          splitLowerList(getEnv("URGENT_ALERT_TYPES", "stop_hit")),
+		AlertRoutes:               parseAlertRoutes(getEnv("ALERT_ROUTES", "critical=email,warning=email,info=email")),
+		AssessmentSourceTieBreak:   getEnv("ASSESSMENT_SOURCE_TIE_BREAK", "conservative_ev"),
+		AssessmentMinEVImprovement: getEnvFloat("ASSESSMENT_MIN_EV_IMPROVEMENT", 2),
+		FXRatesMaxAgeHours:         getEnvInt("FX_RATES_MAX_AGE_HOURS", 48),
+		FXStaleSkipPersist:         os.Getenv("FX_STALE_SKIP_PERSIST") == "true",
+		PortfolioMetricsCacheSeconds: getEnvInt("PORTFOLIO_METRICS_CACHE_SECONDS", 30),
+		PublicRead:                   os.Getenv("PUBLIC_READ") == "true",
+		AutoAddCurrencies:            os.Getenv("AUTO_ADD_CURRENCIES") != "false",
+		ProviderAuthAlerts:           os.Getenv("PROVIDER_AUTH_ALERTS") != "false",
+		ProviderAuthAlertDedupHours:  getEnvInt("PROVIDER_AUTH_ALERT_DEDUP_HOURS", 24),
+		ProviderMaxRetries:           getEnvInt("PROVIDER_MAX_RETRIES", 2),
+		ProviderRetryBaseDelayMs:     getEnvInt("PROVIDER_RETRY_BASE_DELAY_MS", 1000),
+		ProviderCallLog:              os.Getenv("PROVIDER_CALL_LOG"),
+		NormalizeTickers:             os.Getenv("NORMALIZE_TICKERS") != "false",
+		TickerExchangeSuffixes:       parseTickerMap(os.Getenv("TICKER_EXCHANGE_SUFFIXES")),
+		TickerClassSeparator:         getEnv("TICKER_CLASS_SEPARATOR", "-"),
+	}
+}
+
+// ModelFor returns the configured model for a use-case and provider,
+// falling back to the built-in default when not configured.
+func (c *Config) ModelFor(useCase, provider string) string {
+	if c != nil {
+		if model := c.ProviderModels[useCase][provider]; model != "" {
+			return model
+		}
+	}
+	return defaultProviderModels()[useCase][provider]
+}
+
+// DefaultProviderRateLimits returns the built-in provider rate limits without env overrides.
+func DefaultProviderRateLimits() map[string]ProviderRateLimit {
+	return defaultProviderRateLimits()
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// splitList parses a comma-separated env value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToUpper(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func splitLowerList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseFloatList parses a comma-separated list of numbers, returning nil if any item is invalid.
+func parseFloatList(value string) []float64 {
+	var items []float64
+	for _, item := range strings.Split(value, ",") {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil {
+			return nil
+		}
+		items = append(items, parsed)
+	}
+	return items
+}
+
+// parseTickerMap parses "ALIAS=CANONICAL,..." into an upper-cased alias -> canonical map.
+func parseTickerMap(value string) map[string]string {
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		alias, canonical, ok := strings.Cut(pair, "=")
+		alias = strings.ToUpper(strings.TrimSpace(alias))
+		canonical = strings.ToUpper(strings.TrimSpace(canonical))
+		if ok && alias != "" && canonical != "" {
+			mapping[alias] = canonical
+		}
+	}
+	return mapping
+}
+
+// parseAlertRoutes parses "severity=channel+channel,..." into a lower-cased severity -> channels map.
+// A severity with no channels ("info=") maps to an empty list.
+func parseAlertRoutes(value string) map[string][]string {
+	routes := make(map[string][]string)
+	for _, pair := range strings.Split(value, ",") {
+		severity, channels, ok := strings.Cut(pair, "=")
+		severity = strings.ToLower(strings.TrimSpace(severity))
+		if !ok || severity == "" {
+			continue
+		}
+		routes[severity] = []string{}
+		for _, channel := range strings.Split(channels, "+") {
+			if channel = strings.ToLower(strings.TrimSpace(channel)); channel != "" {
+				routes[severity] = append(routes[severity], channel)
+			}
+		}
 	}
+	return routes
 }
 
 func getEnv(key, defaultValue string) string {
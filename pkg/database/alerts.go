@@ -0,0 +1,19 @@
+package database
+
+import (
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// migrateAlertDelivery adds Alert.DeliveredAt and marks alerts emailed before per-channel routing as
+// delivered, so they are not re-sent to newly routed channels. It runs once, when the column is added.
+func migrateAlertDelivery(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Alert{}) || migrator.HasColumn(&models.Alert{}, "DeliveredAt") {
+		return nil
+	}
+	if err := migrator.AddColumn(&models.Alert{}, "DeliveredAt"); err != nil {
+		return err
+	}
+	return db.Model(&models.Alert{}).Where("email_sent = ?", true).Update("delivered_at", gorm.Expr("created_at")).Error
+}
@@ -0,0 +1,389 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Backup streams are newline-delimited JSON: one BackupRecord per line, starting with a header.
+// Records are written parents first (portfolios before stocks, stocks before their history), which
+// ImportBackup relies on to remap IDs.
+const (
+	BackupFormat  = "stock-backend-backup"
+	BackupVersion = 1
+)
+
+// Backup record types, in export order.
+const (
+	BackupRecordHeader              = "header"
+	BackupRecordExchangeRate        = "exchange_rate"
+	BackupRecordExchangeRateHistory = "exchange_rate_history"
+	BackupRecordUserSetting         = "user_setting"
+	BackupRecordPortfolio           = "portfolio"
+	BackupRecordPortfolioSettings   = "portfolio_settings"
+	BackupRecordStock               = "stock"
+	BackupRecordStockHistory        = "stock_history"
+	BackupRecordFairValueHistory    = "fair_value_history"
+	BackupRecordDeletedStock        = "deleted_stock"
+	BackupRecordCashHolding         = "cash_holding"
+	BackupRecordOrder               = "order"
+	BackupRecordOperation           = "operation"
+	BackupRecordAssessment          = "assessment"
+	BackupRecordPortfolioSnapshot   = "portfolio_snapshot"
+	BackupRecordAlert               = "alert"
+)
+
+// backupBatchSize bounds how many rows are held in memory while exporting one table.
+const backupBatchSize = 500
+
+// ErrInvalidBackup is returned (wrapped) when an import stream is malformed or inconsistent.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// BackupRecord is one line of a backup stream. Data is the model's JSON representation.
+type BackupRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// BackupHeader is the data of the first record of a backup stream.
+type BackupHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// BackupImportResult counts imported records per type, and records skipped: exchange rates, and
+// child records whose stock is not in the backup (e.g. history of a deleted stock).
+type BackupImportResult struct {
+	Imported map[string]int `json:"imported"`
+	Skipped  map[string]int `json:"skipped"`
+}
+
+// ExportBackup writes the user's portfolios and everything scoped to them, the user's settings and
+// the exchange rates with their history to w as a backup stream. Tables are read in batches so large histories are
+// never fully loaded into memory. API keys and users are not exported.
+func ExportBackup(db *gorm.DB, userID uint, w io.Writer, now time.Time) error {
+	enc := json.NewEncoder(w)
+	write := func(recordType string, data interface{}) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(BackupRecord{Type: recordType, Data: raw})
+	}
+
+	if err := write(BackupRecordHeader, BackupHeader{Format: BackupFormat, Version: BackupVersion, ExportedAt: now}); err != nil {
+		return err
+	}
+
+	portfolioIDs := db.Model(&models.Portfolio{}).Select("id").Where("user_id = ?", userID)
+	byPortfolio := func() *gorm.DB { return db.Where("portfolio_id IN (?)", portfolioIDs) }
+
+	steps := []func() error{
+		func() error { return exportTable[models.ExchangeRate](db, BackupRecordExchangeRate, write) },
+		func() error {
+			return exportTable[models.ExchangeRateHistory](db, BackupRecordExchangeRateHistory, write)
+		},
+		func() error {
+			return exportTable[models.UserSettings](db.Where("user_id = ?", userID), BackupRecordUserSetting, write)
+		},
+		func() error {
+			return exportTable[models.Portfolio](db.Where("user_id = ?", userID), BackupRecordPortfolio, write)
+		},
+		func() error {
+			return exportTable[models.PortfolioSettings](byPortfolio(), BackupRecordPortfolioSettings, write)
+		},
+		func() error { return exportTable[models.Stock](byPortfolio(), BackupRecordStock, write) },
+		func() error { return exportTable[models.StockHistory](byPortfolio(), BackupRecordStockHistory, write) },
+		func() error {
+			return exportTable[models.FairValueHistory](byPortfolio(), BackupRecordFairValueHistory, write)
+		},
+		func() error { return exportTable[models.DeletedStock](byPortfolio(), BackupRecordDeletedStock, write) },
+		func() error { return exportTable[models.CashHolding](byPortfolio(), BackupRecordCashHolding, write) },
+		func() error { return exportTable[models.Order](byPortfolio(), BackupRecordOrder, write) },
+		func() error { return exportTable[models.Operation](byPortfolio(), BackupRecordOperation, write) },
+		func() error { return exportTable[models.Assessment](byPortfolio(), BackupRecordAssessment, write) },
+		func() error {
+			return exportTable[models.PortfolioSnapshot](byPortfolio(), BackupRecordPortfolioSnapshot, write)
+		},
+		func() error { return exportTable[models.Alert](byPortfolio(), BackupRecordAlert, write) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportTable writes every row matched by query as recordType, in primary key order and in batches.
+func exportTable[T any](query *gorm.DB, recordType string, write func(string, interface{}) error) error {
+	var batch []T
+	return query.FindInBatches(&batch, backupBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := write(recordType, &batch[i]); err != nil {
+				return fmt.Errorf("failed to write %s record: %w", recordType, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+// ImportBackup restores a backup stream for the user in a single transaction. Rows get new IDs;
+// portfolio and stock references are remapped to them, so the stream can be loaded into an instance
+// that already has data. User settings are upserted by their natural key. Exchange rate records are
+// skipped: the rates table is shared by every user and is refreshed from the providers. Exchange
+// rate history is only added where the instance has no rate for that currency and time. An
+// imported default portfolio stays default only when the user has no default portfolio yet.
+func ImportBackup(db *gorm.DB, userID uint, r io.Reader) (BackupImportResult, error) {
+	result := BackupImportResult{Imported: make(map[string]int), Skipped: make(map[string]int)}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		imp := &backupImporter{
+			tx:         tx,
+			userID:     userID,
+			portfolios: make(map[uint]uint),
+			stocks:     make(map[uint]uint),
+			orders:     make(map[uint]uint),
+			result:     &result,
+		}
+		dec := json.NewDecoder(r)
+		for line := 1; ; line++ {
+			var record BackupRecord
+			if err := dec.Decode(&record); err == io.EOF {
+				if line == 1 {
+					return fmt.Errorf("%w: empty stream", ErrInvalidBackup)
+				}
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%w: record %d: %v", ErrInvalidBackup, line, err)
+			}
+			if line == 1 {
+				if err := checkBackupHeader(record); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := imp.apply(record); err != nil {
+				return fmt.Errorf("record %d (%s): %w", line, record.Type, err)
+			}
+		}
+	})
+	return result, err
+}
+
+func checkBackupHeader(record BackupRecord) error {
+	if record.Type != BackupRecordHeader {
+		return fmt.Errorf("%w: stream must start with a header record", ErrInvalidBackup)
+	}
+	var header BackupHeader
+	if err := json.Unmarshal(record.Data, &header); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidBackup, err)
+	}
+	if header.Format != BackupFormat {
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidBackup, header.Format)
+	}
+	if header.Version < 1 || header.Version > BackupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, header.Version)
+	}
+	return nil
+}
+
+// backupImporter maps IDs from the backup to the rows created during import.
+type backupImporter struct {
+	tx         *gorm.DB
+	userID     uint
+	portfolios map[uint]uint // Backup portfolio ID -> new ID
+	stocks     map[uint]uint // Backup stock ID -> new ID
+	orders     map[uint]uint // Backup order ID -> new ID
+	result     *BackupImportResult
+}
+
+func (imp *backupImporter) apply(record BackupRecord) error {
+	switch record.Type {
+	case BackupRecordExchangeRate:
+		return importRecord(imp, record, func(*models.ExchangeRate) (bool, error) {
+			return false, nil
+		})
+	case BackupRecordExchangeRateHistory:
+		return importRecord(imp, record, func(history *models.ExchangeRateHistory) (bool, error) {
+			var existing int64
+			if err := imp.tx.Model(&models.ExchangeRateHistory{}).
+				Where("currency_code = ? AND recorded_at = ?", history.CurrencyCode, history.RecordedAt).Count(&existing).Error; err != nil {
+				return false, err
+			}
+			if existing > 0 {
+				return false, nil
+			}
+			history.ID = 0
+			return true, imp.create(history)
+		})
+	case BackupRecordUserSetting:
+		return importRecord(imp, record, func(setting *models.UserSettings) (bool, error) {
+			setting.ID, setting.UserID = 0, imp.userID
+			return true, imp.tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+			}).Create(setting).Error
+		})
+	case BackupRecordPortfolio:
+		return importRecord(imp, record, func(portfolio *models.Portfolio) (bool, error) {
+			oldID := portfolio.ID
+			portfolio.ID, portfolio.UserID = 0, imp.userID
+			if portfolio.IsDefault {
+				var defaults int64
+				if err := imp.tx.Model(&models.Portfolio{}).Where("user_id = ? AND is_default = ?", imp.userID, true).Count(&defaults).Error; err != nil {
+					return false, err
+				}
+				portfolio.IsDefault = defaults == 0
+			}
+			if err := imp.create(portfolio); err != nil {
+				return false, err
+			}
+			imp.portfolios[oldID] = portfolio.ID
+			return true, nil
+		})
+	case BackupRecordPortfolioSettings:
+		return importRecord(imp, record, func(settings *models.PortfolioSettings) (bool, error) {
+			return imp.createInPortfolio(settings, &settings.ID, &settings.PortfolioID)
+		})
+	case BackupRecordStock:
+		return importRecord(imp, record, func(stock *models.Stock) (bool, error) {
+			oldID := stock.ID
+			if _, err := imp.createInPortfolio(stock, &stock.ID, &stock.PortfolioID); err != nil {
+				return false, err
+			}
+			imp.stocks[oldID] = stock.ID
+			return true, nil
+		})
+	case BackupRecordStockHistory:
+		return importRecord(imp, record, func(history *models.StockHistory) (bool, error) {
+			if !imp.remapStock(&history.StockID) {
+				return false, nil
+			}
+			return imp.createInPortfolio(history, &history.ID, &history.PortfolioID)
+		})
+	case BackupRecordFairValueHistory:
+		return importRecord(imp, record, func(history *models.FairValueHistory) (bool, error) {
+			if !imp.remapStock(&history.StockID) {
+				return false, nil
+			}
+			return imp.createInPortfolio(history, &history.ID, &history.PortfolioID)
+		})
+	case BackupRecordDeletedStock:
+		return importRecord(imp, record, func(deleted *models.DeletedStock) (bool, error) {
+			return imp.createInPortfolio(deleted, &deleted.ID, &deleted.PortfolioID)
+		})
+	case BackupRecordCashHolding:
+		return importRecord(imp, record, func(holding *models.CashHolding) (bool, error) {
+			return imp.createInPortfolio(holding, &holding.ID, &holding.PortfolioID)
+		})
+	case BackupRecordOrder:
+		return importRecord(imp, record, func(order *models.Order) (bool, error) {
+			oldID := order.ID
+			if order.StockID != nil && !imp.remapStock(order.StockID) {
+				order.StockID = nil
+			}
+			if _, err := imp.createInPortfolio(order, &order.ID, &order.PortfolioID); err != nil {
+				return false, err
+			}
+			imp.orders[oldID] = order.ID
+			return true, nil
+		})
+	case BackupRecordOperation:
+		return importRecord(imp, record, func(operation *models.Operation) (bool, error) {
+			// Operations outlive deleted stocks; keep them unlinked rather than dropping trade history.
+			if operation.StockID != nil && !imp.remapStock(operation.StockID) {
+				operation.StockID = nil
+			}
+			if operation.OrderID != nil {
+				if newID, ok := imp.orders[*operation.OrderID]; ok {
+					*operation.OrderID = newID
+				} else {
+					operation.OrderID = nil
+				}
+			}
+			return imp.createInPortfolio(operation, &operation.ID, &operation.PortfolioID)
+		})
+	case BackupRecordAssessment:
+		return importRecord(imp, record, func(assessment *models.Assessment) (bool, error) {
+			if assessment.StockID != nil && !imp.remapStock(assessment.StockID) {
+				assessment.StockID = nil
+			}
+			return imp.createInPortfolio(assessment, &assessment.ID, &assessment.PortfolioID)
+		})
+	case BackupRecordPortfolioSnapshot:
+		return importRecord(imp, record, func(snapshot *models.PortfolioSnapshot) (bool, error) {
+			return imp.createInPortfolio(snapshot, &snapshot.ID, &snapshot.PortfolioID)
+		})
+	case BackupRecordAlert:
+		return importRecord(imp, record, func(alert *models.Alert) (bool, error) {
+			if alert.StockID != 0 && !imp.remapStock(&alert.StockID) {
+				alert.StockID = 0
+			}
+			return imp.createInPortfolio(alert, &alert.ID, &alert.PortfolioID)
+		})
+	case BackupRecordHeader:
+		return fmt.Errorf("%w: duplicate header", ErrInvalidBackup)
+	}
+	return fmt.Errorf("%w: unknown record type %q", ErrInvalidBackup, record.Type)
+}
+
+// importRecord decodes a record into a new T and stores it with store, which reports whether the
+// record was imported or skipped.
+func importRecord[T any](imp *backupImporter, record BackupRecord, store func(*T) (bool, error)) error {
+	row := new(T)
+	if err := json.Unmarshal(record.Data, row); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	imported, err := store(row)
+	if err != nil {
+		return err
+	}
+	if imported {
+		imp.result.Imported[record.Type]++
+	} else {
+		imp.result.Skipped[record.Type]++
+	}
+	return nil
+}
+
+// createInPortfolio clears the row's ID, remaps its portfolio and inserts it. A portfolio that is
+// not in the backup makes the stream invalid.
+func (imp *backupImporter) createInPortfolio(row interface{}, id, portfolioID *uint) (bool, error) {
+	newPortfolioID, ok := imp.portfolios[*portfolioID]
+	if !ok {
+		return false, fmt.Errorf("%w: references unknown portfolio %d", ErrInvalidBackup, *portfolioID)
+	}
+	*id, *portfolioID = 0, newPortfolioID
+	return true, imp.create(row)
+}
+
+// create inserts the row, then rewrites every column: Create substitutes column defaults for zero
+// values (e.g. a disabled flag that defaults to true), which would not restore the backup faithfully.
+func (imp *backupImporter) create(row interface{}) error {
+	exact := reflect.New(reflect.TypeOf(row).Elem())
+	exact.Elem().Set(reflect.ValueOf(row).Elem())
+	if err := imp.tx.Create(row).Error; err != nil {
+		return err
+	}
+	exact.Elem().FieldByName("ID").Set(reflect.ValueOf(row).Elem().FieldByName("ID"))
+	return imp.tx.Model(exact.Interface()).Select("*").Omit("id").UpdateColumns(exact.Interface()).Error
+}
+
+// remapStock rewrites a backup stock ID to the imported stock's ID, reporting false when the stock
+// is not in the backup.
+func (imp *backupImporter) remapStock(stockID *uint) bool {
+	newID, ok := imp.stocks[*stockID]
+	if ok {
+		*stockID = newID
+	}
+	return ok
+}
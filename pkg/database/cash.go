@@ -0,0 +1,94 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// ExchangeRatesMap returns the stored rates (units per 1 EUR) keyed by currency code, with EUR = 1.
+func ExchangeRatesMap(db *gorm.DB) (map[string]float64, error) {
+	var rates []models.ExchangeRate
+	if err := db.Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	fxRates := map[string]float64{"EUR": 1}
+	for _, rate := range rates {
+		if rate.Rate > 0 {
+			fxRates[rate.CurrencyCode] = rate.Rate
+		}
+	}
+	return fxRates, nil
+}
+
+// CashValueInBase converts amount of currencyCode to base via EUR. It returns the currency the value
+// is in (base, or EUR when base has no rate) and false when currencyCode has no rate.
+func CashValueInBase(amount float64, currencyCode, base string, fxRates map[string]float64) (float64, string, bool) {
+	rate := fxRates[currencyCode]
+	if rate <= 0 {
+		return 0, "", false
+	}
+	amountEUR := amount / rate
+	if baseRate := fxRates[base]; base != "" && baseRate > 0 {
+		return amountEUR * baseRate, base, true
+	}
+	return amountEUR, "EUR", true
+}
+
+// SetCashBaseValueWithRates recomputes cash.BaseValue in base, its portfolio's base currency (see
+// PortfolioBaseCurrency), at fxRates (see ExchangeRatesMap). Callers load both once per request.
+func SetCashBaseValueWithRates(cash *models.CashHolding, base string, fxRates map[string]float64) error {
+	value, currency, ok := CashValueInBase(cash.Amount, cash.CurrencyCode, base, fxRates)
+	if !ok {
+		return fmt.Errorf("exchange rate not found for %s", cash.CurrencyCode)
+	}
+	cash.BaseValue, cash.BaseCurrency = value, currency
+	return nil
+}
+
+// migrateCashBaseValue adds CashHolding.BaseCurrency and BaseValue and backfills them from the stored
+// USD value, converted to each portfolio's base currency at the current rates. It runs once, when the
+// columns are added.
+func migrateCashBaseValue(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.CashHolding{}) || migrator.HasColumn(&models.CashHolding{}, "BaseValue") {
+		return nil
+	}
+	for _, field := range []string{"BaseCurrency", "BaseValue"} {
+		if !migrator.HasColumn(&models.CashHolding{}, field) {
+			if err := migrator.AddColumn(&models.CashHolding{}, field); err != nil {
+				return err
+			}
+		}
+	}
+	if !migrator.HasTable(&models.ExchangeRate{}) {
+		return nil
+	}
+
+	fxRates, err := ExchangeRatesMap(db)
+	if err != nil {
+		return err
+	}
+	var holdings []models.CashHolding
+	if err := db.Find(&holdings).Error; err != nil {
+		return err
+	}
+	bases := make(map[uint]string)
+	for _, holding := range holdings {
+		base, loaded := bases[holding.PortfolioID]
+		if !loaded {
+			base = PortfolioBaseCurrency(db, holding.PortfolioID)
+			bases[holding.PortfolioID] = base
+		}
+		value, currency, ok := CashValueInBase(holding.USDValue, "USD", base, fxRates)
+		if !ok {
+			continue
+		}
+		if err := db.Model(&models.CashHolding{}).Where("id = ?", holding.ID).
+			Updates(map[string]interface{}{"base_currency": currency, "base_value": value}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -57,10 +57,21 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 		}
 	}
 
+	// Mark alerts emailed before per-channel routing as delivered
+	if err := migrateAlertDelivery(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate alert delivery: %w", err)
+	}
+
+	// Add cash values in the portfolio's base currency, backfilled from the USD values
+	if err := migrateCashBaseValue(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate cash base values: %w", err)
+	}
+
 	// Run auto migrations
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.UserSettings{},
+		&models.APIKey{},
 		&models.Portfolio{},
 		&models.Stock{},
 		&models.StockHistory{},
@@ -69,10 +80,17 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 		&models.PortfolioSettings{},
 		&models.Alert{},
 		&models.ExchangeRate{},
+		&models.ExchangeRateHistory{},
 		&models.CashHolding{},
 		&models.Assessment{},
 		&models.AssessmentDiff{},
 		&models.Operation{},
+		&models.Order{},
+		&models.PortfolioSnapshot{},
+		&models.BenchmarkSnapshot{},
+		&models.SchedulerRun{},
+		&models.SchedulerRunOutcome{},
+		&models.ProviderCallLog{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/art-pro/stock-backend/pkg/models"
 	"gorm.io/gorm"
@@ -21,6 +22,26 @@ func GetDefaultPortfolioID(db *gorm.DB) (uint, error) {
 	return 0, fmt.Errorf("no portfolio found")
 }
 
+// PortfolioBaseCurrency returns the currency the portfolio reports in, EUR when unset or not found.
+func PortfolioBaseCurrency(db *gorm.DB, portfolioID uint) string {
+	var portfolio models.Portfolio
+	if err := db.Select("id", "base_currency").First(&portfolio, portfolioID).Error; err != nil || portfolio.BaseCurrency == "" {
+		return "EUR"
+	}
+	return portfolio.BaseCurrency
+}
+
+// ResolveDefaultPortfolioID returns the portfolio stock-creating requests write to. With autoCreate
+// set it is username's own default portfolio, created when the user has none (see
+// EnsureDefaultPortfolio), so another user's portfolio is never picked. Otherwise, or without a
+// username, it is the global default (see GetDefaultPortfolioID).
+func ResolveDefaultPortfolioID(db *gorm.DB, username string, autoCreate bool) (uint, error) {
+	if !autoCreate || username == "" {
+		return GetDefaultPortfolioID(db)
+	}
+	return EnsureDefaultPortfolio(db, username)
+}
+
 // EnsureDefaultPortfolio ensures a default portfolio exists for the given user.
 func EnsureDefaultPortfolio(db *gorm.DB, username string) (uint, error) {
 	var user models.User
@@ -51,3 +72,16 @@ func EnsureDefaultPortfolio(db *gorm.DB, username string) (uint, error) {
 
 	return portfolio.ID, nil
 }
+
+// MarkPortfolioReviewed records at as the portfolio's last review, creating its settings row when missing.
+func MarkPortfolioReviewed(db *gorm.DB, portfolioID uint, at time.Time) (*models.PortfolioSettings, error) {
+	var settings models.PortfolioSettings
+	defaults := models.PortfolioSettings{PortfolioID: portfolioID, UpdateFrequency: "daily", AlertsEnabled: true, AlertThresholdEV: 10.0}
+	if err := db.Where("portfolio_id = ?", portfolioID).Attrs(defaults).FirstOrCreate(&settings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load portfolio settings: %w", err)
+	}
+	if err := db.Model(&settings).Update("last_reviewed_at", at).Error; err != nil {
+		return nil, fmt.Errorf("failed to mark portfolio reviewed: %w", err)
+	}
+	return &settings, nil
+}
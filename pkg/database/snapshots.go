@@ -0,0 +1,39 @@
+package database
+
+import (
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SavePortfolioSnapshot upserts the portfolio's snapshot for the day of RecordedAt.
+// Snapshots represent end-of-day, so a later write on the same day overwrites the earlier one.
+func SavePortfolioSnapshot(db *gorm.DB, snapshot *models.PortfolioSnapshot) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "portfolio_id"}, {Name: "snapshot_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"total_value_eur", "cash_eur", "overall_ev", "sharpe_ratio", "kelly_utilization", "cash_pct", "recorded_at"}),
+	}).Create(snapshot).Error
+}
+
+// PortfolioCashEUR sums the portfolio's cash holdings in EUR; currencies without a rate are skipped.
+func PortfolioCashEUR(db *gorm.DB, portfolioID uint, fxRates map[string]float64) (float64, error) {
+	var holdings []models.CashHolding
+	if err := db.Where("portfolio_id = ?", portfolioID).Find(&holdings).Error; err != nil {
+		return 0, err
+	}
+	cashEUR := 0.0
+	for _, holding := range holdings {
+		if rate := fxRates[holding.CurrencyCode]; rate > 0 {
+			cashEUR += holding.Amount / rate
+		}
+	}
+	return cashEUR, nil
+}
+
+// SaveBenchmarkSnapshot upserts the symbol's snapshot for the day of RecordedAt (last write wins).
+func SaveBenchmarkSnapshot(db *gorm.DB, snapshot *models.BenchmarkSnapshot) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}, {Name: "snapshot_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "recorded_at"}),
+	}).Create(snapshot).Error
+}
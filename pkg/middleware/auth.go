@@ -8,40 +8,129 @@ import (
 
 	"github.com/art-pro/stock-backend/pkg/auth"
 	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens, or an X-API-Key header when db is provided.
+// Read-only API keys are rejected on mutating methods.
+func AuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		authenticate(c, cfg, db, false)
+	}
+}
+
+// OptionalAuthMiddleware authenticates like AuthMiddleware when credentials are present. Without
+// credentials, GET/HEAD requests pass anonymously when PUBLIC_READ is enabled: the context is marked
+// read-only with auth_method "anonymous" and any portfolio_id is dropped so the default portfolio
+// is served. Everything else is rejected as with AuthMiddleware.
+func OptionalAuthMiddleware(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, cfg, db, cfg.PublicRead)
+	}
+}
+
+// AdminMiddleware restricts a route group to the admin user (ADMIN_USERNAME). It runs after
+// AuthMiddleware, which sets the caller's username.
+func AdminMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if username := c.GetString("username"); username == "" || username != cfg.AdminUsername {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		// Extract token from "Bearer <token>"
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+func authenticate(c *gin.Context, cfg *config.Config, db *gorm.DB, allowAnonymousRead bool) {
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && db != nil {
+		authenticateAPIKey(c, db, apiKey)
+		return
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		if allowAnonymousRead && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+			allowAnonymous(c)
 			return
 		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		c.Abort()
+		return
+	}
+
+	// Extract token from "Bearer <token>"
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		c.Abort()
+		return
+	}
 
-		token := parts[1]
-		claims, err := auth.ValidateToken(token, cfg.JWTSecret)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+	token := parts[1]
+	claims, err := auth.ValidateToken(token, cfg.JWTSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		c.Abort()
+		return
+	}
+
+	// Set user info in context
+	c.Set("username", claims.Username)
+	c.Set("user_id", claims.UserID)
+	c.Set("auth_method", "jwt")
+	c.Set("read_only", false)
+	c.Next()
+}
+
+// allowAnonymous serves a public read of the default portfolio.
+func allowAnonymous(c *gin.Context) {
+	query := c.Request.URL.Query()
+	if query.Has("portfolio_id") {
+		query.Del("portfolio_id")
+		c.Request.URL.RawQuery = query.Encode()
+	}
+	c.Set("auth_method", "anonymous")
+	c.Set("read_only", true)
+	c.Next()
+}
+
+// authenticateAPIKey resolves the key's user and enforces read-only permission.
+func authenticateAPIKey(c *gin.Context, db *gorm.DB, apiKey string) {
+	var key models.APIKey
+	if err := db.Where("key_hash = ? AND revoked_at IS NULL", auth.HashAPIKey(apiKey)).First(&key).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, key.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or revoked API key"})
+		c.Abort()
+		return
+	}
+
+	if key.ReadOnly {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is read-only"})
 			c.Abort()
 			return
 		}
-
-		// Set user info in context
-		c.Set("username", claims.Username)
-		c.Set("user_id", claims.UserID)
-		c.Next()
 	}
+
+	now := time.Now()
+	db.Model(&key).UpdateColumn("last_used_at", &now)
+
+	c.Set("username", user.Username)
+	c.Set("user_id", user.ID)
+	c.Set("auth_method", "api_key")
+	c.Set("read_only", key.ReadOnly)
+	c.Next()
 }
 
 // rateLimiter provides in-memory token bucket rate limiting per IP.
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/auth"
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAPIKeyTest(t *testing.T, readOnly bool) (*gin.Engine, *gorm.DB, models.APIKey, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "middleware-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.APIKey{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user := models.User{Username: "scripter", Password: "hash"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	key, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	record := models.APIKey{UserID: user.ID, Name: "script", Prefix: key[:12], KeyHash: hash, ReadOnly: readOnly}
+	if err := db.Create(&record).Error; err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(AuthMiddleware(&config.Config{JWTSecret: "secret"}, db))
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"username":    c.GetString("username"),
+			"user_id":     c.GetUint("user_id"),
+			"auth_method": c.GetString("auth_method"),
+		})
+	}
+	r.GET("/protected", handler)
+	r.POST("/protected", handler)
+	return r, db, record, key
+}
+
+func TestAuthMiddlewareAllowsAPIKey(t *testing.T) {
+	t.Parallel()
+	r, db, record, key := setupAPIKeyTest(t, false)
+
+	req := httptest.NewRequest(http.MethodPost, "/protected", nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d want %d, body %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"username":"scripter"`) || !strings.Contains(body, `"auth_method":"api_key"`) {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	var saved models.APIKey
+	if err := db.First(&saved, record.ID).Error; err != nil {
+		t.Fatalf("reload key: %v", err)
+	}
+	if saved.LastUsedAt == nil {
+		t.Error("expected LastUsedAt to be recorded")
+	}
+}
+
+func TestAuthMiddlewareRejectsRevokedAPIKey(t *testing.T) {
+	t.Parallel()
+	r, db, record, key := setupAPIKeyTest(t, false)
+
+	now := time.Now()
+	if err := db.Model(&record).Update("revoked_at", &now).Error; err != nil {
+		t.Fatalf("revoke key: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status: got %d want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthMiddlewareEnforcesReadOnlyAPIKey(t *testing.T) {
+	t.Parallel()
+	r, _, _, key := setupAPIKeyTest(t, true)
+
+	get := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	get.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, get)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET status: got %d want %d", w.Code, http.StatusOK)
+	}
+
+	post := httptest.NewRequest(http.MethodPost, "/protected", nil)
+	post.Header.Set("X-API-Key", key)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, post)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("POST status: got %d want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func setupPublicReadTest(t *testing.T, publicRead bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(OptionalAuthMiddleware(&config.Config{JWTSecret: "secret", PublicRead: publicRead}, nil))
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"username":     c.GetString("username"),
+			"auth_method":  c.GetString("auth_method"),
+			"read_only":    c.GetBool("read_only"),
+			"portfolio_id": c.Query("portfolio_id"),
+		})
+	}
+	r.GET("/portfolio/summary", handler)
+	r.POST("/portfolio/summary", handler)
+	return r
+}
+
+func TestOptionalAuthMiddlewareServesAnonymousReadWhenPublic(t *testing.T) {
+	t.Parallel()
+	r := setupPublicReadTest(t, true)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portfolio/summary?portfolio_id=7", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("anonymous GET status: got %d want %d, body %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"auth_method":"anonymous"`) || !strings.Contains(body, `"read_only":true`) {
+		t.Errorf("expected anonymous read-only context, body %s", body)
+	}
+	if !strings.Contains(body, `"portfolio_id":""`) {
+		t.Errorf("expected portfolio_id to be dropped for anonymous reads, body %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/portfolio/summary", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous POST status: got %d want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOptionalAuthMiddlewarePopulatesContextFromToken(t *testing.T) {
+	t.Parallel()
+	r := setupPublicReadTest(t, true)
+	token, err := auth.GenerateToken(3, "owner", "secret")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/portfolio/summary?portfolio_id=7", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("authed GET status: got %d want %d, body %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"username":"owner"`) || !strings.Contains(body, `"auth_method":"jwt"`) || !strings.Contains(body, `"portfolio_id":"7"`) {
+		t.Errorf("expected authenticated context with portfolio_id kept, body %s", body)
+	}
+
+	bad := httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+	bad.Header.Set("Authorization", "Bearer not-a-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, bad)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid token status: got %d want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOptionalAuthMiddlewareRequiresAuthWhenNotPublic(t *testing.T) {
+	t.Parallel()
+	r := setupPublicReadTest(t, false)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous GET status: got %d want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAdminMiddlewareAllowsOnlyTheAdminUser(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{JWTSecret: "secret", AdminUsername: "owner"}
+	r := gin.New()
+	r.Use(AuthMiddleware(cfg, nil), AdminMiddleware(cfg))
+	r.GET("/admin/export", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for username, want := range map[string]int{"owner": http.StatusOK, "guest": http.StatusForbidden} {
+		token, err := auth.GenerateToken(1, username, "secret")
+		if err != nil {
+			t.Fatalf("generate token: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/admin/export", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: status got %d want %d", username, w.Code, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,6 +16,19 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// APIKey is a per-user key for programmatic access. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`                         // First characters of the key, for identification
+	KeyHash    string     `gorm:"uniqueIndex;not null" json:"-"` // SHA-256 hex of the full key
+	ReadOnly   bool       `json:"read_only"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 // UserSettings stores user-specific UI settings like column visibility
 type UserSettings struct {
 	ID        uint      `gorm:"primarykey" json:"id"`
@@ -27,14 +41,15 @@ type UserSettings struct {
 
 // Portfolio represents a user's portfolio
 type Portfolio struct {
-	ID          uint      `gorm:"primarykey" json:"id"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description string    `json:"description"`
-	IsDefault   bool      `gorm:"default:false" json:"is_default"`
-	TotalValue  float64   `json:"total_value"`
-	UserID      uint      `gorm:"not null;index" json:"user_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           uint      `gorm:"primarykey" json:"id"`
+	Name         string    `gorm:"not null" json:"name"`
+	Description  string    `json:"description"`
+	IsDefault    bool      `gorm:"default:false" json:"is_default"`
+	TotalValue   float64   `json:"total_value"`
+	BaseCurrency string    `gorm:"default:'EUR'" json:"base_currency"` // Currency the portfolio reports its totals in
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // Stock represents a stock in the portfolio with all tracking metrics
@@ -42,9 +57,11 @@ type Stock struct {
 	ID                    uint       `gorm:"primarykey" json:"id"`
 	PortfolioID           uint       `gorm:"not null;index" json:"portfolio_id"`
 	Ticker                string     `gorm:"not null;index" json:"ticker"`
+	DisplayTicker         string     `json:"display_ticker"`    // Ticker as entered, before normalization (empty = same as Ticker)
 	ISIN                  string     `gorm:"index" json:"isin"` // International Securities Identification Number
 	CompanyName           string     `gorm:"not null" json:"company_name"`
 	Sector                string     `json:"sector"`
+	Industry              string     `json:"industry"`             // Sub-industry; positions sharing one are treated as correlated
 	CurrentPrice          float64    `json:"current_price"`        // In local currency
 	Currency              string     `json:"currency"`             // Local currency (DKK, EUR, USD, etc.)
 	FairValue             float64    `json:"fair_value"`           // Consensus target in local currency
@@ -52,6 +69,10 @@ type Stock struct {
 	DownsideRisk          float64    `json:"downside_risk"`        // Percentage (negative)
 	ProbabilityPositive   float64    `json:"probability_positive"` // p value (0-1)
 	ExpectedValue         float64    `json:"expected_value"`       // EV percentage
+	EVLow                 float64    `json:"ev_low"`               // EV (%) at the low end of the probability band (p - band)
+	EVMid                 float64    `json:"ev_mid"`               // EV (%) at the stored probability
+	EVHigh                float64    `json:"ev_high"`              // EV (%) at the high end of the probability band (p + band)
+	MaxDrawdownEstimate   float64    `json:"max_drawdown_estimate"` // Percentage (negative): a 1.65σ one-sided move, at least the downside risk
 	Beta                  float64    `json:"beta"`
 	Volatility            float64    `json:"volatility"` // Sigma percentage
 	PERatio               float64    `json:"pe_ratio"`
@@ -74,13 +95,36 @@ type Stock struct {
 	SellZoneStatus        string     `json:"sell_zone_status"`                        // Below/In trim/In sell zone
 	Assessment            string     `json:"assessment"`                              // Hold/Add/Trim/Sell
 	UpdateFrequency       string     `json:"update_frequency"`                        // daily/weekly/monthly/manually
+	AssessmentFrequency   string     `gorm:"default:'none'" json:"assessment_frequency"` // none/weekly/monthly: scheduled LLM re-assessment (see services.AssessmentDue)
+	LastAssessedAt        *time.Time `json:"last_assessed_at"`                        // When the scheduled job last generated an assessment
 	DataSource            string     `json:"data_source"`                             // Source of data (e.g., "Grok", "Alpha Vantage", "Manual")
 	FairValueSource       string     `json:"fair_value_source"`                       // Source of fair value (e.g., "TipRanks, Nov 5, 2025")
+	FairValueCollectedAt  *time.Time `json:"fair_value_collected_at"`                 // Last successful trusted fair value collection
+	FairValueStale        bool       `json:"fair_value_stale"`                        // Last collection attempt failed; FairValue is last-known
+	FairValueConfidence   string     `json:"fair_value_confidence"`                   // low when the last collected fair values' providers disagreed or were too dispersed (see MaxFVDisagreement, MaxFVDispersion), else normal
+	TradingStatus         string     `gorm:"default:'active'" json:"trading_status"`      // active, or halted when updates get a zero/implausible price or a stale quote (halted or delisted)
+	ProbabilityManual     bool       `json:"probability_manual"`                          // p set by hand; analyst-rating re-estimation leaves it alone
+	AnalystStrongBuy      int        `json:"analyst_strong_buy"`                          // Latest analyst rating mix (counts), used to re-estimate p
+	AnalystBuy            int        `json:"analyst_buy"`
+	AnalystHold           int        `json:"analyst_hold"`
+	AnalystSell           int        `json:"analyst_sell"`
+	AnalystStrongSell     int        `json:"analyst_strong_sell"`
+	AnalystRatingsAt      *time.Time `json:"analyst_ratings_at"`                      // When the rating mix was last fetched
 	AlphaVantageFetchedAt *time.Time `json:"alpha_vantage_fetched_at"`                // When data was last fetched from Alpha Vantage
 	GrokFetchedAt         *time.Time `json:"grok_fetched_at"`                         // When data was last fetched from Grok
 	AlphaVantageRawJSON   string     `gorm:"type:text" json:"alpha_vantage_raw_json"` // Raw JSON response from Alpha Vantage
 	GrokRawJSON           string     `gorm:"type:text" json:"grok_raw_json"`          // Raw JSON response from Grok
 	Comment               string     `gorm:"type:text" json:"comment"`                // User notes and memos for this stock
+	PurchasedAt           *time.Time `json:"purchased_at"`                            // Start of current holding period (first buy or manual)
+	Tags                  string     `json:"tags"`                                    // Manual comma-separated tags (user-editable)
+	DerivedTags           string     `json:"derived_tags"`                            // Comma-separated tags recomputed by CalculateMetrics (read-only)
+	ShadowExpectedValue   float64    `json:"shadow_expected_value"`                   // EV under the experimental shadow MetricsConfig (0 when shadow mode is off)
+	ShadowHalfKelly       float64    `json:"shadow_half_kelly_suggested"`             // Suggested weight under the shadow MetricsConfig
+	ShadowAssessment      string     `json:"shadow_assessment"`                       // Assessment under the shadow MetricsConfig
+	DataQuality           float64    `gorm:"-" json:"data_quality"`                   // 0–100 trust score, computed on read (see services.CalculateDataQuality)
+	EVConfidence          float64    `gorm:"-" json:"ev_confidence"`                  // 0–1 confidence in EV given input age, computed on read (see services.EVAging)
+	DataAgingWarning      string     `gorm:"-" json:"data_aging_warning,omitempty"`   // Set when Add/Trim/Sell rests on stale fair value or price
+	CostBasisEUR          float64    `gorm:"-" json:"cost_basis_eur"`                 // Open FIFO lots' cost, each lot at its own FX-at-purchase, computed on read (see services.ComputeCostBasis)
 	LastUpdated           time.Time  `json:"last_updated"`
 	CreatedAt             time.Time  `json:"created_at"`
 	UpdatedAt             time.Time  `json:"updated_at"`
@@ -101,6 +145,7 @@ type StockHistory struct {
 	KellyFraction       float64   `json:"kelly_fraction"`
 	Weight              float64   `json:"weight"`
 	Assessment          string    `json:"assessment"`
+	PriceType           string    `gorm:"index" json:"price_type"` // end_of_day (scheduled update) or intraday; empty on older rows
 	RecordedAt          time.Time `gorm:"index" json:"recorded_at"`
 }
 
@@ -136,21 +181,64 @@ type PortfolioSettings struct {
 	UpdateFrequency     string    `json:"update_frequency"`      // daily/weekly/monthly
 	LastUpdateRun       time.Time `json:"last_update_run"`
 	AlertsEnabled       bool      `json:"alerts_enabled"`
-	AlertThresholdEV    float64   `json:"alert_threshold_ev"` // Alert when EV changes by this %
+	AlertThresholdEV    float64   `json:"alert_threshold_ev"`                        // Alert when EV changes by this %
+	ReviewIntervalDays  int       `gorm:"default:90" json:"review_interval_days"`    // Flag positions held longer than this for re-assessment
+	MinTradeValueEUR    float64   `json:"min_trade_value_eur"`                       // Rebalance trades below this EUR value are dropped
+	WholeSharesOnly     bool      `json:"whole_shares_only"`                         // Round rebalance trades to whole shares
+	MaxCurrencyExposure float64   `gorm:"default:50" json:"max_currency_exposure"`   // Flag currencies above this % of total exposure
+	EVAddThreshold      float64   `gorm:"default:7" json:"ev_add_threshold"`         // EV (%) above which a stock is assessed Add
+	EVTrimThreshold     float64   `gorm:"default:3" json:"ev_trim_threshold"`        // EV (%) below which a stock is assessed Trim
+	EVSellThreshold     float64   `gorm:"default:0" json:"ev_sell_threshold"`        // EV (%) below which a stock is assessed Sell
+	KellyScale          float64   `gorm:"default:0.5" json:"kelly_scale"`            // Fraction of full Kelly used for the suggested weight
+	KellyCap            float64   `gorm:"default:15" json:"kelly_cap"`               // Maximum suggested weight (%)
+	AutoRecompute       bool      `gorm:"default:true" json:"auto_recompute"`        // Recompute stored metrics when the fields above change
+	DowngradeMinSources int       `gorm:"default:2" json:"downgrade_min_sources"`    // Independent sources required for a fair value that worsens the assessment (0 = off)
+	ShadowMetricsJSON   string    `gorm:"type:text" json:"shadow_metrics_json"`      // Experimental MetricsConfig computed alongside the live one (empty = shadow mode off)
+	KellyUtilizationMin float64   `gorm:"default:0.75" json:"kelly_utilization_min"` // Lower bound of the target invested fraction (0–1)
+	KellyUtilizationMax float64   `gorm:"default:0.85" json:"kelly_utilization_max"` // Upper bound of the target invested fraction (0–1)
+	MinCashBufferPct    float64   `gorm:"default:8" json:"min_cash_buffer_pct"`      // Cash (%) kept when scaling positions up
+	KellyRoundingStep   float64   `json:"kelly_rounding_step"`                       // Round suggested order weights to this step (%), e.g. 0.5 (0 = off)
+	MaxFVDisagreement   float64   `gorm:"default:20" json:"max_fv_disagreement"`     // Flag collected fair values when provider medians differ by more than this % (0 = off)
+	MaxFVDispersion     float64   `gorm:"default:25" json:"max_fv_dispersion"`       // Flag collected fair values whose standard deviation exceeds this % of their median (0 = off)
+	RebalanceReviewDays int       `gorm:"default:90" json:"rebalance_review_days"`   // Raise a review_due alert this many days after the last portfolio review (0 = off)
+	LastReviewedAt      time.Time `json:"last_reviewed_at"`                          // Set by POST /portfolio/mark-reviewed; zero = never reviewed
+	ReviewReminderEmail bool      `json:"review_reminder_email"`                     // Email review_due alerts (with a portfolio summary) via the alert job
+	MaxPositions        int       `gorm:"default:20" json:"max_positions"`           // Soft cap on held positions; /portfolio/health suggests consolidation above it (0 = off)
+	AllowNegativeCash   bool      `json:"allow_negative_cash"`                       // Permit negative cash holdings (margin/overdraft); they reduce net liquidity
+	QuietHoursStart     string    `json:"quiet_hours_start"`                         // HH:MM; non-urgent alert emails are held from here until QuietHoursEnd (empty = off)
+	QuietHoursEnd       string    `json:"quiet_hours_end"`                           // HH:MM; may be earlier than the start (window wraps midnight)
+	QuietHoursTZ        string    `json:"quiet_hours_tz"`                            // IANA timezone of the quiet hours (empty = UTC)
+	ProbabilityBand     float64   `gorm:"default:0.1" json:"probability_band"`       // Half-width of the probability band for EV intervals (0.1 = p ± 0.10)
+	MaxPriceMove        float64   `gorm:"default:10" json:"max_price_move"`          // Scheduled prices more than this multiple above/below the last price mark the stock halted (0 = off)
+	MaxBuyZoneDownside  float64   `gorm:"default:10" json:"max_buy_zone_downside"`   // Buy-zone stocks with |downside risk| above this (%) are flagged elevated risk (0 = off)
+	MinRatioPositions   int       `gorm:"default:2" json:"min_ratio_positions"`      // Valued positions required before the Sharpe ratio is reported (it also needs non-zero volatility)
+	OrderNearLimitPct   float64   `gorm:"default:2" json:"order_near_limit_pct"`     // Flag open orders whose limit is within this % of the current price
+	MaxCorrelatedWeight float64   `gorm:"default:25" json:"max_correlated_weight"`   // Warn when same-industry (else same-sector) positions together exceed this % (0 = off)
+	MaxSectorWeight     float64   `gorm:"default:30" json:"max_sector_weight"`       // Raise a sector_overexposure alert when a sector exceeds this % of invested value (0 = off)
+	AssumedCorrelation  float64   `gorm:"default:0.3" json:"assumed_correlation"`    // Return correlation assumed between positions for the portfolio volatility (-1 to 1)
+	BenchmarkRelativeEV bool      `json:"benchmark_relative_ev"`                     // Measure EV and Kelly as excess return over BenchmarkReturn; the EV thresholds then apply to alpha
+	BenchmarkReturn     float64   `gorm:"default:8" json:"benchmark_return"`         // Benchmark's expected annual return (%) used by benchmark-relative EV
+	AlertCooldownHours  int       `gorm:"default:12" json:"alert_cooldown_hours"`    // Suppress repeat ev_change/buy_zone alerts for a stock within this many hours, from scheduled or manual refreshes (0 = off)
+	MinPositionValue    float64   `json:"min_position_value"`                        // Held positions worth less than this (EUR) are flagged as dust in the summary (0 = off)
+	ExcludeDust         bool      `json:"exclude_dust"`                              // Leave dust positions out of the weighted portfolio metrics (EV, volatility, Sharpe, Kelly utilization)
 	CreatedAt           time.Time `json:"created_at"`
 	UpdatedAt           time.Time `json:"updated_at"`
 }
 
 // Alert represents an alert that was triggered
 type Alert struct {
-	ID          uint      `gorm:"primarykey" json:"id"`
-	PortfolioID uint      `gorm:"not null;index" json:"portfolio_id"`
-	StockID     uint      `json:"stock_id"`
-	Ticker      string    `json:"ticker"`
-	AlertType   string    `json:"alert_type"` // ev_change, buy_zone, etc.
-	Message     string    `json:"message"`
-	EmailSent   bool      `json:"email_sent"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID           uint       `gorm:"primarykey" json:"id"`
+	PortfolioID  uint       `gorm:"not null;index" json:"portfolio_id"`
+	StockID      uint       `json:"stock_id"`
+	Ticker       string     `json:"ticker"`
+	AlertType    string     `json:"alert_type"` // ev_change, buy_zone, etc.
+	Severity     string     `json:"severity"`   // info, warning or critical; derived from the type when empty
+	Message      string     `json:"message"`
+	EmailSent    bool       `json:"email_sent"`
+	TelegramSent bool       `json:"telegram_sent"`
+	DeliveredAt  *time.Time `json:"delivered_at"` // Set once every channel routed for its severity has it (or none was routed)
+	QuietHeld    bool       `json:"quiet_held"`   // Deferred by quiet hours; goes out in the digest after the window
+	CreatedAt    time.Time  `json:"created_at"`
 }
 
 // ExchangeRate represents currency exchange rates
@@ -161,10 +249,20 @@ type ExchangeRate struct {
 	LastUpdated  time.Time `json:"last_updated"`
 	IsActive     bool      `json:"is_active" gorm:"default:true"`  // Whether this currency is actively used
 	IsManual     bool      `json:"is_manual" gorm:"default:false"` // Whether rate is manually set
+	Provider     string    `json:"provider"`                       // Provider that supplied Rate (exchangerate-api, frankfurter) or manual
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// ExchangeRateHistory is a dated exchange rate, appended for every tracked currency on each refresh
+type ExchangeRateHistory struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CurrencyCode string    `gorm:"not null;index:idx_exchange_rate_history_lookup" json:"currency_code"`
+	Rate         float64   `json:"rate"`     // Rate relative to EUR (base currency) at RecordedAt
+	Provider     string    `json:"provider"` // Provider that supplied the rate, or manual
+	RecordedAt   time.Time `gorm:"not null;index:idx_exchange_rate_history_lookup" json:"recorded_at"`
+}
+
 // CashHolding represents available cash in different currencies
 type CashHolding struct {
 	ID           uint      `gorm:"primarykey" json:"id"`
@@ -172,6 +270,9 @@ type CashHolding struct {
 	CurrencyCode string    `gorm:"not null;index" json:"currency_code"` // EUR, USD, DKK, GBP, etc.
 	Amount       float64   `json:"amount"`                              // Amount available in this currency
 	USDValue     float64   `json:"usd_value"`                           // Current value in USD (calculated)
+	RateStale    bool      `json:"rate_stale"`                          // No USD rate (USDValue is the EUR equivalent) or no rate for CurrencyCode (values are the last calculated)
+	BaseCurrency string    `json:"base_currency"`                       // Portfolio base currency BaseValue is in
+	BaseValue    float64   `json:"base_value"`                          // Current value in BaseCurrency (calculated)
 	Description  string    `json:"description"`                         // Optional description/note
 	LastUpdated  time.Time `json:"last_updated"`
 	CreatedAt    time.Time `json:"created_at"`
@@ -186,6 +287,10 @@ type Assessment struct {
 	Source      string    `gorm:"not null;uniqueIndex:idx_assessment_portfolio_ticker_source" json:"source"` // 'grok' or 'deepseek'
 	Assessment  string    `gorm:"type:text" json:"assessment"`                                               // Full assessment text
 	Status      string    `gorm:"default:'pending'" json:"status"`                                           // 'pending', 'completed', 'failed'
+	ExpectedValue  *float64 `json:"expected_value"` // Final EV (%) parsed from the Final Assessment section; null when not found
+	HalfKelly      *float64 `json:"half_kelly"`     // Final ½-Kelly (%) parsed from the Final Assessment section
+	Recommendation *string  `json:"recommendation"` // Add, Hold, Trim or Sell parsed from the Final Assessment section
+	StockID        *uint    `gorm:"index" json:"stock_id"` // Stock a scheduled assessment was generated for; null for on-demand ones
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -205,21 +310,135 @@ type Operation struct {
 	ID            uint      `gorm:"primarykey" json:"id"`
 	PortfolioID   uint      `gorm:"not null;index" json:"portfolio_id"`
 	StockID       *uint     `json:"stock_id,omitempty"`                   // Optional link to stock for Buy/Sell
+	OrderID       *uint     `gorm:"index" json:"order_id,omitempty"`      // Set when the trade is a fill of a limit order
 	OperationType string    `gorm:"not null;index" json:"operation_type"` // Buy, Sell, Deposit, Withdraw, Dividend
 	Ticker        string    `gorm:"index" json:"ticker"`
 	ISIN          string    `json:"isin"`
 	CompanyName   string    `json:"company_name"`
 	Sector        string    `json:"sector"`
 	Currency      string    `gorm:"not null" json:"currency"`
-	Quantity      float64   `json:"quantity"` // Shares for Buy/Sell; can be amount for Deposit/Withdraw
-	Price         float64   `json:"price"`    // Price per share for Buy/Sell
-	Amount        float64   `json:"amount"`   // Total monetary amount in currency (for cash impact)
+	Quantity      float64   `json:"quantity"`      // Shares for Buy/Sell; can be amount for Deposit/Withdraw
+	Price         float64   `json:"price"`         // Price per share for Buy/Sell
+	Amount        float64   `json:"amount"`        // Total monetary amount in currency (for cash impact)
+	FXRate        float64   `json:"fx_rate"`       // Currency units per 1 EUR at trade time (0 = not recorded; current rates are used)
+	StockFXRate   float64   `json:"stock_fx_rate"` // Linked stock's currency units per 1 EUR at trade time, for lots in another currency
 	Note          string    `gorm:"type:text" json:"note"`
 	TradeDate     string    `gorm:"not null;index" json:"trade_date"` // DD.MM.YYYY
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// Order is a limit order that may fill over several trades. Each fill is recorded as a Buy or
+// Sell Operation (linked by OrderID) that adjusts cash and the position.
+type Order struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	PortfolioID    uint      `gorm:"not null;index" json:"portfolio_id"`
+	StockID        *uint     `json:"stock_id,omitempty"` // Set once the ticker is held or the first fill creates the position
+	Ticker         string    `gorm:"not null;index" json:"ticker"`
+	Side           string    `gorm:"not null" json:"side"` // Buy or Sell
+	Currency       string    `gorm:"not null" json:"currency"`
+	LimitPrice     float64   `json:"limit_price"`
+	Quantity       float64   `json:"quantity"`
+	FilledQuantity float64   `json:"filled_quantity"`
+	Status         string    `gorm:"not null;index" json:"status"` // open, partial, filled or cancelled
+	Note           string    `gorm:"type:text" json:"note"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PortfolioSnapshot stores a daily record of portfolio-level totals for performance tracking.
+// Snapshots are end-of-day: one row per portfolio and UTC day, the last write of the day wins.
+type PortfolioSnapshot struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	PortfolioID      uint      `gorm:"not null;uniqueIndex:idx_portfolio_snapshot_day" json:"portfolio_id"`
+	SnapshotDate     string    `gorm:"size:10;uniqueIndex:idx_portfolio_snapshot_day" json:"snapshot_date"` // YYYY-MM-DD (UTC)
+	TotalValueEUR    float64   `json:"total_value_eur"`
+	CashEUR          float64   `json:"cash_eur"` // Cash holdings in EUR; 0 on snapshots recorded before it was tracked
+	OverallEV        float64   `json:"overall_ev"`
+	SharpeRatio      *float64  `json:"sharpe_ratio"`      // Nil when unavailable or recorded before it was tracked
+	KellyUtilization float64   `json:"kelly_utilization"` // Percent (0–100) of positions value, as in the summary
+	CashPct          float64   `json:"cash_pct"`          // Cash as a percent of positions plus cash
+	RecordedAt       time.Time `gorm:"index" json:"recorded_at"`
+}
+
+// BenchmarkSnapshot stores a benchmark index price captured alongside portfolio snapshots.
+// One row per symbol and UTC day, the last write of the day wins.
+type BenchmarkSnapshot struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	Symbol       string    `gorm:"not null;uniqueIndex:idx_benchmark_snapshot_day" json:"symbol"`
+	SnapshotDate string    `gorm:"size:10;uniqueIndex:idx_benchmark_snapshot_day" json:"snapshot_date"` // YYYY-MM-DD (UTC)
+	Price        float64   `json:"price"`
+	RecordedAt   time.Time `gorm:"index" json:"recorded_at"`
+}
+
+// SchedulerRun records one scheduled batch update and its outcome counts
+type SchedulerRun struct {
+	ID                uint                  `gorm:"primarykey" json:"id"`
+	Frequency         string                `gorm:"index" json:"frequency"` // daily/weekly/monthly
+	StartedAt         time.Time             `gorm:"index" json:"started_at"`
+	FinishedAt        time.Time             `json:"finished_at"`
+	Total             int                   `json:"total"`
+	Succeeded         int                   `json:"succeeded"`
+	TransientFailures int                   `json:"transient_failures"` // Provider/network errors; likely to succeed on retry
+	PermanentFailures int                   `json:"permanent_failures"` // Bad/unknown ticker; needs user action
+	HistoryError      string                `gorm:"type:text" json:"history_error,omitempty"` // Set when the run's batched history insert failed
+	Outcomes          []SchedulerRunOutcome `gorm:"foreignKey:RunID" json:"outcomes,omitempty"`
+}
+
+// SchedulerRunOutcome is the result of updating one stock during a SchedulerRun
+type SchedulerRunOutcome struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	RunID       uint   `gorm:"not null;index" json:"run_id"`
+	StockID     uint   `gorm:"index" json:"stock_id"`
+	PortfolioID uint   `gorm:"index" json:"portfolio_id"`
+	Ticker      string `json:"ticker"`
+	Status      string `gorm:"index" json:"status"` // success, transient, permanent
+	Error       string `gorm:"type:text" json:"error,omitempty"`
+}
+
+// ProviderCallLog is one outbound provider request in the compliance ledger (PROVIDER_CALL_LOG=db).
+// It never holds secrets: API keys in the URL and auth headers are redacted.
+type ProviderCallLog struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	Timestamp        time.Time `gorm:"index" json:"timestamp"`
+	Provider         string    `gorm:"index" json:"provider"`
+	Method           string    `json:"method"`
+	Endpoint         string    `gorm:"type:text" json:"endpoint"`          // URL with API keys redacted
+	Headers          string    `gorm:"type:text" json:"headers,omitempty"` // "Name: value" pairs, auth headers redacted
+	Ticker           string    `gorm:"index" json:"ticker,omitempty"`
+	UseCase          string    `json:"use_case,omitempty"`
+	Status           int       `json:"status"`     // HTTP status, 0 when the request failed
+	LatencyMs        int64     `json:"latency_ms"` // Until response headers
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	TotalTokens      int       `json:"total_tokens,omitempty"`
+	Error            string    `gorm:"type:text" json:"error,omitempty"`
+}
+
+// FairValueAge returns how long ago fair value was last collected successfully (0 if never).
+func (s *Stock) FairValueAge(now time.Time) time.Duration {
+	if s.FairValueCollectedAt == nil {
+		return 0
+	}
+	return now.Sub(*s.FairValueCollectedAt)
+}
+
+// HasTag reports whether tag is among the stock's manual or derived tags (case-insensitive).
+func (s *Stock) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return false
+	}
+	for _, list := range []string{s.Tags, s.DerivedTags} {
+		for _, t := range strings.Split(list, ",") {
+			if strings.ToLower(strings.TrimSpace(t)) == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // BeforeCreate hook for Stock to set defaults
 func (s *Stock) BeforeCreate(tx *gorm.DB) error {
 	if s.UpdateFrequency == "" {
@@ -230,3 +449,20 @@ func (s *Stock) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// SnapshotDay returns the dedup key for daily snapshots: the UTC calendar day of t.
+func SnapshotDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// BeforeSave hook for PortfolioSnapshot to derive the daily dedup key
+func (s *PortfolioSnapshot) BeforeSave(tx *gorm.DB) error {
+	s.SnapshotDate = SnapshotDay(s.RecordedAt)
+	return nil
+}
+
+// BeforeSave hook for BenchmarkSnapshot to derive the daily dedup key
+func (s *BenchmarkSnapshot) BeforeSave(tx *gorm.DB) error {
+	s.SnapshotDate = SnapshotDay(s.RecordedAt)
+	return nil
+}
@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// ratingsFetcher is the subset of ExternalAPIService used by the analyst rating pass.
+type ratingsFetcher interface {
+	FetchAnalystRatings(ticker string) (services.AnalystRatings, error)
+}
+
+// reestimateProbabilities fetches the analyst rating mix of every scheduled (not "manually" updated)
+// stock and applies it with services.ApplyAnalystRatings. A stock whose p is re-estimated is saved
+// with its recomputed metrics and gets a probability_reestimated alert noting the p and EV change.
+// Returns the number of stocks re-estimated.
+func reestimateProbabilities(db *gorm.DB, fetcher ratingsFetcher, minShift float64, logger zerolog.Logger) int {
+	var stocks []models.Stock
+	if err := db.Where("update_frequency <> ?", "manually").Find(&stocks).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to load stocks for analyst rating check")
+		return 0
+	}
+
+	reestimated := 0
+	for i := range stocks {
+		if reestimateProbability(db, fetcher, &stocks[i], minShift, logger) {
+			reestimated++
+		}
+		time.Sleep(updateDelay)
+	}
+	return reestimated
+}
+
+// reestimateProbability applies one stock's current rating mix and reports whether p changed.
+func reestimateProbability(db *gorm.DB, fetcher ratingsFetcher, stock *models.Stock, minShift float64, logger zerolog.Logger) bool {
+	ratings, err := fetcher.FetchAnalystRatings(stock.Ticker)
+	if err != nil {
+		logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to fetch analyst ratings")
+		return false
+	}
+	if ratings.Total() == 0 {
+		return false
+	}
+
+	change, applied := services.ApplyAnalystRatings(stock, ratings, minShift, time.Now(), services.PortfolioMetricsConfig(db, stock.PortfolioID))
+	if err := db.Save(stock).Error; err != nil {
+		logger.Error().Err(err).Str("ticker", stock.Ticker).Msg("Failed to save analyst ratings")
+		return false
+	}
+	if !applied {
+		return false
+	}
+
+	logger.Info().
+		Str("ticker", stock.Ticker).
+		Float64("old_probability", change.OldProbability).
+		Float64("new_probability", change.NewProbability).
+		Msg("Re-estimated probability from analyst ratings")
+	alert := models.Alert{
+		PortfolioID: stock.PortfolioID,
+		StockID:     stock.ID,
+		Ticker:      stock.Ticker,
+		AlertType:   services.AlertTypeProbabilityReestimated,
+		Message:     change.Message(stock.Ticker),
+		CreatedAt:   time.Now(),
+	}
+	if err := db.Create(&alert).Error; err != nil {
+		logger.Error().Err(err).Str("ticker", stock.Ticker).Msg("Failed to create probability re-estimate alert")
+	}
+	return true
+}
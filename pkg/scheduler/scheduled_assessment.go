@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// stockAssessor is the subset of services.AssessmentService used by scheduled assessments.
+type stockAssessor interface {
+	ScheduledSource() string
+	AssessStock(stock *models.Stock) (models.Assessment, error)
+}
+
+// runScheduledAssessments generates an assessment for every stock whose AssessmentFrequency makes it
+// due at now (see services.AssessmentDue), longest-unassessed first and at most maxPerRun per call
+// (the LLM budget; <= 0 runs none). Calls are spaced by updateDelay on top of the assessor's own rate
+// limiting. A stock whose new recommendation differs from its previous assessment's gets an
+// assessment_changed alert. Returns the number of stocks assessed.
+func runScheduledAssessments(db *gorm.DB, assessor stockAssessor, maxPerRun int, now time.Time, logger zerolog.Logger) int {
+	if maxPerRun <= 0 {
+		return 0
+	}
+	var stocks []models.Stock
+	if err := db.Where("assessment_frequency IN ?", []string{services.AssessmentFrequencyWeekly, services.AssessmentFrequencyMonthly}).
+		Order("last_assessed_at IS NOT NULL, last_assessed_at ASC, id ASC").Find(&stocks).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to load stocks for scheduled assessments")
+		return 0
+	}
+
+	assessed := 0
+	for i := range stocks {
+		if !services.AssessmentDue(stocks[i], now) {
+			continue
+		}
+		if assessed >= maxPerRun {
+			logger.Info().Int("max_per_run", maxPerRun).Msg("Scheduled assessment budget reached, remaining due stocks wait for the next run")
+			break
+		}
+		if assessed > 0 {
+			time.Sleep(updateDelay)
+		}
+		if assessStock(db, assessor, &stocks[i], now, logger) {
+			assessed++
+		}
+	}
+	return assessed
+}
+
+// assessStock generates and records one scheduled assessment and reports whether it succeeded.
+func assessStock(db *gorm.DB, assessor stockAssessor, stock *models.Stock, now time.Time, logger zerolog.Logger) bool {
+	previous := latestRecommendation(db, stock, assessor.ScheduledSource())
+	record, err := assessor.AssessStock(stock)
+	if err != nil {
+		logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Scheduled assessment failed")
+		return false
+	}
+	if err := db.Model(stock).Update("last_assessed_at", now).Error; err != nil {
+		logger.Error().Err(err).Str("ticker", stock.Ticker).Msg("Failed to record scheduled assessment time")
+	}
+	logger.Info().Str("ticker", stock.Ticker).Str("source", record.Source).Msg("Generated scheduled assessment")
+
+	if previous == "" || record.Recommendation == nil || strings.EqualFold(previous, *record.Recommendation) {
+		return true
+	}
+	alert := models.Alert{
+		PortfolioID: stock.PortfolioID,
+		StockID:     stock.ID,
+		Ticker:      stock.Ticker,
+		AlertType:   services.AlertTypeAssessmentChanged,
+		Message:     fmt.Sprintf("%s scheduled %s assessment changed from %s to %s", stock.Ticker, record.Source, previous, *record.Recommendation),
+		CreatedAt:   now,
+	}
+	if _, err := services.RaiseStockAlert(db, alert, 0); err != nil {
+		logger.Error().Err(err).Str("ticker", stock.Ticker).Msg("Failed to create assessment change alert")
+	}
+	return true
+}
+
+// latestRecommendation returns the recommendation of the stock's stored completed assessment from source,
+// or "" when there is none or it had no parsable recommendation. Assessments store tickers upper-cased.
+func latestRecommendation(db *gorm.DB, stock *models.Stock, source string) string {
+	var last models.Assessment
+	if err := db.Where("portfolio_id = ? AND ticker = ? AND source = ? AND status = ?", stock.PortfolioID, strings.ToUpper(strings.TrimSpace(stock.Ticker)), source, "completed").
+		Order("updated_at DESC").First(&last).Error; err != nil || last.Recommendation == nil {
+		return ""
+	}
+	return *last.Recommendation
+}
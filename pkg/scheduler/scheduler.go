@@ -1,6 +1,8 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -25,6 +27,12 @@ func InitScheduler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 	apiService := services.NewExternalAPIService(cfg)
 	exchangeRateService := services.NewExchangeRateService(db, logger)
 
+	// Fair value collection is opt-in for scheduled runs (LLM calls per stock)
+	var collector fairValueCollector
+	if cfg.SchedulerFairValues {
+		collector = services.NewFairValueCollector(cfg)
+	}
+
 	// Daily latest-price update job (Mon-Fri at 4:05 PM ET)
 	if _, err := s.Every(1).Day().At("16:05").Do(func() {
 		nowNY := time.Now().In(newYorkLocation)
@@ -32,7 +40,9 @@ func InitScheduler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 			return
 		}
 		logger.Info().Msg("Running weekday daily stock update at 4:05 PM ET")
-		updateStocksWithFrequency(db, apiService, exchangeRateService, logger, "daily")
+		updateStocksWithFrequency(db, apiService, collector, exchangeRateService, logger, "daily", cfg.SchedulerHistoryBatchSize)
+		snapshotPortfolios(db, exchangeRateService, logger)
+		snapshotBenchmarks(db, apiService, cfg.BenchmarkSymbols, logger)
 	}); err != nil {
 		logger.Error().Err(err).Msg("Failed to schedule daily update job")
 	}
@@ -40,7 +50,7 @@ func InitScheduler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 	// Weekly update job (Mondays)
 	if _, err := s.Every(1).Monday().At("00:00").Do(func() {
 		logger.Info().Msg("Running weekly stock update")
-		updateStocksWithFrequency(db, apiService, exchangeRateService, logger, "weekly")
+		updateStocksWithFrequency(db, apiService, collector, exchangeRateService, logger, "weekly", cfg.SchedulerHistoryBatchSize)
 	}); err != nil {
 		logger.Error().Err(err).Msg("Failed to schedule weekly update job")
 	}
@@ -48,13 +58,41 @@ func InitScheduler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 	// Monthly update job (1st of month)
 	if _, err := s.Every(1).Month(1).At("00:00").Do(func() {
 		logger.Info().Msg("Running monthly stock update")
-		updateStocksWithFrequency(db, apiService, exchangeRateService, logger, "monthly")
+		updateStocksWithFrequency(db, apiService, collector, exchangeRateService, logger, "monthly", cfg.SchedulerHistoryBatchSize)
 	}); err != nil {
 		logger.Error().Err(err).Msg("Failed to schedule monthly update job")
 	}
 
+	// Analyst rating check (Mondays): re-estimate p where the rating mix moved materially
+	if cfg.RatingProbabilityUpdates {
+		if _, err := s.Every(1).Monday().At("06:00").Do(func() {
+			logger.Info().Msg("Running weekly analyst rating check")
+			reestimateProbabilities(db, apiService, cfg.RatingMixMinShift, logger)
+		}); err != nil {
+			logger.Error().Err(err).Msg("Failed to schedule analyst rating job")
+		}
+	}
+
+	// Scheduled assessment job (daily): LLM re-assessment of stocks with a weekly/monthly AssessmentFrequency
+	assessor := services.NewAssessmentService(db, cfg, logger)
+	if _, err := s.Every(1).Day().At("07:00").Do(func() {
+		logger.Info().Msg("Running scheduled stock assessments")
+		runScheduledAssessments(db, assessor, cfg.ScheduledAssessmentMaxPerRun, time.Now(), logger)
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to schedule assessment job")
+	}
+
+	// Portfolio review reminder and cash buffer job (daily)
+	if _, err := s.Every(1).Day().At("08:00").Do(func() {
+		checkReviewReminders(db, exchangeRateService, time.Now(), logger)
+		checkCashBuffer(db, exchangeRateService, time.Now(), logger)
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to schedule review reminder job")
+	}
+
 	// Alert check job (every hour)
 	if _, err := s.Every(1).Hour().Do(func() {
+		checkSectorOverexposure(db, exchangeRateService, time.Now(), logger)
 		checkAndSendAlerts(db, cfg, logger)
 	}); err != nil {
 		logger.Error().Err(err).Msg("Failed to schedule alert check job")
@@ -64,60 +102,184 @@ func InitScheduler(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
 	logger.Info().Msg("Scheduler initialized and started")
 }
 
-// updateStocksWithFrequency updates all stocks with the specified frequency
-func updateStocksWithFrequency(db *gorm.DB, apiService *services.ExternalAPIService, exchangeRateService *services.ExchangeRateService, logger zerolog.Logger, frequency string) {
+// priceFetcher is the subset of ExternalAPIService used by scheduled updates.
+type priceFetcher interface {
+	FetchStockPrice(ticker string) (float64, error)
+}
+
+// fairValueCollector is the subset of FairValueCollector used by scheduled updates.
+type fairValueCollector interface {
+	CollectTrustedFairValues(ctx context.Context, stock *models.Stock) ([]services.NormalizedFairValueEntry, error)
+}
+
+// Per-stock outcome statuses recorded on SchedulerRunOutcome
+const (
+	outcomeSuccess   = "success"
+	outcomeTransient = "transient"
+	outcomePermanent = "permanent"
+)
+
+// updateDelay spaces out provider calls between stocks to avoid rate limiting
+var updateDelay = 1 * time.Second
+
+// defaultHistoryBatchSize is used when no positive SCHEDULER_HISTORY_BATCH_SIZE is configured
+const defaultHistoryBatchSize = 100
+
+// updateStocksWithFrequency updates all stocks with the specified frequency and persists a SchedulerRun
+// with per-stock outcomes. History snapshots of updated stocks are written at the end of the run in
+// batches of historyBatchSize rows. Returns nil when there is nothing to run.
+func updateStocksWithFrequency(db *gorm.DB, apiService priceFetcher, collector fairValueCollector, exchangeRateService *services.ExchangeRateService, logger zerolog.Logger, frequency string, historyBatchSize int) *models.SchedulerRun {
 	// Skip if frequency is "manually" - these stocks are only updated by user action
 	if frequency == "manually" {
-		return
+		return nil
 	}
 
 	var stocks []models.Stock
 	if err := db.Where("update_frequency = ?", frequency).Find(&stocks).Error; err != nil {
 		logger.Error().Err(err).Str("frequency", frequency).Msg("Failed to fetch stocks for update")
-		return
+		return nil
 	}
 
 	logger.Info().Int("count", len(stocks)).Str("frequency", frequency).Msg("Updating stocks")
 
+	run := models.SchedulerRun{
+		Frequency: frequency,
+		StartedAt: time.Now(),
+		Total:     len(stocks),
+		Outcomes:  make([]models.SchedulerRunOutcome, 0, len(stocks)),
+	}
+	histories := make([]models.StockHistory, 0, len(stocks))
+
 	for i := range stocks {
-		if err := updateStock(db, apiService, exchangeRateService, &stocks[i], logger); err != nil {
-			logger.Warn().Err(err).Str("ticker", stocks[i].Ticker).Msg("Failed to update stock")
+		outcome := models.SchedulerRunOutcome{
+			StockID:     stocks[i].ID,
+			PortfolioID: stocks[i].PortfolioID,
+			Ticker:      stocks[i].Ticker,
+			Status:      outcomeSuccess,
+		}
+		history, err := updateStock(db, apiService, collector, exchangeRateService, &stocks[i], logger)
+		if err != nil {
+			outcome.Status = classifyUpdateError(err)
+			outcome.Error = err.Error()
+			logger.Warn().Err(err).Str("ticker", stocks[i].Ticker).Str("status", outcome.Status).Msg("Failed to update stock")
 		} else {
+			histories = append(histories, history)
 			logger.Debug().Str("ticker", stocks[i].Ticker).Msg("Stock updated successfully")
 		}
 
+		switch outcome.Status {
+		case outcomeSuccess:
+			run.Succeeded++
+		case outcomePermanent:
+			run.PermanentFailures++
+		default:
+			run.TransientFailures++
+		}
+		run.Outcomes = append(run.Outcomes, outcome)
+
 		// Add a small delay to avoid rate limiting
-		time.Sleep(1 * time.Second)
+		time.Sleep(updateDelay)
+	}
+
+	run.FinishedAt = time.Now()
+	if err := saveRunWithHistory(db, &run, histories, historyBatchSize); err != nil {
+		logger.Error().Err(err).Str("frequency", frequency).Int("history_rows", len(histories)).Msg("Failed to save scheduler run")
+	}
+	logger.Info().
+		Int("succeeded", run.Succeeded).
+		Int("transient_failures", run.TransientFailures).
+		Int("permanent_failures", run.PermanentFailures).
+		Str("frequency", frequency).
+		Msg("Stock update run finished")
+
+	return &run
+}
+
+// saveRunWithHistory writes the run's history snapshots (batchSize rows per INSERT) and the run itself
+// in one transaction. If the history insert fails, the error is recorded in run.HistoryError, the run
+// is saved without the snapshots and the history error is returned.
+func saveRunWithHistory(db *gorm.DB, run *models.SchedulerRun, histories []models.StockHistory, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = defaultHistoryBatchSize
+	}
+
+	var historyErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(histories) > 0 {
+			if historyErr = tx.CreateInBatches(&histories, batchSize).Error; historyErr != nil {
+				return historyErr
+			}
+		}
+		return tx.Create(run).Error
+	})
+	if historyErr == nil {
+		return err
+	}
+
+	historyErr = fmt.Errorf("failed to write %d stock history rows: %w", len(histories), historyErr)
+	run.HistoryError = historyErr.Error()
+	if err := db.Create(run).Error; err != nil {
+		return err
 	}
+	return historyErr
 }
 
-// updateStock updates a single stock's data
-func updateStock(db *gorm.DB, apiService *services.ExternalAPIService, exchangeRateService *services.ExchangeRateService, stock *models.Stock, _ zerolog.Logger) error {
+// classifyUpdateError separates permanent failures (no usable price, halted or delisted) from
+// transient provider, network or database errors.
+func classifyUpdateError(err error) string {
+	if errors.Is(err, services.ErrNoPriceData) || errors.Is(err, services.ErrTradingHalted) {
+		return outcomePermanent
+	}
+	return outcomeTransient
+}
+
+// updateStock updates a single stock's data and returns its unsaved history snapshot.
+// Fair value collection (when collector is non-nil) is best-effort: on failure the last-known
+// FairValue is kept, the stock is flagged FairValueStale, and the price update still proceeds.
+func updateStock(db *gorm.DB, apiService priceFetcher, collector fairValueCollector, exchangeRateService *services.ExchangeRateService, stock *models.Stock, logger zerolog.Logger) (models.StockHistory, error) {
 	oldEV := stock.ExpectedValue
 
-	// Fetch current price
+	settings := services.LoadPortfolioSettings(db, stock.PortfolioID)
+	metricsConfig := services.PortfolioMetricsConfig(db, stock.PortfolioID)
+
+	// Fetch current price. No price, a stale quote or an implausible price marks the stock halted
+	// and leaves its metrics at their last-known values.
 	price, err := apiService.FetchStockPrice(stock.Ticker)
+	if err != nil && !errors.Is(err, services.ErrNoPriceData) && !errors.Is(err, services.ErrTradingHalted) {
+		return models.StockHistory{}, err
+	}
+	if err == nil && services.IsImplausiblePrice(price, stock.CurrentPrice, settings.MaxPriceMove) {
+		err = fmt.Errorf("%w: %s price %.4f is unusable against last price %.4f", services.ErrTradingHalted, stock.Ticker, price, stock.CurrentPrice)
+	}
 	if err != nil {
-		return err
+		markTradingHalted(db, stock, err, logger)
+		return models.StockHistory{}, err
 	}
 	stock.CurrentPrice = price
+	stock.TradingStatus = services.TradingStatusActive
+
+	var fairValueEntries []services.NormalizedFairValueEntry
+	heldAssessment := ""
+	if collector != nil {
+		fairValueEntries, heldAssessment = refreshFairValue(collector, stock, settings.DowngradeMinSources, settings.MaxFVDisagreement, metricsConfig, logger)
+	}
 
 	// Calculate derived metrics
-	services.CalculateMetrics(stock)
+	services.CalculateMetrics(stock, metricsConfig)
 
 	amountLocal := float64(stock.SharesOwned) * stock.CurrentPrice
 	costLocal := float64(stock.SharesOwned) * stock.AvgPriceLocal
 	valueEUR, err := exchangeRateService.ConvertToEUR(amountLocal, stock.Currency)
 	if err != nil {
-		return err
+		return models.StockHistory{}, err
 	}
 	costEUR, err := exchangeRateService.ConvertToEUR(costLocal, stock.Currency)
 	if err != nil {
-		return err
+		return models.StockHistory{}, err
 	}
 	usdRate, err := exchangeRateService.GetRate("USD")
 	if err != nil || usdRate <= 0 {
-		return fmt.Errorf("invalid USD exchange rate for scheduler calculations")
+		return models.StockHistory{}, fmt.Errorf("invalid USD exchange rate for scheduler calculations")
 	}
 
 	stock.CurrentValueUSD = valueEUR * usdRate
@@ -125,13 +287,61 @@ func updateStock(db *gorm.DB, apiService *services.ExternalAPIService, exchangeR
 
 	stock.LastUpdated = time.Now()
 
-	// Save to database
-	if err := db.Save(stock).Error; err != nil {
-		return err
+	// Save stock and accepted fair value sources together; the history snapshot is written with the run
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if len(fairValueEntries) > 0 {
+			consensus := services.ConsensusFairValue(fairValueEntries, settings.MaxFVDisagreement)
+			if _, err := services.CheckFairValueDisagreement(tx, stock, consensus, settings, time.Now()); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(stock).Error; err != nil {
+			return err
+		}
+		// A held-back fair value stays out of the history until it is reviewed
+		if heldAssessment != "" {
+			return nil
+		}
+		for _, entry := range fairValueEntries {
+			fvHistory := models.FairValueHistory{
+				StockID:     stock.ID,
+				PortfolioID: stock.PortfolioID,
+				Ticker:      stock.Ticker,
+				FairValue:   entry.FairValue,
+				Source:      entry.Source,
+				RecordedAt:  entry.RecordedAt,
+			}
+			if err := tx.Create(&fvHistory).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return models.StockHistory{}, err
 	}
 
-	// Create history entry
-	history := models.StockHistory{
+	// A thinly sourced fair value that would have worsened the assessment was held back
+	if heldAssessment != "" {
+		alert := models.Alert{
+			PortfolioID: stock.PortfolioID,
+			StockID:     stock.ID,
+			Ticker:      stock.Ticker,
+			AlertType:   "needs_review",
+			Message:     services.NeedsReviewAlertMessage(stock, fairValueEntries, heldAssessment),
+			EmailSent:   false,
+			CreatedAt:   time.Now(),
+		}
+		if _, err := services.RaiseStockAlert(db, alert, services.AlertCooldown(settings)); err != nil {
+			logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to raise needs_review alert")
+		}
+	}
+
+	// EV change and buy zone alerts, deduplicated against manual refreshes
+	if _, err := services.RaiseStockUpdateAlerts(db, stock, oldEV, settings, time.Now()); err != nil {
+		logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to raise stock alerts")
+	}
+
+	return models.StockHistory{
 		StockID:             stock.ID,
 		PortfolioID:         stock.PortfolioID,
 		Ticker:              stock.Ticker,
@@ -144,63 +354,391 @@ func updateStock(db *gorm.DB, apiService *services.ExternalAPIService, exchangeR
 		KellyFraction:       stock.KellyFraction,
 		Weight:              stock.Weight,
 		Assessment:          stock.Assessment,
-		RecordedAt:          time.Now(),
+		PriceType:           services.PriceTypeEndOfDay,
+		RecordedAt:          stock.LastUpdated,
+	}, nil
+}
+
+// markTradingHalted flags the stock halted without touching its metrics and raises one
+// trading_halted alert when it was still trading.
+func markTradingHalted(db *gorm.DB, stock *models.Stock, cause error, logger zerolog.Logger) {
+	if stock.TradingStatus == services.TradingStatusHalted {
+		return
+	}
+	stock.TradingStatus = services.TradingStatusHalted
+	if err := db.Model(stock).Update("trading_status", services.TradingStatusHalted).Error; err != nil {
+		logger.Error().Err(err).Str("ticker", stock.Ticker).Msg("Failed to mark stock halted")
+		return
 	}
-	db.Create(&history)
+	logger.Warn().Err(cause).Str("ticker", stock.Ticker).Msg("Stock marked halted, keeping last-known metrics")
+
+	alert := models.Alert{
+		PortfolioID: stock.PortfolioID,
+		StockID:     stock.ID,
+		Ticker:      stock.Ticker,
+		AlertType:   services.AlertTypeTradingHalted,
+		Message:     fmt.Sprintf("%s looks halted or delisted (%v). Its metrics keep their last-known values until a usable price is fetched.", stock.Ticker, cause),
+		CreatedAt:   time.Now(),
+	}
+	if err := db.Create(&alert).Error; err != nil {
+		logger.Error().Err(err).Str("ticker", stock.Ticker).Msg("Failed to create trading halted alert")
+	}
+}
 
-	// Check for alerts
-	var settings models.PortfolioSettings
-	db.Where("portfolio_id = ?", stock.PortfolioID).First(&settings)
+// refreshFairValue collects trusted fair values and applies their per-provider consensus to stock,
+// logging a warning when provider medians differ by more than maxDisagreementPct.
+// Returns the accepted entries, or nil when collection failed and the last-known value is kept.
+// When the new fair value would worsen the assessment without minSources independent sources,
+// the last-known value is kept and the held-back assessment is returned for a needs-review alert.
+func refreshFairValue(collector fairValueCollector, stock *models.Stock, minSources int, maxDisagreementPct float64, metricsConfig services.MetricsConfig, logger zerolog.Logger) ([]services.NormalizedFairValueEntry, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	entries, err := collector.CollectTrustedFairValues(ctx, stock)
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("no trusted fair value entries returned")
+	}
+	if err != nil {
+		stock.FairValueStale = true
+		logger.Warn().Err(err).
+			Str("ticker", stock.Ticker).
+			Float64("last_known_fair_value", stock.FairValue).
+			Dur("fair_value_age", stock.FairValueAge(time.Now())).
+			Msg("Fair value collection failed, keeping last-known fair value")
+		return nil, ""
+	}
 
-	evChange := stock.ExpectedValue - oldEV
-	if settings.AlertsEnabled && (evChange > settings.AlertThresholdEV || evChange < -settings.AlertThresholdEV) {
-		alert := models.Alert{
-			PortfolioID: stock.PortfolioID,
-			StockID:     stock.ID,
-			Ticker:      stock.Ticker,
-			AlertType:   "ev_change",
-			Message:     "EV changed from " + formatFloat(oldEV) + "% to " + formatFloat(stock.ExpectedValue) + "%",
-			EmailSent:   false,
-			CreatedAt:   time.Now(),
+	if consensus := services.ConsensusFairValue(entries, maxDisagreementPct); consensus.ProvidersDisagree {
+		logger.Warn().
+			Str("ticker", stock.Ticker).
+			Interface("provider_medians", consensus.ProviderMedians).
+			Float64("provider_disagreement_pct", consensus.ProviderDisagreementPct).
+			Msg("Fair value providers disagree, consensus is uncertain")
+	}
+
+	if applied, proposed := services.ApplyCollectedFairValue(stock, entries, minSources, time.Now(), metricsConfig); !applied {
+		logger.Warn().
+			Str("ticker", stock.Ticker).
+			Str("proposed_assessment", proposed).
+			Int("independent_sources", services.CountIndependentSources(entries)).
+			Msg("Fair value would worsen assessment without enough sources, keeping last-known fair value")
+		return entries, proposed
+	}
+	return entries, ""
+}
+
+// snapshotPortfolios writes a PortfolioSnapshot for every portfolio using the shared calculation engine
+func snapshotPortfolios(db *gorm.DB, exchangeRateService *services.ExchangeRateService, logger zerolog.Logger) {
+	fxRates, err := exchangeRateService.GetRatesMap()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load exchange rates for portfolio snapshots")
+		return
+	}
+
+	var portfolios []models.Portfolio
+	if err := db.Find(&portfolios).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to fetch portfolios for snapshots")
+		return
+	}
+
+	now := time.Now()
+	for _, portfolio := range portfolios {
+		var stocks []models.Stock
+		if err := db.Where("portfolio_id = ?", portfolio.ID).Find(&stocks).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch stocks for snapshot")
+			continue
+		}
+		metrics := services.CalculatePortfolioMetrics(stocks, fxRates, "EUR", services.PortfolioMetricsConfig(db, portfolio.ID))
+		cashEUR, err := database.PortfolioCashEUR(db, portfolio.ID, fxRates)
+		if err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch cash holdings for snapshot")
+			continue
+		}
+		snapshot := services.NewPortfolioSnapshot(portfolio.ID, metrics, cashEUR, now)
+		if err := database.SavePortfolioSnapshot(db, &snapshot); err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to save portfolio snapshot")
 		}
-		db.Create(&alert)
 	}
+}
 
-	// Check if in buy zone
-	if stock.CurrentPrice >= stock.BuyZoneMin && stock.CurrentPrice <= stock.BuyZoneMax {
+// snapshotBenchmarks records the latest price of each configured benchmark symbol
+func snapshotBenchmarks(db *gorm.DB, apiService priceFetcher, symbols []string, logger zerolog.Logger) {
+	now := time.Now()
+	for _, symbol := range symbols {
+		price, err := apiService.FetchStockPrice(symbol)
+		if err != nil || price <= 0 {
+			logger.Warn().Err(err).Str("symbol", symbol).Msg("Failed to fetch benchmark price")
+			continue
+		}
+		snapshot := models.BenchmarkSnapshot{Symbol: symbol, Price: price, RecordedAt: now}
+		if err := database.SaveBenchmarkSnapshot(db, &snapshot); err != nil {
+			logger.Warn().Err(err).Str("symbol", symbol).Msg("Failed to save benchmark snapshot")
+		}
+	}
+}
+
+// alertTypeReviewDue marks the periodic whole-portfolio review reminder.
+const alertTypeReviewDue = "review_due"
+
+// checkReviewReminders raises one review_due alert per portfolio once RebalanceReviewDays have
+// passed since the last review (or since settings were created when never reviewed). The alert
+// stays unsent, and is emailed by checkAndSendAlerts, only when ReviewReminderEmail is set.
+func checkReviewReminders(db *gorm.DB, exchangeRateService *services.ExchangeRateService, now time.Time, logger zerolog.Logger) {
+	var allSettings []models.PortfolioSettings
+	if err := db.Where("rebalance_review_days > ?", 0).Find(&allSettings).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to fetch settings for review reminders")
+		return
+	}
+
+	for _, settings := range allSettings {
+		since := settings.LastReviewedAt
+		if since.IsZero() {
+			since = settings.CreatedAt
+		}
+		if now.Sub(since) < time.Duration(settings.RebalanceReviewDays)*24*time.Hour {
+			continue
+		}
+
+		var existing int64
+		if err := db.Model(&models.Alert{}).
+			Where("portfolio_id = ? AND alert_type = ? AND created_at >= ?", settings.PortfolioID, alertTypeReviewDue, since).
+			Count(&existing).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", settings.PortfolioID).Msg("Failed to check existing review reminder")
+			continue
+		}
+		if existing > 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("Portfolio review due: %d days since the last review (interval %d days).",
+			int(now.Sub(since).Hours()/24), settings.RebalanceReviewDays)
+		if summary := reviewSummary(db, exchangeRateService, settings.PortfolioID); summary != "" {
+			message += " " + summary
+		}
 		alert := models.Alert{
-			PortfolioID: stock.PortfolioID,
-			StockID:     stock.ID,
-			Ticker:      stock.Ticker,
-			AlertType:   "buy_zone",
-			Message:     stock.Ticker + " is in buy zone at " + formatFloat(stock.CurrentPrice),
-			EmailSent:   false,
-			CreatedAt:   time.Now(),
+			PortfolioID: settings.PortfolioID,
+			AlertType:   alertTypeReviewDue,
+			Message:     message,
+			EmailSent:   !settings.ReviewReminderEmail,
+			CreatedAt:   now,
+		}
+		if !settings.ReviewReminderEmail {
+			alert.DeliveredAt = &now // In-app only: never routed to a channel
 		}
-		db.Create(&alert)
+		if err := db.Create(&alert).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", settings.PortfolioID).Msg("Failed to create review reminder")
+			continue
+		}
+		logger.Info().Uint("portfolio_id", settings.PortfolioID).Msg("Created portfolio review reminder")
 	}
+}
 
-	return nil
+// reviewSummary describes the portfolio's current value, EV and position count for a review reminder.
+func reviewSummary(db *gorm.DB, exchangeRateService *services.ExchangeRateService, portfolioID uint) string {
+	fxRates, err := exchangeRateService.GetRatesMap()
+	if err != nil {
+		return ""
+	}
+	var stocks []models.Stock
+	if err := db.Where("portfolio_id = ? AND shares_owned > ?", portfolioID, 0).Find(&stocks).Error; err != nil {
+		return ""
+	}
+	metrics := services.CalculatePortfolioMetrics(stocks, fxRates, database.PortfolioBaseCurrency(db, portfolioID), services.PortfolioMetricsConfig(db, portfolioID))
+	return fmt.Sprintf("Summary: %d positions, total value %s %s, overall EV %s%%.",
+		len(stocks), metrics.BaseCurrency, formatFloat(metrics.TotalValue), formatFloat(metrics.OverallEV))
 }
 
-// checkAndSendAlerts checks for unsent alerts and sends emails
-func checkAndSendAlerts(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
-	portfolioID, err := database.GetDefaultPortfolioID(db)
+// alertTypeSectorOverexposure marks a sector above the portfolio's MaxSectorWeight.
+const alertTypeSectorOverexposure = "sector_overexposure"
+
+// checkSectorOverexposure raises a sector_overexposure alert for every sector of a portfolio whose
+// weight exceeds MaxSectorWeight. The sector is stored in the alert's Ticker; a sector that already
+// has an undelivered alert is skipped so the hourly job does not pile up duplicates.
+func checkSectorOverexposure(db *gorm.DB, exchangeRateService *services.ExchangeRateService, now time.Time, logger zerolog.Logger) {
+	fxRates, err := exchangeRateService.GetRatesMap()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load exchange rates for sector exposure check")
+		return
+	}
+
+	var portfolios []models.Portfolio
+	if err := db.Find(&portfolios).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to fetch portfolios for sector exposure check")
+		return
+	}
+
+	for _, portfolio := range portfolios {
+		settings := models.PortfolioSettings{MaxSectorWeight: services.DefaultMaxSectorWeight}
+		if err := db.Where("portfolio_id = ?", portfolio.ID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch settings for sector exposure check")
+			continue
+		}
+		if settings.MaxSectorWeight <= 0 {
+			continue
+		}
+
+		var stocks []models.Stock
+		if err := db.Where("portfolio_id = ? AND shares_owned > ?", portfolio.ID, 0).Find(&stocks).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch stocks for sector exposure check")
+			continue
+		}
+		metrics := services.CalculatePortfolioMetrics(stocks, fxRates, database.PortfolioBaseCurrency(db, portfolio.ID), services.PortfolioMetricsConfig(db, portfolio.ID))
+
+		for _, exposure := range services.OverexposedSectors(metrics.SectorWeights, settings.MaxSectorWeight) {
+			var existing int64
+			if err := db.Model(&models.Alert{}).
+				Where("portfolio_id = ? AND alert_type = ? AND ticker = ? AND delivered_at IS NULL", portfolio.ID, alertTypeSectorOverexposure, exposure.Sector).
+				Count(&existing).Error; err != nil {
+				logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to check existing sector exposure alert")
+				continue
+			}
+			if existing > 0 {
+				continue
+			}
+
+			alert := models.Alert{
+				PortfolioID: portfolio.ID,
+				Ticker:      exposure.Sector,
+				AlertType:   alertTypeSectorOverexposure,
+				Message: fmt.Sprintf("Sector %s is %s%% of invested value, above the %s%% cap.",
+					exposure.Sector, formatFloat(exposure.Weight), formatFloat(settings.MaxSectorWeight)),
+				CreatedAt: now,
+			}
+			if err := db.Create(&alert).Error; err != nil {
+				logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Str("sector", exposure.Sector).Msg("Failed to create sector exposure alert")
+				continue
+			}
+			logger.Info().Uint("portfolio_id", portfolio.ID).Str("sector", exposure.Sector).Float64("weight", exposure.Weight).Msg("Created sector overexposure alert")
+		}
+	}
+}
+
+// alertTypeCashBufferBreach marks a portfolio whose cash fell below its MinCashBufferPct.
+const alertTypeCashBufferBreach = "cash_buffer_breach"
+
+// checkCashBuffer raises one cash_buffer_breach alert per portfolio whose cash holdings are below
+// MinCashBufferPct of positions plus cash (EUR, current rates). Like the sector check, no new alert
+// is raised while an earlier one is still undelivered.
+func checkCashBuffer(db *gorm.DB, exchangeRateService *services.ExchangeRateService, now time.Time, logger zerolog.Logger) {
+	fxRates, err := exchangeRateService.GetRatesMap()
 	if err != nil {
-		logger.Warn().Err(err).Msg("Failed to resolve default portfolio for alerts")
+		logger.Error().Err(err).Msg("Failed to load exchange rates for cash buffer check")
+		return
+	}
+
+	var portfolios []models.Portfolio
+	if err := db.Find(&portfolios).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to fetch portfolios for cash buffer check")
 		return
 	}
 
-	var settings models.PortfolioSettings
-	db.Where("portfolio_id = ?", portfolioID).First(&settings)
+	for _, portfolio := range portfolios {
+		settings := models.PortfolioSettings{MinCashBufferPct: services.DefaultMinCashBufferPct}
+		if err := db.Where("portfolio_id = ?", portfolio.ID).First(&settings).Error; err != nil && err != gorm.ErrRecordNotFound {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch settings for cash buffer check")
+			continue
+		}
+		if settings.MinCashBufferPct <= 0 {
+			continue
+		}
 
-	if !settings.AlertsEnabled {
+		var stocks []models.Stock
+		if err := db.Where("portfolio_id = ? AND shares_owned > ?", portfolio.ID, 0).Find(&stocks).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch stocks for cash buffer check")
+			continue
+		}
+		cashEUR, err := database.PortfolioCashEUR(db, portfolio.ID, fxRates)
+		if err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to fetch cash holdings for cash buffer check")
+			continue
+		}
+		metrics := services.CalculatePortfolioMetrics(stocks, fxRates, "EUR", services.PortfolioMetricsConfig(db, portfolio.ID))
+		buffer := services.CalculateCashBuffer(metrics.TotalValue, cashEUR, settings.MinCashBufferPct, services.DefaultMaxCashBufferPct)
+		if buffer.Status != services.CashBandBelow {
+			continue
+		}
+
+		var existing int64
+		if err := db.Model(&models.Alert{}).
+			Where("portfolio_id = ? AND alert_type = ? AND delivered_at IS NULL", portfolio.ID, alertTypeCashBufferBreach).
+			Count(&existing).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to check existing cash buffer alert")
+			continue
+		}
+		if existing > 0 {
+			continue
+		}
+
+		alert := models.Alert{
+			PortfolioID: portfolio.ID,
+			AlertType:   alertTypeCashBufferBreach,
+			Message:     services.CashBufferAlertMessage(buffer),
+			CreatedAt:   now,
+		}
+		if err := db.Create(&alert).Error; err != nil {
+			logger.Warn().Err(err).Uint("portfolio_id", portfolio.ID).Msg("Failed to create cash buffer alert")
+			continue
+		}
+		logger.Info().Uint("portfolio_id", portfolio.ID).Float64("cash_pct", buffer.CashPct).Msg("Created cash buffer breach alert")
+	}
+}
+
+// alertSender delivers an alert over one channel.
+type alertSender interface {
+	SendAlert(alert models.Alert) error
+}
+
+// alertSenderFunc adapts a delivery function to alertSender.
+type alertSenderFunc func(alert models.Alert) error
+
+func (f alertSenderFunc) SendAlert(alert models.Alert) error { return f(alert) }
+
+// alertDigestSender is implemented by channels that can deliver several alerts in one message.
+type alertDigestSender interface {
+	SendDigest(alerts []models.Alert) error
+}
+
+// checkAndSendAlerts checks for undelivered alerts and routes them to email and telegram
+func checkAndSendAlerts(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) {
+	alertService := services.NewAlertService(cfg, logger)
+	channels := map[string]alertSender{
+		services.AlertChannelEmail:    alertService,
+		services.AlertChannelTelegram: alertSenderFunc(alertService.SendTelegram),
+	}
+	sendPendingAlerts(db, channels, cfg.AlertRoutes, cfg.UrgentAlertTypes, time.Now(), logger)
+}
+
+// alertChannelFlags returns the per-channel delivered flag of alert for each known channel.
+func alertChannelFlags(alert *models.Alert) map[string]*bool {
+	return map[string]*bool{
+		services.AlertChannelEmail:    &alert.EmailSent,
+		services.AlertChannelTelegram: &alert.TelegramSent,
+	}
+}
+
+// sendPendingAlerts delivers the undelivered alerts of every portfolio with alerts enabled on the
+// channels routes assigns
+// to each alert's severity (see services.AlertSeverity). Only attempted channels that succeed are marked
+// sent; an alert is delivered once all its routed channels are, so a failed or not yet configured channel
+// is retried next run without resending the others. Severities routed to no channel are only logged. During the portfolio's
+// quiet hours only critical alerts are sent; the rest are marked QuietHeld and go out on the first run after the window,
+// as one digest per channel that supports it (see sendAlertDigests).
+func sendPendingAlerts(db *gorm.DB, channels map[string]alertSender, routes map[string][]string, urgentTypes []string, now time.Time, logger zerolog.Logger) {
+	var enabled []models.PortfolioSettings
+	if err := db.Where("alerts_enabled = ?", true).Find(&enabled).Error; err != nil {
+		logger.Error().Err(err).Msg("Failed to load portfolios with alerts enabled")
 		return
 	}
+	for i := range enabled {
+		sendPortfolioAlerts(db, &enabled[i], channels, routes, urgentTypes, now, logger)
+	}
+}
 
+// sendPortfolioAlerts delivers one portfolio's undelivered alerts for sendPendingAlerts.
+func sendPortfolioAlerts(db *gorm.DB, settings *models.PortfolioSettings, channels map[string]alertSender, routes map[string][]string, urgentTypes []string, now time.Time, logger zerolog.Logger) {
 	var alerts []models.Alert
-	if err := db.Where("email_sent = ? AND portfolio_id = ?", false, portfolioID).Find(&alerts).Error; err != nil {
-		logger.Error().Err(err).Msg("Failed to fetch unsent alerts")
+	if err := db.Where("delivered_at IS NULL AND portfolio_id = ?", settings.PortfolioID).Find(&alerts).Error; err != nil {
+		logger.Error().Err(err).Uint("portfolio_id", settings.PortfolioID).Msg("Failed to fetch undelivered alerts")
 		return
 	}
 
@@ -208,19 +746,116 @@ func checkAndSendAlerts(db *gorm.DB, cfg *config.Config, logger zerolog.Logger)
 		return
 	}
 
-	logger.Info().Int("count", len(alerts)).Msg("Found unsent alerts")
+	logger.Info().Int("count", len(alerts)).Uint("portfolio_id", settings.PortfolioID).Msg("Found undelivered alerts")
+
+	quiet := services.QuietHours{Start: settings.QuietHoursStart, End: settings.QuietHoursEnd, Timezone: settings.QuietHoursTZ}.Contains(now)
+	deferred := 0
+	var due []*models.Alert
+	for i := range alerts {
+		alert := &alerts[i]
+		alert.Severity = services.AlertSeverity(*alert, urgentTypes)
+		if quiet && alert.Severity != services.AlertSeverityCritical {
+			if !alert.QuietHeld {
+				alert.QuietHeld = true
+				if err := db.Model(alert).Update("quiet_held", true).Error; err != nil {
+					logger.Warn().Err(err).Uint("alert_id", alert.ID).Msg("Failed to mark alert held for the digest")
+				}
+			}
+			deferred++
+			continue
+		}
+		due = append(due, alert)
+	}
 
-	alertService := services.NewAlertService(cfg, logger)
+	failedDigests := sendAlertDigests(due, channels, routes, logger)
+	for _, alert := range due {
+		routed := services.AlertChannelsFor(routes, alert.Severity)
+		if len(routed) == 0 {
+			logger.Info().Uint("alert_id", alert.ID).Str("severity", alert.Severity).Str("type", alert.AlertType).Str("message", alert.Message).Msg("Alert logged without delivery")
+		}
+		flags := alertChannelFlags(alert)
+		delivered := true
+		for _, channel := range routed {
+			sent, known := flags[channel]
+			sender := channels[channel]
+			if !known || sender == nil {
+				logger.Warn().Str("channel", channel).Uint("alert_id", alert.ID).Msg("Alert routed to an unknown channel, skipping it")
+				continue
+			}
+			if *sent {
+				continue
+			}
+			if alert.QuietHeld && failedDigests[channel] {
+				delivered = false // Retried in the next run's digest
+				continue
+			}
+			if err := sender.SendAlert(*alert); err != nil {
+				delivered = false
+				if errors.Is(err, services.ErrChannelNotConfigured) {
+					logger.Debug().Str("channel", channel).Uint("alert_id", alert.ID).Msg("Alert channel not configured, leaving alert queued")
+					continue
+				}
+				logger.Warn().Err(err).Str("channel", channel).Uint("alert_id", alert.ID).Msg("Failed to send alert")
+				continue
+			}
+			*sent = true
+			logger.Info().Str("channel", channel).Uint("alert_id", alert.ID).Msg("Alert sent successfully")
+		}
+		if delivered {
+			alert.DeliveredAt = &now
+		}
+		if err := db.Save(alert).Error; err != nil {
+			logger.Warn().Err(err).Uint("alert_id", alert.ID).Msg("Failed to record alert delivery")
+		}
+	}
+	if deferred > 0 {
+		logger.Info().Int("count", deferred).Msg("Deferred non-critical alerts until quiet hours end")
+	}
+}
 
-	for _, alert := range alerts {
-		if err := alertService.SendAlert(alert); err != nil {
-			logger.Warn().Err(err).Uint("alert_id", alert.ID).Msg("Failed to send alert")
-		} else {
-			alert.EmailSent = true
-			db.Save(&alert)
-			logger.Info().Uint("alert_id", alert.ID).Msg("Alert sent successfully")
+// sendAlertDigests sends the QuietHeld alerts in due as one digest per routed channel that implements
+// alertDigestSender, and marks them sent there. A single held alert, or a channel without digests, is
+// left to the per-alert delivery. It returns the channels whose digest failed; their held alerts wait
+// for the next run.
+func sendAlertDigests(due []*models.Alert, channels map[string]alertSender, routes map[string][]string, logger zerolog.Logger) map[string]bool {
+	held := make(map[string][]*models.Alert)
+	for _, alert := range due {
+		if !alert.QuietHeld {
+			continue
+		}
+		flags := alertChannelFlags(alert)
+		for _, channel := range services.AlertChannelsFor(routes, alert.Severity) {
+			if sent, known := flags[channel]; known && !*sent {
+				held[channel] = append(held[channel], alert)
+			}
+		}
+	}
+
+	failed := make(map[string]bool)
+	for channel, batch := range held {
+		digester, ok := channels[channel].(alertDigestSender)
+		if !ok || len(batch) < 2 {
+			continue
+		}
+		digest := make([]models.Alert, len(batch))
+		for i, alert := range batch {
+			digest[i] = *alert
+		}
+		if err := digester.SendDigest(digest); err != nil {
+			failed[channel] = true
+			if errors.Is(err, services.ErrChannelNotConfigured) {
+				logger.Debug().Str("channel", channel).Int("count", len(batch)).Msg("Alert channel not configured, leaving held alerts queued")
+				continue
+			}
+			logger.Warn().Err(err).Str("channel", channel).Int("count", len(batch)).Msg("Failed to send alert digest")
+			continue
+		}
+		for _, alert := range batch {
+			*alertChannelFlags(alert)[channel] = true
 		}
+		logger.Info().Str("channel", channel).Int("count", len(batch)).Msg("Alert digest sent successfully")
 	}
+	return failed
 }
 
 func formatFloat(f float64) string {
@@ -0,0 +1,1300 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/api/handlers"
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/database"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/art-pro/stock-backend/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// TestMain keeps tests offline: the summary's rate refresh would otherwise fall back to the live
+// frankfurter.app provider, since no exchange rate API key is set.
+func TestMain(m *testing.M) {
+	os.Setenv("EXCHANGE_RATES_FALLBACK_PROVIDER", "none")
+	os.Exit(m.Run())
+}
+
+type stubPriceFetcher struct {
+	price  float64
+	prices map[string]float64
+	errs   map[string]error
+}
+
+func (s stubPriceFetcher) FetchStockPrice(ticker string) (float64, error) {
+	if err, ok := s.errs[ticker]; ok {
+		return 0, err
+	}
+	if price, ok := s.prices[ticker]; ok {
+		return price, nil
+	}
+	return s.price, nil
+}
+
+type stubCollector struct {
+	entries []services.NormalizedFairValueEntry
+	err     error
+}
+
+func (s stubCollector) CollectTrustedFairValues(context.Context, *models.Stock) ([]services.NormalizedFairValueEntry, error) {
+	return s.entries, s.err
+}
+
+func setupSchedulerTest(t *testing.T) (*gorm.DB, *services.ExchangeRateService) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "scheduler-test.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Stock{}, &models.StockHistory{}, &models.FairValueHistory{}, &models.PortfolioSettings{}, &models.Alert{}, &models.ExchangeRate{}, &models.SchedulerRun{}, &models.SchedulerRunOutcome{}, &models.Portfolio{}, &models.PortfolioSnapshot{}, &models.BenchmarkSnapshot{}, &models.CashHolding{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.1, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	return db, services.NewExchangeRateService(db, zerolog.Nop())
+}
+
+func TestUpdateStockKeepsPriceUpdateWhenFairValueCollectionFails(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	collectedAt := time.Now().Add(-72 * time.Hour)
+	stock := models.Stock{
+		PortfolioID:          1,
+		Ticker:               "ACME",
+		Currency:             "USD",
+		CurrentPrice:         100,
+		FairValue:            130,
+		SharesOwned:          10,
+		AvgPriceLocal:        90,
+		FairValueCollectedAt: &collectedAt,
+	}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	collector := stubCollector{err: errors.New("all providers failed")}
+	history, err := updateStock(db, stubPriceFetcher{price: 110}, collector, fx, &stock, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.CurrentPrice != 110 {
+		t.Errorf("CurrentPrice: got %.2f want 110", saved.CurrentPrice)
+	}
+	if saved.FairValue != 130 {
+		t.Errorf("FairValue: got %.2f want last-known 130", saved.FairValue)
+	}
+	if !saved.FairValueStale {
+		t.Error("expected FairValueStale to be set")
+	}
+	if saved.FairValueCollectedAt == nil || saved.FairValueAge(time.Now()) < 71*time.Hour {
+		t.Errorf("expected last successful collection time to be preserved, got %v", saved.FairValueCollectedAt)
+	}
+	wantUpside := (130.0 - 110.0) / 110.0 * 100
+	if diff := saved.UpsidePotential - wantUpside; diff > 0.0001 || diff < -0.0001 {
+		t.Errorf("UpsidePotential: got %.4f want %.4f", saved.UpsidePotential, wantUpside)
+	}
+
+	if history.StockID != stock.ID || history.CurrentPrice != 110 || history.FairValue != 130 {
+		t.Errorf("unexpected history snapshot: %+v", history)
+	}
+}
+
+func TestUpdateStockAppliesCollectedFairValue(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	stock := models.Stock{PortfolioID: 1, Ticker: "ACME", Currency: "USD", CurrentPrice: 100, FairValue: 130, FairValueStale: true}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	now := time.Now()
+	collector := stubCollector{entries: []services.NormalizedFairValueEntry{
+		{FairValue: 140, Source: "Grok | Reuters", RecordedAt: now},
+		{FairValue: 150, Source: "Deepseek | Morningstar", RecordedAt: now},
+	}}
+	if _, err := updateStock(db, stubPriceFetcher{price: 100}, collector, fx, &stock, zerolog.Nop()); err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.FairValue != 145 {
+		t.Errorf("FairValue: got %.2f want median 145", saved.FairValue)
+	}
+	if saved.FairValueStale {
+		t.Error("expected FairValueStale to be cleared")
+	}
+	if saved.FairValueCollectedAt == nil {
+		t.Error("expected FairValueCollectedAt to be set")
+	}
+
+	var fvCount int64
+	db.Model(&models.FairValueHistory{}).Where("stock_id = ?", stock.ID).Count(&fvCount)
+	if fvCount != 2 {
+		t.Errorf("expected 2 fair value history rows, got %d", fvCount)
+	}
+}
+
+func TestUpdateStockHeldFairValueWritesNoHistory(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: 1, DowngradeMinSources: 2}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	stock := models.Stock{PortfolioID: 1, Ticker: "FLAKY", Currency: "USD", CurrentPrice: 100, FairValue: 120}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	// One independent source moving the fair value below the price would turn the Hold into a Sell.
+	now := time.Now()
+	collector := stubCollector{entries: []services.NormalizedFairValueEntry{
+		{FairValue: 95, Source: "Grok | Reuters (https://reuters.com/a)", RecordedAt: now},
+		{FairValue: 95, Source: "Deepseek | Reuters (https://reuters.com/b)", RecordedAt: now},
+	}}
+	if _, err := updateStock(db, stubPriceFetcher{price: 100}, collector, fx, &stock, zerolog.Nop()); err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.FairValue != 120 {
+		t.Errorf("FairValue: got %.2f want prior 120", saved.FairValue)
+	}
+	var fvCount, alerts int64
+	db.Model(&models.FairValueHistory{}).Where("stock_id = ?", stock.ID).Count(&fvCount)
+	if fvCount != 0 {
+		t.Errorf("expected no fair value history for a held value, got %d rows", fvCount)
+	}
+	db.Model(&models.Alert{}).Where("stock_id = ? AND alert_type = ?", stock.ID, "needs_review").Count(&alerts)
+	if alerts != 1 {
+		t.Errorf("expected one needs_review alert, got %d", alerts)
+	}
+
+	// A second run inside the alert cooldown holds the value again without another alert.
+	if _, err := updateStock(db, stubPriceFetcher{price: 100}, collector, fx, &saved, zerolog.Nop()); err != nil {
+		t.Fatalf("second updateStock: %v", err)
+	}
+	db.Model(&models.Alert{}).Where("stock_id = ? AND alert_type = ?", stock.ID, "needs_review").Count(&alerts)
+	if alerts != 1 {
+		t.Errorf("expected the cooldown to suppress a repeat needs_review alert, got %d", alerts)
+	}
+}
+
+func TestUpdateStockZeroPriceMarksHaltedAndKeepsMetrics(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	stock := models.Stock{PortfolioID: 1, Ticker: "GONE", Currency: "USD", CurrentPrice: 100, FairValue: 130, ProbabilityPositive: 0.6, DownsideRisk: -20}
+	services.CalculateMetrics(&stock, services.DefaultMetricsConfig())
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	wantEV, wantUpside := stock.ExpectedValue, stock.UpsidePotential
+
+	for i := 0; i < 2; i++ {
+		_, err := updateStock(db, stubPriceFetcher{price: 0}, nil, fx, &stock, zerolog.Nop())
+		if !errors.Is(err, services.ErrTradingHalted) {
+			t.Fatalf("run %d: expected ErrTradingHalted, got %v", i, err)
+		}
+	}
+
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.TradingStatus != services.TradingStatusHalted {
+		t.Errorf("TradingStatus: got %q want %q", saved.TradingStatus, services.TradingStatusHalted)
+	}
+	if saved.CurrentPrice != 100 || saved.ExpectedValue != wantEV || saved.UpsidePotential != wantUpside {
+		t.Errorf("expected last-known metrics, got price %.2f EV %.4f upside %.4f", saved.CurrentPrice, saved.ExpectedValue, saved.UpsidePotential)
+	}
+	var alerts int64
+	db.Model(&models.Alert{}).Where("alert_type = ? AND stock_id = ?", services.AlertTypeTradingHalted, stock.ID).Count(&alerts)
+	if alerts != 1 {
+		t.Errorf("expected one trading_halted alert across repeated failures, got %d", alerts)
+	}
+
+	// A usable price clears the status.
+	if _, err := updateStock(db, stubPriceFetcher{price: 105}, nil, fx, &stock, zerolog.Nop()); err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.TradingStatus != services.TradingStatusActive || saved.CurrentPrice != 105 {
+		t.Errorf("expected active at 105, got %q at %.2f", saved.TradingStatus, saved.CurrentPrice)
+	}
+}
+
+func TestManualRefreshAfterScheduledRunDoesNotDuplicateAlerts(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	settings := models.PortfolioSettings{PortfolioID: 1, AlertsEnabled: true, AlertThresholdEV: 5, AlertCooldownHours: 12}
+	if err := db.Create(&settings).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	// At 100 against a fair value of 130 the EV jumps from 0 to 12.5% and the price is in the buy zone.
+	stock := models.Stock{PortfolioID: 1, Ticker: "ACME", Currency: "USD", CurrentPrice: 90, FairValue: 130}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	if _, err := updateStock(db, stubPriceFetcher{price: 100}, nil, fx, &stock, zerolog.Nop()); err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+	countAlerts := func() map[string]int64 {
+		counts := make(map[string]int64)
+		for _, alertType := range []string{services.AlertTypeEVChange, services.AlertTypeBuyZone} {
+			var count int64
+			db.Model(&models.Alert{}).Where("stock_id = ? AND alert_type = ?", stock.ID, alertType).Count(&count)
+			counts[alertType] = count
+		}
+		return counts
+	}
+	if counts := countAlerts(); counts[services.AlertTypeEVChange] != 1 || counts[services.AlertTypeBuyZone] != 1 {
+		t.Fatalf("expected one ev_change and one buy_zone alert after the scheduled run, got %v", counts)
+	}
+
+	// A manual refresh right after raises the same alerts through the same service and is deduplicated.
+	created, err := services.RaiseStockUpdateAlerts(db, &stock, 0, settings, time.Now())
+	if err != nil {
+		t.Fatalf("RaiseStockUpdateAlerts: %v", err)
+	}
+	if counts := countAlerts(); created != 0 || counts[services.AlertTypeEVChange] != 1 || counts[services.AlertTypeBuyZone] != 1 {
+		t.Fatalf("manual refresh duplicated alerts: created %d, counts %v", created, counts)
+	}
+
+	// Once the cooldown has passed the alerts are raised again.
+	created, err = services.RaiseStockUpdateAlerts(db, &stock, 0, settings, time.Now().Add(13*time.Hour))
+	if err != nil {
+		t.Fatalf("RaiseStockUpdateAlerts: %v", err)
+	}
+	if created != 2 {
+		t.Errorf("expected both alerts after the cooldown, got %d", created)
+	}
+}
+
+func TestUpdateStocksWithFrequencyRecordsMixedOutcomes(t *testing.T) {
+	db, fx := setupSchedulerTest(t)
+
+	previousDelay := updateDelay
+	updateDelay = 0
+	t.Cleanup(func() { updateDelay = previousDelay })
+
+	for _, stock := range []models.Stock{
+		{PortfolioID: 1, Ticker: "GOOD", Currency: "USD", CurrentPrice: 100, FairValue: 120, UpdateFrequency: "daily"},
+		{PortfolioID: 1, Ticker: "FLAKY", Currency: "USD", CurrentPrice: 50, FairValue: 60, UpdateFrequency: "daily"},
+		{PortfolioID: 2, Ticker: "GONE", Currency: "USD", CurrentPrice: 10, FairValue: 12, UpdateFrequency: "daily"},
+		{PortfolioID: 1, Ticker: "MANUAL", Currency: "USD", CurrentPrice: 10, FairValue: 12, UpdateFrequency: "manually"},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+
+	fetcher := stubPriceFetcher{
+		price: 105,
+		errs: map[string]error{
+			"FLAKY": errors.New("Grok API returned status 503"),
+			"GONE":  fmt.Errorf("%w: %s", services.ErrNoPriceData, "GONE"),
+		},
+	}
+	run := updateStocksWithFrequency(db, fetcher, nil, fx, zerolog.Nop(), "daily", 0)
+	if run == nil {
+		t.Fatal("expected a scheduler run")
+	}
+	if run.Total != 3 || run.Succeeded != 1 || run.TransientFailures != 1 || run.PermanentFailures != 1 {
+		t.Fatalf("unexpected counts: total=%d succeeded=%d transient=%d permanent=%d",
+			run.Total, run.Succeeded, run.TransientFailures, run.PermanentFailures)
+	}
+
+	var saved models.SchedulerRun
+	if err := db.Preload("Outcomes").First(&saved, run.ID).Error; err != nil {
+		t.Fatalf("reload run: %v", err)
+	}
+	statuses := make(map[string]string, len(saved.Outcomes))
+	for _, outcome := range saved.Outcomes {
+		statuses[outcome.Ticker] = outcome.Status
+		if outcome.Status != outcomeSuccess && outcome.Error == "" {
+			t.Errorf("%s: expected error message on failed outcome", outcome.Ticker)
+		}
+	}
+	want := map[string]string{"GOOD": outcomeSuccess, "FLAKY": outcomeTransient, "GONE": outcomePermanent}
+	for ticker, status := range want {
+		if statuses[ticker] != status {
+			t.Errorf("%s: got status %q want %q", ticker, statuses[ticker], status)
+		}
+	}
+	if len(saved.Outcomes) != len(want) {
+		t.Errorf("expected %d outcomes, got %d", len(want), len(saved.Outcomes))
+	}
+
+	var good models.Stock
+	db.Where("ticker = ?", "GOOD").First(&good)
+	if good.CurrentPrice != 105 {
+		t.Errorf("GOOD CurrentPrice: got %.2f want 105", good.CurrentPrice)
+	}
+}
+
+func TestUpdateStocksWithFrequencyBatchesHistoryInserts(t *testing.T) {
+	db, fx := setupSchedulerTest(t)
+
+	previousDelay := updateDelay
+	updateDelay = 0
+	t.Cleanup(func() { updateDelay = previousDelay })
+
+	const stockCount = 5
+	for i := 0; i < stockCount; i++ {
+		stock := models.Stock{PortfolioID: 1, Ticker: fmt.Sprintf("T%d", i), Currency: "USD", CurrentPrice: 100, FairValue: 120, UpdateFrequency: "daily"}
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+
+	historyInserts := 0
+	if err := db.Callback().Create().After("gorm:create").Register("test:count_history_inserts", func(tx *gorm.DB) {
+		if tx.Statement.Table == "stock_histories" {
+			historyInserts++
+		}
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	run := updateStocksWithFrequency(db, stubPriceFetcher{price: 105}, nil, fx, zerolog.Nop(), "daily", 100)
+	if run == nil || run.Succeeded != stockCount || run.HistoryError != "" {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	var historyCount int64
+	db.Model(&models.StockHistory{}).Count(&historyCount)
+	if historyCount != stockCount {
+		t.Errorf("expected %d history rows, got %d", stockCount, historyCount)
+	}
+	if historyInserts != 1 {
+		t.Errorf("expected a single batched history insert, got %d", historyInserts)
+	}
+
+	// A smaller batch size splits the same run into ceil(5/2) inserts.
+	historyInserts = 0
+	updateStocksWithFrequency(db, stubPriceFetcher{price: 106}, nil, fx, zerolog.Nop(), "daily", 2)
+	if historyInserts != 3 {
+		t.Errorf("expected 3 history inserts with batch size 2, got %d", historyInserts)
+	}
+}
+
+func TestSnapshotsSameDayKeepLatestValues(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	stock := models.Stock{PortfolioID: portfolio.ID, Ticker: "ACME", Currency: "EUR", CurrentPrice: 100, SharesOwned: 10}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	snapshotPortfolios(db, fx, zerolog.Nop())
+	snapshotBenchmarks(db, stubPriceFetcher{price: 500}, []string{"SPY"}, zerolog.Nop())
+
+	if err := db.Model(&stock).Update("current_price", 120).Error; err != nil {
+		t.Fatalf("update price: %v", err)
+	}
+	snapshotPortfolios(db, fx, zerolog.Nop())
+	snapshotBenchmarks(db, stubPriceFetcher{price: 510}, []string{"SPY"}, zerolog.Nop())
+
+	var portfolioSnaps []models.PortfolioSnapshot
+	if err := db.Where("portfolio_id = ?", portfolio.ID).Find(&portfolioSnaps).Error; err != nil {
+		t.Fatalf("load portfolio snapshots: %v", err)
+	}
+	if len(portfolioSnaps) != 1 {
+		t.Fatalf("expected 1 portfolio snapshot for the day, got %d", len(portfolioSnaps))
+	}
+	if portfolioSnaps[0].TotalValueEUR != 1200 {
+		t.Errorf("TotalValueEUR: got %.2f want latest 1200", portfolioSnaps[0].TotalValueEUR)
+	}
+	if portfolioSnaps[0].SnapshotDate != time.Now().UTC().Format("2006-01-02") {
+		t.Errorf("SnapshotDate: got %q", portfolioSnaps[0].SnapshotDate)
+	}
+
+	var benchmarkSnaps []models.BenchmarkSnapshot
+	if err := db.Where("symbol = ?", "SPY").Find(&benchmarkSnaps).Error; err != nil {
+		t.Fatalf("load benchmark snapshots: %v", err)
+	}
+	if len(benchmarkSnaps) != 1 || benchmarkSnaps[0].Price != 510 {
+		t.Fatalf("expected 1 SPY snapshot at 510, got %+v", benchmarkSnaps)
+	}
+}
+
+func TestReviewReminderFiresAfterIntervalAndResetsOnMarkReviewed(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	start := time.Date(2026, 1, 5, 8, 0, 0, 0, time.UTC)
+	settings := models.PortfolioSettings{PortfolioID: portfolio.ID, RebalanceReviewDays: 90, ReviewReminderEmail: true, CreatedAt: start}
+	if err := db.Create(&settings).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	stock := models.Stock{PortfolioID: portfolio.ID, Ticker: "ACME", Currency: "EUR", CurrentPrice: 100, SharesOwned: 10}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	reminders := func() []models.Alert {
+		t.Helper()
+		var alerts []models.Alert
+		if err := db.Where("portfolio_id = ? AND alert_type = ?", portfolio.ID, alertTypeReviewDue).Order("created_at").Find(&alerts).Error; err != nil {
+			t.Fatalf("load reminders: %v", err)
+		}
+		return alerts
+	}
+
+	checkReviewReminders(db, fx, start.AddDate(0, 0, 89), zerolog.Nop())
+	if got := reminders(); len(got) != 0 {
+		t.Fatalf("expected no reminder before the interval, got %d", len(got))
+	}
+
+	checkReviewReminders(db, fx, start.AddDate(0, 0, 90), zerolog.Nop())
+	checkReviewReminders(db, fx, start.AddDate(0, 0, 91), zerolog.Nop())
+	got := reminders()
+	if len(got) != 1 {
+		t.Fatalf("expected exactly 1 reminder once the interval elapsed, got %d", len(got))
+	}
+	if got[0].EmailSent {
+		t.Error("expected the reminder to be queued for email")
+	}
+	if !strings.Contains(got[0].Message, "1 positions, total value EUR 1000.00") {
+		t.Errorf("expected a portfolio summary in the message, got %q", got[0].Message)
+	}
+
+	reviewedAt := start.AddDate(0, 0, 95)
+	if _, err := database.MarkPortfolioReviewed(db, portfolio.ID, reviewedAt); err != nil {
+		t.Fatalf("mark reviewed: %v", err)
+	}
+	checkReviewReminders(db, fx, reviewedAt.AddDate(0, 0, 89), zerolog.Nop())
+	if got := reminders(); len(got) != 1 {
+		t.Fatalf("expected mark-reviewed to reset the interval, got %d reminders", len(got))
+	}
+	checkReviewReminders(db, fx, reviewedAt.AddDate(0, 0, 90), zerolog.Nop())
+	if got := reminders(); len(got) != 2 {
+		t.Fatalf("expected a new reminder one interval after the review, got %d", len(got))
+	}
+}
+
+func TestCashBufferBreachAlertStatesCashPctAndBand(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolio.ID, MinCashBufferPct: 8}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	stock := models.Stock{PortfolioID: portfolio.ID, Ticker: "ACME", Currency: "EUR", CurrentPrice: 100, SharesOwned: 95}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	// 550 USD is 500 EUR at 1.1: 5% of 10,000 EUR.
+	cash := models.CashHolding{PortfolioID: portfolio.ID, CurrencyCode: "USD", Amount: 550}
+	if err := db.Create(&cash).Error; err != nil {
+		t.Fatalf("create cash: %v", err)
+	}
+
+	alerts := func() []models.Alert {
+		t.Helper()
+		var alerts []models.Alert
+		if err := db.Where("portfolio_id = ? AND alert_type = ?", portfolio.ID, alertTypeCashBufferBreach).Find(&alerts).Error; err != nil {
+			t.Fatalf("load alerts: %v", err)
+		}
+		return alerts
+	}
+
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	checkCashBuffer(db, fx, now, zerolog.Nop())
+	checkCashBuffer(db, fx, now.Add(24*time.Hour), zerolog.Nop())
+	got := alerts()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 alert while the first is undelivered, got %d", len(got))
+	}
+	if got[0].Message != "Cash is 5.0% of the portfolio, below the 8.0–12.0% target band." {
+		t.Errorf("unexpected message: %q", got[0].Message)
+	}
+
+	// Back inside the band: no alert.
+	if err := db.Model(&got[0]).Update("delivered_at", now.Add(time.Hour)).Error; err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	if err := db.Model(&cash).Update("amount", 1100).Error; err != nil {
+		t.Fatalf("update cash: %v", err)
+	}
+	checkCashBuffer(db, fx, now.Add(48*time.Hour), zerolog.Nop())
+	if got := alerts(); len(got) != 1 {
+		t.Fatalf("expected no new alert with cash at 9.5%%, got %d alerts", len(got))
+	}
+}
+
+func TestSectorOverexposureAlertsOncePerUndeliveredSector(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolio.ID, MaxSectorWeight: 30}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	// Technology is 50% of invested value; Energy and Healthcare 25% each.
+	for _, stock := range []models.Stock{
+		{PortfolioID: portfolio.ID, Ticker: "ACME", Sector: "Technology", Currency: "EUR", CurrentPrice: 100, SharesOwned: 5},
+		{PortfolioID: portfolio.ID, Ticker: "OIL", Sector: "Energy", Currency: "EUR", CurrentPrice: 50, SharesOwned: 5},
+		{PortfolioID: portfolio.ID, Ticker: "MED", Sector: "Healthcare", Currency: "EUR", CurrentPrice: 25, SharesOwned: 10},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+
+	alerts := func() []models.Alert {
+		t.Helper()
+		var alerts []models.Alert
+		if err := db.Where("portfolio_id = ? AND alert_type = ?", portfolio.ID, alertTypeSectorOverexposure).Order("id").Find(&alerts).Error; err != nil {
+			t.Fatalf("load alerts: %v", err)
+		}
+		return alerts
+	}
+
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	checkSectorOverexposure(db, fx, now, zerolog.Nop())
+	checkSectorOverexposure(db, fx, now.Add(time.Hour), zerolog.Nop())
+	got := alerts()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 alert while the first is undelivered, got %d", len(got))
+	}
+	if got[0].Ticker != "Technology" || !strings.Contains(got[0].Message, "Technology is 50.00%") || !strings.Contains(got[0].Message, "30.00% cap") {
+		t.Errorf("unexpected alert: %+v", got[0])
+	}
+
+	delivered := now.Add(90 * time.Minute)
+	if err := db.Model(&got[0]).Update("delivered_at", delivered).Error; err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	checkSectorOverexposure(db, fx, now.Add(2*time.Hour), zerolog.Nop())
+	if got := alerts(); len(got) != 2 {
+		t.Fatalf("expected a new alert once the previous one was delivered, got %d", len(got))
+	}
+}
+
+func TestSnapshotCapturesCashAndIsReadBackByPortfolioHistory(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, fx := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	stock := models.Stock{PortfolioID: portfolio.ID, Ticker: "ACME", Currency: "EUR", CurrentPrice: 100, SharesOwned: 10}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	// 1,000 EUR plus 1,100 USD (1,000 EUR at 1.1) next to 1,000 EUR of positions.
+	for _, cash := range []models.CashHolding{
+		{PortfolioID: portfolio.ID, CurrencyCode: "EUR", Amount: 1000},
+		{PortfolioID: portfolio.ID, CurrencyCode: "USD", Amount: 1100},
+	} {
+		if err := db.Create(&cash).Error; err != nil {
+			t.Fatalf("create cash: %v", err)
+		}
+	}
+
+	snapshotPortfolios(db, fx, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/history", nil)
+	handlers.NewPortfolioHandler(db, &config.Config{}, zerolog.Nop()).GetPortfolioHistory(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Snapshots []models.PortfolioSnapshot `json:"snapshots"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(out.Snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(out.Snapshots))
+	}
+	snapshot := out.Snapshots[0]
+	if math.Abs(snapshot.TotalValueEUR-1000) > 1e-6 || math.Abs(snapshot.CashEUR-2000) > 1e-6 {
+		t.Errorf("values: got positions %.2f cash %.2f want 1000/2000", snapshot.TotalValueEUR, snapshot.CashEUR)
+	}
+	if math.Abs(snapshot.CashPct-200.0/3) > 1e-6 {
+		t.Errorf("CashPct: got %.4f want 66.6667", snapshot.CashPct)
+	}
+}
+
+func TestSnapshotTotalMatchesPortfolioSummary(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+	db, fx := setupSchedulerTest(t)
+	if err := db.AutoMigrate(&models.Operation{}, &models.Order{}, &models.FairValueHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	// Rates are USD per 1 EUR (1.1): 20 x 165 USD is 3,000 EUR, next to 1,000 EUR.
+	for _, stock := range []models.Stock{
+		{PortfolioID: portfolio.ID, Ticker: "ACME", Currency: "EUR", CurrentPrice: 100, SharesOwned: 10},
+		{PortfolioID: portfolio.ID, Ticker: "AAPL", Currency: "USD", CurrentPrice: 165, SharesOwned: 20},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+
+	snapshotPortfolios(db, fx, zerolog.Nop())
+	var snapshot models.PortfolioSnapshot
+	if err := db.Where("portfolio_id = ?", portfolio.ID).First(&snapshot).Error; err != nil {
+		t.Fatalf("load snapshot: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/portfolio/summary", nil)
+	handlers.NewPortfolioHandler(db, &config.Config{}, zerolog.Nop()).GetPortfolioSummary(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("summary status: got %d, body %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Summary struct {
+			TotalValue float64 `json:"total_value"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode summary: %v", err)
+	}
+
+	if math.Abs(snapshot.TotalValueEUR-4000) > 1e-9 {
+		t.Errorf("scheduler TotalValueEUR: got %.4f want 4000", snapshot.TotalValueEUR)
+	}
+	if math.Abs(out.Summary.TotalValue-snapshot.TotalValueEUR) > 1e-9 {
+		t.Errorf("summary total_value %.4f differs from scheduler snapshot %.4f", out.Summary.TotalValue, snapshot.TotalValueEUR)
+	}
+}
+
+type recordingSender struct {
+	sent []string
+}
+
+func (s *recordingSender) SendAlert(alert models.Alert) error {
+	s.sent = append(s.sent, alert.AlertType)
+	return nil
+}
+
+func TestSendPendingAlertsDefersNonUrgentDuringQuietHours(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	settings := models.PortfolioSettings{
+		PortfolioID:     portfolio.ID,
+		AlertsEnabled:   true,
+		QuietHoursStart: "22:00",
+		QuietHoursEnd:   "07:00",
+		QuietHoursTZ:    "Europe/Copenhagen",
+	}
+	if err := db.Create(&settings).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	for _, alert := range []models.Alert{
+		{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "buy_zone", Message: "in buy zone"},
+		{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "stop hit"},
+	} {
+		if err := db.Create(&alert).Error; err != nil {
+			t.Fatalf("create alert: %v", err)
+		}
+	}
+
+	// 03:00 in Copenhagen (CET, UTC+1) is inside the quiet window.
+	sender := &recordingSender{}
+	sendPendingAlerts(db, map[string]alertSender{services.AlertChannelEmail: sender}, nil, []string{"stop_hit"}, time.Date(2026, 1, 6, 2, 0, 0, 0, time.UTC), zerolog.Nop())
+	if len(sender.sent) != 1 || sender.sent[0] != "stop_hit" {
+		t.Fatalf("expected only the urgent alert during quiet hours, sent %v", sender.sent)
+	}
+	var pending []models.Alert
+	if err := db.Where("email_sent = ?", false).Find(&pending).Error; err != nil {
+		t.Fatalf("load pending alerts: %v", err)
+	}
+	if len(pending) != 1 || pending[0].AlertType != "buy_zone" {
+		t.Fatalf("expected buy_zone to stay queued, got %+v", pending)
+	}
+
+	// 08:00 Copenhagen: the window has ended, so the deferred alert goes out.
+	sender = &recordingSender{}
+	sendPendingAlerts(db, map[string]alertSender{services.AlertChannelEmail: sender}, nil, []string{"stop_hit"}, time.Date(2026, 1, 6, 7, 0, 0, 0, time.UTC), zerolog.Nop())
+	if len(sender.sent) != 1 || sender.sent[0] != "buy_zone" {
+		t.Fatalf("expected the deferred alert after quiet hours, sent %v", sender.sent)
+	}
+}
+
+type digestRecordingSender struct {
+	recordingSender
+	digests [][]string
+}
+
+func (s *digestRecordingSender) SendDigest(alerts []models.Alert) error {
+	types := make([]string, len(alerts))
+	for i, alert := range alerts {
+		types[i] = alert.AlertType
+	}
+	s.digests = append(s.digests, types)
+	return nil
+}
+
+func TestSendPendingAlertsDigestsAlertsHeldDuringQuietHours(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	settings := models.PortfolioSettings{PortfolioID: portfolio.ID, AlertsEnabled: true, QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	if err := db.Create(&settings).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	for _, alert := range []models.Alert{
+		{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "buy_zone", Message: "in buy zone"},
+		{PortfolioID: portfolio.ID, Ticker: "BETA", AlertType: "sector_overexposure", Message: "Tech over limit"},
+		{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "stop hit"},
+	} {
+		if err := db.Create(&alert).Error; err != nil {
+			t.Fatalf("create alert: %v", err)
+		}
+	}
+
+	email, telegram := &digestRecordingSender{}, &recordingSender{}
+	channels := map[string]alertSender{services.AlertChannelEmail: email, services.AlertChannelTelegram: telegram}
+	routes := map[string][]string{services.AlertSeverityInfo: {services.AlertChannelEmail, services.AlertChannelTelegram}}
+	sendPendingAlerts(db, channels, routes, []string{"stop_hit"}, time.Date(2026, 1, 6, 3, 0, 0, 0, time.UTC), zerolog.Nop())
+	if len(email.sent) != 1 || email.sent[0] != "stop_hit" || len(email.digests) != 0 {
+		t.Fatalf("expected only the urgent alert during quiet hours, sent %v digests %v", email.sent, email.digests)
+	}
+	var held int64
+	if err := db.Model(&models.Alert{}).Where("quiet_held = ?", true).Count(&held).Error; err != nil {
+		t.Fatalf("count held alerts: %v", err)
+	}
+	if held != 2 {
+		t.Fatalf("expected 2 alerts marked quiet_held, got %d", held)
+	}
+
+	// After the window the held alerts go out as one email digest; telegram has no digest and sends each.
+	email, telegram = &digestRecordingSender{}, &recordingSender{}
+	channels = map[string]alertSender{services.AlertChannelEmail: email, services.AlertChannelTelegram: telegram}
+	sendPendingAlerts(db, channels, routes, []string{"stop_hit"}, time.Date(2026, 1, 6, 8, 0, 0, 0, time.UTC), zerolog.Nop())
+	if len(email.sent) != 0 || len(email.digests) != 1 || len(email.digests[0]) != 2 {
+		t.Fatalf("expected one email digest of both held alerts, sent %v digests %v", email.sent, email.digests)
+	}
+	if len(telegram.sent) != 1 || telegram.sent[0] != "buy_zone" {
+		t.Fatalf("expected the info alert sent to telegram on its own, sent %v", telegram.sent)
+	}
+	var pending int64
+	if err := db.Model(&models.Alert{}).Where("delivered_at IS NULL").Count(&pending).Error; err != nil {
+		t.Fatalf("count pending alerts: %v", err)
+	}
+	if pending != 0 {
+		t.Fatalf("expected every alert delivered after the digest, %d pending", pending)
+	}
+}
+
+type failingSender struct {
+	attempts int
+}
+
+func (s *failingSender) SendAlert(models.Alert) error {
+	s.attempts++
+	return errors.New("channel down")
+}
+
+func TestSendPendingAlertsRoutesBySeverity(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolio.ID, AlertsEnabled: true}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	for _, alert := range []models.Alert{
+		{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "stop hit"},
+		{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "buy_zone", Message: "in buy zone"},
+	} {
+		if err := db.Create(&alert).Error; err != nil {
+			t.Fatalf("create alert: %v", err)
+		}
+	}
+
+	routes := map[string][]string{
+		services.AlertSeverityCritical: {services.AlertChannelTelegram, services.AlertChannelEmail},
+		services.AlertSeverityInfo:     {},
+	}
+	email, telegram := &recordingSender{}, &recordingSender{}
+	channels := map[string]alertSender{services.AlertChannelEmail: email, services.AlertChannelTelegram: telegram}
+	now := time.Date(2026, 1, 6, 12, 0, 0, 0, time.UTC)
+	sendPendingAlerts(db, channels, routes, []string{"stop_hit"}, now, zerolog.Nop())
+
+	if len(email.sent) != 1 || email.sent[0] != "stop_hit" || len(telegram.sent) != 1 || telegram.sent[0] != "stop_hit" {
+		t.Fatalf("expected the critical alert on both channels only, email %v telegram %v", email.sent, telegram.sent)
+	}
+	var stored []models.Alert
+	if err := db.Order("id").Find(&stored).Error; err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	critical, info := stored[0], stored[1]
+	if critical.Severity != services.AlertSeverityCritical || !critical.EmailSent || !critical.TelegramSent || critical.DeliveredAt == nil {
+		t.Fatalf("critical alert not delivered on both channels: %+v", critical)
+	}
+	// The info alert is routed nowhere: logged and closed without marking any channel sent.
+	if info.Severity != services.AlertSeverityInfo || info.EmailSent || info.TelegramSent || info.DeliveredAt == nil {
+		t.Fatalf("info alert should be delivered to no channel: %+v", info)
+	}
+
+	// A failing channel keeps the alert pending and is retried without resending the other one.
+	retry := models.Alert{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "stop hit again"}
+	if err := db.Create(&retry).Error; err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+	down := &failingSender{}
+	email = &recordingSender{}
+	channels = map[string]alertSender{services.AlertChannelEmail: email, services.AlertChannelTelegram: down}
+	sendPendingAlerts(db, channels, routes, []string{"stop_hit"}, now, zerolog.Nop())
+	sendPendingAlerts(db, channels, routes, []string{"stop_hit"}, now, zerolog.Nop())
+	if len(email.sent) != 1 || down.attempts != 2 {
+		t.Fatalf("expected one email and two telegram attempts, got %d and %d", len(email.sent), down.attempts)
+	}
+	if err := db.First(&retry, retry.ID).Error; err != nil {
+		t.Fatalf("reload alert: %v", err)
+	}
+	if !retry.EmailSent || retry.TelegramSent || retry.DeliveredAt != nil {
+		t.Fatalf("expected email sent and telegram pending, got %+v", retry)
+	}
+}
+
+func TestSendPendingAlertsCoversEveryPortfolioWithAlertsEnabled(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+
+	main := models.Portfolio{Name: "Main", IsDefault: true}
+	second := models.Portfolio{Name: "Second", UserID: 2}
+	muted := models.Portfolio{Name: "Muted", UserID: 3}
+	for _, p := range []*models.Portfolio{&main, &second, &muted} {
+		if err := db.Create(p).Error; err != nil {
+			t.Fatalf("create portfolio: %v", err)
+		}
+	}
+	for _, settings := range []models.PortfolioSettings{
+		{PortfolioID: main.ID, AlertsEnabled: true},
+		{PortfolioID: second.ID, AlertsEnabled: true},
+		{PortfolioID: muted.ID, AlertsEnabled: false},
+	} {
+		if err := db.Create(&settings).Error; err != nil {
+			t.Fatalf("create settings: %v", err)
+		}
+	}
+	for _, alert := range []models.Alert{
+		{PortfolioID: main.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "main"},
+		{PortfolioID: second.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "second"},
+		{PortfolioID: muted.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "muted"},
+	} {
+		if err := db.Create(&alert).Error; err != nil {
+			t.Fatalf("create alert: %v", err)
+		}
+	}
+
+	sender := &recordingSender{}
+	sendPendingAlerts(db, map[string]alertSender{services.AlertChannelEmail: sender}, nil, []string{"stop_hit"}, time.Date(2026, 1, 6, 12, 0, 0, 0, time.UTC), zerolog.Nop())
+	if len(sender.sent) != 2 {
+		t.Fatalf("expected the alerts of both enabled portfolios, sent %v", sender.sent)
+	}
+	var pending []models.Alert
+	if err := db.Where("delivered_at IS NULL").Find(&pending).Error; err != nil {
+		t.Fatalf("load pending alerts: %v", err)
+	}
+	if len(pending) != 1 || pending[0].PortfolioID != muted.ID {
+		t.Fatalf("expected only the muted portfolio's alert to stay queued, got %+v", pending)
+	}
+}
+
+func TestSendPendingAlertsKeepsAlertsQueuedForUnconfiguredChannels(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+
+	portfolio := models.Portfolio{Name: "Main", IsDefault: true}
+	if err := db.Create(&portfolio).Error; err != nil {
+		t.Fatalf("create portfolio: %v", err)
+	}
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: portfolio.ID, AlertsEnabled: true}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	alert := models.Alert{PortfolioID: portfolio.ID, Ticker: "ACME", AlertType: "stop_hit", Message: "stop hit"}
+	if err := db.Create(&alert).Error; err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+
+	// No SendGrid key or Telegram token: neither channel may be marked sent.
+	alertService := services.NewAlertService(&config.Config{}, zerolog.Nop())
+	channels := map[string]alertSender{
+		services.AlertChannelEmail:    alertService,
+		services.AlertChannelTelegram: alertSenderFunc(alertService.SendTelegram),
+	}
+	routes := map[string][]string{services.AlertSeverityCritical: {services.AlertChannelEmail, services.AlertChannelTelegram}}
+	sendPendingAlerts(db, channels, routes, []string{"stop_hit"}, time.Date(2026, 1, 6, 12, 0, 0, 0, time.UTC), zerolog.Nop())
+
+	if err := db.First(&alert, alert.ID).Error; err != nil {
+		t.Fatalf("reload alert: %v", err)
+	}
+	if alert.EmailSent || alert.TelegramSent || alert.DeliveredAt != nil {
+		t.Fatalf("expected the alert to stay queued, got %+v", alert)
+	}
+}
+
+type stubRatingsFetcher struct {
+	ratings services.AnalystRatings
+}
+
+func (s stubRatingsFetcher) FetchAnalystRatings(string) (services.AnalystRatings, error) {
+	return s.ratings, nil
+}
+
+func TestReestimateProbabilityLowersPOnSellShift(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+
+	newStock := func(ticker string, manual bool) models.Stock {
+		stock := models.Stock{
+			PortfolioID:         1,
+			Ticker:              ticker,
+			Currency:            "USD",
+			CurrentPrice:        100,
+			FairValue:           120,
+			DownsideRisk:        -10,
+			ProbabilityPositive: 0.65,
+			ProbabilityManual:   manual,
+			AnalystBuy:          10, // Previously all Buy
+			UpdateFrequency:     "daily",
+		}
+		services.CalculateMetrics(&stock, services.DefaultMetricsConfig())
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+		return stock
+	}
+	stock := newStock("ACME", false)
+	manual := newStock("HAND", true)
+	if stock.Assessment != "Add" {
+		t.Fatalf("setup: expected Add at p=0.65, got %s", stock.Assessment)
+	}
+
+	fetcher := stubRatingsFetcher{ratings: services.AnalystRatings{Buy: 1, Hold: 2, Sell: 7}}
+	if !reestimateProbability(db, fetcher, &stock, 0.2, zerolog.Nop()) {
+		t.Fatal("expected p to be re-estimated after the shift to mostly Sell")
+	}
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.ProbabilityPositive >= 0.65 || saved.Assessment == "Add" {
+		t.Fatalf("expected lower p and a flipped assessment, got p=%.3f %s", saved.ProbabilityPositive, saved.Assessment)
+	}
+	if saved.AnalystSell != 7 || saved.AnalystBuy != 1 || saved.AnalystRatingsAt == nil {
+		t.Fatalf("expected the new rating mix to be stored, got %+v", services.StoredAnalystRatings(&saved))
+	}
+	var alerts []models.Alert
+	if err := db.Where("alert_type = ?", services.AlertTypeProbabilityReestimated).Find(&alerts).Error; err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Ticker != "ACME" || !strings.Contains(alerts[0].Message, "0.65 →") || !strings.Contains(alerts[0].Message, "Add →") {
+		t.Fatalf("expected one ACME alert with the p and assessment change, got %+v", alerts)
+	}
+
+	// The same mix again is no longer a change; a manual p is never re-estimated.
+	if reestimateProbability(db, fetcher, &stock, 0.2, zerolog.Nop()) {
+		t.Fatal("expected no second re-estimate for an unchanged mix")
+	}
+	if reestimateProbability(db, fetcher, &manual, 0.2, zerolog.Nop()) {
+		t.Fatal("expected a manual probability to be left alone")
+	}
+	var savedManual models.Stock
+	if err := db.First(&savedManual, manual.ID).Error; err != nil {
+		t.Fatalf("reload manual stock: %v", err)
+	}
+	if savedManual.ProbabilityPositive != 0.65 || savedManual.AnalystSell != 7 {
+		t.Fatalf("manual stock: expected p 0.65 kept and ratings stored, got p=%.3f sell=%d", savedManual.ProbabilityPositive, savedManual.AnalystSell)
+	}
+}
+
+func TestUpdateStockRaisesFairValueUncertainOnDispersedSingleProvider(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: 1, MaxFVDispersion: 25, AlertCooldownHours: 12}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	stock := models.Stock{PortfolioID: 1, Ticker: "ACME", Currency: "USD", CurrentPrice: 100, FairValue: 130}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	// Grok alone: no provider spread, but a standard deviation of about 108.0 around the 100 median.
+	now := time.Now()
+	collector := stubCollector{entries: []services.NormalizedFairValueEntry{
+		{FairValue: 50, Source: "Grok | Reuters", RecordedAt: now},
+		{FairValue: 100, Source: "Grok | Morningstar", RecordedAt: now},
+		{FairValue: 300, Source: "Grok | Zacks", RecordedAt: now},
+	}}
+	if _, err := updateStock(db, stubPriceFetcher{price: 100}, collector, fx, &stock, zerolog.Nop()); err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+
+	var alerts []models.Alert
+	if err := db.Where("alert_type = ?", services.AlertTypeFairValueUncertain).Find(&alerts).Error; err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Message, "108.0%") {
+		t.Fatalf("expected one fair_value_uncertain alert stating the 108.0%% dispersion, got %+v", alerts)
+	}
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.FairValueConfidence != services.FairValueConfidenceLow {
+		t.Errorf("FairValueConfidence: got %q want low", saved.FairValueConfidence)
+	}
+}
+
+func TestUpdateStockRaisesFairValueUncertainWhenProvidersDisagree(t *testing.T) {
+	t.Parallel()
+	db, fx := setupSchedulerTest(t)
+	if err := db.Create(&models.PortfolioSettings{PortfolioID: 1, MaxFVDisagreement: 25, AlertCooldownHours: 12}).Error; err != nil {
+		t.Fatalf("create settings: %v", err)
+	}
+	stock := models.Stock{PortfolioID: 1, Ticker: "ACME", Currency: "USD", CurrentPrice: 100, FairValue: 130}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	// Provider medians 150 and 250 around a 200 consensus differ by 50%, above the 25% threshold.
+	now := time.Now()
+	collector := stubCollector{entries: []services.NormalizedFairValueEntry{
+		{FairValue: 100, Source: "Grok | Reuters", RecordedAt: now},
+		{FairValue: 200, Source: "Grok | Morningstar", RecordedAt: now},
+		{FairValue: 250, Source: "Deepseek | Zacks", RecordedAt: now},
+	}}
+	for i := 0; i < 2; i++ {
+		if _, err := updateStock(db, stubPriceFetcher{price: 100}, collector, fx, &stock, zerolog.Nop()); err != nil {
+			t.Fatalf("updateStock: %v", err)
+		}
+	}
+
+	var alerts []models.Alert
+	if err := db.Where("alert_type = ?", services.AlertTypeFairValueUncertain).Find(&alerts).Error; err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("fair_value_uncertain alerts: got %d want 1 (second run within the cooldown)", len(alerts))
+	}
+	if !strings.Contains(alerts[0].Message, "50.0%") {
+		t.Errorf("message should state the provider disagreement: %q", alerts[0].Message)
+	}
+	var saved models.Stock
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.FairValueConfidence != services.FairValueConfidenceLow {
+		t.Errorf("FairValueConfidence: got %q want low", saved.FairValueConfidence)
+	}
+
+	// Agreeing sources restore normal confidence without another alert.
+	collector.entries = []services.NormalizedFairValueEntry{
+		{FairValue: 195, Source: "Grok | Reuters", RecordedAt: now},
+		{FairValue: 205, Source: "Deepseek | Zacks", RecordedAt: now},
+	}
+	if _, err := updateStock(db, stubPriceFetcher{price: 100}, collector, fx, &stock, zerolog.Nop()); err != nil {
+		t.Fatalf("updateStock: %v", err)
+	}
+	if err := db.First(&saved, stock.ID).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if saved.FairValueConfidence != services.FairValueConfidenceNormal {
+		t.Errorf("FairValueConfidence after agreeing sources: got %q want normal", saved.FairValueConfidence)
+	}
+}
+
+// stubAssessor persists a completed assessment with recommendation for each stock, as AssessStock does.
+type stubAssessor struct {
+	db             *gorm.DB
+	recommendation string
+	assessed       []string
+}
+
+func (s *stubAssessor) ScheduledSource() string { return "grok" }
+
+func (s *stubAssessor) AssessStock(stock *models.Stock) (models.Assessment, error) {
+	s.assessed = append(s.assessed, stock.Ticker)
+	recommendation := s.recommendation
+	record := models.Assessment{PortfolioID: stock.PortfolioID, Ticker: stock.Ticker, Source: "grok", Status: "completed", Recommendation: &recommendation, StockID: &stock.ID}
+	if err := s.db.Where("portfolio_id = ? AND ticker = ? AND source = ?", stock.PortfolioID, stock.Ticker, "grok").Delete(&models.Assessment{}).Error; err != nil {
+		return models.Assessment{}, err
+	}
+	return record, s.db.Create(&record).Error
+}
+
+func TestScheduledAssessmentsGenerateForDueStocksAndAlertOnChange(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+	if err := db.AutoMigrate(&models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	now := time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	for _, stock := range []models.Stock{
+		{PortfolioID: 1, Ticker: "DUE", Currency: "USD", AssessmentFrequency: services.AssessmentFrequencyWeekly},
+		{PortfolioID: 1, Ticker: "FRESH", Currency: "USD", AssessmentFrequency: services.AssessmentFrequencyWeekly, LastAssessedAt: &yesterday},
+		{PortfolioID: 1, Ticker: "OFF", Currency: "USD"},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+	hold := "Hold"
+	if err := db.Create(&models.Assessment{PortfolioID: 1, Ticker: "DUE", Source: "grok", Status: "completed", Recommendation: &hold}).Error; err != nil {
+		t.Fatalf("create previous assessment: %v", err)
+	}
+
+	assessor := &stubAssessor{db: db, recommendation: "Sell"}
+	if got := runScheduledAssessments(db, assessor, 5, now, zerolog.Nop()); got != 1 {
+		t.Fatalf("assessed: got %d want 1", got)
+	}
+	if len(assessor.assessed) != 1 || assessor.assessed[0] != "DUE" {
+		t.Fatalf("expected only DUE to be assessed, got %v", assessor.assessed)
+	}
+	var due models.Stock
+	if err := db.Where("ticker = ?", "DUE").First(&due).Error; err != nil {
+		t.Fatalf("reload stock: %v", err)
+	}
+	if due.LastAssessedAt == nil || !due.LastAssessedAt.Equal(now) {
+		t.Fatalf("expected last_assessed_at %v, got %v", now, due.LastAssessedAt)
+	}
+	var record models.Assessment
+	if err := db.Where("ticker = ?", "DUE").First(&record).Error; err != nil {
+		t.Fatalf("load assessment: %v", err)
+	}
+	if record.StockID == nil || *record.StockID != due.ID {
+		t.Fatalf("expected the assessment to be linked to stock %d, got %v", due.ID, record.StockID)
+	}
+	var alerts []models.Alert
+	if err := db.Where("alert_type = ?", services.AlertTypeAssessmentChanged).Find(&alerts).Error; err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].StockID != due.ID || !strings.Contains(alerts[0].Message, "from Hold to Sell") {
+		t.Fatalf("expected one assessment_changed alert for DUE, got %+v", alerts)
+	}
+
+	// Assessed at now, DUE is not due again until a week later.
+	if got := runScheduledAssessments(db, assessor, 5, now.AddDate(0, 0, 1), zerolog.Nop()); got != 0 {
+		t.Fatalf("second run assessed %d, want 0", got)
+	}
+}
+
+func TestScheduledAssessmentsCompareAgainstTheScheduledSource(t *testing.T) {
+	t.Parallel()
+	db, _ := setupSchedulerTest(t)
+	if err := db.AutoMigrate(&models.Assessment{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	now := time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC)
+	for _, stock := range []models.Stock{
+		{PortfolioID: 1, Ticker: "OTHER", Currency: "USD", AssessmentFrequency: services.AssessmentFrequencyWeekly},
+		{PortfolioID: 1, Ticker: "low", Currency: "USD", AssessmentFrequency: services.AssessmentFrequencyWeekly},
+	} {
+		if err := db.Create(&stock).Error; err != nil {
+			t.Fatalf("create stock: %v", err)
+		}
+	}
+	add, hold := "Add", "Hold"
+	for _, previous := range []models.Assessment{
+		// Another source's opinion is not the scheduled assessment's previous one.
+		{PortfolioID: 1, Ticker: "OTHER", Source: "deepseek", Status: "completed", Recommendation: &add},
+		// Stored assessments carry upper-cased tickers.
+		{PortfolioID: 1, Ticker: "LOW", Source: "grok", Status: "completed", Recommendation: &hold},
+	} {
+		if err := db.Create(&previous).Error; err != nil {
+			t.Fatalf("create previous assessment: %v", err)
+		}
+	}
+
+	assessor := &stubAssessor{db: db, recommendation: "Sell"}
+	if got := runScheduledAssessments(db, assessor, 5, now, zerolog.Nop()); got != 2 {
+		t.Fatalf("assessed: got %d want 2", got)
+	}
+	var alerts []models.Alert
+	if err := db.Where("alert_type = ?", services.AlertTypeAssessmentChanged).Find(&alerts).Error; err != nil {
+		t.Fatalf("load alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Ticker != "low" {
+		t.Fatalf("expected one assessment_changed alert for low only, got %+v", alerts)
+	}
+}
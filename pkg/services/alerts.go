@@ -1,7 +1,14 @@
 package services
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/art-pro/stock-backend/pkg/config"
 	"github.com/art-pro/stock-backend/pkg/models"
@@ -10,30 +17,40 @@ import (
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
+// Alert delivery channels named in ALERT_ROUTES.
+const (
+	AlertChannelEmail    = "email"
+	AlertChannelTelegram = "telegram"
+)
+
+// ErrChannelNotConfigured is returned by the Send methods when the channel's credentials are missing,
+// so callers leave the alert queued instead of marking it sent.
+var ErrChannelNotConfigured = errors.New("alert channel not configured")
+
 // AlertService handles sending alerts
 type AlertService struct {
-	cfg    *config.Config
-	logger zerolog.Logger
+	cfg             *config.Config
+	logger          zerolog.Logger
+	client          *http.Client
+	telegramBaseURL string
 }
 
 // NewAlertService creates a new alert service
 func NewAlertService(cfg *config.Config, logger zerolog.Logger) *AlertService {
 	return &AlertService{
-		cfg:    cfg,
-		logger: logger,
+		cfg:             cfg,
+		logger:          logger,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		telegramBaseURL: "https://api.telegram.org",
 	}
 }
 
 // SendAlert sends an email alert
 func (s *AlertService) SendAlert(alert models.Alert) error {
 	if s.cfg.SendGridAPIKey == "" {
-		s.logger.Warn().Msg("SendGrid API key not configured, skipping email")
-		return nil
+		return fmt.Errorf("email: %w", ErrChannelNotConfigured)
 	}
 
-	from := mail.NewEmail("Stock Tracker Alerts", s.cfg.AlertEmailFrom)
-	to := mail.NewEmail("Admin", s.cfg.AlertEmailTo)
-
 	subject := fmt.Sprintf("Stock Alert: %s - %s", alert.Ticker, alert.AlertType)
 
 	plainTextContent := fmt.Sprintf(
@@ -55,6 +72,52 @@ func (s *AlertService) SendAlert(alert models.Alert) error {
 		</html>
 	`, alert.Ticker, alert.AlertType, alert.Message, alert.CreatedAt.Format("2006-01-02 15:04:05"))
 
+	if err := s.sendEmail(subject, plainTextContent, htmlContent); err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("ticker", alert.Ticker).Msg("Alert email sent successfully")
+	return nil
+}
+
+// SendDigest emails alerts held back during quiet hours as one message.
+func (s *AlertService) SendDigest(alerts []models.Alert) error {
+	if s.cfg.SendGridAPIKey == "" {
+		return fmt.Errorf("email: %w", ErrChannelNotConfigured)
+	}
+
+	subject := fmt.Sprintf("Stock Alerts: %d held during quiet hours", len(alerts))
+
+	var plainTextContent, items strings.Builder
+	plainTextContent.WriteString("Alerts raised during quiet hours:\n")
+	for _, alert := range alerts {
+		createdAt := alert.CreatedAt.Format("2006-01-02 15:04:05")
+		fmt.Fprintf(&plainTextContent, "\n%s %s - %s: %s", createdAt, alert.Ticker, alert.AlertType, alert.Message)
+		fmt.Fprintf(&items, "<li>%s <strong>%s - %s</strong>: %s</li>", createdAt, alert.Ticker, alert.AlertType, alert.Message)
+	}
+
+	htmlContent := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>%s</h2>
+			<ul>%s</ul>
+		</body>
+		</html>
+	`, subject, items.String())
+
+	if err := s.sendEmail(subject, plainTextContent.String(), htmlContent); err != nil {
+		return err
+	}
+
+	s.logger.Info().Int("count", len(alerts)).Msg("Alert digest email sent successfully")
+	return nil
+}
+
+// sendEmail sends one message from AlertEmailFrom to AlertEmailTo through SendGrid.
+func (s *AlertService) sendEmail(subject, plainTextContent, htmlContent string) error {
+	from := mail.NewEmail("Stock Tracker Alerts", s.cfg.AlertEmailFrom)
+	to := mail.NewEmail("Admin", s.cfg.AlertEmailTo)
+
 	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
 	client := sendgrid.NewSendClient(s.cfg.SendGridAPIKey)
 
@@ -66,7 +129,136 @@ func (s *AlertService) SendAlert(alert models.Alert) error {
 	if response.StatusCode >= 300 {
 		return fmt.Errorf("email service returned status %d", response.StatusCode)
 	}
+	return nil
+}
 
-	s.logger.Info().Str("ticker", alert.Ticker).Msg("Alert email sent successfully")
+// SendTelegram posts the alert to the configured Telegram chat via the Bot API.
+func (s *AlertService) SendTelegram(alert models.Alert) error {
+	if s.cfg.TelegramBotToken == "" || s.cfg.TelegramChatID == "" {
+		return fmt.Errorf("telegram: %w", ErrChannelNotConfigured)
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"chat_id": s.cfg.TelegramChatID,
+		"text":    fmt.Sprintf("[%s] %s - %s\n%s", strings.ToUpper(alert.Severity), alert.Ticker, alert.AlertType, alert.Message),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode telegram message: %w", err)
+	}
+	url := fmt.Sprintf("%s/bot%s/sendMessage", s.telegramBaseURL, s.cfg.TelegramBotToken)
+	response, err := s.client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// The URL embeds the bot token, so it is left out of the error.
+		return fmt.Errorf("failed to send telegram message")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("telegram returned status %d", response.StatusCode)
+	}
+
+	s.logger.Info().Str("ticker", alert.Ticker).Msg("Alert telegram message sent successfully")
+	return nil
+}
+
+// Alert severities. Critical alerts are delivered even during quiet hours.
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+// alertTypeSeverity is the severity of alert types that carry no magnitude.
+var alertTypeSeverity = map[string]string{
+	AlertTypeBuyZone:                AlertSeverityInfo,
+	"needs_review":                  AlertSeverityInfo,
+	"review_due":                    AlertSeverityInfo,
+	"sector_overexposure":           AlertSeverityWarning,
+	AlertTypeProbabilityReestimated: AlertSeverityInfo,
+	AlertTypeTradingHalted:          AlertSeverityWarning,
+	AlertTypeProviderAuthFailed:     AlertSeverityWarning,
+	AlertTypeFairValueUncertain:     AlertSeverityWarning,
+	AlertTypeAssessmentChanged:      AlertSeverityInfo,
+}
+
+// evChangeCriticalPoints is the EV move (percentage points) at which an ev_change alert is critical.
+const evChangeCriticalPoints = 25.0
+
+// EVChangeSeverity grades an ev_change alert by the size of the EV move in percentage points.
+func EVChangeSeverity(change float64) string {
+	if math.Abs(change) >= evChangeCriticalPoints {
+		return AlertSeverityCritical
+	}
+	return AlertSeverityWarning
+}
+
+// AlertSeverity returns the alert's severity: critical for types listed in urgentTypes, else the
+// severity stored when the alert was raised (set from its magnitude), else the default for its type
+// (warning for unknown types).
+func AlertSeverity(alert models.Alert, urgentTypes []string) string {
+	for _, urgent := range urgentTypes {
+		if strings.EqualFold(alert.AlertType, urgent) {
+			return AlertSeverityCritical
+		}
+	}
+	if alert.Severity != "" {
+		return alert.Severity
+	}
+	if severity, ok := alertTypeSeverity[alert.AlertType]; ok {
+		return severity
+	}
+	return AlertSeverityWarning
+}
+
+// AlertChannelsFor returns the channels routes assigns to severity. Severities missing from routes
+// go to email; an empty list means the alert is only logged.
+func AlertChannelsFor(routes map[string][]string, severity string) []string {
+	if channels, ok := routes[severity]; ok {
+		return channels
+	}
+	return []string{AlertChannelEmail}
+}
+
+// QuietHours is a daily window ("HH:MM" local times) during which non-urgent alert emails are held.
+// The window may wrap midnight (22:00–07:00). Empty Start or End disables it.
+type QuietHours struct {
+	Start    string
+	End      string
+	Timezone string // IANA name; empty = UTC
+}
+
+// Validate reports whether the window's times and timezone parse.
+func (q QuietHours) Validate() error {
+	if q.Start == "" && q.End == "" {
+		return nil
+	}
+	if _, err := time.Parse("15:04", q.Start); err != nil {
+		return fmt.Errorf("invalid quiet hours start %q (want HH:MM)", q.Start)
+	}
+	if _, err := time.Parse("15:04", q.End); err != nil {
+		return fmt.Errorf("invalid quiet hours end %q (want HH:MM)", q.End)
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid quiet hours timezone %q", q.Timezone)
+	}
 	return nil
 }
+
+// Contains reports whether t falls inside the quiet window. Invalid windows never match.
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Start == "" || q.End == "" || q.Validate() != nil {
+		return false
+	}
+	location, _ := time.LoadLocation(q.Timezone)
+	start, _ := time.Parse("15:04", q.Start)
+	end, _ := time.Parse("15:04", q.End)
+
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+	return minute >= startMinute || minute < endMinute
+}
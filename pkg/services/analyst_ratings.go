@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// AlertTypeProbabilityReestimated marks p being re-estimated after a material analyst rating change.
+const AlertTypeProbabilityReestimated = "probability_reestimated"
+
+// Conservative clamp for probabilities estimated from analyst ratings: a unanimous Strong Buy never
+// implies more than 0.70 (the strategy's ceiling) and a unanimous Strong Sell never less than 0.30.
+const (
+	ratingProbabilityMin = 0.30
+	ratingProbabilityMax = 0.70
+)
+
+// minProbabilityChange is the smallest re-estimated p change worth applying.
+const minProbabilityChange = 0.005
+
+// AnalystRatings is a stock's analyst rating mix as counts per rating.
+type AnalystRatings struct {
+	StrongBuy  int `json:"strong_buy"`
+	Buy        int `json:"buy"`
+	Hold       int `json:"hold"`
+	Sell       int `json:"sell"`
+	StrongSell int `json:"strong_sell"`
+}
+
+// Total is the number of ratings.
+func (r AnalystRatings) Total() int {
+	return r.StrongBuy + r.Buy + r.Hold + r.Sell + r.StrongSell
+}
+
+func (r AnalystRatings) fractions() [5]float64 {
+	total := float64(r.Total())
+	if total == 0 {
+		return [5]float64{}
+	}
+	return [5]float64{
+		float64(r.StrongBuy) / total,
+		float64(r.Buy) / total,
+		float64(r.Hold) / total,
+		float64(r.Sell) / total,
+		float64(r.StrongSell) / total,
+	}
+}
+
+// StoredAnalystRatings returns the rating mix last stored on stock.
+func StoredAnalystRatings(stock *models.Stock) AnalystRatings {
+	return AnalystRatings{
+		StrongBuy:  stock.AnalystStrongBuy,
+		Buy:        stock.AnalystBuy,
+		Hold:       stock.AnalystHold,
+		Sell:       stock.AnalystSell,
+		StrongSell: stock.AnalystStrongSell,
+	}
+}
+
+// EstimateProbabilityFromRatings maps a rating mix to p: the rating-weighted average of 0.70 Strong
+// Buy, 0.65 Buy, 0.50 Hold, 0.40 Sell and 0.30 Strong Sell (the strategy's guidance), clamped to
+// [0.30, 0.70]. Returns false when there are no ratings.
+func EstimateProbabilityFromRatings(r AnalystRatings) (float64, bool) {
+	if r.Total() == 0 {
+		return 0, false
+	}
+	weights := [5]float64{0.70, 0.65, 0.50, 0.40, 0.30}
+	p := 0.0
+	for i, fraction := range r.fractions() {
+		p += fraction * weights[i]
+	}
+	return math.Max(ratingProbabilityMin, math.Min(ratingProbabilityMax, p)), true
+}
+
+// RatingMixShift is the share of ratings (0–1) that moved between two mixes: half the sum of the
+// absolute differences of their fractions. 0 when either mix is empty.
+func RatingMixShift(previous, current AnalystRatings) float64 {
+	if previous.Total() == 0 || current.Total() == 0 {
+		return 0
+	}
+	before, after := previous.fractions(), current.fractions()
+	shift := 0.0
+	for i := range before {
+		shift += math.Abs(after[i] - before[i])
+	}
+	return shift / 2
+}
+
+// ProbabilityReestimate records a p change applied by ApplyAnalystRatings.
+type ProbabilityReestimate struct {
+	OldProbability float64
+	NewProbability float64
+	OldEV          float64
+	NewEV          float64
+	OldAssessment  string
+	NewAssessment  string
+	Shift          float64 // RatingMixShift that triggered it
+}
+
+// Message describes the change for a probability_reestimated alert.
+func (r ProbabilityReestimate) Message(ticker string) string {
+	msg := fmt.Sprintf("%s analyst ratings shifted %.0f%%: probability re-estimated %.2f → %.2f, EV %.1f%% → %.1f%%",
+		ticker, r.Shift*100, r.OldProbability, r.NewProbability, r.OldEV, r.NewEV)
+	if r.OldAssessment != r.NewAssessment {
+		msg += fmt.Sprintf(" (assessment %s → %s)", r.OldAssessment, r.NewAssessment)
+	}
+	return msg
+}
+
+// ApplyAnalystRatings stores ratings as stock's latest rating mix and, when the mix moved by at least
+// minShift against the previously stored one, re-estimates ProbabilityPositive from it and recomputes
+// metrics with cfg. The first mix seen only sets the baseline, and a stock with ProbabilityManual keeps its p.
+// Returns the applied change, or false when p was left alone.
+func ApplyAnalystRatings(stock *models.Stock, ratings AnalystRatings, minShift float64, now time.Time, cfg MetricsConfig) (ProbabilityReestimate, bool) {
+	previous := StoredAnalystRatings(stock)
+	stock.AnalystStrongBuy = ratings.StrongBuy
+	stock.AnalystBuy = ratings.Buy
+	stock.AnalystHold = ratings.Hold
+	stock.AnalystSell = ratings.Sell
+	stock.AnalystStrongSell = ratings.StrongSell
+	stock.AnalystRatingsAt = &now
+
+	shift := RatingMixShift(previous, ratings)
+	if previous.Total() == 0 || shift < minShift || stock.ProbabilityManual {
+		return ProbabilityReestimate{}, false
+	}
+	p, ok := EstimateProbabilityFromRatings(ratings)
+	if !ok || math.Abs(p-stock.ProbabilityPositive) < minProbabilityChange {
+		return ProbabilityReestimate{}, false
+	}
+
+	change := ProbabilityReestimate{
+		OldProbability: stock.ProbabilityPositive,
+		NewProbability: p,
+		OldEV:          stock.ExpectedValue,
+		OldAssessment:  stock.Assessment,
+		Shift:          shift,
+	}
+	stock.ProbabilityPositive = p
+	CalculateMetrics(stock, cfg)
+	change.NewEV = stock.ExpectedValue
+	change.NewAssessment = stock.Assessment
+	return change, true
+}
+
+// FetchAnalystRatings returns the analyst rating mix from the Alpha Vantage company overview.
+func (s *ExternalAPIService) FetchAnalystRatings(ticker string) (AnalystRatings, error) {
+	overview, err := s.FetchAlphaVantageOverview(ticker)
+	if err != nil {
+		return AnalystRatings{}, err
+	}
+	count := func(raw string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || n < 0 {
+			return 0 // "None" or missing
+		}
+		return n
+	}
+	return AnalystRatings{
+		StrongBuy:  count(overview.AnalystRatingStrongBuy),
+		Buy:        count(overview.AnalystRatingBuy),
+		Hold:       count(overview.AnalystRatingHold),
+		Sell:       count(overview.AnalystRatingSell),
+		StrongSell: count(overview.AnalystRatingStrongSell),
+	}, nil
+}
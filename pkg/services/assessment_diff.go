@@ -0,0 +1,405 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// AssessmentSources are the sources an assessment can be requested from and stored under.
+var AssessmentSources = []string{"grok", "deepseek", "perplexity", "chatgpt", "claude"}
+
+// AssessmentCompareRow is one field of an assessment diff, with each source's extracted value.
+type AssessmentCompareRow struct {
+	Key        string `json:"key"`
+	Label      string `json:"label"`
+	Grok       string `json:"grok"`
+	Deepseek   string `json:"deepseek"`
+	Perplexity string `json:"perplexity,omitempty"`
+	ChatGPT    string `json:"chatgpt,omitempty"`
+	Claude     string `json:"claude,omitempty"`
+}
+
+// assessmentCompareLLMResult is the JSON the extraction model returns, keyed by source then field.
+type assessmentCompareLLMResult struct {
+	Grok       map[string]string `json:"grok"`
+	Deepseek   map[string]string `json:"deepseek"`
+	Perplexity map[string]string `json:"perplexity,omitempty"`
+	ChatGPT    map[string]string `json:"chatgpt,omitempty"`
+	Claude     map[string]string `json:"claude,omitempty"`
+}
+
+// CompleteChat calls Grok, Deepseek, Claude (through their LLMProvider), Perplexity, or ChatGPT chat API and returns the assistant content.
+func (s *AssessmentService) CompleteChat(systemContent, userContent, source string) (string, error) {
+	var url string
+	var apiKey string
+	var model string
+	switch source {
+	case "perplexity":
+		url = "https://api.perplexity.ai/chat/completions"
+		apiKey = s.cfg.PerplexityAPIKey
+		model = s.cfg.ModelFor(config.UseCaseAssessment, "perplexity")
+	case "chatgpt":
+		url = "https://api.openai.com/v1/chat/completions"
+		apiKey = s.cfg.OpenAIAPIKey
+		model = s.cfg.ModelFor(config.UseCaseAssessment, "chatgpt")
+	default:
+		return s.Provider(source).Complete(context.Background(), systemContent, userContent)
+	}
+	if apiKey == "" {
+		return "", fmt.Errorf("%s API key not configured", source)
+	}
+	reqBody := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": systemContent},
+			{"role": "user", "content": userContent},
+		},
+		"stream": false,
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("call API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("API status %d: %s", resp.StatusCode, string(body))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("parse response: %w", err)
+	}
+	RecordProviderSuccess(resp)
+	choices, ok := parsed["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("invalid choice format")
+	}
+	message, ok := choice["message"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("invalid message format")
+	}
+	content, ok := message["content"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid content format")
+	}
+	return RequireContent(content)
+}
+
+func assessmentCompareFieldSpec() []struct {
+	Key   string
+	Label string
+} {
+	return []struct {
+		Key   string
+		Label string
+	}{
+		{"current_price", "Current Price"},
+		{"fair_value_estimate", "Fair Value Estimate"},
+		{"upside_potential", "Upside Potential"},
+		{"beta", "Beta"},
+		{"downside_risk", "Downside Risk (D)"},
+		{"probability_positive", "Probability of Positive Outcome (p)"},
+		{"volatility", "Volatility (σ)"},
+		{"forward_pe_ratio", "Forward P/E Ratio"},
+		{"eps_growth", "EPS Growth"},
+		{"debt_to_ebitda_ttm", "Debt-to-EBITDA (TTM)"},
+		{"dividend_yield", "Dividend Yield"},
+		{"expected_value_calculation", "Expected Value (EV) Calculation"},
+		{"kelly_criterion_sizing", "Kelly Criterion Sizing"},
+		{"buy_zone", "Buy Zone"},
+		{"final_assessment", "Final Assessment"},
+	}
+}
+
+// ExtractAssessmentCompareRows asks an LLM to pull the comparable fields out of each source's
+// assessment text. Perplexity, ChatGPT and Claude columns are filled only when their text is given.
+func (s *AssessmentService) ExtractAssessmentCompareRows(ticker, grokAssessment, deepseekAssessment, perplexityAssessment, chatgptAssessment, claudeAssessment string) ([]AssessmentCompareRow, error) {
+	var source string
+	switch {
+	case s.cfg.XAIAPIKey != "":
+		source = "grok"
+	case s.cfg.DeepseekAPIKey != "":
+		source = "deepseek"
+	case s.cfg.PerplexityAPIKey != "":
+		source = "perplexity"
+	case s.cfg.OpenAIAPIKey != "":
+		source = "chatgpt"
+	case s.cfg.AnthropicAPIKey != "":
+		source = "claude"
+	default:
+		return nil, fmt.Errorf("No LLM API key configured")
+	}
+
+	perplexityBlock := ""
+	if perplexityAssessment != "" {
+		perplexityBlock = `,
+  "perplexity": {
+    "current_price": "...",
+    "fair_value_estimate": "...",
+    "upside_potential": "...",
+    "beta": "...",
+    "downside_risk": "...",
+    "probability_positive": "...",
+    "volatility": "...",
+    "forward_pe_ratio": "...",
+    "eps_growth": "...",
+    "debt_to_ebitda_ttm": "...",
+    "dividend_yield": "...",
+    "expected_value_calculation": "...",
+    "kelly_criterion_sizing": "...",
+    "buy_zone": "...",
+    "final_assessment": "ADD|SELL|HOLD|N/A"
+  }`
+	}
+	chatgptBlock := ""
+	if chatgptAssessment != "" {
+		chatgptBlock = `,
+  "chatgpt": {
+    "current_price": "...",
+    "fair_value_estimate": "...",
+    "upside_potential": "...",
+    "beta": "...",
+    "downside_risk": "...",
+    "probability_positive": "...",
+    "volatility": "...",
+    "forward_pe_ratio": "...",
+    "eps_growth": "...",
+    "debt_to_ebitda_ttm": "...",
+    "dividend_yield": "...",
+    "expected_value_calculation": "...",
+    "kelly_criterion_sizing": "...",
+    "buy_zone": "...",
+    "final_assessment": "ADD|SELL|HOLD|N/A"
+  }`
+	}
+	claudeBlock := ""
+	if claudeAssessment != "" {
+		claudeBlock = `,
+  "claude": {
+    "current_price": "...",
+    "fair_value_estimate": "...",
+    "upside_potential": "...",
+    "beta": "...",
+    "downside_risk": "...",
+    "probability_positive": "...",
+    "volatility": "...",
+    "forward_pe_ratio": "...",
+    "eps_growth": "...",
+    "debt_to_ebitda_ttm": "...",
+    "dividend_yield": "...",
+    "expected_value_calculation": "...",
+    "kelly_criterion_sizing": "...",
+    "buy_zone": "...",
+    "final_assessment": "ADD|SELL|HOLD|N/A"
+  }`
+	}
+	systemContent := "You are a financial data extraction assistant. Extract only values explicitly present in text. If a field is absent, return 'N/A'. For final assessment return only ADD, SELL, or HOLD if clearly stated, otherwise N/A."
+	userContent := fmt.Sprintf(`Extract the requested fields from the stock assessment summaries for ticker %s.
+
+Return STRICT JSON with this exact shape (include "perplexity", "chatgpt" and/or "claude" only if the corresponding summary is provided below):
+{
+  "grok": {
+    "current_price": "...",
+    "fair_value_estimate": "...",
+    "upside_potential": "...",
+    "beta": "...",
+    "downside_risk": "...",
+    "probability_positive": "...",
+    "volatility": "...",
+    "forward_pe_ratio": "...",
+    "eps_growth": "...",
+    "debt_to_ebitda_ttm": "...",
+    "dividend_yield": "...",
+    "expected_value_calculation": "...",
+    "kelly_criterion_sizing": "...",
+    "buy_zone": "...",
+    "final_assessment": "ADD|SELL|HOLD|N/A"
+  },
+  "deepseek": {
+    "current_price": "...",
+    "fair_value_estimate": "...",
+    "upside_potential": "...",
+    "beta": "...",
+    "downside_risk": "...",
+    "probability_positive": "...",
+    "volatility": "...",
+    "forward_pe_ratio": "...",
+    "eps_growth": "...",
+    "debt_to_ebitda_ttm": "...",
+    "dividend_yield": "...",
+    "expected_value_calculation": "...",
+    "kelly_criterion_sizing": "...",
+    "buy_zone": "...",
+    "final_assessment": "ADD|SELL|HOLD|N/A"
+  }%s%s%s
+}
+
+Rules:
+- Keep values compact and human-readable.
+- Preserve units/percent signs if present.
+- Do not invent missing data.
+- Output raw JSON only, no markdown.
+
+GROK SUMMARY:
+%s
+
+DEEPSEEK SUMMARY:
+%s
+`, ticker, perplexityBlock, chatgptBlock, claudeBlock, grokAssessment, deepseekAssessment)
+	if perplexityAssessment != "" {
+		userContent += "\n\nPERPLEXITY SUMMARY:\n" + perplexityAssessment
+	}
+	if chatgptAssessment != "" {
+		userContent += "\n\nCHATGPT SUMMARY:\n" + chatgptAssessment
+	}
+	if claudeAssessment != "" {
+		userContent += "\n\nCLAUDE SUMMARY:\n" + claudeAssessment
+	}
+
+	content, err := s.CompleteChat(systemContent, userContent, source)
+	if err != nil {
+		return nil, err
+	}
+
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```json") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimSuffix(content, "```")
+	} else if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(content, "```")
+	}
+	content = strings.TrimSpace(content)
+
+	var parsed assessmentCompareLLMResult
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		s.logger.Error().Err(err).Str("content", content).Msg("Failed to parse assessment comparison JSON")
+		return nil, fmt.Errorf("Failed to parse comparison output")
+	}
+
+	fieldSpec := assessmentCompareFieldSpec()
+	rows := make([]AssessmentCompareRow, 0, len(fieldSpec))
+	for _, f := range fieldSpec {
+		grokValue := "N/A"
+		deepseekValue := "N/A"
+		perplexityValue := "N/A"
+		chatgptValue := "N/A"
+		claudeValue := "N/A"
+		if parsed.Grok != nil {
+			if value := strings.TrimSpace(parsed.Grok[f.Key]); value != "" {
+				grokValue = value
+			}
+		}
+		if parsed.Deepseek != nil {
+			if value := strings.TrimSpace(parsed.Deepseek[f.Key]); value != "" {
+				deepseekValue = value
+			}
+		}
+		if parsed.Perplexity != nil {
+			if value := strings.TrimSpace(parsed.Perplexity[f.Key]); value != "" {
+				perplexityValue = value
+			}
+		}
+		if parsed.ChatGPT != nil {
+			if value := strings.TrimSpace(parsed.ChatGPT[f.Key]); value != "" {
+				chatgptValue = value
+			}
+		}
+		if parsed.Claude != nil {
+			if value := strings.TrimSpace(parsed.Claude[f.Key]); value != "" {
+				claudeValue = value
+			}
+		}
+		rows = append(rows, AssessmentCompareRow{
+			Key:        f.Key,
+			Label:      f.Label,
+			Grok:       grokValue,
+			Deepseek:   deepseekValue,
+			Perplexity: perplexityValue,
+			ChatGPT:    chatgptValue,
+			Claude:     claudeValue,
+		})
+	}
+
+	return rows, nil
+}
+
+// PersistAssessmentDiff stores rows as the ticker's assessment diff, replacing any previous one.
+func (s *AssessmentService) PersistAssessmentDiff(ticker string, rows []AssessmentCompareRow) error {
+	payload, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+
+	var existing models.AssessmentDiff
+	err = s.db.Where("ticker = ?", ticker).First(&existing).Error
+	if err == nil {
+		return s.db.Model(&existing).Updates(map[string]interface{}{
+			"rows_json":  string(payload),
+			"updated_at": time.Now(),
+		}).Error
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	record := models.AssessmentDiff{
+		Ticker:   ticker,
+		RowsJSON: string(payload),
+	}
+	return s.db.Create(&record).Error
+}
+
+// RegenerateAssessmentDiff rebuilds and persists the ticker's diff from the portfolio's latest
+// completed assessments. It does nothing until both a Grok and a Deepseek assessment exist.
+func (s *AssessmentService) RegenerateAssessmentDiff(portfolioID uint, ticker string) error {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	var records []models.Assessment
+	if err := s.db.Where("portfolio_id = ? AND ticker = ? AND source IN ? AND status = ?", portfolioID, ticker, AssessmentSources, "completed").Find(&records).Error; err != nil {
+		return err
+	}
+
+	texts := make(map[string]string, len(AssessmentSources))
+	for _, record := range records {
+		texts[strings.ToLower(record.Source)] = record.Assessment
+	}
+	grokText, deepseekText := texts["grok"], texts["deepseek"]
+
+	if strings.TrimSpace(grokText) == "" || strings.TrimSpace(deepseekText) == "" {
+		return nil
+	}
+
+	rows, err := s.ExtractAssessmentCompareRows(ticker, grokText, deepseekText, texts["perplexity"], texts["chatgpt"], texts["claude"])
+	if err != nil {
+		return err
+	}
+	return s.PersistAssessmentDiff(ticker, rows)
+}
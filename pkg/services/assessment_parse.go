@@ -0,0 +1,91 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AssessmentSummary holds headline figures parsed from assessment text. Fields are empty when not found.
+type AssessmentSummary struct {
+	ExpectedValue  string
+	HalfKelly      string
+	Recommendation string
+}
+
+var (
+	assessmentPercentPattern = regexp.MustCompile(`[-+]?\d+(?:\.\d+)?\s*%`)
+	assessmentEVLine         = regexp.MustCompile(`\bEV\b|(?i:expected value)`)
+	assessmentKellyLine      = regexp.MustCompile(`(?i)(½|half|1/2)[\s-]*kelly`)
+	assessmentCategory       = regexp.MustCompile(`\b(Add|Hold|Trim|Sell)\b`)
+	assessmentFinalHeading   = regexp.MustCompile(`(?im)^[\s#*_\-]*final assessment\b`)
+)
+
+// ParseAssessmentSummary extracts EV, ½-Kelly and the recommendation from LLM assessment markdown.
+// EV and ½-Kelly take the last percentage on the first line mentioning them (the calculated result);
+// the recommendation is taken from the last line mentioning "assessment" with a category.
+func ParseAssessmentSummary(text string) AssessmentSummary {
+	var summary AssessmentSummary
+	for _, line := range strings.Split(text, "\n") {
+		percents := assessmentPercentPattern.FindAllString(line, -1)
+		if summary.HalfKelly == "" && len(percents) > 0 && assessmentKellyLine.MatchString(line) {
+			summary.HalfKelly = strings.ReplaceAll(percents[len(percents)-1], " ", "")
+			continue
+		}
+		if summary.ExpectedValue == "" && len(percents) > 0 && assessmentEVLine.MatchString(line) {
+			summary.ExpectedValue = strings.ReplaceAll(percents[len(percents)-1], " ", "")
+		}
+		if strings.Contains(strings.ToLower(line), "assessment") {
+			if category := assessmentCategory.FindString(line); category != "" {
+				summary.Recommendation = category
+			}
+		}
+	}
+	return summary
+}
+
+// ParseFinalAssessment extracts EV (%), ½-Kelly (%) and the recommendation from the last
+// "Final Assessment" section of the text. Values that cannot be found are left nil, as is
+// everything when the section is missing.
+func ParseFinalAssessment(text string) (expectedValue, halfKelly *float64, recommendation *string) {
+	headings := assessmentFinalHeading.FindAllStringIndex(text, -1)
+	if len(headings) == 0 {
+		return nil, nil, nil
+	}
+	section := text[headings[len(headings)-1][0]:]
+	summary := ParseAssessmentSummary(section)
+	category := summary.Recommendation
+	if category == "" {
+		category = assessmentCategory.FindString(section)
+	}
+	if category != "" {
+		recommendation = &category
+	}
+	return ParsePercentValue(summary.ExpectedValue), ParsePercentValue(summary.HalfKelly), recommendation
+}
+
+// ParsePercentValue parses a percentage such as "12.5%" into 12.5, or returns nil when raw is empty or
+// not a number.
+func ParsePercentValue(raw string) *float64 {
+	if raw == "" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// MostConservativeAssessment picks the sampled assessment with the lowest parsed EV. Choices without
+// a parseable EV are only used when none has one, in which case the first choice is returned.
+func MostConservativeAssessment(choices []string) string {
+	best, bestEV := 0, math.Inf(1)
+	for i, text := range choices {
+		if ev := ParsePercentValue(ParseAssessmentSummary(text).ExpectedValue); ev != nil && *ev < bestEV {
+			best, bestEV = i, *ev
+		}
+	}
+	return choices[best]
+}
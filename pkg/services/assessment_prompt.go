@@ -0,0 +1,293 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// defaultAssessmentSectorTargets are the bands the assessment prompt quotes for owners without
+// configured sector targets (GET/POST /settings/sector-targets).
+var defaultAssessmentSectorTargets = map[string]SectorTarget{
+	"Healthcare": {Min: 0.30, Max: 0.35},
+	"Technology": {Min: 0.15, Max: 0.15},
+}
+
+// lookupTrackedStock returns the portfolio's most recently updated stock row for ticker, or nil.
+func (s *AssessmentService) lookupTrackedStock(portfolioID uint, ticker string) *models.Stock {
+	if s.db == nil {
+		return nil
+	}
+	var stock models.Stock
+	err := s.db.Where("portfolio_id = ? AND UPPER(ticker) = ?", portfolioID, strings.ToUpper(strings.TrimSpace(ticker))).Order("updated_at DESC").First(&stock).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			s.logger.Warn().Err(err).Str("ticker", ticker).Msg("Failed to look up stock for sector context")
+		}
+		return nil
+	}
+	return &stock
+}
+
+// sectorTargetFor returns the target band for the stock's sector from its portfolio owner's sector
+// targets, falling back to defaultAssessmentSectorTargets when the owner has none configured.
+func (s *AssessmentService) sectorTargetFor(stock *models.Stock) (SectorTarget, bool) {
+	var targets map[string]SectorTarget
+	var portfolio models.Portfolio
+	if err := s.db.Select("id", "user_id").First(&portfolio, stock.PortfolioID).Error; err == nil {
+		loaded, err := LoadSectorTargets(s.db, portfolio.UserID)
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to load sector targets for assessment prompt")
+		}
+		targets = loaded
+	}
+	if len(targets) == 0 {
+		targets = defaultAssessmentSectorTargets
+	}
+	return LookupSectorTarget(targets, stock.Sector)
+}
+
+// buildSectorContext describes a tracked stock's sector, its target allocation band, currency and
+// (when includeBeta) beta for the assessment prompt. Returns "" when stock is nil or has no sector.
+func (s *AssessmentService) buildSectorContext(stock *models.Stock, includeBeta bool) string {
+	if stock == nil || strings.TrimSpace(stock.Sector) == "" {
+		return ""
+	}
+	sector := models.NormalizeSector(strings.TrimSpace(stock.Sector))
+
+	context := "\n\n## SECTOR CONTEXT (portfolio data)\n\n"
+	if target, ok := s.sectorTargetFor(stock); ok {
+		band := fmt.Sprintf("%.0f–%.0f%%", target.Min*100, target.Max*100)
+		if target.Min == target.Max {
+			band = fmt.Sprintf("%.0f%%", target.Max*100)
+		}
+		context += fmt.Sprintf("**Sector:** %s (target allocation %s of the portfolio)\n", sector, band)
+	} else {
+		context += fmt.Sprintf("**Sector:** %s (no target allocation band set; apply the general diversification rules)\n", sector)
+	}
+	if includeBeta && stock.Beta > 0 {
+		context += fmt.Sprintf("**Beta:** %.2f\n", stock.Beta)
+	}
+	if stock.Currency != "" {
+		context += fmt.Sprintf("**Trading Currency:** %s\n", stock.Currency)
+	}
+	context += "Use this sector and band rather than inferring them: calibrate downside by this beta and keep the recommended position within the sector band.\n"
+	return context
+}
+
+// buildPortfolioContext creates a formatted string describing the current portfolio
+func (s *AssessmentService) buildPortfolioContext(portfolio []models.Stock, cashHoldings []models.CashHolding) string {
+	context := "\n\n## CURRENT PORTFOLIO CONTEXT\n\n"
+
+	if len(portfolio) == 0 {
+		context += "**Current Portfolio:** Empty (no owned stocks)\n\n"
+	} else {
+		context += "**Current Portfolio (Owned Stocks):**\n\n"
+		context += "| Ticker | Company | Sector | Shares | Avg Price | Current Price | Position Value | Weight | EV | Assessment |\n"
+		context += "|--------|---------|--------|--------|-----------|---------------|----------------|--------|----|------------|\n"
+
+		totalPortfolioValue := 0.0
+		for _, stock := range portfolio {
+			positionValue := float64(stock.SharesOwned) * stock.CurrentPrice
+			totalPortfolioValue += positionValue
+		}
+
+		sectorAllocations := make(map[string]float64)
+
+		for _, stock := range portfolio {
+			positionValue := float64(stock.SharesOwned) * stock.CurrentPrice
+			weightPercent := (positionValue / totalPortfolioValue) * 100
+
+			context += fmt.Sprintf("| %s | %s | %s | %d | €%.2f | €%.2f | €%.0f | %.1f%% | %.1f%% | %s |\n",
+				stock.Ticker,
+				stock.CompanyName,
+				stock.Sector,
+				stock.SharesOwned,
+				stock.AvgPriceLocal,
+				stock.CurrentPrice,
+				positionValue,
+				weightPercent,
+				stock.ExpectedValue,
+				stock.Assessment)
+
+			// Track sector allocations
+			sectorAllocations[stock.Sector] += weightPercent
+		}
+
+		context += "\n**Current Sector Allocations:**\n"
+		for sector, allocation := range sectorAllocations {
+			context += fmt.Sprintf("- %s: %.1f%%\n", sector, allocation)
+		}
+		context += fmt.Sprintf("\n**Total Portfolio Value:** €%.0f\n", totalPortfolioValue)
+	}
+
+	// Add cash holdings
+	if len(cashHoldings) == 0 {
+		context += "\n**Available Cash:** No cash holdings recorded\n"
+	} else {
+		context += "\n**Available Cash:**\n"
+		totalCash := 0.0
+		for _, cash := range cashHoldings {
+			if cash.CurrencyCode == "EUR" {
+				// For EUR (base currency), use actual amount
+				context += fmt.Sprintf("- %s: %.0f (€%.0f)\n", cash.CurrencyCode, cash.Amount, cash.Amount)
+				totalCash += cash.Amount
+			} else {
+				// For other currencies, show both original and EUR value
+				context += fmt.Sprintf("- %s: %.0f (€%.0f)\n", cash.CurrencyCode, cash.Amount, cash.USDValue)
+				totalCash += cash.USDValue
+			}
+		}
+		context += fmt.Sprintf("\n**Total Available Cash:** €%.0f\n", totalCash)
+	}
+
+	context += "\n**IMPORTANT:** Consider this portfolio context when making recommendations. Analyze:\n"
+	context += "- How this new position would affect sector diversification\n"
+	context += "- Whether current sector allocations exceed targets (Healthcare 30-35%, Tech 15%, etc.)\n"
+	context += "- If sufficient cash is available for the recommended position size\n"
+	context += "- How this fits with the overall portfolio risk and Kelly utilization\n"
+
+	return context
+}
+
+// BuildPrompt creates the comprehensive prompt for stock assessment
+// When stockData is set, its stored price, fair value and beta are given to the model as known figures.
+// A tracked stock's sector (with its target band), beta and currency are added as sector context.
+func (s *AssessmentService) BuildPrompt(portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, portfolio []models.Stock, cashHoldings []models.CashHolding, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) string {
+	// Build portfolio context string
+	portfolioContext := s.buildPortfolioContext(portfolio, cashHoldings)
+	// Append dashboard hints when provided by the frontend (Sector rebalance hint, Concentration & tail risk, Suggested next actions)
+	if rebalanceHint != "" || concentrationHint != "" || suggestedActionsHint != "" {
+		portfolioContext += "\n\n## DASHBOARD HINTS (current portfolio state)\n\n"
+		if rebalanceHint != "" {
+			portfolioContext += "**Sector rebalance hint:** " + rebalanceHint + "\n\n"
+		}
+		if concentrationHint != "" {
+			portfolioContext += "**Concentration & tail risk:** " + concentrationHint + "\n\n"
+		}
+		if suggestedActionsHint != "" {
+			portfolioContext += "**Suggested next actions:** " + suggestedActionsHint + "\n\n"
+		}
+		portfolioContext += "Consider these hints when making recommendations (e.g. sector fit, concentration, and existing sell/trim/buy-zone actions).\n"
+	}
+	// Get current date
+	currentDate := time.Now().Format("January 2, 2006")
+
+	// Build additional stock info
+	stockInfo := ""
+	if companyName != "" {
+		stockInfo += fmt.Sprintf("\n**Company Name:** %s", companyName)
+	}
+	if strings.TrimSpace(isin) != "" {
+		stockInfo += fmt.Sprintf("\n**ISIN:** %s", strings.ToUpper(strings.TrimSpace(isin)))
+	}
+	if stockData != nil && stockData.CurrentPrice > 0 {
+		stockInfo += fmt.Sprintf("\n**Current Price:** %.2f %s (portfolio data as of %s)", stockData.CurrentPrice, stockData.Currency, stockData.LastUpdated.Format("January 2, 2006 15:04 MST"))
+		if stockData.FairValue > 0 {
+			stockInfo += fmt.Sprintf("\n**Fair Value:** %.2f %s (portfolio data)", stockData.FairValue, stockData.Currency)
+		}
+		if stockData.Beta > 0 {
+			stockInfo += fmt.Sprintf("\n**Beta:** %.2f (portfolio data)", stockData.Beta)
+		}
+		stockInfo += "\nUse these known figures as the basis for your calculations. Only deviate if you have verifiably newer data, and state the source and date when you do."
+	} else if currentPrice > 0 && currency != "" {
+		stockInfo += fmt.Sprintf("\n**Current Price:** %.2f %s (user-provided)", currentPrice, currency)
+	}
+	// Tracked stocks carry their own sector, beta and currency so the model does not guess the sector band.
+	sectorStock := stockData
+	if sectorStock == nil {
+		sectorStock = s.lookupTrackedStock(portfolioID, ticker)
+	}
+	stockInfo += s.buildSectorContext(sectorStock, stockData == nil || stockData.CurrentPrice <= 0)
+
+	return fmt.Sprintf(`CURRENT DATE: %s
+%s
+IMPORTANT: Please use the most recent available market data and financial information. Access current stock prices, latest quarterly earnings, recent analyst reports, and up-to-date fundamental metrics. If any data appears outdated, please indicate when the information was last updated.
+
+You are a financial advisor and investment consultant using a probabilistic strategy. For the stock %s, follow these steps:
+
+1. Collect data: current price, fair value (median consensus target), upside %% = ((fair value - current price) / current price) * 100, downside %% (calibrate by beta: -15%% <0.5, -20%% 0.5–1, -25%% 1–1.5, -30%% >1.5), p (0.5–0.7 based on ratings), volatility, P/E, EPS growth, debt-to-EBITDA, dividend yield.
+
+2. Calculate EV = (p * upside %%) + ((1-p) * downside %%).
+
+3. Calculate b = upside %% / |downside %%|, Kelly f* = ((b * p) - (1-p)) / b, ½-Kelly = f*/2 capped at 15%%.
+
+4. Assess: Add (EV >7%%), Hold (EV >0%%), Trim (EV <3%%), Sell (EV <0%%).
+
+5. Recommend buy zone (prices for EV >7%%), laddered entries if Add. Align with sector targets (Healthcare 30–35%%, Tech 15%%, etc.).
+
+Output in structured format with EV, Kelly, assessment, and notes. Use conservative p; avoid hype.
+
+Core Philosophy:
+My investment approach is built on probabilistic reasoning, expected value optimization, and risk control via the Kelly criterion. The strategy aims to maximize long-term portfolio growth while minimizing the probability of ruin. It is grounded in three key principles:
+
+1. Probabilistic Thinking – all investment decisions are made by assessing probabilities, not certainties. Every scenario (growth, stagnation, decline) is assigned a probability rather than treated as binary "yes/no".
+
+2. Expected Value (EV) – an investment is only valid if the expected value is positive, accounting for both the potential upside and downside.
+
+3. Kelly Criterion (½-Kelly Implementation) – position sizing is determined mathematically based on the Kelly formula, but only half of the optimal position is used to limit drawdowns and smooth volatility.
+
+Decision-Making Framework:
+For every asset, the model should follow these steps:
+
+Collect Fundamental and Market Data:
+• Current price and fair value estimate
+• Upside potential (%%) and downside risk (%%)
+• Probability of positive outcome (p)
+• Volatility (σ)
+• P/E ratio, EPS growth rate, debt-to-EBITDA, dividend yield
+
+Portfolio Construction Rules:
+• Diversification: include multiple sectors with positive EV to capture the "long tail" of outperformers.
+• Maximum single-position weight: 15%% (only for extremely high-conviction, low-volatility assets like Novo Nordisk).
+• Typical range: 3–6%% per stock, depending on EV, volatility, and risk correlation.
+• Avoid overexposure to any one sector, region, or currency.
+• Cash buffer: always maintain 8–12%% of total portfolio in cash for high-EV opportunities during corrections.
+
+Execution and Risk Management Rules:
+1. Enter only within the defined "EV buy zone." Optimal buy zones correspond to the range where EV > 7%% and downside risk < 10%%. Avoid buying into EV < 3%% or after strong rallies.
+
+2. Add positions gradually ("laddered entries"). Divide entries into 2–3 limit orders across a price range to average in probabilistically.
+
+3. Never average down mechanically. Only average down if EV increases and probability of success remains >55%%.
+
+4. Position trimming: If EV drops below +3%% (e.g., due to overvaluation), trim or take profits.
+
+5. Portfolio rebalancing: Review weights quarterly. Maintain overall Kelly usage between 0.75–0.85 (not fully leveraged).
+
+6. Hold cash strategically. Cash has optional value during corrections. Reinvest only when market-wide EV turns positive again.
+
+Behavioral and Philosophical Anchors:
+• Avoid emotional reactions to drawdowns. Evaluate situations through EV changes, not price changes.
+• Loss ≠ mistake if EV was positive at entry. Focus on process, not short-term results.
+• Never chase hype or "narratives." Wait for probabilistic edge.
+• Diversify into "future rocket stocks" (2%% of positions) to capture asymmetric long-tail gains.
+
+Target Portfolio Metrics:
+Expected Value (EV): +10–11%% (Portfolio-wide mathematical expectation)
+Volatility (σ): 11–13%% (Moderate risk level)
+Sharpe Ratio (EV/σ): 0.8–0.9 (Efficient balance of risk/reward)
+Kelly Utilization: 0.75–0.85 (Safe use of probabilistic leverage)
+Max drawdown tolerance: ≤15%% (Controlled downside risk)
+
+Summary Principle: "Every investment must be a probabilistic bet with a positive expected value, diversified across independent opportunities, and sized according to Kelly to maximize long-term growth without emotional interference."
+
+Please provide a detailed assessment for %s following the template format similar to the NVIDIA analysis example, including:
+
+- Step 1: Data Collection & Fundamental Analysis
+- Step 2: Conservative Parameter Estimation
+- Step 3: Expected Value Calculation
+- Step 4: Kelly Criterion Sizing
+- Step 5: Assessment
+- Step 6: Buy Zone & Strategic Context
+- Recommendation & Action Plan
+- Risk Management Notes
+- Final Assessment
+
+Use real market data and provide specific numbers for all calculations. Be conservative with probability estimates and avoid hype.
+
+%s`, currentDate, stockInfo, ticker, ticker, portfolioContext)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// Stock.AssessmentFrequency values: how often the scheduler re-assesses the stock with an LLM.
+const (
+	AssessmentFrequencyNone    = "none"
+	AssessmentFrequencyWeekly  = "weekly"
+	AssessmentFrequencyMonthly = "monthly"
+)
+
+// AlertTypeAssessmentChanged marks a scheduled assessment whose recommendation differs from the
+// previous assessment's.
+const AlertTypeAssessmentChanged = "assessment_changed"
+
+// NormalizeAssessmentFrequency returns the canonical form of raw ("" defaults to none), or "" when
+// raw is not a known frequency.
+func NormalizeAssessmentFrequency(raw string) string {
+	frequency := strings.ToLower(strings.TrimSpace(raw))
+	switch frequency {
+	case "":
+		return AssessmentFrequencyNone
+	case AssessmentFrequencyNone, AssessmentFrequencyWeekly, AssessmentFrequencyMonthly:
+		return frequency
+	}
+	return ""
+}
+
+// AssessmentDue reports whether stock's scheduled assessment is due at now: never assessed, or a
+// week (weekly) or a calendar month (monthly) since LastAssessedAt.
+func AssessmentDue(stock models.Stock, now time.Time) bool {
+	var next time.Time
+	switch stock.AssessmentFrequency {
+	case AssessmentFrequencyWeekly:
+		if stock.LastAssessedAt == nil {
+			return true
+		}
+		next = stock.LastAssessedAt.AddDate(0, 0, 7)
+	case AssessmentFrequencyMonthly:
+		if stock.LastAssessedAt == nil {
+			return true
+		}
+		next = stock.LastAssessedAt.AddDate(0, 1, 0)
+	default:
+		return false
+	}
+	return !now.Before(next)
+}
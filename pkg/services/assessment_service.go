@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// AssessmentSystemPrompt is the system message for single-stock assessments across all sources.
+const AssessmentSystemPrompt = "You are a financial advisor and investment consultant using a probabilistic strategy. You provide detailed stock analysis following the Kelly Criterion framework. Always provide complete, structured analysis. Use the most recent market data available and indicate data freshness in your analysis."
+
+// AssessmentService generates single-stock LLM assessments and persists them. The assessment handler
+// and the scheduler's per-stock re-assessments share it.
+type AssessmentService struct {
+	db        *gorm.DB
+	cfg       *config.Config
+	logger    zerolog.Logger
+	client    *http.Client
+	Providers map[string]LLMProvider // Per-source overrides ("grok", "deepseek", "claude"); others are built from cfg
+}
+
+// NewAssessmentService creates an assessment service whose LLM calls go through a rate-limited client.
+func NewAssessmentService(db *gorm.DB, cfg *config.Config, logger zerolog.Logger) *AssessmentService {
+	return &AssessmentService{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+		client: &http.Client{
+			Timeout:   120 * time.Second, // Longer timeout for AI analysis
+			Transport: NewRateLimitedTransport(nil),
+		},
+	}
+}
+
+// Client returns the rate-limited HTTP client the service's LLM providers use.
+func (s *AssessmentService) Client() *http.Client {
+	return s.client
+}
+
+// Provider returns the override for source ("grok", "deepseek" or "claude") if one is set, otherwise
+// a provider built from cfg on the service's client. Any other source falls back to Grok.
+func (s *AssessmentService) Provider(source string) LLMProvider {
+	if provider, ok := s.Providers[source]; ok {
+		return provider
+	}
+	switch source {
+	case "deepseek":
+		return NewDeepseekProvider(s.cfg, config.UseCaseAssessment, s.client)
+	case "claude":
+		return NewClaudeProvider(s.cfg, config.UseCaseAssessment, s.client)
+	}
+	return NewGrokProvider(s.cfg, config.UseCaseAssessment, s.client)
+}
+
+// Generate builds the assessment prompt with portfolio context and completes it with provider.
+func (s *AssessmentService) Generate(provider LLMProvider, portfolioID uint, ticker, isin, companyName string, currentPrice float64, currency string, rebalanceHint, concentrationHint, suggestedActionsHint string, stockData *models.Stock) (string, error) {
+	// Fetch portfolio data for context
+	portfolioData, cashData, err := s.PortfolioContext()
+	if err != nil {
+		s.logger.Warn().Err(err).Msg("Failed to fetch portfolio context, continuing without it")
+	}
+
+	// Create the comprehensive prompt based on your strategy (includes dashboard hints when provided)
+	prompt := s.BuildPrompt(portfolioID, ticker, isin, companyName, currentPrice, currency, portfolioData, cashData, rebalanceHint, concentrationHint, suggestedActionsHint, stockData)
+
+	ctx := WithProviderCallInfo(context.Background(), ticker, config.UseCaseAssessment)
+	choices, err := CompleteChoices(ctx, provider, AssessmentSystemPrompt, prompt, s.cfg.AssessmentLLMChoices)
+	if err != nil {
+		return "", err
+	}
+	return MostConservativeAssessment(choices), nil
+}
+
+// scheduledAssessmentSources are the sources SCHEDULED_ASSESSMENT_SOURCE may name; each goes through
+// Provider, so the service's rate-limited client and the provider call ledger apply.
+var scheduledAssessmentSources = map[string]struct{}{"grok": {}, "deepseek": {}, "claude": {}}
+
+// ScheduledSource returns the normalized SCHEDULED_ASSESSMENT_SOURCE that AssessStock generates with.
+func (s *AssessmentService) ScheduledSource() string {
+	return strings.ToLower(strings.TrimSpace(s.cfg.ScheduledAssessmentSource))
+}
+
+// AssessStock generates an assessment of stock with SCHEDULED_ASSESSMENT_SOURCE, anchored on the
+// stored stock data, and persists it as the latest assessment for the stock's ticker and source,
+// linked to the stock, then regenerates the ticker's assessment diff. It is the scheduler's entry
+// point for per-stock re-assessments.
+func (s *AssessmentService) AssessStock(stock *models.Stock) (models.Assessment, error) {
+	source := s.ScheduledSource()
+	if _, ok := scheduledAssessmentSources[source]; !ok {
+		return models.Assessment{}, fmt.Errorf("unsupported scheduled assessment source %q: use grok, deepseek or claude", source)
+	}
+
+	text, err := s.Generate(s.Provider(source), stock.PortfolioID, stock.Ticker, stock.ISIN, stock.CompanyName, stock.CurrentPrice, stock.Currency, "", "", "", stock)
+	if err != nil {
+		return models.Assessment{}, err
+	}
+	if err := s.Upsert(stock.PortfolioID, stock.Ticker, source, text); err != nil {
+		return models.Assessment{}, fmt.Errorf("failed to persist assessment: %w", err)
+	}
+
+	var record models.Assessment
+	if err := s.db.Where("portfolio_id = ? AND ticker = ? AND source = ?", stock.PortfolioID, strings.ToUpper(strings.TrimSpace(stock.Ticker)), source).
+		First(&record).Error; err != nil {
+		return models.Assessment{}, fmt.Errorf("failed to load persisted assessment: %w", err)
+	}
+	if err := s.db.Model(&record).Update("stock_id", stock.ID).Error; err != nil {
+		return models.Assessment{}, fmt.Errorf("failed to link assessment to stock: %w", err)
+	}
+	record.StockID = &stock.ID
+	if err := s.RegenerateAssessmentDiff(stock.PortfolioID, stock.Ticker); err != nil {
+		s.logger.Warn().Err(err).Str("ticker", stock.Ticker).Msg("Failed to regenerate assessment diff after scheduled assessment")
+	}
+	s.CleanupOld()
+	return record, nil
+}
+
+// Upsert stores text as the latest completed assessment for the portfolio's ticker and source, with
+// EV, ½-Kelly and recommendation parsed from its Final Assessment section.
+func (s *AssessmentService) Upsert(portfolioID uint, ticker, source, text string) error {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	source = strings.ToLower(strings.TrimSpace(source))
+	// Parsed fields stay null when the text has no recognizable Final Assessment section.
+	expectedValue, halfKelly, recommendation := ParseFinalAssessment(text)
+
+	var existing models.Assessment
+	err := s.db.Where("portfolio_id = ? AND ticker = ? AND source = ?", portfolioID, ticker, source).First(&existing).Error
+	if err == nil {
+		if updateErr := s.db.Model(&existing).Updates(map[string]interface{}{
+			"assessment":     text,
+			"status":         "completed",
+			"expected_value": expectedValue,
+			"half_kelly":     halfKelly,
+			"recommendation": recommendation,
+			"stock_id":       nil, // On-demand text replaces a scheduled one; AssessStock re-links its own
+			"updated_at":     time.Now(),
+		}).Error; updateErr != nil {
+			return updateErr
+		}
+		// Clean up any legacy duplicates from older behavior.
+		return s.db.Where("portfolio_id = ? AND ticker = ? AND source = ? AND id <> ?", portfolioID, ticker, source, existing.ID).Delete(&models.Assessment{}).Error
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	record := models.Assessment{
+		PortfolioID:    portfolioID,
+		Ticker:         ticker,
+		Source:         source,
+		Assessment:     text,
+		Status:         "completed",
+		ExpectedValue:  expectedValue,
+		HalfKelly:      halfKelly,
+		Recommendation: recommendation,
+		CreatedAt:      time.Now(),
+	}
+	return s.db.Create(&record).Error
+}
+
+// maxStoredAssessments is how many assessments CleanupOld keeps across all portfolios.
+const maxStoredAssessments = 100
+
+// CleanupOld keeps at most maxStoredAssessments; deletes oldest first.
+func (s *AssessmentService) CleanupOld() {
+	var count int64
+	if err := s.db.Model(&models.Assessment{}).Count(&count).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count assessments")
+		return
+	}
+	if count <= maxStoredAssessments {
+		return
+	}
+	var idsToDelete []uint
+	if err := s.db.Model(&models.Assessment{}).
+		Select("id").
+		Order("created_at ASC").
+		Limit(int(count-maxStoredAssessments)).
+		Pluck("id", &idsToDelete).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to get assessment IDs for cleanup")
+		return
+	}
+	if len(idsToDelete) == 0 {
+		return
+	}
+	if err := s.db.Where("id IN ?", idsToDelete).Delete(&models.Assessment{}).Error; err != nil {
+		s.logger.Error().Err(err).Msg("Failed to delete old assessments")
+	} else {
+		s.logger.Info().Int("deleted", len(idsToDelete)).Int("remaining", maxStoredAssessments).Msg("Cleaned up old assessments")
+	}
+}
+
+// PortfolioContext retrieves current portfolio and cash data for assessment context (all portfolios).
+func (s *AssessmentService) PortfolioContext() ([]models.Stock, []models.CashHolding, error) {
+	var portfolioStocks []models.Stock
+	if err := s.db.Where("shares_owned > 0").Find(&portfolioStocks).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch portfolio stocks: %w", err)
+	}
+	var cashHoldings []models.CashHolding
+	if err := s.db.Find(&cashHoldings).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch cash holdings: %w", err)
+	}
+	return portfolioStocks, cashHoldings, nil
+}
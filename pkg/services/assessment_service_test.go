@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAssessStockPersistsAndLinksScheduledAssessment(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-service-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.UserSettings{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	stock := models.Stock{PortfolioID: 1, Ticker: "acme", CompanyName: "Acme Corp", CurrentPrice: 100, Currency: "USD"}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+
+	service := NewAssessmentService(db, &config.Config{ScheduledAssessmentSource: "Grok"}, zerolog.Nop())
+	service.Providers = map[string]LLMProvider{"grok": staticLLMProvider("## Final Assessment\nEV: +8.5%\n½-Kelly: 4%\nAssessment: Add")}
+
+	record, err := service.AssessStock(&stock)
+	if err != nil {
+		t.Fatalf("AssessStock: %v", err)
+	}
+	if record.Ticker != "ACME" || record.Source != "grok" || record.StockID == nil || *record.StockID != stock.ID {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	if record.Recommendation == nil || *record.Recommendation != "Add" {
+		t.Fatalf("recommendation: got %v want Add", record.Recommendation)
+	}
+
+	var stored models.Assessment
+	if err := db.Where("portfolio_id = ? AND ticker = ?", 1, "ACME").First(&stored).Error; err != nil {
+		t.Fatalf("load assessment: %v", err)
+	}
+	if stored.StockID == nil || *stored.StockID != stock.ID || !strings.Contains(stored.Assessment, "Final Assessment") {
+		t.Fatalf("assessment not persisted and linked: %+v", stored)
+	}
+
+	// An on-demand assessment replacing the scheduled one is no longer linked to the stock.
+	if err := service.Upsert(1, "acme", "grok", "EV: 5%"); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if err := db.First(&stored, stored.ID).Error; err != nil {
+		t.Fatalf("reload assessment: %v", err)
+	}
+	if stored.StockID != nil {
+		t.Fatalf("expected stock_id cleared by the on-demand upsert, got %d", *stored.StockID)
+	}
+
+	service.cfg.ScheduledAssessmentSource = "perplexity"
+	if _, err := service.AssessStock(&stock); err == nil {
+		t.Fatal("expected an error for a source outside grok, deepseek and claude")
+	}
+}
+
+// extractingLLMProvider answers the diff extraction prompt with extraction and anything else with assessment.
+type extractingLLMProvider struct {
+	assessment, extraction string
+}
+
+func (p extractingLLMProvider) Complete(_ context.Context, systemPrompt, _ string) (string, error) {
+	if strings.Contains(systemPrompt, "data extraction") {
+		return p.extraction, nil
+	}
+	return p.assessment, nil
+}
+
+func TestAssessStockRegeneratesAssessmentDiff(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "assessment-diff-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Portfolio{}, &models.Stock{}, &models.CashHolding{}, &models.Assessment{}, &models.AssessmentDiff{}, &models.UserSettings{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	stock := models.Stock{PortfolioID: 1, Ticker: "ACME", CompanyName: "Acme Corp", CurrentPrice: 100, Currency: "USD"}
+	if err := db.Create(&stock).Error; err != nil {
+		t.Fatalf("create stock: %v", err)
+	}
+	for _, source := range []string{"deepseek", "claude"} {
+		if err := db.Create(&models.Assessment{PortfolioID: 1, Ticker: "ACME", Source: source, Assessment: source + " assessment", Status: "completed"}).Error; err != nil {
+			t.Fatalf("create %s assessment: %v", source, err)
+		}
+	}
+
+	service := NewAssessmentService(db, &config.Config{ScheduledAssessmentSource: "grok", XAIAPIKey: "test-key"}, zerolog.Nop())
+	service.Providers = map[string]LLMProvider{"grok": extractingLLMProvider{
+		assessment: "## Final Assessment\nAssessment: Add",
+		extraction: `{"grok":{"final_assessment":"ADD"},"deepseek":{"final_assessment":"HOLD"},"claude":{"final_assessment":"SELL"}}`,
+	}}
+	if _, err := service.AssessStock(&stock); err != nil {
+		t.Fatalf("AssessStock: %v", err)
+	}
+
+	var diff models.AssessmentDiff
+	if err := db.Where("ticker = ?", "ACME").First(&diff).Error; err != nil {
+		t.Fatalf("expected a regenerated diff: %v", err)
+	}
+	var rows []AssessmentCompareRow
+	if err := json.Unmarshal([]byte(diff.RowsJSON), &rows); err != nil {
+		t.Fatalf("decode diff rows: %v", err)
+	}
+	final := rows[len(rows)-1]
+	if final.Key != "final_assessment" || final.Grok != "ADD" || final.Deepseek != "HOLD" || final.Claude != "SELL" {
+		t.Fatalf("final assessment row: got %+v", final)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// AverageDownMinProbability is the probability of a positive outcome a stock must keep (strictly
+// above) before averaging down: "only average down if EV increases and probability remains >55%".
+const AverageDownMinProbability = 0.55
+
+// AverageDownCheck is the averaging-down rule evaluated for a stock at a hypothetical lower price.
+type AverageDownCheck struct {
+	Ticker              string   `json:"ticker"`
+	CurrentPrice        float64  `json:"current_price"`
+	NewPrice            float64  `json:"new_price"`
+	CurrentEV           float64  `json:"current_ev"` // EV (%) recomputed at the current price
+	NewEV               float64  `json:"new_ev"`     // EV (%) at NewPrice
+	ProbabilityPositive float64  `json:"probability_positive"`
+	Eligible            bool     `json:"eligible"`
+	Reasons             []string `json:"reasons"` // Why the rule fails; empty when eligible
+}
+
+// EvaluateAverageDown recomputes the stock's EV at its current price and at newPrice with the portfolio's
+// cfg and checks the averaging-down rule: the new price is lower, the new EV exceeds the
+// current EV and the probability is above AverageDownMinProbability. The stock is not modified.
+func EvaluateAverageDown(stock models.Stock, newPrice float64, cfg MetricsConfig) AverageDownCheck {
+	current := stock
+	CalculateMetrics(&current, cfg)
+	lower := stock
+	lower.CurrentPrice = newPrice
+	CalculateMetrics(&lower, cfg)
+
+	check := AverageDownCheck{
+		Ticker:              stock.Ticker,
+		CurrentPrice:        stock.CurrentPrice,
+		NewPrice:            newPrice,
+		CurrentEV:           current.ExpectedValue,
+		NewEV:               lower.ExpectedValue,
+		ProbabilityPositive: current.ProbabilityPositive,
+		Reasons:             []string{},
+	}
+	if newPrice >= stock.CurrentPrice {
+		check.Reasons = append(check.Reasons, fmt.Sprintf("price %.2f is not below the current price %.2f", newPrice, stock.CurrentPrice))
+	}
+	if check.NewEV <= check.CurrentEV {
+		check.Reasons = append(check.Reasons, fmt.Sprintf("EV would not increase (%.2f%% -> %.2f%%)", check.CurrentEV, check.NewEV))
+	}
+	if check.ProbabilityPositive <= AverageDownMinProbability {
+		check.Reasons = append(check.Reasons, fmt.Sprintf("probability %.2f is not above %.2f", check.ProbabilityPositive, AverageDownMinProbability))
+	}
+	check.Eligible = len(check.Reasons) == 0
+	return check
+}
+
+// ShouldAverageDown reports whether buying more of stock at newPrice satisfies the averaging-down
+// rule (see EvaluateAverageDown).
+func ShouldAverageDown(stock models.Stock, newPrice float64, cfg MetricsConfig) bool {
+	return EvaluateAverageDown(stock, newPrice, cfg).Eligible
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestShouldAverageDownRequiresHigherEVAndProbabilityAbove55(t *testing.T) {
+	t.Parallel()
+	base := models.Stock{Ticker: "ACME", CurrentPrice: 100, FairValue: 130, ProbabilityPositive: 0.65, DownsideRisk: -20}
+
+	// At 90 the upside grows from 30% to 44.4%: EV 0.65*44.44 - 0.35*20 = 21.9 > 12.5.
+	check := EvaluateAverageDown(base, 90, DefaultMetricsConfig())
+	assertClose(t, check.CurrentEV, 12.5, 0.0001, "CurrentEV")
+	assertClose(t, check.NewEV, 0.65*(130.0/90-1)*100-0.35*20, 0.0001, "NewEV")
+	if !check.Eligible || len(check.Reasons) != 0 || !ShouldAverageDown(base, 90, DefaultMetricsConfig()) {
+		t.Fatalf("expected eligible at 90, got %+v", check)
+	}
+	if base.ExpectedValue != 0 || base.CurrentPrice != 100 {
+		t.Errorf("stock was modified: %+v", base)
+	}
+
+	lowProbability := base
+	lowProbability.ProbabilityPositive = 0.55
+	if ShouldAverageDown(lowProbability, 90, DefaultMetricsConfig()) {
+		t.Error("expected probability 0.55 (not above 0.55) to block averaging down")
+	}
+	if check := EvaluateAverageDown(base, 105, DefaultMetricsConfig()); check.Eligible || len(check.Reasons) != 2 {
+		t.Errorf("expected a higher price to fail on price and EV, got %+v", check)
+	}
+}
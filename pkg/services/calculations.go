@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"math"
+	"strings"
 
 	"github.com/art-pro/stock-backend/pkg/models"
 )
@@ -11,8 +12,17 @@ const (
 	defaultProbabilityPositive = 0.65
 	riskFreeRatePercent        = 4.0
 	minDownsideMagnitude       = 0.1
+	defaultProbabilityBand     = 0.1
+	maxProbabilityBand         = 0.5
+	defaultMaxBuyZoneDownside  = 10.0
+	defaultMinRatioPositions   = 2
+	defaultBenchmarkReturn     = 8.0 // Long-run equity index return (%) used by benchmark-relative EV
 )
 
+// BuyZoneElevatedRisk is the buy-zone status of a stock whose price and EV qualify but whose
+// downside risk exceeds the cap: the strategy's optimal zone is EV > 7% AND downside risk < 10%.
+const BuyZoneElevatedRisk = "elevated risk — outside optimal zone"
+
 func calibrateDownsideRisk(beta float64) float64 {
 	if beta < 0.5 {
 		return -15.0
@@ -26,9 +36,33 @@ func calibrateDownsideRisk(beta float64) float64 {
 	return -30.0
 }
 
-// CalculateMetrics calculates all derived metrics for a stock
+// CalculateMetrics calculates all derived metrics for a stock using cfg (normally its portfolio's,
+// see PortfolioMetricsConfig), plus shadow results when cfg carries the portfolio's shadow config.
 // These formulas implement the investment strategy's Kelly criterion and EV approach
-func CalculateMetrics(stock *models.Stock) {
+func CalculateMetrics(stock *models.Stock, cfg MetricsConfig) {
+	CalculateMetricsWithShadow(stock, cfg, cfg.Shadow())
+}
+
+// CalculateMetricsWithShadow computes live metrics with cfg and, when shadow is non-nil, the
+// alternate results into the Shadow* fields without affecting live fields. A nil shadow clears them.
+func CalculateMetricsWithShadow(stock *models.Stock, cfg MetricsConfig, shadow *MetricsConfig) {
+	if shadow != nil {
+		// Work on a copy of the inputs before the live pass fills defaults (e.g. probability).
+		alternate := *stock
+		CalculateMetricsWithConfig(&alternate, *shadow)
+		stock.ShadowExpectedValue = alternate.ExpectedValue
+		stock.ShadowHalfKelly = alternate.HalfKellySuggested
+		stock.ShadowAssessment = alternate.Assessment
+	} else {
+		stock.ShadowExpectedValue = 0
+		stock.ShadowHalfKelly = 0
+		stock.ShadowAssessment = ""
+	}
+	CalculateMetricsWithConfig(stock, cfg)
+}
+
+// CalculateMetricsWithConfig calculates all derived metrics for a stock using explicit thresholds.
+func CalculateMetricsWithConfig(stock *models.Stock, cfg MetricsConfig) {
 	// 1. Calibrate downside risk based on beta, unless explicitly provided.
 	if stock.DownsideRisk == 0 {
 		if stock.Beta > 0 {
@@ -45,21 +79,38 @@ func CalculateMetrics(stock *models.Stock) {
 		stock.UpsidePotential = 0
 	}
 
-	// 3. Use conservative default probability when missing/invalid.
+	// 2b. Max drawdown estimate: a 1.65σ one-sided move (95% confidence), floored at the calibrated
+	// downside; with no volatility it is the downside alone.
+	stock.MaxDrawdownEstimate = EstimateMaxDrawdown(stock.Volatility, stock.DownsideRisk)
+
+	// 3. Use conservative default probability (0.65 unless configured) when missing/invalid.
 	if stock.ProbabilityPositive <= 0 || stock.ProbabilityPositive > 1 {
-		stock.ProbabilityPositive = defaultProbabilityPositive
+		stock.ProbabilityPositive = cfg.DefaultProbability
+		if stock.ProbabilityPositive <= 0 || stock.ProbabilityPositive > 1 {
+			stock.ProbabilityPositive = defaultProbabilityPositive
+		}
 	}
 
+	// In benchmark-relative mode both scenarios are measured as excess return over the benchmark,
+	// so EV, b and Kelly describe alpha; UpsidePotential and DownsideRisk stay absolute.
+	offset := cfg.evOffset()
+	upside := stock.UpsidePotential - offset
+	downside := stock.DownsideRisk - offset
+
 	// 4. b Ratio = Upside % / |Downside %| with a small floor on downside.
-	downsideMagnitude := math.Abs(stock.DownsideRisk)
+	downsideMagnitude := math.Abs(downside)
 	if downsideMagnitude < minDownsideMagnitude {
 		downsideMagnitude = minDownsideMagnitude
 	}
-	stock.BRatio = stock.UpsidePotential / downsideMagnitude
+	stock.BRatio = upside / downsideMagnitude
 
 	// 5. Expected Value (EV) = (p * Upside %) + ((1 - p) * Downside %)
-	stock.ExpectedValue = (stock.ProbabilityPositive * stock.UpsidePotential) +
-		((1 - stock.ProbabilityPositive) * stock.DownsideRisk)
+	stock.ExpectedValue = (stock.ProbabilityPositive * upside) +
+		((1 - stock.ProbabilityPositive) * downside)
+
+	// 5b. EV interval across the probability band, showing how sensitive EV is to the p estimate.
+	stock.EVLow, stock.EVMid, stock.EVHigh = ExpectedValueInterval(stock, cfg.ProbabilityBand)
+	stock.EVLow, stock.EVMid, stock.EVHigh = stock.EVLow-offset, stock.EVMid-offset, stock.EVHigh-offset
 
 	// 6. Kelly f* = ((b * p) - (1 - p)) / b, expressed in percent and clamped at 0.
 	if stock.BRatio > 0 {
@@ -71,26 +122,26 @@ func CalculateMetrics(stock *models.Stock) {
 		stock.KellyFraction = 0
 	}
 
-	// 7. Half-Kelly suggested weight, capped at 15%.
-	stock.HalfKellySuggested = stock.KellyFraction / 2
-	if stock.HalfKellySuggested > 15 {
-		stock.HalfKellySuggested = 15
+	// 7. Scaled-Kelly suggested weight (½-Kelly by default), capped at KellyCap (15% by default).
+	stock.HalfKellySuggested = stock.KellyFraction * cfg.KellyScale
+	if stock.HalfKellySuggested > cfg.KellyCap {
+		stock.HalfKellySuggested = cfg.KellyCap
 	}
 
-	// 8. Assessment thresholds under a conservative EV policy.
-	if stock.ExpectedValue > 7 {
+	// 8. Assessment thresholds under a conservative EV policy (Add > 7%, Hold 3–7%, Trim 0–3% by default).
+	if stock.ExpectedValue > cfg.AddThreshold {
 		stock.Assessment = "Add"
-	} else if stock.ExpectedValue >= 3 && stock.ExpectedValue <= 7 {
+	} else if stock.ExpectedValue >= cfg.TrimThreshold {
 		stock.Assessment = "Hold"
-	} else if stock.ExpectedValue >= 0 && stock.ExpectedValue < 3 {
+	} else if stock.ExpectedValue >= cfg.SellThreshold {
 		stock.Assessment = "Trim"
 	} else {
 		stock.Assessment = "Sell"
 	}
 
-	// 9. Buy zone uses EV >= 7% entry threshold.
+	// 9. Buy zone uses the Add threshold (EV >= 7% by default) as entry.
 	if stock.FairValue > 0 && stock.ProbabilityPositive > 0 {
-		targetEV := 7.0
+		targetEV := cfg.AddThreshold + offset // Absolute EV at which the (relative) Add threshold is met
 		requiredUpside := (targetEV - (1-stock.ProbabilityPositive)*stock.DownsideRisk) / stock.ProbabilityPositive
 
 		if requiredUpside > -100 {
@@ -111,6 +162,9 @@ func CalculateMetrics(stock *models.Stock) {
 			default:
 				stock.BuyZoneStatus = "outside buy zone"
 			}
+			if stock.BuyZoneStatus != "outside buy zone" && exceedsBuyZoneDownside(stock.DownsideRisk, cfg.MaxBuyZoneDownside) {
+				stock.BuyZoneStatus = BuyZoneElevatedRisk
+			}
 		} else {
 			stock.BuyZoneMin = 0
 			stock.BuyZoneMax = 0
@@ -123,17 +177,17 @@ func CalculateMetrics(stock *models.Stock) {
 	}
 
 	// 10. Sell zone thresholds:
-	// - lower bound: EV = 3% (trim zone start)
-	// - upper bound: EV = 0% (sell zone start)
-	sellLowerBound, okTrim := solvePriceForEVThreshold(stock.FairValue, stock.ProbabilityPositive, stock.DownsideRisk, 3)
-	sellUpperBound, okSell := solvePriceForEVThreshold(stock.FairValue, stock.ProbabilityPositive, stock.DownsideRisk, 0)
+	// - lower bound: EV = TrimThreshold (trim zone start, 3% by default)
+	// - upper bound: EV = SellThreshold (sell zone start, 0% by default)
+	sellLowerBound, okTrim := solvePriceForEVThreshold(stock.FairValue, stock.ProbabilityPositive, stock.DownsideRisk, cfg.TrimThreshold+offset)
+	sellUpperBound, okSell := solvePriceForEVThreshold(stock.FairValue, stock.ProbabilityPositive, stock.DownsideRisk, cfg.SellThreshold+offset)
 	if okTrim && okSell && sellLowerBound < sellUpperBound {
 		stock.SellZoneLowerBound = sellLowerBound
 		stock.SellZoneUpperBound = sellUpperBound
 		switch {
-		case stock.ExpectedValue > 3:
+		case stock.ExpectedValue > cfg.TrimThreshold:
 			stock.SellZoneStatus = "Below sell zone"
-		case stock.ExpectedValue > 0:
+		case stock.ExpectedValue > cfg.SellThreshold:
 			stock.SellZoneStatus = "In trim zone"
 		default:
 			stock.SellZoneStatus = "In sell zone"
@@ -143,12 +197,95 @@ func CalculateMetrics(stock *models.Stock) {
 		stock.SellZoneUpperBound = 0
 		stock.SellZoneStatus = "no sell zone"
 	}
+
+	// 11. Derived triage tags from the assessment band and buy-zone status.
+	stock.DerivedTags = strings.Join(deriveTags(stock), ",")
+}
+
+// Derived tags set by CalculateMetrics. They are recomputed on every metrics refresh
+// and kept separate from user-editable Stock.Tags.
+const (
+	TagAddCandidate  = "add-candidate"
+	TagHold          = "hold"
+	TagTrimCandidate = "trim-candidate"
+	TagSellCandidate = "sell-candidate"
+	TagInBuyZone     = "in-buy-zone"
+	TagBelowBuyZone  = "below-buy-zone"
+)
+
+func deriveTags(stock *models.Stock) []string {
+	var tags []string
+	switch stock.Assessment {
+	case "Add":
+		tags = append(tags, TagAddCandidate)
+	case "Hold":
+		tags = append(tags, TagHold)
+	case "Trim":
+		tags = append(tags, TagTrimCandidate)
+	case "Sell":
+		tags = append(tags, TagSellCandidate)
+	}
+	switch stock.BuyZoneStatus {
+	case "within buy zone":
+		tags = append(tags, TagInBuyZone)
+	case "EV >> 15%":
+		tags = append(tags, TagBelowBuyZone)
+	}
+	return tags
+}
+
+// maxDrawdownSigmas is the one-sided 95% z-score used for the max drawdown estimate.
+const maxDrawdownSigmas = 1.65
+
+// EstimateMaxDrawdown returns the drawdown (%, negative) a position should be expected to sit
+// through: the larger of a 1.65σ one-sided move and |downsideRisk|.
+func EstimateMaxDrawdown(volatility, downsideRisk float64) float64 {
+	return -math.Max(maxDrawdownSigmas*math.Max(volatility, 0), math.Abs(downsideRisk))
 }
 
-// CalculatePortfolioMetrics calculates portfolio-level metrics
-func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64) PortfolioMetrics {
-	var totalValue float64
+// ExpectedValueInterval returns EV (%) at p - band, p and p + band using the stock's computed
+// upside and downside, with the band ends clamped to [0, 1]. Low <= mid <= high whenever upside
+// exceeds downside; otherwise the ends swap, since a higher p then lowers EV.
+func ExpectedValueInterval(stock *models.Stock, band float64) (low, mid, high float64) {
+	evAt := func(p float64) float64 {
+		p = math.Max(0, math.Min(1, p))
+		return p*stock.UpsidePotential + (1-p)*stock.DownsideRisk
+	}
+	band = math.Abs(band)
+	return evAt(stock.ProbabilityPositive - band), evAt(stock.ProbabilityPositive), evAt(stock.ProbabilityPositive + band)
+}
+
+// BaseCurrencyRate returns units of base per 1 EUR from fxRates (1 for EUR or an empty base) and
+// whether the rate is usable.
+func BaseCurrencyRate(fxRates map[string]float64, base string) (float64, bool) {
+	base = strings.ToUpper(strings.TrimSpace(base))
+	if base == "" || base == "EUR" {
+		return 1, true
+	}
+	rate := fxRates[base]
+	return rate, rate > 0
+}
+
+// CalculatePortfolioMetrics calculates portfolio-level metrics with values in baseCurrency under the
+// portfolio's cfg, assuming cfg.AssumedCorrelation between every pair of positions.
+// Without a usable rate for baseCurrency the metrics are reported in EUR (see BaseCurrency).
+func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64, baseCurrency string, cfg MetricsConfig) PortfolioMetrics {
+	return CalculatePortfolioMetricsWithCorrelations(stocks, fxRates, baseCurrency, CorrelationMatrix{Default: cfg.AssumedCorrelation}, cfg)
+}
+
+// CalculatePortfolioMetricsWithCorrelations is CalculatePortfolioMetrics with pairwise return
+// correlations for the portfolio volatility (WeightedVolatility).
+func CalculatePortfolioMetricsWithCorrelations(stocks []models.Stock, fxRates map[string]float64, baseCurrency string, correlations CorrelationMatrix, cfg MetricsConfig) PortfolioMetrics {
+	baseCurrency = strings.ToUpper(strings.TrimSpace(baseCurrency))
+	baseRate, ok := BaseCurrencyRate(fxRates, baseCurrency)
+	if !ok || baseCurrency == "" {
+		baseCurrency, baseRate = "EUR", 1
+	}
+
+	var totalValue, excludedValue float64
 	stockValues := make([]float64, len(stocks))
+	excluded := make([]bool, len(stocks))
+	var dust []DustPosition
 
 	// First pass: Calculate total portfolio value
 	for i, stock := range stocks {
@@ -157,22 +294,38 @@ func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64
 			continue
 		}
 
-		// Convert position value to EUR (rates are stored as currency per 1 EUR).
+		// Convert position value to the base currency via EUR (rates are stored as currency per 1 EUR).
 		fxRate := fxRates[stock.Currency]
 		if fxRate <= 0 {
 			continue
 		}
 
 		valueEUR := float64(stock.SharesOwned) * stock.CurrentPrice / fxRate
-		stockValues[i] = valueEUR
-		totalValue += valueEUR
+		value := valueEUR * baseRate
+		stockValues[i] = value
+		totalValue += value
+
+		if cfg.MinPositionValue > 0 && valueEUR > 0 && valueEUR < cfg.MinPositionValue {
+			dust = append(dust, newDustPosition(stock, value, valueEUR, cfg))
+			if cfg.ExcludeDust {
+				excluded[i] = true
+				excludedValue += value
+			}
+		}
+	}
+	weightedValue := totalValue - excludedValue
+	for i := range dust {
+		dust[i].WeightPct = dust[i].Value / totalValue * 100
 	}
 
 	// Second pass: Calculate weighted metrics with correct total
-	var weightedEV float64
-	var weightedVolatility float64
+	var weightedEV, weightedEVLow, weightedEVHigh float64
+	var naiveVolatility, weightedMaxDrawdown float64
+	var weights, volatilities []float64
+	var tickers []string
 	sectorWeights := make(map[string]float64)
 	kellyUtilization := 0.0
+	valuedPositions := 0
 
 	for i, stock := range stocks {
 		// Skip stocks with no shares owned
@@ -180,10 +333,22 @@ func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64
 			continue
 		}
 
-		if totalValue > 0 && stockValues[i] > 0 {
-			weight := stockValues[i] / totalValue
+		if weightedValue > 0 && stockValues[i] > 0 && !excluded[i] {
+			weight := stockValues[i] / weightedValue
 			weightedEV += stock.ExpectedValue * weight
-			weightedVolatility += stock.Volatility * weight
+			weightedEVLow += stock.EVLow * weight
+			weightedEVHigh += stock.EVHigh * weight
+			naiveVolatility += stock.Volatility * weight
+			drawdown := stock.MaxDrawdownEstimate
+			if drawdown == 0 {
+				// Row saved before the estimate existed
+				drawdown = EstimateMaxDrawdown(stock.Volatility, stock.DownsideRisk)
+			}
+			weightedMaxDrawdown += drawdown * weight
+			weights = append(weights, weight)
+			volatilities = append(volatilities, stock.Volatility)
+			tickers = append(tickers, stock.Ticker)
+			valuedPositions++
 
 			// Accumulate sector weights (fractions 0–1; see DATA_CONTRACT.md)
 			sectorWeights[stock.Sector] += weight
@@ -193,32 +358,65 @@ func CalculatePortfolioMetrics(stocks []models.Stock, fxRates map[string]float64
 		}
 	}
 
-	// Sharpe Ratio = (Rp - Rf) / sigma, using weighted EV as Rp proxy.
-	sharpeRatio := 0.0
-	if weightedVolatility > 0 {
-		sharpeRatio = (weightedEV - riskFreeRatePercent) / weightedVolatility
-	}
+	weightedVolatility := PortfolioVolatility(weights, volatilities, tickers, correlations)
+	sharpe, sharpeReason := SharpeRatio(weightedEV, weightedVolatility, valuedPositions, cfg.MinRatioPositions)
 
 	return PortfolioMetrics{
-		TotalValue:         totalValue,
-		OverallEV:          weightedEV,
-		WeightedVolatility: weightedVolatility,
-		SharpeRatio:        sharpeRatio,
-		KellyUtilization:   kellyUtilization,
-		SectorWeights:      sectorWeights,
-		RealizedPnL:        0, // Set by handler from operations (FIFO)
+		BaseCurrency:        baseCurrency,
+		TotalValue:          totalValue,
+		OverallEV:           weightedEV,
+		OverallEVLow:        weightedEVLow,
+		OverallEVHigh:       weightedEVHigh,
+		WeightedVolatility:  weightedVolatility,
+		NaiveVolatility:     naiveVolatility,
+		MaxDrawdownEstimate: weightedMaxDrawdown,
+		SharpeRatio:         sharpe,
+		SharpeUnavailable:   sharpeReason,
+		ValuedPositions:     valuedPositions,
+		KellyUtilization:    kellyUtilization,
+		SectorWeights:       sectorWeights,
+		DustPositions:       dust,
+		RealizedPnL:         0, // Set by handler from operations (FIFO)
 	}
 }
 
+// SharpeRatio returns (weightedEV - Rf) / weightedVolatility, using weighted EV as the return proxy.
+// It returns nil and the reason when the ratio would be misleading: zero weighted volatility or
+// fewer than minPositions valued positions.
+func SharpeRatio(weightedEV, weightedVolatility float64, valuedPositions, minPositions int) (*float64, string) {
+	switch {
+	case valuedPositions < minPositions:
+		return nil, fmt.Sprintf("insufficient data: %d valued positions, at least %d required", valuedPositions, minPositions)
+	case weightedVolatility <= 0:
+		return nil, "insufficient data: weighted volatility is zero"
+	}
+	ratio := (weightedEV - riskFreeRatePercent) / weightedVolatility
+	return &ratio, ""
+}
+
 // PortfolioMetrics holds portfolio-level aggregated metrics
 type PortfolioMetrics struct {
-	TotalValue         float64            `json:"total_value"`
-	OverallEV          float64            `json:"overall_ev"`
-	WeightedVolatility float64            `json:"weighted_volatility"`
-	SharpeRatio        float64            `json:"sharpe_ratio"`
-	KellyUtilization   float64            `json:"kelly_utilization"`
-	SectorWeights      map[string]float64 `json:"sector_weights"`
-	RealizedPnL        float64            `json:"realized_pnl"` // Lifetime realized PnL from closed trades (FIFO), in base currency (EUR)
+	BaseCurrency          string              `json:"base_currency"` // Currency of TotalValue and RealizedPnL
+	TotalValue            float64             `json:"total_value"`
+	OverallEV             float64             `json:"overall_ev"`
+	OverallEVLow          float64             `json:"overall_ev_low"`               // Value-weighted EV at the low end of each stock's probability band
+	OverallEVHigh         float64             `json:"overall_ev_high"`              // Value-weighted EV at the high end of each stock's probability band
+	WeightedVolatility    float64             `json:"weighted_volatility"`          // Portfolio volatility sqrt(w'Σw) over pairwise correlations
+	NaiveVolatility       float64             `json:"naive_volatility"`             // Linear sum of weight * volatility (every pair perfectly correlated)
+	MaxDrawdownEstimate   float64             `json:"max_drawdown_estimate"`        // Value-weighted per-stock max drawdown estimate (%, negative)
+	SharpeRatio           *float64            `json:"sharpe_ratio"`                 // Nil when there is too little data (see SharpeUnavailable)
+	SharpeUnavailable     string              `json:"sharpe_unavailable,omitempty"` // Why SharpeRatio is nil
+	ValuedPositions       int                 `json:"valued_positions"`             // Held positions with a price and exchange rate
+	KellyUtilization      float64             `json:"kelly_utilization"`
+	SectorWeights         map[string]float64  `json:"sector_weights"`
+	SectorTargetDeviation map[string]float64  `json:"sector_target_deviation,omitempty"` // Set by handler: fraction outside each configured sector target range (negative = under)
+	SectorTargetStatus    map[string]string   `json:"sector_target_status,omitempty"`    // Set by handler: under, within or over per targeted sector
+	CorrelatedClusters    []CorrelatedCluster `json:"correlated_clusters,omitempty"`     // Set by handler: same-industry (else same-sector) position groups against the correlated-weight cap
+	DustPositions         []DustPosition      `json:"dust_positions,omitempty"`          // Held positions below the configured minimum position value
+	CashBuffer            *CashBuffer         `json:"cash_buffer,omitempty"`             // Set by handler: cash share of positions plus cash against min_cash_buffer_pct
+	RealizedPnL           float64             `json:"realized_pnl"`                      // Lifetime realized PnL from closed trades (FIFO), in BaseCurrency
+	RatesStale            bool                `json:"rates_stale"`                       // Set by handler: youngest exchange rate is older than the configured max age
+	RatesAgeHours         float64             `json:"rates_age_hours"`                   // Set by handler: age of the youngest exchange rate
 }
 
 type BuyZone struct {
@@ -227,13 +425,14 @@ type BuyZone struct {
 }
 
 type BuyZoneCalculationResult struct {
-	Ticker               string  `json:"ticker"`
-	FairValue            float64 `json:"fair_value"`
-	ProbabilityPositive  float64 `json:"probability_positive"`
-	DownsideRisk         float64 `json:"downside_risk"`
-	BuyZone              BuyZone `json:"buy_zone"`
-	CurrentExpectedValue float64 `json:"current_expected_value"`
-	ZoneStatus           string  `json:"zone_status,omitempty"`
+	Ticker               string          `json:"ticker"`
+	FairValue            float64         `json:"fair_value"`
+	ProbabilityPositive  float64         `json:"probability_positive"`
+	DownsideRisk         float64         `json:"downside_risk"`
+	BuyZone              BuyZone         `json:"buy_zone"`
+	CurrentExpectedValue float64         `json:"current_expected_value"`
+	ZoneStatus           string          `json:"zone_status,omitempty"`
+	Ladder               []LadderedEntry `json:"ladder,omitempty"` // Set when tranches are requested and a zone exists
 }
 
 type SellZone struct {
@@ -251,14 +450,16 @@ type SellZoneCalculationResult struct {
 	SellZoneStatus       string   `json:"sell_zone_status,omitempty"`
 }
 
-// CalculateBuyZoneResult calculates buy-zone bounds from EV thresholds and returns
-// the current EV plus status classification for a provided current price.
+// CalculateBuyZoneResult calculates buy-zone bounds from EV thresholds (15% and cfg's
+// AddThreshold) and returns the current EV plus status classification for a provided current price.
+// A price in or below the zone is BuyZoneElevatedRisk when |downsideRisk| exceeds cfg's MaxBuyZoneDownside.
 func CalculateBuyZoneResult(
 	ticker string,
 	fairValue float64,
 	probabilityPositive float64,
 	downsideRisk float64,
 	currentPrice float64,
+	cfg MetricsConfig,
 ) (BuyZoneCalculationResult, error) {
 	result := BuyZoneCalculationResult{
 		Ticker:              ticker,
@@ -277,8 +478,9 @@ func CalculateBuyZoneResult(
 		return result, fmt.Errorf("fair_value must be positive")
 	}
 
-	lowerBound, okLower := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, 15)
-	upperBound, okUpper := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, 7)
+	offset := cfg.evOffset()
+	lowerBound, okLower := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, 15+offset)
+	upperBound, okUpper := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, cfg.AddThreshold+offset)
 	if !okLower || !okUpper {
 		result.ZoneStatus = "no buy zone available"
 		return result, nil
@@ -295,7 +497,7 @@ func CalculateBuyZoneResult(
 	}
 
 	if currentPrice > 0 {
-		result.CurrentExpectedValue = expectedValueAtPrice(fairValue, probabilityPositive, downsideRisk, currentPrice)
+		result.CurrentExpectedValue = expectedValueAtPrice(fairValue, probabilityPositive, downsideRisk, currentPrice) - offset
 		switch {
 		case currentPrice < result.BuyZone.LowerBound:
 			result.ZoneStatus = "EV >> 15%"
@@ -304,19 +506,28 @@ func CalculateBuyZoneResult(
 		default:
 			result.ZoneStatus = "outside buy zone"
 		}
+		if result.ZoneStatus != "outside buy zone" && exceedsBuyZoneDownside(downsideRisk, cfg.MaxBuyZoneDownside) {
+			result.ZoneStatus = BuyZoneElevatedRisk
+		}
 	}
 
 	return result, nil
 }
 
-// CalculateSellZoneResult calculates sell-zone bounds from EV thresholds and returns
-// current EV plus classification for trim/sell actioning.
+// exceedsBuyZoneDownside reports whether |downsideRisk| (%) is above maxDownside (0 = no cap).
+func exceedsBuyZoneDownside(downsideRisk, maxDownside float64) bool {
+	return maxDownside > 0 && math.Abs(downsideRisk) > maxDownside
+}
+
+// CalculateSellZoneResult calculates sell-zone bounds from cfg's TrimThreshold and SellThreshold
+// and returns current EV plus classification for trim/sell actioning.
 func CalculateSellZoneResult(
 	ticker string,
 	fairValue float64,
 	probabilityPositive float64,
 	downsideRisk float64,
 	currentPrice float64,
+	cfg MetricsConfig,
 ) (SellZoneCalculationResult, error) {
 	result := SellZoneCalculationResult{
 		Ticker:              ticker,
@@ -335,8 +546,9 @@ func CalculateSellZoneResult(
 		return result, fmt.Errorf("fair_value must be positive")
 	}
 
-	trimPrice, okTrim := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, 3)
-	sellPrice, okSell := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, 0)
+	offset := cfg.evOffset()
+	trimPrice, okTrim := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, cfg.TrimThreshold+offset)
+	sellPrice, okSell := solvePriceForEVThreshold(fairValue, probabilityPositive, downsideRisk, cfg.SellThreshold+offset)
 	if !okTrim || !okSell || trimPrice >= sellPrice {
 		result.SellZoneStatus = "no sell zone"
 		return result, nil
@@ -348,11 +560,11 @@ func CalculateSellZoneResult(
 	}
 
 	if currentPrice > 0 {
-		result.CurrentExpectedValue = expectedValueAtPrice(fairValue, probabilityPositive, downsideRisk, currentPrice)
+		result.CurrentExpectedValue = expectedValueAtPrice(fairValue, probabilityPositive, downsideRisk, currentPrice) - offset
 		switch {
-		case result.CurrentExpectedValue > 3:
+		case result.CurrentExpectedValue > cfg.TrimThreshold:
 			result.SellZoneStatus = "Below sell zone"
-		case result.CurrentExpectedValue > 0:
+		case result.CurrentExpectedValue > cfg.SellThreshold:
 			result.SellZoneStatus = "In trim zone"
 		default:
 			result.SellZoneStatus = "In sell zone"
@@ -22,7 +22,7 @@ func TestCalculateMetricsDefaultsAndDerivedValues(t *testing.T) {
 		FairValue:    120,
 	}
 
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 
 	assertClose(t, stock.DownsideRisk, -25, 0.0001, "DownsideRisk")
 	assertClose(t, stock.ProbabilityPositive, 0.65, 0.0001, "ProbabilityPositive")
@@ -49,7 +49,7 @@ func TestCalculateMetricsPreservesDownsideRisk(t *testing.T) {
 		DownsideRisk: -10,
 	}
 
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 
 	assertClose(t, stock.DownsideRisk, -10, 0.0001, "DownsideRisk")
 	// Verify other fields are still calculated correctly with custom downside
@@ -66,7 +66,7 @@ func TestCalculateMetricsClampsNegativeKelly(t *testing.T) {
 		ProbabilityPositive: 0.1,
 	}
 
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 
 	assertClose(t, stock.KellyFraction, 0, 0.0001, "KellyFraction")
 	assertClose(t, stock.HalfKellySuggested, 0, 0.0001, "HalfKellySuggested")
@@ -109,12 +109,17 @@ func TestCalculatePortfolioMetrics(t *testing.T) {
 		"EUR": 2,
 	}
 
-	metrics := CalculatePortfolioMetrics(stocks, fxRates)
+	metrics := CalculatePortfolioMetrics(stocks, fxRates, "EUR", DefaultMetricsConfig())
 
 	assertClose(t, metrics.TotalValue, 1500, 0.01, "TotalValue")
 	assertClose(t, metrics.OverallEV, 3.6667, 0.01, "OverallEV")
-	assertClose(t, metrics.WeightedVolatility, 13.3333, 0.01, "WeightedVolatility")
-	assertClose(t, metrics.SharpeRatio, -0.025, 0.01, "SharpeRatio")
+	// sqrt(w'Σw) at the default 0.3 correlation, below the linear 13.33
+	assertClose(t, metrics.WeightedVolatility, 10.7497, 0.01, "WeightedVolatility")
+	assertClose(t, metrics.NaiveVolatility, 13.3333, 0.01, "NaiveVolatility")
+	if metrics.SharpeRatio == nil {
+		t.Fatalf("expected a Sharpe ratio, got %q", metrics.SharpeUnavailable)
+	}
+	assertClose(t, *metrics.SharpeRatio, -0.0310, 0.001, "SharpeRatio")
 	assertClose(t, metrics.KellyUtilization, 100, 0.01, "KellyUtilization")
 
 	// sector_weights are fractions 0–1 (DATA_CONTRACT.md)
@@ -129,7 +134,7 @@ func TestCalculatePortfolioMetrics(t *testing.T) {
 
 func TestCalculateBuyZoneResult_ValidInput(t *testing.T) {
 	t.Parallel()
-	result, err := CalculateBuyZoneResult("UNH", 380, 0.65, -15, 284.37)
+	result, err := CalculateBuyZoneResult("UNH", 380, 0.65, -15, 284.37, DefaultMetricsConfig())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -142,8 +147,9 @@ func TestCalculateBuyZoneResult_ValidInput(t *testing.T) {
 	assertClose(t, result.BuyZone.UpperBound, 319.7411, 0.02, "UpperBound")
 	assertClose(t, result.CurrentExpectedValue, 16.6087, 0.02, "CurrentExpectedValue")
 
-	if result.ZoneStatus != "EV >> 15%" {
-		t.Fatalf("ZoneStatus: got %s want %s", result.ZoneStatus, "EV >> 15%")
+	// EV qualifies but |downside| 15% exceeds the 10% optimal-zone cap.
+	if result.ZoneStatus != BuyZoneElevatedRisk {
+		t.Fatalf("ZoneStatus: got %s want %s", result.ZoneStatus, BuyZoneElevatedRisk)
 	}
 
 	// Verify zone bounds are properly ordered
@@ -174,7 +180,7 @@ func TestCalculateBuyZoneResult_ValidationErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := CalculateBuyZoneResult(tt.ticker, tt.fairValue, tt.probability, tt.downside, tt.currentPrice)
+			_, err := CalculateBuyZoneResult(tt.ticker, tt.fairValue, tt.probability, tt.downside, tt.currentPrice, DefaultMetricsConfig())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CalculateBuyZoneResult() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -193,10 +199,41 @@ func TestCalculateBuyZoneResult_StatusClassifications(t *testing.T) {
 		{"within buy zone", 90, "within buy zone"},
 		{"above upper bound", 130, "outside buy zone"},
 	}
+	// The downside gate is covered separately; switch it off to classify on EV alone.
+	cfg := DefaultMetricsConfig()
+	cfg.MaxBuyZoneDownside = 0
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CalculateBuyZoneResult("ABC", 120, 0.65, -25, tt.price, cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.ZoneStatus != tt.wantStatus {
+				t.Errorf("ZoneStatus: got %s want %s", result.ZoneStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCalculateBuyZoneResult_StatusClassificationsWithDownsideGate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		downsideRisk float64
+		price        float64
+		wantStatus   string
+	}{
+		{"below lower bound, downside over cap", -25, 80, BuyZoneElevatedRisk},
+		{"within buy zone, downside over cap", -25, 90, BuyZoneElevatedRisk},
+		{"above upper bound, downside over cap", -25, 130, "outside buy zone"},
+		{"below lower bound, downside within cap", -8, 90, "EV >> 15%"},
+		{"within buy zone, downside within cap", -8, 100, "within buy zone"},
+	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := CalculateBuyZoneResult("ABC", 120, 0.65, -25, tt.price)
+			result, err := CalculateBuyZoneResult("ABC", 120, 0.65, tt.downsideRisk, tt.price, DefaultMetricsConfig())
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -207,9 +244,38 @@ func TestCalculateBuyZoneResult_StatusClassifications(t *testing.T) {
 	}
 }
 
+func TestCalculateBuyZoneResult_HighDownsideOutsideOptimalZone(t *testing.T) {
+	t.Parallel()
+	// EV at 90 is well above 7%, but a 25% downside breaks the "downside risk < 10%" half of the rule.
+	result, err := CalculateBuyZoneResult("ABC", 120, 0.65, -25, 90, DefaultMetricsConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.CurrentExpectedValue <= 7 {
+		t.Fatalf("expected a qualifying EV, got %.2f", result.CurrentExpectedValue)
+	}
+	if result.ZoneStatus != BuyZoneElevatedRisk {
+		t.Fatalf("ZoneStatus: got %s want %s", result.ZoneStatus, BuyZoneElevatedRisk)
+	}
+
+	stock := models.Stock{DownsideRisk: -25, ProbabilityPositive: 0.65, CurrentPrice: 90, FairValue: 120}
+	CalculateMetricsWithConfig(&stock, DefaultMetricsConfig())
+	if stock.Assessment != "Add" || stock.BuyZoneStatus != BuyZoneElevatedRisk || stock.HasTag(TagInBuyZone) {
+		t.Fatalf("got assessment %q status %q tags %q, want Add flagged outside the optimal zone", stock.Assessment, stock.BuyZoneStatus, stock.DerivedTags)
+	}
+
+	// A cap of 0 turns the gate off.
+	cfg := DefaultMetricsConfig()
+	cfg.MaxBuyZoneDownside = 0
+	CalculateMetricsWithConfig(&stock, cfg)
+	if stock.BuyZoneStatus != "within buy zone" {
+		t.Fatalf("BuyZoneStatus with gate off: got %q want within buy zone", stock.BuyZoneStatus)
+	}
+}
+
 func TestCalculateSellZoneResult_ValidInput(t *testing.T) {
 	t.Parallel()
-	result, err := CalculateSellZoneResult("UNH", 380, 0.65, -15, 350)
+	result, err := CalculateSellZoneResult("UNH", 380, 0.65, -15, 350, DefaultMetricsConfig())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -255,7 +321,7 @@ func TestCalculateSellZoneResult_ValidationErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := CalculateSellZoneResult(tt.ticker, tt.fairValue, tt.probability, tt.downside, tt.currentPrice)
+			_, err := CalculateSellZoneResult(tt.ticker, tt.fairValue, tt.probability, tt.downside, tt.currentPrice, DefaultMetricsConfig())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CalculateSellZoneResult() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -272,7 +338,7 @@ func TestCalculateMetricsSetsSellZoneFields(t *testing.T) {
 		DownsideRisk:        -15,
 	}
 
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 
 	if stock.SellZoneLowerBound <= 0 || stock.SellZoneUpperBound <= 0 {
 		t.Fatalf("expected sell zone bounds to be set, got lower=%f upper=%f", stock.SellZoneLowerBound, stock.SellZoneUpperBound)
@@ -303,7 +369,7 @@ func TestCalculateMetricsCalibratesDownsideRiskByBetaBuckets(t *testing.T) {
 				CurrentPrice: 100,
 				FairValue:    120,
 			}
-			CalculateMetrics(&stock)
+			CalculateMetrics(&stock, DefaultMetricsConfig())
 			assertClose(t, stock.DownsideRisk, tc.want, 0.0001, "DownsideRisk")
 		})
 	}
@@ -313,7 +379,7 @@ func TestCalculateMetricsUsesFallbackDownsideRiskWithoutBeta(t *testing.T) {
 		CurrentPrice: 100,
 		FairValue:    120,
 	}
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 	assertClose(t, stock.DownsideRisk, -20, 0.0001, "DownsideRisk")
 }
 func TestCalculateMetricsUsesMinDownsideMagnitudeForBRatio(t *testing.T) {
@@ -323,7 +389,7 @@ func TestCalculateMetricsUsesMinDownsideMagnitudeForBRatio(t *testing.T) {
 		ProbabilityPositive: 0.5,
 		DownsideRisk:        -0.01,
 	}
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 	assertClose(t, stock.BRatio, 100, 0.0001, "BRatio")
 }
 func TestCalculateMetricsCapsHalfKellySuggested(t *testing.T) {
@@ -333,7 +399,7 @@ func TestCalculateMetricsCapsHalfKellySuggested(t *testing.T) {
 		ProbabilityPositive: 0.9,
 		DownsideRisk:        -10,
 	}
-	CalculateMetrics(&stock)
+	CalculateMetrics(&stock, DefaultMetricsConfig())
 	assertClose(t, stock.HalfKellySuggested, 15, 0.0001, "HalfKellySuggested")
 }
 func TestCalculateMetricsAssessmentThresholds(t *testing.T) {
@@ -356,12 +422,130 @@ func TestCalculateMetricsAssessmentThresholds(t *testing.T) {
 				ProbabilityPositive: 0.5,
 				DownsideRisk:        -10,
 			}
-			CalculateMetrics(&stock)
+			CalculateMetrics(&stock, DefaultMetricsConfig())
+			if stock.Assessment != tc.assessment {
+				t.Fatalf("Assessment: got %s want %s", stock.Assessment, tc.assessment)
+			}
+		})
+	}
+}
+func TestCalculateMetricsWithConfigUsesCustomThresholds(t *testing.T) {
+	t.Parallel()
+	// p = 0.5 and downside -10 give EV = (fairValue - 100) / 2 - 5 at a price of 100.
+	cfg := DefaultMetricsConfig()
+	cfg.AddThreshold = 10
+	cfg.TrimThreshold = 4
+	cfg.SellThreshold = -2
+	tests := []struct {
+		name       string
+		fairValue  float64
+		assessment string
+	}{
+		{name: "above 10 is add", fairValue: 131, assessment: "Add"},
+		{name: "at 10 is hold", fairValue: 130, assessment: "Hold"},
+		{name: "at 4 is hold", fairValue: 118, assessment: "Hold"},
+		{name: "between -2 and 4 is trim", fairValue: 108, assessment: "Trim"},
+		{name: "below -2 is sell", fairValue: 105, assessment: "Sell"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stock := models.Stock{
+				CurrentPrice:        100,
+				FairValue:           tc.fairValue,
+				ProbabilityPositive: 0.5,
+				DownsideRisk:        -10,
+			}
+			CalculateMetricsWithConfig(&stock, cfg)
 			if stock.Assessment != tc.assessment {
 				t.Fatalf("Assessment: got %s want %s", stock.Assessment, tc.assessment)
 			}
 		})
 	}
+
+	// Zone bounds are the prices where EV equals the Add, Trim and Sell thresholds.
+	stock := models.Stock{CurrentPrice: 100, FairValue: 108, ProbabilityPositive: 0.5, DownsideRisk: -10}
+	CalculateMetricsWithConfig(&stock, cfg)
+	assertClose(t, stock.BuyZoneMax, 108/1.3, 0.0001, "BuyZoneMax")
+	assertClose(t, stock.SellZoneLowerBound, 108/1.18, 0.0001, "SellZoneLowerBound")
+	assertClose(t, stock.SellZoneUpperBound, 108/1.06, 0.0001, "SellZoneUpperBound")
+	if stock.SellZoneStatus != "In trim zone" {
+		t.Fatalf("SellZoneStatus: got %s want In trim zone", stock.SellZoneStatus)
+	}
+}
+func TestCalculateMetricsBenchmarkRelativeEV(t *testing.T) {
+	t.Parallel()
+	// Price 100, fair value 130, p = 0.6, downside -10: absolute EV = 0.6*30 + 0.4*-10 = 14 (Add).
+	newStock := func() models.Stock {
+		return models.Stock{CurrentPrice: 100, FairValue: 130, ProbabilityPositive: 0.6, DownsideRisk: -10}
+	}
+	absolute := newStock()
+	CalculateMetricsWithConfig(&absolute, DefaultMetricsConfig())
+	assertClose(t, absolute.ExpectedValue, 14, 0.0001, "absolute ExpectedValue")
+	assertClose(t, absolute.KellyFraction, 46.6667, 0.001, "absolute KellyFraction")
+	if absolute.Assessment != "Add" {
+		t.Fatalf("absolute Assessment: got %s want Add", absolute.Assessment)
+	}
+
+	// Against an 8% benchmark the scenarios are +22 and -18 excess: alpha EV = 13.2 - 7.2 = 6 (Hold),
+	// b = 22/18 and Kelly = (b*0.6 - 0.4) / b.
+	cfg := DefaultMetricsConfig()
+	cfg.BenchmarkRelativeEV = true
+	cfg.BenchmarkReturn = 8
+	relative := newStock()
+	CalculateMetricsWithConfig(&relative, cfg)
+	assertClose(t, relative.ExpectedValue, 6, 0.0001, "relative ExpectedValue")
+	assertClose(t, relative.ExpectedValue, absolute.ExpectedValue-cfg.BenchmarkReturn, 0.0001, "relative EV vs absolute")
+	assertClose(t, relative.BRatio, 22.0/18, 0.0001, "relative BRatio")
+	assertClose(t, relative.KellyFraction, 27.2727, 0.001, "relative KellyFraction")
+	assertClose(t, relative.EVMid, 6, 0.0001, "relative EVMid")
+	assertClose(t, relative.UpsidePotential, 30, 0.0001, "UpsidePotential stays absolute")
+	if relative.Assessment != "Hold" {
+		t.Fatalf("relative Assessment: got %s want Hold", relative.Assessment)
+	}
+	// The Add threshold now needs 7% alpha, i.e. 15% absolute EV: upside (15 + 4) / 0.6.
+	assertClose(t, relative.BuyZoneMax, 130/(1+(15+4)/0.6/100), 0.0001, "relative BuyZoneMax")
+	if relative.BuyZoneStatus != "outside buy zone" {
+		t.Fatalf("relative BuyZoneStatus: got %s want outside buy zone", relative.BuyZoneStatus)
+	}
+}
+
+func TestCalculateMetricsMaxDrawdownEstimate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		stock    models.Stock
+		drawdown float64
+	}{
+		{name: "1.65 sigma beyond the downside", stock: models.Stock{Volatility: 20, DownsideRisk: -20}, drawdown: -33},
+		{name: "floored at the downside", stock: models.Stock{Volatility: 10, DownsideRisk: -25}, drawdown: -25},
+		{name: "zero volatility uses the calibrated downside", stock: models.Stock{Beta: 1.2}, drawdown: -25},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stock := tc.stock
+			stock.CurrentPrice, stock.FairValue = 100, 120
+			CalculateMetricsWithConfig(&stock, DefaultMetricsConfig())
+			assertClose(t, stock.MaxDrawdownEstimate, tc.drawdown, 0.0001, "MaxDrawdownEstimate")
+		})
+	}
+
+	// The summary value-weights the per-stock estimates; a row without one is estimated on the fly.
+	stocks := []models.Stock{
+		{SharesOwned: 3, CurrentPrice: 100, Currency: "EUR", MaxDrawdownEstimate: -33},
+		{SharesOwned: 1, CurrentPrice: 100, Currency: "EUR", Volatility: 10, DownsideRisk: -25},
+	}
+	metrics := CalculatePortfolioMetrics(stocks, map[string]float64{"EUR": 1}, "EUR", DefaultMetricsConfig())
+	assertClose(t, metrics.MaxDrawdownEstimate, 0.75*-33+0.25*-25, 0.0001, "summary MaxDrawdownEstimate")
+}
+
+func TestMetricsConfigFromSettingsAppliesSellThreshold(t *testing.T) {
+	t.Parallel()
+	cfg := MetricsConfigFromSettings(&models.PortfolioSettings{EVAddThreshold: 7, EVTrimThreshold: 3, EVSellThreshold: -1.5})
+	assertClose(t, cfg.SellThreshold, -1.5, 0.0001, "SellThreshold")
+
+	// A sell cutoff above the trim threshold is ignored.
+	cfg = MetricsConfigFromSettings(&models.PortfolioSettings{EVAddThreshold: 7, EVTrimThreshold: 3, EVSellThreshold: 5})
+	assertClose(t, cfg.SellThreshold, 0, 0.0001, "SellThreshold")
 }
 func TestCalculateMetricsResetsUpsidePotentialWhenPricesAreInvalid(t *testing.T) {
 	t.Parallel()
@@ -387,7 +571,7 @@ func TestCalculateMetricsResetsUpsidePotentialWhenPricesAreInvalid(t *testing.T)
 				UpsidePotential:     35,
 				BuyZoneStatus:       "within buy zone",
 			}
-			CalculateMetrics(&stock)
+			CalculateMetrics(&stock, DefaultMetricsConfig())
 			assertClose(t, stock.UpsidePotential, 0, 0.0001, "UpsidePotential")
 			assertClose(t, stock.BRatio, 0, 0.0001, "BRatio")
 			assertClose(t, stock.BuyZoneMin, 0, 0.0001, "BuyZoneMin")
@@ -411,7 +595,7 @@ func TestCalculateSellZoneResult_StatusClassifications(t *testing.T) {
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			result, err := CalculateSellZoneResult("UNH", 380, 0.65, -15, tc.price)
+			result, err := CalculateSellZoneResult("UNH", 380, 0.65, -15, tc.price, DefaultMetricsConfig())
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -445,7 +629,7 @@ func TestCalculateSellZoneResult_NoZoneWhenProbabilityIsZero(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := CalculateSellZoneResult("X", 100, tt.probability, tt.downside, 90)
+			result, err := CalculateSellZoneResult("X", 100, tt.probability, tt.downside, 90, DefaultMetricsConfig())
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -478,11 +662,17 @@ func TestCalculatePortfolioMetricsSkipsStocksWithoutUsableFXRate(t *testing.T) {
 		},
 	}
 	fxRates := map[string]float64{"USD": 1}
-	metrics := CalculatePortfolioMetrics(stocks, fxRates)
+	metrics := CalculatePortfolioMetrics(stocks, fxRates, "EUR", DefaultMetricsConfig())
 	assertClose(t, metrics.TotalValue, 1000, 0.01, "TotalValue")
 	assertClose(t, metrics.OverallEV, 5, 0.01, "OverallEV")
 	assertClose(t, metrics.WeightedVolatility, 10, 0.01, "WeightedVolatility")
-	assertClose(t, metrics.SharpeRatio, 0.1, 0.01, "SharpeRatio")
+	// A single valued position is too little data for a Sharpe ratio.
+	if metrics.ValuedPositions != 1 {
+		t.Fatalf("ValuedPositions: got %d want 1", metrics.ValuedPositions)
+	}
+	if metrics.SharpeRatio != nil {
+		t.Fatalf("expected no Sharpe ratio from 1 valued position, got %v", *metrics.SharpeRatio)
+	}
 	assertClose(t, metrics.KellyUtilization, 100, 0.01, "KellyUtilization")
 	assertClose(t, metrics.SectorWeights["Tech"], 1, 0.0001, "SectorWeights[Tech]")
 	// Verify JPY stock is excluded from sector weights
@@ -491,9 +681,108 @@ func TestCalculatePortfolioMetricsSkipsStocksWithoutUsableFXRate(t *testing.T) {
 	}
 }
 
+func TestCalculatePortfolioMetricsSharpeUnavailableWithoutVolatility(t *testing.T) {
+	t.Parallel()
+	stocks := []models.Stock{
+		{SharesOwned: 10, CurrentPrice: 100, Currency: "EUR", ExpectedValue: 8},
+		{SharesOwned: 5, CurrentPrice: 200, Currency: "EUR", ExpectedValue: 12},
+	}
+	metrics := CalculatePortfolioMetrics(stocks, map[string]float64{"EUR": 1}, "EUR", DefaultMetricsConfig())
+	if metrics.SharpeRatio != nil {
+		t.Fatalf("expected no Sharpe ratio at zero volatility, got %v", *metrics.SharpeRatio)
+	}
+	if metrics.SharpeUnavailable != "insufficient data: weighted volatility is zero" {
+		t.Fatalf("SharpeUnavailable: got %q", metrics.SharpeUnavailable)
+	}
+
+	// With volatility the ratio needs minPositions valued positions.
+	if ratio, reason := SharpeRatio(10, 20, 2, 3); ratio != nil || reason == "" {
+		t.Fatalf("expected no ratio below the minimum positions, got %v", ratio)
+	}
+	ratio, reason := SharpeRatio(10, 20, 3, 3)
+	if ratio == nil {
+		t.Fatalf("expected a ratio, got %q", reason)
+	}
+	assertClose(t, *ratio, 0.3, 0.0001, "SharpeRatio")
+}
+
+func TestCalculatePortfolioMetricsFlagsDustPositions(t *testing.T) {
+	t.Parallel()
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "BIG", SharesOwned: 10, CurrentPrice: 100, Currency: "EUR", ExpectedValue: 10},
+		{ID: 2, Ticker: "DUST", SharesOwned: 2, CurrentPrice: 4, Currency: "USD", ExpectedValue: 50}, // 8 USD = 6.40 EUR
+		{ID: 3, Ticker: "CRUMB", SharesOwned: 1, CurrentPrice: 2, Currency: "EUR", ExpectedValue: 1},
+	}
+	fxRates := map[string]float64{"EUR": 1, "USD": 1.25}
+
+	cfg := DefaultMetricsConfig()
+	cfg.MinPositionValue = 10
+	metrics := CalculatePortfolioMetrics(stocks, fxRates, "EUR", cfg)
+	if len(metrics.DustPositions) != 2 {
+		t.Fatalf("expected 2 dust positions, got %+v", metrics.DustPositions)
+	}
+	if dust := metrics.DustPositions[0]; dust.Ticker != "DUST" || dust.Suggestion != DustSuggestionConsolidate {
+		t.Errorf("DUST: got %+v, want consolidate", dust)
+	}
+	assertClose(t, metrics.DustPositions[0].ValueEUR, 6.4, 0.0001, "DUST ValueEUR")
+	if dust := metrics.DustPositions[1]; dust.Ticker != "CRUMB" || dust.Suggestion != DustSuggestionExit {
+		t.Errorf("CRUMB: got %+v, want exit", dust)
+	}
+	// Flagged only: (1000*10 + 6.4*50 + 2*1) / 1008.4
+	assertClose(t, metrics.OverallEV, 10.2360, 0.0001, "OverallEV with dust")
+	assertClose(t, metrics.TotalValue, 1008.4, 0.0001, "TotalValue with dust")
+
+	cfg.ExcludeDust = true
+	metrics = CalculatePortfolioMetrics(stocks, fxRates, "EUR", cfg)
+	if len(metrics.DustPositions) != 2 {
+		t.Fatalf("expected 2 dust positions, got %+v", metrics.DustPositions)
+	}
+	assertClose(t, metrics.OverallEV, 10, 0.0001, "OverallEV without dust")
+	assertClose(t, metrics.KellyUtilization, 100, 0.0001, "KellyUtilization without dust")
+	assertClose(t, metrics.TotalValue, 1008.4, 0.0001, "TotalValue still counts dust")
+	if metrics.ValuedPositions != 1 {
+		t.Errorf("ValuedPositions: got %d want 1", metrics.ValuedPositions)
+	}
+}
+
+func TestCalculatePortfolioMetricsReportsInBaseCurrency(t *testing.T) {
+	t.Parallel()
+	fxRates := map[string]float64{"EUR": 1, "USD": 1.25, "DKK": 7.5}
+	// A EUR-based portfolio holding USD and a USD-based portfolio holding DKK and EUR.
+	eurPortfolio := []models.Stock{
+		{SharesOwned: 10, CurrentPrice: 100, Currency: "USD", ExpectedValue: 10, Sector: "Tech"},
+	}
+	usdPortfolio := []models.Stock{
+		{SharesOwned: 20, CurrentPrice: 375, Currency: "DKK", ExpectedValue: 5, Sector: "Health"},
+		{SharesOwned: 5, CurrentPrice: 200, Currency: "EUR", ExpectedValue: 15, Sector: "Energy"},
+	}
+
+	eur := CalculatePortfolioMetrics(eurPortfolio, fxRates, "EUR", DefaultMetricsConfig())
+	if eur.BaseCurrency != "EUR" {
+		t.Errorf("BaseCurrency = %q, want EUR", eur.BaseCurrency)
+	}
+	assertClose(t, eur.TotalValue, 800, 0.0001, "EUR TotalValue") // 1,000 USD / 1.25
+
+	// 7,500 DKK = 1,000 EUR and 1,000 EUR: 2,000 EUR = 2,500 USD; weights are unchanged by the base.
+	usd := CalculatePortfolioMetrics(usdPortfolio, fxRates, "usd", DefaultMetricsConfig())
+	if usd.BaseCurrency != "USD" {
+		t.Errorf("BaseCurrency = %q, want USD", usd.BaseCurrency)
+	}
+	assertClose(t, usd.TotalValue, 2500, 0.0001, "USD TotalValue")
+	assertClose(t, usd.OverallEV, 10, 0.0001, "USD OverallEV")
+	assertClose(t, usd.SectorWeights["Health"], 0.5, 0.0001, "USD SectorWeights[Health]")
+
+	// A base without a rate falls back to EUR.
+	fallback := CalculatePortfolioMetrics(usdPortfolio, fxRates, "GBP", DefaultMetricsConfig())
+	if fallback.BaseCurrency != "EUR" {
+		t.Errorf("BaseCurrency = %q, want EUR fallback", fallback.BaseCurrency)
+	}
+	assertClose(t, fallback.TotalValue, 2000, 0.0001, "fallback TotalValue")
+}
+
 func TestCalculatePortfolioMetricsEmptyPortfolio(t *testing.T) {
 	t.Parallel()
-	metrics := CalculatePortfolioMetrics([]models.Stock{}, map[string]float64{"USD": 1})
+	metrics := CalculatePortfolioMetrics([]models.Stock{}, map[string]float64{"USD": 1}, "EUR", DefaultMetricsConfig())
 	assertClose(t, metrics.TotalValue, 0, 0.01, "TotalValue")
 	assertClose(t, metrics.OverallEV, 0, 0.01, "OverallEV")
 	assertClose(t, metrics.WeightedVolatility, 0, 0.01, "WeightedVolatility")
@@ -534,7 +823,7 @@ func TestCalculatePortfolioMetricsMultipleSectorsWithDifferentWeights(t *testing
 		},
 	}
 	fxRates := map[string]float64{"USD": 1}
-	metrics := CalculatePortfolioMetrics(stocks, fxRates)
+	metrics := CalculatePortfolioMetrics(stocks, fxRates, "EUR", DefaultMetricsConfig())
 
 	assertClose(t, metrics.TotalValue, 2000, 0.01, "TotalValue")
 	// Weighted EV: (1000/2000)*8 + (500/2000)*5 + (500/2000)*3 = 4 + 1.25 + 0.75 = 6
@@ -552,3 +841,129 @@ func TestCalculatePortfolioMetricsMultipleSectorsWithDifferentWeights(t *testing
 	assertClose(t, metrics.SectorWeights["Healthcare"], 0.25, 0.0001, "SectorWeights[Healthcare]")
 	assertClose(t, metrics.SectorWeights["Financials"], 0.25, 0.0001, "SectorWeights[Financials]")
 }
+
+func TestCalculateMetricsDerivesBuyZoneTags(t *testing.T) {
+	t.Parallel()
+	stock := models.Stock{
+		Beta:         1.2,
+		CurrentPrice: 90,
+		FairValue:    120,
+		Tags:         "watchlist",
+	}
+	// Beta 1.2 implies a downside past the buy-zone cap; the gate has its own cases below.
+	cfg := DefaultMetricsConfig()
+	cfg.MaxBuyZoneDownside = 0
+
+	CalculateMetrics(&stock, cfg)
+
+	if stock.BuyZoneStatus != "within buy zone" {
+		t.Fatalf("BuyZoneStatus: got %q want within buy zone", stock.BuyZoneStatus)
+	}
+	if stock.DerivedTags != TagAddCandidate+","+TagInBuyZone {
+		t.Fatalf("DerivedTags: got %q", stock.DerivedTags)
+	}
+	if !stock.HasTag("in-buy-zone") || !stock.HasTag("Watchlist") {
+		t.Fatal("expected derived and manual tags to coexist")
+	}
+
+	// Derived tags are recomputed, not accumulated, when the price leaves the buy zone.
+	stock.CurrentPrice = 118
+	CalculateMetrics(&stock, cfg)
+	if stock.HasTag(TagInBuyZone) {
+		t.Errorf("expected in-buy-zone to be dropped, got %q", stock.DerivedTags)
+	}
+	if stock.Tags != "watchlist" {
+		t.Errorf("manual tags changed: got %q", stock.Tags)
+	}
+}
+
+func TestCalculateMetricsDownsideGateWithholdsInBuyZoneTag(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		stock      models.Stock
+		wantStatus string
+		wantTag    bool
+	}{
+		{"downside over cap", models.Stock{Beta: 1.2, CurrentPrice: 90, FairValue: 120}, BuyZoneElevatedRisk, false},
+		{"downside within cap", models.Stock{DownsideRisk: -8, CurrentPrice: 100, FairValue: 120}, "within buy zone", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stock := tt.stock
+			CalculateMetrics(&stock, DefaultMetricsConfig())
+			if stock.BuyZoneStatus != tt.wantStatus {
+				t.Errorf("BuyZoneStatus: got %q want %q", stock.BuyZoneStatus, tt.wantStatus)
+			}
+			if stock.HasTag(TagInBuyZone) != tt.wantTag {
+				t.Errorf("in-buy-zone tag: got %q, want present=%v", stock.DerivedTags, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestCalculateMetricsWithShadowKeepsLiveFieldsUnchanged(t *testing.T) {
+	t.Parallel()
+	stock := models.Stock{
+		Beta:         1.0,
+		CurrentPrice: 100,
+		FairValue:    120,
+	}
+	live := stock
+	CalculateMetricsWithConfig(&live, DefaultMetricsConfig())
+
+	shadow := DefaultMetricsConfig()
+	shadow.AddThreshold = 4
+	shadow.DefaultProbability = 0.75
+	CalculateMetricsWithShadow(&stock, DefaultMetricsConfig(), &shadow)
+
+	assertClose(t, stock.ExpectedValue, live.ExpectedValue, 1e-9, "ExpectedValue")
+	if stock.Assessment != live.Assessment {
+		t.Fatalf("Assessment: got %q want live %q", stock.Assessment, live.Assessment)
+	}
+	if stock.ProbabilityPositive != defaultProbabilityPositive {
+		t.Fatalf("ProbabilityPositive: got %.2f want live default", stock.ProbabilityPositive)
+	}
+	if stock.ShadowExpectedValue <= stock.ExpectedValue {
+		t.Fatalf("ShadowExpectedValue: got %.4f want above live %.4f", stock.ShadowExpectedValue, stock.ExpectedValue)
+	}
+	if stock.ShadowAssessment != "Add" || stock.Assessment == "Add" {
+		t.Fatalf("assessments: live %q shadow %q", stock.Assessment, stock.ShadowAssessment)
+	}
+
+	CalculateMetricsWithShadow(&stock, DefaultMetricsConfig(), nil)
+	if stock.ShadowAssessment != "" || stock.ShadowExpectedValue != 0 {
+		t.Fatalf("expected shadow fields cleared, got %q %.4f", stock.ShadowAssessment, stock.ShadowExpectedValue)
+	}
+}
+
+func TestCalculateMetricsWiderProbabilityBandWidensEVInterval(t *testing.T) {
+	t.Parallel()
+	base := models.Stock{
+		CurrentPrice:        100,
+		FairValue:           130,
+		ProbabilityPositive: 0.6,
+		DownsideRisk:        -20,
+	}
+
+	narrowCfg := DefaultMetricsConfig()
+	narrowCfg.ProbabilityBand = 0.05
+	narrow := base
+	CalculateMetricsWithConfig(&narrow, narrowCfg)
+
+	wideCfg := DefaultMetricsConfig()
+	wideCfg.ProbabilityBand = 0.2
+	wide := base
+	CalculateMetricsWithConfig(&wide, wideCfg)
+
+	// EV at p = 0.6: 0.6*30 + 0.4*(-20) = 10; each 0.01 of p moves EV by 0.5.
+	assertClose(t, narrow.EVMid, narrow.ExpectedValue, 1e-9, "EVMid")
+	assertClose(t, narrow.EVLow, 7.5, 1e-9, "narrow EVLow")
+	assertClose(t, narrow.EVHigh, 12.5, 1e-9, "narrow EVHigh")
+	assertClose(t, wide.EVLow, 0, 1e-9, "wide EVLow")
+	assertClose(t, wide.EVHigh, 20, 1e-9, "wide EVHigh")
+	if wide.EVHigh-wide.EVLow <= narrow.EVHigh-narrow.EVLow {
+		t.Fatalf("expected wider band to widen interval: narrow [%.2f, %.2f], wide [%.2f, %.2f]", narrow.EVLow, narrow.EVHigh, wide.EVLow, wide.EVHigh)
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+	"math"
+)
+
+// Cash buffer band statuses.
+const (
+	CashBandBelow  = "below"
+	CashBandWithin = "within"
+	CashBandAbove  = "above"
+)
+
+// CashBuffer is cash as a percent of total portfolio value (positions + cash) against the target band.
+type CashBuffer struct {
+	CashValue  float64 `json:"cash_value"`  // In the metrics' base currency
+	TotalValue float64 `json:"total_value"` // Positions plus cash, in the metrics' base currency
+	CashPct    float64 `json:"cash_pct"`
+	MinPct     float64 `json:"min_pct"`
+	MaxPct     float64 `json:"max_pct"`
+	Status     string  `json:"status"` // below, within or above the band
+}
+
+// CalculateCashBuffer returns cash's share of positionsValue + cashValue and where it falls in the
+// minPct–maxPct band. maxPct is raised to minPct when below it; an empty portfolio is within.
+func CalculateCashBuffer(positionsValue, cashValue, minPct, maxPct float64) CashBuffer {
+	buffer := CashBuffer{
+		CashValue:  cashValue,
+		TotalValue: positionsValue + cashValue,
+		MinPct:     minPct,
+		MaxPct:     math.Max(maxPct, minPct),
+		Status:     CashBandWithin,
+	}
+	if buffer.TotalValue <= 0 {
+		return buffer
+	}
+	buffer.CashPct = cashValue / buffer.TotalValue * 100
+	switch {
+	case buffer.CashPct < buffer.MinPct:
+		buffer.Status = CashBandBelow
+	case buffer.CashPct > buffer.MaxPct:
+		buffer.Status = CashBandAbove
+	}
+	return buffer
+}
+
+// CashBufferAlertMessage describes a buffer below its band, e.g. for a cash_buffer_breach alert.
+func CashBufferAlertMessage(buffer CashBuffer) string {
+	return fmt.Sprintf("Cash is %.1f%% of the portfolio, below the %.1f–%.1f%% target band.", buffer.CashPct, buffer.MinPct, buffer.MaxPct)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// MergeHoldingsAcrossPortfolios combines held positions from several portfolios into one row per
+// ticker and currency, so a ticker held in two portfolios counts as a single position. Shares are
+// summed; the average cost is share-weighted; the price and other inputs come from the most recently
+// updated row; EV (and its band), volatility, beta and the max drawdown estimate are share-weighted
+// across the rows.
+// Merged rows carry no ID or portfolio. Positions without shares are dropped.
+func MergeHoldingsAcrossPortfolios(stocks []models.Stock) []models.Stock {
+	type accumulator struct {
+		stock                          models.Stock
+		shares                         float64
+		cost, ev, evLow, evMid, evHigh float64
+		volatility, beta, maxDrawdown  float64
+	}
+
+	byKey := make(map[string]*accumulator)
+	order := make([]string, 0, len(stocks))
+	for _, stock := range stocks {
+		if stock.SharesOwned <= 0 {
+			continue
+		}
+		key := strings.ToUpper(strings.TrimSpace(stock.Ticker)) + "|" + stock.Currency
+		acc, ok := byKey[key]
+		if !ok {
+			acc = &accumulator{stock: stock}
+			byKey[key] = acc
+			order = append(order, key)
+		} else if stock.LastUpdated.After(acc.stock.LastUpdated) {
+			acc.stock = stock
+		}
+		shares := float64(stock.SharesOwned)
+		acc.shares += shares
+		acc.cost += stock.AvgPriceLocal * shares
+		acc.ev += stock.ExpectedValue * shares
+		acc.evLow += stock.EVLow * shares
+		acc.evMid += stock.EVMid * shares
+		acc.evHigh += stock.EVHigh * shares
+		acc.volatility += stock.Volatility * shares
+		acc.maxDrawdown += stock.MaxDrawdownEstimate * shares
+		acc.beta += stock.Beta * shares
+	}
+
+	merged := make([]models.Stock, 0, len(order))
+	for _, key := range order {
+		acc := byKey[key]
+		stock := acc.stock
+		stock.ID = 0
+		stock.PortfolioID = 0
+		stock.Weight = 0
+		stock.SharesOwned = int(acc.shares)
+		stock.AvgPriceLocal = acc.cost / acc.shares
+		stock.ExpectedValue = acc.ev / acc.shares
+		stock.EVLow = acc.evLow / acc.shares
+		stock.EVMid = acc.evMid / acc.shares
+		stock.EVHigh = acc.evHigh / acc.shares
+		stock.Volatility = acc.volatility / acc.shares
+		stock.MaxDrawdownEstimate = acc.maxDrawdown / acc.shares
+		stock.Beta = acc.beta / acc.shares
+		merged = append(merged, stock)
+	}
+	return merged
+}
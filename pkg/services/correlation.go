@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// DefaultMaxCorrelatedWeight is the combined weight (% of invested value) above which a cluster of
+// correlated positions is flagged.
+const DefaultMaxCorrelatedWeight = 25.0
+
+// Correlation bases: how the members of a cluster were judged to move together.
+const (
+	CorrelationBasisIndustry = "industry"
+	CorrelationBasisSector   = "sector"
+)
+
+// CorrelatedCluster is a group of two or more held positions expected to move together.
+type CorrelatedCluster struct {
+	Key          string   `json:"key"`   // Industry, or sector for stocks without an industry
+	Basis        string   `json:"basis"` // industry or sector
+	Tickers      []string `json:"tickers"`
+	StockIDs     []uint   `json:"stock_ids"`
+	WeightPct    float64  `json:"weight_pct"`     // Combined percent (0–100) of invested value
+	MaxWeightPct float64  `json:"max_weight_pct"` // Cap the cluster is checked against (0 = off)
+	OverCap      bool     `json:"over_cap"`
+}
+
+// FindCorrelatedClusters groups held positions by a sector/industry heuristic: stocks sharing an
+// industry are one cluster, and stocks without an industry cluster by sector. Only groups of two or
+// more positions are returned, heaviest first; OverCap is set when a group's combined weight exceeds
+// maxWeightPct (0 = off).
+func FindCorrelatedClusters(stocks []models.Stock, fxRates map[string]float64, maxWeightPct float64) []CorrelatedCluster {
+	positionsEUR, invested := positionValuesEUR(stocks, fxRates)
+	if invested <= 0 {
+		return nil
+	}
+
+	byKey := make(map[string]*CorrelatedCluster)
+	var order []string
+	for i, stock := range stocks {
+		if positionsEUR[i] <= 0 {
+			continue
+		}
+		key, basis := strings.TrimSpace(stock.Industry), CorrelationBasisIndustry
+		if key == "" {
+			key, basis = strings.TrimSpace(stock.Sector), CorrelationBasisSector
+		}
+		if key == "" {
+			continue
+		}
+		mapKey := basis + ":" + strings.ToLower(key)
+		cluster, ok := byKey[mapKey]
+		if !ok {
+			cluster = &CorrelatedCluster{Key: key, Basis: basis, MaxWeightPct: maxWeightPct}
+			byKey[mapKey] = cluster
+			order = append(order, mapKey)
+		}
+		cluster.Tickers = append(cluster.Tickers, stock.Ticker)
+		cluster.StockIDs = append(cluster.StockIDs, stock.ID)
+		cluster.WeightPct += positionsEUR[i] / invested * 100
+	}
+
+	clusters := make([]CorrelatedCluster, 0, len(order))
+	for _, mapKey := range order {
+		cluster := byKey[mapKey]
+		if len(cluster.Tickers) < 2 {
+			continue
+		}
+		cluster.OverCap = maxWeightPct > 0 && cluster.WeightPct > maxWeightPct
+		clusters = append(clusters, *cluster)
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].WeightPct > clusters[j].WeightPct })
+	return clusters
+}
+
+// correlatedPositionsWarnings returns one warning per cluster over its cap, listing its positions.
+func correlatedPositionsWarnings(clusters []CorrelatedCluster, held []HealthPosition) []HealthWarning {
+	byID := make(map[uint]HealthPosition, len(held))
+	for _, position := range held {
+		byID[position.StockID] = position
+	}
+	var warnings []HealthWarning
+	for _, cluster := range clusters {
+		if !cluster.OverCap {
+			continue
+		}
+		positions := make([]HealthPosition, 0, len(cluster.StockIDs))
+		for _, id := range cluster.StockIDs {
+			if position, ok := byID[id]; ok {
+				positions = append(positions, position)
+			}
+		}
+		warnings = append(warnings, HealthWarning{
+			Code:      HealthWarningCorrelatedPositions,
+			Message:   fmt.Sprintf("%s (%s) positions %s together make up %.1f%%, above the %.1f%% cap for correlated positions", cluster.Key, cluster.Basis, strings.Join(cluster.Tickers, ", "), cluster.WeightPct, cluster.MaxWeightPct),
+			Positions: positions,
+		})
+	}
+	return warnings
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestCheckPortfolioHealthWarnsOnCorrelatedPositionsOverCap(t *testing.T) {
+	t.Parallel()
+	fxRates := map[string]float64{"EUR": 1}
+	// NOVO and LLY share an industry and hold 60% of invested value together; SAP and ASML are
+	// both Technology (no industry) at 40% combined.
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "NOVO", Sector: "Healthcare", Industry: "Pharmaceuticals", Currency: "EUR", CurrentPrice: 100, SharesOwned: 30},
+		{ID: 2, Ticker: "LLY", Sector: "Healthcare", Industry: "pharmaceuticals", Currency: "EUR", CurrentPrice: 100, SharesOwned: 30},
+		{ID: 3, Ticker: "SAP", Sector: "Technology", Currency: "EUR", CurrentPrice: 100, SharesOwned: 20},
+		{ID: 4, Ticker: "ASML", Sector: "Technology", Currency: "EUR", CurrentPrice: 100, SharesOwned: 20},
+	}
+
+	health := CheckPortfolioHealth(stocks, fxRates, HealthOptions{MaxCorrelatedWeight: 50})
+	if len(health.CorrelatedClusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %+v", health.CorrelatedClusters)
+	}
+	pharma := health.CorrelatedClusters[0]
+	if pharma.Basis != CorrelationBasisIndustry || !pharma.OverCap || len(pharma.Tickers) != 2 {
+		t.Fatalf("unexpected industry cluster: %+v", pharma)
+	}
+	assertClose(t, pharma.WeightPct, 60, 0.0001, "pharma Weight")
+	tech := health.CorrelatedClusters[1]
+	if tech.Basis != CorrelationBasisSector || tech.OverCap {
+		t.Fatalf("unexpected sector cluster: %+v", tech)
+	}
+
+	var warnings []HealthWarning
+	for _, warning := range health.Warnings {
+		if warning.Code == HealthWarningCorrelatedPositions {
+			warnings = append(warnings, warning)
+		}
+	}
+	if len(warnings) != 1 || len(warnings[0].Positions) != 2 {
+		t.Fatalf("expected one correlated_positions warning listing 2 positions, got %+v", health.Warnings)
+	}
+
+	// With the cap off the clusters are still reported but not flagged.
+	health = CheckPortfolioHealth(stocks, fxRates, HealthOptions{})
+	for _, warning := range health.Warnings {
+		if warning.Code == HealthWarningCorrelatedPositions {
+			t.Fatalf("expected no correlation warning with the cap off, got %+v", warning)
+		}
+	}
+}
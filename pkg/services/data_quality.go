@@ -0,0 +1,111 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+const (
+	// Prices at most this old count as fully fresh; freshness decays linearly to zero at dataQualityStaleAfter.
+	dataQualityFreshFor   = 24 * time.Hour
+	dataQualityStaleAfter = 7 * 24 * time.Hour
+	// Number of distinct fair value sources that earns the full source score.
+	dataQualityTargetSources = 3
+)
+
+// CalculateDataQuality returns a 0–100 score for how much a stock's metrics can be trusted.
+// Each input scores 0–1 and is combined using the configured weights:
+//   - freshness: age of LastUpdated
+//   - fair value sources: distinct recent sources (capped at 3); a manual fair value counts as one
+//   - beta, volatility: provided (> 0)
+//   - probability: provided and not the 0.65 default
+func CalculateDataQuality(stock *models.Stock, fairValueSources int, now time.Time, weights config.DataQualityWeights) float64 {
+	freshness := 0.0
+	if !stock.LastUpdated.IsZero() {
+		age := now.Sub(stock.LastUpdated)
+		switch {
+		case age <= dataQualityFreshFor:
+			freshness = 1
+		case age < dataQualityStaleAfter:
+			freshness = 1 - float64(age-dataQualityFreshFor)/float64(dataQualityStaleAfter-dataQualityFreshFor)
+		}
+	}
+
+	if fairValueSources == 0 && stock.FairValue > 0 && stock.FairValueSource != "" {
+		fairValueSources = 1
+	}
+	sources := math.Min(float64(fairValueSources), dataQualityTargetSources) / dataQualityTargetSources
+	if stock.FairValueStale {
+		sources /= 2
+	}
+
+	components := []struct {
+		weight, score float64
+	}{
+		{weights.Freshness, freshness},
+		{weights.FairValueSources, sources},
+		{weights.Beta, boolScore(stock.Beta > 0)},
+		{weights.Probability, boolScore(stock.ProbabilityPositive > 0 && stock.ProbabilityPositive <= 1 && stock.ProbabilityPositive != defaultProbabilityPositive)},
+		{weights.Volatility, boolScore(stock.Volatility > 0)},
+	}
+
+	var totalWeight, weighted float64
+	for _, component := range components {
+		if component.weight <= 0 {
+			continue
+		}
+		totalWeight += component.weight
+		weighted += component.weight * component.score
+	}
+	if totalWeight == 0 {
+		return 0
+	}
+	return weighted / totalWeight * 100
+}
+
+func boolScore(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// DataAgingWarning is surfaced when an EV-driven action rests on stale inputs.
+const DataAgingWarning = "data aging — re-collect"
+
+// EVAging returns a 0–1 confidence factor for a stock's EV based on the age of its last
+// fair value collection and last price update. Each input keeps full confidence up to its
+// max age and decays linearly to zero at twice that age; the lower of the two wins.
+// A warning is returned when either input is past its max age and the assessment is
+// Add, Trim or Sell. A stock without a recorded fair value collection is judged on price alone.
+func EVAging(stock *models.Stock, now time.Time, fairValueMaxAge, priceMaxAge time.Duration) (float64, string) {
+	confidence := 1.0
+	aging := false
+
+	decay := func(at time.Time, maxAge time.Duration) {
+		if at.IsZero() || maxAge <= 0 {
+			return
+		}
+		age := now.Sub(at)
+		if age <= maxAge {
+			return
+		}
+		aging = true
+		confidence = math.Min(confidence, math.Max(0, 1-float64(age-maxAge)/float64(maxAge)))
+	}
+	if stock.FairValueCollectedAt != nil {
+		decay(*stock.FairValueCollectedAt, fairValueMaxAge)
+	}
+	decay(stock.LastUpdated, priceMaxAge)
+
+	switch stock.Assessment {
+	case "Add", "Trim", "Sell":
+		if aging {
+			return confidence, DataAgingWarning
+		}
+	}
+	return confidence, ""
+}
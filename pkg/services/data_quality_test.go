@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+var testDataQualityWeights = config.DataQualityWeights{
+	Freshness:        30,
+	FairValueSources: 25,
+	Beta:             15,
+	Probability:      15,
+	Volatility:       15,
+}
+
+func TestCalculateDataQualityMissingInputsScoresLow(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	stock := models.Stock{
+		CurrentPrice: 100,
+		FairValue:    120,
+		LastUpdated:  now.Add(-10 * 24 * time.Hour),
+	}
+	CalculateMetrics(&stock, DefaultMetricsConfig()) // fills default probability and downside
+
+	score := CalculateDataQuality(&stock, 0, now, testDataQualityWeights)
+	if score > 10 {
+		t.Fatalf("expected low score for stock missing most inputs, got %.2f", score)
+	}
+}
+
+func TestCalculateDataQualityFullyPopulatedScoresHigh(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	stock := models.Stock{
+		CurrentPrice:        100,
+		FairValue:           120,
+		Beta:                1.1,
+		Volatility:          22,
+		ProbabilityPositive: 0.6,
+		LastUpdated:         now.Add(-2 * time.Hour),
+	}
+	CalculateMetrics(&stock, DefaultMetricsConfig())
+
+	assertClose(t, CalculateDataQuality(&stock, 3, now, testDataQualityWeights), 100, 0.0001, "DataQuality")
+
+	// Fewer sources and an older price lower the score proportionally.
+	stock.LastUpdated = now.Add(-4 * 24 * time.Hour) // halfway between fresh (1d) and stale (7d)
+	assertClose(t, CalculateDataQuality(&stock, 1, now, testDataQualityWeights), (30*0.5+25.0/3+45)/100*100, 0.0001, "DataQuality partial")
+}
+
+func TestEVAgingWarnsOnOldFairValue(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	collected := now.Add(-21 * 24 * time.Hour)
+	stock := models.Stock{
+		Assessment:           "Add",
+		LastUpdated:          now.Add(-time.Hour),
+		FairValueCollectedAt: &collected,
+	}
+
+	confidence, warning := EVAging(&stock, now, 14*24*time.Hour, 3*24*time.Hour)
+	if warning != DataAgingWarning {
+		t.Fatalf("expected aging warning, got %q", warning)
+	}
+	// 7 days past a 14-day max age decays confidence halfway.
+	assertClose(t, confidence, 0.5, 0.0001, "confidence")
+
+	stock.Assessment = "Hold"
+	if _, warning := EVAging(&stock, now, 14*24*time.Hour, 3*24*time.Hour); warning != "" {
+		t.Errorf("Hold should not warn, got %q", warning)
+	}
+
+	fresh := now.Add(-24 * time.Hour)
+	stock.Assessment = "Add"
+	stock.FairValueCollectedAt = &fresh
+	confidence, warning = EVAging(&stock, now, 14*24*time.Hour, 3*24*time.Hour)
+	if warning != "" || confidence != 1 {
+		t.Errorf("fresh inputs: got confidence %.2f warning %q", confidence, warning)
+	}
+}
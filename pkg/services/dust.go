@@ -0,0 +1,38 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// Dust position suggestions.
+const (
+	DustSuggestionConsolidate = "consolidate"
+	DustSuggestionExit        = "exit"
+)
+
+// DustPosition is a held position worth less than the configured minimum position value.
+type DustPosition struct {
+	StockID    uint    `json:"stock_id"`
+	Ticker     string  `json:"ticker"`
+	Value      float64 `json:"value"` // In the metrics' base currency
+	ValueEUR   float64 `json:"value_eur"`
+	WeightPct  float64 `json:"weight_pct"` // Percent (0–100) of total position value
+	Suggestion string  `json:"suggestion"`
+	Message    string  `json:"message"`
+}
+
+// newDustPosition flags stock as dust. Positions still worth adding to (EV at or above the Add
+// threshold) are suggested to be consolidated up to the minimum; the rest to be exited.
+func newDustPosition(stock models.Stock, value, valueEUR float64, cfg MetricsConfig) DustPosition {
+	position := DustPosition{StockID: stock.ID, Ticker: stock.Ticker, Value: value, ValueEUR: valueEUR}
+	if stock.ExpectedValue >= cfg.AddThreshold {
+		position.Suggestion = DustSuggestionConsolidate
+		position.Message = fmt.Sprintf("%s is worth %.2f EUR, below the %.2f EUR minimum position value; EV %.1f%% still supports adding up to the minimum", stock.Ticker, valueEUR, cfg.MinPositionValue, stock.ExpectedValue)
+	} else {
+		position.Suggestion = DustSuggestionExit
+		position.Message = fmt.Sprintf("%s is worth %.2f EUR, below the %.2f EUR minimum position value; consider exiting it", stock.Ticker, valueEUR, cfg.MinPositionValue)
+	}
+	return position
+}
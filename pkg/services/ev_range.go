@@ -0,0 +1,69 @@
+package services
+
+import "math"
+
+// EVRangeWeights are the probabilities assigned to the low, consensus and high fair value targets
+// when blending EV. They are normalized to sum to 1.
+type EVRangeWeights struct {
+	Low       float64 `json:"low"`
+	Consensus float64 `json:"consensus"`
+	High      float64 `json:"high"`
+}
+
+// DefaultEVRangeWeights weights the consensus twice as heavily as each extreme (a three-point
+// triangular distribution).
+func DefaultEVRangeWeights() EVRangeWeights {
+	return EVRangeWeights{Low: 0.25, Consensus: 0.5, High: 0.25}
+}
+
+// EVRange is EV evaluated at the low, consensus and high fair value targets, plus the
+// probability-weighted blend. EVs are percentages.
+type EVRange struct {
+	CurrentPrice       float64        `json:"current_price"`
+	LowFairValue       float64        `json:"low_fair_value"`
+	ConsensusFairValue float64        `json:"consensus_fair_value"`
+	HighFairValue      float64        `json:"high_fair_value"`
+	LowEV              float64        `json:"low_ev"`
+	ConsensusEV        float64        `json:"consensus_ev"`
+	HighEV             float64        `json:"high_ev"`
+	BlendedEV          float64        `json:"blended_ev"`
+	Weights            EVRangeWeights `json:"weights"`
+}
+
+// CalculateEVRange computes EV at each fair value target using the stock's probability and downside
+// risk, and blends them with weights (defaults when the weights are not positive).
+func CalculateEVRange(low, consensus, high, currentPrice, probabilityPositive, downsideRisk float64, weights EVRangeWeights) EVRange {
+	total := weights.Low + weights.Consensus + weights.High
+	if weights.Low < 0 || weights.Consensus < 0 || weights.High < 0 || total <= 0 {
+		weights = DefaultEVRangeWeights()
+		total = 1
+	}
+	weights = EVRangeWeights{Low: weights.Low / total, Consensus: weights.Consensus / total, High: weights.High / total}
+
+	result := EVRange{
+		CurrentPrice:       currentPrice,
+		LowFairValue:       low,
+		ConsensusFairValue: consensus,
+		HighFairValue:      high,
+		Weights:            weights,
+	}
+	result.LowEV = expectedValueAtPrice(low, probabilityPositive, downsideRisk, currentPrice)
+	result.ConsensusEV = expectedValueAtPrice(consensus, probabilityPositive, downsideRisk, currentPrice)
+	result.HighEV = expectedValueAtPrice(high, probabilityPositive, downsideRisk, currentPrice)
+	result.BlendedEV = weights.Low*result.LowEV + weights.Consensus*result.ConsensusEV + weights.High*result.HighEV
+	return result
+}
+
+// FairValueRange returns the low (min), consensus (per-provider median) and high (max) fair value
+// targets of collected entries, or zeros when there are none.
+func FairValueRange(entries []NormalizedFairValueEntry) (low, consensus, high float64) {
+	if len(entries) == 0 {
+		return 0, 0, 0
+	}
+	low, high = math.Inf(1), math.Inf(-1)
+	for _, entry := range entries {
+		low = math.Min(low, entry.FairValue)
+		high = math.Max(high, entry.FairValue)
+	}
+	return low, ConsensusFairValue(entries, 0).FairValue, high
+}
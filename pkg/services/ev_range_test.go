@@ -0,0 +1,29 @@
+package services
+
+import "testing"
+
+func TestCalculateEVRangeFromTargetSpread(t *testing.T) {
+	t.Parallel()
+	entries := []NormalizedFairValueEntry{
+		{FairValue: 90, Source: "Grok | Morningstar"},
+		{FairValue: 120, Source: "Grok | Reuters"},
+		{FairValue: 150, Source: "Deepseek | MarketScreener"},
+		{FairValue: 110, Source: "Deepseek | Yahoo Finance"},
+	}
+	low, consensus, high := FairValueRange(entries)
+	// Provider medians: Grok 105, Deepseek 130 -> consensus 117.5
+	assertClose(t, low, 90, 1e-9, "low")
+	assertClose(t, consensus, 117.5, 1e-9, "consensus")
+	assertClose(t, high, 150, 1e-9, "high")
+
+	// p = 0.6, downside -20%: EV = 0.6 * upside - 8
+	result := CalculateEVRange(90, 120, 150, 100, 0.6, -20, DefaultEVRangeWeights())
+	assertClose(t, result.LowEV, -14, 1e-9, "low_ev")
+	assertClose(t, result.ConsensusEV, 4, 1e-9, "consensus_ev")
+	assertClose(t, result.HighEV, 22, 1e-9, "high_ev")
+	assertClose(t, result.BlendedEV, 0.25*-14+0.5*4+0.25*22, 1e-9, "blended_ev")
+
+	// Weights are normalized, so 1:1:1 is an equal blend.
+	equal := CalculateEVRange(90, 120, 150, 100, 0.6, -20, EVRangeWeights{Low: 1, Consensus: 1, High: 1})
+	assertClose(t, equal.BlendedEV, (-14+4+22)/3.0, 1e-9, "equal blended_ev")
+}
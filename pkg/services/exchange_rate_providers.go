@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Exchange rate providers recorded on ExchangeRate.Provider and ExchangeRateHistory.Provider.
+// ExchangeRateProviderManual marks rates entered by the user.
+const (
+	ExchangeRateProviderExchangeRateAPI = "exchangerate-api"
+	ExchangeRateProviderFrankfurter     = "frankfurter"
+	ExchangeRateProviderManual          = "manual"
+)
+
+const defaultFrankfurterBaseURL = "https://api.frankfurter.app"
+
+// ExchangeRateProvider supplies the latest exchange rates as currency units per 1 EUR.
+type ExchangeRateProvider interface {
+	Name() string     // Recorded as the provider of each rate it supplies
+	Key() string      // Identifies the endpoint (and account) for refresh throttling
+	Configured() bool // False when the provider cannot be called, e.g. its API key is missing
+	LatestRates(ctx context.Context) (map[string]float64, error)
+}
+
+// exchangeRateAPIProvider fetches rates from exchangerate-api.com, which needs an API key.
+type exchangeRateAPIProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+	logger  zerolog.Logger
+}
+
+// NewExchangeRateAPIProvider returns the exchangerate-api.com provider for baseURL (the v6 API root)
+// and apiKey.
+func NewExchangeRateAPIProvider(baseURL, apiKey string, client *http.Client, logger zerolog.Logger) ExchangeRateProvider {
+	return &exchangeRateAPIProvider{baseURL: baseURL, apiKey: apiKey, client: client, logger: logger}
+}
+
+func (p *exchangeRateAPIProvider) Name() string     { return ExchangeRateProviderExchangeRateAPI }
+func (p *exchangeRateAPIProvider) Key() string      { return p.baseURL + "/" + p.apiKey }
+func (p *exchangeRateAPIProvider) Configured() bool { return p.apiKey != "" }
+
+// ExchangeRateAPIResponse represents the API response structure
+type ExchangeRateAPIResponse struct {
+	Result          string             `json:"result"`
+	Documentation   string             `json:"documentation"`
+	TermsOfUse      string             `json:"terms_of_use"`
+	TimeLastUpdate  int64              `json:"time_last_update_unix"`
+	TimeNextUpdate  int64              `json:"time_next_update_unix"`
+	BaseCode        string             `json:"base_code"`
+	ConversionRates map[string]float64 `json:"conversion_rates"`
+	ErrorType       string             `json:"error-type,omitempty"`
+}
+
+func (p *exchangeRateAPIProvider) LatestRates(ctx context.Context) (map[string]float64, error) {
+	body, status, err := getRatesBody(ctx, p.client, fmt.Sprintf("%s/%s/latest/EUR", p.baseURL, p.apiKey), p.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON response
+	var apiResp ExchangeRateAPIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for API errors
+	if apiResp.Result != "success" {
+		if apiResp.ErrorType == "invalid-key" || apiResp.ErrorType == "inactive-account" {
+			sharedProviderHealth.ReportAuthFailure("exchangerates", status)
+		}
+		return nil, fmt.Errorf("API error: %s", apiResp.ErrorType)
+	}
+	sharedProviderHealth.ReportSuccess("exchangerates")
+	return apiResp.ConversionRates, nil
+}
+
+// frankfurterProvider fetches the ECB reference rates from frankfurter.app, which needs no key.
+type frankfurterProvider struct {
+	baseURL string
+	client  *http.Client
+	logger  zerolog.Logger
+}
+
+// NewFrankfurterProvider returns the frankfurter.app provider for baseURL.
+func NewFrankfurterProvider(baseURL string, client *http.Client, logger zerolog.Logger) ExchangeRateProvider {
+	return &frankfurterProvider{baseURL: strings.TrimRight(baseURL, "/"), client: client, logger: logger}
+}
+
+func (p *frankfurterProvider) Name() string     { return ExchangeRateProviderFrankfurter }
+func (p *frankfurterProvider) Key() string      { return p.baseURL }
+func (p *frankfurterProvider) Configured() bool { return p.baseURL != "" }
+
+// frankfurterResponse is the body of GET /latest?from=EUR; rates omit the base currency.
+type frankfurterResponse struct {
+	Base  string             `json:"base"`
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+func (p *frankfurterProvider) LatestRates(ctx context.Context) (map[string]float64, error) {
+	body, _, err := getRatesBody(ctx, p.client, p.baseURL+"/latest?from=EUR", p.logger)
+	if err != nil {
+		return nil, err
+	}
+	var apiResp frankfurterResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if apiResp.Base != "EUR" || len(apiResp.Rates) == 0 {
+		return nil, fmt.Errorf("unexpected frankfurter response for base %q with %d rates", apiResp.Base, len(apiResp.Rates))
+	}
+	rates := make(map[string]float64, len(apiResp.Rates)+1)
+	for code, rate := range apiResp.Rates {
+		rates[code] = rate
+	}
+	rates["EUR"] = 1
+	sharedProviderHealth.ReportSuccess("frankfurter")
+	return rates, nil
+}
+
+// getRatesBody GETs url and returns the body of a 200 response with the status code.
+func getRatesBody(ctx context.Context, client *http.Client, url string, logger zerolog.Logger) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build exchange rate request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil {
+			logger.Warn().Err(cerr).Msg("Failed to close exchange rate response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("exchange rate API returned status %d", resp.StatusCode)
+	}
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, resp.StatusCode, nil
+}
@@ -2,24 +2,71 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/art-pro/stock-backend/pkg/models"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 )
 
+const defaultExchangeRateAPIBaseURL = "https://v6.exchangerate-api.com/v6"
+
+var (
+	// ErrNoExchangeRateProvider means no exchange rate provider is configured, so rates cannot be fetched.
+	ErrNoExchangeRateProvider = errors.New("no exchange rate provider configured")
+	// ErrCurrencyNotSupported means the exchange rate provider does not quote the currency.
+	ErrCurrencyNotSupported = errors.New("currency not supported by the exchange rate provider")
+)
+
+// DefaultRatesRefreshMinInterval is how long after a provider fetch further refreshes return the
+// stored rates instead of fetching again, when FX_REFRESH_MIN_INTERVAL_SECONDS is not set.
+const DefaultRatesRefreshMinInterval = 60 * time.Second
+
+// ratesRefreshGate lets one refresh per provider endpoint run at a time and remembers when each
+// endpoint was last fetched.
+type ratesRefreshGate struct {
+	flights singleflight.Group
+	mu      sync.Mutex
+	last    map[string]time.Time
+}
+
+// sharedRatesRefresh is shared by every service instance (the scheduler and the handlers each
+// create their own), so concurrent refreshes never race on the rate rows.
+var sharedRatesRefresh = &ratesRefreshGate{last: make(map[string]time.Time)}
+
+func (g *ratesRefreshGate) lastRefresh(key string) time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.last[key]
+}
+
+func (g *ratesRefreshGate) setLastRefresh(key string, at time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last[key] = at
+}
+
+// RatesRefresh is the outcome of RefreshLatestRates.
+type RatesRefresh struct {
+	RefreshedAt       time.Time // When the providers were last fetched (zero when none is configured)
+	RecentlyRefreshed bool      // The fetch was skipped because RefreshedAt is within the minimum interval
+	Provider          string    // Provider that supplied the rates of this fetch (empty when skipped)
+}
+
 // ExchangeRateService handles exchange rate operations
 type ExchangeRateService struct {
-	db         *gorm.DB
-	logger     zerolog.Logger
-	apiKey     string
-	httpClient *http.Client
+	db                 *gorm.DB
+	logger             zerolog.Logger
+	providers          []ExchangeRateProvider // Tried in order until one returns rates
+	minRefreshInterval time.Duration
 }
 
 // NewExchangeRateService creates a new exchange rate service
@@ -30,80 +77,115 @@ func NewExchangeRateService(db *gorm.DB, logger zerolog.Logger) *ExchangeRateSer
 		apiKey = os.Getenv("EXCHANGE_RATE_API_KEY")
 	}
 
-	return &ExchangeRateService{
-		db:     db,
-		logger: logger,
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 15 * time.Second,
-		},
+	minRefreshInterval := DefaultRatesRefreshMinInterval
+	if raw := os.Getenv("FX_REFRESH_MIN_INTERVAL_SECONDS"); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil && seconds >= 0 {
+			minRefreshInterval = time.Duration(seconds) * time.Second
+		}
 	}
-}
 
-// ExchangeRateAPIResponse represents the API response structure
-type ExchangeRateAPIResponse struct {
-	Result          string             `json:"result"`
-	Documentation   string             `json:"documentation"`
-	TermsOfUse      string             `json:"terms_of_use"`
-	TimeLastUpdate  int64              `json:"time_last_update_unix"`
-	TimeNextUpdate  int64              `json:"time_next_update_unix"`
-	BaseCode        string             `json:"base_code"`
-	ConversionRates map[string]float64 `json:"conversion_rates"`
-	ErrorType       string             `json:"error-type,omitempty"`
-}
+	client := &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: NewRateLimitedTransport(nil),
+	}
+	// exchangerate-api.com is primary; frankfurter.app (no key) is the fallback unless
+	// EXCHANGE_RATES_FALLBACK_PROVIDER is "none".
+	providers := []ExchangeRateProvider{NewExchangeRateAPIProvider(defaultExchangeRateAPIBaseURL, apiKey, client, logger)}
+	switch fallback := getEnvDefault("EXCHANGE_RATES_FALLBACK_PROVIDER", ExchangeRateProviderFrankfurter); fallback {
+	case ExchangeRateProviderFrankfurter:
+		providers = append(providers, NewFrankfurterProvider(getEnvDefault("FRANKFURTER_BASE_URL", defaultFrankfurterBaseURL), client, logger))
+	case "none":
+	default:
+		logger.Warn().Str("provider", fallback).Msg("Unknown EXCHANGE_RATES_FALLBACK_PROVIDER, no fallback exchange rate provider configured")
+	}
 
-// FetchLatestRates fetches the latest exchange rates from the API
-func (s *ExchangeRateService) FetchLatestRates() error {
-	// If no API key, skip fetching
-	if s.apiKey == "" {
-		s.logger.Warn().Msg("No exchange rate API key configured, using default rates")
-		return nil
+	return &ExchangeRateService{
+		db:                 db,
+		logger:             logger,
+		providers:          providers,
+		minRefreshInterval: minRefreshInterval,
 	}
+}
 
-	// Construct API URL
-	url := fmt.Sprintf("https://v6.exchangerate-api.com/v6/%s/latest/EUR", s.apiKey)
+// getEnvDefault returns the environment variable key, or fallback when it is unset or empty.
+func getEnvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
+// SetProvider makes the exchangerate-api.com endpoint, key and HTTP client the only provider (for tests).
+func (s *ExchangeRateService) SetProvider(baseURL, apiKey string, client *http.Client) {
+	s.SetProviders(NewExchangeRateAPIProvider(baseURL, apiKey, client, s.logger))
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to build exchange rate request: %w", err)
-	}
+// SetProviders replaces the providers, tried in the given order (for tests).
+func (s *ExchangeRateService) SetProviders(providers ...ExchangeRateProvider) {
+	s.providers = providers
+}
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch exchange rates: %w", err)
-	}
-	defer func() {
-		if cerr := resp.Body.Close(); cerr != nil {
-			s.logger.Warn().Err(cerr).Msg("Failed to close exchange rate response body")
+// configuredProviders returns the providers that can be called, in order.
+func (s *ExchangeRateService) configuredProviders() []ExchangeRateProvider {
+	var configured []ExchangeRateProvider
+	for _, provider := range s.providers {
+		if provider.Configured() {
+			configured = append(configured, provider)
 		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("exchange rate API returned status %d", resp.StatusCode)
 	}
+	return configured
+}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+// FetchLatestRates fetches the latest exchange rates from the API (see RefreshLatestRates).
+func (s *ExchangeRateService) FetchLatestRates() error {
+	_, err := s.RefreshLatestRates()
+	return err
+}
+
+// RefreshLatestRates fetches the latest exchange rates from the first provider that returns them
+// (see fetchConversionRates) and stores them. Only one refresh per provider chain runs at a time:
+// concurrent callers wait for it and share its result. Within FX_REFRESH_MIN_INTERVAL_SECONDS
+// (default 60, 0 = off) of the last successful fetch no provider is called and RecentlyRefreshed is set.
+func (s *ExchangeRateService) RefreshLatestRates() (RatesRefresh, error) {
+	providers := s.configuredProviders()
+	if len(providers) == 0 {
+		s.logger.Warn().Msg("No exchange rate provider configured, using default rates")
+		return RatesRefresh{}, nil
 	}
 
-	// Parse JSON response
-	var apiResp ExchangeRateAPIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	keys := make([]string, len(providers))
+	for i, provider := range providers {
+		keys[i] = provider.Key()
 	}
+	key := strings.Join(keys, "|")
+	result, err, _ := sharedRatesRefresh.flights.Do(key, func() (interface{}, error) {
+		if last := sharedRatesRefresh.lastRefresh(key); !last.IsZero() && time.Since(last) < s.minRefreshInterval {
+			return RatesRefresh{RefreshedAt: last, RecentlyRefreshed: true}, nil
+		}
+		provider, err := s.storeLatestRates()
+		if err != nil {
+			return RatesRefresh{}, err
+		}
+		now := time.Now()
+		sharedRatesRefresh.setLastRefresh(key, now)
+		return RatesRefresh{RefreshedAt: now, Provider: provider}, nil
+	})
+	return result.(RatesRefresh), err
+}
 
-	// Check for API errors
-	if apiResp.Result != "success" {
-		return fmt.Errorf("API error: %s", apiResp.ErrorType)
+// storeLatestRates fetches the providers' rates, updates the tracked, non-manual currencies and
+// appends each active currency's resulting rate (manual ones included) to ExchangeRateHistory. Each
+// rate is stored with the provider that supplied it. It returns that provider.
+func (s *ExchangeRateService) storeLatestRates() (string, error) {
+	conversionRates, provider, err := s.fetchConversionRates()
+	if err != nil {
+		return "", err
 	}
 
 	// Update rates in database
-	for code, rate := range apiResp.ConversionRates {
+	now := time.Now()
+	var history []models.ExchangeRateHistory
+	for code, rate := range conversionRates {
 		// Check if we track this currency
 		var exchangeRate models.ExchangeRate
 		result := s.db.Where("currency_code = ?", code).First(&exchangeRate)
@@ -112,16 +194,102 @@ func (s *ExchangeRateService) FetchLatestRates() error {
 			// Update existing rate if not manually set
 			if !exchangeRate.IsManual {
 				exchangeRate.Rate = rate
-				exchangeRate.LastUpdated = time.Now()
+				exchangeRate.Provider = provider
+				exchangeRate.LastUpdated = now
 				if err := s.db.Save(&exchangeRate).Error; err != nil {
 					s.logger.Error().Err(err).Str("currency", code).Msg("Failed to update exchange rate")
 				}
 			}
+			if exchangeRate.IsActive {
+				source := provider
+				if exchangeRate.IsManual {
+					source = ExchangeRateProviderManual
+				}
+				history = append(history, models.ExchangeRateHistory{CurrencyCode: code, Rate: exchangeRate.Rate, Provider: source, RecordedAt: now})
+			}
+		}
+	}
+	if len(history) > 0 {
+		if err := s.db.Create(&history).Error; err != nil {
+			s.logger.Error().Err(err).Msg("Failed to record exchange rate history")
 		}
 	}
 
-	s.logger.Info().Msg("Exchange rates updated successfully")
-	return nil
+	s.logger.Info().Str("provider", provider).Msg("Exchange rates updated successfully")
+	return provider, nil
+}
+
+// fetchConversionRates tries the configured providers in order and returns the first one's rates
+// (currency units per 1 EUR) with its name. A failing provider is logged and the next one tried;
+// the error joins every provider's failure. ErrNoExchangeRateProvider means none is configured.
+func (s *ExchangeRateService) fetchConversionRates() (map[string]float64, string, error) {
+	providers := s.configuredProviders()
+	if len(providers) == 0 {
+		return nil, "", ErrNoExchangeRateProvider
+	}
+
+	var errs []error
+	for _, provider := range providers {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		rates, err := provider.LatestRates(ctx)
+		cancel()
+		if err == nil {
+			return rates, provider.Name(), nil
+		}
+		s.logger.Warn().Err(err).Str("provider", provider.Name()).Msg("Exchange rate provider failed")
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// EnsureCurrency makes sure currencyCode is tracked, adding it (or reactivating a deleted entry)
+// with the provider's current rate when it is not. It reports whether a rate was added.
+// ErrNoExchangeRateProvider and ErrCurrencyNotSupported mean the rate must be added manually.
+func (s *ExchangeRateService) EnsureCurrency(currencyCode string) (bool, error) {
+	if currencyCode == "EUR" {
+		return false, nil
+	}
+
+	var existing models.ExchangeRate
+	err := s.db.Where("currency_code = ?", currencyCode).First(&existing).Error
+	if err == nil && existing.IsActive {
+		return false, nil
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return false, err
+	}
+
+	conversionRates, provider, fetchErr := s.fetchConversionRates()
+	if fetchErr != nil {
+		return false, fetchErr
+	}
+	rate, ok := conversionRates[currencyCode]
+	if !ok || rate <= 0 {
+		return false, ErrCurrencyNotSupported
+	}
+
+	if err == nil {
+		// Previously deleted: reactivate with the fresh rate.
+		existing.Rate = rate
+		existing.IsActive = true
+		existing.IsManual = false
+		existing.Provider = provider
+		existing.LastUpdated = time.Now()
+		if err := s.db.Save(&existing).Error; err != nil {
+			return false, err
+		}
+	} else if err := s.db.Create(&models.ExchangeRate{
+		CurrencyCode: currencyCode,
+		Rate:         rate,
+		LastUpdated:  time.Now(),
+		IsActive:     true,
+		Provider:     provider,
+	}).Error; err != nil {
+		return false, err
+	}
+
+	s.logger.Info().Str("currency", currencyCode).Float64("rate", rate).Str("provider", provider).Msg("Currency added automatically")
+	return true, nil
 }
 
 // GetAllRates returns all exchange rates
@@ -146,6 +314,38 @@ func (s *ExchangeRateService) GetRate(currencyCode string) (float64, error) {
 	return rate.Rate, nil
 }
 
+// GetRateOn returns the rate recorded for currencyCode closest to date, at or before it (see
+// ExchangeRateHistory). It falls back to the current rate (see GetRate) when none was recorded by
+// then.
+func (s *ExchangeRateService) GetRateOn(currencyCode string, date time.Time) (float64, error) {
+	var history models.ExchangeRateHistory
+	err := s.db.Where("currency_code = ? AND recorded_at <= ?", currencyCode, date).
+		Order("recorded_at DESC").
+		First(&history).Error
+	if err == nil {
+		return history.Rate, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return 0, err
+	}
+	return s.GetRate(currencyCode)
+}
+
+// LatestRateUpdate returns the most recent LastUpdated among active rates (zero when there are none).
+func (s *ExchangeRateService) LatestRateUpdate() (time.Time, error) {
+	rates, err := s.GetAllRates()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, rate := range rates {
+		if rate.LastUpdated.After(latest) {
+			latest = rate.LastUpdated
+		}
+	}
+	return latest, nil
+}
+
 // GetRatesMap returns a map of currency codes to rates
 func (s *ExchangeRateService) GetRatesMap() (map[string]float64, error) {
 	rates, err := s.GetAllRates()
@@ -161,7 +361,8 @@ func (s *ExchangeRateService) GetRatesMap() (map[string]float64, error) {
 	return rateMap, nil
 }
 
-// AddCurrency adds a new currency to track
+// AddCurrency adds a new currency to track. Only a manual rate is recorded with the manual provider;
+// a non-manual rate has none until the next provider refresh replaces it.
 func (s *ExchangeRateService) AddCurrency(currencyCode string, rate float64, isManual bool) error {
 	exchangeRate := models.ExchangeRate{
 		CurrencyCode: currencyCode,
@@ -170,11 +371,15 @@ func (s *ExchangeRateService) AddCurrency(currencyCode string, rate float64, isM
 		IsActive:     true,
 		IsManual:     isManual,
 	}
+	if isManual {
+		exchangeRate.Provider = ExchangeRateProviderManual
+	}
 
 	return s.db.Create(&exchangeRate).Error
 }
 
-// UpdateRate updates an exchange rate
+// UpdateRate updates an exchange rate. A manual rate is recorded with the manual provider; a
+// non-manual one keeps the provider that last served it, or none if it was manual.
 func (s *ExchangeRateService) UpdateRate(currencyCode string, rate float64, isManual bool) error {
 	var exchangeRate models.ExchangeRate
 	if err := s.db.Where("currency_code = ?", currencyCode).First(&exchangeRate).Error; err != nil {
@@ -183,6 +388,11 @@ func (s *ExchangeRateService) UpdateRate(currencyCode string, rate float64, isMa
 
 	exchangeRate.Rate = rate
 	exchangeRate.IsManual = isManual
+	if isManual {
+		exchangeRate.Provider = ExchangeRateProviderManual
+	} else if exchangeRate.Provider == ExchangeRateProviderManual {
+		exchangeRate.Provider = ""
+	}
 	exchangeRate.LastUpdated = time.Now()
 
 	return s.db.Save(&exchangeRate).Error
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"github.com/rs/zerolog"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRefreshRecordsRateHistoryAndGetRateOnLooksBack(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "exchange-rate-history-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ExchangeRate{}, &models.ExchangeRateHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.1, IsActive: true},
+		{CurrencyCode: "GBP", Rate: 0.85, IsActive: true, IsManual: true},
+		{CurrencyCode: "JPY", Rate: 150, IsActive: true},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+	// Deleted currencies stay in the table but are no longer recorded.
+	if err := db.Model(&models.ExchangeRate{}).Where("currency_code = ?", "JPY").Update("is_active", false).Error; err != nil {
+		t.Fatalf("deactivate JPY: %v", err)
+	}
+
+	service := NewExchangeRateService(db, zerolog.Nop())
+	service.minRefreshInterval = 0
+	service.SetProvider("https://fx-history.test/v6", "history-key", &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"result":"success","base_code":"EUR","conversion_rates":{"EUR":1,"USD":1.2,"GBP":0.9,"JPY":160,"CHF":0.95}}`)),
+			Request:    req,
+		}, nil
+	})})
+	if _, err := service.RefreshLatestRates(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	var recorded []models.ExchangeRateHistory
+	if err := db.Order("currency_code").Find(&recorded).Error; err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	got := make(map[string]float64, len(recorded))
+	for _, row := range recorded {
+		got[row.CurrencyCode] = row.Rate
+	}
+	want := map[string]float64{"EUR": 1, "GBP": 0.85, "USD": 1.2}
+	if len(got) != len(want) || len(recorded) != len(want) {
+		t.Fatalf("history rows: got %v want %v", got, want)
+	}
+	for code, rate := range want {
+		if got[code] != rate {
+			t.Errorf("%s history rate: got %.4f want %.4f", code, got[code], rate)
+		}
+	}
+
+	january := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	february := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	for _, row := range []models.ExchangeRateHistory{
+		{CurrencyCode: "USD", Rate: 1.05, RecordedAt: january},
+		{CurrencyCode: "USD", Rate: 1.10, RecordedAt: february},
+	} {
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatalf("create history: %v", err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		date time.Time
+		want float64
+	}{
+		{"between records", january.AddDate(0, 0, 14), 1.05},
+		{"exact record", february, 1.10},
+		{"before any record", january.AddDate(0, -1, 0), 1.2},
+	} {
+		rate, err := service.GetRateOn("USD", tc.date)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if rate != tc.want {
+			t.Errorf("%s: got %.4f want %.4f", tc.name, rate, tc.want)
+		}
+	}
+}
+
+func TestRefreshFailsOverToFallbackProviderAndRecordsIt(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "exchange-rate-failover-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ExchangeRate{}, &models.ExchangeRateHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	for _, rate := range []models.ExchangeRate{
+		{CurrencyCode: "EUR", Rate: 1, IsActive: true},
+		{CurrencyCode: "USD", Rate: 1.1, IsActive: true},
+		{CurrencyCode: "GBP", Rate: 0.85, IsActive: true, IsManual: true, Provider: ExchangeRateProviderManual},
+	} {
+		if err := db.Create(&rate).Error; err != nil {
+			t.Fatalf("create rate: %v", err)
+		}
+	}
+
+	var primaryCalls, fallbackCalls int
+	primary := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		primaryCalls++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})}
+	fallback := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		fallbackCalls++
+		if req.URL.Path != "/latest" || req.URL.Query().Get("from") != "EUR" {
+			t.Errorf("unexpected fallback request %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"amount":1.0,"base":"EUR","date":"2026-10-15","rates":{"USD":1.17,"GBP":0.87}}`)),
+			Request:    req,
+		}, nil
+	})}
+	// Refreshes are throttled per provider chain process-wide, so each run uses its own endpoints.
+	run := time.Now().UnixNano()
+	service := NewExchangeRateService(db, zerolog.Nop())
+	service.minRefreshInterval = 0
+	service.SetProviders(
+		NewExchangeRateAPIProvider(fmt.Sprintf("https://fx-primary-%d.test/v6", run), "primary-key", primary, zerolog.Nop()),
+		NewFrankfurterProvider(fmt.Sprintf("https://fx-fallback-%d.test", run), fallback, zerolog.Nop()),
+	)
+
+	refresh, err := service.RefreshLatestRates()
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if primaryCalls != 1 || fallbackCalls != 1 {
+		t.Fatalf("calls: primary %d fallback %d, want 1 each", primaryCalls, fallbackCalls)
+	}
+	if refresh.Provider != ExchangeRateProviderFrankfurter {
+		t.Errorf("refresh provider: got %q want %q", refresh.Provider, ExchangeRateProviderFrankfurter)
+	}
+
+	rates := make(map[string]models.ExchangeRate)
+	var stored []models.ExchangeRate
+	if err := db.Find(&stored).Error; err != nil {
+		t.Fatalf("load rates: %v", err)
+	}
+	for _, rate := range stored {
+		rates[rate.CurrencyCode] = rate
+	}
+	if usd := rates["USD"]; usd.Rate != 1.17 || usd.Provider != ExchangeRateProviderFrankfurter {
+		t.Errorf("USD: got %.2f from %q, want 1.17 from frankfurter", usd.Rate, usd.Provider)
+	}
+	if eur := rates["EUR"]; eur.Rate != 1 || eur.Provider != ExchangeRateProviderFrankfurter {
+		t.Errorf("EUR: got %.2f from %q, want 1 from frankfurter", eur.Rate, eur.Provider)
+	}
+	if gbp := rates["GBP"]; gbp.Rate != 0.85 || gbp.Provider != ExchangeRateProviderManual {
+		t.Errorf("manual GBP: got %.2f from %q, want 0.85 kept as manual", gbp.Rate, gbp.Provider)
+	}
+
+	var history []models.ExchangeRateHistory
+	if err := db.Find(&history).Error; err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+	for _, row := range history {
+		want := ExchangeRateProviderFrankfurter
+		if row.CurrencyCode == "GBP" {
+			want = ExchangeRateProviderManual
+		}
+		if row.Provider != want {
+			t.Errorf("%s history provider: got %q want %q", row.CurrencyCode, row.Provider, want)
+		}
+	}
+
+	// Without a primary API key the primary is skipped and the fallback serves directly.
+	service.SetProviders(
+		NewExchangeRateAPIProvider(fmt.Sprintf("https://fx-primary-%d.test/v6", run), "", primary, zerolog.Nop()),
+		NewFrankfurterProvider(fmt.Sprintf("https://fx-fallback-%d.test", run), fallback, zerolog.Nop()),
+	)
+	if refresh, err := service.RefreshLatestRates(); err != nil || refresh.Provider != ExchangeRateProviderFrankfurter {
+		t.Fatalf("refresh without primary key: provider %q err %v", refresh.Provider, err)
+	}
+	if primaryCalls != 1 || fallbackCalls != 2 {
+		t.Errorf("calls without primary key: primary %d fallback %d, want 1 and 2", primaryCalls, fallbackCalls)
+	}
+}
+
+func TestAddAndUpdateRateRecordManualProviderOnlyForManualRates(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "exchange-rate-manual-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.ExchangeRate{}, &models.ExchangeRateHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&models.ExchangeRate{CurrencyCode: "USD", Rate: 1.1, IsActive: true, Provider: ExchangeRateProviderFrankfurter}).Error; err != nil {
+		t.Fatalf("create rate: %v", err)
+	}
+	service := NewExchangeRateService(db, zerolog.Nop())
+
+	provider := func(code string) string {
+		var rate models.ExchangeRate
+		if err := db.Where("currency_code = ?", code).First(&rate).Error; err != nil {
+			t.Fatalf("load %s: %v", code, err)
+		}
+		return rate.Provider
+	}
+	if err := service.AddCurrency("SEK", 11.5, false); err != nil {
+		t.Fatalf("AddCurrency: %v", err)
+	}
+	if err := service.AddCurrency("NOK", 11.7, true); err != nil {
+		t.Fatalf("AddCurrency manual: %v", err)
+	}
+	if got := provider("SEK"); got != "" {
+		t.Errorf("non-manual SEK provider: got %q want none", got)
+	}
+	if got := provider("NOK"); got != ExchangeRateProviderManual {
+		t.Errorf("manual NOK provider: got %q want %q", got, ExchangeRateProviderManual)
+	}
+
+	if err := service.UpdateRate("USD", 1.12, false); err != nil {
+		t.Fatalf("UpdateRate: %v", err)
+	}
+	if got := provider("USD"); got != ExchangeRateProviderFrankfurter {
+		t.Errorf("non-manual USD update provider: got %q want %q kept", got, ExchangeRateProviderFrankfurter)
+	}
+	if err := service.UpdateRate("USD", 1.15, true); err != nil {
+		t.Fatalf("UpdateRate manual: %v", err)
+	}
+	if got := provider("USD"); got != ExchangeRateProviderManual {
+		t.Errorf("manual USD update provider: got %q want %q", got, ExchangeRateProviderManual)
+	}
+	if err := service.UpdateRate("USD", 1.1, false); err != nil {
+		t.Fatalf("UpdateRate back to non-manual: %v", err)
+	}
+	if got := provider("USD"); got != "" {
+		t.Errorf("USD provider after leaving manual: got %q want none", got)
+	}
+}
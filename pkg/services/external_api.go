@@ -3,6 +3,7 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,14 +16,16 @@ import (
 	"github.com/art-pro/stock-backend/pkg/models"
 )
 
+// ErrNoPriceData is returned when no provider produced a usable price for a ticker
+// (unknown or delisted symbol, or no provider configured). Retrying will not help.
+var ErrNoPriceData = errors.New("no price data for ticker")
+
 // ExternalAPIService handles all external API integrations
 type ExternalAPIService struct {
-	cfg                   *config.Config
-	client                *http.Client
-	exchangeRateCache     map[string]float64 // Cache for exchange rates from Grok
-	exchangeRateCacheMu   sync.RWMutex       // Mutex for thread-safe cache access
-	lastAlphaVantageCall  time.Time          // Track last API call for rate limiting
-	alphaVantageCallMutex sync.Mutex         // Mutex for thread-safe rate limiting
+	cfg                 *config.Config
+	client              *http.Client
+	exchangeRateCache   map[string]float64 // Cache for exchange rates from Grok
+	exchangeRateCacheMu sync.RWMutex       // Mutex for thread-safe cache access
 }
 
 // AlphaVantageQuote represents Alpha Vantage real-time quote data
@@ -60,6 +63,11 @@ type AlphaVantageOverview struct {
 	RevenuePerShareTTM         string `json:"RevenuePerShareTTM"`
 	ProfitMargin               string `json:"ProfitMargin"`
 	AnalystTargetPrice         string `json:"AnalystTargetPrice"`
+	AnalystRatingStrongBuy     string `json:"AnalystRatingStrongBuy"`
+	AnalystRatingBuy           string `json:"AnalystRatingBuy"`
+	AnalystRatingHold          string `json:"AnalystRatingHold"`
+	AnalystRatingSell          string `json:"AnalystRatingSell"`
+	AnalystRatingStrongSell    string `json:"AnalystRatingStrongSell"`
 	TrailingPE                 string `json:"TrailingPE"`
 	ForwardPE                  string `json:"ForwardPE"`
 	PriceToSalesRatioTTM       string `json:"PriceToSalesRatioTTM"`
@@ -79,33 +87,11 @@ func NewExternalAPIService(cfg *config.Config) *ExternalAPIService {
 	return &ExternalAPIService{
 		cfg: cfg,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: NewRateLimitedTransport(nil), // Alpha Vantage free tier: 5 calls/min
 		},
-		exchangeRateCache:    make(map[string]float64),
-		lastAlphaVantageCall: time.Time{},
-	}
-}
-
-// enforceAlphaVantageRateLimit ensures we don't exceed 5 calls per minute for free tier
-// Premium tiers: 30 calls/min (75 calls/min for higher tiers)
-func (s *ExternalAPIService) enforceAlphaVantageRateLimit() {
-	s.alphaVantageCallMutex.Lock()
-	defer s.alphaVantageCallMutex.Unlock()
-
-	if !s.lastAlphaVantageCall.IsZero() {
-		timeSinceLastCall := time.Since(s.lastAlphaVantageCall)
-		// Free tier: 5 calls per minute = 1 call every 12 seconds
-		// We use 13 seconds to be safe
-		minInterval := 13 * time.Second
-
-		if timeSinceLastCall < minInterval {
-			sleepDuration := minInterval - timeSinceLastCall
-			fmt.Printf("⏱ Rate limiting: waiting %.1f seconds before next Alpha Vantage call...\n", sleepDuration.Seconds())
-			time.Sleep(sleepDuration)
-		}
+		exchangeRateCache: make(map[string]float64),
 	}
-
-	s.lastAlphaVantageCall = time.Now()
 }
 
 // cacheExchangeRate stores an exchange rate from Grok
@@ -169,6 +155,17 @@ func uniqueStrings(values []string) []string {
 	return result
 }
 
+// symbolCandidates returns the provider symbols to try for ticker, starting with its normalized
+// form when NORMALIZE_TICKERS is on.
+func (s *ExternalAPIService) symbolCandidates(ticker string) []string {
+	candidates := alphaVantageSymbolCandidates(ticker)
+	if !s.cfg.NormalizeTickers || len(candidates) == 0 {
+		return candidates
+	}
+	normalized := NormalizeTicker(ticker, TickerRulesFromConfig(s.cfg))
+	return uniqueStrings(append([]string{normalized}, candidates...))
+}
+
 func alphaVantageSymbolCandidates(ticker string) []string {
 	normalized := strings.ToUpper(strings.TrimSpace(ticker))
 	if normalized == "" {
@@ -218,15 +215,13 @@ func (s *ExternalAPIService) FetchAlphaVantageQuote(ticker string) (*AlphaVantag
 		return nil, fmt.Errorf("Alpha Vantage API key not configured")
 	}
 
-	candidates := alphaVantageSymbolCandidates(ticker)
+	candidates := s.symbolCandidates(ticker)
 	if len(candidates) == 0 {
 		return nil, fmt.Errorf("invalid ticker %q", ticker)
 	}
 
 	var lastErr error
 	for _, symbol := range candidates {
-		s.enforceAlphaVantageRateLimit()
-
 		params := url.Values{}
 		params.Set("function", "GLOBAL_QUOTE")
 		params.Set("symbol", symbol)
@@ -255,6 +250,7 @@ func (s *ExternalAPIService) FetchAlphaVantageQuote(ticker string) (*AlphaVantag
 			return nil, fmt.Errorf("Alpha Vantage rate limit reached (5 calls/minute for free tier)")
 		}
 		if bytes.Contains(body, []byte("Invalid API key")) {
+			sharedProviderHealth.ReportAuthFailure("alphavantage", resp.StatusCode)
 			return nil, fmt.Errorf("invalid Alpha Vantage API key")
 		}
 
@@ -274,6 +270,7 @@ func (s *ExternalAPIService) FetchAlphaVantageQuote(ticker string) (*AlphaVantag
 		if quote.Information != "" {
 			fmt.Printf("ℹ️ Alpha Vantage info (%s): %s\n", symbol, quote.Information)
 		}
+		sharedProviderHealth.ReportSuccess("alphavantage")
 		if quote.GlobalQuote.Symbol == "" {
 			lastErr = fmt.Errorf("%s: no data returned", symbol)
 			continue
@@ -287,21 +284,80 @@ func (s *ExternalAPIService) FetchAlphaVantageQuote(ticker string) (*AlphaVantag
 	return nil, fmt.Errorf("no data returned for ticker %s", ticker)
 }
 
+// alphaVantageSymbolSearch is the SYMBOL_SEARCH response.
+type alphaVantageSymbolSearch struct {
+	BestMatches []struct {
+		Symbol string `json:"1. symbol"`
+		Name   string `json:"2. name"`
+	} `json:"bestMatches"`
+	Note         string `json:"Note,omitempty"`
+	ErrorMessage string `json:"Error Message,omitempty"`
+	Information  string `json:"Information,omitempty"`
+}
+
+// ResolveTicker reports whether the ticker (or one of its exchange-suffixed variants) is a listed
+// security according to Alpha Vantage symbol search. An error means the lookup itself failed
+// (no API key, rate limit, network) and says nothing about the ticker.
+func (s *ExternalAPIService) ResolveTicker(ticker string) (bool, error) {
+	if s.cfg.AlphaVantageAPIKey == "" {
+		return false, fmt.Errorf("Alpha Vantage API key not configured")
+	}
+
+	candidates := s.symbolCandidates(ticker)
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	params := url.Values{}
+	params.Set("function", "SYMBOL_SEARCH")
+	params.Set("keywords", strings.Fields(candidates[0])[0])
+	params.Set("apikey", s.cfg.AlphaVantageAPIKey)
+	params.Set("datatype", "json")
+
+	resp, err := s.client.Get("https://www.alphavantage.co/query?" + params.Encode())
+	if err != nil {
+		return false, fmt.Errorf("failed to search symbol: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("symbol search returned status %d", resp.StatusCode)
+	}
+
+	var result alphaVantageSymbolSearch
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode symbol search: %w", err)
+	}
+	if result.Note != "" || result.Information != "" {
+		return false, fmt.Errorf("Alpha Vantage rate limit: %s%s", result.Note, result.Information)
+	}
+	if result.ErrorMessage != "" {
+		return false, fmt.Errorf("Alpha Vantage error: %s", result.ErrorMessage)
+	}
+	sharedProviderHealth.ReportSuccess("alphavantage")
+
+	for _, match := range result.BestMatches {
+		for _, candidate := range candidates {
+			if strings.EqualFold(match.Symbol, candidate) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
 // FetchAlphaVantageOverview fetches company fundamentals from Alpha Vantage
 func (s *ExternalAPIService) FetchAlphaVantageOverview(ticker string) (*AlphaVantageOverview, error) {
 	if s.cfg.AlphaVantageAPIKey == "" {
 		return nil, fmt.Errorf("Alpha Vantage API key not configured")
 	}
 
-	candidates := alphaVantageSymbolCandidates(ticker)
+	candidates := s.symbolCandidates(ticker)
 	if len(candidates) == 0 {
 		return nil, fmt.Errorf("invalid ticker %q", ticker)
 	}
 
 	var lastErr error
 	for _, symbol := range candidates {
-		s.enforceAlphaVantageRateLimit()
-
 		params := url.Values{}
 		params.Set("function", "OVERVIEW")
 		params.Set("symbol", symbol)
@@ -330,6 +386,7 @@ func (s *ExternalAPIService) FetchAlphaVantageOverview(ticker string) (*AlphaVan
 			return nil, fmt.Errorf("Alpha Vantage rate limit reached (5 calls/minute for free tier)")
 		}
 		if bytes.Contains(body, []byte("Invalid API key")) {
+			sharedProviderHealth.ReportAuthFailure("alphavantage", resp.StatusCode)
 			return nil, fmt.Errorf("invalid Alpha Vantage API key")
 		}
 
@@ -349,6 +406,7 @@ func (s *ExternalAPIService) FetchAlphaVantageOverview(ticker string) (*AlphaVan
 		if overview.Information != "" {
 			fmt.Printf("ℹ️ Alpha Vantage info (%s): %s\n", symbol, overview.Information)
 		}
+		sharedProviderHealth.ReportSuccess("alphavantage")
 		if overview.Symbol == "" {
 			lastErr = fmt.Errorf("%s: no overview data returned", symbol)
 			continue
@@ -423,7 +481,8 @@ type GrokStockData struct {
 	DataSource          string  `json:"data_source"`
 }
 
-// FetchAllStockData fetches all stock data using Alpha Vantage (primary) and Grok (analysis)
+// FetchAllStockData fetches all stock data using Alpha Vantage (primary) and Grok (analysis).
+// Derived metrics use the default MetricsConfig; callers recompute them with the portfolio's.
 func (s *ExternalAPIService) FetchAllStockData(stock *models.Stock) error {
 	var dataSource string
 	var fairValueSource string
@@ -435,6 +494,9 @@ func (s *ExternalAPIService) FetchAllStockData(stock *models.Stock) error {
 		// Fetch current price
 		quote, err := s.FetchAlphaVantageQuote(stock.Ticker)
 		if err == nil && quote.GlobalQuote.Price != "" {
+			if err := s.checkQuoteTrading(stock.Ticker, quote, time.Now()); err != nil {
+				return err
+			}
 			stock.CurrentPrice = parseFloat(quote.GlobalQuote.Price)
 			dataSource = "Alpha Vantage"
 			fmt.Printf("✓ Current price from Alpha Vantage: %.2f\n", stock.CurrentPrice)
@@ -483,7 +545,7 @@ func (s *ExternalAPIService) FetchAllStockData(stock *models.Stock) error {
 			}
 
 			// Use CalculateMetrics to compute derived values
-			CalculateMetrics(stock)
+			CalculateMetrics(stock, DefaultMetricsConfig())
 			stock.LastUpdated = time.Now()
 			return nil
 		}
@@ -557,7 +619,7 @@ VERIFY: Current price must be LOWER than fair value if upside is positive. Use r
 
 	// Build Grok API request
 	reqBody := GrokStockRequest{
-		Model: "grok-4-fast-reasoning",
+		Model: s.cfg.ModelFor(config.UseCaseStockData, "grok"),
 		Messages: []Message{
 			{
 				Role:    "system",
@@ -636,6 +698,7 @@ VERIFY: Current price must be LOWER than fair value if upside is positive. Use r
 		fmt.Printf("Failed to parse Grok response JSON: %v\n", err)
 		return s.mockStockData(stock)
 	}
+	RecordProviderSuccess(resp)
 
 	// Extract the JSON content from Grok's response
 	if len(grokResp.Choices) == 0 {
@@ -680,7 +743,7 @@ VERIFY: Current price must be LOWER than fair value if upside is positive. Use r
 	}
 
 	// Recalculate metrics using our corrected formulas
-	CalculateMetrics(stock)
+	CalculateMetrics(stock, DefaultMetricsConfig())
 
 	// Store exchange rate for later use (will be retrieved by FetchExchangeRate)
 	s.cacheExchangeRate(stock.Currency, analysis.ExchangeRateToUSD)
@@ -754,6 +817,9 @@ func (s *ExternalAPIService) FetchStockPrice(ticker string) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
+	if tempStock.CurrentPrice <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNoPriceData, ticker)
+	}
 
 	return tempStock.CurrentPrice, nil
 }
@@ -847,6 +913,9 @@ func (s *ExternalAPIService) FetchFromAlphaVantage(stock *models.Stock) error {
 		return fmt.Errorf("no price data returned for %s", stock.Ticker)
 	}
 
+	if err := s.checkQuoteTrading(stock.Ticker, quote, time.Now()); err != nil {
+		return err
+	}
 	stock.CurrentPrice = parseFloat(quote.GlobalQuote.Price)
 	fmt.Printf("✓ Current price: %.2f\n", stock.CurrentPrice)
 
@@ -893,7 +962,7 @@ func (s *ExternalAPIService) FetchFromAlphaVantage(stock *models.Stock) error {
 	stock.DataSource = "Alpha Vantage (Raw Data)"
 
 	// Calculate all derived metrics (EV, Kelly, assessment, etc.)
-	CalculateMetrics(stock)
+	CalculateMetrics(stock, DefaultMetricsConfig())
 	stock.LastUpdated = time.Now()
 
 	fmt.Printf("✅ Alpha Vantage fetch complete for %s\n", stock.Ticker)
@@ -972,7 +1041,7 @@ Return ONLY valid JSON (no markdown, no extra text):
 }`, stock.Ticker, stock.ISIN, stock.CompanyName, stock.Sector, stock.Currency, stock.Sector, stock.Currency)
 
 	req := GrokStockRequest{
-		Model: "grok-4-fast-reasoning",
+		Model: s.cfg.ModelFor(config.UseCaseStockData, "grok"),
 		Messages: []Message{
 			{
 				Role:    "user",
@@ -1016,6 +1085,7 @@ Return ONLY valid JSON (no markdown, no extra text):
 	if err := json.Unmarshal(body, &grokResp); err != nil {
 		return fmt.Errorf("failed to decode Grok response: %w", err)
 	}
+	RecordProviderSuccess(resp)
 
 	// Store the raw Grok response
 	stock.GrokRawJSON = string(body)
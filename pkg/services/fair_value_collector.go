@@ -1,11 +1,10 @@
 package services
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
 	"regexp"
 	"sort"
@@ -15,6 +14,7 @@ import (
 
 	"github.com/art-pro/stock-backend/pkg/config"
 	"github.com/art-pro/stock-backend/pkg/models"
+	"golang.org/x/sync/singleflight"
 )
 
 type FairValueSourceEntry struct {
@@ -34,180 +34,280 @@ type NormalizedFairValueEntry struct {
 	RecordedAt time.Time
 }
 
+// defaultFairValueMaxPriceMultiple bounds fair values relative to the current price when not configured.
+const defaultFairValueMaxPriceMultiple = 5.0
+
+// sharedFairValueFlights deduplicates concurrent collections across collector instances (the
+// scheduler and the handlers each create their own).
+var sharedFairValueFlights singleflight.Group
+
 type FairValueCollector struct {
-	cfg    *config.Config
-	client *http.Client
+	cfg       *config.Config
+	client    *http.Client
+	providers map[string]LLMProvider // Per-provider overrides ("grok", "deepseek"); others are built from cfg
+	flights   *singleflight.Group
 }
 
 func NewFairValueCollector(cfg *config.Config) *FairValueCollector {
 	return &FairValueCollector{
 		cfg: cfg,
 		client: &http.Client{
-			Timeout: 120 * time.Second,
+			Timeout:   120 * time.Second,
+			Transport: NewRateLimitedTransport(nil),
 		},
+		flights: &sharedFairValueFlights,
 	}
 }
 
+// Reasons a provider fair value entry is rejected before acceptance.
+const (
+	RejectImplausibleFairValue = "implausible_fair_value" // Not positive, or absurdly large
+	RejectOutsidePriceBand     = "outside_price_band"     // More than FairValueMaxPriceMultiple above/below the current price
+	RejectMissingSource        = "missing_source"         // Provider named no source (when FAIR_VALUE_REQUIRE_SOURCE is on)
+	RejectBlockedSource        = "blocked_source"         // Source or URL matches FAIR_VALUE_SOURCE_BLOCKLIST
+	RejectUnparseableDate      = "unparseable_date"       // as_of missing or not a recognizable date
+	RejectStaleDate            = "stale_date"             // as_of outside the current month
+)
+
+// FairValueRejection describes a provider entry dropped by validation.
+type FairValueRejection struct {
+	Provider  string  `json:"provider"`
+	Source    string  `json:"source"`
+	FairValue float64 `json:"fair_value"`
+	AsOf      string  `json:"as_of"`
+	Reason    string  `json:"reason"`
+}
+
+// FairValueCollection is the outcome of a collection run: accepted entries plus diagnostics
+// explaining every dropped entry and provider failure.
+type FairValueCollection struct {
+	Entries        []NormalizedFairValueEntry `json:"-"`
+	Received       int                        `json:"received"`
+	Rejections     []FairValueRejection       `json:"rejections"`
+	ProviderErrors []string                   `json:"provider_errors"`
+}
+
 func (c *FairValueCollector) CollectTrustedFairValues(ctx context.Context, stock *models.Stock) ([]NormalizedFairValueEntry, error) {
-	var all []FairValueSourceEntry
-	var errs []string
+	collection, err := c.CollectWithDiagnostics(ctx, stock)
+	if err != nil {
+		return nil, err
+	}
+	return collection.Entries, nil
+}
 
-	if c.cfg.XAIAPIKey != "" {
-		entries, err := c.collectFromGrok(ctx, stock)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("grok: %v", err))
-		} else {
-			for _, e := range entries {
-				if strings.TrimSpace(e.Source) == "" {
-					e.Source = "Grok"
-				} else {
-					e.Source = "Grok | " + e.Source
-				}
-				all = append(all, e)
-			}
-		}
+// CollectWithDiagnostics collects fair values from every configured provider and validates each
+// entry, returning the accepted entries and the reason each rejected entry was dropped. It errors
+// when no entry is accepted; the returned collection still carries the diagnostics.
+//
+// With FAIR_VALUE_SINGLEFLIGHT on (default), concurrent calls for the same ticker share one
+// in-flight run and its result. The shared run is not cancelled when one caller's context is;
+// each caller stops waiting when its own context ends.
+func (c *FairValueCollector) CollectWithDiagnostics(ctx context.Context, stock *models.Stock) (FairValueCollection, error) {
+	if !c.cfg.FairValueSingleflight || c.flights == nil {
+		return c.collectWithDiagnostics(ctx, stock)
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(stock.Ticker))
+	shared := *stock
+	flight := c.flights.DoChan(key, func() (interface{}, error) {
+		collection, err := c.collectWithDiagnostics(context.WithoutCancel(ctx), &shared)
+		return collection, err
+	})
+	select {
+	case <-ctx.Done():
+		return FairValueCollection{Rejections: []FairValueRejection{}, ProviderErrors: []string{}}, ctx.Err()
+	case result := <-flight:
+		collection := result.Val.(FairValueCollection)
+		// Callers own their copy of the shared result.
+		collection.Entries = append([]NormalizedFairValueEntry(nil), collection.Entries...)
+		collection.Rejections = append([]FairValueRejection{}, collection.Rejections...)
+		collection.ProviderErrors = append([]string{}, collection.ProviderErrors...)
+		return collection, result.Err
 	}
+}
 
-	if c.cfg.DeepseekAPIKey != "" {
-		entries, err := c.collectFromDeepseek(ctx, stock)
+func (c *FairValueCollector) collectWithDiagnostics(ctx context.Context, stock *models.Stock) (FairValueCollection, error) {
+	collection := FairValueCollection{Rejections: []FairValueRejection{}, ProviderErrors: []string{}}
+	type providerEntry struct {
+		provider string
+		entry    FairValueSourceEntry
+	}
+	var all []providerEntry
+
+	providers := []struct {
+		name   string
+		apiKey string
+	}{
+		{"Grok", c.cfg.XAIAPIKey},
+		{"Deepseek", c.cfg.DeepseekAPIKey},
+	}
+	for _, provider := range providers {
+		key := strings.ToLower(provider.name)
+		if provider.apiKey == "" && c.providers[key] == nil {
+			continue
+		}
+		entries, err := c.callLLM(ctx, c.llmProvider(key), stock)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("deepseek: %v", err))
-		} else {
-			for _, e := range entries {
-				if strings.TrimSpace(e.Source) == "" {
-					e.Source = "Deepseek"
-				} else {
-					e.Source = "Deepseek | " + e.Source
-				}
-				all = append(all, e)
-			}
+			collection.ProviderErrors = append(collection.ProviderErrors, fmt.Sprintf("%s: %v", strings.ToLower(provider.name), err))
+			continue
+		}
+		for _, e := range entries {
+			all = append(all, providerEntry{provider: provider.name, entry: e})
 		}
 	}
+	collection.Received = len(all)
 
 	if len(all) == 0 {
-		if len(errs) > 0 {
-			return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+		if len(collection.ProviderErrors) > 0 {
+			return collection, fmt.Errorf("%s", strings.Join(collection.ProviderErrors, "; "))
 		}
-		return nil, fmt.Errorf("no LLM provider configured (XAI_API_KEY / DEEPSEEK_API_KEY)")
+		return collection, fmt.Errorf("no LLM provider configured (XAI_API_KEY / DEEPSEEK_API_KEY)")
 	}
 
 	valid := make([]NormalizedFairValueEntry, 0, len(all))
 	now := time.Now().UTC()
-
-	for _, entry := range all {
-		normalized, ok := normalizeLLMEntry(entry, now)
-		if !ok {
+	maxMultiple := c.cfg.FairValueMaxPriceMultiple
+	if maxMultiple <= 1 {
+		maxMultiple = defaultFairValueMaxPriceMultiple
+	}
+
+	for _, item := range all {
+		entry := item.entry
+		reason := ""
+		if strings.TrimSpace(entry.Source) == "" && c.cfg.FairValueRequireSource {
+			reason = RejectMissingSource
+		} else if sourceBlocked(entry, c.cfg.FairValueSourceBlocklist) {
+			reason = RejectBlockedSource
+		}
+		if strings.TrimSpace(entry.Source) == "" {
+			entry.Source = item.provider
+		} else {
+			entry.Source = item.provider + " | " + entry.Source
+		}
+		var normalized NormalizedFairValueEntry
+		if reason == "" {
+			normalized, reason = validateLLMEntry(entry, stock.CurrentPrice, maxMultiple, now)
+		}
+		if reason != "" {
+			collection.Rejections = append(collection.Rejections, FairValueRejection{
+				Provider:  item.provider,
+				Source:    item.entry.Source,
+				FairValue: item.entry.FairValue,
+				AsOf:      item.entry.AsOf,
+				Reason:    reason,
+			})
 			continue
 		}
 		valid = append(valid, normalized)
 	}
+	collection.Entries = valid
 
 	if len(valid) < 1 {
 		errDetail := fmt.Sprintf("no usable fair value entries (received=%d)", len(all))
-		if len(errs) > 0 {
-			errDetail = errDetail + "; provider_errors=" + strings.Join(errs, " | ")
+		if summary := rejectionSummary(collection.Rejections); summary != "" {
+			errDetail = errDetail + "; rejected=" + summary
 		}
-		return nil, fmt.Errorf("%s", errDetail)
+		if len(collection.ProviderErrors) > 0 {
+			errDetail = errDetail + "; provider_errors=" + strings.Join(collection.ProviderErrors, " | ")
+		}
+		return collection, fmt.Errorf("%s", errDetail)
 	}
 
-	return valid, nil
+	return collection, nil
 }
 
-func (c *FairValueCollector) collectFromGrok(ctx context.Context, stock *models.Stock) ([]FairValueSourceEntry, error) {
-	prompt := buildFairValuePrompt(stock)
-	reqBody := map[string]interface{}{
-		"model": "grok-4-fast-reasoning",
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a strict financial data assistant. Use only trustworthy and recent sources. Return JSON only.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"stream": false,
+// sourceBlocked reports whether the entry's source or source URL contains one of the blocklist's
+// lower-cased substrings, ignoring case.
+func sourceBlocked(entry FairValueSourceEntry, blocklist []string) bool {
+	source := strings.ToLower(entry.Source + " " + entry.SourceURL)
+	for _, blocked := range blocklist {
+		if blocked != "" && strings.Contains(source, blocked) {
+			return true
+		}
 	}
-	return c.callLLM(ctx, "https://api.x.ai/v1/chat/completions", c.cfg.XAIAPIKey, reqBody)
+	return false
 }
 
-func (c *FairValueCollector) collectFromDeepseek(ctx context.Context, stock *models.Stock) ([]FairValueSourceEntry, error) {
-	prompt := buildFairValuePrompt(stock)
-	reqBody := map[string]interface{}{
-		"model": "deepseek-reasoner",
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a strict financial data assistant. Use only trustworthy and recent sources. Return JSON only.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"stream": false,
+// rejectionSummary counts rejections per reason, e.g. "stale_date=2, missing_source=1".
+func rejectionSummary(rejections []FairValueRejection) string {
+	counts := make(map[string]int)
+	var reasons []string
+	for _, rejection := range rejections {
+		if counts[rejection.Reason] == 0 {
+			reasons = append(reasons, rejection.Reason)
+		}
+		counts[rejection.Reason]++
 	}
-	return c.callLLM(ctx, "https://api.deepseek.com/v1/chat/completions", c.cfg.DeepseekAPIKey, reqBody)
+	parts := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		parts = append(parts, fmt.Sprintf("%s=%d", reason, counts[reason]))
+	}
+	return strings.Join(parts, ", ")
 }
 
-func (c *FairValueCollector) callLLM(ctx context.Context, endpoint, apiKey string, body map[string]interface{}) ([]FairValueSourceEntry, error) {
-	jsonData, err := json.Marshal(body)
-	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
-	}
+// fairValueSystemPrompt is the system message for fair value collection across providers.
+const fairValueSystemPrompt = "You are a strict financial data assistant. Use only trustworthy and recent sources. Return JSON only."
 
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+// llmProvider returns the override for name ("grok" or "deepseek") if one is set, otherwise a
+// provider built from cfg on the collector's client.
+func (c *FairValueCollector) llmProvider(name string) LLMProvider {
+	if provider, ok := c.providers[name]; ok {
+		return provider
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("call provider: %w", err)
+	if name == "deepseek" {
+		return NewDeepseekProvider(c.cfg, config.UseCaseFairValue, c.client)
 	}
-	defer func() { _ = resp.Body.Close() }()
+	return NewGrokProvider(c.cfg, config.UseCaseFairValue, c.client)
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+// callLLM asks provider for the stock's fair value entries. With FAIR_VALUE_LLM_CHOICES > 1 it samples
+// that many choices and aggregates the entries of every choice that parses.
+func (c *FairValueCollector) callLLM(ctx context.Context, provider LLMProvider, stock *models.Stock) ([]FairValueSourceEntry, error) {
+	ctx = WithProviderCallInfo(ctx, stock.Ticker, config.UseCaseFairValue)
+	contents, err := CompleteChoices(ctx, provider, fairValueSystemPrompt, buildFairValuePrompt(stock), c.cfg.FairValueLLMChoices)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("provider status %d: %s", resp.StatusCode, string(respBody))
+		return nil, fmt.Errorf("call provider: %w", err)
 	}
 
-	var parsed map[string]interface{}
-	if err := json.Unmarshal(respBody, &parsed); err != nil {
-		return nil, fmt.Errorf("parse provider response: %w", err)
-	}
+	return aggregateFairValueChoices(contents, c.cfg.LLMDecimalSeparator)
+}
 
-	choices, ok := parsed["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return nil, fmt.Errorf("missing choices in response")
-	}
-	choice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid choice format")
-	}
-	message, ok := choice["message"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid message format")
+// aggregateFairValueChoices parses each choice's content and merges the entries. Choices sampled
+// from the same prompt mostly repeat the same sources, so entries sharing a source and URL collapse
+// into one carrying their median value; otherwise each repeat would count again in the consensus.
+// It fails only when no choice parses.
+func aggregateFairValueChoices(contents []string, decimalSeparator string) ([]FairValueSourceEntry, error) {
+	var entries []FairValueSourceEntry
+	values := make(map[string][]float64)
+	var parseErr error
+	for _, content := range contents {
+		parsed, err := parseFairValueEntries(content, decimalSeparator)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+		for _, entry := range parsed {
+			key := fairValueEntryKey(entry)
+			if _, seen := values[key]; !seen {
+				entries = append(entries, entry)
+			}
+			values[key] = append(values[key], entry.FairValue)
+		}
 	}
-	content, ok := message["content"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing content")
+	if len(entries) == 0 && parseErr != nil {
+		return nil, fmt.Errorf("parse fair value JSON: %w", parseErr)
 	}
-
-	entries, err := parseFairValueEntries(content)
-	if err != nil {
-		return nil, fmt.Errorf("parse fair value JSON: %w", err)
+	for i := range entries {
+		entries[i].FairValue = Median(values[fairValueEntryKey(entries[i])])
 	}
-
 	return entries, nil
 }
 
+// fairValueEntryKey identifies an entry's source across choices: its name and URL, case-insensitive.
+func fairValueEntryKey(entry FairValueSourceEntry) string {
+	return strings.ToLower(strings.TrimSpace(entry.Source)) + "|" + strings.ToLower(strings.TrimSpace(entry.SourceURL))
+}
+
 func extractJSONContent(content string) string {
 	trimmed := strings.TrimSpace(content)
 	if strings.HasPrefix(trimmed, "```") {
@@ -218,7 +318,7 @@ func extractJSONContent(content string) string {
 	return strings.TrimSpace(trimmed)
 }
 
-func parseFairValueEntries(content string) ([]FairValueSourceEntry, error) {
+func parseFairValueEntries(content, decimalSeparator string) ([]FairValueSourceEntry, error) {
 	trimmed := extractJSONContent(content)
 	candidates := []string{trimmed}
 
@@ -234,19 +334,19 @@ func parseFairValueEntries(content string) ([]FairValueSourceEntry, error) {
 	}
 
 	for _, candidate := range candidates {
-		if entries, ok := parseEntriesFromJSONCandidate(candidate); ok && len(entries) > 0 {
+		if entries, ok := parseEntriesFromJSONCandidate(candidate, decimalSeparator); ok && len(entries) > 0 {
 			return entries, nil
 		}
 	}
 
-	if entries := parseEntriesFromPipeText(trimmed); len(entries) > 0 {
+	if entries := parseEntriesFromPipeText(trimmed, decimalSeparator); len(entries) > 0 {
 		return entries, nil
 	}
 
 	return nil, fmt.Errorf("could not parse entries from provider content")
 }
 
-func parseEntriesFromJSONCandidate(candidate string) ([]FairValueSourceEntry, bool) {
+func parseEntriesFromJSONCandidate(candidate, decimalSeparator string) ([]FairValueSourceEntry, bool) {
 	var wrapped fairValueLLMResponse
 	if err := json.Unmarshal([]byte(candidate), &wrapped); err == nil && len(wrapped.Entries) > 0 {
 		return wrapped.Entries, true
@@ -274,7 +374,7 @@ func parseEntriesFromJSONCandidate(candidate string) ([]FairValueSourceEntry, bo
 				if !ok {
 					continue
 				}
-				if entry, ok := coerceEntry(itemMap); ok {
+				if entry, ok := coerceEntry(itemMap, decimalSeparator); ok {
 					entries = append(entries, entry)
 				}
 			}
@@ -287,7 +387,7 @@ func parseEntriesFromJSONCandidate(candidate string) ([]FairValueSourceEntry, bo
 	return nil, false
 }
 
-func coerceEntry(item map[string]interface{}) (FairValueSourceEntry, bool) {
+func coerceEntry(item map[string]interface{}, decimalSeparator string) (FairValueSourceEntry, bool) {
 	readString := func(keys ...string) string {
 		for _, key := range keys {
 			if value, exists := item[key]; exists {
@@ -311,9 +411,7 @@ func coerceEntry(item map[string]interface{}) (FairValueSourceEntry, bool) {
 			case int:
 				return float64(v), true
 			case string:
-				cleaned := strings.TrimSpace(strings.ReplaceAll(v, ",", ""))
-				cleaned = strings.TrimPrefix(cleaned, "$")
-				if f, err := strconv.ParseFloat(cleaned, 64); err == nil {
+				if f, ok := parseLocaleNumber(v, decimalSeparator); ok {
 					return f, true
 				}
 			}
@@ -335,10 +433,69 @@ func coerceEntry(item map[string]interface{}) (FairValueSourceEntry, bool) {
 	return entry, true
 }
 
-func parseEntriesFromPipeText(content string) []FairValueSourceEntry {
+// Decimal separator conventions for numbers in LLM output (config.LLMDecimalSeparator).
+const (
+	DecimalSeparatorAuto  = "auto"  // Detect per number; "1,234" and "1.234" (one separator, three digits) read US-style
+	DecimalSeparatorDot   = "dot"   // 1,234.56: commas are always thousands separators
+	DecimalSeparatorComma = "comma" // 1.234,56: periods are always thousands separators
+)
+
+// parseLocaleNumber parses a number that may use either comma or period as the decimal separator.
+// In auto mode, when both appear the last one is the decimal separator; a single separator
+// that repeats ("1,234,567") or is not followed by exactly three digits ("123,45") is resolved
+// unambiguously, and only the remaining "1,234"/"1.234" shape falls back to US convention.
+func parseLocaleNumber(raw, decimalSeparator string) (float64, bool) {
+	cleaned := strings.TrimSpace(raw)
+	cleaned = strings.TrimPrefix(cleaned, "$")
+	cleaned = strings.TrimPrefix(cleaned, "€")
+	cleaned = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' || r == '\u202f' || r == '\'' {
+			return -1
+		}
+		return r
+	}, cleaned)
+
+	decimal := '.'
+	switch decimalSeparator {
+	case DecimalSeparatorComma:
+		decimal = ','
+	case DecimalSeparatorDot:
+		// Commas are thousands separators.
+	default:
+		lastComma, lastDot := strings.LastIndex(cleaned, ","), strings.LastIndex(cleaned, ".")
+		switch {
+		case lastComma >= 0 && lastDot >= 0:
+			if lastComma > lastDot {
+				decimal = ','
+			}
+		case lastComma >= 0:
+			if strings.Count(cleaned, ",") == 1 && len(cleaned)-lastComma-1 != 3 {
+				decimal = ','
+			}
+		case lastDot >= 0:
+			if strings.Count(cleaned, ".") > 1 {
+				decimal = ','
+			}
+		}
+	}
+
+	if decimal == ',' {
+		cleaned = strings.ReplaceAll(cleaned, ".", "")
+		cleaned = strings.Replace(cleaned, ",", ".", 1)
+	} else {
+		cleaned = strings.ReplaceAll(cleaned, ",", "")
+	}
+	f, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+func parseEntriesFromPipeText(content, decimalSeparator string) []FairValueSourceEntry {
 	lines := strings.Split(content, "\n")
 	datePattern := regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
-	numberPattern := regexp.MustCompile(`[-+]?\d+(?:,\d{3})*(?:\.\d+)?`)
+	numberPattern := regexp.MustCompile(`[-+]?\d+(?:[.,]\d+)*`)
 
 	entries := make([]FairValueSourceEntry, 0)
 	for _, rawLine := range lines {
@@ -383,8 +540,7 @@ func parseEntriesFromPipeText(content string) []FairValueSourceEntry {
 			}
 			if !hasFairValue {
 				if n := numberPattern.FindString(strings.ReplaceAll(part, "$", "")); n != "" {
-					n = strings.ReplaceAll(n, ",", "")
-					if f, err := strconv.ParseFloat(n, 64); err == nil && f > 0 {
+					if f, ok := parseLocaleNumber(n, decimalSeparator); ok && f > 0 {
 						fairValue = f
 						hasFairValue = true
 					}
@@ -443,9 +599,16 @@ JSON schema:
 }`, stock.Ticker, stock.ISIN, stock.CompanyName, stock.Currency, currentMonth, currentYear, stock.Currency)
 }
 
-func normalizeLLMEntry(entry FairValueSourceEntry, now time.Time) (NormalizedFairValueEntry, bool) {
+// validateLLMEntry checks a provider entry and returns it normalized, or the reason it was rejected.
+// When currentPrice is known, fair values more than maxMultiple above or below it are rejected as
+// likely hallucinations.
+func validateLLMEntry(entry FairValueSourceEntry, currentPrice, maxMultiple float64, now time.Time) (NormalizedFairValueEntry, string) {
 	if entry.FairValue <= 0 || entry.FairValue > 10000000 {
-		return NormalizedFairValueEntry{}, false
+		return NormalizedFairValueEntry{}, RejectImplausibleFairValue
+	}
+	if currentPrice > 0 && maxMultiple > 0 &&
+		(entry.FairValue > currentPrice*maxMultiple || entry.FairValue < currentPrice/maxMultiple) {
+		return NormalizedFairValueEntry{}, RejectOutsidePriceBand
 	}
 	source := strings.TrimSpace(entry.Source)
 	if source == "" {
@@ -457,19 +620,19 @@ func normalizeLLMEntry(entry FairValueSourceEntry, now time.Time) (NormalizedFai
 
 	recordedAt, ok := parseAsOfDate(entry.AsOf)
 	if !ok {
-		return NormalizedFairValueEntry{}, false
+		return NormalizedFairValueEntry{}, RejectUnparseableDate
 	}
 
 	// Strict freshness: source data must be from current month and year.
 	if recordedAt.Year() != now.Year() || recordedAt.Month() != now.Month() {
-		return NormalizedFairValueEntry{}, false
+		return NormalizedFairValueEntry{}, RejectStaleDate
 	}
 
 	return NormalizedFairValueEntry{
 		FairValue:  entry.FairValue,
 		Source:     source,
 		RecordedAt: recordedAt,
-	}, true
+	}, ""
 }
 
 func parseAsOfDate(raw string) (time.Time, bool) {
@@ -501,6 +664,76 @@ func parseAsOfDate(raw string) (time.Time, bool) {
 	return time.Time{}, false
 }
 
+// FairValueConsensus combines collected entries per provider: each provider's median first,
+// then the median of those. ProviderDisagreementPct is the spread between the highest and
+// lowest provider medians as a percentage of the consensus.
+type FairValueConsensus struct {
+	FairValue               float64            `json:"fair_value"`
+	ProviderMedians         map[string]float64 `json:"provider_medians"`
+	ProviderDisagreementPct float64            `json:"provider_disagreement_pct"`
+	ProvidersDisagree       bool               `json:"providers_disagree"` // Spread exceeds the configured maximum
+	DispersionPct           float64            `json:"dispersion_pct"`     // Coefficient of variation of all entries; 0 with fewer than two
+}
+
+// fairValueProvider returns the provider prefix of a collected entry's source ("Grok | Reuters" -> "Grok").
+func fairValueProvider(source string) string {
+	if idx := strings.Index(source, " | "); idx >= 0 {
+		return source[:idx]
+	}
+	return strings.TrimSpace(source)
+}
+
+// ConsensusFairValue computes the per-provider consensus for collected entries. Providers are
+// flagged as disagreeing when their medians differ by more than maxDisagreementPct (0 = never flag).
+func ConsensusFairValue(entries []NormalizedFairValueEntry, maxDisagreementPct float64) FairValueConsensus {
+	byProvider := make(map[string][]float64)
+	for _, entry := range entries {
+		provider := fairValueProvider(entry.Source)
+		byProvider[provider] = append(byProvider[provider], entry.FairValue)
+	}
+
+	consensus := FairValueConsensus{ProviderMedians: make(map[string]float64, len(byProvider))}
+	medians := make([]float64, 0, len(byProvider))
+	for provider, values := range byProvider {
+		median := Median(values)
+		consensus.ProviderMedians[provider] = median
+		medians = append(medians, median)
+	}
+	consensus.FairValue = Median(medians)
+
+	if len(medians) > 1 && consensus.FairValue > 0 {
+		sort.Float64s(medians)
+		consensus.ProviderDisagreementPct = (medians[len(medians)-1] - medians[0]) / consensus.FairValue * 100
+		consensus.ProvidersDisagree = maxDisagreementPct > 0 && consensus.ProviderDisagreementPct > maxDisagreementPct
+	}
+	consensus.DispersionPct = fairValueDispersionPct(entries)
+	return consensus
+}
+
+// fairValueDispersionPct is the coefficient of variation of entries: their standard deviation as a
+// percentage of their median, over all entries whichever provider returned them.
+func fairValueDispersionPct(entries []NormalizedFairValueEntry) float64 {
+	if len(entries) < 2 {
+		return 0
+	}
+	values := make([]float64, len(entries))
+	var sum float64
+	for i, entry := range entries {
+		values[i] = entry.FairValue
+		sum += entry.FairValue
+	}
+	median := Median(values)
+	if median <= 0 {
+		return 0
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return math.Sqrt(variance/float64(len(values))) / median * 100
+}
+
 func Median(values []float64) float64 {
 	if len(values) == 0 {
 		return 0
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"golang.org/x/sync/singleflight"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCollectTrustedFairValuesUsesConfiguredModel(t *testing.T) {
+	t.Parallel()
+	cfg := &config.Config{
+		XAIAPIKey:      "test-key",
+		DeepseekAPIKey: "test-key",
+		ProviderModels: map[string]map[string]string{
+			config.UseCaseFairValue: {"grok": "grok-custom", "deepseek": "deepseek-custom"},
+		},
+	}
+	collector := NewFairValueCollector(cfg)
+
+	gotModels := map[string]string{}
+	collector.client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		model, _ := body["model"].(string)
+		gotModels[req.URL.Host] = model
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       io.NopCloser(strings.NewReader("unavailable")),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	_, _ = collector.CollectTrustedFairValues(context.Background(), &models.Stock{Ticker: "AAPL", Currency: "USD"})
+
+	if gotModels["api.x.ai"] != "grok-custom" {
+		t.Errorf("grok model: got %q want %q", gotModels["api.x.ai"], "grok-custom")
+	}
+	if gotModels["api.deepseek.com"] != "deepseek-custom" {
+		t.Errorf("deepseek model: got %q want %q", gotModels["api.deepseek.com"], "deepseek-custom")
+	}
+}
+
+func TestModelForFallsBackToDefaults(t *testing.T) {
+	t.Parallel()
+	cfg := &config.Config{}
+	if got := cfg.ModelFor(config.UseCaseFairValue, "deepseek"); got != "deepseek-reasoner" {
+		t.Fatalf("default fair_value deepseek model: got %q", got)
+	}
+}
+
+func TestValidateLLMEntryRejectsFairValueFarFromPrice(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	asOf := now.Format("2006-01-02")
+
+	if _, reason := validateLLMEntry(FairValueSourceEntry{FairValue: 2000, Source: "Hallucinated", AsOf: asOf}, 100, 5, now); reason == "" {
+		t.Error("expected 20x-price fair value to be rejected")
+	}
+	if _, reason := validateLLMEntry(FairValueSourceEntry{FairValue: 4, Source: "Hallucinated", AsOf: asOf}, 100, 5, now); reason == "" {
+		t.Error("expected fair value 25x below price to be rejected")
+	}
+	normalized, reason := validateLLMEntry(FairValueSourceEntry{FairValue: 130, Source: "Analyst consensus", AsOf: asOf}, 100, 5, now)
+	if reason != "" || normalized.FairValue != 130 {
+		t.Fatalf("expected 1.3x-price fair value to pass, got %+v reason=%q", normalized, reason)
+	}
+	if _, reason := validateLLMEntry(FairValueSourceEntry{FairValue: 2000, Source: "No price yet", AsOf: asOf}, 0, 5, now); reason != "" {
+		t.Error("expected relative check to be skipped without a current price")
+	}
+}
+
+func TestConsensusFairValueFlagsProviderDisagreement(t *testing.T) {
+	t.Parallel()
+	entries := []NormalizedFairValueEntry{
+		{FairValue: 100, Source: "Grok | Reuters"},
+		{FairValue: 104, Source: "Grok | Morningstar"},
+		{FairValue: 102, Source: "Grok"},
+		{FairValue: 130, Source: "Deepseek | Bloomberg"},
+		{FairValue: 126, Source: "Deepseek | FactSet"},
+	}
+
+	// Grok median 102, Deepseek median 128: consensus 115, spread 26/115 = 22.6%.
+	consensus := ConsensusFairValue(entries, 20)
+
+	assertClose(t, consensus.ProviderMedians["Grok"], 102, 0.0001, "Grok median")
+	assertClose(t, consensus.ProviderMedians["Deepseek"], 128, 0.0001, "Deepseek median")
+	assertClose(t, consensus.FairValue, 115, 0.0001, "FairValue")
+	assertClose(t, consensus.ProviderDisagreementPct, 26.0/115*100, 0.0001, "ProviderDisagreementPct")
+	if !consensus.ProvidersDisagree {
+		t.Fatal("expected providers to disagree beyond 20%")
+	}
+
+	if ConsensusFairValue(entries, 25).ProvidersDisagree {
+		t.Error("expected no flag with a 25% threshold")
+	}
+	if single := ConsensusFairValue(entries[:3], 20); single.ProvidersDisagree || single.ProviderDisagreementPct != 0 {
+		t.Errorf("single provider: got %+v", single)
+	}
+}
+
+func TestParseLocaleNumberDetectsSeparators(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		raw  string
+		mode string
+		want float64
+	}{
+		{"1.234,56", DecimalSeparatorAuto, 1234.56},
+		{"1,234.56", DecimalSeparatorAuto, 1234.56},
+		{"123,45", DecimalSeparatorAuto, 123.45},
+		{"1,234,567", DecimalSeparatorAuto, 1234567},
+		{"1.234.567", DecimalSeparatorAuto, 1234567},
+		{"€ 98,5", DecimalSeparatorAuto, 98.5},
+		{"1,234", DecimalSeparatorAuto, 1234},
+		{"1,234", DecimalSeparatorComma, 1.234},
+		{"1.234", DecimalSeparatorComma, 1234},
+		{"123,45", DecimalSeparatorDot, 12345},
+	}
+	for _, tc := range cases {
+		got, ok := parseLocaleNumber(tc.raw, tc.mode)
+		if !ok {
+			t.Errorf("parseLocaleNumber(%q, %s): not parsed", tc.raw, tc.mode)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseLocaleNumber(%q, %s): got %v want %v", tc.raw, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestParseFairValueEntriesHandlesEuropeanDecimals(t *testing.T) {
+	t.Parallel()
+	jsonEntries, err := parseFairValueEntries(`{"data":[{"source":"Boursorama","fair_value":"123,45","as_of":"2026-01-05"}]}`, DecimalSeparatorAuto)
+	if err != nil {
+		t.Fatalf("parse JSON: %v", err)
+	}
+	if len(jsonEntries) != 1 || jsonEntries[0].FairValue != 123.45 {
+		t.Fatalf("JSON entries: got %+v want fair value 123.45", jsonEntries)
+	}
+
+	pipeEntries, err := parseFairValueEntries("Source | Fair value | Date\nFinanzen.net | 1.234,56 EUR | 2026-01-05", DecimalSeparatorAuto)
+	if err != nil {
+		t.Fatalf("parse pipe text: %v", err)
+	}
+	if len(pipeEntries) != 1 || pipeEntries[0].FairValue != 1234.56 {
+		t.Fatalf("pipe entries: got %+v want fair value 1234.56", pipeEntries)
+	}
+}
+
+func TestAggregateFairValueChoicesMergesParseableChoices(t *testing.T) {
+	t.Parallel()
+	entries, err := aggregateFairValueChoices([]string{
+		`{"data":[{"source":"Reuters","fair_value":120,"as_of":"2026-01-05"}]}`,
+		"not fair value data",
+		`{"data":[{"source":"Morningstar","fair_value":130,"as_of":"2026-01-06"},{"source":"reuters ","fair_value":118,"as_of":"2026-01-05"}]}`,
+		`{"data":[{"source":"Reuters","fair_value":140,"as_of":"2026-01-05"},{"source":"Reuters","source_url":"https://example.com/other","fair_value":90}]}`,
+	}, DecimalSeparatorAuto)
+	if err != nil {
+		t.Fatalf("aggregate: %v", err)
+	}
+	// Reuters without a URL appears in three choices and collapses to its median; the one with a URL stays apart.
+	if len(entries) != 3 || entries[0].FairValue != 120 || entries[1].FairValue != 130 || entries[2].FairValue != 90 {
+		t.Fatalf("entries: got %+v", entries)
+	}
+
+	if _, err := aggregateFairValueChoices([]string{"nothing", "here"}, DecimalSeparatorAuto); err == nil {
+		t.Fatal("expected an error when no choice parses")
+	}
+}
+
+func TestCollectWithDiagnosticsReportsEachRejectionReason(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	today := now.Format("2006-01-02")
+	stale := now.AddDate(0, -2, 0).Format("2006-01-02")
+
+	content, err := json.Marshal(map[string]interface{}{"entries": []map[string]interface{}{
+		{"fair_value": 120, "source": "Reuters", "as_of": today},
+		{"fair_value": 0, "source": "Zero", "as_of": today},
+		{"fair_value": 900, "source": "Hallucinated", "as_of": today},
+		{"fair_value": 110, "source": "", "as_of": today},
+		{"fair_value": 115, "source": "Undated", "as_of": "recently"},
+		{"fair_value": 125, "source": "Old", "as_of": stale},
+	}})
+	if err != nil {
+		t.Fatalf("marshal entries: %v", err)
+	}
+	response, err := json.Marshal(map[string]interface{}{
+		"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": string(content)}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+
+	collector := NewFairValueCollector(&config.Config{XAIAPIKey: "test-key", FairValueRequireSource: true})
+	collector.client = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(response))),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	collection, err := collector.CollectWithDiagnostics(context.Background(), &models.Stock{Ticker: "ACME", Currency: "USD", CurrentPrice: 100})
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if collection.Received != 6 || len(collection.Entries) != 1 || collection.Entries[0].Source != "Grok | Reuters" {
+		t.Fatalf("expected 1 accepted Reuters entry of 6, got received=%d entries=%+v", collection.Received, collection.Entries)
+	}
+
+	want := map[string]string{
+		"Zero":         RejectImplausibleFairValue,
+		"Hallucinated": RejectOutsidePriceBand,
+		"":             RejectMissingSource,
+		"Undated":      RejectUnparseableDate,
+		"Old":          RejectStaleDate,
+	}
+	if len(collection.Rejections) != len(want) {
+		t.Fatalf("expected %d rejections, got %+v", len(want), collection.Rejections)
+	}
+	for _, rejection := range collection.Rejections {
+		if rejection.Provider != "Grok" {
+			t.Errorf("%q: provider got %q want Grok", rejection.Source, rejection.Provider)
+		}
+		if rejection.Reason != want[rejection.Source] {
+			t.Errorf("%q: reason got %q want %q", rejection.Source, rejection.Reason, want[rejection.Source])
+		}
+	}
+}
+
+func TestCollectWithDiagnosticsDropsBlocklistedSources(t *testing.T) {
+	t.Parallel()
+	today := time.Now().UTC().Format("2006-01-02")
+	content, err := json.Marshal(map[string]interface{}{"entries": []map[string]interface{}{
+		{"fair_value": 120, "source": "Reuters", "as_of": today},
+		{"fair_value": 118, "source": "MarketScreener consensus", "as_of": today},
+		{"fair_value": 150, "source": "Some aggregator", "source_url": "https://Paywalled-Estimates.example/acme", "as_of": today},
+		{"fair_value": 160, "source": "TipRanks average", "as_of": today},
+	}})
+	if err != nil {
+		t.Fatalf("marshal entries: %v", err)
+	}
+	response, err := json.Marshal(map[string]interface{}{
+		"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": string(content)}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+
+	collector := NewFairValueCollector(&config.Config{XAIAPIKey: "test-key", FairValueSourceBlocklist: []string{"tipranks", "paywalled-estimates"}})
+	collector.client = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(response))),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	collection, err := collector.CollectWithDiagnostics(context.Background(), &models.Stock{Ticker: "ACME", Currency: "USD", CurrentPrice: 100})
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(collection.Entries) != 2 || collection.Entries[0].Source != "Grok | Reuters" || collection.Entries[1].Source != "Grok | MarketScreener consensus" {
+		t.Fatalf("expected the Reuters and MarketScreener entries, got %+v", collection.Entries)
+	}
+	if len(collection.Rejections) != 2 {
+		t.Fatalf("expected 2 rejections, got %+v", collection.Rejections)
+	}
+	for _, rejection := range collection.Rejections {
+		if rejection.Reason != RejectBlockedSource {
+			t.Errorf("%q: reason got %q want %q", rejection.Source, rejection.Reason, RejectBlockedSource)
+		}
+	}
+}
+
+func TestCollectWithDiagnosticsSharesConcurrentCollectionsForTicker(t *testing.T) {
+	t.Parallel()
+	content, err := json.Marshal(map[string]interface{}{"entries": []map[string]interface{}{
+		{"fair_value": 120, "source": "Reuters", "as_of": time.Now().UTC().Format("2006-01-02")},
+	}})
+	if err != nil {
+		t.Fatalf("marshal entries: %v", err)
+	}
+	response, err := json.Marshal(map[string]interface{}{
+		"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": string(content)}}},
+	})
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+
+	var calls atomic.Int32
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	collector := NewFairValueCollector(&config.Config{XAIAPIKey: "test-key", FairValueSingleflight: true})
+	collector.flights = &singleflight.Group{}
+	collector.client = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		calls.Add(1)
+		entered <- struct{}{}
+		<-release
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(response))),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	results := make([]FairValueCollection, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	collect := func(i int) {
+		defer wg.Done()
+		results[i], errs[i] = collector.CollectWithDiagnostics(context.Background(), &models.Stock{Ticker: "ACME", Currency: "USD", CurrentPrice: 100})
+	}
+	wg.Add(2)
+	go collect(0)
+	<-entered
+	go collect(1)
+	// Give the second caller time to join the in-flight collection before it completes.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("provider calls: got %d want 1 shared call", got)
+	}
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("collection %d: %v", i, errs[i])
+		}
+		if len(results[i].Entries) != 1 || results[i].Entries[0].FairValue != 120 {
+			t.Errorf("collection %d: got entries %+v want the shared 120 entry", i, results[i].Entries)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// AlertTypeFairValueUncertain marks a stock whose fair value providers disagree, or whose collected
+// fair values scatter, too much for the consensus (and the EV built on it) to be trusted without a
+// manual check.
+const AlertTypeFairValueUncertain = "fair_value_uncertain"
+
+// Stock.FairValueConfidence values
+const (
+	FairValueConfidenceNormal = "normal"
+	FairValueConfidenceLow    = "low" // Providers disagreed (settings.MaxFVDisagreement) or entries were too dispersed (settings.MaxFVDispersion)
+)
+
+// Fair value collection settings used when a portfolio has no PortfolioSettings row; they match
+// the column defaults.
+const (
+	DefaultDowngradeMinSources = 2
+	DefaultMaxFVDisagreement   = 20.0
+	DefaultMaxFVDispersion     = 25.0
+)
+
+// LoadPortfolioSettings returns portfolioID's settings. Without a settings row the fair value
+// collection fields and the alert cooldown get their defaults, so the handler and the scheduler gate
+// and flag alike.
+func LoadPortfolioSettings(db *gorm.DB, portfolioID uint) models.PortfolioSettings {
+	var settings models.PortfolioSettings
+	if err := db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil {
+		settings = models.PortfolioSettings{
+			PortfolioID:         portfolioID,
+			DowngradeMinSources: DefaultDowngradeMinSources,
+			MaxFVDisagreement:   DefaultMaxFVDisagreement,
+			MaxFVDispersion:     DefaultMaxFVDispersion,
+			AlertCooldownHours:  DefaultAlertCooldownHours,
+		}
+	}
+	return settings
+}
+
+// CheckFairValueDisagreement sets stock.FairValueConfidence low and raises a fair_value_uncertain
+// alert when consensus.ProvidersDisagree (computed against settings.MaxFVDisagreement) or when
+// consensus.DispersionPct exceeds settings.MaxFVDispersion (0 = off). The dispersion covers every
+// entry, so a single provider returning scattered targets is flagged too. The alert goes through the
+// same settings.AlertCooldownHours dedup as the other stock alerts. The caller saves stock. It
+// reports whether an alert was created.
+func CheckFairValueDisagreement(db *gorm.DB, stock *models.Stock, consensus FairValueConsensus, settings models.PortfolioSettings, now time.Time) (bool, error) {
+	dispersed := settings.MaxFVDispersion > 0 && consensus.DispersionPct > settings.MaxFVDispersion
+	if !consensus.ProvidersDisagree && !dispersed {
+		stock.FairValueConfidence = FairValueConfidenceNormal
+		return false, nil
+	}
+	stock.FairValueConfidence = FairValueConfidenceLow
+
+	var reasons []string
+	if consensus.ProvidersDisagree {
+		reasons = append(reasons, fmt.Sprintf("provider medians differ by %.1f%% of the %.2f consensus (above %.1f%%)", consensus.ProviderDisagreementPct, consensus.FairValue, settings.MaxFVDisagreement))
+	}
+	if dispersed {
+		reasons = append(reasons, fmt.Sprintf("standard deviation is %.1f%% of the median (above %.1f%%)", consensus.DispersionPct, settings.MaxFVDispersion))
+	}
+	return RaiseStockAlert(db, models.Alert{
+		PortfolioID: stock.PortfolioID,
+		StockID:     stock.ID,
+		Ticker:      stock.Ticker,
+		AlertType:   AlertTypeFairValueUncertain,
+		Message:     fmt.Sprintf("%s fair values are uncertain: %s; check the sources before trusting the EV", stock.Ticker, strings.Join(reasons, " and ")),
+		CreatedAt:   now,
+	}, AlertCooldown(settings))
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// assessmentRank orders assessments from most to least favourable.
+var assessmentRank = map[string]int{
+	"Add":  0,
+	"Hold": 1,
+	"Trim": 2,
+	"Sell": 3,
+}
+
+// AssessmentWorsened reports whether next is a less favourable assessment than previous.
+// Unknown or empty assessments never count as worsening.
+func AssessmentWorsened(previous, next string) bool {
+	prevRank, okPrev := assessmentRank[previous]
+	nextRank, okNext := assessmentRank[next]
+	return okPrev && okNext && nextRank > prevRank
+}
+
+// CountIndependentSources counts distinct underlying sources among collected entries.
+// The provider prefix ("Grok | ") and URL suffix are ignored, so the same publication
+// reported by two providers counts once.
+func CountIndependentSources(entries []NormalizedFairValueEntry) int {
+	seen := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		source := entry.Source
+		if idx := strings.LastIndex(source, " | "); idx >= 0 {
+			source = source[idx+3:]
+		}
+		if idx := strings.Index(source, " ("); idx >= 0 {
+			source = source[:idx]
+		}
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source == "" {
+			continue
+		}
+		seen[source] = struct{}{}
+	}
+	return len(seen)
+}
+
+// ApplyCollectedFairValue sets the stock's fair value to the per-provider consensus of the
+// collected entries (see ConsensusFairValue) and recalculates metrics with cfg. When the new fair value worsens the assessment (e.g. Hold -> Sell)
+// and fewer than minSources independent sources back it, the prior fair value is restored and
+// applied is false; proposed is the assessment the collection would have produced.
+// Both assessments are calculated at the stock's current price, so a price move alone never
+// counts as the new fair value worsening the assessment. A minSources of 0 disables the gate.
+func ApplyCollectedFairValue(stock *models.Stock, entries []NormalizedFairValueEntry, minSources int, collectedAt time.Time, cfg MetricsConfig) (applied bool, proposed string) {
+	CalculateMetrics(stock, cfg)
+	previousAssessment := stock.Assessment
+	previousFairValue := stock.FairValue
+	previousSource := stock.FairValueSource
+	previousCollectedAt := stock.FairValueCollectedAt
+	previousStale := stock.FairValueStale
+
+	stock.FairValue = ConsensusFairValue(entries, 0).FairValue
+	stock.FairValueSource = fmt.Sprintf("Trusted multi-source consensus (%d entries), %s", len(entries), collectedAt.Format("2006-01-02"))
+	stock.FairValueCollectedAt = &collectedAt
+	stock.FairValueStale = false
+	CalculateMetrics(stock, cfg)
+	proposed = stock.Assessment
+
+	if minSources > 0 && AssessmentWorsened(previousAssessment, proposed) && CountIndependentSources(entries) < minSources {
+		stock.FairValue = previousFairValue
+		stock.FairValueSource = previousSource
+		stock.FairValueCollectedAt = previousCollectedAt
+		stock.FairValueStale = previousStale
+		CalculateMetrics(stock, cfg)
+		return false, proposed
+	}
+	return true, proposed
+}
+
+// NeedsReviewAlertMessage describes a fair value update held back by the source gate.
+func NeedsReviewAlertMessage(stock *models.Stock, entries []NormalizedFairValueEntry, proposed string) string {
+	return fmt.Sprintf("%s: fair value from %d independent source(s) would move assessment to %s; kept prior fair value %.2f pending review",
+		stock.Ticker, CountIndependentSources(entries), proposed, stock.FairValue)
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestApplyCollectedFairValueRequiresSourcesToWorsenAssessment(t *testing.T) {
+	t.Parallel()
+	newHoldStock := func() *models.Stock {
+		// EV = 0.65*20% + 0.35*(-20%) = 6%: Hold.
+		stock := &models.Stock{Ticker: "FLAKY", CurrentPrice: 100, FairValue: 120, FairValueSource: "Manual"}
+		CalculateMetrics(stock, DefaultMetricsConfig())
+		if stock.Assessment != "Hold" {
+			t.Fatalf("precondition: got %s want Hold", stock.Assessment)
+		}
+		return stock
+	}
+	now := time.Now()
+
+	// Two providers quoting the same publication are one independent source.
+	oneSource := []NormalizedFairValueEntry{
+		{FairValue: 95, Source: "Grok | Reuters (https://reuters.com/a)"},
+		{FairValue: 95, Source: "Deepseek | Reuters (https://reuters.com/b)"},
+	}
+	stock := newHoldStock()
+	applied, proposed := ApplyCollectedFairValue(stock, oneSource, 2, now, DefaultMetricsConfig())
+	if applied || proposed != "Sell" {
+		t.Fatalf("one source: got applied=%v proposed=%s, want held-back Sell", applied, proposed)
+	}
+	if stock.Assessment != "Hold" || stock.FairValue != 120 || stock.FairValueSource != "Manual" {
+		t.Errorf("one source: expected prior Hold at 120, got %s at %.2f (%s)", stock.Assessment, stock.FairValue, stock.FairValueSource)
+	}
+
+	multiSource := []NormalizedFairValueEntry{
+		{FairValue: 95, Source: "Grok | Reuters (https://reuters.com/a)"},
+		{FairValue: 95, Source: "Deepseek | Bloomberg (https://bloomberg.com/b)"},
+	}
+	stock = newHoldStock()
+	applied, _ = ApplyCollectedFairValue(stock, multiSource, 2, now, DefaultMetricsConfig())
+	if !applied || stock.Assessment != "Sell" || stock.FairValue != 95 {
+		t.Errorf("two sources: got applied=%v %s at %.2f, want Sell at 95", applied, stock.Assessment, stock.FairValue)
+	}
+}
+
+func TestApplyCollectedFairValueComparesAtTheCurrentPrice(t *testing.T) {
+	t.Parallel()
+	// The stored Add was calculated at an older, lower price; at 100 the prior fair value is a Hold.
+	stock := &models.Stock{Ticker: "MOVED", CurrentPrice: 100, FairValue: 120, FairValueSource: "Manual", Assessment: "Add"}
+	entries := []NormalizedFairValueEntry{{FairValue: 121, Source: "Grok | Reuters (https://reuters.com/a)"}}
+
+	applied, proposed := ApplyCollectedFairValue(stock, entries, 2, time.Now(), DefaultMetricsConfig())
+	if !applied || proposed != "Hold" {
+		t.Fatalf("got applied=%v proposed=%s, want the Hold applied since only the price moved", applied, proposed)
+	}
+	if stock.FairValue != 121 {
+		t.Errorf("fair value: got %.2f want 121", stock.FairValue)
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Reasons XIRR has no answer.
+var (
+	ErrIRRNoSignChange  = errors.New("cash flows need at least one negative and one positive amount")
+	ErrIRRNoConvergence = errors.New("IRR solver did not converge")
+)
+
+// IRR statuses reported in IRRResult.Status.
+const (
+	IRRStatusOK               = "ok"
+	IRRStatusInsufficientData = "insufficient_data"
+	IRRStatusNoSignChange     = "no_sign_change"
+	IRRStatusNoConvergence    = "no_convergence"
+)
+
+// XIRRFlow is a dated cash flow from the investor's side: money put in is negative, money taken
+// out (or the ending value) is positive.
+type XIRRFlow struct {
+	Date   time.Time `json:"date"`
+	Amount float64   `json:"amount"`
+}
+
+const (
+	xirrTolerance     = 1e-9
+	xirrMaxIterations = 100
+	xirrMinRate       = -0.999999
+	xirrMaxRate       = 1e6
+)
+
+// XIRR returns the annual rate r (0.1 = 10%) at which the flows' net present value is zero,
+// discounting each by (1+r)^(days/365) from the earliest flow. Newton's method is tried first; when
+// it leaves the valid range or stalls, bisection between just above -100% and 1e8% takes over.
+func XIRR(flows []XIRRFlow) (float64, error) {
+	if len(flows) < 2 {
+		return 0, ErrIRRNoSignChange
+	}
+	var hasNegative, hasPositive bool
+	start := flows[0].Date
+	for _, flow := range flows {
+		hasNegative = hasNegative || flow.Amount < 0
+		hasPositive = hasPositive || flow.Amount > 0
+		if flow.Date.Before(start) {
+			start = flow.Date
+		}
+	}
+	if !hasNegative || !hasPositive {
+		return 0, ErrIRRNoSignChange
+	}
+
+	years := make([]float64, len(flows))
+	for i, flow := range flows {
+		years[i] = flow.Date.Sub(start).Hours() / 24 / 365
+	}
+	npv := func(rate float64) float64 {
+		var total float64
+		for i, flow := range flows {
+			total += flow.Amount / math.Pow(1+rate, years[i])
+		}
+		return total
+	}
+	derivative := func(rate float64) float64 {
+		var total float64
+		for i, flow := range flows {
+			total -= years[i] * flow.Amount / math.Pow(1+rate, years[i]+1)
+		}
+		return total
+	}
+
+	rate := 0.1
+	for i := 0; i < xirrMaxIterations; i++ {
+		value, slope := npv(rate), derivative(rate)
+		if math.Abs(value) < xirrTolerance {
+			return rate, nil
+		}
+		if slope == 0 || math.IsNaN(slope) {
+			break
+		}
+		next := rate - value/slope
+		if next <= xirrMinRate || next > xirrMaxRate || math.IsNaN(next) {
+			break
+		}
+		if math.Abs(next-rate) < xirrTolerance {
+			return next, nil
+		}
+		rate = next
+	}
+
+	// Bisection: find a bracket with a sign change, then halve it.
+	low, high := xirrMinRate, 1.0
+	for npv(low)*npv(high) > 0 {
+		if high >= xirrMaxRate {
+			return 0, ErrIRRNoConvergence
+		}
+		high *= 10
+	}
+	for i := 0; i < 1000; i++ {
+		mid := (low + high) / 2
+		value := npv(mid)
+		if math.Abs(value) < xirrTolerance || (high-low)/2 < xirrTolerance {
+			return mid, nil
+		}
+		if npv(low)*value < 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return 0, ErrIRRNoConvergence
+}
+
+// IRRResult is the money-weighted return over a range of snapshots.
+type IRRResult struct {
+	From          string     `json:"from"` // Requested range (YYYY-MM-DD), set by the caller
+	To            string     `json:"to"`
+	IRRPct        *float64   `json:"irr_pct"` // Annualized; nil unless Status is ok
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason,omitempty"`
+	StartValueEUR float64    `json:"start_value_eur"`
+	EndValueEUR   float64    `json:"end_value_eur"`
+	NetFlowsEUR   float64    `json:"net_flows_eur"`
+	CashFlows     []XIRRFlow `json:"cash_flows"`
+}
+
+// MoneyWeightedReturn treats the first snapshot's value as money put in, external flows between the
+// first and last snapshot (as in TimeWeightedReturn) as money put in or taken out, and the last
+// snapshot's value as money taken out, and solves XIRR over them. Unlike TWR the result depends on
+// the timing and size of contributions.
+func MoneyWeightedReturn(points []TWRValuePoint, flows []TWRCashFlow) IRRResult {
+	result := IRRResult{Status: IRRStatusInsufficientData, CashFlows: []XIRRFlow{}}
+	if len(points) < 2 {
+		result.Reason = "at least two snapshots are required"
+		return result
+	}
+	first, last := points[0], points[len(points)-1]
+	result.StartValueEUR, result.EndValueEUR = first.ValueEUR, last.ValueEUR
+
+	result.CashFlows = append(result.CashFlows, XIRRFlow{Date: first.Date, Amount: -first.ValueEUR})
+	for _, flow := range flows {
+		if !flow.Date.After(first.Date) || flow.Date.After(last.Date) {
+			continue
+		}
+		result.NetFlowsEUR += flow.AmountEUR
+		result.CashFlows = append(result.CashFlows, XIRRFlow{Date: flow.Date, Amount: -flow.AmountEUR})
+	}
+	result.CashFlows = append(result.CashFlows, XIRRFlow{Date: last.Date, Amount: last.ValueEUR})
+
+	rate, err := XIRR(result.CashFlows)
+	switch {
+	case errors.Is(err, ErrIRRNoSignChange):
+		result.Status, result.Reason = IRRStatusNoSignChange, err.Error()
+	case err != nil:
+		result.Status, result.Reason = IRRStatusNoConvergence, err.Error()
+	default:
+		pct := rate * 100
+		result.IRRPct, result.Status = &pct, IRRStatusOK
+	}
+	return result
+}
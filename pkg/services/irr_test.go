@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestXIRRMatchesKnownCashFlows(t *testing.T) {
+	t.Parallel()
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	// The reference XIRR example from spreadsheet documentation: 37.34% a year.
+	flows := []XIRRFlow{
+		{Date: date(2008, 1, 1), Amount: -10000},
+		{Date: date(2008, 3, 1), Amount: 2750},
+		{Date: date(2008, 10, 30), Amount: 4250},
+		{Date: date(2009, 2, 15), Amount: 3250},
+		{Date: date(2009, 4, 1), Amount: 2750},
+	}
+	rate, err := XIRR(flows)
+	if err != nil {
+		t.Fatalf("XIRR: %v", err)
+	}
+	assertClose(t, rate, 0.373362535, 1e-6, "rate")
+
+	if _, err := XIRR([]XIRRFlow{{Date: date(2025, 1, 1), Amount: -100}, {Date: date(2025, 6, 1), Amount: -50}}); !errors.Is(err, ErrIRRNoSignChange) {
+		t.Errorf("all-negative flows: expected ErrIRRNoSignChange, got %v", err)
+	}
+	// 100 turning into 1,000,000 overnight annualizes far beyond any representable rate.
+	if _, err := XIRR([]XIRRFlow{{Date: date(2025, 1, 1), Amount: -100}, {Date: date(2025, 1, 2), Amount: 1e6}}); !errors.Is(err, ErrIRRNoConvergence) {
+		t.Errorf("extreme flows: expected ErrIRRNoConvergence, got %v", err)
+	}
+}
+
+func TestMoneyWeightedReturnWeighsDepositTiming(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 365)
+
+	// No flows: 1,000 growing to 1,100 over 365 days is exactly 10% a year.
+	result := MoneyWeightedReturn([]TWRValuePoint{{Date: start, ValueEUR: 1000}, {Date: end, ValueEUR: 1100}}, nil)
+	if result.Status != IRRStatusOK || result.IRRPct == nil {
+		t.Fatalf("expected a solved IRR, got %+v", result)
+	}
+	assertClose(t, *result.IRRPct, 10, 1e-6, "IRRPct without flows")
+
+	// A 1,000 deposit half-way through earns only half a year, so the same 200 gain is worth more
+	// per euro-year: 1000(1+r) + 1000(1+r)^(182/365) = 2200 gives r ≈ 13.46%.
+	mid := start.AddDate(0, 0, 182)
+	points := []TWRValuePoint{{Date: start, ValueEUR: 1000}, {Date: end, ValueEUR: 2200}}
+	flows := []TWRCashFlow{
+		{Date: start, AmountEUR: 400}, // On the first snapshot: already in its value
+		{Date: mid, AmountEUR: 1000},
+	}
+	result = MoneyWeightedReturn(points, flows)
+	if result.Status != IRRStatusOK || result.IRRPct == nil {
+		t.Fatalf("expected a solved IRR, got %+v", result)
+	}
+	assertClose(t, result.NetFlowsEUR, 1000, 1e-9, "NetFlowsEUR")
+	if len(result.CashFlows) != 3 {
+		t.Fatalf("expected start, deposit and end flows, got %+v", result.CashFlows)
+	}
+	assertClose(t, *result.IRRPct, 13.462698, 1e-4, "IRRPct with a mid-year deposit")
+
+	if single := MoneyWeightedReturn(points[:1], nil); single.Status != IRRStatusInsufficientData || single.IRRPct != nil {
+		t.Errorf("one snapshot: got %+v", single)
+	}
+	if lost := MoneyWeightedReturn([]TWRValuePoint{{Date: start, ValueEUR: 1000}, {Date: end, ValueEUR: 0}}, nil); lost.Status != IRRStatusNoSignChange {
+		t.Errorf("zero ending value: got status %q", lost.Status)
+	}
+}
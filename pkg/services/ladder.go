@@ -0,0 +1,45 @@
+package services
+
+// Bounds on the number of laddered entry tranches.
+const (
+	MinLadderTranches = 1
+	MaxLadderTranches = 5
+)
+
+// LadderedEntry is one limit order of a laddered entry into the buy zone.
+type LadderedEntry struct {
+	Tranche    int     `json:"tranche"` // 1 = highest price, filled first on the way down
+	LimitPrice float64 `json:"limit_price"`
+	Fraction   float64 `json:"fraction"` // Share of the intended position (0–1); tranches sum to 1
+}
+
+// CalculateLadderedEntries splits buyZone into tranches (clamped to 1–5) evenly spaced limit prices
+// from the upper bound down to the lower bound. Fractions are front-loaded toward the lower prices:
+// tranche i of n gets i / (1 + 2 + … + n). A single tranche sits at the upper bound. It returns nil
+// when the zone is empty or invalid.
+func CalculateLadderedEntries(buyZone BuyZone, tranches int) []LadderedEntry {
+	if buyZone.UpperBound <= 0 || buyZone.LowerBound <= 0 || buyZone.LowerBound > buyZone.UpperBound {
+		return nil
+	}
+	if tranches < MinLadderTranches {
+		tranches = MinLadderTranches
+	}
+	if tranches > MaxLadderTranches {
+		tranches = MaxLadderTranches
+	}
+
+	step := 0.0
+	if tranches > 1 {
+		step = (buyZone.UpperBound - buyZone.LowerBound) / float64(tranches-1)
+	}
+	total := float64(tranches*(tranches+1)) / 2
+	entries := make([]LadderedEntry, tranches)
+	for i := range entries {
+		entries[i] = LadderedEntry{
+			Tranche:    i + 1,
+			LimitPrice: buyZone.UpperBound - float64(i)*step,
+			Fraction:   float64(i+1) / total,
+		}
+	}
+	return entries
+}
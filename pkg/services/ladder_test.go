@@ -0,0 +1,47 @@
+package services
+
+import "testing"
+
+func TestCalculateLadderedEntriesSpacesPricesAndFrontLoadsLowerTranches(t *testing.T) {
+	t.Parallel()
+	entries := CalculateLadderedEntries(BuyZone{LowerBound: 80, UpperBound: 100}, 3)
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 tranches, got %+v", entries)
+	}
+	wantPrices := []float64{100, 90, 80}
+	wantFractions := []float64{1.0 / 6, 2.0 / 6, 3.0 / 6}
+	for i, entry := range entries {
+		if entry.Tranche != i+1 {
+			t.Errorf("tranche %d: got number %d", i, entry.Tranche)
+		}
+		assertClose(t, entry.LimitPrice, wantPrices[i], 0.0001, "LimitPrice")
+		assertClose(t, entry.Fraction, wantFractions[i], 0.0001, "Fraction")
+	}
+}
+
+func TestCalculateLadderedEntriesClampsTranches(t *testing.T) {
+	t.Parallel()
+	zone := BuyZone{LowerBound: 80, UpperBound: 100}
+
+	single := CalculateLadderedEntries(zone, 0)
+	if len(single) != 1 {
+		t.Fatalf("expected tranches clamped to 1, got %+v", single)
+	}
+	assertClose(t, single[0].LimitPrice, 100, 0.0001, "single LimitPrice")
+	assertClose(t, single[0].Fraction, 1, 0.0001, "single Fraction")
+
+	capped := CalculateLadderedEntries(zone, 9)
+	if len(capped) != MaxLadderTranches {
+		t.Fatalf("expected tranches clamped to %d, got %d", MaxLadderTranches, len(capped))
+	}
+	assertClose(t, capped[4].LimitPrice, 80, 0.0001, "last LimitPrice")
+	var total float64
+	for _, entry := range capped {
+		total += entry.Fraction
+	}
+	assertClose(t, total, 1, 0.0001, "total Fraction")
+
+	if entries := CalculateLadderedEntries(BuyZone{}, 3); entries != nil {
+		t.Fatalf("expected no ladder for an empty zone, got %+v", entries)
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+)
+
+// LLMProvider completes one system + user prompt with a chat model and returns the reply text.
+type LLMProvider interface {
+	Complete(ctx context.Context, systemPrompt, userPrompt string) (string, error)
+}
+
+// MultiChoiceProvider is an LLMProvider that can sample several completions (n) in one call.
+type MultiChoiceProvider interface {
+	LLMProvider
+	CompleteChoices(ctx context.Context, systemPrompt, userPrompt string, n int) ([]string, error)
+}
+
+// CompleteChoices asks provider for n completions when n > 1 and it is a MultiChoiceProvider;
+// otherwise it returns the single Complete reply. Providers may return fewer choices than asked.
+// Blank choices are dropped; ErrEmptyContent is returned when nothing else is left.
+func CompleteChoices(ctx context.Context, provider LLMProvider, systemPrompt, userPrompt string, n int) ([]string, error) {
+	var choices []string
+	if multi, ok := provider.(MultiChoiceProvider); ok && n > 1 {
+		var err error
+		if choices, err = multi.CompleteChoices(ctx, systemPrompt, userPrompt, n); err != nil {
+			return nil, err
+		}
+	} else {
+		text, err := provider.Complete(ctx, systemPrompt, userPrompt)
+		if err != nil {
+			return nil, err
+		}
+		choices = []string{text}
+	}
+
+	nonBlank := choices[:0]
+	for _, choice := range choices {
+		if strings.TrimSpace(choice) != "" {
+			nonBlank = append(nonBlank, choice)
+		}
+	}
+	if len(nonBlank) == 0 {
+		return nil, ErrEmptyContent
+	}
+	return nonBlank, nil
+}
+
+// GrokProvider calls xAI's chat completions API.
+type GrokProvider struct {
+	Endpoint string
+	Model    string
+	APIKey   string
+	Client   *http.Client
+	Retry    RetryPolicy
+}
+
+// NewGrokProvider returns a Grok provider using cfg's API key, the model configured for useCase
+// and client for transport (rate limiting and health tracking).
+func NewGrokProvider(cfg *config.Config, useCase string, client *http.Client) *GrokProvider {
+	return &GrokProvider{
+		Endpoint: "https://api.x.ai/v1/chat/completions",
+		Model:    cfg.ModelFor(useCase, "grok"),
+		APIKey:   cfg.XAIAPIKey,
+		Client:   client,
+		Retry:    RetryPolicyFromConfig(cfg),
+	}
+}
+
+// Complete implements LLMProvider.
+func (p *GrokProvider) Complete(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
+	return completeChat(ctx, "Grok", p.Client, p.Retry, p.Endpoint, p.APIKey, p.Model, systemPrompt, userPrompt)
+}
+
+// CompleteChoices implements MultiChoiceProvider.
+func (p *GrokProvider) CompleteChoices(ctx context.Context, systemPrompt, userPrompt string, n int) ([]string, error) {
+	return completeChatChoices(ctx, "Grok", p.Client, p.Retry, p.Endpoint, p.APIKey, p.Model, systemPrompt, userPrompt, n)
+}
+
+// DeepseekProvider calls Deepseek's chat completions API.
+type DeepseekProvider struct {
+	Endpoint string
+	Model    string
+	APIKey   string
+	Client   *http.Client
+	Retry    RetryPolicy
+}
+
+// NewDeepseekProvider returns a Deepseek provider using cfg's API key, the model configured for
+// useCase and client for transport.
+func NewDeepseekProvider(cfg *config.Config, useCase string, client *http.Client) *DeepseekProvider {
+	return &DeepseekProvider{
+		Endpoint: "https://api.deepseek.com/v1/chat/completions",
+		Model:    cfg.ModelFor(useCase, "deepseek"),
+		APIKey:   cfg.DeepseekAPIKey,
+		Client:   client,
+		Retry:    RetryPolicyFromConfig(cfg),
+	}
+}
+
+// Complete implements LLMProvider.
+func (p *DeepseekProvider) Complete(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
+	return completeChat(ctx, "Deepseek", p.Client, p.Retry, p.Endpoint, p.APIKey, p.Model, systemPrompt, userPrompt)
+}
+
+// CompleteChoices implements MultiChoiceProvider.
+func (p *DeepseekProvider) CompleteChoices(ctx context.Context, systemPrompt, userPrompt string, n int) ([]string, error) {
+	return completeChatChoices(ctx, "Deepseek", p.Client, p.Retry, p.Endpoint, p.APIKey, p.Model, systemPrompt, userPrompt, n)
+}
+
+// completeChat sends a non-streaming OpenAI-style chat completion (with DoWithRetry) and returns
+// the first choice's message content.
+func completeChat(ctx context.Context, name string, client *http.Client, retry RetryPolicy, endpoint, apiKey, model, systemPrompt, userPrompt string) (string, error) {
+	choices, err := completeChatChoices(ctx, name, client, retry, endpoint, apiKey, model, systemPrompt, userPrompt, 1)
+	if err != nil {
+		return "", err
+	}
+	return choices[0], nil
+}
+
+// completeChatChoices is completeChat asking for n choices (sent as "n" only when n > 1). It returns
+// the content of every choice with non-blank content, in order, or ErrEmptyContent when all are blank.
+func completeChatChoices(ctx context.Context, name string, client *http.Client, retry RetryPolicy, endpoint, apiKey, model, systemPrompt, userPrompt string, n int) ([]string, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("%s API key not configured", name)
+	}
+	reqBody := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": systemPrompt},
+			{"role": "user", "content": userPrompt},
+		},
+		"stream": false,
+	}
+	if n > 1 {
+		reqBody["n"] = n
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := DoWithRetry(client, req, retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s API: %w", name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s API returned status %d: %s", name, resp.StatusCode, string(body))
+	}
+
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content *string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+	RecordProviderSuccess(resp)
+	if n <= 1 {
+		parsed.Choices = parsed.Choices[:1]
+	}
+	contents := make([]string, 0, len(parsed.Choices))
+	var blank bool
+	for _, choice := range parsed.Choices {
+		if choice.Message.Content == nil {
+			continue
+		}
+		if strings.TrimSpace(*choice.Message.Content) == "" {
+			blank = true
+			continue
+		}
+		contents = append(contents, *choice.Message.Content)
+	}
+	if len(contents) == 0 {
+		if blank {
+			return nil, ErrEmptyContent
+		}
+		return nil, fmt.Errorf("missing content in response")
+	}
+	return contents, nil
+}
+
+// anthropicVersion is the Messages API version sent in the anthropic-version header.
+const anthropicVersion = "2023-06-01"
+
+// claudeMaxTokens caps the reply length; the Messages API requires max_tokens.
+const claudeMaxTokens = 8192
+
+// ClaudeProvider calls Anthropic's Messages API.
+type ClaudeProvider struct {
+	Endpoint string
+	Model    string
+	APIKey   string
+	Client   *http.Client
+	Retry    RetryPolicy
+}
+
+// NewClaudeProvider returns a Claude provider using cfg's Anthropic API key, the model configured
+// for useCase and client for transport.
+func NewClaudeProvider(cfg *config.Config, useCase string, client *http.Client) *ClaudeProvider {
+	return &ClaudeProvider{
+		Endpoint: "https://api.anthropic.com/v1/messages",
+		Model:    cfg.ModelFor(useCase, "claude"),
+		APIKey:   cfg.AnthropicAPIKey,
+		Client:   client,
+		Retry:    RetryPolicyFromConfig(cfg),
+	}
+}
+
+// Complete implements LLMProvider. The reply's content is an array of blocks; the text blocks are
+// concatenated in order.
+func (p *ClaudeProvider) Complete(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
+	if p.APIKey == "" {
+		return "", fmt.Errorf("Anthropic API key not configured")
+	}
+	reqBody := map[string]interface{}{
+		"model":      p.Model,
+		"max_tokens": claudeMaxTokens,
+		"system":     systemPrompt,
+		"messages": []map[string]string{
+			{"role": "user", "content": userPrompt},
+		},
+	}
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := DoWithRetry(p.Client, req, p.Retry)
+	if err != nil {
+		return "", fmt.Errorf("failed to call Anthropic API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Anthropic API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var parsed struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	RecordProviderSuccess(resp)
+	var text strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text content in response")
+	}
+	return RequireContent(text.String())
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestClaudeProviderPostsMessagesAndJoinsTextBlocks(t *testing.T) {
+	t.Parallel()
+	cfg := &config.Config{
+		AnthropicAPIKey: "test-key",
+		ProviderModels:  map[string]map[string]string{config.UseCaseAssessment: {"claude": "claude-custom"}},
+	}
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != "https://api.anthropic.com/v1/messages" {
+			t.Errorf("url: got %s", req.URL)
+		}
+		if req.Header.Get("x-api-key") != "test-key" || req.Header.Get("anthropic-version") != anthropicVersion || req.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected auth headers: %v", req.Header)
+		}
+		var body struct {
+			Model     string `json:"model"`
+			MaxTokens int    `json:"max_tokens"`
+			System    string `json:"system"`
+			Messages  []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		if body.Model != "claude-custom" || body.MaxTokens <= 0 || body.System != "system" ||
+			len(body.Messages) != 1 || body.Messages[0].Role != "user" || body.Messages[0].Content != "user" {
+			t.Errorf("unexpected request body: %+v", body)
+		}
+		reply := `{"content":[{"type":"text","text":"Part one. "},{"type":"tool_use","id":"x"},{"type":"text","text":"Part two."}]}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(reply)), Request: req}, nil
+	})}
+
+	text, err := NewClaudeProvider(cfg, config.UseCaseAssessment, client).Complete(context.Background(), "system", "user")
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if text != "Part one. Part two." {
+		t.Fatalf("text: got %q", text)
+	}
+
+	if _, err := NewClaudeProvider(&config.Config{}, config.UseCaseAssessment, client).Complete(context.Background(), "s", "u"); err == nil {
+		t.Fatal("expected an error without an API key")
+	}
+}
+
+type staticLLMProvider string
+
+func (p staticLLMProvider) Complete(context.Context, string, string) (string, error) {
+	return string(p), nil
+}
+
+func TestCompleteChoicesRejectsBlankContent(t *testing.T) {
+	t.Parallel()
+	if _, err := CompleteChoices(context.Background(), staticLLMProvider(" \n\t "), "s", "u", 1); !errors.Is(err, ErrEmptyContent) {
+		t.Fatalf("CompleteChoices: got %v, want ErrEmptyContent", err)
+	}
+
+	collector := &FairValueCollector{cfg: &config.Config{}}
+	if _, err := collector.callLLM(context.Background(), staticLLMProvider(""), &models.Stock{Ticker: "ACME"}); !errors.Is(err, ErrEmptyContent) {
+		t.Fatalf("callLLM: got %v, want ErrEmptyContent", err)
+	}
+
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		reply := `{"choices":[{"message":{"content":"  "}},{"message":{"content":"Hold"}}]}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(reply)), Request: req}, nil
+	})}
+	provider := NewGrokProvider(&config.Config{XAIAPIKey: "test-key"}, config.UseCaseAssessment, client)
+	choices, err := CompleteChoices(context.Background(), provider, "s", "u", 2)
+	if err != nil || len(choices) != 1 || choices[0] != "Hold" {
+		t.Fatalf("expected only the non-blank choice, got %q, %v", choices, err)
+	}
+}
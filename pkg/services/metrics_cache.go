@@ -0,0 +1,120 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// metricsCacheTables are the tables whose writes change a computed portfolio summary.
+var metricsCacheTables = map[string]bool{
+	"stocks":               true,
+	"operations":           true,
+	"exchange_rates":       true,
+	"fair_value_histories": true,
+	"portfolios":           true, // base currency
+	"portfolio_settings":   true, // correlated-weight cap
+}
+
+// CachedPortfolioSummary is a computed portfolio summary held by MetricsCache.
+type CachedPortfolioSummary struct {
+	Metrics    PortfolioMetrics
+	Stocks     []models.Stock
+	FXRates    map[string]float64
+	ComputedAt time.Time
+}
+
+// MetricsCache holds computed portfolio summaries per portfolio for a short TTL, so repeated
+// dashboard polls do not recompute (and re-save) metrics. Entries are dropped when stocks,
+// trades, exchange rates or fair values are written (see InvalidateOnWrites).
+type MetricsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[uint]CachedPortfolioSummary
+	now     func() time.Time
+}
+
+// NewMetricsCache creates a cache whose entries expire after ttl.
+func NewMetricsCache(ttl time.Duration) *MetricsCache {
+	return &MetricsCache{
+		ttl:     ttl,
+		entries: make(map[uint]CachedPortfolioSummary),
+		now:     time.Now,
+	}
+}
+
+// SetClock replaces the clock used for timestamps and expiry (for tests).
+func (c *MetricsCache) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Get returns the portfolio's cached summary when it is younger than the TTL. The stocks slice
+// is a copy, so callers may filter or modify it.
+func (c *MetricsCache) Get(portfolioID uint) (CachedPortfolioSummary, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[portfolioID]
+	if !ok {
+		return CachedPortfolioSummary{}, false
+	}
+	if c.now().Sub(entry.ComputedAt) >= c.ttl {
+		delete(c.entries, portfolioID)
+		return CachedPortfolioSummary{}, false
+	}
+	entry.Stocks = append([]models.Stock(nil), entry.Stocks...)
+	return entry, true
+}
+
+// Put stores a freshly computed summary, stamping it with the current time.
+func (c *MetricsCache) Put(portfolioID uint, summary CachedPortfolioSummary) CachedPortfolioSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary.ComputedAt = c.now()
+	stored := summary
+	stored.Stocks = append([]models.Stock(nil), summary.Stocks...)
+	c.entries[portfolioID] = stored
+	return summary
+}
+
+// Invalidate drops the portfolio's cached summary.
+func (c *MetricsCache) Invalidate(portfolioID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, portfolioID)
+}
+
+// InvalidateAll drops every cached summary.
+func (c *MetricsCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[uint]CachedPortfolioSummary)
+}
+
+// InvalidateOnWrites registers GORM callbacks that invalidate the cache after creates, updates and
+// deletes on metrics-relevant tables, covering every writer (handlers, scheduler, webhooks). A write
+// to a single loaded stock invalidates its portfolio; any other write invalidates all portfolios.
+func (c *MetricsCache) InvalidateOnWrites(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("metrics_cache:invalidate_create", c.invalidateAfterWrite); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("metrics_cache:invalidate_update", c.invalidateAfterWrite); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("metrics_cache:invalidate_delete", c.invalidateAfterWrite)
+}
+
+func (c *MetricsCache) invalidateAfterWrite(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || !metricsCacheTables[db.Statement.Schema.Table] {
+		return
+	}
+	if stock, ok := db.Statement.Model.(*models.Stock); ok && stock.PortfolioID != 0 {
+		c.Invalidate(stock.PortfolioID)
+		return
+	}
+	c.InvalidateAll()
+}
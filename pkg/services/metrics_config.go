@@ -0,0 +1,190 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// MetricsConfig holds the tunable thresholds used by CalculateMetrics.
+type MetricsConfig struct {
+	AddThreshold       float64 `json:"add_threshold"`         // EV above this (%) is Add; also the buy-zone entry EV
+	TrimThreshold      float64 `json:"trim_threshold"`        // EV from here up to AddThreshold is Hold; from SellThreshold to here is Trim
+	SellThreshold      float64 `json:"sell_threshold"`        // EV below this (%) is Sell; also the sell-zone upper bound
+	KellyScale         float64 `json:"kelly_scale"`           // Fraction of full Kelly used for the suggested weight (0.5 = ½-Kelly)
+	KellyCap           float64 `json:"kelly_cap"`             // Maximum suggested weight (%)
+	DefaultProbability float64 `json:"default_probability"`   // p used when a stock's probability is missing or invalid
+	ProbabilityBand    float64 `json:"probability_band"`      // Half-width of the p band used for the EV interval (0.1 = p ± 0.10)
+	MaxBuyZoneDownside float64 `json:"max_buy_zone_downside"` // |Downside risk| (%) above which a buy-zone stock is elevated risk (0 = off)
+	MinRatioPositions  int     `json:"min_ratio_positions"`   // Valued positions required before the portfolio Sharpe ratio is reported
+	AssumedCorrelation float64 `json:"assumed_correlation"`   // Return correlation assumed between positions for the portfolio volatility
+	// BenchmarkRelativeEV measures EV, b and Kelly as excess return over BenchmarkReturn (%),
+	// so the Add/Hold/Trim/Sell thresholds apply to alpha. Off = absolute EV.
+	BenchmarkRelativeEV bool    `json:"benchmark_relative_ev"`
+	BenchmarkReturn     float64 `json:"benchmark_return"`
+	// Held positions worth less than MinPositionValue (EUR, 0 = off) are dust; ExcludeDust leaves
+	// them out of the weighted portfolio metrics.
+	MinPositionValue float64 `json:"min_position_value"`
+	ExcludeDust      bool    `json:"exclude_dust"`
+	// ShadowJSON is the portfolio's experimental config (PortfolioSettings.ShadowMetricsJSON) that
+	// CalculateMetrics computes into the Shadow* fields; empty = shadow mode off.
+	ShadowJSON string `json:"-"`
+}
+
+// evOffset is the return (%) subtracted from both EV scenarios: the benchmark's expected return in
+// benchmark-relative mode, else 0.
+func (cfg MetricsConfig) evOffset() float64 {
+	if !cfg.BenchmarkRelativeEV {
+		return 0
+	}
+	return cfg.BenchmarkReturn
+}
+
+// DefaultMetricsConfig returns the conservative EV policy thresholds.
+func DefaultMetricsConfig() MetricsConfig {
+	return MetricsConfig{
+		AddThreshold:       7,
+		TrimThreshold:      3,
+		SellThreshold:      0,
+		KellyScale:         0.5,
+		KellyCap:           15,
+		DefaultProbability: defaultProbabilityPositive,
+		ProbabilityBand:    defaultProbabilityBand,
+		MaxBuyZoneDownside: defaultMaxBuyZoneDownside,
+		MinRatioPositions:  defaultMinRatioPositions,
+		AssumedCorrelation: defaultAssumedCorrelation,
+		BenchmarkReturn:    defaultBenchmarkReturn,
+	}
+}
+
+// Shadow returns the experimental config computed alongside cfg, or nil when shadow mode is off.
+// ShadowJSON is validated when settings are saved, so an unparsable value also means off.
+func (cfg MetricsConfig) Shadow() *MetricsConfig {
+	shadow, err := ParseShadowMetricsConfig(cfg.ShadowJSON)
+	if err != nil {
+		return nil
+	}
+	return shadow
+}
+
+// ParseShadowMetricsConfig decodes a JSON MetricsConfig; omitted fields keep their defaults.
+// An empty string returns nil (shadow mode off).
+func ParseShadowMetricsConfig(raw string) (*MetricsConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	cfg := DefaultMetricsConfig()
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid shadow metrics config: %w", err)
+	}
+	if cfg.AddThreshold <= cfg.TrimThreshold || cfg.TrimThreshold < cfg.SellThreshold {
+		return nil, fmt.Errorf("invalid shadow metrics config: add_threshold must exceed trim_threshold >= sell_threshold")
+	}
+	if cfg.KellyScale <= 0 || cfg.KellyScale > 1 || cfg.KellyCap <= 0 {
+		return nil, fmt.Errorf("invalid shadow metrics config: kelly_scale must be in (0, 1] and kelly_cap positive")
+	}
+	if cfg.DefaultProbability <= 0 || cfg.DefaultProbability > 1 {
+		return nil, fmt.Errorf("invalid shadow metrics config: default_probability must be in (0, 1]")
+	}
+	if cfg.ProbabilityBand < 0 || cfg.ProbabilityBand > maxProbabilityBand {
+		return nil, fmt.Errorf("invalid shadow metrics config: probability_band must be in [0, %.1f]", maxProbabilityBand)
+	}
+	if cfg.MaxBuyZoneDownside < 0 {
+		return nil, fmt.Errorf("invalid shadow metrics config: max_buy_zone_downside must be >= 0")
+	}
+	if cfg.AssumedCorrelation < -1 || cfg.AssumedCorrelation > 1 {
+		return nil, fmt.Errorf("invalid shadow metrics config: assumed_correlation must be in [-1, 1]")
+	}
+	if cfg.MinPositionValue < 0 {
+		return nil, fmt.Errorf("invalid shadow metrics config: min_position_value must be >= 0")
+	}
+	return &cfg, nil
+}
+
+// MetricsConfigFromSettings builds a MetricsConfig from portfolio settings, falling back
+// to defaults for missing or inconsistent values.
+func MetricsConfigFromSettings(settings *models.PortfolioSettings) MetricsConfig {
+	cfg := DefaultMetricsConfig()
+	if settings == nil {
+		return cfg
+	}
+	if settings.EVAddThreshold > 0 {
+		cfg.AddThreshold = settings.EVAddThreshold
+	}
+	if settings.EVTrimThreshold >= 0 && settings.EVTrimThreshold < cfg.AddThreshold {
+		cfg.TrimThreshold = settings.EVTrimThreshold
+	}
+	if settings.EVSellThreshold <= cfg.TrimThreshold {
+		cfg.SellThreshold = settings.EVSellThreshold
+	}
+	if settings.KellyScale > 0 && settings.KellyScale <= 1 {
+		cfg.KellyScale = settings.KellyScale
+	}
+	if settings.KellyCap > 0 {
+		cfg.KellyCap = settings.KellyCap
+	}
+	if settings.ProbabilityBand >= 0 && settings.ProbabilityBand <= maxProbabilityBand {
+		cfg.ProbabilityBand = settings.ProbabilityBand
+	}
+	if settings.MaxBuyZoneDownside >= 0 {
+		cfg.MaxBuyZoneDownside = settings.MaxBuyZoneDownside
+	}
+	if settings.MinRatioPositions > 0 {
+		cfg.MinRatioPositions = settings.MinRatioPositions
+	}
+	if settings.AssumedCorrelation >= -1 && settings.AssumedCorrelation <= 1 {
+		cfg.AssumedCorrelation = settings.AssumedCorrelation
+	}
+	cfg.BenchmarkRelativeEV = settings.BenchmarkRelativeEV
+	if settings.BenchmarkReturn != 0 {
+		cfg.BenchmarkReturn = settings.BenchmarkReturn
+	}
+	if settings.MinPositionValue > 0 {
+		cfg.MinPositionValue = settings.MinPositionValue
+	}
+	cfg.ExcludeDust = settings.ExcludeDust
+	cfg.ShadowJSON = settings.ShadowMetricsJSON
+	return cfg
+}
+
+// PortfolioMetricsConfig loads the portfolio's settings and returns its MetricsConfig (see
+// MetricsConfigFromSettings), or the defaults when the settings cannot be loaded.
+func PortfolioMetricsConfig(db *gorm.DB, portfolioID uint) MetricsConfig {
+	var settings models.PortfolioSettings
+	if err := db.Where("portfolio_id = ?", portfolioID).First(&settings).Error; err != nil {
+		return DefaultMetricsConfig()
+	}
+	return MetricsConfigFromSettings(&settings)
+}
+
+// RecomputePortfolioMetrics recalculates and persists derived metrics for every stock in a
+// portfolio using the given config, so stored assessments reflect it immediately.
+// It returns the number of stocks whose assessment changed.
+func RecomputePortfolioMetrics(db *gorm.DB, portfolioID uint, cfg MetricsConfig) (int, error) {
+	var stocks []models.Stock
+	if err := db.Where("portfolio_id = ?", portfolioID).Find(&stocks).Error; err != nil {
+		return 0, fmt.Errorf("failed to load stocks: %w", err)
+	}
+
+	reclassified := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range stocks {
+			previous := stocks[i].Assessment
+			CalculateMetrics(&stocks[i], cfg)
+			if stocks[i].Assessment != previous {
+				reclassified++
+			}
+			if err := tx.Save(&stocks[i]).Error; err != nil {
+				return fmt.Errorf("failed to save %s: %w", stocks[i].Ticker, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reclassified, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// DefaultMonteCarloSimulations is the number of draws when the request does not set one.
+	DefaultMonteCarloSimulations = 10000
+	// MaxMonteCarloSimulations bounds a single request's work.
+	MaxMonteCarloSimulations = 200000
+)
+
+// MonteCarloInput describes one EV simulation. Returns and risks are percentages.
+type MonteCarloInput struct {
+	FairValue           float64 `json:"fair_value"`
+	CurrentPrice        float64 `json:"current_price"`
+	ProbabilityPositive float64 `json:"probability_positive"` // 0–1
+	Volatility          float64 `json:"volatility"`           // Standard deviation (%) of each simulated return
+	DownsideRisk        float64 `json:"downside_risk"`        // Negative, e.g. -20
+	Simulations         int     `json:"simulations"`          // 0 = DefaultMonteCarloSimulations
+	Seed                int64   `json:"seed"`                 // Fixes the draws for reproducible results; 0 = random
+}
+
+// MonteCarloResult summarizes the simulated return distribution.
+type MonteCarloResult struct {
+	Simulations       int     `json:"simulations"`
+	UpsidePotential   float64 `json:"upside_potential"`
+	ExpectedValue     float64 `json:"expected_value"` // Closed-form EV at the current price
+	MeanReturn        float64 `json:"mean_return"`    // Mean of the simulated returns
+	StdDev            float64 `json:"std_dev"`
+	P5                float64 `json:"p5"`
+	P25               float64 `json:"p25"`
+	P50               float64 `json:"p50"`
+	P75               float64 `json:"p75"`
+	P95               float64 `json:"p95"`
+	ProbabilityOfLoss float64 `json:"probability_of_loss"` // Fraction 0–1 of draws below 0
+	MeanConsistent    bool    `json:"mean_consistent"`     // MeanReturn is within 4 standard errors of ExpectedValue
+}
+
+// SimulateEV draws input.Simulations returns: with probability ProbabilityPositive a draw is normal
+// around the upside implied by FairValue/CurrentPrice, otherwise normal around DownsideRisk, both
+// with standard deviation Volatility. The mean therefore converges to the binary-model EV, which
+// is reported alongside as a sanity check.
+func SimulateEV(input MonteCarloInput) (MonteCarloResult, error) {
+	switch {
+	case input.FairValue <= 0:
+		return MonteCarloResult{}, fmt.Errorf("fair_value must be positive")
+	case input.CurrentPrice <= 0:
+		return MonteCarloResult{}, fmt.Errorf("current_price must be positive")
+	case input.ProbabilityPositive < 0 || input.ProbabilityPositive > 1:
+		return MonteCarloResult{}, fmt.Errorf("probability_positive must be between 0 and 1")
+	case input.Volatility < 0:
+		return MonteCarloResult{}, fmt.Errorf("volatility must not be negative")
+	case input.Simulations < 0 || input.Simulations > MaxMonteCarloSimulations:
+		return MonteCarloResult{}, fmt.Errorf("simulations must be between 1 and %d", MaxMonteCarloSimulations)
+	}
+	n := input.Simulations
+	if n == 0 {
+		n = DefaultMonteCarloSimulations
+	}
+	seed := input.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	upside := (input.FairValue - input.CurrentPrice) / input.CurrentPrice * 100
+	draws := make([]float64, n)
+	var sum, losses float64
+	for i := range draws {
+		center := input.DownsideRisk
+		if rng.Float64() < input.ProbabilityPositive {
+			center = upside
+		}
+		draws[i] = center + rng.NormFloat64()*input.Volatility
+		sum += draws[i]
+		if draws[i] < 0 {
+			losses++
+		}
+	}
+	mean := sum / float64(n)
+	var squares float64
+	for _, draw := range draws {
+		squares += (draw - mean) * (draw - mean)
+	}
+	stdDev := math.Sqrt(squares / float64(n))
+	sort.Float64s(draws)
+
+	result := MonteCarloResult{
+		Simulations:       n,
+		UpsidePotential:   upside,
+		ExpectedValue:     expectedValueAtPrice(input.FairValue, input.ProbabilityPositive, input.DownsideRisk, input.CurrentPrice),
+		MeanReturn:        mean,
+		StdDev:            stdDev,
+		P5:                percentileSorted(draws, 5),
+		P25:               percentileSorted(draws, 25),
+		P50:               percentileSorted(draws, 50),
+		P75:               percentileSorted(draws, 75),
+		P95:               percentileSorted(draws, 95),
+		ProbabilityOfLoss: losses / float64(n),
+	}
+	result.MeanConsistent = math.Abs(result.MeanReturn-result.ExpectedValue) <= 4*stdDev/math.Sqrt(float64(n))+1e-9
+	return result, nil
+}
+
+// percentileSorted returns the pct-th percentile (0–100) of sorted values, interpolating linearly
+// between neighbouring ranks.
+func percentileSorted(sorted []float64, pct float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := pct / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
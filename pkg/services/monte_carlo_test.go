@@ -0,0 +1,68 @@
+package services
+
+import "testing"
+
+func TestSimulateEVMatchesBinaryModel(t *testing.T) {
+	t.Parallel()
+	// 30% upside with p = 0.6 and -20% downside: EV = 0.6*30 + 0.4*(-20) = 10.
+	input := MonteCarloInput{FairValue: 130, CurrentPrice: 100, ProbabilityPositive: 0.6, DownsideRisk: -20, Seed: 42}
+
+	// Without volatility every draw is exactly the upside or the downside.
+	exact, err := SimulateEV(input)
+	if err != nil {
+		t.Fatalf("SimulateEV: %v", err)
+	}
+	if exact.Simulations != DefaultMonteCarloSimulations {
+		t.Fatalf("Simulations: got %d want %d", exact.Simulations, DefaultMonteCarloSimulations)
+	}
+	assertClose(t, exact.ExpectedValue, 10, 0.0001, "ExpectedValue")
+	assertClose(t, exact.P5, -20, 0.0001, "P5")
+	assertClose(t, exact.P95, 30, 0.0001, "P95")
+	assertClose(t, exact.ProbabilityOfLoss, 0.4, 0.02, "ProbabilityOfLoss")
+	assertClose(t, exact.MeanReturn, 10, 0.5, "MeanReturn")
+
+	input.Volatility = 15
+	spread, err := SimulateEV(input)
+	if err != nil {
+		t.Fatalf("SimulateEV: %v", err)
+	}
+	if !spread.MeanConsistent {
+		t.Fatalf("expected the simulated mean %.3f to match EV %.3f", spread.MeanReturn, spread.ExpectedValue)
+	}
+	if !(spread.P5 < spread.P25 && spread.P25 < spread.P50 && spread.P50 < spread.P75 && spread.P75 < spread.P95) {
+		t.Fatalf("percentiles out of order: %+v", spread)
+	}
+	if spread.P5 >= exact.P5 || spread.P95 <= exact.P95 {
+		t.Fatalf("volatility should widen the tails: %+v", spread)
+	}
+
+	// The same seed reproduces the same draws.
+	again, _ := SimulateEV(input)
+	if again != spread {
+		t.Fatalf("expected identical results for the same seed")
+	}
+}
+
+func TestSimulateEVRejectsInvalidInput(t *testing.T) {
+	t.Parallel()
+	valid := MonteCarloInput{FairValue: 130, CurrentPrice: 100, ProbabilityPositive: 0.6, DownsideRisk: -20, Volatility: 10}
+	tests := []struct {
+		name   string
+		mutate func(*MonteCarloInput)
+	}{
+		{"zero fair value", func(in *MonteCarloInput) { in.FairValue = 0 }},
+		{"zero price", func(in *MonteCarloInput) { in.CurrentPrice = 0 }},
+		{"probability above 1", func(in *MonteCarloInput) { in.ProbabilityPositive = 1.2 }},
+		{"negative volatility", func(in *MonteCarloInput) { in.Volatility = -1 }},
+		{"too many simulations", func(in *MonteCarloInput) { in.Simulations = MaxMonteCarloSimulations + 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid
+			tt.mutate(&input)
+			if _, err := SimulateEV(input); err == nil {
+				t.Fatalf("expected an error for %+v", input)
+			}
+		})
+	}
+}
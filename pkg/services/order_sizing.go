@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// OrderSizingOptions controls SuggestOrder.
+type OrderSizingOptions struct {
+	AvailableCashEUR  float64 // Cash the order may draw on, before the buffer
+	MaxPositionWeight float64 // Per-position cap (%); 0 = no cap
+	MinCashBufferPct  float64 // Cash (% of total value) that must remain after the order
+	MinTradeValueEUR  float64 // Orders smaller than this are not suggested
+	WeightStep        float64 // Round the target weight to this step (%), e.g. 0.5; 0 = no rounding
+}
+
+// SuggestedOrder is the buy that moves one stock toward its ½-Kelly suggested weight.
+// Weights are percentages (0–100) of total portfolio value (positions + cash).
+type SuggestedOrder struct {
+	StockID            uint    `json:"stock_id"`
+	Ticker             string  `json:"ticker"`
+	Currency           string  `json:"currency"`
+	Price              float64 `json:"price"`
+	CurrentShares      int     `json:"current_shares"`
+	CurrentWeightPct   float64 `json:"current_weight_pct"`
+	RawTargetWeightPct float64 `json:"raw_target_weight_pct"` // Capped ½-Kelly weight before rounding
+	TargetWeightPct    float64 `json:"target_weight_pct"`     // RawTargetWeightPct rounded to WeightStep
+	RawShares          float64 `json:"raw_shares"`            // Fractional shares that would reach RawTargetWeightPct
+	Shares             int     `json:"shares"`
+	Cost               float64 `json:"cost"` // In the stock's currency
+	CostEUR            float64 `json:"cost_eur"`
+	ResultingWeightPct float64 `json:"resulting_weight_pct"`
+	TotalValueEUR      float64 `json:"total_value_eur"`
+	AvailableCashEUR   float64 `json:"available_cash_eur"`
+	SpendableCashEUR   float64 `json:"spendable_cash_eur"`   // Available cash above the buffer
+	LimitedBy          string  `json:"limited_by,omitempty"` // position_cap or cash_buffer
+	Reason             string  `json:"reason,omitempty"`     // Why no shares are suggested
+}
+
+// SuggestOrder sizes a buy of stock (one of stocks, with metrics computed) in whole shares that
+// brings it up to its HalfKellySuggested weight of total portfolio value (positions + cashEUR),
+// capped at MaxPositionWeight and rounded to WeightStep. The order never spends more than
+// AvailableCashEUR minus MinCashBufferPct of total value, and is dropped when below MinTradeValueEUR.
+func SuggestOrder(stock models.Stock, stocks []models.Stock, fxRates map[string]float64, cashEUR float64, opts OrderSizingOptions) (SuggestedOrder, error) {
+	fxRate := fxRates[stock.Currency]
+	if stock.CurrentPrice <= 0 {
+		return SuggestedOrder{}, fmt.Errorf("%s has no current price", stock.Ticker)
+	}
+	if fxRate <= 0 {
+		return SuggestedOrder{}, fmt.Errorf("no exchange rate for %s", stock.Currency)
+	}
+	_, invested := positionValuesEUR(stocks, fxRates)
+	totalValue := invested + cashEUR
+	if totalValue <= 0 {
+		return SuggestedOrder{}, fmt.Errorf("portfolio has no value to size against")
+	}
+
+	priceEUR := stock.CurrentPrice / fxRate
+	currentEUR := math.Max(float64(stock.SharesOwned), 0) * priceEUR
+	order := SuggestedOrder{
+		StockID:          stock.ID,
+		Ticker:           stock.Ticker,
+		Currency:         stock.Currency,
+		Price:            stock.CurrentPrice,
+		CurrentShares:    stock.SharesOwned,
+		CurrentWeightPct: currentEUR / totalValue * 100,
+		TargetWeightPct:  math.Max(stock.HalfKellySuggested, 0),
+		TotalValueEUR:    totalValue,
+		AvailableCashEUR: opts.AvailableCashEUR,
+		SpendableCashEUR: math.Max(opts.AvailableCashEUR-opts.MinCashBufferPct/100*totalValue, 0),
+	}
+	if opts.MaxPositionWeight > 0 && order.TargetWeightPct > opts.MaxPositionWeight {
+		order.TargetWeightPct = opts.MaxPositionWeight
+		order.LimitedBy = "position_cap"
+	}
+	order.RawTargetWeightPct = order.TargetWeightPct
+	order.TargetWeightPct = RoundToStep(order.TargetWeightPct, opts.WeightStep)
+	if opts.MaxPositionWeight > 0 && order.TargetWeightPct > opts.MaxPositionWeight {
+		order.TargetWeightPct = math.Floor(opts.MaxPositionWeight/opts.WeightStep) * opts.WeightStep // Rounded up past the cap
+	}
+	order.RawShares = math.Max(order.RawTargetWeightPct/100*totalValue-currentEUR, 0) / priceEUR
+	order.ResultingWeightPct = order.CurrentWeightPct
+
+	neededEUR := order.TargetWeightPct/100*totalValue - currentEUR
+	switch {
+	case order.TargetWeightPct <= 0:
+		order.Reason = "No Kelly allocation suggested"
+		return order, nil
+	case neededEUR < priceEUR:
+		order.Reason = "Position is at or above its target weight"
+		return order, nil
+	}
+	if neededEUR > order.SpendableCashEUR {
+		neededEUR = order.SpendableCashEUR
+		order.LimitedBy = "cash_buffer"
+	}
+
+	shares := int(math.Floor(neededEUR / priceEUR))
+	costEUR := float64(shares) * priceEUR
+	switch {
+	case shares <= 0:
+		order.Reason = "Not enough cash above the buffer for one share"
+		return order, nil
+	case costEUR < opts.MinTradeValueEUR:
+		order.Reason = fmt.Sprintf("Order of %.2f EUR is below the minimum trade value", costEUR)
+		return order, nil
+	}
+	order.Shares = shares
+	order.Cost = float64(shares) * stock.CurrentPrice
+	order.CostEUR = costEUR
+	order.ResultingWeightPct = (currentEUR + costEUR) / totalValue * 100
+	return order, nil
+}
+
+// RoundToStep rounds value to the nearest multiple of step; a non-positive step leaves it unchanged.
+func RoundToStep(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	return math.Round(value/step) * step
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestSuggestOrderReachesTargetWeight(t *testing.T) {
+	t.Parallel()
+	// ACME trades at 100 USD = 80 EUR; 10 held = 800 EUR. With OTHER (4,200) and 5,000 cash the
+	// portfolio is 10,000 EUR, so the 12% target is 1,200 EUR: 400 EUR more, i.e. 5 shares.
+	fxRates := map[string]float64{"EUR": 1, "USD": 1.25}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "ACME", Currency: "USD", CurrentPrice: 100, SharesOwned: 10, HalfKellySuggested: 12},
+		{ID: 2, Ticker: "OTHER", Currency: "EUR", CurrentPrice: 50, SharesOwned: 84, HalfKellySuggested: 5},
+	}
+	opts := OrderSizingOptions{AvailableCashEUR: 5000, MaxPositionWeight: 15, MinCashBufferPct: 8}
+
+	order, err := SuggestOrder(stocks[0], stocks, fxRates, 5000, opts)
+	if err != nil {
+		t.Fatalf("SuggestOrder: %v", err)
+	}
+	if order.Shares != 5 || order.LimitedBy != "" {
+		t.Fatalf("expected 5 shares without a limit, got %+v", order)
+	}
+	assertClose(t, order.TotalValueEUR, 10000, 0.0001, "TotalValueEUR")
+	assertClose(t, order.CurrentWeightPct, 8, 0.0001, "CurrentWeight")
+	assertClose(t, order.Cost, 500, 0.0001, "Cost")
+	assertClose(t, order.CostEUR, 400, 0.0001, "CostEUR")
+	assertClose(t, order.ResultingWeightPct, 12, 0.0001, "ResultingWeight")
+
+	// The position cap lowers the target to 10.4% (1,040 EUR): 3 shares.
+	opts.MaxPositionWeight = 10.4
+	capped, err := SuggestOrder(stocks[0], stocks, fxRates, 5000, opts)
+	if err != nil {
+		t.Fatalf("SuggestOrder: %v", err)
+	}
+	if capped.Shares != 3 || capped.LimitedBy != "position_cap" {
+		t.Fatalf("expected 3 shares limited by the cap, got %+v", capped)
+	}
+	assertClose(t, capped.ResultingWeightPct, 10.4, 0.0001, "capped ResultingWeight")
+
+	// 1,000 EUR of cash less the 8% buffer (800 EUR) leaves 200 EUR: 2 shares at 80 EUR.
+	opts.MaxPositionWeight = 15
+	opts.AvailableCashEUR = 1000
+	limited, err := SuggestOrder(stocks[0], stocks, fxRates, 5000, opts)
+	if err != nil {
+		t.Fatalf("SuggestOrder: %v", err)
+	}
+	if limited.Shares != 2 || limited.LimitedBy != "cash_buffer" {
+		t.Fatalf("expected 2 shares limited by the cash buffer, got %+v", limited)
+	}
+	assertClose(t, limited.SpendableCashEUR, 200, 0.0001, "SpendableCashEUR")
+	assertClose(t, limited.ResultingWeightPct, 9.6, 0.0001, "limited ResultingWeight")
+}
+
+func TestSuggestOrderRoundsTargetWeightToStep(t *testing.T) {
+	t.Parallel()
+	// 10,000 EUR portfolio: 5,000 in OTHER plus 5,000 cash. ACME's 10.625% target rounds to 10.5%
+	// (1,050 EUR = 42 shares at 25 EUR); the raw target would need 42.5 shares.
+	fxRates := map[string]float64{"EUR": 1}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "ACME", Currency: "EUR", CurrentPrice: 25, HalfKellySuggested: 10.625},
+		{ID: 2, Ticker: "OTHER", Currency: "EUR", CurrentPrice: 50, SharesOwned: 100},
+	}
+	opts := OrderSizingOptions{AvailableCashEUR: 5000, MaxPositionWeight: 15, WeightStep: 0.5}
+
+	order, err := SuggestOrder(stocks[0], stocks, fxRates, 5000, opts)
+	if err != nil {
+		t.Fatalf("SuggestOrder: %v", err)
+	}
+	assertClose(t, order.RawTargetWeightPct, 10.625, 0.0001, "RawTargetWeight")
+	assertClose(t, order.TargetWeightPct, 10.5, 0.0001, "TargetWeight")
+	assertClose(t, order.RawShares, 42.5, 0.0001, "RawShares")
+	if order.Shares != 42 {
+		t.Fatalf("expected 42 shares, got %+v", order)
+	}
+	assertClose(t, order.CostEUR, 1050, 0.0001, "CostEUR")
+	assertClose(t, order.ResultingWeightPct, 10.5, 0.0001, "ResultingWeight")
+
+	// A rounded target never exceeds the position cap: a 10.4% cap would round up to 10.5%, so 10% is used.
+	opts.MaxPositionWeight = 10.4
+	capped, err := SuggestOrder(stocks[0], stocks, fxRates, 5000, opts)
+	if err != nil {
+		t.Fatalf("SuggestOrder: %v", err)
+	}
+	assertClose(t, capped.TargetWeightPct, 10, 0.0001, "capped TargetWeight")
+	if capped.Shares != 40 || capped.LimitedBy != "position_cap" {
+		t.Fatalf("expected 40 shares limited by the cap, got %+v", capped)
+	}
+
+	// Without a step the target is used as is and shares are still whole.
+	opts.MaxPositionWeight = 15
+	opts.WeightStep = 0
+	unrounded, err := SuggestOrder(stocks[0], stocks, fxRates, 5000, opts)
+	if err != nil {
+		t.Fatalf("SuggestOrder: %v", err)
+	}
+	assertClose(t, unrounded.TargetWeightPct, 10.625, 0.0001, "unrounded TargetWeight")
+	if unrounded.Shares != 42 {
+		t.Fatalf("expected 42 unrounded shares, got %+v", unrounded)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"math"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// Order statuses.
+const (
+	OrderStatusOpen      = "open"
+	OrderStatusPartial   = "partial"
+	OrderStatusFilled    = "filled"
+	OrderStatusCancelled = "cancelled"
+)
+
+// DefaultOrderNearLimitPct is the distance (%) between price and limit at which an open order is flagged.
+const DefaultOrderNearLimitPct = 2.0
+
+// OrderStatusFor returns open, partial or filled for filled of quantity shares.
+func OrderStatusFor(filled, quantity float64) string {
+	switch {
+	case filled <= 0:
+		return OrderStatusOpen
+	case filled < quantity:
+		return OrderStatusPartial
+	default:
+		return OrderStatusFilled
+	}
+}
+
+// OrderIsActive reports whether the order can still fill (open or partially filled).
+func OrderIsActive(order models.Order) bool {
+	return order.Status == OrderStatusOpen || order.Status == OrderStatusPartial
+}
+
+// OpenOrderView is an active order shown against its position in the portfolio summary.
+type OpenOrderView struct {
+	OrderID           uint    `json:"order_id"`
+	StockID           uint    `json:"stock_id,omitempty"` // 0 when the ticker is not tracked yet
+	Ticker            string  `json:"ticker"`
+	Side              string  `json:"side"`
+	Status            string  `json:"status"`
+	LimitPrice        float64 `json:"limit_price"`
+	RemainingQuantity float64 `json:"remaining_quantity"`
+	CurrentPrice      float64 `json:"current_price"` // 0 when the ticker is not tracked yet
+	DistancePct       float64 `json:"distance_pct"`  // (current - limit) / limit, in percent
+	NearLimit         bool    `json:"near_limit"`    // Price is within nearLimitPct of the limit, or already through it
+}
+
+// OpenOrderViews matches active orders to stocks by ticker and flags those whose current price is
+// within nearLimitPct of the limit on the side that would fill: at most limit*(1+pct) for buys and
+// at least limit*(1-pct) for sells.
+func OpenOrderViews(orders []models.Order, stocks []models.Stock, nearLimitPct float64) []OpenOrderView {
+	byTicker := make(map[string]models.Stock, len(stocks))
+	for _, stock := range stocks {
+		byTicker[strings.ToUpper(stock.Ticker)] = stock
+	}
+
+	views := make([]OpenOrderView, 0, len(orders))
+	for _, order := range orders {
+		if !OrderIsActive(order) {
+			continue
+		}
+		view := OpenOrderView{
+			OrderID:           order.ID,
+			Ticker:            order.Ticker,
+			Side:              order.Side,
+			Status:            order.Status,
+			LimitPrice:        order.LimitPrice,
+			RemainingQuantity: math.Max(order.Quantity-order.FilledQuantity, 0),
+		}
+		if stock, ok := byTicker[strings.ToUpper(order.Ticker)]; ok {
+			view.StockID = stock.ID
+			view.CurrentPrice = stock.CurrentPrice
+		}
+		if view.CurrentPrice > 0 && order.LimitPrice > 0 {
+			view.DistancePct = (view.CurrentPrice - order.LimitPrice) / order.LimitPrice * 100
+			if order.Side == "Sell" {
+				view.NearLimit = view.DistancePct >= -nearLimitPct
+			} else {
+				view.NearLimit = view.DistancePct <= nearLimitPct
+			}
+		}
+		views = append(views, view)
+	}
+	return views
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestOpenOrderViewsFlagsOrdersNearTheirLimit(t *testing.T) {
+	t.Parallel()
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "ACME", CurrentPrice: 101},
+		{ID: 2, Ticker: "BETA", CurrentPrice: 95},
+	}
+	orders := []models.Order{
+		{ID: 1, Ticker: "ACME", Side: "Buy", LimitPrice: 100, Quantity: 10, Status: OrderStatusOpen},                       // 1% above the buy limit
+		{ID: 2, Ticker: "ACME", Side: "Buy", LimitPrice: 90, Quantity: 10, Status: OrderStatusOpen},                        // 12% above
+		{ID: 3, Ticker: "BETA", Side: "Sell", LimitPrice: 100, Quantity: 5, FilledQuantity: 2, Status: OrderStatusPartial}, // 5% below the sell limit
+		{ID: 4, Ticker: "BETA", Side: "Sell", LimitPrice: 94, Quantity: 5, Status: OrderStatusOpen},                        // Already through the limit
+		{ID: 5, Ticker: "ACME", Side: "Buy", LimitPrice: 100, Quantity: 10, Status: OrderStatusFilled},
+	}
+
+	views := OpenOrderViews(orders, stocks, 2)
+	if len(views) != 4 {
+		t.Fatalf("expected 4 active orders, got %+v", views)
+	}
+	wantNear := map[uint]bool{1: true, 2: false, 3: false, 4: true}
+	for _, view := range views {
+		if view.NearLimit != wantNear[view.OrderID] {
+			t.Errorf("order %d: near_limit got %v want %v (distance %.2f%%)", view.OrderID, view.NearLimit, wantNear[view.OrderID], view.DistancePct)
+		}
+	}
+	assertClose(t, views[0].DistancePct, 1, 0.0001, "DistancePct")
+	assertClose(t, views[2].RemainingQuantity, 3, 0.0001, "RemainingQuantity")
+	if views[2].StockID != 2 {
+		t.Errorf("StockID: got %d want 2", views[2].StockID)
+	}
+}
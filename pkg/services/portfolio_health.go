@@ -0,0 +1,170 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// DefaultMaxPositions is the soft cap on held positions before consolidation is suggested.
+const DefaultMaxPositions = 20
+
+// Health warning codes.
+const (
+	HealthWarningTooManyPositions    = "too_many_positions"
+	HealthWarningCashBelowTarget     = "cash_below_target"
+	HealthWarningLeveraged           = "leveraged"
+	HealthWarningCorrelatedPositions = "correlated_positions"
+)
+
+// Sharpe ratio statuses.
+const (
+	SharpeStatusOK               = "ok"
+	SharpeStatusInsufficientData = "insufficient_data"
+)
+
+// Cash buffer statuses.
+const (
+	CashBufferOK          = "ok"
+	CashBufferBelowTarget = "below_target"
+	CashBufferLeveraged   = "leveraged" // Net cash is negative (margin/overdraft)
+)
+
+// HealthPosition is a held position referenced by a health warning.
+type HealthPosition struct {
+	StockID   uint    `json:"stock_id"`
+	Ticker    string  `json:"ticker"`
+	ValueEUR  float64 `json:"value_eur"`
+	WeightPct float64 `json:"weight_pct"` // Percent (0–100) of invested value
+}
+
+// HealthWarning is one issue found by a portfolio health check.
+type HealthWarning struct {
+	Code      string           `json:"code"`
+	Message   string           `json:"message"`
+	Positions []HealthPosition `json:"positions,omitempty"` // Positions the warning suggests acting on
+}
+
+// PortfolioHealth summarizes portfolio-level checks. Values are in EUR; TotalValueEUR is net
+// liquidity (positions + cash), so negative cash reduces it.
+type PortfolioHealth struct {
+	Positions          int                 `json:"positions"`
+	MaxPositions       int                 `json:"max_positions"` // 0 = position cap disabled
+	InvestedEUR        float64             `json:"invested_eur"`
+	CashEUR            float64             `json:"cash_eur"`
+	TotalValueEUR      float64             `json:"total_value_eur"`
+	CashPct            float64             `json:"cash_pct"` // Percent (0–100) of total value; negative when leveraged
+	MinCashBufferPct   float64             `json:"min_cash_buffer_pct"`
+	CashBufferStatus   string              `json:"cash_buffer_status"` // ok, below_target or leveraged
+	SharpeRatio        *float64            `json:"sharpe_ratio"`       // Nil until there is enough data (see SharpeStatus)
+	SharpeStatus       string              `json:"sharpe_status"`      // ok or insufficient_data
+	SharpeReason       string              `json:"sharpe_reason,omitempty"`
+	CorrelatedClusters []CorrelatedCluster `json:"correlated_clusters"`
+	Warnings           []HealthWarning     `json:"warnings"`
+}
+
+// HealthOptions controls the portfolio health checks.
+type HealthOptions struct {
+	MaxPositions        int               // Soft cap on held positions (0 = off)
+	CashEUR             float64           // Net cash across holdings; negative for margin/overdraft
+	MinCashBufferPct    float64           // Target minimum cash (%) of total value
+	MinRatioPositions   int               // Valued positions required before the Sharpe ratio is reported
+	Correlations        CorrelationMatrix // Pairwise return correlations for the Sharpe ratio's volatility
+	MaxCorrelatedWeight float64           // Cap (%) on the combined weight of correlated positions (0 = off)
+}
+
+// CheckPortfolioHealth runs the portfolio-level checks over held positions.
+func CheckPortfolioHealth(stocks []models.Stock, fxRates map[string]float64, opts HealthOptions) PortfolioHealth {
+	positionsEUR, invested := positionValuesEUR(stocks, fxRates)
+	held := make([]HealthPosition, 0, len(stocks))
+	var weightedEV float64
+	var weights, volatilities []float64
+	var tickers []string
+	valued := 0
+	for i, stock := range stocks {
+		if stock.SharesOwned <= 0 {
+			continue
+		}
+		position := HealthPosition{StockID: stock.ID, Ticker: stock.Ticker, ValueEUR: positionsEUR[i]}
+		if invested > 0 {
+			position.WeightPct = positionsEUR[i] / invested * 100
+		}
+		if positionsEUR[i] > 0 {
+			weightedEV += stock.ExpectedValue * position.WeightPct / 100
+			weights = append(weights, position.WeightPct/100)
+			volatilities = append(volatilities, stock.Volatility)
+			tickers = append(tickers, stock.Ticker)
+			valued++
+		}
+		held = append(held, position)
+	}
+
+	health := PortfolioHealth{
+		Positions:        len(held),
+		MaxPositions:     opts.MaxPositions,
+		InvestedEUR:      invested,
+		CashEUR:          opts.CashEUR,
+		TotalValueEUR:    invested + opts.CashEUR,
+		MinCashBufferPct: opts.MinCashBufferPct,
+		CashBufferStatus: CashBufferOK,
+		SharpeStatus:     SharpeStatusOK,
+		Warnings:         []HealthWarning{},
+	}
+	// Same correlation-aware volatility as the portfolio summary, so both report the same sharpe_ratio.
+	weightedVolatility := PortfolioVolatility(weights, volatilities, tickers, opts.Correlations)
+	health.SharpeRatio, health.SharpeReason = SharpeRatio(weightedEV, weightedVolatility, valued, opts.MinRatioPositions)
+	if health.SharpeRatio == nil {
+		health.SharpeStatus = SharpeStatusInsufficientData
+	}
+	if warning, ok := positionCountWarning(held, opts.MaxPositions); ok {
+		health.Warnings = append(health.Warnings, warning)
+	}
+	if warning, ok := cashBufferWarning(&health); ok {
+		health.Warnings = append(health.Warnings, warning)
+	}
+	health.CorrelatedClusters = FindCorrelatedClusters(stocks, fxRates, opts.MaxCorrelatedWeight)
+	if health.CorrelatedClusters == nil {
+		health.CorrelatedClusters = []CorrelatedCluster{}
+	}
+	health.Warnings = append(health.Warnings, correlatedPositionsWarnings(health.CorrelatedClusters, held)...)
+	return health
+}
+
+// cashBufferWarning sets the cash percentage and buffer status from CalculateCashBuffer, and warns
+// when cash is negative (leveraged) or below the minimum buffer.
+func cashBufferWarning(health *PortfolioHealth) (HealthWarning, bool) {
+	buffer := CalculateCashBuffer(health.InvestedEUR, health.CashEUR, health.MinCashBufferPct, 0)
+	health.CashPct = buffer.CashPct
+	switch {
+	case health.CashEUR < 0:
+		health.CashBufferStatus = CashBufferLeveraged
+		return HealthWarning{
+			Code:    HealthWarningLeveraged,
+			Message: fmt.Sprintf("Net cash is negative (%.2f EUR); positions are partly financed by margin", health.CashEUR),
+		}, true
+	case buffer.Status == CashBandBelow:
+		health.CashBufferStatus = CashBufferBelowTarget
+		return HealthWarning{
+			Code:    HealthWarningCashBelowTarget,
+			Message: fmt.Sprintf("Cash is %.1f%% of the portfolio, below the %.1f%% buffer", health.CashPct, health.MinCashBufferPct),
+		}, true
+	}
+	return HealthWarning{}, false
+}
+
+// positionCountWarning flags a portfolio holding more than maxPositions and lists the smallest
+// positions, as many as the cap is exceeded by, as consolidation candidates.
+func positionCountWarning(held []HealthPosition, maxPositions int) (HealthWarning, bool) {
+	if maxPositions <= 0 || len(held) <= maxPositions {
+		return HealthWarning{}, false
+	}
+	smallest := append([]HealthPosition(nil), held...)
+	sort.SliceStable(smallest, func(i, j int) bool { return smallest[i].ValueEUR < smallest[j].ValueEUR })
+	excess := len(held) - maxPositions
+	return HealthWarning{
+		Code:      HealthWarningTooManyPositions,
+		Message:   fmt.Sprintf("%d positions exceed the soft cap of %d; consider consolidating the %d smallest", len(held), maxPositions, excess),
+		Positions: smallest[:excess],
+	}, true
+}
@@ -0,0 +1,23 @@
+package services
+
+import (
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// NewPortfolioSnapshot builds the portfolio's daily snapshot from its EUR metrics and cash holdings
+// in EUR. CashPct is cash's share of positions plus cash, as in CalculateCashBuffer.
+func NewPortfolioSnapshot(portfolioID uint, metrics PortfolioMetrics, cashEUR float64, recordedAt time.Time) models.PortfolioSnapshot {
+	snapshot := models.PortfolioSnapshot{
+		PortfolioID:      portfolioID,
+		TotalValueEUR:    metrics.TotalValue,
+		CashEUR:          cashEUR,
+		OverallEV:        metrics.OverallEV,
+		SharpeRatio:      metrics.SharpeRatio,
+		KellyUtilization: metrics.KellyUtilization,
+		CashPct:          CalculateCashBuffer(metrics.TotalValue, cashEUR, 0, 0).CashPct,
+		RecordedAt:       recordedAt,
+	}
+	return snapshot
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"math"
+	"strings"
+)
+
+// defaultAssumedCorrelation is the return correlation assumed between two positions when no
+// pairwise figure is known.
+const defaultAssumedCorrelation = 0.3
+
+// CorrelationMatrix holds pairwise return correlations between tickers. Pairs keys are
+// CorrelationPairKey values; pairs it does not list use Default.
+type CorrelationMatrix struct {
+	Default float64
+	Pairs   map[string]float64
+}
+
+// CorrelationPairKey returns the Pairs key of two tickers, independent of their order and case.
+func CorrelationPairKey(a, b string) string {
+	a, b = strings.ToUpper(strings.TrimSpace(a)), strings.ToUpper(strings.TrimSpace(b))
+	if b < a {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
+
+// Correlation returns the correlation between two tickers (1 for the same ticker), clamped to [-1, 1].
+func (m CorrelationMatrix) Correlation(a, b string) float64 {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a != "" && strings.EqualFold(a, b) {
+		return 1
+	}
+	rho, ok := m.Pairs[CorrelationPairKey(a, b)]
+	if !ok {
+		rho = m.Default
+	}
+	return math.Max(-1, math.Min(1, rho))
+}
+
+// PortfolioVolatility returns sqrt(w'Σw), where Σ[i][j] = vol[i] * vol[j] * ρ(i, j), for positions
+// with the given weights (fractions), volatilities (%) and tickers. Any correlation below 1 makes it
+// lower than the linear sum of weight * volatility, which assumes every pair moves together.
+func PortfolioVolatility(weights, volatilities []float64, tickers []string, correlations CorrelationMatrix) float64 {
+	var variance float64
+	for i := range weights {
+		for j := range weights {
+			rho := 1.0
+			if i != j {
+				rho = correlations.Correlation(tickers[i], tickers[j])
+			}
+			variance += weights[i] * weights[j] * volatilities[i] * volatilities[j] * rho
+		}
+	}
+	// An inconsistent matrix can make the variance slightly negative.
+	return math.Sqrt(math.Max(0, variance))
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestPortfolioVolatilityBelowLinearSumForImperfectCorrelation(t *testing.T) {
+	t.Parallel()
+	// Two equal 1,000 EUR positions with 20% and 30% volatility: the linear sum is 25%.
+	stocks := []models.Stock{
+		{Ticker: "AAA", SharesOwned: 10, CurrentPrice: 100, Currency: "EUR", Volatility: 20},
+		{Ticker: "BBB", SharesOwned: 10, CurrentPrice: 100, Currency: "EUR", Volatility: 30},
+	}
+	fxRates := map[string]float64{"EUR": 1}
+
+	// Uncorrelated pair, given in reverse order: sqrt(0.25*400 + 0.25*900) = sqrt(325).
+	matrix := CorrelationMatrix{Default: 0.3, Pairs: map[string]float64{CorrelationPairKey("bbb", "AAA"): 0}}
+	metrics := CalculatePortfolioMetricsWithCorrelations(stocks, fxRates, "EUR", matrix, DefaultMetricsConfig())
+	assertClose(t, metrics.NaiveVolatility, 25, 1e-9, "NaiveVolatility")
+	assertClose(t, metrics.WeightedVolatility, 18.027756, 1e-6, "WeightedVolatility at rho 0")
+
+	// The default correlation applies to unlisted pairs: sqrt(325 + 2*0.25*0.3*600) = sqrt(415).
+	metrics = CalculatePortfolioMetricsWithCorrelations(stocks, fxRates, "EUR", CorrelationMatrix{Default: 0.3}, DefaultMetricsConfig())
+	assertClose(t, metrics.WeightedVolatility, 20.371549, 1e-6, "WeightedVolatility at rho 0.3")
+	if metrics.WeightedVolatility >= metrics.NaiveVolatility {
+		t.Errorf("correlation-adjusted volatility %.4f should be below the linear %.4f", metrics.WeightedVolatility, metrics.NaiveVolatility)
+	}
+
+	// Perfect correlation reproduces the linear sum.
+	metrics = CalculatePortfolioMetricsWithCorrelations(stocks, fxRates, "EUR", CorrelationMatrix{Default: 1}, DefaultMetricsConfig())
+	assertClose(t, metrics.WeightedVolatility, 25, 1e-9, "WeightedVolatility at rho 1")
+}
+
+func TestPortfolioHealthSharpeMatchesSummary(t *testing.T) {
+	t.Parallel()
+	stocks := []models.Stock{
+		{Ticker: "AAA", SharesOwned: 10, CurrentPrice: 100, Currency: "EUR", Volatility: 20, ExpectedValue: 12},
+		{Ticker: "BBB", SharesOwned: 20, CurrentPrice: 100, Currency: "EUR", Volatility: 30, ExpectedValue: 9},
+		{Ticker: "CCC", SharesOwned: 5, CurrentPrice: 100, Currency: "EUR", Volatility: 25, ExpectedValue: 15},
+	}
+	fxRates := map[string]float64{"EUR": 1}
+	cfg := DefaultMetricsConfig()
+	matrix := CorrelationMatrix{Default: cfg.AssumedCorrelation}
+
+	metrics := CalculatePortfolioMetricsWithCorrelations(stocks, fxRates, "EUR", matrix, cfg)
+	health := CheckPortfolioHealth(stocks, fxRates, HealthOptions{MinRatioPositions: cfg.MinRatioPositions, Correlations: matrix})
+	if metrics.SharpeRatio == nil || health.SharpeRatio == nil {
+		t.Fatalf("expected both Sharpe ratios, summary %v health %v", metrics.SharpeRatio, health.SharpeRatio)
+	}
+	assertClose(t, *health.SharpeRatio, *metrics.SharpeRatio, 1e-9, "health SharpeRatio")
+}
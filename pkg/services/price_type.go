@@ -0,0 +1,7 @@
+package services
+
+// StockHistory.PriceType values
+const (
+	PriceTypeEndOfDay = "end_of_day" // Recorded by a scheduled update after the close
+	PriceTypeIntraday = "intraday"   // Recorded by a manual refresh, create or edit
+)
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// redacted replaces secrets in provider call log entries.
+const redacted = "[REDACTED]"
+
+// maxUsageCaptureBytes bounds how much of an LLM response body is kept to read its token usage.
+const maxUsageCaptureBytes = 4 << 20
+
+// Query parameters and headers that carry credentials.
+var (
+	secretQueryParams = map[string]struct{}{"apikey": {}, "api_key": {}, "access_key": {}, "key": {}, "token": {}}
+	secretHeaders     = map[string]struct{}{"Authorization": {}, "X-Api-Key": {}, "Cookie": {}, "Proxy-Authorization": {}}
+)
+
+// llmProviders report token usage in their JSON responses.
+var llmProviders = map[string]struct{}{"grok": {}, "deepseek": {}, "perplexity": {}, "chatgpt": {}, "claude": {}}
+
+// defaultProviderUseCases labels calls to providers that serve a single purpose.
+var defaultProviderUseCases = map[string]string{"alphavantage": "market_data", "exchangerates": "fx_rates"}
+
+// ProviderCallSink receives one entry per outbound provider request.
+type ProviderCallSink interface {
+	RecordProviderCall(entry models.ProviderCallLog) error
+}
+
+// JSONProviderCallSink writes each entry as one JSON line (e.g. to stdout), separate from app logs.
+type JSONProviderCallSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONProviderCallSink returns a sink writing JSON lines to w.
+func NewJSONProviderCallSink(w io.Writer) *JSONProviderCallSink {
+	return &JSONProviderCallSink{w: w}
+}
+
+// RecordProviderCall implements ProviderCallSink.
+func (s *JSONProviderCallSink) RecordProviderCall(entry models.ProviderCallLog) error {
+	line, err := json.Marshal(struct {
+		Type string `json:"type"`
+		models.ProviderCallLog
+	}{"provider_call", entry})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// DBProviderCallSink stores entries in the provider_call_logs table.
+type DBProviderCallSink struct {
+	db *gorm.DB
+}
+
+// NewDBProviderCallSink returns a sink writing to db.
+func NewDBProviderCallSink(db *gorm.DB) *DBProviderCallSink {
+	return &DBProviderCallSink{db: db}
+}
+
+// RecordProviderCall implements ProviderCallSink.
+func (s *DBProviderCallSink) RecordProviderCall(entry models.ProviderCallLog) error {
+	return s.db.Create(&entry).Error
+}
+
+// ProviderCallLedger records every request the shared provider transport sends. It is off until a
+// sink is configured.
+type ProviderCallLedger struct {
+	mu      sync.RWMutex
+	sink    ProviderCallSink
+	secrets []string
+	onError func(error)
+}
+
+var sharedProviderCallLedger = &ProviderCallLedger{}
+
+// SharedProviderCallLedger returns the process-wide ledger fed by every provider client's transport.
+func SharedProviderCallLedger() *ProviderCallLedger {
+	return sharedProviderCallLedger
+}
+
+// Configure sets the sink (nil turns the ledger off), the secret values redacted wherever they appear
+// in a URL, and the func called when the sink fails (may be nil).
+func (l *ProviderCallLedger) Configure(sink ProviderCallSink, secrets []string, onError func(error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sink = sink
+	l.secrets = nil
+	for _, secret := range secrets {
+		if strings.TrimSpace(secret) != "" {
+			l.secrets = append(l.secrets, secret)
+		}
+	}
+	l.onError = onError
+}
+
+func (l *ProviderCallLedger) enabled() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sink != nil
+}
+
+func (l *ProviderCallLedger) record(entry models.ProviderCallLog) {
+	l.mu.RLock()
+	sink, onError := l.sink, l.onError
+	l.mu.RUnlock()
+	if sink == nil {
+		return
+	}
+	if err := sink.RecordProviderCall(entry); err != nil && onError != nil {
+		onError(err)
+	}
+}
+
+// redactURL drops credentials from u: secret query parameters and any configured secret value
+// (e.g. an API key in the path).
+func (l *ProviderCallLedger) redactURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	query := clean.Query()
+	for name := range query {
+		if _, secret := secretQueryParams[strings.ToLower(name)]; secret {
+			query.Set(name, redacted)
+		}
+	}
+	clean.RawQuery = query.Encode()
+	endpoint := clean.String()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, secret := range l.secrets {
+		endpoint = strings.ReplaceAll(endpoint, secret, redacted)
+		endpoint = strings.ReplaceAll(endpoint, url.QueryEscape(secret), redacted)
+	}
+	return endpoint
+}
+
+// redactHeaders formats headers as sorted "Name: value" pairs with credentials replaced.
+func redactHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(header.Values(name), ", ")
+		if _, secret := secretHeaders[http.CanonicalHeaderKey(name)]; secret {
+			value = redacted
+		}
+		pairs = append(pairs, name+": "+value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+type providerCallInfoKey struct{}
+
+type providerCallInfo struct {
+	ticker  string
+	useCase string
+}
+
+// WithProviderCallInfo labels provider requests made with ctx with a ticker and use-case
+// (config.UseCase*) for the call ledger.
+func WithProviderCallInfo(ctx context.Context, ticker, useCase string) context.Context {
+	return context.WithValue(ctx, providerCallInfoKey{}, providerCallInfo{ticker: ticker, useCase: useCase})
+}
+
+// newProviderCallEntry starts an entry for req. Ticker and use-case come from WithProviderCallInfo,
+// else from the "symbol" query parameter and the provider's single purpose.
+func (l *ProviderCallLedger) newProviderCallEntry(req *http.Request, provider string, start time.Time) models.ProviderCallLog {
+	entry := models.ProviderCallLog{
+		Timestamp: start.UTC(),
+		Provider:  provider,
+		Method:    req.Method,
+		Endpoint:  l.redactURL(req.URL),
+		Headers:   redactHeaders(req.Header),
+		Ticker:    req.URL.Query().Get("symbol"),
+		UseCase:   defaultProviderUseCases[provider],
+	}
+	if info, ok := req.Context().Value(providerCallInfoKey{}).(providerCallInfo); ok {
+		if info.ticker != "" {
+			entry.Ticker = info.ticker
+		}
+		if info.useCase != "" {
+			entry.UseCase = info.useCase
+		}
+	}
+	return entry
+}
+
+// parseTokenUsage reads OpenAI-style (prompt/completion/total_tokens) or Anthropic-style
+// (input/output_tokens) usage from a JSON response body.
+func parseTokenUsage(body []byte, entry *models.ProviderCallLog) {
+	var parsed struct {
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+			InputTokens      int `json:"input_tokens"`
+			OutputTokens     int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(body), &parsed); err != nil {
+		return
+	}
+	usage := parsed.Usage
+	entry.PromptTokens = usage.PromptTokens + usage.InputTokens
+	entry.CompletionTokens = usage.CompletionTokens + usage.OutputTokens
+	entry.TotalTokens = usage.TotalTokens
+	if entry.TotalTokens == 0 {
+		entry.TotalTokens = entry.PromptTokens + entry.CompletionTokens
+	}
+}
+
+// loggingBody records the call when the response body is closed, reading token usage from the
+// captured body of LLM responses first.
+type loggingBody struct {
+	io.ReadCloser
+	ledger  *ProviderCallLedger
+	entry   models.ProviderCallLog
+	capture *bytes.Buffer // nil when usage is not read
+	once    sync.Once
+}
+
+func (b *loggingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.capture != nil && n > 0 && b.capture.Len() < maxUsageCaptureBytes {
+		b.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *loggingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if b.capture != nil {
+			parseTokenUsage(b.capture.Bytes(), &b.entry)
+		}
+		b.ledger.record(b.entry)
+	})
+	return err
+}
+
+// ProviderSecretsFromConfig lists the configured provider API keys, for redaction.
+func ProviderSecretsFromConfig(cfg *config.Config) []string {
+	return []string{
+		cfg.AlphaVantageAPIKey, cfg.XAIAPIKey, cfg.DeepseekAPIKey, cfg.PerplexityAPIKey,
+		cfg.OpenAIAPIKey, cfg.AnthropicAPIKey, cfg.ExchangeRatesAPIKey,
+	}
+}
+
+// NewProviderCallSinkFromConfig returns the sink selected by PROVIDER_CALL_LOG: "stdout" (JSON lines),
+// "db" (provider_call_logs table) or nil when off.
+func NewProviderCallSinkFromConfig(cfg *config.Config, db *gorm.DB, stdout io.Writer) (ProviderCallSink, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.ProviderCallLog)) {
+	case "", "off", "false":
+		return nil, nil
+	case "stdout":
+		return NewJSONProviderCallSink(stdout), nil
+	case "db":
+		return NewDBProviderCallSink(db), nil
+	default:
+		return nil, fmt.Errorf("invalid PROVIDER_CALL_LOG %q: use stdout or db", cfg.ProviderCallLog)
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+)
+
+func TestProviderCallLedgerLogsCallWithoutSecrets(t *testing.T) {
+	t.Parallel()
+	const secret = "sk-super-secret"
+	var out bytes.Buffer
+	ledger := &ProviderCallLedger{}
+	ledger.Configure(NewJSONProviderCallSink(&out), []string{secret}, nil)
+
+	transport := &rateLimitedTransport{
+		base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			reply := `{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":120,"completion_tokens":30,"total_tokens":150}}`
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(reply)), Request: req}, nil
+		}),
+		limiter: NewProviderLimiter(nil),
+		ledger:  ledger,
+	}
+	provider := NewGrokProvider(&config.Config{XAIAPIKey: secret}, config.UseCaseFairValue, &http.Client{Transport: transport})
+	ctx := WithProviderCallInfo(context.Background(), "AAPL", config.UseCaseFairValue)
+	if _, err := provider.Complete(ctx, "system", "user"); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+
+	// Alpha Vantage carries its key in the query string.
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get("https://www.alphavantage.co/query?function=GLOBAL_QUOTE&symbol=MSFT&apikey=" + secret)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	logged := out.String()
+	if strings.Contains(logged, secret) {
+		t.Fatalf("secret leaked into provider call log: %s", logged)
+	}
+	lines := strings.Split(strings.TrimSpace(logged), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d: %s", len(lines), logged)
+	}
+
+	var llm map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &llm); err != nil {
+		t.Fatalf("parse log line: %v", err)
+	}
+	for field, want := range map[string]interface{}{
+		"type":              "provider_call",
+		"provider":          "grok",
+		"endpoint":          "https://api.x.ai/v1/chat/completions",
+		"ticker":            "AAPL",
+		"use_case":          config.UseCaseFairValue,
+		"status":            float64(200),
+		"prompt_tokens":     float64(120),
+		"completion_tokens": float64(30),
+		"total_tokens":      float64(150),
+	} {
+		if llm[field] != want {
+			t.Errorf("%s: got %v, want %v", field, llm[field], want)
+		}
+	}
+	for _, field := range []string{"timestamp", "latency_ms"} {
+		if _, ok := llm[field]; !ok {
+			t.Errorf("missing field %s", field)
+		}
+	}
+	if headers, _ := llm["headers"].(string); !strings.Contains(headers, "Authorization: "+redacted) {
+		t.Errorf("authorization header not redacted: %q", headers)
+	}
+
+	var quote map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &quote); err != nil {
+		t.Fatalf("parse log line: %v", err)
+	}
+	if quote["provider"] != "alphavantage" || quote["ticker"] != "MSFT" || quote["use_case"] != "market_data" {
+		t.Errorf("unexpected quote entry: %v", quote)
+	}
+}
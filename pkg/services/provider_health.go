@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// AlertTypeProviderAuthFailed marks a provider rejecting its API key (revoked, expired or mistyped).
+const AlertTypeProviderAuthFailed = "provider_auth_failed"
+
+// ProviderHealthState is the last known authentication state of one provider's API key.
+type ProviderHealthState struct {
+	Healthy       bool      `json:"healthy"`
+	AuthFailed    bool      `json:"auth_failed"`
+	StatusCode    int       `json:"status_code,omitempty"` // Status of the rejected request
+	FailedAt      time.Time `json:"failed_at,omitempty"`
+	LastSuccessAt time.Time `json:"last_success_at,omitempty"`
+}
+
+// ProviderHealth tracks per-provider auth failures seen on outbound responses. A 401/403 marks the
+// provider unhealthy and calls the auth-failure handler once; a later validated response (see
+// ReportSuccess) clears it.
+type ProviderHealth struct {
+	mu        sync.Mutex
+	states    map[string]ProviderHealthState
+	onFailure func(provider string, statusCode int)
+	now       func() time.Time
+}
+
+// NewProviderHealth creates an empty tracker.
+func NewProviderHealth() *ProviderHealth {
+	return &ProviderHealth{
+		states: make(map[string]ProviderHealthState),
+		now:    time.Now,
+	}
+}
+
+var sharedProviderHealth = NewProviderHealth()
+
+// SharedProviderHealth returns the process-wide tracker fed by every provider client's transport.
+func SharedProviderHealth() *ProviderHealth {
+	return sharedProviderHealth
+}
+
+// SetAuthFailureHandler sets the func called when a provider starts rejecting its key (nil disables).
+func (p *ProviderHealth) SetAuthFailureHandler(handler func(provider string, statusCode int)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onFailure = handler
+}
+
+// RecordResponse records an auth failure from a response status code. A 2xx is not a success yet:
+// some providers report a rejected key in a 200 body, so provider code calls ReportSuccess once the
+// body has been validated.
+func (p *ProviderHealth) RecordResponse(provider string, statusCode int) {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		p.ReportAuthFailure(provider, statusCode)
+	}
+}
+
+// ReportSuccess marks the provider healthy after a response whose body was validated, clearing an
+// earlier auth failure.
+func (p *ProviderHealth) ReportSuccess(provider string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.states[provider] = ProviderHealthState{Healthy: true, LastSuccessAt: p.now()}
+}
+
+// RecordProviderSuccess reports a validated response to the shared ProviderHealth for the provider
+// serving resp's host (see ProviderForHost). Other hosts are ignored.
+func RecordProviderSuccess(resp *http.Response) {
+	if resp == nil || resp.Request == nil || resp.Request.URL == nil {
+		return
+	}
+	if provider := ProviderForHost(resp.Request.URL.Hostname()); provider != "" {
+		sharedProviderHealth.ReportSuccess(provider)
+	}
+}
+
+// ReportAuthFailure marks the provider's key as rejected, for providers that signal it in the body of a
+// 200 response. The handler runs only on the transition from healthy, so repeated failures alert once.
+func (p *ProviderHealth) ReportAuthFailure(provider string, statusCode int) {
+	p.mu.Lock()
+	state := p.states[provider]
+	alreadyFailed := state.AuthFailed
+	state.Healthy = false
+	state.AuthFailed = true
+	state.StatusCode = statusCode
+	if !alreadyFailed {
+		state.FailedAt = p.now()
+	}
+	p.states[provider] = state
+	handler := p.onFailure
+	p.mu.Unlock()
+
+	if !alreadyFailed && handler != nil {
+		handler(provider, statusCode)
+	}
+}
+
+// State returns the provider's last known state and whether any response has been seen.
+func (p *ProviderHealth) State(provider string) (ProviderHealthState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state, ok := p.states[provider]
+	return state, ok
+}
+
+// Snapshot returns the state of every provider that has responded since startup.
+func (p *ProviderHealth) Snapshot() map[string]ProviderHealthState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snapshot := make(map[string]ProviderHealthState, len(p.states))
+	for provider, state := range p.states {
+		snapshot[provider] = state
+	}
+	return snapshot
+}
+
+// RaiseProviderAuthAlert stores a provider_auth_failed alert for the provider on portfolioID unless
+// one was raised within dedupWindow. It reports whether an alert was created.
+func RaiseProviderAuthAlert(db *gorm.DB, portfolioID uint, provider string, statusCode int, now time.Time, dedupWindow time.Duration) (bool, error) {
+	var existing int64
+	if err := db.Model(&models.Alert{}).
+		Where("alert_type = ? AND ticker = ? AND created_at >= ?", AlertTypeProviderAuthFailed, provider, now.Add(-dedupWindow)).
+		Count(&existing).Error; err != nil {
+		return false, fmt.Errorf("failed to check existing auth alerts: %w", err)
+	}
+	if existing > 0 {
+		return false, nil
+	}
+
+	alert := models.Alert{
+		PortfolioID: portfolioID,
+		Ticker:      provider,
+		AlertType:   AlertTypeProviderAuthFailed,
+		Message:     fmt.Sprintf("The %s API rejected its key (HTTP %d). The key may be revoked, expired or mistyped; updates using %s will fail until it is replaced.", provider, statusCode, provider),
+		CreatedAt:   now,
+	}
+	if err := db.Create(&alert).Error; err != nil {
+		return false, fmt.Errorf("failed to create auth alert: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// providerHosts maps outbound API hosts to the provider keys used in config.ProviderRateLimits.
+var providerHosts = map[string]string{
+	"api.x.ai":                "grok",
+	"api.deepseek.com":        "deepseek",
+	"api.perplexity.ai":       "perplexity",
+	"api.openai.com":          "chatgpt",
+	"api.anthropic.com":       "claude",
+	"www.alphavantage.co":     "alphavantage",
+	"api.exchangeratesapi.io": "exchangerates",
+	"v6.exchangerate-api.com": "exchangerates",
+	"api.frankfurter.app":     "frankfurter",
+}
+
+// ProviderForHost returns the provider key for an API host, or "" when the host is not a known provider.
+func ProviderForHost(host string) string {
+	return providerHosts[strings.ToLower(host)]
+}
+
+// ProviderLimiter enforces per-provider requests-per-minute (rolling window) and max-concurrency limits.
+// Providers without a configured limit are not throttled.
+type ProviderLimiter struct {
+	mu       sync.Mutex
+	limits   map[string]config.ProviderRateLimit
+	started  map[string][]time.Time   // Start times within the last minute, oldest first
+	inFlight map[string]chan struct{} // Concurrency semaphore per provider
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// NewProviderLimiter creates a limiter for the given provider limits.
+func NewProviderLimiter(limits map[string]config.ProviderRateLimit) *ProviderLimiter {
+	l := &ProviderLimiter{
+		started:  make(map[string][]time.Time),
+		inFlight: make(map[string]chan struct{}),
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits replaces the configured limits. Requests already in flight keep their slots.
+func (l *ProviderLimiter) SetLimits(limits map[string]config.ProviderRateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = make(map[string]config.ProviderRateLimit, len(limits))
+	for provider, limit := range limits {
+		l.limits[provider] = limit
+		if limit.MaxConcurrent > 0 {
+			l.inFlight[provider] = make(chan struct{}, limit.MaxConcurrent)
+		} else {
+			delete(l.inFlight, provider)
+		}
+	}
+}
+
+// Acquire blocks until a request to provider may start under its rate and concurrency limits.
+// The returned release func must be called when the request finishes.
+func (l *ProviderLimiter) Acquire(ctx context.Context, provider string) (func(), error) {
+	l.mu.Lock()
+	semaphore := l.inFlight[provider]
+	l.mu.Unlock()
+
+	release := func() {}
+	if semaphore != nil {
+		select {
+		case semaphore <- struct{}{}:
+			var once sync.Once
+			release = func() { once.Do(func() { <-semaphore }) }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		wait := l.reserve(provider)
+		if wait <= 0 {
+			return release, nil
+		}
+		if err := l.sleep(ctx, wait); err != nil {
+			release()
+			return nil, err
+		}
+	}
+}
+
+// reserve records a request start and returns 0, or returns how long to wait for a free slot
+// in the rolling one-minute window.
+func (l *ProviderLimiter) reserve(provider string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limits[provider].RequestsPerMinute
+	if limit <= 0 {
+		return 0
+	}
+	now := l.now()
+	windowStart := now.Add(-time.Minute)
+	started := l.started[provider]
+	for len(started) > 0 && !started[0].After(windowStart) {
+		started = started[1:]
+	}
+	if len(started) >= limit {
+		l.started[provider] = started
+		return started[0].Sub(windowStart)
+	}
+	l.started[provider] = append(started, now)
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var sharedProviderLimiter = NewProviderLimiter(config.DefaultProviderRateLimits())
+
+// SharedProviderLimiter returns the process-wide limiter used by every provider client.
+func SharedProviderLimiter() *ProviderLimiter {
+	return sharedProviderLimiter
+}
+
+// ConfigureProviderRateLimits applies configured limits to the shared limiter.
+func ConfigureProviderRateLimits(limits map[string]config.ProviderRateLimit) {
+	if len(limits) == 0 {
+		return
+	}
+	sharedProviderLimiter.SetLimits(limits)
+}
+
+// rateLimitedTransport throttles requests to known provider hosts through a ProviderLimiter,
+// records auth failures (401/403) in ProviderHealth and logs them to the ProviderCallLedger.
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *ProviderLimiter
+	health  *ProviderHealth
+	ledger  *ProviderCallLedger
+}
+
+// NewRateLimitedTransport wraps base (http.DefaultTransport when nil) so requests to known
+// provider hosts go through the shared limiter and report auth failures to the shared
+// ProviderHealth. A concurrency slot is held until the response body is closed, which is also
+// when the call is written to the shared ProviderCallLedger.
+func NewRateLimitedTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitedTransport{base: base, limiter: sharedProviderLimiter, health: sharedProviderHealth, ledger: sharedProviderCallLedger}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := ProviderForHost(req.URL.Hostname())
+	if provider == "" {
+		return t.base.RoundTrip(req)
+	}
+	release, err := t.limiter.Acquire(req.Context(), provider)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && t.health != nil {
+		t.health.RecordResponse(provider, resp.StatusCode)
+	}
+	logging := t.ledger != nil && t.ledger.enabled()
+	var entry models.ProviderCallLog
+	if logging {
+		entry = t.ledger.newProviderCallEntry(req, provider, start)
+		entry.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Status = resp.StatusCode
+		}
+	}
+	if err != nil || resp.Body == nil {
+		release()
+		if logging {
+			t.ledger.record(entry)
+		}
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	if logging {
+		body := &loggingBody{ReadCloser: resp.Body, ledger: t.ledger, entry: entry}
+		if _, llm := llmProviders[provider]; llm {
+			body.capture = &bytes.Buffer{}
+		}
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+// releasingBody frees the provider concurrency slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
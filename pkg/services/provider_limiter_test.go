@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+)
+
+func TestProviderLimiterEnforcesRequestsPerMinute(t *testing.T) {
+	t.Parallel()
+	limiter := NewProviderLimiter(map[string]config.ProviderRateLimit{
+		"alphavantage": {RequestsPerMinute: 2},
+	})
+	clock := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	limiter.now = func() time.Time { return clock }
+	limiter.sleep = func(_ context.Context, d time.Duration) error {
+		slept += d
+		clock = clock.Add(d)
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		release, err := limiter.Acquire(context.Background(), "alphavantage")
+		if err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+		release()
+		clock = clock.Add(10 * time.Second)
+	}
+	if slept != 0 {
+		t.Fatalf("expected the first 2 requests to start immediately, slept %s", slept)
+	}
+
+	// Third request in the same minute waits until the first falls out of the window.
+	if _, err := limiter.Acquire(context.Background(), "alphavantage"); err != nil {
+		t.Fatalf("acquire 3: %v", err)
+	}
+	if slept != 40*time.Second {
+		t.Fatalf("slept: got %s want 40s", slept)
+	}
+
+	// Providers without a limit are never throttled.
+	for i := 0; i < 5; i++ {
+		if _, err := limiter.Acquire(context.Background(), "grok"); err != nil {
+			t.Fatalf("acquire grok: %v", err)
+		}
+	}
+	if slept != 40*time.Second {
+		t.Fatalf("unlimited provider slept: got %s", slept)
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+)
+
+// RetryPolicy configures DoWithRetry.
+type RetryPolicy struct {
+	MaxRetries int           // Retries after the first attempt (0 = no retries)
+	BaseDelay  time.Duration // Delay before the first retry; doubles for each further retry
+}
+
+// RetryPolicyFromConfig reads PROVIDER_MAX_RETRIES and PROVIDER_RETRY_BASE_DELAY_MS.
+func RetryPolicyFromConfig(cfg *config.Config) RetryPolicy {
+	if cfg == nil {
+		return RetryPolicy{MaxRetries: 2, BaseDelay: time.Second}
+	}
+	return RetryPolicy{
+		MaxRetries: cfg.ProviderMaxRetries,
+		BaseDelay:  time.Duration(cfg.ProviderRetryBaseDelayMs) * time.Millisecond,
+	}
+}
+
+// ErrEmptyContent is returned when a provider replies with empty or whitespace-only content. DoWithRetry
+// only sees HTTP status and transport errors, so it is not retried.
+var ErrEmptyContent = errors.New("provider returned empty content")
+
+// RequireContent returns content, or ErrEmptyContent when it is empty or whitespace only.
+func RequireContent(content string) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		return "", ErrEmptyContent
+	}
+	return content, nil
+}
+
+// retryableStatus reports whether a provider status is worth retrying: rate limiting and server-side
+// failures. Client errors such as 400/401 fail the same way again.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableError reports whether a transport error is a network timeout.
+func retryableError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// DoWithRetry sends req with client, retrying 429/500/502/503/504 responses and network timeouts with
+// exponential backoff plus up to 50% jitter. The body is replayed through req.GetBody, so build req with
+// http.NewRequest(WithContext) from a bytes buffer. Returns the last response (caller closes it) or error.
+// Waiting stops early when the request's context is done.
+func DoWithRetry(client *http.Client, req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	ctx := req.Context()
+	maxRetries := policy.MaxRetries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0 // The body cannot be sent twice
+	}
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("replay request body: %w", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := client.Do(attemptReq)
+		var retry bool
+		if err != nil {
+			retry = retryableError(err) && ctx.Err() == nil
+		} else {
+			retry = retryableStatus(resp.StatusCode)
+		}
+		if !retry || attempt >= maxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain so the connection can be reused for the next attempt.
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		if err := sleepContext(ctx, retryDelay(policy.BaseDelay, attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay is BaseDelay * 2^attempt plus a random jitter of up to half that.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << uint(attempt)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoWithRetryRetriesTransientStatusesOnly(t *testing.T) {
+	t.Parallel()
+	policy := RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}
+	run := func(statuses ...int) (int, []string, *http.Response) {
+		var calls int
+		var bodies []string
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(req.Body)
+			bodies = append(bodies, string(body))
+			status := statuses[len(statuses)-1]
+			if calls < len(statuses) {
+				status = statuses[calls]
+			}
+			calls++
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+		})}
+		req, err := http.NewRequest(http.MethodPost, "https://api.x.ai/v1/chat/completions", bytes.NewBufferString(`{"model":"m"}`))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		resp, err := DoWithRetry(client, req, policy)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		_ = resp.Body.Close()
+		return calls, bodies, resp
+	}
+
+	// A 429 then a 503 are retried and the body is replayed on each attempt.
+	calls, bodies, resp := run(http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK)
+	if calls != 3 || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected success on the third attempt, got %d calls status %d", calls, resp.StatusCode)
+	}
+	for i, body := range bodies {
+		if body != `{"model":"m"}` {
+			t.Errorf("attempt %d sent body %q", i+1, body)
+		}
+	}
+
+	// Retries stop after MaxRetries and the last response is returned.
+	if calls, _, resp := run(http.StatusBadGateway); calls != 3 || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected 3 attempts ending in 502, got %d calls status %d", calls, resp.StatusCode)
+	}
+
+	// Client errors are not retried.
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized} {
+		if calls, _, resp := run(status); calls != 1 || resp.StatusCode != status {
+			t.Fatalf("status %d: expected a single attempt, got %d calls status %d", status, calls, resp.StatusCode)
+		}
+	}
+}
@@ -37,10 +37,28 @@ func parseTradeDate(s string) (time.Time, error) {
 	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
 }
 
-// ComputeRealizedPnL computes lifetime realized PnL from Buy/Sell operations using FIFO.
-// All amounts are converted to base currency (EUR) using fxRates (currency units per 1 EUR).
-// Fees are not stored on Operation; fee is treated as 0.
-func ComputeRealizedPnL(operations []models.Operation, fxRates map[string]float64) (float64, error) {
+// ParseTradeDate parses an Operation.TradeDate (DD.MM.YYYY).
+func ParseTradeDate(s string) (time.Time, error) {
+	return parseTradeDate(s)
+}
+
+// lotRate returns the operation's FX-at-purchase (currency units per 1 EUR) when recorded,
+// else the current rate, else 1 (treated as EUR).
+func lotRate(op models.Operation, fxRates map[string]float64) float64 {
+	if op.FXRate > 0 {
+		return op.FXRate
+	}
+	if rate := fxRates[op.Currency]; rate > 0 {
+		return rate
+	}
+	return 1
+}
+
+// replayFIFO matches Buy/Sell operations FIFO per ticker, oldest trade first. It returns the open
+// lots per ticker and the realized PnL, both in base currency (EUR). Each operation is converted at
+// its own FX-at-purchase (Operation.FXRate) when recorded, else at the current fxRates, so lots of
+// one ticker may be in different currencies.
+func replayFIFO(operations []models.Operation, fxRates map[string]float64) (map[string][]*lot, float64) {
 	// Filter Buy/Sell and sort by trade date ascending (oldest first) for FIFO.
 	var trades []models.Operation
 	for _, op := range operations {
@@ -70,12 +88,8 @@ func ComputeRealizedPnL(operations []models.Operation, fxRates map[string]float6
 	lotsByTicker := make(map[string][]*lot)
 
 	for _, op := range trades {
-		rate := fxRates[op.Currency]
-		if rate <= 0 {
-			rate = 1 // treat as EUR if missing
-		}
 		// Convert to EUR: amount_eur = amount_local / rate (rate = local per 1 EUR)
-		amountEUR := (op.Quantity * op.Price) / rate
+		amountEUR := (op.Quantity * op.Price) / lotRate(op, fxRates)
 		ticker := strings.TrimSpace(op.Ticker)
 		if ticker == "" {
 			continue
@@ -114,5 +128,41 @@ func ComputeRealizedPnL(operations []models.Operation, fxRates map[string]float6
 		}
 	}
 
-	return totalRealizedPnL, nil
+	return lotsByTicker, totalRealizedPnL
+}
+
+// ComputeRealizedPnL computes lifetime realized PnL from Buy/Sell operations using FIFO.
+// All amounts are converted to base currency (EUR) at each operation's FX-at-purchase when recorded,
+// else using fxRates (currency units per 1 EUR).
+// Fees are not stored on Operation; fee is treated as 0.
+func ComputeRealizedPnL(operations []models.Operation, fxRates map[string]float64) (float64, error) {
+	_, realized := replayFIFO(operations, fxRates)
+	return realized, nil
+}
+
+// CostBasis is the open (unsold) FIFO position of one ticker in base currency (EUR).
+type CostBasis struct {
+	Shares     float64 `json:"shares"`
+	CostEUR    float64 `json:"cost_eur"`
+	AvgCostEUR float64 `json:"avg_cost_eur"`
+}
+
+// ComputeCostBasis returns the blended cost basis of the open lots per ticker after FIFO matching.
+// Lots bought in different currencies are each converted at their own FX-at-purchase (see ComputeRealizedPnL).
+func ComputeCostBasis(operations []models.Operation, fxRates map[string]float64) map[string]CostBasis {
+	lotsByTicker, _ := replayFIFO(operations, fxRates)
+	result := make(map[string]CostBasis, len(lotsByTicker))
+	for ticker, lots := range lotsByTicker {
+		var basis CostBasis
+		for _, l := range lots {
+			basis.Shares += l.qtyRemaining
+			basis.CostEUR += l.qtyRemaining * l.unitCost
+		}
+		if basis.Shares <= 0 {
+			continue
+		}
+		basis.AvgCostEUR = basis.CostEUR / basis.Shares
+		result[ticker] = basis
+	}
+	return result
 }
@@ -26,6 +26,40 @@ func TestComputeRealizedPnL_FIFO(t *testing.T) {
 	}
 }
 
+func TestComputeCostBasis_LotsInDifferentCurrencies(t *testing.T) {
+	t.Parallel()
+	// Current rates differ from the rates at purchase; each lot must keep its own FX-at-purchase.
+	fxRates := map[string]float64{"USD": 1.5, "EUR": 1.0}
+	ops := []models.Operation{
+		// 10 @ 110 USD when 1 EUR = 1.10 USD => 1000 EUR
+		{OperationType: "Buy", Ticker: "NVO", Currency: "USD", FXRate: 1.10, Quantity: 10, Price: 110, TradeDate: "01.01.2024", CreatedAt: time.Now()},
+		// 10 @ 90 EUR => 900 EUR
+		{OperationType: "Buy", Ticker: "NVO", Currency: "EUR", FXRate: 1.0, Quantity: 10, Price: 90, TradeDate: "01.02.2024", CreatedAt: time.Now()},
+		// Sell 5 @ 120 USD when 1 EUR = 1.20 USD => 500 EUR proceeds; FIFO cost 5 × 100 = 500 EUR
+		{OperationType: "Sell", Ticker: "NVO", Currency: "USD", FXRate: 1.20, Quantity: 5, Price: 120, TradeDate: "01.03.2024", CreatedAt: time.Now()},
+	}
+
+	basis := ComputeCostBasis(ops, fxRates)["NVO"]
+	// Open: 5 USD-lot shares at 100 EUR + 10 EUR-lot shares at 90 EUR = 1400 EUR over 15 shares.
+	if basis.Shares != 15 {
+		t.Fatalf("shares: got %.2f want 15", basis.Shares)
+	}
+	if diff := basis.CostEUR - 1400; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("cost basis: got %.4f EUR want 1400", basis.CostEUR)
+	}
+	if diff := basis.AvgCostEUR - 1400.0/15; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("avg cost: got %.4f EUR want %.4f", basis.AvgCostEUR, 1400.0/15)
+	}
+
+	realized, err := ComputeRealizedPnL(ops, fxRates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if realized > 1e-9 || realized < -1e-9 {
+		t.Errorf("realized PnL: got %.4f want 0 at purchase/sale FX", realized)
+	}
+}
+
 func TestComputeRealizedPnL_NoTrades(t *testing.T) {
 	t.Parallel()
 	fxRates := map[string]float64{"USD": 1.2}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// RebalanceOptions controls which suggested trades are executable.
+type RebalanceOptions struct {
+	MinTradeValueEUR  float64 // Trades smaller than this (absolute EUR) are dropped
+	WholeShares       bool    // Round share quantities toward zero to whole shares
+	MaxPositionWeight float64 // Cap (%) on ½-Kelly target weights; 0 = no cap
+	MinCashBufferPct  float64 // Lower bound (%) of the cash buffer band checked against projected cash
+	MaxCashBufferPct  float64 // Upper bound (%) of that band
+}
+
+// RebalanceTrade is a single suggested order in a rebalance plan.
+// Weights are percentages (0–100) of total investable value (positions + cash).
+type RebalanceTrade struct {
+	StockID            uint    `json:"stock_id"`
+	Ticker             string  `json:"ticker"`
+	Currency           string  `json:"currency"`
+	Action             string  `json:"action"` // Buy or Sell
+	Shares             float64 `json:"shares"`
+	Price              float64 `json:"price"`
+	ValueEUR           float64 `json:"value_eur"`
+	CurrentWeightPct   float64 `json:"current_weight_pct"`
+	TargetWeightPct    float64 `json:"target_weight_pct"`
+	ProjectedWeightPct float64 `json:"projected_weight_pct"`
+	OverMaxWeight      bool    `json:"over_max_weight"`      // Current weight already above MaxPositionWeight
+	LimitedBy          string  `json:"limited_by,omitempty"` // cash_buffer when the buy was scaled down to the cash above the buffer
+	SkipReason         string  `json:"skip_reason,omitempty"`
+}
+
+// RebalancePlan holds executable trades, dropped trades and the projected cash position, checked
+// against the cash buffer band.
+type RebalancePlan struct {
+	TotalValueEUR    float64          `json:"total_value_eur"`
+	CashEUR          float64          `json:"cash_eur"`
+	ProjectedCashEUR float64          `json:"projected_cash_eur"`
+	CashBuffer       CashBuffer       `json:"cash_buffer"` // Projected cash against the band
+	Trades           []RebalanceTrade `json:"trades"`
+	Skipped          []RebalanceTrade `json:"skipped"`
+}
+
+// BuildRebalancePlan sizes trades that move each stock from its current weight to its
+// ½-Kelly suggested weight, capped at MaxPositionWeight. Trades are rounded to whole shares when required and dropped
+// when below the minimum trade value; projected weights reflect only the kept trades. With a zero
+// minimum and fractional shares the plan is the full, unrounded move to target.
+func BuildRebalancePlan(stocks []models.Stock, fxRates map[string]float64, cashEUR float64, opts RebalanceOptions) RebalancePlan {
+	return buildRebalancePlan(stocks, fxRates, cashEUR, opts, func(stock models.Stock, _ float64) float64 {
+		if opts.MaxPositionWeight > 0 && stock.HalfKellySuggested > opts.MaxPositionWeight {
+			return opts.MaxPositionWeight
+		}
+		return stock.HalfKellySuggested
+	})
+}
+
+// positionValuesEUR returns each stock's position value in EUR and their sum.
+func positionValuesEUR(stocks []models.Stock, fxRates map[string]float64) ([]float64, float64) {
+	positionsEUR := make([]float64, len(stocks))
+	var invested float64
+	for i, stock := range stocks {
+		fxRate := fxRates[stock.Currency]
+		if stock.SharesOwned <= 0 || stock.CurrentPrice <= 0 || fxRate <= 0 {
+			continue
+		}
+		positionsEUR[i] = float64(stock.SharesOwned) * stock.CurrentPrice / fxRate
+		invested += positionsEUR[i]
+	}
+	return positionsEUR, invested
+}
+
+// rebalanceGap is one stock's move from its current to its target weight before sizing.
+type rebalanceGap struct {
+	index         int
+	currentWeight float64
+	target        float64
+	deltaEUR      float64 // Positive to buy, negative to sell
+}
+
+// buildRebalancePlan sizes trades from each stock's current weight to targetWeight (percent of
+// total investable value), applying the whole-share and minimum trade value rules. Sells are sized
+// first; buys are then scaled down together so they never spend more than the cash left after
+// MinCashBufferPct of total value, and the scaled trades are marked limited_by cash_buffer.
+func buildRebalancePlan(stocks []models.Stock, fxRates map[string]float64, cashEUR float64, opts RebalanceOptions, targetWeight func(stock models.Stock, currentWeight float64) float64) RebalancePlan {
+	positionsEUR, invested := positionValuesEUR(stocks, fxRates)
+	totalValue := invested + cashEUR
+
+	plan := newRebalancePlan(totalValue, cashEUR, opts)
+	if totalValue <= 0 {
+		return plan
+	}
+
+	var sells, buys []rebalanceGap
+	var buyEUR float64
+	for i, stock := range stocks {
+		if stock.CurrentPrice <= 0 || fxRates[stock.Currency] <= 0 {
+			continue
+		}
+		currentWeight := positionsEUR[i] / totalValue * 100
+		target := targetWeight(stock, currentWeight)
+		gap := rebalanceGap{index: i, currentWeight: currentWeight, target: target, deltaEUR: target/100*totalValue - positionsEUR[i]}
+		switch {
+		case gap.deltaEUR <= -1e-6:
+			sells = append(sells, gap)
+		case gap.deltaEUR >= 1e-6:
+			buys = append(buys, gap)
+			buyEUR += gap.deltaEUR
+		}
+	}
+
+	addTrade := func(gap rebalanceGap, deltaEUR float64, limitedBy string) {
+		stock := stocks[gap.index]
+		fxRate := fxRates[stock.Currency]
+		shares := deltaEUR * fxRate / stock.CurrentPrice
+		if opts.WholeShares {
+			shares = math.Trunc(shares)
+		}
+		// Never sell more than is held.
+		if shares < 0 && -shares > float64(stock.SharesOwned) {
+			shares = -float64(stock.SharesOwned)
+		}
+		valueEUR := shares * stock.CurrentPrice / fxRate
+
+		trade := RebalanceTrade{
+			StockID:            stock.ID,
+			Ticker:             stock.Ticker,
+			Currency:           stock.Currency,
+			Action:             "Buy",
+			Shares:             math.Abs(shares),
+			Price:              stock.CurrentPrice,
+			ValueEUR:           math.Abs(valueEUR),
+			CurrentWeightPct:   gap.currentWeight,
+			TargetWeightPct:    gap.target,
+			ProjectedWeightPct: gap.currentWeight,
+			OverMaxWeight:      opts.MaxPositionWeight > 0 && gap.currentWeight > opts.MaxPositionWeight,
+			LimitedBy:          limitedBy,
+		}
+		if shares < 0 {
+			trade.Action = "Sell"
+		}
+
+		switch {
+		case shares == 0 && deltaEUR < 1e-6:
+			trade.SkipReason = "no cash above the minimum buffer"
+		case shares == 0:
+			trade.SkipReason = "less than one whole share"
+		case trade.ValueEUR < opts.MinTradeValueEUR:
+			trade.SkipReason = "below minimum trade value"
+		}
+		if trade.SkipReason != "" {
+			plan.Skipped = append(plan.Skipped, trade)
+			return
+		}
+
+		trade.ProjectedWeightPct = (positionsEUR[gap.index] + valueEUR) / totalValue * 100
+		plan.ProjectedCashEUR -= valueEUR
+		plan.Trades = append(plan.Trades, trade)
+	}
+
+	for _, gap := range sells {
+		addTrade(gap, gap.deltaEUR, "")
+	}
+	scale, limitedBy := 1.0, ""
+	if budget := plan.ProjectedCashEUR - opts.MinCashBufferPct/100*totalValue; buyEUR > budget {
+		scale, limitedBy = math.Max(budget, 0)/buyEUR, "cash_buffer"
+	}
+	for _, gap := range buys {
+		addTrade(gap, gap.deltaEUR*scale, limitedBy)
+	}
+
+	sort.SliceStable(plan.Trades, func(i, j int) bool {
+		return plan.Trades[i].ValueEUR > plan.Trades[j].ValueEUR
+	})
+
+	plan.CashBuffer = CalculateCashBuffer(totalValue-plan.ProjectedCashEUR, plan.ProjectedCashEUR, opts.MinCashBufferPct, opts.MaxCashBufferPct)
+	return plan
+}
+
+// newRebalancePlan returns a plan without trades, its cash checked against the band in opts.
+func newRebalancePlan(totalValue, cashEUR float64, opts RebalanceOptions) RebalancePlan {
+	return RebalancePlan{
+		TotalValueEUR:    totalValue,
+		CashEUR:          cashEUR,
+		ProjectedCashEUR: cashEUR,
+		CashBuffer:       CalculateCashBuffer(totalValue-cashEUR, cashEUR, opts.MinCashBufferPct, opts.MaxCashBufferPct),
+		Trades:           []RebalanceTrade{},
+		Skipped:          []RebalanceTrade{},
+	}
+}
+
+// Default Kelly utilization band and cash buffer from the portfolio strategy.
+const (
+	DefaultKellyUtilizationMin = 0.75
+	DefaultKellyUtilizationMax = 0.85
+	DefaultMinCashBufferPct    = 8.0
+	DefaultMaxCashBufferPct    = 12.0
+)
+
+// KellyUtilizationOptions controls the Kelly utilization recommendation.
+type KellyUtilizationOptions struct {
+	Min               float64          // Lower bound of the target band (fraction 0–1)
+	Max               float64          // Upper bound of the target band (fraction 0–1)
+	MaxPositionWeight float64          // Per-position cap (%) when scaling up; 0 = no cap
+	Rebalance         RebalanceOptions // Sizing rules; its MinCashBufferPct of cash must remain after scaling up
+}
+
+// KellyUtilizationRecommendation is the suggested portfolio-wide scaling when Kelly utilization
+// (invested value / positions + cash) is outside the target band.
+type KellyUtilizationRecommendation struct {
+	Utilization          float64       `json:"utilization"` // Fraction 0–1
+	BandMin              float64       `json:"band_min"`
+	BandMax              float64       `json:"band_max"`
+	Status               string        `json:"status"` // within, over, under
+	ScaleFactor          float64       `json:"scale_factor"`
+	ProjectedUtilization float64       `json:"projected_utilization"`
+	Action               string        `json:"action"`
+	LimitedBy            string        `json:"limited_by,omitempty"` // cash_buffer when the buffer caps scaling up
+	Plan                 RebalancePlan `json:"plan"`
+}
+
+// RecommendKellyUtilization computes a scaling factor that moves Kelly utilization to the middle
+// of the band by trimming or adding to every held position proportionally. Scaling up keeps at
+// least Rebalance.MinCashBufferPct in cash and never lifts a position above MaxPositionWeight.
+// Trades are sized with the rebalance plan rules.
+func RecommendKellyUtilization(stocks []models.Stock, fxRates map[string]float64, cashEUR float64, opts KellyUtilizationOptions) KellyUtilizationRecommendation {
+	_, invested := positionValuesEUR(stocks, fxRates)
+	totalValue := invested + cashEUR
+
+	rec := KellyUtilizationRecommendation{
+		BandMin:     opts.Min,
+		BandMax:     opts.Max,
+		Status:      "within",
+		ScaleFactor: 1,
+		Action:      "None",
+		Plan:        newRebalancePlan(totalValue, cashEUR, opts.Rebalance),
+	}
+	if totalValue > 0 {
+		rec.Utilization = invested / totalValue
+	}
+	rec.ProjectedUtilization = rec.Utilization
+
+	switch {
+	case invested <= 0 || totalValue <= 0:
+		return rec
+	case rec.Utilization > opts.Max:
+		rec.Status = "over"
+	case rec.Utilization < opts.Min:
+		rec.Status = "under"
+	default:
+		return rec
+	}
+
+	factor := (opts.Min + opts.Max) / 2 / rec.Utilization
+	if factor > 1 {
+		maxInvested := 1 - opts.Rebalance.MinCashBufferPct/100
+		if limit := maxInvested / rec.Utilization; factor > limit {
+			factor = math.Max(limit, 1)
+			rec.LimitedBy = "cash_buffer"
+		}
+	}
+	rec.ScaleFactor = factor
+
+	rec.Plan = buildRebalancePlan(stocks, fxRates, cashEUR, opts.Rebalance, func(_ models.Stock, currentWeight float64) float64 {
+		target := currentWeight * factor
+		if factor > 1 && opts.MaxPositionWeight > 0 && target > opts.MaxPositionWeight {
+			target = math.Max(opts.MaxPositionWeight, currentWeight)
+		}
+		return target
+	})
+	rec.ProjectedUtilization = 1 - rec.Plan.ProjectedCashEUR/totalValue
+
+	switch {
+	case factor < 1:
+		rec.Action = fmt.Sprintf("Trim all positions proportionally by %.1f%%", (1-factor)*100)
+	case factor > 1:
+		rec.Action = fmt.Sprintf("Add to all positions proportionally by %.1f%%", (factor-1)*100)
+	}
+	return rec
+}
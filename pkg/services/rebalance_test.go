@@ -0,0 +1,200 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestBuildRebalancePlanDropsTradesBelowMinimum(t *testing.T) {
+	t.Parallel()
+	fxRates := map[string]float64{"EUR": 1}
+	stocks := []models.Stock{
+		// 10% of 10,000 = 1,000 target vs 950 held: 50 EUR buy, below minimum.
+		{ID: 1, Ticker: "SMALL", Currency: "EUR", CurrentPrice: 10, SharesOwned: 95, HalfKellySuggested: 10},
+		// 12% of 10,000 = 1,200 target vs 0 held: 1,200 EUR buy.
+		{ID: 2, Ticker: "BIG", Currency: "EUR", CurrentPrice: 100, SharesOwned: 0, HalfKellySuggested: 12},
+	}
+
+	plan := BuildRebalancePlan(stocks, fxRates, 9050, RebalanceOptions{MinTradeValueEUR: 100})
+
+	assertClose(t, plan.TotalValueEUR, 10000, 0.0001, "TotalValueEUR")
+	if len(plan.Trades) != 1 || plan.Trades[0].Ticker != "BIG" {
+		t.Fatalf("expected only BIG trade, got %+v", plan.Trades)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Ticker != "SMALL" {
+		t.Fatalf("expected SMALL to be skipped, got %+v", plan.Skipped)
+	}
+	if plan.Skipped[0].SkipReason != "below minimum trade value" {
+		t.Errorf("SkipReason: got %q", plan.Skipped[0].SkipReason)
+	}
+	assertClose(t, plan.Skipped[0].ProjectedWeightPct, 9.5, 0.0001, "SMALL ProjectedWeight")
+	assertClose(t, plan.Trades[0].ProjectedWeightPct, 12, 0.0001, "BIG ProjectedWeight")
+	assertClose(t, plan.ProjectedCashEUR, 9050-1200, 0.0001, "ProjectedCashEUR")
+}
+
+func TestBuildRebalancePlanCapsTargetWeight(t *testing.T) {
+	t.Parallel()
+	// A 14% ½-Kelly target under a 10% cap buys 1,000 EUR of 10,000 instead of 1,400.
+	fxRates := map[string]float64{"EUR": 1}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "ACME", Currency: "EUR", CurrentPrice: 100, SharesOwned: 0, HalfKellySuggested: 14},
+	}
+
+	plan := BuildRebalancePlan(stocks, fxRates, 10000, RebalanceOptions{MaxPositionWeight: 10})
+	if len(plan.Trades) != 1 {
+		t.Fatalf("expected 1 trade, got %+v", plan.Trades)
+	}
+	assertClose(t, plan.Trades[0].TargetWeightPct, 10, 0.0001, "TargetWeight")
+	assertClose(t, plan.Trades[0].Shares, 10, 0.0001, "Shares")
+
+	uncapped := BuildRebalancePlan(stocks, fxRates, 10000, RebalanceOptions{})
+	assertClose(t, uncapped.Trades[0].TargetWeightPct, 14, 0.0001, "uncapped TargetWeight")
+}
+
+func TestBuildRebalancePlanReportsFullMoveAndCashBuffer(t *testing.T) {
+	t.Parallel()
+	// 10,000 EUR total: BIG is 60% against a 40% target, ACME 25% against 70% capped at 50%.
+	fxRates := map[string]float64{"EUR": 1}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "BIG", Currency: "EUR", CurrentPrice: 100, SharesOwned: 60, HalfKellySuggested: 40},
+		{ID: 2, Ticker: "ACME", Currency: "EUR", CurrentPrice: 50, SharesOwned: 50, HalfKellySuggested: 70},
+	}
+	opts := RebalanceOptions{MaxPositionWeight: 50, MinCashBufferPct: 8, MaxCashBufferPct: 12}
+
+	plan := BuildRebalancePlan(stocks, fxRates, 1500, opts)
+	if len(plan.Trades) != 2 {
+		t.Fatalf("expected 2 trades, got %+v", plan.Trades)
+	}
+	trades := make(map[string]RebalanceTrade, len(plan.Trades))
+	for _, trade := range plan.Trades {
+		trades[trade.Ticker] = trade
+	}
+	big, acme := trades["BIG"], trades["ACME"]
+	if big.Action != "Sell" || !big.OverMaxWeight {
+		t.Errorf("BIG: expected an over-cap Sell, got %+v", big)
+	}
+	assertClose(t, big.ValueEUR, 2000, 0.0001, "BIG ValueEUR")
+	if acme.Action != "Buy" || acme.OverMaxWeight {
+		t.Errorf("ACME: expected a Buy under the cap, got %+v", acme)
+	}
+	assertClose(t, acme.TargetWeightPct, 50, 0.0001, "ACME TargetWeight")
+	assertClose(t, acme.ValueEUR, 2500, 0.0001, "ACME ValueEUR")
+	assertClose(t, plan.ProjectedCashEUR, 1000, 0.0001, "ProjectedCashEUR")
+	assertClose(t, plan.CashBuffer.CashPct, 10, 0.0001, "CashBuffer.CashPct")
+	if plan.CashBuffer.Status != CashBandWithin {
+		t.Errorf("expected cash buffer within, got %q", plan.CashBuffer.Status)
+	}
+
+	// Uncapped, ACME's 4,500 EUR buy would overdraw cash; it is scaled to the 3,500 EUR after
+	// BIG's sale minus the 800 EUR (8%) buffer.
+	opts.MaxPositionWeight = 0
+	uncapped := BuildRebalancePlan(stocks, fxRates, 1500, opts)
+	for _, trade := range uncapped.Trades {
+		if trade.Ticker == "ACME" {
+			assertClose(t, trade.ValueEUR, 2700, 0.0001, "scaled ACME ValueEUR")
+			if trade.LimitedBy != "cash_buffer" {
+				t.Errorf("ACME LimitedBy: got %q want cash_buffer", trade.LimitedBy)
+			}
+		}
+	}
+	assertClose(t, uncapped.ProjectedCashEUR, 800, 0.0001, "uncapped ProjectedCashEUR")
+	if uncapped.CashBuffer.Status != CashBandWithin {
+		t.Errorf("expected cash buffer within, got %q", uncapped.CashBuffer.Status)
+	}
+}
+
+func TestBuildRebalancePlanNeverProjectsNegativeCash(t *testing.T) {
+	t.Parallel()
+	// Two 80% targets on 1,000 EUR of cash and no buffer: 1,600 EUR of buys are scaled to 500 EUR
+	// each, then rounded down to 16 ONE (480) and 7 TWO (490).
+	fxRates := map[string]float64{"EUR": 1}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "ONE", Currency: "EUR", CurrentPrice: 30, SharesOwned: 0, HalfKellySuggested: 80},
+		{ID: 2, Ticker: "TWO", Currency: "EUR", CurrentPrice: 70, SharesOwned: 0, HalfKellySuggested: 80},
+	}
+
+	plan := BuildRebalancePlan(stocks, fxRates, 1000, RebalanceOptions{WholeShares: true})
+	if len(plan.Trades) != 2 {
+		t.Fatalf("expected 2 trades, got %+v", plan.Trades)
+	}
+	assertClose(t, plan.ProjectedCashEUR, 30, 0.0001, "ProjectedCashEUR")
+
+	// Cash already below the buffer leaves nothing to buy with.
+	plan = BuildRebalancePlan(stocks, fxRates, 1000, RebalanceOptions{MinCashBufferPct: 100})
+	if len(plan.Trades) != 0 || len(plan.Skipped) != 2 || plan.Skipped[0].SkipReason != "no cash above the minimum buffer" {
+		t.Errorf("expected both buys skipped for the buffer, got trades %+v skipped %+v", plan.Trades, plan.Skipped)
+	}
+	assertClose(t, plan.ProjectedCashEUR, 1000, 0.0001, "ProjectedCashEUR")
+}
+
+func TestBuildRebalancePlanRoundsToWholeShares(t *testing.T) {
+	t.Parallel()
+	// USD trades at 1.25 per EUR: a 1,000 EUR target at 300 USD is 4.1667 shares.
+	fxRates := map[string]float64{"EUR": 1, "USD": 1.25}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "ACME", Currency: "USD", CurrentPrice: 300, SharesOwned: 0, HalfKellySuggested: 10},
+		{ID: 2, Ticker: "TRIM", Currency: "USD", CurrentPrice: 50, SharesOwned: 50, HalfKellySuggested: 15},
+	}
+
+	fractional := BuildRebalancePlan(stocks, fxRates, 8000, RebalanceOptions{})
+	if len(fractional.Trades) != 2 {
+		t.Fatalf("expected 2 fractional trades, got %+v", fractional.Trades)
+	}
+
+	plan := BuildRebalancePlan(stocks, fxRates, 8000, RebalanceOptions{WholeShares: true})
+	if len(plan.Trades) != 2 {
+		t.Fatalf("expected 2 trades, got %+v", plan.Trades)
+	}
+	trades := make(map[string]RebalanceTrade, len(plan.Trades))
+	for _, trade := range plan.Trades {
+		trades[trade.Ticker] = trade
+	}
+
+	acme := trades["ACME"]
+	if acme.Action != "Buy" || acme.Shares != 4 {
+		t.Fatalf("ACME: got %s %.4f shares, want Buy 4", acme.Action, acme.Shares)
+	}
+	assertClose(t, acme.ValueEUR, 960, 0.0001, "ACME ValueEUR")
+	assertClose(t, acme.ProjectedWeightPct, 9.6, 0.0001, "ACME ProjectedWeight")
+
+	// TRIM holds 2,000 EUR (20%) against a 15% target: sell 500 EUR = 12.5 shares -> 12.
+	trim := trades["TRIM"]
+	if trim.Action != "Sell" || trim.Shares != 12 {
+		t.Fatalf("TRIM: got %s %.4f shares, want Sell 12", trim.Action, trim.Shares)
+	}
+	assertClose(t, trim.ProjectedWeightPct, 15.2, 0.0001, "TRIM ProjectedWeight")
+	assertClose(t, plan.ProjectedCashEUR, 8000-960+480, 0.0001, "ProjectedCashEUR")
+}
+
+func TestRecommendKellyUtilizationTrimsOverLeveredPortfolioProportionally(t *testing.T) {
+	t.Parallel()
+	fxRates := map[string]float64{"EUR": 1}
+	stocks := []models.Stock{
+		{ID: 1, Ticker: "AAA", Currency: "EUR", CurrentPrice: 10, SharesOwned: 570},
+		{ID: 2, Ticker: "BBB", Currency: "EUR", CurrentPrice: 10, SharesOwned: 380},
+		{ID: 3, Ticker: "WATCH", Currency: "EUR", CurrentPrice: 10, SharesOwned: 0},
+	}
+	opts := KellyUtilizationOptions{Min: 0.75, Max: 0.85, MaxPositionWeight: 15, Rebalance: RebalanceOptions{MinCashBufferPct: 8}}
+
+	// 9,500 invested of 10,000 total: 0.95 utilization, scaled to the 0.80 midpoint.
+	rec := RecommendKellyUtilization(stocks, fxRates, 500, opts)
+
+	if rec.Status != "over" {
+		t.Fatalf("Status: got %q want over", rec.Status)
+	}
+	assertClose(t, rec.Utilization, 0.95, 0.0001, "Utilization")
+	assertClose(t, rec.ScaleFactor, 0.80/0.95, 0.0001, "ScaleFactor")
+	if len(rec.Plan.Trades) != 2 {
+		t.Fatalf("expected trims for both held positions, got %+v", rec.Plan.Trades)
+	}
+	for _, trade := range rec.Plan.Trades {
+		if trade.Action != "Sell" {
+			t.Fatalf("%s: expected Sell, got %s", trade.Ticker, trade.Action)
+		}
+		// Every position shrinks by the same fraction.
+		assertClose(t, trade.ProjectedWeightPct/trade.CurrentWeightPct, rec.ScaleFactor, 0.0001, trade.Ticker+" scale")
+	}
+	assertClose(t, rec.Plan.Trades[0].ValueEUR, 5700*(1-0.80/0.95), 0.0001, "AAA trim")
+	assertClose(t, rec.ProjectedUtilization, 0.80, 0.0001, "ProjectedUtilization")
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Sector target statuses reported in PortfolioMetrics.SectorTargetStatus
+const (
+	SectorTargetUnder  = "under"
+	SectorTargetWithin = "within"
+	SectorTargetOver   = "over"
+)
+
+// SectorTarget is a sector's target allocation range as fractions 0–1 of invested value.
+type SectorTarget struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// DefaultMaxSectorWeight is the sector weight (% of invested value) above which a sector_overexposure
+// alert is raised.
+const DefaultMaxSectorWeight = 30.0
+
+// SectorExposure is a sector's share of invested value.
+type SectorExposure struct {
+	Sector string
+	Weight float64 // Percent 0–100
+}
+
+// OverexposedSectors returns the named sectors in weights (fractions 0–1, as in
+// PortfolioMetrics.SectorWeights) above maxPct percent, heaviest first. maxPct <= 0 disables the check.
+func OverexposedSectors(weights map[string]float64, maxPct float64) []SectorExposure {
+	if maxPct <= 0 {
+		return nil
+	}
+	var over []SectorExposure
+	for sector, weight := range weights {
+		if strings.TrimSpace(sector) == "" || weight*100 <= maxPct {
+			continue
+		}
+		over = append(over, SectorExposure{Sector: sector, Weight: weight * 100})
+	}
+	sort.Slice(over, func(i, j int) bool {
+		if over[i].Weight != over[j].Weight {
+			return over[i].Weight > over[j].Weight
+		}
+		return over[i].Sector < over[j].Sector
+	})
+	return over
+}
+
+// ApplySectorTargets compares metrics.SectorWeights with the target ranges keyed by sector and fills
+// SectorTargetDeviation and SectorTargetStatus for every targeted sector. The deviation is the distance
+// (fraction 0–1) outside the range: negative below Min, positive above Max, 0 within it. Sector names
+// match case-insensitively after NormalizeSector; a targeted sector with no holdings is under target.
+// Held sectors without a target are left out.
+func ApplySectorTargets(metrics *PortfolioMetrics, targets map[string]SectorTarget) {
+	if len(targets) == 0 {
+		return
+	}
+
+	actual := make(map[string]float64, len(metrics.SectorWeights))
+	for sector, weight := range metrics.SectorWeights {
+		actual[sectorTargetKey(sector)] += weight
+	}
+
+	metrics.SectorTargetDeviation = make(map[string]float64, len(targets))
+	metrics.SectorTargetStatus = make(map[string]string, len(targets))
+	for sector, target := range targets {
+		weight := actual[sectorTargetKey(sector)]
+		deviation, status := 0.0, SectorTargetWithin
+		switch {
+		case weight < target.Min:
+			deviation, status = weight-target.Min, SectorTargetUnder
+		case weight > target.Max:
+			deviation, status = weight-target.Max, SectorTargetOver
+		}
+		metrics.SectorTargetDeviation[sector] = deviation
+		metrics.SectorTargetStatus[sector] = status
+	}
+}
+
+// LookupSectorTarget returns the target range for sector, matching names as ApplySectorTargets does.
+func LookupSectorTarget(targets map[string]SectorTarget, sector string) (SectorTarget, bool) {
+	key := sectorTargetKey(sector)
+	for name, target := range targets {
+		if sectorTargetKey(name) == key {
+			return target, true
+		}
+	}
+	return SectorTarget{}, false
+}
+
+func sectorTargetKey(sector string) string {
+	return strings.ToLower(models.NormalizeSector(strings.TrimSpace(sector)))
+}
+
+// SectorTargetsSettingKey is the UserSettings key holding a user's sector targets table
+// (GET/POST /settings/sector-targets).
+const SectorTargetsSettingKey = "sector_targets"
+
+// LoadSectorTargets returns the user's saved sector targets as fractions 0–1 keyed by sector, or nil
+// when none are saved. The Cash row is skipped because sector weights cover invested value only.
+func LoadSectorTargets(db *gorm.DB, userID uint) (map[string]SectorTarget, error) {
+	var setting models.UserSettings
+	if err := db.Where("user_id = ? AND key = ?", userID, SectorTargetsSettingKey).First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var payload struct {
+		Rows []struct {
+			Sector string `json:"sector"`
+			Min    int    `json:"min"`
+			Max    int    `json:"max"`
+		} `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(setting.Value), &payload); err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]SectorTarget, len(payload.Rows))
+	for _, row := range payload.Rows {
+		if strings.EqualFold(strings.TrimSpace(row.Sector), "cash") {
+			continue
+		}
+		targets[row.Sector] = SectorTarget{Min: float64(row.Min) / 100, Max: float64(row.Max) / 100}
+	}
+	return targets, nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestApplySectorTargetsFlagsDeviations(t *testing.T) {
+	t.Parallel()
+	stocks := []models.Stock{
+		{Ticker: "NOVO", Sector: "Healthcare", Currency: "EUR", SharesOwned: 50, CurrentPrice: 10},
+		{Ticker: "MSFT", Sector: "Tech", Currency: "EUR", SharesOwned: 15, CurrentPrice: 10},
+		{Ticker: "JPM", Sector: "Financials", Currency: "EUR", SharesOwned: 35, CurrentPrice: 10},
+	}
+	metrics := CalculatePortfolioMetrics(stocks, map[string]float64{"EUR": 1}, "EUR", DefaultMetricsConfig())
+
+	ApplySectorTargets(&metrics, map[string]SectorTarget{
+		"Healthcare": {Min: 0.30, Max: 0.35},
+		"Technology": {Min: 0.15, Max: 0.15},
+		"Energy":     {Min: 0.05, Max: 0.10},
+	})
+
+	assertClose(t, metrics.SectorTargetDeviation["Healthcare"], 0.15, 1e-9, "Healthcare deviation")
+	assertClose(t, metrics.SectorTargetDeviation["Technology"], 0, 1e-9, "Technology deviation")
+	assertClose(t, metrics.SectorTargetDeviation["Energy"], -0.05, 1e-9, "Energy deviation")
+	want := map[string]string{
+		"Healthcare": SectorTargetOver,
+		"Technology": SectorTargetWithin,
+		"Energy":     SectorTargetUnder,
+	}
+	for sector, status := range want {
+		if metrics.SectorTargetStatus[sector] != status {
+			t.Errorf("%s: got status %q want %q", sector, metrics.SectorTargetStatus[sector], status)
+		}
+	}
+	if _, ok := metrics.SectorTargetStatus["Financials"]; ok {
+		t.Error("expected untargeted Financials to be left out")
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// ConsolidatedPosition is one economic exposure made of one or more share-class positions.
+// Metrics are value-weighted across the share classes; Weight is a fraction 0–1 of invested value.
+type ConsolidatedPosition struct {
+	Symbol             string   `json:"symbol"`  // Canonical ticker
+	Tickers            []string `json:"tickers"` // Share-class tickers held under this symbol
+	CompanyName        string   `json:"company_name"`
+	Sector             string   `json:"sector"`
+	ValueEUR           float64  `json:"value_eur"`
+	Weight             float64  `json:"weight"`
+	ExpectedValue      float64  `json:"expected_value"`
+	Volatility         float64  `json:"volatility"`
+	Beta               float64  `json:"beta"`
+	HalfKellySuggested float64  `json:"half_kelly_suggested"` // Largest suggestion among the share classes
+}
+
+// CanonicalTicker returns the canonical symbol for a share-class ticker, or the ticker itself.
+func CanonicalTicker(ticker string, aliases map[string]string) string {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	if canonical, ok := aliases[ticker]; ok {
+		return canonical
+	}
+	return ticker
+}
+
+// ConsolidateShareClasses groups held positions by canonical ticker so share classes of the same
+// company count as one exposure. Positions without an FX rate are skipped. Lines are ordered by
+// value, largest first.
+func ConsolidateShareClasses(stocks []models.Stock, fxRates map[string]float64, aliases map[string]string) []ConsolidatedPosition {
+	positionsEUR, invested := positionValuesEUR(stocks, fxRates)
+
+	bySymbol := make(map[string]*ConsolidatedPosition)
+	order := make([]string, 0, len(stocks))
+	for i, stock := range stocks {
+		value := positionsEUR[i]
+		if value <= 0 {
+			continue
+		}
+		symbol := CanonicalTicker(stock.Ticker, aliases)
+		line, ok := bySymbol[symbol]
+		if !ok {
+			line = &ConsolidatedPosition{Symbol: symbol, CompanyName: stock.CompanyName, Sector: stock.Sector}
+			bySymbol[symbol] = line
+			order = append(order, symbol)
+		}
+		line.Tickers = append(line.Tickers, stock.Ticker)
+		line.ValueEUR += value
+		line.ExpectedValue += stock.ExpectedValue * value
+		line.Volatility += stock.Volatility * value
+		line.Beta += stock.Beta * value
+		if stock.HalfKellySuggested > line.HalfKellySuggested {
+			line.HalfKellySuggested = stock.HalfKellySuggested
+		}
+	}
+
+	lines := make([]ConsolidatedPosition, 0, len(order))
+	for _, symbol := range order {
+		line := bySymbol[symbol]
+		line.ExpectedValue /= line.ValueEUR
+		line.Volatility /= line.ValueEUR
+		line.Beta /= line.ValueEUR
+		if invested > 0 {
+			line.Weight = line.ValueEUR / invested
+		}
+		lines = append(lines, *line)
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].ValueEUR > lines[j].ValueEUR })
+	return lines
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestConsolidateShareClassesMergesAliasesIntoOneLine(t *testing.T) {
+	t.Parallel()
+	stocks := []models.Stock{
+		{Ticker: "GOOGL", CompanyName: "Alphabet", Sector: "Technology", Currency: "USD", CurrentPrice: 200, SharesOwned: 10, ExpectedValue: 10, Volatility: 30, Beta: 1.0, HalfKellySuggested: 6},
+		{Ticker: "goog", CompanyName: "Alphabet", Sector: "Technology", Currency: "USD", CurrentPrice: 200, SharesOwned: 30, ExpectedValue: 6, Volatility: 30, Beta: 1.2, HalfKellySuggested: 4},
+		{Ticker: "SAP", CompanyName: "SAP", Sector: "Technology", Currency: "EUR", CurrentPrice: 100, SharesOwned: 20, ExpectedValue: 8, Volatility: 25, Beta: 0.9},
+		{Ticker: "SOLD", Currency: "EUR", CurrentPrice: 50, SharesOwned: 0},
+	}
+	fxRates := map[string]float64{"EUR": 1, "USD": 2}
+
+	lines := ConsolidateShareClasses(stocks, fxRates, map[string]string{"GOOG": "GOOGL"})
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 exposure lines, got %+v", lines)
+	}
+	alphabet := lines[0]
+	if alphabet.Symbol != "GOOGL" || len(alphabet.Tickers) != 2 {
+		t.Fatalf("expected GOOGL line with both share classes first, got %+v", alphabet)
+	}
+	// 1,000 EUR + 3,000 EUR of 6,000 EUR invested
+	assertClose(t, alphabet.ValueEUR, 4000, 1e-9, "value_eur")
+	assertClose(t, alphabet.Weight, 4000.0/6000, 1e-9, "weight")
+	assertClose(t, alphabet.ExpectedValue, (10*1000+6*3000)/4000.0, 1e-9, "expected_value")
+	assertClose(t, alphabet.Beta, (1.0*1000+1.2*3000)/4000.0, 1e-9, "beta")
+	assertClose(t, alphabet.HalfKellySuggested, 6, 1e-9, "half_kelly_suggested")
+	if lines[1].Symbol != "SAP" || len(lines[1].Tickers) != 1 {
+		t.Errorf("expected SAP to stay a single line, got %+v", lines[1])
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Alert types raised when a stock's data is refreshed.
+const (
+	AlertTypeEVChange = "ev_change"
+	AlertTypeBuyZone  = "buy_zone"
+)
+
+// DefaultAlertCooldownHours is how long an ev_change or buy_zone alert suppresses another one of
+// the same type for the same stock when the portfolio has no settings row.
+const DefaultAlertCooldownHours = 12
+
+// AlertCooldown returns the dedup window configured in settings (0 = off).
+func AlertCooldown(settings models.PortfolioSettings) time.Duration {
+	if settings.AlertCooldownHours <= 0 {
+		return 0
+	}
+	return time.Duration(settings.AlertCooldownHours) * time.Hour
+}
+
+// RaiseStockAlert stores alert unless one of the same type for the same stock was created within
+// cooldown before alert.CreatedAt (cooldown <= 0 disables the check). It reports whether an alert
+// was created.
+func RaiseStockAlert(db *gorm.DB, alert models.Alert, cooldown time.Duration) (bool, error) {
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	if cooldown > 0 {
+		var existing int64
+		if err := db.Model(&models.Alert{}).
+			Where("portfolio_id = ? AND stock_id = ? AND alert_type = ? AND created_at > ?", alert.PortfolioID, alert.StockID, alert.AlertType, alert.CreatedAt.Add(-cooldown)).
+			Count(&existing).Error; err != nil {
+			return false, fmt.Errorf("failed to check existing %s alerts: %w", alert.AlertType, err)
+		}
+		if existing > 0 {
+			return false, nil
+		}
+	}
+	if err := db.Create(&alert).Error; err != nil {
+		return false, fmt.Errorf("failed to create %s alert: %w", alert.AlertType, err)
+	}
+	return true, nil
+}
+
+// RaiseStockUpdateAlerts raises the alerts due after a stock's data was refreshed: ev_change when
+// alerts are enabled and EV moved by more than settings.AlertThresholdEV from oldEV, and buy_zone
+// while the price is inside the buy zone. The scheduled update and manual refreshes both call it,
+// so each alert goes through the same settings.AlertCooldownHours dedup whichever path ran first.
+// It returns the number of alerts created.
+func RaiseStockUpdateAlerts(db *gorm.DB, stock *models.Stock, oldEV float64, settings models.PortfolioSettings, now time.Time) (int, error) {
+	var alerts []models.Alert
+	evChange := stock.ExpectedValue - oldEV
+	if settings.AlertsEnabled && (evChange > settings.AlertThresholdEV || evChange < -settings.AlertThresholdEV) {
+		alerts = append(alerts, models.Alert{
+			PortfolioID: stock.PortfolioID,
+			StockID:     stock.ID,
+			Ticker:      stock.Ticker,
+			AlertType:   AlertTypeEVChange,
+			Severity:    EVChangeSeverity(evChange),
+			Message:     fmt.Sprintf("EV changed from %.2f%% to %.2f%%", oldEV, stock.ExpectedValue),
+			CreatedAt:   now,
+		})
+	}
+	if stock.CurrentPrice >= stock.BuyZoneMin && stock.CurrentPrice <= stock.BuyZoneMax {
+		alerts = append(alerts, models.Alert{
+			PortfolioID: stock.PortfolioID,
+			StockID:     stock.ID,
+			Ticker:      stock.Ticker,
+			AlertType:   AlertTypeBuyZone,
+			Message:     fmt.Sprintf("%s is in buy zone at %.2f", stock.Ticker, stock.CurrentPrice),
+			CreatedAt:   now,
+		})
+	}
+
+	created := 0
+	for _, alert := range alerts {
+		ok, err := RaiseStockAlert(db, alert, AlertCooldown(settings))
+		if err != nil {
+			return created, err
+		}
+		if ok {
+			created++
+		}
+	}
+	return created, nil
+}
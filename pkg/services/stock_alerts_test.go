@@ -0,0 +1,38 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRaiseStockUpdateAlertsUsesDefaultCooldownWithoutSettings(t *testing.T) {
+	t.Parallel()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "stock-alerts-test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.PortfolioSettings{}, &models.Alert{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	settings := LoadPortfolioSettings(db, 1)
+	if got := AlertCooldown(settings); got != DefaultAlertCooldownHours*time.Hour {
+		t.Fatalf("cooldown without settings: got %v want %dh", got, DefaultAlertCooldownHours)
+	}
+
+	stock := &models.Stock{ID: 7, PortfolioID: 1, Ticker: "ACME", CurrentPrice: 50, BuyZoneMin: 40, BuyZoneMax: 60}
+	now := time.Now()
+	for i, want := range []int{1, 0} {
+		created, err := RaiseStockUpdateAlerts(db, stock, 0, settings, now.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("RaiseStockUpdateAlerts: %v", err)
+		}
+		if created != want {
+			t.Errorf("run %d: created %d alerts, want %d", i, created, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+)
+
+// defaultExchangeSuffixes maps exchange codes and suffixes as users type them (Bloomberg, MIC,
+// Yahoo, Alpha Vantage) to the canonical suffix. An empty canonical suffix means a US listing,
+// which carries no suffix.
+var defaultExchangeSuffixes = map[string]string{
+	"CO": "CO", "CPH": "CO", "CSE": "CO", "XCSE": "CO", "DC": "CO",
+	"ST": "ST", "STO": "ST", "XSTO": "ST",
+	"HE": "HE", "HEL": "HE", "XHEL": "HE", "FH": "HE",
+	"OL": "OL", "OSL": "OL", "XOSL": "OL", "NO": "OL",
+	"LON": "LON", "L": "LON", "LSE": "LON", "XLON": "LON", "LN": "LON",
+	"DE": "DE", "XETRA": "DE", "XETR": "DE", "FRA": "DE", "GY": "DE", "GR": "DE",
+	"AS": "AS", "AMS": "AS", "XAMS": "AS", "NA": "AS",
+	"PA": "PA", "PAR": "PA", "XPAR": "PA", "FP": "PA",
+	"SW": "SW", "SWX": "SW", "XSWX": "SW", "VX": "SW",
+	"MI": "MI", "MIL": "MI", "XMIL": "MI", "IM": "MI",
+	"MC": "MC", "MCE": "MC", "XMAD": "MC", "SM": "MC",
+	"BR": "BR", "XBRU": "BR", "BB": "BR",
+	"TO": "TO", "TSX": "TO", "XTSE": "TO", "CN": "TO",
+	"US": "", "UN": "", "UW": "", "UQ": "", "NYSE": "", "NASDAQ": "", "XNYS": "", "XNAS": "",
+}
+
+// TickerRules configures NormalizeTicker.
+type TickerRules struct {
+	ExchangeSuffixes map[string]string // Exchange code or suffix -> canonical suffix ("" = none)
+	ClassSeparator   string            // Joins base symbol and share class (e.g. "-" in NOVO-B)
+}
+
+// DefaultTickerRules returns the built-in exchange suffixes with "-" as the share-class separator.
+func DefaultTickerRules() TickerRules {
+	suffixes := make(map[string]string, len(defaultExchangeSuffixes))
+	for code, suffix := range defaultExchangeSuffixes {
+		suffixes[code] = suffix
+	}
+	return TickerRules{ExchangeSuffixes: suffixes, ClassSeparator: "-"}
+}
+
+// TickerRulesFromConfig layers TICKER_EXCHANGE_SUFFIXES and TICKER_CLASS_SEPARATOR over the defaults.
+func TickerRulesFromConfig(cfg *config.Config) TickerRules {
+	rules := DefaultTickerRules()
+	if cfg == nil {
+		return rules
+	}
+	for code, suffix := range cfg.TickerExchangeSuffixes {
+		rules.ExchangeSuffixes[code] = suffix
+	}
+	if cfg.TickerClassSeparator != "" {
+		rules.ClassSeparator = cfg.TickerClassSeparator
+	}
+	return rules
+}
+
+// StoredTicker returns the ticker stocks are stored and looked up under: NormalizeTicker's form
+// when NORMALIZE_TICKERS is on, else ticker unchanged. Every lookup or creation from user input goes
+// through it, so "BRK.B" finds the stock stored as "BRK-B".
+func StoredTicker(ticker string, cfg *config.Config) string {
+	if cfg == nil || !cfg.NormalizeTickers {
+		return ticker
+	}
+	if normalized := NormalizeTicker(ticker, TickerRulesFromConfig(cfg)); normalized != "" {
+		return normalized
+	}
+	return ticker
+}
+
+// NormalizeTicker canonicalizes a ticker to BASE[.SUFFIX]: upper case, a known exchange given as a
+// suffix ("NOVO-B.CO"), a trailing code ("NOVO B CPH") or a prefix ("CPH:NOVO-B") becomes its canonical
+// suffix, and share-class separators in the base (" ", ".", "/", "_", "-") become rules.ClassSeparator.
+// A trailing ".B" that is not a known exchange is a share class, so "BRK.B" becomes "BRK-B".
+// Different listings (NVO vs NOVO-B.CO) stay different.
+func NormalizeTicker(ticker string, rules TickerRules) string {
+	normalized := strings.Join(strings.Fields(strings.ToUpper(ticker)), " ")
+	if normalized == "" {
+		return ""
+	}
+
+	base, suffix := normalized, ""
+	hasExchange := false
+	if prefix, rest, ok := strings.Cut(normalized, ":"); ok {
+		if canonical, known := rules.ExchangeSuffixes[strings.TrimSpace(prefix)]; known {
+			base, suffix, hasExchange = strings.TrimSpace(rest), canonical, true
+		}
+	}
+	if !hasExchange {
+		if i := strings.LastIndex(normalized, " "); i > 0 {
+			if canonical, known := rules.ExchangeSuffixes[normalized[i+1:]]; known {
+				base, suffix, hasExchange = normalized[:i], canonical, true
+			}
+		}
+	}
+	if !hasExchange {
+		if i := strings.LastIndex(normalized, "."); i > 0 {
+			if canonical, known := rules.ExchangeSuffixes[normalized[i+1:]]; known {
+				base, suffix = normalized[:i], canonical
+			}
+		}
+	}
+
+	parts := strings.FieldsFunc(base, func(r rune) bool {
+		return r == ' ' || r == '.' || r == '/' || r == '_' || r == '-'
+	})
+	base = strings.Join(parts, rules.ClassSeparator)
+	if base == "" {
+		return normalized
+	}
+	if suffix == "" {
+		return base
+	}
+	return base + "." + suffix
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/art-pro/stock-backend/pkg/config"
+)
+
+func TestNormalizeTickerCanonicalizesRealWorldFormats(t *testing.T) {
+	t.Parallel()
+	rules := DefaultTickerRules()
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"NOVO-B.CO", "NOVO-B.CO"},
+		{"novo b cph", "NOVO-B.CO"},
+		{"NOVO.B.CO", "NOVO-B.CO"},
+		{"CPH:NOVO B", "NOVO-B.CO"},
+		{"NVO", "NVO"},
+		{"BRK.B", "BRK-B"},
+		{"BRK/B", "BRK-B"},
+		{"BRK B US", "BRK-B"},
+		{"NASDAQ:AAPL", "AAPL"},
+		{"RDSA.AS", "RDSA.AS"},
+		{"RDSA NA", "RDSA.AS"},
+		{"SAP GY", "SAP.DE"},
+		{"VOD.L", "VOD.LON"},
+		{" ERIC-B  STO ", "ERIC-B.ST"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeTicker(tt.input, rules); got != tt.want {
+			t.Errorf("NormalizeTicker(%q): got %q want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTickerRulesFromConfigOverridesDefaults(t *testing.T) {
+	t.Parallel()
+	rules := TickerRulesFromConfig(&config.Config{
+		TickerExchangeSuffixes: map[string]string{"LSE": "L", "L": "L"},
+		TickerClassSeparator:   ".",
+	})
+	if got := NormalizeTicker("VOD LSE", rules); got != "VOD.L" {
+		t.Errorf("custom suffix: got %q want VOD.L", got)
+	}
+	if got := NormalizeTicker("BRK-B", rules); got != "BRK.B" {
+		t.Errorf("custom class separator: got %q want BRK.B", got)
+	}
+	if got := NormalizeTicker("NOVO B CPH", DefaultTickerRules()); got != "NOVO-B.CO" {
+		t.Errorf("defaults must not be modified by config overrides, got %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stock.TradingStatus values
+const (
+	TradingStatusActive = "active"
+	TradingStatusHalted = "halted" // Halted or delisted: no usable price, metrics keep their last-known values
+)
+
+// AlertTypeTradingHalted marks a stock whose price updates stopped producing a usable price.
+const AlertTypeTradingHalted = "trading_halted"
+
+// ErrTradingHalted is returned when the provider signals that a security no longer trades
+// (e.g. its latest quote is older than HALTED_QUOTE_MAX_AGE_DAYS).
+var ErrTradingHalted = errors.New("security halted or delisted")
+
+// IsImplausiblePrice reports whether a fetched price cannot be used for metrics: it is not positive,
+// or it is more than maxMove times above or below lastPrice (maxMove <= 1 or no last price skips that check).
+func IsImplausiblePrice(price, lastPrice, maxMove float64) bool {
+	if price <= 0 {
+		return true
+	}
+	if lastPrice <= 0 || maxMove <= 1 {
+		return false
+	}
+	return price > lastPrice*maxMove || price < lastPrice/maxMove
+}
+
+// checkQuoteTrading returns ErrTradingHalted when the quote's latest trading day is more than
+// HALTED_QUOTE_MAX_AGE_DAYS before now. A missing or unparsable day passes.
+func (s *ExternalAPIService) checkQuoteTrading(ticker string, quote *AlphaVantageQuote, now time.Time) error {
+	maxAgeDays := s.cfg.HaltedQuoteMaxAgeDays
+	if maxAgeDays <= 0 {
+		return nil
+	}
+	lastTraded, err := time.Parse("2006-01-02", quote.GlobalQuote.LatestTradingDay)
+	if err != nil {
+		return nil
+	}
+	if now.Sub(lastTraded) > time.Duration(maxAgeDays)*24*time.Hour {
+		return fmt.Errorf("%w: %s last traded %s", ErrTradingHalted, ticker, quote.GlobalQuote.LatestTradingDay)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+// TWRValuePoint is the portfolio's end-of-day value (positions + cash, EUR).
+type TWRValuePoint struct {
+	Date     time.Time
+	ValueEUR float64
+}
+
+// TWRCashFlow is an external cash flow in EUR: positive for deposits, negative for withdrawals.
+type TWRCashFlow struct {
+	Date      time.Time
+	AmountEUR float64
+}
+
+// TWRSubPeriod is a stretch between external cash flows, measured from the value after the flow
+// that opened it to the value at its last snapshot.
+type TWRSubPeriod struct {
+	From          string  `json:"from"` // YYYY-MM-DD
+	To            string  `json:"to"`
+	CashFlowEUR   float64 `json:"cash_flow_eur"`   // Flow added at the start of the period
+	StartValueEUR float64 `json:"start_value_eur"` // Value at From plus CashFlowEUR
+	EndValueEUR   float64 `json:"end_value_eur"`
+	ReturnPct     float64 `json:"return_pct"`
+}
+
+// TWRResult is the time-weighted return over a range of snapshots.
+type TWRResult struct {
+	From         string         `json:"from"` // Requested range (YYYY-MM-DD), set by the caller
+	To           string         `json:"to"`
+	TWRPct       *float64       `json:"twr_pct"` // nil with fewer than two snapshots
+	NetFlowsEUR  float64        `json:"net_flows_eur"`
+	StartValue   float64        `json:"start_value_eur"`
+	EndValue     float64        `json:"end_value_eur"`
+	SubPeriods   []TWRSubPeriod `json:"sub_periods"`
+	SnapshotDays int            `json:"snapshot_days"`
+}
+
+// TimeWeightedReturn links the returns of the sub-periods delimited by external cash flows
+// geometrically, so deposits and withdrawals do not count as performance. Points are end-of-day
+// values sorted ascending. A flow dated after one snapshot and on or before the next is assumed to
+// arrive at the start of that interval: the sub-period it opens starts at the earlier value plus the
+// flow. Flows on or before the first snapshot are already in its value and are ignored, as are flows
+// after the last. Sub-periods that start at a non-positive value cannot be measured and are skipped.
+func TimeWeightedReturn(points []TWRValuePoint, flows []TWRCashFlow) TWRResult {
+	result := TWRResult{SubPeriods: []TWRSubPeriod{}, SnapshotDays: len(points)}
+	if len(points) < 2 {
+		return result
+	}
+	result.StartValue = points[0].ValueEUR
+	result.EndValue = points[len(points)-1].ValueEUR
+
+	sorted := append([]TWRCashFlow(nil), flows...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	growth := 1.0
+	start := 0
+	period := TWRSubPeriod{From: points[0].Date.Format("2006-01-02"), StartValueEUR: points[0].ValueEUR}
+	closePeriod := func(end int) {
+		if end == start {
+			return
+		}
+		period.To = points[end].Date.Format("2006-01-02")
+		period.EndValueEUR = points[end].ValueEUR
+		if period.StartValueEUR <= 0 {
+			return
+		}
+		period.ReturnPct = (period.EndValueEUR/period.StartValueEUR - 1) * 100
+		growth *= period.EndValueEUR / period.StartValueEUR
+		result.SubPeriods = append(result.SubPeriods, period)
+	}
+
+	next := 0
+	for next < len(sorted) && !sorted[next].Date.After(points[0].Date) {
+		next++
+	}
+	for i := 1; i < len(points); i++ {
+		var flow float64
+		for next < len(sorted) && !sorted[next].Date.After(points[i].Date) {
+			flow += sorted[next].AmountEUR
+			next++
+		}
+		if math.Abs(flow) < 1e-9 {
+			continue
+		}
+		result.NetFlowsEUR += flow
+		closePeriod(i - 1)
+		start = i - 1
+		period = TWRSubPeriod{
+			From:          points[i-1].Date.Format("2006-01-02"),
+			CashFlowEUR:   flow,
+			StartValueEUR: points[i-1].ValueEUR + flow,
+		}
+	}
+	closePeriod(len(points) - 1)
+
+	twr := (growth - 1) * 100
+	result.TWRPct = &twr
+	return result
+}
+
+// ExternalCashFlows converts Deposit and Withdraw operations to EUR flows at the FX rate recorded
+// on the operation (else the current rate). Operations with an unparseable trade date are skipped.
+func ExternalCashFlows(ops []models.Operation, fxRates map[string]float64) []TWRCashFlow {
+	var flows []TWRCashFlow
+	for _, op := range ops {
+		sign := 1.0
+		switch op.OperationType {
+		case "Deposit":
+		case "Withdraw":
+			sign = -1
+		default:
+			continue
+		}
+		date, err := parseTradeDate(op.TradeDate)
+		if err != nil {
+			continue
+		}
+		amount := op.Amount
+		if amount == 0 {
+			amount = op.Quantity
+		}
+		flows = append(flows, TWRCashFlow{Date: date, AmountEUR: sign * math.Abs(amount) / lotRate(op, fxRates)})
+	}
+	return flows
+}
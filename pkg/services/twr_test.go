@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/art-pro/stock-backend/pkg/models"
+)
+
+func TestTimeWeightedReturnExcludesMidPeriodDeposit(t *testing.T) {
+	t.Parallel()
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	// +10% to 1,100, a 1,000 deposit, then +10% on 2,100 to 2,310: TWR is 1.1 * 1.1 - 1 = 21%,
+	// while the raw value change (2,310 / 1,000) would suggest 131%.
+	points := []TWRValuePoint{
+		{Date: day(2), ValueEUR: 1000},
+		{Date: day(3), ValueEUR: 1100},
+		{Date: day(4), ValueEUR: 2310},
+	}
+	flows := []TWRCashFlow{
+		{Date: day(1), AmountEUR: 500}, // Before the first snapshot: already in its value
+		{Date: day(4), AmountEUR: 1000},
+	}
+
+	result := TimeWeightedReturn(points, flows)
+	if result.TWRPct == nil {
+		t.Fatal("expected a TWR with three snapshots")
+	}
+	assertClose(t, *result.TWRPct, 21, 1e-9, "TWRPct")
+	assertClose(t, result.NetFlowsEUR, 1000, 1e-9, "NetFlowsEUR")
+	if len(result.SubPeriods) != 2 {
+		t.Fatalf("expected 2 sub-periods split at the deposit, got %+v", result.SubPeriods)
+	}
+	second := result.SubPeriods[1]
+	if second.From != "2026-03-03" || second.To != "2026-03-04" {
+		t.Errorf("second sub-period: got %s..%s", second.From, second.To)
+	}
+	assertClose(t, second.StartValueEUR, 2100, 1e-9, "second StartValueEUR")
+	assertClose(t, second.ReturnPct, 10, 1e-9, "second ReturnPct")
+
+	if single := TimeWeightedReturn(points[:1], flows); single.TWRPct != nil {
+		t.Errorf("expected no TWR from one snapshot, got %v", *single.TWRPct)
+	}
+}
+
+func TestExternalCashFlowsConvertsDepositsAndWithdrawals(t *testing.T) {
+	t.Parallel()
+	ops := []models.Operation{
+		{OperationType: "Deposit", Currency: "USD", Amount: 1100, FXRate: 1.1, TradeDate: "04.03.2026"},
+		{OperationType: "Withdraw", Currency: "EUR", Quantity: 200, TradeDate: "05.03.2026"},
+		{OperationType: "Dividend", Currency: "EUR", Amount: 50, TradeDate: "05.03.2026"},
+	}
+
+	flows := ExternalCashFlows(ops, map[string]float64{"EUR": 1, "USD": 1.2})
+	if len(flows) != 2 {
+		t.Fatalf("expected deposit and withdrawal only, got %+v", flows)
+	}
+	assertClose(t, flows[0].AmountEUR, 1000, 1e-9, "deposit at recorded FX")
+	assertClose(t, flows[1].AmountEUR, -200, 1e-9, "withdrawal")
+}